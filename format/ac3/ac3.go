@@ -0,0 +1,259 @@
+package ac3
+
+// https://www.etsi.org/deliver/etsi_ts/102300_102399/102366/01.04.01_60/ts_102366v010401p.pdf
+// https://www.atsc.org/wp-content/uploads/2015/03/A52-201212-17.pdf
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/checksum"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed ac3.jq
+var ac3FS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.AC3,
+		ProbeOrder:  format.ProbeOrderBinFuzzy, // only sync word is fixed
+		Description: "Dolby Digital (AC-3)",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    func(d *decode.D, _ any) any { return decodeFrames(d, decodeFrame) },
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(ac3FS)
+}
+
+const syncWord = 0x0b77
+
+// bsid 9 and 10 are lower sample rate variants of AC-3, 11-16 are E-AC-3
+const (
+	bsidMaxAC3  = 10
+	bsidMinEAC3 = 11
+	bsidMaxEAC3 = 16
+)
+
+var sampleRateMap = scalar.UToSymU{
+	0: 48000,
+	1: 44100,
+	2: 32000,
+}
+
+// bit rate in kbit/s for frmsizecod/2
+var bitRates = [19]uint64{32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 448, 512, 576, 640}
+
+var acmodNames = scalar.UToScalar{
+	0: {Sym: "dual_mono", Description: "1+1 (Ch1, Ch2)"},
+	1: {Sym: "mono", Description: "1/0 (C)"},
+	2: {Sym: "stereo", Description: "2/0 (L, R)"},
+	3: {Sym: "3_0", Description: "3/0 (L, C, R)"},
+	4: {Sym: "2_1", Description: "2/1 (L, R, S)"},
+	5: {Sym: "3_1", Description: "3/1 (L, C, R, S)"},
+	6: {Sym: "2_2", Description: "2/2 (L, R, SL, SR)"},
+	7: {Sym: "3_2", Description: "3/2 (L, C, R, SL, SR)"},
+}
+
+var bsmodNames = scalar.UToSymStr{
+	0: "main_complete",
+	1: "main_music_and_effects",
+	2: "associated_visually_impaired",
+	3: "associated_hearing_impaired",
+	4: "associated_dialogue",
+	5: "associated_commentary",
+	6: "associated_emergency",
+	7: "associated_voice_over_or_main_karaoke",
+}
+
+var cmixlevNames = scalar.UToDescription{
+	0: "-3.0 dB",
+	1: "-4.5 dB",
+	2: "-6.0 dB",
+	3: "Reserved",
+}
+
+var surmixlevNames = scalar.UToDescription{
+	0: "-3 dB",
+	1: "-6 dB",
+	2: "0",
+	3: "Reserved",
+}
+
+var dsurmodNames = scalar.UToSymStr{
+	0: "not_indicated",
+	1: "not_dolby_surround",
+	2: "dolby_surround",
+	3: "reserved",
+}
+
+var roomtypNames = scalar.UToSymStr{
+	0: "not_indicated",
+	1: "large_room",
+	2: "small_room",
+	3: "reserved",
+}
+
+// dialogue normalization in -dB
+var dialnormMapper = scalar.UToDescription{
+	0: "Reserved",
+}
+
+func ac3FrameBytes(fscod uint64, frmsizecod uint64) int64 {
+	bitRate := bitRates[frmsizecod/2]
+	switch fscod {
+	case 0:
+		return int64(bitRate*2) * 2
+	case 1:
+		return int64(bitRate*96000/44100+(frmsizecod&1)) * 2
+	default:
+		return int64(bitRate*3) * 2
+	}
+}
+
+// crc remainder over a range including the crc itself is zero for valid crc
+func crcValidMapper(d *decode.D, firstBit int64, nBits int64) scalar.Mapper {
+	crc := &checksum.CRC{Bits: 16, Table: checksum.ANSI16Table}
+	d.CopyBits(crc, d.BitBufRange(firstBit, nBits))
+	valid := true
+	for _, b := range crc.Sum(nil) {
+		if b != 0 {
+			valid = false
+		}
+	}
+	return scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		if valid {
+			s.Description = "valid"
+		} else {
+			s.Description = "invalid"
+		}
+		return s, nil
+	})
+}
+
+func decodeFrames(d *decode.D, frameFn func(d *decode.D)) any {
+	frameCount := 0
+	d.FieldArray("frames", func(d *decode.D) {
+		for d.BitsLeft() >= 16 && d.PeekBits(16) == syncWord {
+			d.FieldStruct("frame", frameFn)
+			frameCount++
+		}
+	})
+	if frameCount == 0 {
+		d.Fatalf("no frames found")
+	}
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("trailing", d.BitsLeft())
+	}
+
+	return nil
+}
+
+// audio blocks and auxiliary data are not decoded, errorcheck is the last 16 bits of a frame
+func decodeAudioBlocks(d *decode.D, frameStart int64, frameBits int64) {
+	audioBits := frameStart + frameBits - 16 - d.Pos()
+	if audioBits < 0 {
+		d.Fatalf("bsi outside frame")
+	}
+	d.FieldRawLen("audio_blocks", audioBits)
+	d.FieldU16("crc2", crcValidMapper(d, frameStart+16, frameBits-16), scalar.ActualHex)
+}
+
+func decodeFrame(d *decode.D) {
+	frameStart := d.Pos()
+
+	var frameBits int64
+	d.FieldStruct("syncinfo", func(d *decode.D) {
+		d.FieldU16("syncword", d.AssertU(syncWord), scalar.ActualHex)
+		crc1Pos := d.Pos()
+		d.SeekRel(16)
+		fscod := d.PeekBits(2)
+		frmsizecod := d.PeekBits(8) & 0x3f
+		if fscod == 3 || frmsizecod >= 38 {
+			d.Fatalf("invalid fscod %d or frmsizecod %d", fscod, frmsizecod)
+		}
+		frameBytes := ac3FrameBytes(fscod, frmsizecod)
+		frameBits = frameBytes * 8
+		if frameBits > d.BitsLeft()+32 {
+			d.Fatalf("frame size %d outside buffer", frameBytes)
+		}
+		// crc1 covers first 5/8 of frame excluding sync word
+		frame58Bytes := ((frameBytes >> 2) + (frameBytes >> 4)) << 1
+		d.SeekAbs(crc1Pos)
+		d.FieldU16("crc1", crcValidMapper(d, frameStart+16, (frame58Bytes-2)*8), scalar.ActualHex)
+		d.FieldU2("fscod", sampleRateMap)
+		d.FieldU6("frmsizecod")
+		d.FieldValueU("bit_rate", bitRates[frmsizecod/2]*1000)
+		d.FieldValueU("frame_size", uint64(frameBytes))
+	})
+
+	d.FieldStruct("bsi", func(d *decode.D) {
+		bsid := d.FieldU5("bsid", d.AssertURange(0, bsidMaxAC3))
+		d.FieldU3("bsmod", bsmodNames)
+		acmod := d.FieldU3("acmod", acmodNames)
+		if acmod&1 != 0 && acmod != 1 {
+			d.FieldU2("cmixlev", cmixlevNames)
+		}
+		if acmod&4 != 0 {
+			d.FieldU2("surmixlev", surmixlevNames)
+		}
+		if acmod == 2 {
+			d.FieldU2("dsurmod", dsurmodNames)
+		}
+		d.FieldBool("lfeon")
+
+		programFn := func(d *decode.D, suffix string) {
+			d.FieldU5("dialnorm"+suffix, dialnormMapper)
+			if d.FieldBool("compre" + suffix) {
+				d.FieldU8("compr" + suffix)
+			}
+			if d.FieldBool("langcode" + suffix) {
+				d.FieldU8("langcod" + suffix)
+			}
+			if d.FieldBool("audprodie" + suffix) {
+				d.FieldU5("mixlevel" + suffix)
+				d.FieldU2("roomtyp"+suffix, roomtypNames)
+			}
+		}
+		programFn(d, "")
+		// dual mono has a second set of program fields
+		if acmod == 0 {
+			programFn(d, "2")
+		}
+
+		d.FieldBool("copyrightb")
+		d.FieldBool("origbs")
+		if bsid == 6 {
+			// alternate bit stream syntax (annex D)
+			if d.FieldBool("xbsi1e") {
+				d.FieldU2("dmixmod")
+				d.FieldU3("ltrtcmixlev")
+				d.FieldU3("ltrtsurmixlev")
+				d.FieldU3("lorocmixlev")
+				d.FieldU3("lorosurmixlev")
+			}
+			if d.FieldBool("xbsi2e") {
+				d.FieldU2("dsurexmod")
+				d.FieldU2("dheadphonmod")
+				d.FieldBool("adconvtyp")
+				d.FieldU8("xbsi2")
+				d.FieldBool("encinfo")
+			}
+		} else {
+			if d.FieldBool("timecod1e") {
+				d.FieldU14("timecod1")
+			}
+			if d.FieldBool("timecod2e") {
+				d.FieldU14("timecod2")
+			}
+		}
+		if d.FieldBool("addbsie") {
+			addbsil := d.FieldU6("addbsil")
+			d.FieldRawLen("addbsi", int64(addbsil+1)*8)
+		}
+	})
+
+	decodeAudioBlocks(d, frameStart, frameBits)
+}
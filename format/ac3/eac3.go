@@ -0,0 +1,219 @@
+package ac3
+
+// https://www.etsi.org/deliver/etsi_ts/102300_102399/102366/01.04.01_60/ts_102366v010401p.pdf annex E
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed eac3.jq
+var eac3FS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.EAC3,
+		ProbeOrder:  format.ProbeOrderBinFuzzy, // only sync word is fixed
+		Description: "Dolby Digital Plus (E-AC-3)",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    func(d *decode.D, _ any) any { return decodeFrames(d, decodeEAC3Frame) },
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(eac3FS)
+}
+
+var strmtypNames = scalar.UToSymStr{
+	0: "independent",
+	1: "dependent",
+	2: "ac3_convert",
+	3: "reserved",
+}
+
+var sampleRate2Map = scalar.UToSymU{
+	0: 24000,
+	1: 22050,
+	2: 16000,
+}
+
+var numblkscodMap = scalar.UToSymU{
+	0: 1,
+	1: 2,
+	2: 3,
+	3: 6,
+}
+
+var mixdefNames = scalar.UToSymStr{
+	0: "no_mixing",
+	1: "premix_compression",
+	2: "mixdata_12_bits",
+	3: "mixdata_variable",
+}
+
+func decodeEAC3Frame(d *decode.D) {
+	frameStart := d.Pos()
+
+	var frameBits int64
+	var strmtyp uint64
+	var fscod uint64
+	numblkscod := uint64(3)
+	d.FieldStruct("syncinfo", func(d *decode.D) {
+		d.FieldU16("syncword", d.AssertU(syncWord), scalar.ActualHex)
+	})
+
+	d.FieldStruct("bsi", func(d *decode.D) {
+		strmtyp = d.FieldU2("strmtyp", strmtypNames)
+		d.FieldU3("substreamid")
+		frmsiz := d.FieldU11("frmsiz")
+		frameBytes := int64(frmsiz+1) * 2
+		frameBits = frameBytes * 8
+		d.FieldValueU("frame_size", uint64(frameBytes))
+		if frameBits > d.BitsLeft()+32 {
+			d.Fatalf("frame size %d outside buffer", frameBytes)
+		}
+		fscod = d.FieldU2("fscod", sampleRateMap)
+		if fscod == 3 {
+			d.FieldU2("fscod2", sampleRate2Map)
+		} else {
+			numblkscod = d.FieldU2("numblkscod", numblkscodMap)
+		}
+		acmod := d.FieldU3("acmod", acmodNames)
+		lfeon := d.FieldBool("lfeon")
+		d.FieldU5("bsid", d.AssertURange(bsidMinEAC3, bsidMaxEAC3))
+		d.FieldU5("dialnorm", dialnormMapper)
+		if d.FieldBool("compre") {
+			d.FieldU8("compr")
+		}
+		if acmod == 0 {
+			d.FieldU5("dialnorm2", dialnormMapper)
+			if d.FieldBool("compr2e") {
+				d.FieldU8("compr2")
+			}
+		}
+		if strmtyp == 1 {
+			if d.FieldBool("chanmape") {
+				d.FieldU16("chanmap", scalar.ActualBin)
+			}
+		}
+
+		if d.FieldBool("mixmdate") {
+			if acmod > 2 {
+				d.FieldU2("dmixmod")
+			}
+			if acmod&1 != 0 && acmod > 2 {
+				d.FieldU3("ltrtcmixlev")
+				d.FieldU3("lorocmixlev")
+			}
+			if acmod&4 != 0 {
+				d.FieldU3("ltrtsurmixlev")
+				d.FieldU3("lorosurmixlev")
+			}
+			if lfeon {
+				if d.FieldBool("lfemixlevcode") {
+					d.FieldU5("lfemixlevcod")
+				}
+			}
+			if strmtyp == 0 {
+				if d.FieldBool("pgmscle") {
+					d.FieldU6("pgmscl")
+				}
+				if acmod == 0 {
+					if d.FieldBool("pgmscl2e") {
+						d.FieldU6("pgmscl2")
+					}
+				}
+				if d.FieldBool("extpgmscle") {
+					d.FieldU6("extpgmscl")
+				}
+				switch d.FieldU2("mixdef", mixdefNames) {
+				case 1:
+					d.FieldBool("premixcmpsel")
+					d.FieldBool("drcsrc")
+					d.FieldU3("premixcmpscl")
+				case 2:
+					d.FieldU12("mixdata")
+				case 3:
+					mixdeflen := d.FieldU5("mixdeflen")
+					d.FieldRawLen("mixdata", int64(mixdeflen+2)*8)
+				}
+				if acmod < 2 {
+					if d.FieldBool("paninfoe") {
+						d.FieldU8("panmean")
+						d.FieldU6("paninfo")
+					}
+					if acmod == 0 {
+						if d.FieldBool("paninfo2e") {
+							d.FieldU8("panmean2")
+							d.FieldU6("paninfo2")
+						}
+					}
+				}
+				if d.FieldBool("frmmixcfginfoe") {
+					if numblkscod == 0 {
+						d.FieldU5("blkmixcfginfo")
+					} else {
+						d.FieldArray("blkmixcfginfos", func(d *decode.D) {
+							for i := uint64(0); i < numblkscodMap[numblkscod]; i++ {
+								d.FieldStruct("blkmixcfginfo", func(d *decode.D) {
+									if d.FieldBool("blkmixcfginfoe") {
+										d.FieldU5("blkmixcfginfo")
+									}
+								})
+							}
+						})
+					}
+				}
+			}
+		}
+
+		if d.FieldBool("infomdate") {
+			d.FieldU3("bsmod", bsmodNames)
+			d.FieldBool("copyrightb")
+			d.FieldBool("origbs")
+			if acmod == 2 {
+				d.FieldU2("dsurmod", dsurmodNames)
+				d.FieldU2("dheadphonmod")
+			}
+			if acmod >= 6 {
+				d.FieldU2("dsurexmod")
+			}
+			if d.FieldBool("audprodie") {
+				d.FieldU5("mixlevel")
+				d.FieldU2("roomtyp", roomtypNames)
+				d.FieldBool("adconvtyp")
+			}
+			if acmod == 0 {
+				if d.FieldBool("audprodi2e") {
+					d.FieldU5("mixlevel2")
+					d.FieldU2("roomtyp2", roomtypNames)
+					d.FieldBool("adconvtyp2")
+				}
+			}
+			if fscod < 3 {
+				d.FieldBool("sourcefscod")
+			}
+		}
+
+		if strmtyp == 0 && numblkscod != 3 {
+			d.FieldBool("convsync")
+		}
+		if strmtyp == 2 {
+			blkid := true
+			if numblkscod != 3 {
+				blkid = d.FieldBool("blkid")
+			}
+			if blkid {
+				d.FieldU6("frmsizecod")
+			}
+		}
+		if d.FieldBool("addbsie") {
+			addbsil := d.FieldU6("addbsil")
+			d.FieldRawLen("addbsi", int64(addbsil+1)*8)
+		}
+	})
+
+	decodeAudioBlocks(d, frameStart, frameBits)
+}
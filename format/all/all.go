@@ -4,52 +4,92 @@
 package all
 
 import (
+	_ "github.com/wader/fq/format/ac3"
+	_ "github.com/wader/fq/format/amr"
 	_ "github.com/wader/fq/format/ape"
 	_ "github.com/wader/fq/format/ar"
+	_ "github.com/wader/fq/format/arrow"
+	_ "github.com/wader/fq/format/asf"
 	_ "github.com/wader/fq/format/asn1"
 	_ "github.com/wader/fq/format/av1"
+	_ "github.com/wader/fq/format/avi"
 	_ "github.com/wader/fq/format/avro"
 	_ "github.com/wader/fq/format/bencode"
 	_ "github.com/wader/fq/format/bitcoin"
+	_ "github.com/wader/fq/format/bmp"
+	_ "github.com/wader/fq/format/bplist"
 	_ "github.com/wader/fq/format/bson"
+	_ "github.com/wader/fq/format/btrfs"
 	_ "github.com/wader/fq/format/bzip2"
+	_ "github.com/wader/fq/format/caf"
+	_ "github.com/wader/fq/format/capnproto"
 	_ "github.com/wader/fq/format/cbor"
 	_ "github.com/wader/fq/format/crypto"
 	_ "github.com/wader/fq/format/csv"
 	_ "github.com/wader/fq/format/dns"
+	_ "github.com/wader/fq/format/dsd"
+	_ "github.com/wader/fq/format/dts"
 	_ "github.com/wader/fq/format/elf"
 	_ "github.com/wader/fq/format/fairplay"
+	_ "github.com/wader/fq/format/fits"
 	_ "github.com/wader/fq/format/flac"
+	_ "github.com/wader/fq/format/flatbuffers"
+	_ "github.com/wader/fq/format/flv"
+	_ "github.com/wader/fq/format/gguf"
 	_ "github.com/wader/fq/format/gif"
+	_ "github.com/wader/fq/format/git"
 	_ "github.com/wader/fq/format/gzip"
+	_ "github.com/wader/fq/format/hdf5"
 	_ "github.com/wader/fq/format/icc"
+	_ "github.com/wader/fq/format/ico"
 	_ "github.com/wader/fq/format/id3"
 	_ "github.com/wader/fq/format/inet"
+	_ "github.com/wader/fq/format/innodb"
 	_ "github.com/wader/fq/format/jpeg"
+	_ "github.com/wader/fq/format/jpeg2000"
 	_ "github.com/wader/fq/format/json"
+	_ "github.com/wader/fq/format/kafka"
+	_ "github.com/wader/fq/format/lz4"
+	_ "github.com/wader/fq/format/lzma"
 	_ "github.com/wader/fq/format/macho"
 	_ "github.com/wader/fq/format/math"
 	_ "github.com/wader/fq/format/matroska"
+	_ "github.com/wader/fq/format/minidump"
 	_ "github.com/wader/fq/format/mp3"
 	_ "github.com/wader/fq/format/mp4"
 	_ "github.com/wader/fq/format/mpeg"
 	_ "github.com/wader/fq/format/msgpack"
+	_ "github.com/wader/fq/format/mxf"
 	_ "github.com/wader/fq/format/ogg"
+	_ "github.com/wader/fq/format/opentype"
 	_ "github.com/wader/fq/format/opus"
 	_ "github.com/wader/fq/format/pcap"
+	_ "github.com/wader/fq/format/pickle"
 	_ "github.com/wader/fq/format/png"
+	_ "github.com/wader/fq/format/postgres"
+	_ "github.com/wader/fq/format/prefetch"
 	_ "github.com/wader/fq/format/protobuf"
 	_ "github.com/wader/fq/format/raw"
 	_ "github.com/wader/fq/format/rtmp"
+	_ "github.com/wader/fq/format/sf2"
+	_ "github.com/wader/fq/format/sqlite3"
+	_ "github.com/wader/fq/format/sstable"
+	_ "github.com/wader/fq/format/swap"
 	_ "github.com/wader/fq/format/tar"
 	_ "github.com/wader/fq/format/text"
 	_ "github.com/wader/fq/format/tiff"
+	_ "github.com/wader/fq/format/tls"
 	_ "github.com/wader/fq/format/toml"
+	_ "github.com/wader/fq/format/truehd"
+	_ "github.com/wader/fq/format/verity"
 	_ "github.com/wader/fq/format/vorbis"
 	_ "github.com/wader/fq/format/vpx"
 	_ "github.com/wader/fq/format/wav"
 	_ "github.com/wader/fq/format/webp"
+	_ "github.com/wader/fq/format/woff2"
 	_ "github.com/wader/fq/format/xml"
 	_ "github.com/wader/fq/format/yaml"
+	_ "github.com/wader/fq/format/zfs"
 	_ "github.com/wader/fq/format/zip"
+	_ "github.com/wader/fq/format/zstd"
 )
@@ -0,0 +1,152 @@
+package amr
+
+// https://www.rfc-editor.org/rfc/rfc4867#section-5
+// https://www.etsi.org/deliver/etsi_ts/126100_126199/126101/
+// https://www.etsi.org/deliver/etsi_ts/126200_126299/126201/
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed amr.jq
+var amrFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.AMR,
+		Description: "Adaptive Multi-Rate audio",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    amrDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(amrFS)
+}
+
+const (
+	magicNB   = "#!AMR\n"
+	magicNBMC = "#!AMR_MC1.0\n"
+	magicWB   = "#!AMR-WB\n"
+	magicWBMC = "#!AMR-WB_MC1.0\n"
+)
+
+// speech data bytes per frame type, excluding frame header
+var nbFrameBytes = [16]int64{12, 13, 15, 17, 19, 20, 26, 31, 5, 0, 0, 0, 0, 0, 0, 0}
+var wbFrameBytes = [16]int64{17, 23, 32, 36, 40, 46, 50, 58, 60, 5, 0, 0, 0, 0, 0, 0}
+
+var nbFrameTypeNames = scalar.UToScalar{
+	0:  {Sym: "amr_4_75", Description: "AMR 4.75 kbit/s"},
+	1:  {Sym: "amr_5_15", Description: "AMR 5.15 kbit/s"},
+	2:  {Sym: "amr_5_9", Description: "AMR 5.9 kbit/s"},
+	3:  {Sym: "amr_6_7", Description: "AMR 6.7 kbit/s"},
+	4:  {Sym: "amr_7_4", Description: "AMR 7.4 kbit/s"},
+	5:  {Sym: "amr_7_95", Description: "AMR 7.95 kbit/s"},
+	6:  {Sym: "amr_10_2", Description: "AMR 10.2 kbit/s"},
+	7:  {Sym: "amr_12_2", Description: "AMR 12.2 kbit/s"},
+	8:  {Sym: "sid", Description: "Comfort noise"},
+	9:  {Sym: "gsm_efr_sid", Description: "GSM-EFR comfort noise"},
+	10: {Sym: "tdma_efr_sid", Description: "TDMA-EFR comfort noise"},
+	11: {Sym: "pdc_efr_sid", Description: "PDC-EFR comfort noise"},
+	15: {Sym: "no_data", Description: "No data"},
+}
+
+var wbFrameTypeNames = scalar.UToScalar{
+	0:  {Sym: "amr_wb_6_60", Description: "AMR-WB 6.60 kbit/s"},
+	1:  {Sym: "amr_wb_8_85", Description: "AMR-WB 8.85 kbit/s"},
+	2:  {Sym: "amr_wb_12_65", Description: "AMR-WB 12.65 kbit/s"},
+	3:  {Sym: "amr_wb_14_25", Description: "AMR-WB 14.25 kbit/s"},
+	4:  {Sym: "amr_wb_15_85", Description: "AMR-WB 15.85 kbit/s"},
+	5:  {Sym: "amr_wb_18_25", Description: "AMR-WB 18.25 kbit/s"},
+	6:  {Sym: "amr_wb_19_85", Description: "AMR-WB 19.85 kbit/s"},
+	7:  {Sym: "amr_wb_23_05", Description: "AMR-WB 23.05 kbit/s"},
+	8:  {Sym: "amr_wb_23_85", Description: "AMR-WB 23.85 kbit/s"},
+	9:  {Sym: "sid", Description: "Comfort noise"},
+	14: {Sym: "speech_lost", Description: "Speech lost"},
+	15: {Sym: "no_data", Description: "No data"},
+}
+
+func amrDecode(d *decode.D, _ any) any {
+	var magic string
+	for _, m := range []string{magicNB, magicNBMC, magicWB, magicWBMC} {
+		if d.BitsLeft() >= int64(len(m))*8 && string(d.PeekBytes(len(m))) == m {
+			magic = m
+			break
+		}
+	}
+	if magic == "" {
+		d.Fatalf("no AMR magic found")
+	}
+
+	d.FieldUTF8("magic", len(magic), scalar.StrToDescription{
+		magicNB:   "AMR-NB",
+		magicNBMC: "AMR-NB multichannel",
+		magicWB:   "AMR-WB",
+		magicWBMC: "AMR-WB multichannel",
+	})
+
+	wideband := magic == magicWB || magic == magicWBMC
+	frameBytes := nbFrameBytes
+	frameTypeNames := nbFrameTypeNames
+	if wideband {
+		frameBytes = wbFrameBytes
+		frameTypeNames = wbFrameTypeNames
+	}
+	d.FieldValueBool("wideband", wideband)
+
+	channels := uint64(1)
+	if magic == magicNBMC || magic == magicWBMC {
+		d.FieldStruct("channel_description", func(d *decode.D) {
+			d.FieldU28("reserved")
+			channels = d.FieldU4("channels")
+		})
+		if channels == 0 {
+			d.Fatalf("zero channels")
+		}
+	}
+
+	frameFn := func(d *decode.D) {
+		var frameType uint64
+		d.FieldStruct("header", func(d *decode.D) {
+			d.FieldU1("padding0")
+			frameType = d.FieldU4("frame_type", frameTypeNames)
+			d.FieldBool("quality")
+			d.FieldU2("padding1")
+		})
+		if n := frameBytes[frameType]; n > 0 {
+			d.FieldRawLen("speech_data", n*8)
+		}
+	}
+
+	// each frame has a one byte header and speech data size is given by frame type
+	frameLeft := func() bool {
+		if d.BitsLeft() < 8 {
+			return false
+		}
+		frameType := d.PeekBits(5) & 0xf
+		return frameBytes[frameType]*8 <= d.BitsLeft()-8
+	}
+
+	if channels == 1 {
+		d.FieldStructArrayLoop("frames", "frame", frameLeft, frameFn)
+	} else {
+		// frame blocks has one frame per channel
+		d.FieldArray("frame_blocks", func(d *decode.D) {
+			for frameLeft() {
+				d.FieldArray("frame_block", func(d *decode.D) {
+					for i := uint64(0); i < channels && frameLeft(); i++ {
+						d.FieldStruct("frame", frameFn)
+					}
+				})
+			}
+		})
+	}
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("trailing", d.BitsLeft())
+	}
+
+	return nil
+}
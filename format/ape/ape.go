@@ -0,0 +1,286 @@
+package ape
+
+// https://github.com/FFmpeg/FFmpeg/blob/master/libavformat/ape.c
+// https://www.monkeysaudio.com/developers.html
+
+// TODO: decode frames
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed ape.jq
+var apeFS embed.FS
+
+var headerFormat decode.Group
+var footerFormat decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.APE,
+		Description: "Monkey's Audio",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    apeDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.ID3V2}, Group: &headerFormat},
+			{
+				Names: []string{
+					format.APEV2,
+					format.ID3V1,
+					format.ID3V11,
+				},
+				Group: &footerFormat,
+			},
+		},
+		Functions: []string{"_help"},
+	})
+	interp.RegisterFS(apeFS)
+}
+
+const (
+	// version 3.98 added descriptor
+	versionDescriptor = 3980
+	descriptorBytes   = 52
+	headerBytes       = 24
+)
+
+const (
+	formatFlag8Bit            = 1 << 0
+	formatFlagCRC             = 1 << 1
+	formatFlagHasPeakLevel    = 1 << 2
+	formatFlag24Bit           = 1 << 3
+	formatFlagHasSeekElements = 1 << 4
+	formatFlagCreateWavHeader = 1 << 5
+)
+
+var compressionLevelNames = scalar.UToSymStr{
+	1000: "fast",
+	2000: "normal",
+	3000: "high",
+	4000: "extra_high",
+	5000: "insane",
+}
+
+var versionMapper = scalar.UToDescription{
+	3800: "3.80",
+	3810: "3.81",
+	3900: "3.90",
+	3950: "3.95",
+	3970: "3.97",
+	3980: "3.98",
+	3990: "3.99",
+}
+
+func decodeFormatFlags(d *decode.D) uint64 {
+	var flags uint64
+	d.FieldStruct("format_flags", func(d *decode.D) {
+		// little endian so low byte first
+		d.FieldU2("unused0")
+		for _, f := range []struct {
+			name string
+			flag uint64
+		}{
+			{"create_wav_header", formatFlagCreateWavHeader},
+			{"has_seek_elements", formatFlagHasSeekElements},
+			{"24_bit", formatFlag24Bit},
+			{"has_peak_level", formatFlagHasPeakLevel},
+			{"crc", formatFlagCRC},
+			{"8_bit", formatFlag8Bit},
+		} {
+			if d.FieldBool(f.name) {
+				flags |= f.flag
+			}
+		}
+		d.FieldU8("unused1")
+	})
+	return flags
+}
+
+// start of APEv2 and ID3v1 tags at end of file
+func tagsStart(d *decode.D) int64 {
+	end := d.Len()
+	if end >= 128*8 && string(d.BytesRange(end-128*8, 3)) == "TAG" {
+		end -= 128 * 8
+	}
+	if end >= 32*8 && string(d.BytesRange(end-32*8, 8)) == "APETAGEX" {
+		var tagSize, flags uint64
+		d.SeekAbs(end-32*8+12*8, func(d *decode.D) {
+			tagSize = d.U32()
+			d.SeekRel(4 * 8)
+			flags = d.U32()
+		})
+		// tag size includes items and footer
+		size := int64(tagSize)
+		if flags&0x8000_0000 != 0 {
+			size += 32
+		}
+		if size*8 <= end {
+			end -= size * 8
+		}
+	}
+	return end
+}
+
+func apeDecode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	d.FieldArray("headers", func(d *decode.D) {
+		for d.NotEnd() {
+			if dv, _, _ := d.TryFieldFormat("header", headerFormat, nil); dv == nil {
+				return
+			}
+		}
+	})
+	// seek table offsets are relative to start of descriptor
+	junkBytes := d.Pos() / 8
+
+	var version uint64
+	var headerLen uint64
+	var seekTableBytes uint64
+	var wavHeaderBytes uint64
+	var wavTailBytes uint64
+	var frameDataBytes int64 = -1
+	var totalFrames uint64
+	var formatFlags uint64
+
+	d.FieldStruct("descriptor", func(d *decode.D) {
+		d.FieldUTF8("id", 4, d.AssertStr("MAC "))
+		version = d.FieldU16("version", versionMapper)
+		if version < versionDescriptor {
+			return
+		}
+		d.FieldU16("padding")
+		descBytes := d.FieldU32("descriptor_bytes")
+		headerLen = d.FieldU32("header_bytes")
+		seekTableBytes = d.FieldU32("seek_table_bytes")
+		wavHeaderBytes = d.FieldU32("header_data_bytes")
+		frameDataLow := d.FieldU32("frame_data_bytes")
+		frameDataHigh := d.FieldU32("frame_data_bytes_high")
+		frameDataBytes = int64(frameDataHigh<<32 | frameDataLow)
+		wavTailBytes = d.FieldU32("terminating_data_bytes")
+		d.FieldRawLen("file_md5", 16*8)
+		if descBytes > descriptorBytes {
+			d.FieldRawLen("unknown", int64(descBytes-descriptorBytes)*8)
+		}
+	})
+
+	d.FieldStruct("header", func(d *decode.D) {
+		if version >= versionDescriptor {
+			d.FieldU16("compression_level", compressionLevelNames)
+			formatFlags = decodeFormatFlags(d)
+			d.FieldU32("blocks_per_frame")
+			d.FieldU32("final_frame_blocks")
+			totalFrames = d.FieldU32("total_frames")
+			d.FieldU16("bits_per_sample")
+			d.FieldU16("channels")
+			d.FieldU32("sample_rate")
+			if headerLen > headerBytes {
+				d.FieldRawLen("unknown", int64(headerLen-headerBytes)*8)
+			}
+			return
+		}
+
+		d.FieldU16("compression_level", compressionLevelNames)
+		formatFlags = decodeFormatFlags(d)
+		d.FieldU16("channels")
+		d.FieldU32("sample_rate")
+		wavHeaderBytes = d.FieldU32("header_data_bytes")
+		wavTailBytes = d.FieldU32("terminating_data_bytes")
+		totalFrames = d.FieldU32("total_frames")
+		d.FieldU32("final_frame_blocks")
+		if formatFlags&formatFlagHasPeakLevel != 0 {
+			d.FieldU32("peak_level")
+		}
+		if formatFlags&formatFlagHasSeekElements != 0 {
+			seekTableBytes = d.FieldU32("seek_elements") * 4
+		} else {
+			seekTableBytes = totalFrames * 4
+		}
+		bitsPerSample := uint64(16)
+		switch {
+		case formatFlags&formatFlag8Bit != 0:
+			bitsPerSample = 8
+		case formatFlags&formatFlag24Bit != 0:
+			bitsPerSample = 24
+		}
+		d.FieldValueU("bits_per_sample", bitsPerSample)
+	})
+
+	// older versions has header data before seek table
+	if formatFlags&formatFlagCreateWavHeader != 0 {
+		wavHeaderBytes = 0
+	}
+	if version < versionDescriptor && wavHeaderBytes > 0 {
+		d.FieldRawLen("header_data", int64(wavHeaderBytes)*8)
+	}
+
+	var seekTable []int64
+	d.FramedFn(int64(seekTableBytes)*8, func(d *decode.D) {
+		d.FieldArray("seek_table", func(d *decode.D) {
+			for d.BitsLeft() >= 32 {
+				seekTable = append(seekTable, int64(d.FieldU32("offset")))
+			}
+		})
+	})
+	if version < 3810 && len(seekTable) > 0 {
+		d.FieldArray("bit_table", func(d *decode.D) {
+			for i := uint64(0); i < totalFrames; i++ {
+				d.FieldU8("bits")
+			}
+		})
+	}
+	if version >= versionDescriptor && wavHeaderBytes > 0 {
+		d.FieldRawLen("header_data", int64(wavHeaderBytes)*8)
+	}
+
+	framesStart := d.Pos()
+	framesEnd := tagsStart(d) - int64(wavTailBytes)*8
+	if frameDataBytes >= 0 && framesStart+frameDataBytes*8 <= framesEnd {
+		framesEnd = framesStart + frameDataBytes*8
+	}
+	if framesEnd < framesStart {
+		d.Fatalf("invalid frame data size")
+	}
+
+	d.FieldArray("frames", func(d *decode.D) {
+		for i := 0; i < len(seekTable) && uint64(i) < totalFrames; i++ {
+			pos := d.Pos()
+			end := framesEnd
+			if i+1 < len(seekTable) && uint64(i+1) < totalFrames {
+				end = (junkBytes + seekTable[i+1]) * 8
+			}
+			// first frame starts after header
+			if i > 0 {
+				pos = (junkBytes + seekTable[i]) * 8
+			}
+			if pos != d.Pos() || end <= pos || end > framesEnd {
+				break
+			}
+			d.FieldRawLen("frame", end-pos)
+		}
+	})
+	if d.Pos() < framesEnd {
+		d.FieldRawLen("unknown", framesEnd-d.Pos())
+	}
+	if wavTailBytes > 0 && int64(wavTailBytes)*8 <= d.BitsLeft() {
+		d.FieldRawLen("terminating_data", int64(wavTailBytes)*8)
+	}
+
+	d.FieldArray("footers", func(d *decode.D) {
+		for d.NotEnd() {
+			if dv, _, _ := d.TryFieldFormat("footer", footerFormat, nil); dv == nil {
+				return
+			}
+		}
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("trailing", d.BitsLeft())
+	}
+
+	return nil
+}
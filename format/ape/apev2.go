@@ -1,11 +1,17 @@
 package ape
 
 // http://wiki.hydrogenaud.io/index.php?title=APE_Tags_Header
+// https://wiki.hydrogenaud.io/index.php?title=APE_Tag_Item
+// https://wiki.hydrogenaud.io/index.php?title=APEv1_specification
 
 import (
+	"bytes"
+	"strings"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
 )
 
 var imageFormat decode.Group
@@ -21,55 +27,164 @@ func init() {
 	})
 }
 
+const (
+	headerFooterBytes = 32
+	id3v1Bytes        = 128
+	maxItemCount      = 1000
+)
+
+var apeTagPreamble = []byte("APETAGEX")
+
+var apeTagVersionNames = scalar.UToDescription{
+	1000: "1.0",
+	2000: "2.0",
+}
+
+const (
+	itemTypeUTF8     = 0
+	itemTypeBinary   = 1
+	itemTypeExternal = 2
+)
+
+var itemTypeNames = scalar.UToSymStr{
+	itemTypeUTF8:     "utf8",
+	itemTypeBinary:   "binary",
+	itemTypeExternal: "external",
+	3:                "reserved",
+}
+
+type apeTagHeaderFooter struct {
+	tagSize     uint64
+	itemCount   uint64
+	hasNoFooter bool
+}
+
+func decodeAPETagHeaderFooter(d *decode.D, name string) apeTagHeaderFooter {
+	var hf apeTagHeaderFooter
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldUTF8("preamble", 8, d.AssertStr(string(apeTagPreamble)))
+		d.FieldU32("version", apeTagVersionNames)
+		hf.tagSize = d.FieldU32("tag_size")
+		hf.itemCount = d.FieldU32("item_count")
+		d.FieldStruct("flags", func(d *decode.D) {
+			// 32LE, bytes are in reverse order
+			d.FieldU7("unused0")
+			d.FieldBool("read_only")
+			d.FieldU16("unused1")
+			d.FieldBool("has_header")
+			hf.hasNoFooter = d.FieldBool("has_no_footer")
+			d.FieldBool("is_header")
+			d.FieldU5("unused2")
+		})
+		d.FieldRawLen("reserved", 64, d.BitBufIsZero())
+	})
+	return hf
+}
+
+func decodeAPETagItem(d *decode.D) {
+	itemSize := d.FieldU32("item_size")
+	var itemType uint64
+	d.FieldStruct("item_flags", func(d *decode.D) {
+		// 32LE, bytes are in reverse order
+		d.FieldU5("unused0")
+		itemType = d.FieldU2("item_type", itemTypeNames)
+		d.FieldBool("read_only")
+		d.FieldU24("unused1")
+	})
+	keyLen := d.PeekFindByte(0, 256)
+	if keyLen < 0 {
+		d.Fatalf("key terminator not found")
+	}
+	key := d.FieldUTF8("key", int(keyLen))
+	d.FieldU8("key_terminator")
+	if int64(itemSize)*8 > d.BitsLeft() {
+		d.Fatalf("item size %d outside tag", itemSize)
+	}
+
+	switch {
+	case itemType == itemTypeBinary && strings.HasPrefix(strings.ToLower(key), "cover art"):
+		d.FramedFn(int64(itemSize)*8, func(d *decode.D) {
+			d.FieldUTF8Null("filename")
+			d.FieldFormatOrRaw("value", imageFormat, nil)
+		})
+	case itemType == itemTypeUTF8, itemType == itemTypeExternal:
+		// multiple values are separated by null
+		d.FieldUTF8("value", int(itemSize))
+	default:
+		d.FieldRawLen("value", int64(itemSize)*8)
+	}
+}
+
+// findFooter looks for a footer at end of buffer or before a ID3v1 tag that
+// describes a tag starting at current position and returns its item count
+func findFooter(d *decode.D) (uint64, bool) {
+	start := d.Pos()
+	end := d.Len()
+	for _, footerPos := range []int64{
+		end - headerFooterBytes*8,
+		end - (headerFooterBytes+id3v1Bytes)*8,
+	} {
+		if footerPos < start {
+			continue
+		}
+		if footerPos != end-headerFooterBytes*8 &&
+			!bytes.Equal(d.BytesRange(footerPos+headerFooterBytes*8, 3), []byte("TAG")) {
+			continue
+		}
+		if !bytes.Equal(d.BytesRange(footerPos, 8), apeTagPreamble) {
+			continue
+		}
+		var tagSize, itemCount uint64
+		d.RangeFn(footerPos, headerFooterBytes*8, func(d *decode.D) {
+			d.SeekRel(12 * 8)
+			tagSize = d.U32()
+			itemCount = d.U32()
+		})
+		// tag size includes items and footer but not header
+		if footerPos+headerFooterBytes*8-int64(tagSize)*8 == start {
+			return itemCount, true
+		}
+	}
+	return 0, false
+}
+
 func apev2Decode(d *decode.D, _ any) any {
 	d.Endian = decode.LittleEndian
 
-	headerFooterFn := func(d *decode.D, name string) uint64 {
-		var tagCount uint64
-		d.FieldStruct(name, func(d *decode.D) {
-			d.FieldUTF8("preamble", 8, d.AssertStr("APETAGEX"))
-			d.FieldU32("version")
-			d.FieldU32("tag_size")
-			tagCount = d.FieldU32("item_count")
-			d.FieldU32("flags")
-			d.FieldRawLen("reserved", 64, d.BitBufIsZero())
-		})
-		return tagCount
+	if d.BitsLeft() < headerFooterBytes*8 {
+		d.Fatalf("too short")
 	}
 
-	tagCount := headerFooterFn(d, "header")
-	if tagCount > 1000 {
-		d.Fatalf("too many tags %d", tagCount)
+	var itemCount uint64
+	hasFooter := true
+	if bytes.Equal(d.PeekBytes(8), apeTagPreamble) {
+		header := decodeAPETagHeaderFooter(d, "header")
+		itemCount = header.itemCount
+		hasFooter = !header.hasNoFooter
+		if int64(header.tagSize)*8 > d.BitsLeft() {
+			d.Fatalf("tag size %d outside buffer", header.tagSize)
+		}
+	} else {
+		// APEv1 and some APEv2 tags only have a footer
+		var ok bool
+		itemCount, ok = findFooter(d)
+		if !ok {
+			d.Fatalf("no APE tag header or footer found")
+		}
+	}
+	if itemCount > maxItemCount {
+		d.Fatalf("too many items %d", itemCount)
 	}
 
 	d.FieldArray("tags", func(d *decode.D) {
-		for i := uint64(0); i < tagCount; i++ {
-			d.FieldStruct("tag", func(d *decode.D) {
-				itemSize := d.FieldU32("item_size")
-				var binaryItem bool
-				d.FieldStruct("item_flags", func(d *decode.D) {
-					d.FieldU6("unused0")
-					binaryItem = d.FieldBool("binary")
-					d.FieldU25("unused1")
-				})
-				keyLen := d.PeekFindByte(0, -1)
-				d.FieldUTF8("key", int(keyLen))
-				d.FieldU8("key_terminator")
-				if binaryItem {
-					d.FramedFn(int64(itemSize)*8, func(d *decode.D) {
-						d.FieldUTF8Null("filename")
-						// assume image if binary
-						d.FieldFormatOrRaw("value", imageFormat, nil)
-					})
-				} else {
-					d.FieldUTF8("value", int(itemSize))
-				}
-			})
+		for i := uint64(0); i < itemCount; i++ {
+			d.FieldStruct("tag", decodeAPETagItem)
 		}
 	})
 
-	// TODO: check footer flag
-	headerFooterFn(d, "footer")
+	if hasFooter {
+		decodeAPETagHeaderFooter(d, "footer")
+	}
 
 	return nil
 }
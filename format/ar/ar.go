@@ -14,6 +14,7 @@ func init() {
 		Name:        format.AR,
 		Description: "Unix archive",
 		Groups:      []string{format.PROBE},
+		ProbeOrder:  format.ProbeOrderBinFuzzy, // after deb, both start with "!<arch>\n"
 		DecodeFn:    decodeAr,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.PROBE}, Group: &probeFormat},
@@ -21,12 +22,14 @@ func init() {
 	})
 }
 
-func decodeAr(d *decode.D, _ any) any {
+// decodeArFiles decodes signature and file headers, dataFn is called to decode file data
+func decodeArFiles(d *decode.D, dataFn func(d *decode.D, index int, identifier string, size int64)) {
 	d.FieldUTF8("signature", 8, d.AssertStr("!<arch>\n"))
+	index := 0
 	d.FieldArray("files", func(d *decode.D) {
 		for !d.End() {
 			d.FieldStruct("file", func(d *decode.D) {
-				d.FieldUTF8("identifier", 16, scalar.ActualTrimSpace)
+				identifier := d.FieldUTF8("identifier", 16, scalar.ActualTrimSpace)
 				d.FieldUTF8("modification_timestamp", 12, scalar.ActualTrimSpace, scalar.SymUParseUint(10))
 				d.FieldUTF8("owner_id", 6, scalar.ActualTrimSpace, scalar.SymUParseUint(10))
 				d.FieldUTF8("group_id", 6, scalar.ActualTrimSpace, scalar.SymUParseUint(10))
@@ -37,14 +40,21 @@ func decodeAr(d *decode.D, _ any) any {
 				}
 				size := int64(sizeS.SymU()) * 8
 				d.FieldUTF8("ending_characters", 2)
-				d.FieldFormatOrRawLen("data", size, probeFormat, nil)
+				dataFn(d, index, identifier, size)
 				padding := d.AlignBits(16)
 				if padding > 0 {
 					d.FieldRawLen("padding", int64(padding))
 				}
 			})
+			index++
 		}
 	})
+}
+
+func decodeAr(d *decode.D, _ any) any {
+	decodeArFiles(d, func(d *decode.D, _ int, _ string, size int64) {
+		d.FieldFormatOrRawLen("data", size, probeFormat, nil)
+	})
 
 	return nil
 }
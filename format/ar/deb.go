@@ -0,0 +1,56 @@
+package ar
+
+// https://manpages.debian.org/unstable/dpkg-dev/deb.5.en.html
+
+import (
+	"embed"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+)
+
+//go:embed deb.jq
+var debFS embed.FS
+
+var debProbeFormat decode.Group
+var debTarFormat decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.DEB,
+		Description: "Debian package",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    decodeDeb,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.PROBE}, Group: &debProbeFormat},
+			{Names: []string{format.TAR}, Group: &debTarFormat},
+		},
+		Functions: []string{"_help"},
+	})
+	interp.RegisterFS(debFS)
+}
+
+func decodeDeb(d *decode.D, _ any) any {
+	decodeArFiles(d, func(d *decode.D, index int, identifier string, size int64) {
+		switch {
+		case index == 0:
+			// must be first member
+			if identifier != "debian-binary" {
+				d.Fatalf("first member not debian-binary")
+			}
+			d.FieldUTF8("data", int(size/8))
+		case identifier == "control.tar", identifier == "data.tar":
+			d.FieldFormatOrRawLen("data", size, debTarFormat, nil)
+		case strings.HasPrefix(identifier, "control.tar."), strings.HasPrefix(identifier, "data.tar."):
+			// compressed tar, compression format will probe tar
+			d.FieldFormatOrRawLen("data", size, debProbeFormat, nil)
+		default:
+			// members starting with "_" are reserved for dpkg extensions
+			d.FieldRawLen("data", size)
+		}
+	})
+
+	return nil
+}
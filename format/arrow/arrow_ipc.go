@@ -0,0 +1,610 @@
+package arrow
+
+// https://arrow.apache.org/docs/format/Columnar.html#serialization-and-interprocess-communication-ipc
+// https://github.com/apache/arrow/blob/main/format/Message.fbs
+// https://github.com/apache/arrow/blob/main/format/Schema.fbs
+// https://github.com/apache/arrow/blob/main/format/File.fbs
+// TODO: feather v1, tensor and sparse tensor bodies
+
+import (
+	"bytes"
+	"embed"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed arrow_ipc.jq
+var arrowFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.ARROW_IPC,
+		Description: "Apache Arrow IPC stream or file",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    ipcDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(arrowFS)
+}
+
+const (
+	continuationMarker = 0xffff_ffff
+	// magic and padding to 8 bytes
+	fileMagicBytes = 8
+	// footer length and magic
+	fileTrailerBytes = 10
+	// body buffers start with uncompressed length
+	compressedLengthBytes = 8
+	uncompressedLength    = -1
+)
+
+var fileMagic = []byte("ARROW1")
+
+const (
+	metadataV1 = 0
+	metadataV2 = 1
+	metadataV3 = 2
+	metadataV4 = 3
+	metadataV5 = 4
+)
+
+var metadataVersionNames = scalar.SToSymStr{
+	metadataV1: "v1",
+	metadataV2: "v2",
+	metadataV3: "v3",
+	metadataV4: "v4",
+	metadataV5: "v5",
+}
+
+const (
+	headerSchema          = 1
+	headerDictionaryBatch = 2
+	headerRecordBatch     = 3
+	headerTensor          = 4
+	headerSparseTensor    = 5
+)
+
+var headerTypeNames = scalar.UToSymStr{
+	0:                     "none",
+	headerSchema:          "schema",
+	headerDictionaryBatch: "dictionary_batch",
+	headerRecordBatch:     "record_batch",
+	headerTensor:          "tensor",
+	headerSparseTensor:    "sparse_tensor",
+}
+
+const (
+	typeNull            = 1
+	typeInt             = 2
+	typeFloatingPoint   = 3
+	typeBinary          = 4
+	typeUtf8            = 5
+	typeBool            = 6
+	typeDecimal         = 7
+	typeDate            = 8
+	typeTime            = 9
+	typeTimestamp       = 10
+	typeInterval        = 11
+	typeList            = 12
+	typeStruct          = 13
+	typeUnion           = 14
+	typeFixedSizeBinary = 15
+	typeFixedSizeList   = 16
+	typeMap             = 17
+	typeDuration        = 18
+	typeLargeBinary     = 19
+	typeLargeUtf8       = 20
+	typeLargeList       = 21
+	typeRunEndEncoded   = 22
+	typeBinaryView      = 23
+	typeUtf8View        = 24
+	typeListView        = 25
+	typeLargeListView   = 26
+)
+
+var typeNames = scalar.UToSymStr{
+	0:                   "none",
+	typeNull:            "null",
+	typeInt:             "int",
+	typeFloatingPoint:   "floating_point",
+	typeBinary:          "binary",
+	typeUtf8:            "utf8",
+	typeBool:            "bool",
+	typeDecimal:         "decimal",
+	typeDate:            "date",
+	typeTime:            "time",
+	typeTimestamp:       "timestamp",
+	typeInterval:        "interval",
+	typeList:            "list",
+	typeStruct:          "struct",
+	typeUnion:           "union",
+	typeFixedSizeBinary: "fixed_size_binary",
+	typeFixedSizeList:   "fixed_size_list",
+	typeMap:             "map",
+	typeDuration:        "duration",
+	typeLargeBinary:     "large_binary",
+	typeLargeUtf8:       "large_utf8",
+	typeLargeList:       "large_list",
+	typeRunEndEncoded:   "run_end_encoded",
+	typeBinaryView:      "binary_view",
+	typeUtf8View:        "utf8_view",
+	typeListView:        "list_view",
+	typeLargeListView:   "large_list_view",
+}
+
+var endiannessNames = scalar.SToSymStr{
+	0: "little",
+	1: "big",
+}
+
+var precisionNames = scalar.SToSymStr{
+	0: "half",
+	1: "single",
+	2: "double",
+}
+
+var dateUnitNames = scalar.SToSymStr{
+	0: "day",
+	1: "millisecond",
+}
+
+var timeUnitNames = scalar.SToSymStr{
+	0: "second",
+	1: "millisecond",
+	2: "microsecond",
+	3: "nanosecond",
+}
+
+var intervalUnitNames = scalar.SToSymStr{
+	0: "year_month",
+	1: "day_time",
+	2: "month_day_nano",
+}
+
+const (
+	unionModeSparse = 0
+	unionModeDense  = 1
+)
+
+var unionModeNames = scalar.SToSymStr{
+	unionModeSparse: "sparse",
+	unionModeDense:  "dense",
+}
+
+var dictionaryKindNames = scalar.SToSymStr{
+	0: "dense_array",
+}
+
+var featureNames = scalar.SToSymStr{
+	0: "unused",
+	1: "dictionary_replacement",
+	2: "compressed_body",
+}
+
+const (
+	compressionLZ4Frame = 0
+	compressionZstd     = 1
+)
+
+var compressionCodecNames = scalar.SToSymStr{
+	compressionLZ4Frame: "lz4_frame",
+	compressionZstd:     "zstd",
+}
+
+var compressionMethodNames = scalar.UToSymStr{
+	0: "buffer",
+}
+
+var uncompressedLengthNames = scalar.SToSymStr{
+	uncompressedLength: "uncompressed",
+}
+
+type field struct {
+	name         string
+	typ          uint64
+	unionMode    int64
+	isDictionary bool
+	dictionaryID int64
+	children     []field
+}
+
+type recordBatch struct {
+	buffers        []bodyBuffer
+	variadicCounts []int64
+	// -1 if not compressed
+	codec int64
+}
+
+type bodyBuffer struct {
+	offset int64
+	length int64
+}
+
+// field and kind of buffer as laid out in body
+type bufferLayout struct {
+	field string
+	kind  string
+}
+
+type decodeContext struct {
+	version      int64
+	fields       []field
+	dictionaries map[int64]field
+}
+
+func decodeInt(d *decode.D, t table) {
+	t.fieldS32(d, 0, "bit_width", 0)
+	t.fieldBool(d, 1, "is_signed")
+}
+
+func decodeType(d *decode.D, typ uint64, t table, f *field) {
+	switch typ {
+	case typeInt:
+		decodeInt(d, t)
+	case typeFloatingPoint:
+		t.fieldS16(d, 0, "precision", 0, precisionNames)
+	case typeDecimal:
+		t.fieldS32(d, 0, "precision", 0)
+		t.fieldS32(d, 1, "scale", 0)
+		t.fieldS32(d, 2, "bit_width", 128)
+	case typeDate:
+		t.fieldS16(d, 0, "unit", 1, dateUnitNames)
+	case typeTime:
+		t.fieldS16(d, 0, "unit", 1, timeUnitNames)
+		t.fieldS32(d, 1, "bit_width", 32)
+	case typeTimestamp:
+		t.fieldS16(d, 0, "unit", 0, timeUnitNames)
+		t.fieldString(d, 1, "timezone")
+	case typeInterval:
+		t.fieldS16(d, 0, "unit", 0, intervalUnitNames)
+	case typeUnion:
+		f.unionMode = t.fieldS16(d, 0, "mode", unionModeSparse, unionModeNames)
+		t.fieldVector(d, 1, "type_ids", 4, func(d *decode.D, _ int) { d.FieldS32("type_id") })
+	case typeFixedSizeBinary:
+		t.fieldS32(d, 0, "byte_width", 0)
+	case typeFixedSizeList:
+		t.fieldS32(d, 0, "list_size", 0)
+	case typeMap:
+		t.fieldBool(d, 0, "keys_sorted")
+	case typeDuration:
+		t.fieldS16(d, 0, "unit", 1, timeUnitNames)
+	}
+}
+
+func decodeField(d *decode.D, t table) field {
+	var f field
+	f.name = t.fieldString(d, 0, "name")
+	t.fieldBool(d, 1, "nullable")
+	f.typ = t.fieldU8(d, 2, "type_type", 0, typeNames)
+	t.fieldTable(d, 3, "type", func(d *decode.D, tt table) { decodeType(d, f.typ, tt, &f) })
+	t.fieldTable(d, 4, "dictionary", func(d *decode.D, t table) {
+		f.isDictionary = true
+		f.dictionaryID = t.fieldS64(d, 0, "id", 0)
+		t.fieldTable(d, 1, "index_type", func(d *decode.D, t table) { decodeInt(d, t) })
+		t.fieldBool(d, 2, "is_ordered")
+		t.fieldS16(d, 3, "dictionary_kind", 0, dictionaryKindNames)
+	})
+	t.fieldTableVector(d, 5, "children", "field", func(d *decode.D, t table) {
+		f.children = append(f.children, decodeField(d, t))
+	})
+	t.fieldKeyValues(d, 6, "custom_metadata")
+	return f
+}
+
+func decodeSchema(d *decode.D, t table) []field {
+	t.fieldS16(d, 0, "endianness", 0, endiannessNames)
+	var fields []field
+	t.fieldTableVector(d, 1, "fields", "field", func(d *decode.D, t table) {
+		fields = append(fields, decodeField(d, t))
+	})
+	t.fieldKeyValues(d, 2, "custom_metadata")
+	t.fieldVector(d, 3, "features", 8, func(d *decode.D, _ int) { d.FieldS64("feature", featureNames) })
+	return fields
+}
+
+func (dc *decodeContext) setSchema(fields []field) {
+	dc.fields = fields
+	dc.dictionaries = map[int64]field{}
+	var collect func(fs []field)
+	collect = func(fs []field) {
+		for _, f := range fs {
+			if f.isDictionary {
+				dc.dictionaries[f.dictionaryID] = f
+			}
+			collect(f.children)
+		}
+	}
+	collect(fields)
+}
+
+func decodeRecordBatch(d *decode.D, t table) recordBatch {
+	rb := recordBatch{codec: -1}
+	t.fieldS64(d, 0, "length", 0)
+	t.fieldVector(d, 1, "nodes", 16, func(d *decode.D, _ int) {
+		d.FieldStruct("node", func(d *decode.D) {
+			d.FieldS64("length")
+			d.FieldS64("null_count")
+		})
+	})
+	t.fieldVector(d, 2, "buffers", 16, func(d *decode.D, _ int) {
+		d.FieldStruct("buffer", func(d *decode.D) {
+			rb.buffers = append(rb.buffers, bodyBuffer{
+				offset: d.FieldS64("offset"),
+				length: d.FieldS64("length"),
+			})
+		})
+	})
+	t.fieldTable(d, 3, "compression", func(d *decode.D, t table) {
+		rb.codec = t.fieldS8(d, 0, "codec", compressionLZ4Frame, compressionCodecNames)
+		t.fieldU8(d, 1, "method", 0, compressionMethodNames)
+	})
+	t.fieldVector(d, 4, "variadic_buffer_counts", 8, func(d *decode.D, _ int) {
+		rb.variadicCounts = append(rb.variadicCounts, d.FieldS64("count"))
+	})
+	return rb
+}
+
+// layout returns buffers in order for fields, children of dictionary encoded
+// fields are in dictionary batches
+func (dc *decodeContext) layout(fields []field, parent string, variadicCounts []int64) []bufferLayout {
+	var bufs []bufferLayout
+	variadicIndex := 0
+	var walk func(fs []field, parent string)
+	walk = func(fs []field, parent string) {
+		for _, f := range fs {
+			path := f.name
+			if parent != "" {
+				path = parent + "." + f.name
+			}
+			add := func(kinds ...string) {
+				for _, k := range kinds {
+					bufs = append(bufs, bufferLayout{field: path, kind: k})
+				}
+			}
+			if f.isDictionary {
+				add("validity", "indices")
+				continue
+			}
+			switch f.typ {
+			case typeNull, typeRunEndEncoded:
+			case typeBinary, typeUtf8, typeLargeBinary, typeLargeUtf8:
+				add("validity", "offsets", "data")
+			case typeList, typeLargeList, typeMap:
+				add("validity", "offsets")
+			case typeListView, typeLargeListView:
+				add("validity", "offsets", "sizes")
+			case typeStruct, typeFixedSizeList:
+				add("validity")
+			case typeUnion:
+				// validity buffer was removed in v5
+				if dc.version < metadataV5 {
+					add("validity")
+				}
+				add("types")
+				if f.unionMode == unionModeDense {
+					add("offsets")
+				}
+			case typeBinaryView, typeUtf8View:
+				add("validity", "views")
+				if variadicIndex < len(variadicCounts) {
+					for i := int64(0); i < variadicCounts[variadicIndex]; i++ {
+						add("data")
+					}
+					variadicIndex++
+				}
+			default:
+				add("validity", "data")
+			}
+			walk(f.children, path)
+		}
+	}
+	walk(fields, parent)
+	return bufs
+}
+
+func uncompress(codec int64, b []byte) ([]byte, error) {
+	switch codec {
+	case compressionLZ4Frame:
+		return io.ReadAll(lz4.NewReader(bytes.NewReader(b)))
+	default:
+		zd, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer zd.Close()
+		return zd.DecodeAll(b, nil)
+	}
+}
+
+func decodeBody(d *decode.D, rb recordBatch, layout []bufferLayout) {
+	bodyStart := d.Pos()
+	bodyLen := d.BitsLeft()
+	d.FieldArray("buffers", func(d *decode.D) {
+		for i, b := range rb.buffers {
+			// offsets are relative to start of body
+			if b.offset < 0 || b.length < 0 || (b.offset+b.length)*8 > bodyLen {
+				d.Fatalf("buffer %d at %d length %d outside body", i, b.offset, b.length)
+			}
+			d.RangeFn(bodyStart+b.offset*8, b.length*8, func(d *decode.D) {
+				d.FieldStruct("buffer", func(d *decode.D) {
+					if i < len(layout) {
+						d.FieldValueStr("field", layout[i].field)
+						d.FieldValueStr("kind", layout[i].kind)
+					}
+					if rb.codec == -1 || b.length == 0 {
+						d.FieldRawLen("data", b.length*8)
+						return
+					}
+					if b.length < compressedLengthBytes {
+						d.Fatalf("compressed buffer %d too short", i)
+					}
+					n := d.FieldS64("uncompressed_length", uncompressedLengthNames)
+					dataLen := d.BitsLeft()
+					if n == uncompressedLength {
+						d.FieldRawLen("data", dataLen)
+						return
+					}
+					compressed := d.BytesRange(d.Pos(), int(dataLen/8))
+					d.FieldRawLen("compressed", dataLen)
+					if uncompressed, err := uncompress(rb.codec, compressed); err == nil {
+						d.FieldRootBitBuf("data", bitio.NewBitReader(uncompressed, -1))
+					}
+				})
+			})
+		}
+	})
+}
+
+// decodeMessage decodes encapsulated message at current position, returns
+// false for end of stream
+func (dc *decodeContext) decodeMessage(d *decode.D, end int64) bool {
+	// continuation marker was added in 0.15
+	if d.PeekBits(32) == continuationMarker {
+		d.FieldU32("continuation", scalar.ActualHex)
+	}
+	metadataLength := d.FieldS32("metadata_length")
+	if metadataLength == 0 {
+		return false
+	}
+	if metadataLength < 0 || d.Pos()+metadataLength*8 > end {
+		d.Fatalf("invalid metadata length %d", metadataLength)
+	}
+
+	var headerType uint64
+	var bodyLength int64
+	var rb recordBatch
+	var layout []bufferLayout
+	d.FramedFn(metadataLength*8, func(d *decode.D) {
+		d.FieldStruct("metadata", func(d *decode.D) {
+			fieldOffset(d, func(d *decode.D) {
+				t := decodeTable(d)
+				dc.version = t.fieldS16(d, 0, "version", metadataV1, metadataVersionNames)
+				if dc.version > metadataV5 {
+					d.Fatalf("unknown metadata version %d", dc.version)
+				}
+				headerType = t.fieldU8(d, 1, "header_type", 0, headerTypeNames)
+				t.fieldTable(d, 2, "header", func(d *decode.D, t table) {
+					switch headerType {
+					case headerSchema:
+						dc.setSchema(decodeSchema(d, t))
+					case headerRecordBatch:
+						rb = decodeRecordBatch(d, t)
+						layout = dc.layout(dc.fields, "", rb.variadicCounts)
+					case headerDictionaryBatch:
+						id := t.fieldS64(d, 0, "id", 0)
+						t.fieldTable(d, 1, "data", func(d *decode.D, t table) {
+							rb = decodeRecordBatch(d, t)
+						})
+						t.fieldBool(d, 2, "is_delta")
+						if f, ok := dc.dictionaries[id]; ok {
+							// dictionary batch has one field with the value type
+							f.isDictionary = false
+							layout = dc.layout([]field{f}, "", rb.variadicCounts)
+						}
+					}
+				})
+				bodyLength = t.fieldS64(d, 3, "body_length", 0)
+				t.fieldKeyValues(d, 4, "custom_metadata")
+			})
+		})
+	})
+
+	if bodyLength < 0 || d.Pos()+bodyLength*8 > end {
+		d.Fatalf("invalid body length %d", bodyLength)
+	}
+	if bodyLength > 0 {
+		d.FramedFn(bodyLength*8, func(d *decode.D) {
+			d.FieldStruct("body", func(d *decode.D) {
+				if headerType == headerRecordBatch || headerType == headerDictionaryBatch {
+					decodeBody(d, rb, layout)
+				}
+			})
+		})
+	}
+
+	return true
+}
+
+func (dc *decodeContext) decodeMessages(d *decode.D, end int64) {
+	d.FieldArray("messages", func(d *decode.D) {
+		for d.Pos() < end {
+			more := true
+			d.FieldStruct("message", func(d *decode.D) {
+				more = dc.decodeMessage(d, end)
+			})
+			if !more {
+				break
+			}
+		}
+	})
+}
+
+func decodeBlock(d *decode.D) {
+	d.FieldStruct("block", func(d *decode.D) {
+		d.FieldS64("offset")
+		d.FieldS32("metadata_length")
+		d.FieldRawLen("padding", 32, d.BitBufIsZero())
+		d.FieldS64("body_length")
+	})
+}
+
+func decodeFooter(d *decode.D) {
+	fieldOffset(d, func(d *decode.D) {
+		t := decodeTable(d)
+		t.fieldS16(d, 0, "version", metadataV1, metadataVersionNames)
+		t.fieldTable(d, 1, "schema", func(d *decode.D, t table) {
+			decodeSchema(d, t)
+		})
+		t.fieldVector(d, 2, "dictionaries", 24, func(d *decode.D, _ int) { decodeBlock(d) })
+		t.fieldVector(d, 3, "record_batches", 24, func(d *decode.D, _ int) { decodeBlock(d) })
+		t.fieldKeyValues(d, 4, "custom_metadata")
+	})
+}
+
+func ipcDecode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	dc := &decodeContext{dictionaries: map[int64]field{}}
+
+	if bytes.Equal(d.PeekBytes(len(fileMagic)), fileMagic) {
+		d.FieldUTF8("magic", len(fileMagic), d.AssertStr(string(fileMagic)))
+		d.FieldRawLen("padding", (fileMagicBytes-int64(len(fileMagic)))*8, d.BitBufIsZero())
+
+		if d.Len() < (fileMagicBytes+fileTrailerBytes)*8 {
+			d.Fatalf("too short")
+		}
+		var footerLength int64
+		d.RangeFn(d.Len()-fileTrailerBytes*8, 32, func(d *decode.D) { footerLength = d.S32() })
+		footerStart := d.Len() - (fileTrailerBytes+footerLength)*8
+		if footerLength <= 0 || footerStart < d.Pos() {
+			d.Fatalf("invalid footer length %d", footerLength)
+		}
+
+		dc.decodeMessages(d, footerStart)
+		d.SeekAbs(footerStart)
+		d.FramedFn(footerLength*8, func(d *decode.D) {
+			d.FieldStruct("footer", decodeFooter)
+		})
+		d.FieldS32("footer_length")
+		d.FieldUTF8("magic_end", len(fileMagic), d.AssertStr(string(fileMagic)))
+		return nil
+	}
+
+	// stream has no magic, first message should be a schema
+	if d.PeekBits(32) != continuationMarker {
+		d.Fatalf("no continuation marker")
+	}
+	dc.decodeMessages(d, d.Len())
+	if len(dc.fields) == 0 {
+		d.Fatalf("no schema found")
+	}
+
+	return nil
+}
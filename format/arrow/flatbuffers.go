@@ -0,0 +1,178 @@
+package arrow
+
+// minimal flatbuffers reader for the fixed arrow schemas, tree layout is
+// same as the flatbuffers format
+
+import (
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// table field positions are absolute bit positions, 0 if not present
+type table struct {
+	fields []int64
+}
+
+func (t table) fieldFn(d *decode.D, id int, fn func(d *decode.D)) bool {
+	if id >= len(t.fields) || t.fields[id] == 0 {
+		return false
+	}
+	p := t.fields[id]
+	d.RangeFn(p, d.Len()-p, fn)
+	return true
+}
+
+// seek to uoffset target, offset is relative to its own position
+func fieldOffset(d *decode.D, fn func(d *decode.D)) {
+	offsetPos := d.Pos()
+	offset := d.FieldU32("offset")
+	target := offsetPos + int64(offset)*8
+	if offset == 0 || target >= d.Len() {
+		d.Fatalf("offset %d outside buffer", offset)
+	}
+	d.RangeFn(target, d.Len()-target, fn)
+}
+
+// decodeTable decodes table and its vtable at current position
+func decodeTable(d *decode.D) table {
+	tablePos := d.Pos()
+	vtableOffset := d.FieldS32("vtable_offset")
+	vtablePos := tablePos - vtableOffset*8
+	if vtablePos < 0 || vtablePos >= d.Len() {
+		d.Fatalf("vtable offset %d outside buffer", vtableOffset)
+	}
+
+	var t table
+	d.RangeFn(vtablePos, d.Len()-vtablePos, func(d *decode.D) {
+		d.FieldStruct("vtable", func(d *decode.D) {
+			vtableSize := d.FieldU16("vtable_size")
+			tableSize := d.FieldU16("table_size")
+			if vtableSize < 4 {
+				d.Fatalf("vtable size %d too small", vtableSize)
+			}
+			d.FieldArray("field_offsets", func(d *decode.D) {
+				for i := uint64(0); i < (vtableSize-4)/2; i++ {
+					off := d.FieldU16("field_offset")
+					if off >= tableSize && off != 0 {
+						d.Fatalf("field offset %d outside table", off)
+					}
+					var p int64
+					if off != 0 {
+						p = tablePos + int64(off)*8
+					}
+					t.fields = append(t.fields, p)
+				}
+			})
+		})
+	})
+
+	return t
+}
+
+// fieldS* and fieldBool adds a value field with the default value if not present
+
+func (t table) fieldS8(d *decode.D, id int, name string, def int64, sms ...scalar.Mapper) int64 {
+	v := def
+	if !t.fieldFn(d, id, func(d *decode.D) { v = d.FieldS8(name, sms...) }) {
+		d.FieldValueS(name, def, sms...)
+	}
+	return v
+}
+
+func (t table) fieldS16(d *decode.D, id int, name string, def int64, sms ...scalar.Mapper) int64 {
+	v := def
+	if !t.fieldFn(d, id, func(d *decode.D) { v = d.FieldS16(name, sms...) }) {
+		d.FieldValueS(name, def, sms...)
+	}
+	return v
+}
+
+func (t table) fieldS32(d *decode.D, id int, name string, def int64, sms ...scalar.Mapper) int64 {
+	v := def
+	if !t.fieldFn(d, id, func(d *decode.D) { v = d.FieldS32(name, sms...) }) {
+		d.FieldValueS(name, def, sms...)
+	}
+	return v
+}
+
+func (t table) fieldS64(d *decode.D, id int, name string, def int64, sms ...scalar.Mapper) int64 {
+	v := def
+	if !t.fieldFn(d, id, func(d *decode.D) { v = d.FieldS64(name, sms...) }) {
+		d.FieldValueS(name, def, sms...)
+	}
+	return v
+}
+
+func (t table) fieldU8(d *decode.D, id int, name string, def uint64, sms ...scalar.Mapper) uint64 {
+	v := def
+	if !t.fieldFn(d, id, func(d *decode.D) { v = d.FieldU8(name, sms...) }) {
+		d.FieldValueU(name, def, sms...)
+	}
+	return v
+}
+
+func (t table) fieldBool(d *decode.D, id int, name string) bool {
+	var v bool
+	if !t.fieldFn(d, id, func(d *decode.D) {
+		v = d.FieldBoolFn(name, func(d *decode.D) bool { return d.U8() != 0 })
+	}) {
+		d.FieldValueBool(name, false)
+	}
+	return v
+}
+
+func (t table) fieldTable(d *decode.D, id int, name string, fn func(d *decode.D, t table)) bool {
+	return t.fieldFn(d, id, func(d *decode.D) {
+		d.FieldStruct(name, func(d *decode.D) {
+			fieldOffset(d, func(d *decode.D) { fn(d, decodeTable(d)) })
+		})
+	})
+}
+
+func (t table) fieldString(d *decode.D, id int, name string) string {
+	var s string
+	t.fieldFn(d, id, func(d *decode.D) {
+		d.FieldStruct(name, func(d *decode.D) {
+			fieldOffset(d, func(d *decode.D) {
+				length := d.FieldU32("length")
+				s = d.FieldUTF8("value", int(length))
+			})
+		})
+	})
+	return s
+}
+
+// fieldVector calls fn for each element, elements are inline so tables are
+// offsets and structs are values
+func (t table) fieldVector(d *decode.D, id int, name string, elemSize int64, fn func(d *decode.D, i int)) {
+	t.fieldFn(d, id, func(d *decode.D) {
+		d.FieldStruct(name, func(d *decode.D) {
+			fieldOffset(d, func(d *decode.D) {
+				length := d.FieldU32("length")
+				if int64(length)*elemSize*8 > d.BitsLeft() {
+					d.Fatalf("vector length %d outside buffer", length)
+				}
+				d.FieldArray("value", func(d *decode.D) {
+					for i := 0; i < int(length); i++ {
+						fn(d, i)
+					}
+				})
+			})
+		})
+	})
+}
+
+func (t table) fieldTableVector(d *decode.D, id int, name string, elemName string, fn func(d *decode.D, t table)) {
+	t.fieldVector(d, id, name, 4, func(d *decode.D, _ int) {
+		d.FieldStruct(elemName, func(d *decode.D) {
+			fieldOffset(d, func(d *decode.D) { fn(d, decodeTable(d)) })
+		})
+	})
+}
+
+func (t table) fieldKeyValues(d *decode.D, id int, name string) {
+	t.fieldTableVector(d, id, name, "key_value", func(d *decode.D, t table) {
+		t.fieldString(d, 0, "key")
+		t.fieldString(d, 1, "value")
+	})
+}
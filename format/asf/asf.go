@@ -0,0 +1,576 @@
+package asf
+
+// https://learn.microsoft.com/en-us/windows/win32/wmformat/overview-of-the-asf-format
+// http://drang.s4.xrea.com/program/tips/id3tag/wmp/pdf/ASF_Specification.pdf
+// https://github.com/FFmpeg/FFmpeg/blob/master/libavformat/asfdec_f.c
+
+// TODO: compressed payloads (replicated data length 1)
+// TODO: decode payloads as media objects
+
+import (
+	"bytes"
+	"embed"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed asf.jq
+var asfFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.ASF,
+		Description: "Advanced Systems Format (WMV/WMA)",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    asfDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(asfFS)
+}
+
+// guid string to bytes, first three groups are little endian
+func guidBytes(s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(b) != 16 {
+		panic(fmt.Sprintf("invalid guid %q", s))
+	}
+	return []byte{
+		b[3], b[2], b[1], b[0],
+		b[5], b[4],
+		b[7], b[6],
+		b[8], b[9], b[10], b[11], b[12], b[13], b[14], b[15],
+	}
+}
+
+var (
+	guidHeader                     = guidBytes("75B22630-668E-11CF-A6D9-00AA0062CE6C")
+	guidData                       = guidBytes("75B22636-668E-11CF-A6D9-00AA0062CE6C")
+	guidSimpleIndex                = guidBytes("33000890-E5B1-11CF-89F4-00A0C90349CB")
+	guidIndex                      = guidBytes("D6E229D3-35DA-11D1-9034-00A0C90349BE")
+	guidFileProperties             = guidBytes("8CABDCA1-A947-11CF-8EE4-00C00C205365")
+	guidStreamProperties           = guidBytes("B7DC0791-A9B7-11CF-8EE6-00C00C205365")
+	guidHeaderExtension            = guidBytes("5FBF03B5-A92E-11CF-8EE3-00C00C205365")
+	guidCodecList                  = guidBytes("86D15240-311D-11D0-A3A4-00A0C90348F6")
+	guidContentDescription         = guidBytes("75B22633-668E-11CF-A6D9-00AA0062CE6C")
+	guidExtendedContentDescription = guidBytes("D2D0A440-E307-11D2-97F0-00A0C95EA850")
+	guidStreamBitrateProperties    = guidBytes("7BF875CE-468D-11D1-8D82-006097C9A2B2")
+	guidPadding                    = guidBytes("1806D474-CADF-4509-A4BA-9AABCB96AAE8")
+	guidContentEncryption          = guidBytes("2211B3FB-BD23-11D2-B4B7-00A0C955FC6E")
+	guidExtendedContentEncryption  = guidBytes("298AE614-2622-4C17-B935-DAE07EE9289C")
+	guidMetadata                   = guidBytes("C5F8CBEA-5BAF-4877-8467-AA8C44FA4CCA")
+	guidMetadataLibrary            = guidBytes("44231C94-9498-49D1-A141-1D134E457054")
+	guidExtendedStreamProperties   = guidBytes("14E6A5CB-C672-4332-8399-A96952065B5A")
+	guidLanguageList               = guidBytes("7C4346A9-EFE0-4BFC-B229-393EDE415C85")
+	guidReserved1                  = guidBytes("ABD3D211-A9BA-11CF-8EE6-00C00C205365")
+	guidReserved2                  = guidBytes("86D15241-311D-11D0-A3A4-00A0C90348F6")
+
+	guidAudioMedia        = guidBytes("F8699E40-5B4D-11CF-A8FD-00805F5C442B")
+	guidVideoMedia        = guidBytes("BC19EFC0-5B4D-11CF-A8FD-00805F5C442B")
+	guidCommandMedia      = guidBytes("59DACFC0-59E6-11D0-A3AC-00A0C90348F6")
+	guidJFIFMedia         = guidBytes("B61BE100-5B4E-11CF-A8FD-00805F5C442B")
+	guidDegradableJPEG    = guidBytes("35907DE0-E415-11CF-A917-00805F5C442B")
+	guidFileTransferMedia = guidBytes("91BD222C-F21C-497A-8B6D-5AA86BFC0185")
+	guidBinaryMedia       = guidBytes("3AFB65E2-47EF-40F2-AC2C-70A90D71D343")
+
+	guidNoErrorCorrection = guidBytes("20FB5700-5B55-11CF-A8FD-00805F5C442B")
+	guidAudioSpread       = guidBytes("BFC3CD50-618F-11CF-8BB2-00AA00B4E220")
+)
+
+var guidNames = scalar.BytesToScalar{
+	{Bytes: guidHeader, Scalar: scalar.S{Sym: "header"}},
+	{Bytes: guidData, Scalar: scalar.S{Sym: "data"}},
+	{Bytes: guidSimpleIndex, Scalar: scalar.S{Sym: "simple_index"}},
+	{Bytes: guidIndex, Scalar: scalar.S{Sym: "index"}},
+	{Bytes: guidFileProperties, Scalar: scalar.S{Sym: "file_properties"}},
+	{Bytes: guidStreamProperties, Scalar: scalar.S{Sym: "stream_properties"}},
+	{Bytes: guidHeaderExtension, Scalar: scalar.S{Sym: "header_extension"}},
+	{Bytes: guidCodecList, Scalar: scalar.S{Sym: "codec_list"}},
+	{Bytes: guidContentDescription, Scalar: scalar.S{Sym: "content_description"}},
+	{Bytes: guidExtendedContentDescription, Scalar: scalar.S{Sym: "extended_content_description"}},
+	{Bytes: guidStreamBitrateProperties, Scalar: scalar.S{Sym: "stream_bitrate_properties"}},
+	{Bytes: guidPadding, Scalar: scalar.S{Sym: "padding"}},
+	{Bytes: guidContentEncryption, Scalar: scalar.S{Sym: "content_encryption"}},
+	{Bytes: guidExtendedContentEncryption, Scalar: scalar.S{Sym: "extended_content_encryption"}},
+	{Bytes: guidMetadata, Scalar: scalar.S{Sym: "metadata"}},
+	{Bytes: guidMetadataLibrary, Scalar: scalar.S{Sym: "metadata_library"}},
+	{Bytes: guidExtendedStreamProperties, Scalar: scalar.S{Sym: "extended_stream_properties"}},
+	{Bytes: guidLanguageList, Scalar: scalar.S{Sym: "language_list"}},
+	{Bytes: guidReserved1, Scalar: scalar.S{Sym: "reserved1"}},
+	{Bytes: guidReserved2, Scalar: scalar.S{Sym: "reserved2"}},
+	{Bytes: guidAudioMedia, Scalar: scalar.S{Sym: "audio_media"}},
+	{Bytes: guidVideoMedia, Scalar: scalar.S{Sym: "video_media"}},
+	{Bytes: guidCommandMedia, Scalar: scalar.S{Sym: "command_media"}},
+	{Bytes: guidJFIFMedia, Scalar: scalar.S{Sym: "jfif_media"}},
+	{Bytes: guidDegradableJPEG, Scalar: scalar.S{Sym: "degradable_jpeg_media"}},
+	{Bytes: guidFileTransferMedia, Scalar: scalar.S{Sym: "file_transfer_media"}},
+	{Bytes: guidBinaryMedia, Scalar: scalar.S{Sym: "binary_media"}},
+	{Bytes: guidNoErrorCorrection, Scalar: scalar.S{Sym: "no_error_correction"}},
+	{Bytes: guidAudioSpread, Scalar: scalar.S{Sym: "audio_spread"}},
+}
+
+var rawGUID = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	return scalar.RawSym(s, 16, func(b []byte) string {
+		return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+			binary.LittleEndian.Uint32(b[0:4]), binary.LittleEndian.Uint16(b[4:6]), binary.LittleEndian.Uint16(b[6:8]),
+			b[8:10], b[10:16])
+	})
+})
+
+// FILETIME, 100ns intervals since 1601-01-01
+const filetimeUnixEpochDiff = 11644473600
+
+var descriptionFiletime = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	v := s.ActualU()
+	if v == 0 {
+		return s, nil
+	}
+	s.Description = time.Unix(int64(v/10_000_000)-filetimeUnixEpochDiff, int64(v%10_000_000)*100).UTC().Format(time.RFC3339)
+	return s, nil
+})
+
+// 100ns units
+var description100ns = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	s.Description = (time.Duration(s.ActualU()) * 100).String()
+	return s, nil
+})
+
+// subset of ffmpeg libavformat/riff.c
+var audioCodecNames = scalar.UToSymStr{
+	0x0001: "pcm",
+	0x0002: "adpcm_ms",
+	0x0003: "pcm_float",
+	0x000a: "wmavoice",
+	0x0050: "mp2",
+	0x0055: "mp3",
+	0x00ff: "aac",
+	0x0160: "wmav1",
+	0x0161: "wmav2",
+	0x0162: "wmapro",
+	0x0163: "wmalossless",
+	0x1600: "aac",
+	0x2000: "ac3",
+	0x2001: "dts",
+}
+
+var codecTypeNames = scalar.UToSymStr{
+	0x0001: "video",
+	0x0002: "audio",
+	0xffff: "unknown",
+}
+
+const (
+	valueTypeUnicode = 0
+	valueTypeBytes   = 1
+	valueTypeBool    = 2
+	valueTypeDWORD   = 3
+	valueTypeQWORD   = 4
+	valueTypeWORD    = 5
+	valueTypeGUID    = 6
+)
+
+var valueTypeNames = scalar.UToSymStr{
+	valueTypeUnicode: "unicode",
+	valueTypeBytes:   "bytes",
+	valueTypeBool:    "bool",
+	valueTypeDWORD:   "dword",
+	valueTypeQWORD:   "qword",
+	valueTypeWORD:    "word",
+	valueTypeGUID:    "guid",
+}
+
+type asfState struct {
+	packetSize uint64
+}
+
+func fieldGUID(d *decode.D, name string) []byte {
+	b := d.PeekBytes(16)
+	d.FieldRawLen(name, 16*8, rawGUID, guidNames)
+	return b
+}
+
+// utf16 string with length in bytes, usually null terminated
+func fieldUTF16(d *decode.D, name string, nBytes uint64) {
+	d.FieldUTF16LE(name, int(nBytes), scalar.ActualTrim("\x00"))
+}
+
+func fieldValue(d *decode.D, name string, valueType uint64, length uint64, boolBytes int) {
+	switch {
+	case valueType == valueTypeUnicode:
+		fieldUTF16(d, name, length)
+	case valueType == valueTypeBool && length == uint64(boolBytes):
+		d.FieldU(name, boolBytes*8)
+	case valueType == valueTypeDWORD && length == 4:
+		d.FieldU32(name)
+	case valueType == valueTypeQWORD && length == 8:
+		d.FieldU64(name)
+	case valueType == valueTypeWORD && length == 2:
+		d.FieldU16(name)
+	case valueType == valueTypeGUID && length == 16:
+		d.FieldRawLen(name, 16*8, rawGUID, guidNames)
+	default:
+		d.FieldRawLen(name, int64(length)*8)
+	}
+}
+
+func decodeObjects(d *decode.D, s *asfState) {
+	for d.BitsLeft() >= 24*8 {
+		d.FieldStruct("object", func(d *decode.D) { decodeObject(d, s) })
+	}
+}
+
+func decodeStreamProperties(d *decode.D) {
+	streamType := fieldGUID(d, "stream_type")
+	fieldGUID(d, "error_correction_type")
+	d.FieldU64("time_offset", description100ns)
+	typeSpecificLength := d.FieldU32("type_specific_data_length")
+	errorCorrectionLength := d.FieldU32("error_correction_data_length")
+	flags := d.FieldU16("flags", scalar.ActualHex)
+	d.FieldValueU("stream_number", flags&0x7f)
+	d.FieldValueBool("encrypted_content", flags&0x8000 != 0)
+	d.FieldU32("reserved")
+
+	d.FramedFn(int64(typeSpecificLength)*8, func(d *decode.D) {
+		d.FieldStruct("type_specific_data", func(d *decode.D) {
+			switch {
+			case bytes.Equal(streamType, guidAudioMedia) && d.BitsLeft() >= 16*8:
+				d.FieldU16("codec_id", audioCodecNames, scalar.ActualHex)
+				d.FieldU16("channels")
+				d.FieldU32("samples_per_second")
+				d.FieldU32("average_bytes_per_second")
+				d.FieldU16("block_align")
+				d.FieldU16("bits_per_sample")
+				if d.BitsLeft() >= 16 {
+					codecDataSize := d.FieldU16("codec_specific_data_size")
+					d.FieldRawLen("codec_specific_data", int64(codecDataSize)*8)
+				}
+			case bytes.Equal(streamType, guidVideoMedia) && d.BitsLeft() >= 11*8:
+				d.FieldU32("encoded_image_width")
+				d.FieldU32("encoded_image_height")
+				d.FieldU8("reserved_flags")
+				formatDataSize := d.FieldU16("format_data_size")
+				d.FramedFn(int64(formatDataSize)*8, func(d *decode.D) {
+					d.FieldStruct("format_data", func(d *decode.D) {
+						d.FieldU32("format_data_size")
+						d.FieldS32("image_width")
+						d.FieldS32("image_height")
+						d.FieldU16("reserved")
+						d.FieldU16("bits_per_pixel_count")
+						d.FieldUTF8("compression_id", 4)
+						d.FieldU32("image_size")
+						d.FieldS32("horizontal_pixels_per_meter")
+						d.FieldS32("vertical_pixels_per_meter")
+						d.FieldU32("colors_used_count")
+						d.FieldU32("important_colors_count")
+						if d.BitsLeft() > 0 {
+							d.FieldRawLen("codec_specific_data", d.BitsLeft())
+						}
+					})
+				})
+			}
+			if d.BitsLeft() > 0 {
+				d.FieldRawLen("data", d.BitsLeft())
+			}
+		})
+	})
+	d.FramedFn(int64(errorCorrectionLength)*8, func(d *decode.D) {
+		d.FieldStruct("error_correction_data", func(d *decode.D) {
+			if d.BitsLeft() >= 8*8 {
+				d.FieldU8("span")
+				d.FieldU16("virtual_packet_length")
+				d.FieldU16("virtual_chunk_length")
+				d.FieldU16("silence_data_length")
+			}
+			if d.BitsLeft() > 0 {
+				d.FieldRawLen("silence_data", d.BitsLeft())
+			}
+		})
+	})
+}
+
+// length type 0 is not present, 1 byte, 2 word and 3 dword
+func fieldVarLen(d *decode.D, name string, lengthType uint64) uint64 {
+	switch lengthType {
+	case 1:
+		return d.FieldU8(name)
+	case 2:
+		return d.FieldU16(name)
+	case 3:
+		return d.FieldU32(name)
+	default:
+		return 0
+	}
+}
+
+func decodeDataPacket(d *decode.D) {
+	if d.PeekBits(1) == 1 {
+		d.FieldStruct("error_correction", func(d *decode.D) {
+			d.FieldBool("error_correction_present")
+			d.FieldU2("error_correction_length_type")
+			d.FieldBool("opaque_data_present")
+			length := d.FieldU4("error_correction_data_length")
+			d.FieldRawLen("error_correction_data", int64(length)*8)
+		})
+	}
+
+	var multiplePayloads bool
+	var sequenceType, paddingLengthType, packetLengthType uint64
+	var replicatedDataLengthType, offsetLengthType, mediaObjectNumberLengthType, streamNumberLengthType uint64
+	var paddingLength uint64
+	d.FieldStruct("payload_parsing_information", func(d *decode.D) {
+		d.FieldStruct("length_type_flags", func(d *decode.D) {
+			d.FieldBool("error_correction_present")
+			packetLengthType = d.FieldU2("packet_length_type")
+			paddingLengthType = d.FieldU2("padding_length_type")
+			sequenceType = d.FieldU2("sequence_type")
+			multiplePayloads = d.FieldBool("multiple_payloads_present")
+		})
+		d.FieldStruct("property_flags", func(d *decode.D) {
+			streamNumberLengthType = d.FieldU2("stream_number_length_type")
+			mediaObjectNumberLengthType = d.FieldU2("media_object_number_length_type")
+			offsetLengthType = d.FieldU2("offset_into_media_object_length_type")
+			replicatedDataLengthType = d.FieldU2("replicated_data_length_type")
+		})
+		fieldVarLen(d, "packet_length", packetLengthType)
+		fieldVarLen(d, "sequence", sequenceType)
+		paddingLength = fieldVarLen(d, "padding_length", paddingLengthType)
+		d.FieldU32("send_time")
+		d.FieldU16("duration")
+	})
+	if streamNumberLengthType != 1 {
+		d.Fatalf("invalid stream number length type %d", streamNumberLengthType)
+	}
+
+	payloadFn := func(d *decode.D, payloadLengthType uint64) {
+		d.FieldBool("key_frame")
+		d.FieldU7("stream_number")
+		fieldVarLen(d, "media_object_number", mediaObjectNumberLengthType)
+		fieldVarLen(d, "offset_into_media_object", offsetLengthType)
+		replicatedDataLength := fieldVarLen(d, "replicated_data_length", replicatedDataLengthType)
+		if replicatedDataLength >= 8 {
+			d.FieldStruct("replicated_data", func(d *decode.D) {
+				d.FieldU32("media_object_size")
+				d.FieldU32("presentation_time")
+				if replicatedDataLength > 8 {
+					d.FieldRawLen("data", int64(replicatedDataLength-8)*8)
+				}
+			})
+		} else if replicatedDataLength > 0 {
+			d.FieldRawLen("replicated_data", int64(replicatedDataLength)*8)
+		}
+		var payloadLength int64
+		if payloadLengthType != 0 {
+			payloadLength = int64(fieldVarLen(d, "payload_length", payloadLengthType)) * 8
+		} else {
+			payloadLength = d.BitsLeft() - int64(paddingLength)*8
+		}
+		if payloadLength < 0 || payloadLength > d.BitsLeft() {
+			d.Fatalf("payload length outside packet")
+		}
+		d.FieldRawLen("payload_data", payloadLength)
+	}
+
+	var payloadLengthType uint64
+	numPayloads := uint64(1)
+	if multiplePayloads {
+		d.FieldStruct("payload_flags", func(d *decode.D) {
+			payloadLengthType = d.FieldU2("payload_length_type")
+			numPayloads = d.FieldU6("number_of_payloads")
+		})
+		if payloadLengthType == 0 {
+			d.Fatalf("invalid payload length type 0")
+		}
+	}
+	d.FieldArray("payloads", func(d *decode.D) {
+		for i := uint64(0); i < numPayloads; i++ {
+			d.FieldStruct("payload", func(d *decode.D) { payloadFn(d, payloadLengthType) })
+		}
+	})
+
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("padding_data", d.BitsLeft())
+	}
+}
+
+func decodeObject(d *decode.D, s *asfState) {
+	guid := fieldGUID(d, "guid")
+	size := d.FieldU64("size")
+	if size < 24 || int64(size-24)*8 > d.BitsLeft() {
+		d.Fatalf("invalid object size %d", size)
+	}
+
+	d.FramedFn(int64(size-24)*8, func(d *decode.D) {
+		switch {
+		case bytes.Equal(guid, guidHeader):
+			d.FieldU32("number_of_header_objects")
+			d.FieldU8("reserved1")
+			d.FieldU8("reserved2")
+			d.FieldArray("objects", func(d *decode.D) { decodeObjects(d, s) })
+		case bytes.Equal(guid, guidFileProperties):
+			fieldGUID(d, "file_id")
+			d.FieldU64("file_size")
+			d.FieldU64("creation_date", descriptionFiletime)
+			d.FieldU64("data_packets_count")
+			d.FieldU64("play_duration", description100ns)
+			d.FieldU64("send_duration", description100ns)
+			d.FieldU64("preroll")
+			flags := d.FieldU32("flags", scalar.ActualHex)
+			d.FieldValueBool("broadcast", flags&0x1 != 0)
+			d.FieldValueBool("seekable", flags&0x2 != 0)
+			minPacketSize := d.FieldU32("minimum_data_packet_size")
+			maxPacketSize := d.FieldU32("maximum_data_packet_size")
+			d.FieldU32("maximum_bitrate")
+			if minPacketSize == maxPacketSize {
+				s.packetSize = minPacketSize
+			}
+		case bytes.Equal(guid, guidStreamProperties):
+			decodeStreamProperties(d)
+		case bytes.Equal(guid, guidHeaderExtension):
+			fieldGUID(d, "reserved_field1")
+			d.FieldU16("reserved_field2")
+			dataSize := d.FieldU32("header_extension_data_size")
+			d.FramedFn(int64(dataSize)*8, func(d *decode.D) {
+				d.FieldArray("objects", func(d *decode.D) { decodeObjects(d, s) })
+			})
+		case bytes.Equal(guid, guidCodecList):
+			fieldGUID(d, "reserved")
+			count := d.FieldU32("codec_entries_count")
+			d.FieldArray("codec_entries", func(d *decode.D) {
+				for i := uint64(0); i < count; i++ {
+					d.FieldStruct("codec_entry", func(d *decode.D) {
+						d.FieldU16("type", codecTypeNames)
+						nameLength := d.FieldU16("codec_name_length")
+						fieldUTF16(d, "codec_name", nameLength*2)
+						descriptionLength := d.FieldU16("codec_description_length")
+						fieldUTF16(d, "codec_description", descriptionLength*2)
+						informationLength := d.FieldU16("codec_information_length")
+						d.FieldRawLen("codec_information", int64(informationLength)*8)
+					})
+				}
+			})
+		case bytes.Equal(guid, guidContentDescription):
+			titleLength := d.FieldU16("title_length")
+			authorLength := d.FieldU16("author_length")
+			copyrightLength := d.FieldU16("copyright_length")
+			descriptionLength := d.FieldU16("description_length")
+			ratingLength := d.FieldU16("rating_length")
+			fieldUTF16(d, "title", titleLength)
+			fieldUTF16(d, "author", authorLength)
+			fieldUTF16(d, "copyright", copyrightLength)
+			fieldUTF16(d, "description", descriptionLength)
+			fieldUTF16(d, "rating", ratingLength)
+		case bytes.Equal(guid, guidExtendedContentDescription):
+			count := d.FieldU16("content_descriptors_count")
+			d.FieldArray("content_descriptors", func(d *decode.D) {
+				for i := uint64(0); i < count; i++ {
+					d.FieldStruct("content_descriptor", func(d *decode.D) {
+						nameLength := d.FieldU16("name_length")
+						fieldUTF16(d, "name", nameLength)
+						valueType := d.FieldU16("value_data_type", valueTypeNames)
+						valueLength := d.FieldU16("value_length")
+						// bool is 32 bit in extended content description
+						fieldValue(d, "value", valueType, valueLength, 4)
+					})
+				}
+			})
+		case bytes.Equal(guid, guidMetadata), bytes.Equal(guid, guidMetadataLibrary):
+			count := d.FieldU16("description_records_count")
+			d.FieldArray("description_records", func(d *decode.D) {
+				for i := uint64(0); i < count; i++ {
+					d.FieldStruct("description_record", func(d *decode.D) {
+						d.FieldU16("language_list_index")
+						d.FieldU16("stream_number")
+						nameLength := d.FieldU16("name_length")
+						valueType := d.FieldU16("data_type", valueTypeNames)
+						dataLength := d.FieldU32("data_length")
+						fieldUTF16(d, "name", nameLength)
+						// bool is 16 bit in metadata objects
+						fieldValue(d, "data", valueType, dataLength, 2)
+					})
+				}
+			})
+		case bytes.Equal(guid, guidLanguageList):
+			count := d.FieldU16("language_id_records_count")
+			d.FieldArray("language_id_records", func(d *decode.D) {
+				for i := uint64(0); i < count; i++ {
+					d.FieldStruct("language_id_record", func(d *decode.D) {
+						length := d.FieldU8("language_id_length")
+						fieldUTF16(d, "language_id", length)
+					})
+				}
+			})
+		case bytes.Equal(guid, guidStreamBitrateProperties):
+			count := d.FieldU16("bitrate_records_count")
+			d.FieldArray("bitrate_records", func(d *decode.D) {
+				for i := uint64(0); i < count; i++ {
+					d.FieldStruct("bitrate_record", func(d *decode.D) {
+						flags := d.FieldU16("flags", scalar.ActualHex)
+						d.FieldValueU("stream_number", flags&0x7f)
+						d.FieldU32("average_bitrate")
+					})
+				}
+			})
+		case bytes.Equal(guid, guidPadding):
+			d.FieldRawLen("padding_data", d.BitsLeft())
+		case bytes.Equal(guid, guidData):
+			fieldGUID(d, "file_id")
+			packetsCount := d.FieldU64("total_data_packets")
+			d.FieldU16("reserved")
+			if s.packetSize == 0 {
+				d.FieldRawLen("data", d.BitsLeft())
+				return
+			}
+			d.FieldArray("packets", func(d *decode.D) {
+				for i := uint64(0); i < packetsCount && d.BitsLeft() >= int64(s.packetSize)*8; i++ {
+					d.FramedFn(int64(s.packetSize)*8, func(d *decode.D) {
+						d.FieldStruct("packet", decodeDataPacket)
+					})
+				}
+			})
+			if d.BitsLeft() > 0 {
+				d.FieldRawLen("unknown", d.BitsLeft())
+			}
+		case bytes.Equal(guid, guidSimpleIndex):
+			fieldGUID(d, "file_id")
+			d.FieldU64("index_entry_time_interval", description100ns)
+			d.FieldU32("maximum_packet_count")
+			count := d.FieldU32("index_entries_count")
+			d.FieldArray("index_entries", func(d *decode.D) {
+				for i := uint64(0); i < count; i++ {
+					d.FieldStruct("index_entry", func(d *decode.D) {
+						d.FieldU32("packet_number")
+						d.FieldU16("packet_count")
+					})
+				}
+			})
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("unknown", d.BitsLeft())
+		}
+	})
+}
+
+func asfDecode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	if !bytes.Equal(d.PeekBytes(16), guidHeader) {
+		d.Fatalf("no header object found")
+	}
+
+	var s asfState
+	d.FieldArray("objects", func(d *decode.D) { decodeObjects(d, &s) })
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("trailing", d.BitsLeft())
+	}
+
+	return nil
+}
@@ -0,0 +1,336 @@
+package avi
+
+// https://learn.microsoft.com/en-us/windows/win32/directshow/avi-riff-file-reference
+// http://www.jmcgowan.com/odmlff2.pdf
+// https://github.com/FFmpeg/FFmpeg/blob/master/libavformat/avidec.c
+
+// TODO: decode stream chunk data using codec decoders
+// TODO: vprp and other OpenDML header chunks
+
+import (
+	"bytes"
+	"embed"
+	"strconv"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed avi.jq
+var aviFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.AVI,
+		Description: "Audio Video Interleave",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    aviDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(aviFS)
+}
+
+var streamTypeNames = scalar.StrToSymStr{
+	"vids": "video",
+	"auds": "audio",
+	"txts": "text",
+	"mids": "midi",
+}
+
+// two character code after stream number in movi chunk ids
+var streamChunkTypeNames = scalar.StrToSymStr{
+	"db": "uncompressed_video",
+	"dc": "compressed_video",
+	"pc": "palette_change",
+	"wb": "audio",
+	"tx": "text",
+}
+
+// subset of ffmpeg libavformat/riff.c
+var audioFormatNames = scalar.UToSymStr{
+	0x0001: "pcm",
+	0x0002: "adpcm_ms",
+	0x0003: "pcm_float",
+	0x0006: "pcm_alaw",
+	0x0007: "pcm_mulaw",
+	0x0011: "adpcm_ima_wav",
+	0x0050: "mp2",
+	0x0055: "mp3",
+	0x00ff: "aac",
+	0x0160: "wmav1",
+	0x0161: "wmav2",
+	0x1600: "aac",
+	0x2000: "ac3",
+	0x2001: "dts",
+	0xfffe: "extensible",
+}
+
+const (
+	indexOfIndexes = 0x00
+	indexOfChunks  = 0x01
+)
+
+var indexTypeNames = scalar.UToSymStr{
+	indexOfIndexes: "indexes",
+	indexOfChunks:  "chunks",
+	0x80:           "data",
+}
+
+const indexSubType2Field = 0x01
+
+var indexSubTypeNames = scalar.UToSymStr{
+	0x00:               "default",
+	indexSubType2Field: "2field",
+}
+
+type aviState struct {
+	// fccType of last strh, decides how strf is decoded
+	streamType string
+}
+
+func decodeMainHeader(d *decode.D) {
+	d.FieldU32("micro_sec_per_frame")
+	d.FieldU32("max_bytes_per_sec")
+	d.FieldU32("padding_granularity")
+	flags := d.FieldU32("flags", scalar.ActualHex)
+	d.FieldValueBool("has_index", flags&0x10 != 0)
+	d.FieldValueBool("must_use_index", flags&0x20 != 0)
+	d.FieldValueBool("is_interleaved", flags&0x100 != 0)
+	d.FieldValueBool("trust_ck_type", flags&0x800 != 0)
+	d.FieldValueBool("was_capture_file", flags&0x10000 != 0)
+	d.FieldValueBool("copyrighted", flags&0x20000 != 0)
+	d.FieldU32("total_frames")
+	d.FieldU32("initial_frames")
+	d.FieldU32("streams")
+	d.FieldU32("suggested_buffer_size")
+	d.FieldU32("width")
+	d.FieldU32("height")
+	d.FieldArray("reserved", func(d *decode.D) {
+		for i := 0; i < 4; i++ {
+			d.FieldU32("reserved")
+		}
+	})
+}
+
+func decodeStreamHeader(d *decode.D, s *aviState) {
+	s.streamType = d.FieldUTF8("type", 4, streamTypeNames)
+	d.FieldUTF8("handler", 4, scalar.ActualTrim("\x00"))
+	flags := d.FieldU32("flags", scalar.ActualHex)
+	d.FieldValueBool("disabled", flags&0x1 != 0)
+	d.FieldValueBool("video_palette_changes", flags&0x10000 != 0)
+	d.FieldU16("priority")
+	d.FieldU16("language")
+	d.FieldU32("initial_frames")
+	d.FieldU32("scale")
+	d.FieldU32("rate")
+	d.FieldU32("start")
+	d.FieldU32("length")
+	d.FieldU32("suggested_buffer_size")
+	d.FieldS32("quality")
+	d.FieldU32("sample_size")
+	// some muxers write a shorter header without frame rectangle
+	if d.BitsLeft() >= 4*16 {
+		d.FieldStruct("frame", func(d *decode.D) {
+			d.FieldS16("left")
+			d.FieldS16("top")
+			d.FieldS16("right")
+			d.FieldS16("bottom")
+		})
+	}
+}
+
+func decodeStreamFormat(d *decode.D, s *aviState) {
+	switch {
+	case s.streamType == "vids" && d.BitsLeft() >= 40*8:
+		d.FieldU32("header_size")
+		d.FieldS32("width")
+		d.FieldS32("height")
+		d.FieldU16("planes")
+		d.FieldU16("bit_count")
+		d.FieldUTF8("compression", 4, scalar.ActualTrim("\x00"))
+		d.FieldU32("size_image")
+		d.FieldS32("x_pels_per_meter")
+		d.FieldS32("y_pels_per_meter")
+		d.FieldU32("clr_used")
+		d.FieldU32("clr_important")
+	case s.streamType == "auds" && d.BitsLeft() >= 16*8:
+		d.FieldU16("format_tag", audioFormatNames, scalar.ActualHex)
+		d.FieldU16("channels")
+		d.FieldU32("samples_per_sec")
+		d.FieldU32("avg_bytes_per_sec")
+		d.FieldU16("block_align")
+		d.FieldU16("bits_per_sample")
+		if d.BitsLeft() >= 16 {
+			cbSize := d.FieldU16("cb_size")
+			if int64(cbSize)*8 <= d.BitsLeft() {
+				d.FieldRawLen("extra_data", int64(cbSize)*8)
+			}
+		}
+	}
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+}
+
+func decodeOldIndex(d *decode.D) {
+	d.FieldStructArrayLoop("entries", "entry", func() bool { return d.BitsLeft() >= 16*8 }, func(d *decode.D) {
+		d.FieldUTF8("chunk_id", 4)
+		flags := d.FieldU32("flags", scalar.ActualHex)
+		d.FieldValueBool("list", flags&0x1 != 0)
+		d.FieldValueBool("key_frame", flags&0x10 != 0)
+		d.FieldValueBool("no_time", flags&0x100 != 0)
+		d.FieldU32("offset")
+		d.FieldU32("size")
+	})
+}
+
+// super index (indx) and standard index (ix##) chunks
+func decodeIndex(d *decode.D) {
+	longsPerEntry := d.FieldU16("longs_per_entry")
+	indexSubType := d.FieldU8("index_sub_type", indexSubTypeNames)
+	indexType := d.FieldU8("index_type", indexTypeNames)
+	entriesInUse := d.FieldU32("entries_in_use")
+	d.FieldUTF8("chunk_id", 4)
+
+	switch indexType {
+	case indexOfIndexes:
+		d.FieldArray("reserved", func(d *decode.D) {
+			for i := 0; i < 3; i++ {
+				d.FieldU32("reserved")
+			}
+		})
+		d.FieldArray("entries", func(d *decode.D) {
+			for i := uint64(0); i < entriesInUse; i++ {
+				d.FieldStruct("entry", func(d *decode.D) {
+					d.FieldU64("offset")
+					d.FieldU32("size")
+					d.FieldU32("duration")
+				})
+			}
+		})
+	case indexOfChunks:
+		d.FieldU64("base_offset")
+		d.FieldU32("reserved")
+		d.FieldArray("entries", func(d *decode.D) {
+			for i := uint64(0); i < entriesInUse; i++ {
+				d.FramedFn(int64(longsPerEntry)*32, func(d *decode.D) {
+					d.FieldStruct("entry", func(d *decode.D) {
+						d.FieldU32("offset")
+						size := d.FieldU32("size", scalar.ActualHex)
+						d.FieldValueBool("key_frame", size&0x8000_0000 == 0)
+						d.FieldValueU("data_size", size&0x7fff_ffff)
+						if indexSubType == indexSubType2Field {
+							d.FieldU32("offset_field2")
+						}
+						if d.BitsLeft() > 0 {
+							d.FieldRawLen("unknown", d.BitsLeft())
+						}
+					})
+				})
+			}
+		})
+	}
+	// super index usually has preallocated unused entries
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unused", d.BitsLeft())
+	}
+}
+
+// stream chunk ids in movi are two digit stream number and two character type, ex "00dc" and "01wb"
+func parseStreamChunkID(id string) (uint64, string, bool) {
+	if len(id) != 4 {
+		return 0, "", false
+	}
+	n, err := strconv.ParseUint(id[0:2], 10, 8)
+	if err != nil {
+		return 0, "", false
+	}
+	return n, id[2:4], true
+}
+
+func decodeChunk(d *decode.D, s *aviState, listType string) {
+	id := d.FieldUTF8("id", 4, scalar.ActualTrimSpace)
+	inMovi := listType == "movi" || listType == "rec"
+	if inMovi {
+		if streamNumber, chunkType, ok := parseStreamChunkID(id); ok {
+			d.FieldValueU("stream_number", streamNumber)
+			d.FieldValueStr("stream_type", chunkType, streamChunkTypeNames)
+		}
+	}
+	size := int64(d.FieldU32("size"))
+	if size*8 > d.BitsLeft() {
+		d.Fatalf("chunk size %d outside buffer", size)
+	}
+
+	d.FramedFn(size*8, func(d *decode.D) {
+		switch {
+		case id == "RIFF":
+			d.FieldUTF8("form_type", 4, scalar.ActualTrimSpace)
+			decodeChunks(d, s, "")
+		case id == "LIST":
+			listType := d.FieldUTF8("list_type", 4, scalar.ActualTrimSpace)
+			decodeChunks(d, s, listType)
+		case id == "avih":
+			decodeMainHeader(d)
+		case id == "strh":
+			decodeStreamHeader(d, s)
+		case id == "strf":
+			decodeStreamFormat(d, s)
+		case id == "strn":
+			d.FieldUTF8("name", int(d.BitsLeft()/8), scalar.ActualTrim("\x00"))
+		case id == "dmlh":
+			d.FieldU32("total_frames")
+			if d.BitsLeft() > 0 {
+				d.FieldRawLen("reserved", d.BitsLeft())
+			}
+		case id == "idx1":
+			decodeOldIndex(d)
+		case id == "indx", inMovi && len(id) == 4 && id[0:2] == "ix":
+			decodeIndex(d)
+		case listType == "INFO":
+			d.FieldUTF8("value", int(d.BitsLeft()/8), scalar.ActualTrim(" \x00"))
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+
+	if size%2 != 0 && d.BitsLeft() >= 8 {
+		d.FieldRawLen("align", 8)
+	}
+}
+
+func decodeChunks(d *decode.D, s *aviState, listType string) {
+	d.FieldStructArrayLoop("chunks", "chunk", func() bool { return d.BitsLeft() >= 8*8 }, func(d *decode.D) {
+		decodeChunk(d, s, listType)
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+}
+
+func aviDecode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	if d.BitsLeft() < 12*8 {
+		d.Fatalf("too short")
+	}
+	p := d.PeekBytes(12)
+	if !bytes.Equal(p[0:4], []byte("RIFF")) || !bytes.Equal(p[8:12], []byte("AVI ")) {
+		d.Fatalf("no RIFF AVI chunk found")
+	}
+
+	var s aviState
+	// files larger than 1GB continue in "AVIX" RIFF chunks
+	d.FieldStructArrayLoop("chunks", "chunk", func() bool {
+		return d.BitsLeft() >= 12*8 && bytes.Equal(d.PeekBytes(4), []byte("RIFF"))
+	}, func(d *decode.D) {
+		decodeChunk(d, &s, "")
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("trailing", d.BitsLeft())
+	}
+
+	return nil
+}
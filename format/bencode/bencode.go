@@ -57,21 +57,35 @@ func decodeStrIntUntil(b byte) func(d *decode.D) int64 {
 	}
 }
 
-func decodeBencodeValue(d *decode.D) {
+// valueFn is called with the dictionary key path for each value and returns true if it decoded the value
+type valueFn func(d *decode.D, path []string) bool
+
+func decodeBencodeString(d *decode.D, fn func(d *decode.D, length int64)) {
+	d.SeekRel(-8)
+	length := d.FieldSFn("length", decodeStrIntUntil(':'))
+	d.FieldUTF8("separator", 1, d.AssertStr(":"))
+	fn(d, length)
+}
+
+// returns string value for string types
+func decodeBencodeValue(d *decode.D, path []string, fn valueFn) string {
 	typ := d.FieldUTF8("type", 1, typeToNames)
 	switch typ {
 	case "0", "1", "2", "3", "4", "5", "6", "7", "8", "9":
-		d.SeekRel(-8)
-		length := d.FieldSFn("length", decodeStrIntUntil(':'))
-		d.FieldUTF8("separator", 1, d.AssertStr(":"))
-		d.FieldUTF8("value", int(length))
+		var s string
+		decodeBencodeString(d, func(d *decode.D, length int64) {
+			s = d.FieldUTF8("value", int(length))
+		})
+		return s
 	case "i":
 		d.FieldSFn("value", decodeStrIntUntil('e'))
 		d.FieldUTF8("end", 1, d.AssertStr("e"))
 	case "l":
 		d.FieldArray("values", func(d *decode.D) {
 			for d.PeekBits(8) != 'e' {
-				d.FieldStruct("value", decodeBencodeValue)
+				d.FieldStruct("value", func(d *decode.D) {
+					decodeBencodeValue(d, path, fn)
+				})
 			}
 		})
 		d.FieldUTF8("end", 1, d.AssertStr("e"))
@@ -79,8 +93,16 @@ func decodeBencodeValue(d *decode.D) {
 		d.FieldArray("pairs", func(d *decode.D) {
 			for d.PeekBits(8) != 'e' {
 				d.FieldStruct("pair", func(d *decode.D) {
-					d.FieldStruct("key", decodeBencodeValue)
-					d.FieldStruct("value", decodeBencodeValue)
+					var key string
+					d.FieldStruct("key", func(d *decode.D) {
+						key = decodeBencodeValue(d, path, nil)
+					})
+					d.FieldStruct("value", func(d *decode.D) {
+						valuePath := append(append([]string{}, path...), key)
+						if fn == nil || !fn(d, valuePath) {
+							decodeBencodeValue(d, valuePath, fn)
+						}
+					})
 				})
 			}
 		})
@@ -88,9 +110,11 @@ func decodeBencodeValue(d *decode.D) {
 	default:
 		d.Fatalf("unknown type %v", typ)
 	}
+
+	return ""
 }
 
 func decodeBencode(d *decode.D, _ any) any {
-	decodeBencodeValue(d)
+	decodeBencodeValue(d, nil, nil)
 	return nil
 }
@@ -0,0 +1,122 @@
+package bencode
+
+// https://www.bittorrent.org/beps/bep_0003.html
+// https://www.bittorrent.org/beps/bep_0052.html
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"embed"
+	"hash"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed torrent.jq
+var torrentFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.TORRENT,
+		Description: "BitTorrent metainfo file",
+		DecodeFn:    decodeTorrent,
+		Functions:   []string{"torepr", "_help"},
+	})
+	interp.RegisterFS(torrentFS)
+}
+
+const (
+	pieceHashLen   = 20 // sha1 for v1 pieces
+	pieceHashLenV2 = 32 // sha256 for v2 piece layers
+)
+
+func isPath(path []string, elms ...string) bool {
+	if len(path) != len(elms) {
+		return false
+	}
+	for i, e := range elms {
+		if path[i] != e {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeRawString(d *decode.D, fn func(d *decode.D, length int64)) bool {
+	if typ := d.PeekBits(8); typ < '0' || typ > '9' {
+		return false
+	}
+	d.FieldUTF8("type", 1, typeToNames)
+	decodeBencodeString(d, fn)
+	return true
+}
+
+// decode string value as a hash
+func decodeHashString(d *decode.D) bool {
+	return decodeRawString(d, func(d *decode.D, length int64) {
+		d.FieldRawLen("value", length*8, scalar.RawHex)
+	})
+}
+
+// decode string value as concatenated hashes
+func decodeHashesString(d *decode.D, hashLen int64) bool {
+	return decodeRawString(d, func(d *decode.D, length int64) {
+		d.FramedFn(length*8, func(d *decode.D) {
+			d.FieldArray("value", func(d *decode.D) {
+				for !d.End() {
+					d.FieldRawLen("hash", hashLen*8, scalar.RawHex)
+				}
+			})
+		})
+	})
+}
+
+func fieldInfoHash(d *decode.D, name string, h hash.Hash, start int64) {
+	d.CopyBits(h, d.BitBufRange(start, d.Pos()-start))
+	d.FieldValueRaw(name, h.Sum(nil), scalar.RawHex)
+}
+
+func decodeTorrent(d *decode.D, _ any) any {
+	if d.PeekBits(8) != 'd' {
+		d.Fatalf("torrent must be a dictionary")
+	}
+
+	var hasInfo bool
+	var isV2 bool
+	var fn valueFn
+	fn = func(d *decode.D, path []string) bool {
+		switch {
+		case isPath(path, "info"):
+			// info hash is hash of the bencoded info dictionary
+			hasInfo = true
+			start := d.Pos()
+			decodeBencodeValue(d, path, fn)
+			fieldInfoHash(d, "info_hash", sha1.New(), start)
+			if isV2 {
+				fieldInfoHash(d, "info_hash_v2", sha256.New(), start)
+			}
+			return true
+		case isPath(path, "info", "meta version"):
+			decodeBencodeValue(d, path, fn)
+			isV2 = true
+			return true
+		case isPath(path, "info", "pieces"):
+			return decodeHashesString(d, pieceHashLen)
+		case len(path) > 2 && path[0] == "info" && path[len(path)-1] == "pieces root":
+			return decodeHashString(d)
+		case len(path) == 2 && path[0] == "piece layers":
+			return decodeHashesString(d, pieceHashLenV2)
+		}
+		return false
+	}
+	decodeBencodeValue(d, nil, fn)
+
+	if !hasInfo {
+		d.Fatalf("no info dictionary found")
+	}
+
+	return nil
+}
@@ -0,0 +1,358 @@
+package bmp
+
+// https://learn.microsoft.com/en-us/windows/win32/gdi/bitmap-storage
+// https://learn.microsoft.com/en-us/windows/win32/api/wingdi/ns-wingdi-bitmapv5header
+// https://en.wikipedia.org/wiki/BMP_file_format
+// TODO: decode RLE pixel data
+// TODO: OS/2 bitmap arrays (BA) and OS/2 icons
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var iccProfileFormat decode.Group
+var jpegFormat decode.Group
+var pngFormat decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.BMP,
+		Description: "Windows bitmap image",
+		Groups:      []string{format.PROBE, format.IMAGE},
+		DecodeFn:    bmpDecode,
+		DecodeInArg: format.BMPIn{
+			Icon: false,
+		},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.ICC_PROFILE}, Group: &iccProfileFormat},
+			{Names: []string{format.JPEG}, Group: &jpegFormat},
+			{Names: []string{format.PNG}, Group: &pngFormat},
+		},
+	})
+}
+
+const (
+	headerSizeCore     = 12
+	headerSizeInfo     = 40
+	headerSizeV2       = 52
+	headerSizeV3       = 56
+	headerSizeOS22     = 64
+	headerSizeV4       = 108
+	headerSizeV5       = 124
+	paletteEntrySize   = 4
+	paletteEntrySizeOS = 3
+)
+
+var headerSizeNames = scalar.UToSymStr{
+	headerSizeCore: "bitmapcoreheader",
+	headerSizeInfo: "bitmapinfoheader",
+	headerSizeV2:   "bitmapv2infoheader",
+	headerSizeV3:   "bitmapv3infoheader",
+	headerSizeOS22: "os22xbitmapheader",
+	headerSizeV4:   "bitmapv4header",
+	headerSizeV5:   "bitmapv5header",
+}
+
+const (
+	compressionRGB            = 0
+	compressionRLE8           = 1
+	compressionRLE4           = 2
+	compressionBitfields      = 3
+	compressionJPEG           = 4
+	compressionPNG            = 5
+	compressionAlphaBitfields = 6
+	compressionCMYK           = 11
+	compressionCMYKRLE8       = 12
+	compressionCMYKRLE4       = 13
+)
+
+var compressionNames = scalar.UToSymStr{
+	compressionRGB:            "rgb",
+	compressionRLE8:           "rle8",
+	compressionRLE4:           "rle4",
+	compressionBitfields:      "bitfields",
+	compressionJPEG:           "jpeg",
+	compressionPNG:            "png",
+	compressionAlphaBitfields: "alphabitfields",
+	compressionCMYK:           "cmyk",
+	compressionCMYKRLE8:       "cmykrle8",
+	compressionCMYKRLE4:       "cmykrle4",
+}
+
+const (
+	csTypeCalibratedRGB     = 0
+	csTypeSRGB              = 0x73524742 // "sRGB"
+	csTypeWindowsColorSpace = 0x57696e20 // "Win "
+	csTypeProfileLinked     = 0x4c494e4b // "LINK"
+	csTypeProfileEmbedded   = 0x4d424544 // "MBED"
+)
+
+const (
+	intentBusiness             = 1
+	intentGraphics             = 2
+	intentImages               = 4
+	intentAbsoluteColorimetric = 8
+)
+
+var csTypeNames = scalar.UToSymStr{
+	csTypeCalibratedRGB:     "calibrated_rgb",
+	csTypeSRGB:              "srgb",
+	csTypeWindowsColorSpace: "windows_color_space",
+	csTypeProfileLinked:     "profile_linked",
+	csTypeProfileEmbedded:   "profile_embedded",
+}
+
+var intentNames = scalar.UToSymStr{
+	intentBusiness:             "business",
+	intentGraphics:             "graphics",
+	intentImages:               "images",
+	intentAbsoluteColorimetric: "absolute_colorimetric",
+}
+
+var fileTypeNames = scalar.StrToDescription{
+	"BM": "Windows bitmap",
+	"BA": "OS/2 bitmap array",
+	"CI": "OS/2 color icon",
+	"CP": "OS/2 color pointer",
+	"IC": "OS/2 icon",
+	"PT": "OS/2 pointer",
+}
+
+func fieldCIEXYZ(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		// FXPT2DOT30
+		d.FieldFP("x", 32, 30)
+		d.FieldFP("y", 32, 30)
+		d.FieldFP("z", 32, 30)
+	})
+}
+
+func fieldPalette(d *decode.D, n int64, entrySize int64) {
+	d.FieldArray("palette", func(d *decode.D) {
+		for i := int64(0); i < n; i++ {
+			d.FieldStruct("color", func(d *decode.D) {
+				d.FieldU8("b")
+				d.FieldU8("g")
+				d.FieldU8("r")
+				if entrySize == paletteEntrySize {
+					d.FieldU8("reserved")
+				}
+			})
+		}
+	})
+}
+
+type dibHeader struct {
+	size          uint64
+	width         int64
+	height        int64
+	bitCount      uint64
+	compression   uint64
+	imageSize     uint64
+	colorsUsed    uint64
+	profileOffset uint64
+	profileSize   uint64
+}
+
+func decodeDIBHeader(d *decode.D) dibHeader {
+	var h dibHeader
+
+	h.size = d.FieldU32("size", headerSizeNames)
+	if _, ok := headerSizeNames[h.size]; !ok {
+		d.Fatalf("unknown header size %d", h.size)
+	}
+	if h.size == headerSizeCore {
+		h.width = int64(d.FieldU16("width"))
+		h.height = int64(d.FieldU16("height"))
+		d.FieldU16("planes")
+		h.bitCount = d.FieldU16("bit_count")
+		return h
+	}
+
+	h.width = d.FieldS32("width")
+	// negative height is a top-down bitmap
+	h.height = d.FieldS32("height")
+	d.FieldU16("planes")
+	h.bitCount = d.FieldU16("bit_count")
+	h.compression = d.FieldU32("compression", compressionNames)
+	h.imageSize = d.FieldU32("image_size")
+	d.FieldS32("x_pixels_per_meter")
+	d.FieldS32("y_pixels_per_meter")
+	h.colorsUsed = d.FieldU32("colors_used")
+	d.FieldU32("colors_important")
+
+	switch h.size {
+	case headerSizeInfo:
+		return h
+	case headerSizeOS22:
+		d.FieldU16("units")
+		d.FieldU16("reserved")
+		d.FieldU16("recording")
+		d.FieldU16("rendering")
+		d.FieldU32("size1")
+		d.FieldU32("size2")
+		d.FieldU32("color_encoding")
+		d.FieldU32("identifier")
+		return h
+	}
+
+	d.FieldU32("red_mask", scalar.ActualHex)
+	d.FieldU32("green_mask", scalar.ActualHex)
+	d.FieldU32("blue_mask", scalar.ActualHex)
+	if h.size >= headerSizeV3 {
+		d.FieldU32("alpha_mask", scalar.ActualHex)
+	}
+	if h.size >= headerSizeV4 {
+		d.FieldU32("cs_type", csTypeNames, scalar.ActualHex)
+		d.FieldStruct("endpoints", func(d *decode.D) {
+			fieldCIEXYZ(d, "red")
+			fieldCIEXYZ(d, "green")
+			fieldCIEXYZ(d, "blue")
+		})
+		d.FieldFP32("gamma_red")
+		d.FieldFP32("gamma_green")
+		d.FieldFP32("gamma_blue")
+	}
+	if h.size >= headerSizeV5 {
+		d.FieldU32("intent", intentNames)
+		// relative to start of header
+		h.profileOffset = d.FieldU32("profile_data")
+		h.profileSize = d.FieldU32("profile_size")
+		d.FieldU32("reserved")
+	}
+	return h
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func bmpDecode(d *decode.D, in any) any {
+	bi, _ := in.(format.BMPIn)
+
+	d.Endian = decode.LittleEndian
+
+	// icon DIB has no file header, pixels follow palette
+	pixelOffset := int64(-1)
+	if !bi.Icon {
+		d.FieldStruct("file_header", func(d *decode.D) {
+			d.FieldUTF8("type", 2, d.AssertStr("BM"), fileTypeNames)
+			size := d.FieldU32("size")
+			if size != 0 && int64(size)*8 > d.Len() {
+				d.Fatalf("file size %d larger than buffer", size)
+			}
+			d.FieldU16("reserved1")
+			d.FieldU16("reserved2")
+			pixelOffset = int64(d.FieldU32("pixel_offset")) * 8
+		})
+	}
+
+	headerStart := d.Pos()
+	var h dibHeader
+	d.FieldStruct("dib_header", func(d *decode.D) {
+		h = decodeDIBHeader(d)
+	})
+	if pixelOffset != -1 && (pixelOffset > d.Len() || pixelOffset < d.Pos()) {
+		d.Fatalf("invalid pixel offset %d", pixelOffset/8)
+	}
+
+	// masks follow the header if not part of it
+	if h.size == headerSizeInfo {
+		switch h.compression {
+		case compressionBitfields, compressionAlphaBitfields:
+			d.FieldStruct("color_masks", func(d *decode.D) {
+				d.FieldU32("red_mask", scalar.ActualHex)
+				d.FieldU32("green_mask", scalar.ActualHex)
+				d.FieldU32("blue_mask", scalar.ActualHex)
+				if h.compression == compressionAlphaBitfields {
+					d.FieldU32("alpha_mask", scalar.ActualHex)
+				}
+			})
+		}
+	}
+
+	if h.bitCount <= 8 {
+		entrySize := int64(paletteEntrySize)
+		if h.size == headerSizeCore {
+			entrySize = paletteEntrySizeOS
+		}
+		colors := int64(h.colorsUsed)
+		if colors == 0 {
+			colors = 1 << h.bitCount
+		}
+		paletteEnd := pixelOffset
+		if paletteEnd == -1 {
+			paletteEnd = d.Len()
+		}
+		// some files have shorter palette than stated
+		if maxColors := (paletteEnd - d.Pos()) / (entrySize * 8); colors > maxColors {
+			colors = maxColors
+		}
+		if colors > 0 {
+			fieldPalette(d, colors, entrySize)
+		}
+	}
+
+	if pixelOffset != -1 {
+		if gap := pixelOffset - d.Pos(); gap > 0 {
+			d.FieldRawLen("gap0", gap)
+		}
+		d.SeekAbs(pixelOffset)
+	}
+
+	height := abs64(h.height)
+	if bi.Icon {
+		// height includes AND mask
+		height /= 2
+	}
+	pixelLen := int64(h.imageSize) * 8
+	uncompressed := false
+	switch h.compression {
+	case compressionRGB, compressionBitfields, compressionAlphaBitfields, compressionCMYK:
+		// rows are 4 byte aligned, image size is allowed to be zero for uncompressed
+		rowSize := ((int64(h.bitCount)*h.width + 31) / 32) * 4
+		pixelLen = rowSize * height * 8
+		uncompressed = true
+	}
+	if pixelLen == 0 || pixelLen > d.BitsLeft() {
+		pixelLen = d.BitsLeft()
+	}
+	switch h.compression {
+	case compressionJPEG:
+		d.FieldFormatOrRawLen("pixel_data", pixelLen, jpegFormat, nil)
+	case compressionPNG:
+		d.FieldFormatOrRawLen("pixel_data", pixelLen, pngFormat, nil)
+	default:
+		d.FieldRawLen("pixel_data", pixelLen)
+	}
+
+	if bi.Icon && uncompressed {
+		// 1 bit per pixel transparency mask
+		maskLen := ((h.width + 31) / 32) * 4 * height * 8
+		if maskLen > d.BitsLeft() {
+			maskLen = d.BitsLeft()
+		}
+		if maskLen > 0 {
+			d.FieldRawLen("mask_data", maskLen)
+		}
+	}
+
+	if h.profileSize > 0 {
+		profilePos := headerStart + int64(h.profileOffset)*8
+		profileLen := int64(h.profileSize) * 8
+		if profilePos >= d.Pos() && profilePos+profileLen <= d.Len() {
+			if gap := profilePos - d.Pos(); gap > 0 {
+				d.FieldRawLen("gap1", gap)
+			}
+			d.FieldFormatOrRawLen("profile", profileLen, iccProfileFormat, nil)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package bplist
+
+// https://opensource.apple.com/source/CF/CF-1153.18/CFBinaryPList.c
+// https://medium.com/@karaiskc/understanding-apples-binary-property-list-format-281e6da00dbd
+
+import (
+	"embed"
+	"math"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed bplist.jq
+var bplistFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.BPLIST,
+		Description: "Apple binary property list",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    bplistDecode,
+		Functions:   []string{"torepr", "_help"},
+	})
+	interp.RegisterFS(bplistFS)
+}
+
+const (
+	headerBytes  = 8
+	trailerBytes = 32
+	maxObjects   = 10_000_000
+)
+
+const (
+	objectTypeSingleton   = 0x0
+	objectTypeInt         = 0x1
+	objectTypeReal        = 0x2
+	objectTypeDate        = 0x3
+	objectTypeData        = 0x4
+	objectTypeASCIIString = 0x5
+	objectTypeUTF16String = 0x6
+	objectTypeUID         = 0x8
+	objectTypeArray       = 0xa
+	objectTypeOrdset      = 0xb
+	objectTypeSet         = 0xc
+	objectTypeDict        = 0xd
+)
+
+var objectTypeNames = scalar.UToSymStr{
+	objectTypeSingleton:   "singleton",
+	objectTypeInt:         "int",
+	objectTypeReal:        "real",
+	objectTypeDate:        "date",
+	objectTypeData:        "data",
+	objectTypeASCIIString: "ascii_string",
+	objectTypeUTF16String: "utf16_string",
+	objectTypeUID:         "uid",
+	objectTypeArray:       "array",
+	objectTypeOrdset:      "ordset",
+	objectTypeSet:         "set",
+	objectTypeDict:        "dict",
+}
+
+const (
+	singletonNull  = 0x0
+	singletonFalse = 0x8
+	singletonTrue  = 0x9
+	singletonFill  = 0xf
+)
+
+var singletonNames = scalar.UToSymStr{
+	singletonNull:  "null",
+	singletonFalse: "false",
+	singletonTrue:  "true",
+	singletonFill:  "fill",
+}
+
+// dates are seconds since 2001-01-01T00:00:00Z
+var dateEpoch = time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var dateDescription = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	f := s.ActualF()
+	if math.IsNaN(f) || math.IsInf(f, 0) || math.Abs(f) > 1e11 {
+		return s, nil
+	}
+	sec, frac := math.Modf(f)
+	s.Description = dateEpoch.Add(time.Duration(sec)*time.Second + time.Duration(frac*1e9)).Format(time.RFC3339Nano)
+	return s, nil
+})
+
+type trailer struct {
+	offsetIntSize     int
+	objectRefSize     int
+	numObjects        uint64
+	topObject         uint64
+	offsetTableOffset int64
+}
+
+type decodeContext struct {
+	trailer
+	offsets []int64
+	// object indexes currently being decoded, used to detect reference cycles
+	stack map[uint64]bool
+}
+
+// size nibble 0xf means size is a following int object
+func decodeSize(d *decode.D, info uint64) int64 {
+	if info != 0xf {
+		d.FieldValueU("size", info)
+		return int64(info)
+	}
+	d.FieldU4("size_type", d.AssertU(objectTypeInt), objectTypeNames)
+	sizeExp := d.FieldU4("size_exp")
+	if sizeExp > 3 {
+		d.Fatalf("invalid size int width %d", 1<<sizeExp)
+	}
+	size := d.FieldU("size", 8<<sizeExp)
+	if size > math.MaxInt32 {
+		d.Fatalf("size %d too large", size)
+	}
+	return int64(size)
+}
+
+func decodeRefs(d *decode.D, dc *decodeContext, name string, n int64) []uint64 {
+	var refs []uint64
+	d.FieldArray(name, func(d *decode.D) {
+		for i := int64(0); i < n; i++ {
+			ref := d.FieldU("ref", dc.objectRefSize*8)
+			if ref >= dc.numObjects {
+				d.Fatalf("object ref %d outside object table", ref)
+			}
+			refs = append(refs, ref)
+		}
+	})
+	return refs
+}
+
+func decodeObjectRef(d *decode.D, dc *decodeContext, name string, ref uint64) {
+	if dc.stack[ref] {
+		d.Fatalf("reference cycle at object %d", ref)
+	}
+	dc.stack[ref] = true
+	offset := dc.offsets[ref]
+	d.RangeFn(offset*8, dc.offsetTableOffset*8-offset*8, func(d *decode.D) {
+		d.FieldStruct(name, func(d *decode.D) {
+			d.FieldValueU("index", ref)
+			decodeObject(d, dc)
+		})
+	})
+	delete(dc.stack, ref)
+}
+
+func decodeObject(d *decode.D, dc *decodeContext) {
+	typ := d.FieldU4("type", objectTypeNames)
+	switch typ {
+	case objectTypeSingleton:
+		info := d.FieldU4("info", singletonNames)
+		switch info {
+		case singletonNull, singletonFill:
+			d.FieldValueNil("value")
+		case singletonFalse:
+			d.FieldValueBool("value", false)
+		case singletonTrue:
+			d.FieldValueBool("value", true)
+		default:
+			d.Fatalf("unknown singleton %d", info)
+		}
+	case objectTypeInt:
+		sizeExp := d.FieldU4("size_exp")
+		switch sizeExp {
+		case 0, 1, 2:
+			d.FieldU("value", 8<<sizeExp)
+		case 3:
+			d.FieldS64("value")
+		case 4:
+			d.FieldSBigInt("value", 128)
+		default:
+			d.Fatalf("invalid int width %d", 1<<sizeExp)
+		}
+	case objectTypeReal:
+		sizeExp := d.FieldU4("size_exp")
+		switch sizeExp {
+		case 2:
+			d.FieldF32("value")
+		case 3:
+			d.FieldF64("value")
+		default:
+			d.Fatalf("invalid real width %d", 1<<sizeExp)
+		}
+	case objectTypeDate:
+		d.FieldU4("size_exp", d.AssertU(3))
+		d.FieldF64("value", dateDescription)
+	case objectTypeData:
+		size := decodeSize(d, d.FieldU4("info"))
+		d.FieldRawLen("value", size*8)
+	case objectTypeASCIIString:
+		size := decodeSize(d, d.FieldU4("info"))
+		d.FieldUTF8("value", int(size))
+	case objectTypeUTF16String:
+		// size is number of UTF-16 code units
+		size := decodeSize(d, d.FieldU4("info"))
+		d.FieldUTF16BE("value", int(size*2))
+	case objectTypeUID:
+		info := d.FieldU4("info")
+		d.FieldU("value", int(info+1)*8)
+	case objectTypeArray,
+		objectTypeOrdset,
+		objectTypeSet:
+		size := decodeSize(d, d.FieldU4("info"))
+		refs := decodeRefs(d, dc, "refs", size)
+		d.FieldArray("entries", func(d *decode.D) {
+			for _, ref := range refs {
+				decodeObjectRef(d, dc, "entry", ref)
+			}
+		})
+	case objectTypeDict:
+		size := decodeSize(d, d.FieldU4("info"))
+		keyRefs := decodeRefs(d, dc, "key_refs", size)
+		valueRefs := decodeRefs(d, dc, "value_refs", size)
+		d.FieldArray("entries", func(d *decode.D) {
+			for i := range keyRefs {
+				d.FieldStruct("entry", func(d *decode.D) {
+					decodeObjectRef(d, dc, "key", keyRefs[i])
+					decodeObjectRef(d, dc, "value", valueRefs[i])
+				})
+			}
+		})
+	default:
+		d.Fatalf("unknown object type %d", typ)
+	}
+}
+
+func bplistDecode(d *decode.D, _ any) any {
+	if d.BitsLeft() < (headerBytes+trailerBytes)*8 {
+		d.Fatalf("too short")
+	}
+
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldUTF8("magic", 6, d.AssertStr("bplist"))
+		d.FieldUTF8("version", 2, d.AssertStr("00"))
+	})
+
+	trailerPos := d.Len() - trailerBytes*8
+	dc := &decodeContext{stack: map[uint64]bool{}}
+	d.RangeFn(trailerPos, trailerBytes*8, func(d *decode.D) {
+		d.SeekRel(6 * 8)
+		dc.offsetIntSize = int(d.U8())
+		dc.objectRefSize = int(d.U8())
+		dc.numObjects = d.U64()
+		dc.topObject = d.U64()
+		dc.offsetTableOffset = int64(d.U64())
+	})
+	switch {
+	case dc.offsetIntSize < 1 || dc.offsetIntSize > 8:
+		d.Fatalf("invalid offset int size %d", dc.offsetIntSize)
+	case dc.objectRefSize < 1 || dc.objectRefSize > 8:
+		d.Fatalf("invalid object ref size %d", dc.objectRefSize)
+	case dc.numObjects > maxObjects:
+		d.Fatalf("too many objects %d", dc.numObjects)
+	case dc.topObject >= dc.numObjects:
+		d.Fatalf("top object %d outside object table", dc.topObject)
+	case dc.offsetTableOffset < headerBytes ||
+		dc.offsetTableOffset > trailerPos/8 ||
+		dc.offsetTableOffset*8+int64(dc.numObjects)*int64(dc.offsetIntSize)*8 > trailerPos:
+		d.Fatalf("invalid offset table offset %d", dc.offsetTableOffset)
+	}
+
+	d.RangeFn(dc.offsetTableOffset*8, int64(dc.numObjects)*int64(dc.offsetIntSize)*8, func(d *decode.D) {
+		for i := uint64(0); i < dc.numObjects; i++ {
+			offset := int64(d.U(dc.offsetIntSize * 8))
+			if offset < headerBytes || offset >= dc.offsetTableOffset {
+				d.Fatalf("object %d offset %d outside object table", i, offset)
+			}
+			dc.offsets = append(dc.offsets, offset)
+		}
+	})
+
+	decodeObjectRef(d, dc, "top_object", dc.topObject)
+
+	d.SeekAbs(dc.offsetTableOffset * 8)
+	d.FieldArray("offset_table", func(d *decode.D) {
+		for i := uint64(0); i < dc.numObjects; i++ {
+			d.FieldU("offset", dc.offsetIntSize*8)
+		}
+	})
+
+	d.SeekAbs(trailerPos)
+	d.FieldStruct("trailer", func(d *decode.D) {
+		d.FieldRawLen("unused", 5*8)
+		d.FieldU8("sort_version")
+		d.FieldU8("offset_int_size")
+		d.FieldU8("object_ref_size")
+		d.FieldU64("num_objects")
+		d.FieldU64("top_object")
+		d.FieldU64("offset_table_offset")
+	})
+
+	return nil
+}
@@ -0,0 +1,459 @@
+package btrfs
+
+// https://btrfs.readthedocs.io/en/latest/dev/On-disk-format.html
+// https://github.com/torvalds/linux/blob/master/include/uapi/linux/btrfs_tree.h
+// TODO: decode more tree item types
+// TODO: validate xxhash, sha256 and blake2 checksums
+
+import (
+	"embed"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed btrfs.jq
+var btrfsFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.BTRFS,
+		Description: "Btrfs filesystem superblock and chunk tree",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    btrfsDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(btrfsFS)
+}
+
+const (
+	superblockLen = 4096
+	csumLen       = 32
+	headerLen     = 101
+	keyLen        = 17
+	itemLen       = keyLen + 8
+	keyPtrLen     = keyLen + 16
+)
+
+// primary and mirror superblock offsets
+var superblockOffsets = []int64{
+	0x1_0000,
+	0x400_0000,
+	0x40_0000_0000,
+}
+
+const (
+	magic       = "_BHRfS_M"
+	magicOffset = 0x40
+)
+
+const csumTypeCRC32C = 0
+
+var csumTypeNames = scalar.UToSymStr{
+	csumTypeCRC32C: "crc32c",
+	1:              "xxhash64",
+	2:              "sha256",
+	3:              "blake2b",
+}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+const (
+	keyTypeDevItem   = 216
+	keyTypeChunkItem = 228
+)
+
+var keyTypeNames = scalar.UToSymStr{
+	1:                "inode_item",
+	12:               "inode_ref",
+	13:               "inode_extref",
+	24:               "xattr_item",
+	48:               "orphan_item",
+	60:               "dir_log_item",
+	72:               "dir_log_index",
+	84:               "dir_item",
+	96:               "dir_index",
+	108:              "extent_data",
+	128:              "extent_csum",
+	132:              "root_item",
+	144:              "root_backref",
+	156:              "root_ref",
+	168:              "extent_item",
+	169:              "metadata_item",
+	176:              "tree_block_ref",
+	178:              "extent_data_ref",
+	182:              "shared_block_ref",
+	184:              "shared_data_ref",
+	192:              "block_group_item",
+	198:              "free_space_info",
+	199:              "free_space_extent",
+	200:              "free_space_bitmap",
+	204:              "dev_extent",
+	keyTypeDevItem:   "dev_item",
+	keyTypeChunkItem: "chunk_item",
+	240:              "qgroup_status",
+	242:              "qgroup_info",
+	244:              "qgroup_limit",
+	246:              "qgroup_relation",
+	248:              "temporary_item",
+	249:              "persistent_item",
+	250:              "dev_replace",
+	251:              "uuid_key_subvol",
+	252:              "uuid_key_received_subvol",
+	253:              "string_item",
+}
+
+var treeObjectIDNames = scalar.UToSymStr{
+	1:  "root_tree",
+	2:  "extent_tree",
+	3:  "chunk_tree",
+	4:  "dev_tree",
+	5:  "fs_tree",
+	6:  "root_tree_dir",
+	7:  "csum_tree",
+	8:  "quota_tree",
+	9:  "uuid_tree",
+	10: "free_space_tree",
+	11: "block_group_tree",
+}
+
+var blockGroupFlagNames = []string{
+	"data",
+	"system",
+	"metadata",
+	"raid0",
+	"raid1",
+	"dup",
+	"raid10",
+	"raid5",
+	"raid6",
+	"raid1c3",
+	"raid1c4",
+}
+
+var incompatFlagNames = []string{
+	"mixed_backref",
+	"default_subvol",
+	"mixed_groups",
+	"compress_lzo",
+	"compress_zstd",
+	"big_metadata",
+	"extended_iref",
+	"raid56",
+	"skinny_metadata",
+	"no_holes",
+	"metadata_uuid",
+	"raid1c34",
+	"zoned",
+	"extent_tree_v2",
+	"raid_stripe_tree",
+	"simple_quota",
+}
+
+var compatROFlagNames = []string{
+	"free_space_tree",
+	"free_space_tree_valid",
+	"verity",
+	"block_group_tree",
+}
+
+// describe set bits using names, ex: "system|dup"
+func flagsDescription(names []string) scalar.Mapper {
+	return scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		var set []string
+		v := s.ActualU()
+		for i, n := range names {
+			if v&(1<<i) != 0 {
+				set = append(set, n)
+			}
+		}
+		s.Description = strings.Join(set, "|")
+		return s, nil
+	})
+}
+
+func fieldCsum(d *decode.D, csumType uint64, blockLen int64) {
+	start := d.Pos()
+	if csumType != csumTypeCRC32C {
+		d.FieldRawLen("csum", csumLen*8, scalar.RawHex)
+		return
+	}
+	expected := make([]byte, csumLen)
+	binary.LittleEndian.PutUint32(expected, crc32.Checksum(d.BytesRange(start+csumLen*8, int(blockLen-csumLen)), crc32cTable))
+	d.FieldRawLen("csum", csumLen*8, d.ValidateBitBuf(expected), scalar.RawHex)
+}
+
+// returns key type and offset
+func decodeKey(d *decode.D) (uint64, uint64) {
+	d.FieldU64("objectid")
+	typ := d.FieldU8("type", keyTypeNames)
+	offset := d.FieldU64("offset", scalar.ActualHex)
+	return typ, offset
+}
+
+func decodeDevItem(d *decode.D) {
+	d.FieldU64("devid")
+	d.FieldU64("total_bytes")
+	d.FieldU64("bytes_used")
+	d.FieldU32("io_align")
+	d.FieldU32("io_width")
+	d.FieldU32("sector_size")
+	d.FieldU64("type")
+	d.FieldU64("generation")
+	d.FieldU64("start_offset")
+	d.FieldU32("dev_group")
+	d.FieldU8("seek_speed")
+	d.FieldU8("bandwidth")
+	d.FieldRawLen("uuid", 16*8, scalar.RawUUID)
+	d.FieldRawLen("fsid", 16*8, scalar.RawUUID)
+}
+
+type stripe struct {
+	devID  uint64
+	offset uint64
+}
+
+type chunk struct {
+	logical uint64
+	length  uint64
+	stripes []stripe
+}
+
+func decodeChunkItem(d *decode.D, logical uint64) chunk {
+	c := chunk{logical: logical}
+	c.length = d.FieldU64("length")
+	d.FieldU64("owner", treeObjectIDNames)
+	d.FieldU64("stripe_len")
+	d.FieldU64("type", flagsDescription(blockGroupFlagNames), scalar.ActualHex)
+	d.FieldU32("io_align")
+	d.FieldU32("io_width")
+	d.FieldU32("sector_size")
+	numStripes := d.FieldU16("num_stripes")
+	d.FieldU16("sub_stripes")
+	d.FieldArray("stripes", func(d *decode.D) {
+		for i := uint64(0); i < numStripes; i++ {
+			d.FieldStruct("stripe", func(d *decode.D) {
+				devID := d.FieldU64("devid")
+				offset := d.FieldU64("offset", scalar.ActualHex)
+				d.FieldRawLen("dev_uuid", 16*8, scalar.RawUUID)
+				c.stripes = append(c.stripes, stripe{devID: devID, offset: offset})
+			})
+		}
+	})
+	return c
+}
+
+// physical offset for logical address using first stripe
+func logicalToPhysical(chunks []chunk, logical uint64) (uint64, bool) {
+	for _, c := range chunks {
+		if logical >= c.logical && logical < c.logical+c.length && len(c.stripes) > 0 {
+			return c.stripes[0].offset + (logical - c.logical), true
+		}
+	}
+	return 0, false
+}
+
+type superblock struct {
+	nodesize     uint64
+	chunkRoot    uint64
+	csumType     uint64
+	systemChunks []chunk
+}
+
+func decodeRootBackup(d *decode.D) {
+	d.FieldU64("tree_root", scalar.ActualHex)
+	d.FieldU64("tree_root_gen")
+	d.FieldU64("chunk_root", scalar.ActualHex)
+	d.FieldU64("chunk_root_gen")
+	d.FieldU64("extent_root", scalar.ActualHex)
+	d.FieldU64("extent_root_gen")
+	d.FieldU64("fs_root", scalar.ActualHex)
+	d.FieldU64("fs_root_gen")
+	d.FieldU64("dev_root", scalar.ActualHex)
+	d.FieldU64("dev_root_gen")
+	d.FieldU64("csum_root", scalar.ActualHex)
+	d.FieldU64("csum_root_gen")
+	d.FieldU64("total_bytes")
+	d.FieldU64("bytes_used")
+	d.FieldU64("num_devices")
+	d.FieldRawLen("unused_64", 4*8*8)
+	d.FieldU8("tree_root_level")
+	d.FieldU8("chunk_root_level")
+	d.FieldU8("extent_root_level")
+	d.FieldU8("fs_root_level")
+	d.FieldU8("dev_root_level")
+	d.FieldU8("csum_root_level")
+	d.FieldRawLen("unused_8", 10*8)
+}
+
+func decodeSuperblock(d *decode.D) superblock {
+	var sb superblock
+
+	start := d.Pos()
+	sb.csumType = uint64(binary.LittleEndian.Uint16(d.BytesRange(start+0xc4*8, 2)))
+
+	fieldCsum(d, sb.csumType, superblockLen)
+	d.FieldRawLen("fsid", 16*8, scalar.RawUUID)
+	d.FieldU64("bytenr", scalar.ActualHex)
+	d.FieldU64("flags", scalar.ActualHex)
+	d.FieldUTF8("magic", 8, d.AssertStr(magic))
+	d.FieldU64("generation")
+	d.FieldU64("root", scalar.ActualHex)
+	sb.chunkRoot = d.FieldU64("chunk_root", scalar.ActualHex)
+	d.FieldU64("log_root", scalar.ActualHex)
+	d.FieldU64("log_root_transid")
+	d.FieldU64("total_bytes")
+	d.FieldU64("bytes_used")
+	d.FieldU64("root_dir_objectid")
+	d.FieldU64("num_devices")
+	d.FieldU32("sectorsize")
+	sb.nodesize = d.FieldU32("nodesize")
+	d.FieldU32("leafsize")
+	d.FieldU32("stripesize")
+	sysChunkArraySize := d.FieldU32("sys_chunk_array_size")
+	d.FieldU64("chunk_root_generation")
+	d.FieldU64("compat_flags", scalar.ActualHex)
+	d.FieldU64("compat_ro_flags", flagsDescription(compatROFlagNames), scalar.ActualHex)
+	d.FieldU64("incompat_flags", flagsDescription(incompatFlagNames), scalar.ActualHex)
+	d.FieldU16("csum_type", csumTypeNames)
+	d.FieldU8("root_level")
+	d.FieldU8("chunk_root_level")
+	d.FieldU8("log_root_level")
+	d.FieldStruct("dev_item", decodeDevItem)
+	d.FieldUTF8NullFixedLen("label", 256)
+	d.FieldU64("cache_generation")
+	d.FieldU64("uuid_tree_generation")
+	d.FieldRawLen("metadata_uuid", 16*8, scalar.RawUUID)
+	d.FieldU64("nr_global_roots")
+	d.FieldRawLen("reserved", 27*8*8)
+	sysChunkArrayStart := d.Pos()
+	if sysChunkArraySize > 2048 {
+		d.Fatalf("sys_chunk_array_size %d too large", sysChunkArraySize)
+	}
+	d.FramedFn(int64(sysChunkArraySize)*8, func(d *decode.D) {
+		d.FieldArray("sys_chunk_array", func(d *decode.D) {
+			for !d.End() {
+				d.FieldStruct("chunk", func(d *decode.D) {
+					var logical uint64
+					d.FieldStruct("key", func(d *decode.D) {
+						_, logical = decodeKey(d)
+					})
+					sb.systemChunks = append(sb.systemChunks, decodeChunkItem(d, logical))
+				})
+			}
+		})
+	})
+	d.FieldRawLen("sys_chunk_array_unused", 2048*8-(d.Pos()-sysChunkArrayStart))
+	d.FieldArray("super_roots", func(d *decode.D) {
+		for i := 0; i < 4; i++ {
+			d.FieldStruct("super_root", decodeRootBackup)
+		}
+	})
+	d.FieldRawLen("padding", superblockLen*8-(d.Pos()-start))
+
+	return sb
+}
+
+func decodeTreeBlock(d *decode.D, csumType uint64, nodesize uint64) {
+	start := d.Pos()
+	var level uint64
+	var nrItems uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		fieldCsum(d, csumType, int64(nodesize))
+		d.FieldRawLen("fsid", 16*8, scalar.RawUUID)
+		d.FieldU64("bytenr", scalar.ActualHex)
+		d.FieldU56("flags", scalar.ActualHex)
+		d.FieldU8("backref_rev")
+		d.FieldRawLen("chunk_tree_uuid", 16*8, scalar.RawUUID)
+		d.FieldU64("generation")
+		d.FieldU64("owner", treeObjectIDNames)
+		nrItems = d.FieldU32("nritems")
+		level = d.FieldU8("level")
+	})
+	itemsStart := d.Pos()
+
+	if level > 0 {
+		d.FieldArray("key_ptrs", func(d *decode.D) {
+			for i := uint64(0); i < nrItems; i++ {
+				d.FieldStruct("key_ptr", func(d *decode.D) {
+					d.FieldStruct("key", func(d *decode.D) { decodeKey(d) })
+					d.FieldU64("blockptr", scalar.ActualHex)
+					d.FieldU64("generation")
+				})
+			}
+		})
+		return
+	}
+
+	if int64(nrItems)*itemLen*8 > int64(nodesize)*8-(itemsStart-start) {
+		d.Fatalf("nritems %d does not fit in node", nrItems)
+	}
+	d.FieldArray("items", func(d *decode.D) {
+		for i := uint64(0); i < nrItems; i++ {
+			d.FieldStruct("item", func(d *decode.D) {
+				var typ uint64
+				var keyOffset uint64
+				d.FieldStruct("key", func(d *decode.D) {
+					typ, keyOffset = decodeKey(d)
+				})
+				offset := d.FieldU32("offset")
+				size := d.FieldU32("size")
+				// item data offset is relative to end of header
+				d.RangeFn(itemsStart+int64(offset)*8, int64(size)*8, func(d *decode.D) {
+					switch typ {
+					case keyTypeDevItem:
+						d.FieldStruct("data", decodeDevItem)
+					case keyTypeChunkItem:
+						d.FieldStruct("data", func(d *decode.D) { decodeChunkItem(d, keyOffset) })
+					default:
+						d.FieldRawLen("data", int64(size)*8)
+					}
+				})
+			})
+		}
+	})
+}
+
+func btrfsDecode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	hasMagic := func(offset int64) bool {
+		return d.Len() >= (offset+superblockLen)*8 &&
+			string(d.BytesRange((offset+magicOffset)*8, len(magic))) == magic
+	}
+	if !hasMagic(superblockOffsets[0]) {
+		d.Fatalf("no superblock magic found")
+	}
+
+	var primary *superblock
+	d.FieldArray("superblocks", func(d *decode.D) {
+		for _, offset := range superblockOffsets {
+			// skip missing or damaged mirrors
+			if !hasMagic(offset) {
+				continue
+			}
+			d.SeekAbs(offset * 8)
+			d.FieldStruct("superblock", func(d *decode.D) {
+				sb := decodeSuperblock(d)
+				if primary == nil {
+					primary = &sb
+				}
+			})
+		}
+	})
+
+	physical, ok := logicalToPhysical(primary.systemChunks, primary.chunkRoot)
+	if ok && d.Len() >= int64(physical+primary.nodesize)*8 {
+		d.SeekAbs(int64(physical) * 8)
+		d.FieldStruct("chunk_tree", func(d *decode.D) {
+			decodeTreeBlock(d, primary.csumType, primary.nodesize)
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,396 @@
+package caf
+
+// https://developer.apple.com/library/archive/documentation/MusicAudio/Reference/CAFSpec/CAF_spec/CAF_spec.html
+// https://github.com/macosforge/alac/blob/master/ALACMagicCookieDescription.txt
+
+// TODO: decode lpcm and alac packets
+// TODO: mark, regn, inst, midi, ovvw, peak, edct, strg and umid chunks
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed caf.jq
+var cafFS embed.FS
+
+var mpegESFormat decode.Group
+var aacFrameFormat decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.CAF,
+		Description: "Apple Core Audio Format",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    cafDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.MPEG_ES}, Group: &mpegESFormat},
+			{Names: []string{format.AAC_FRAME}, Group: &aacFrameFormat},
+		},
+		Functions: []string{"_help"},
+	})
+	interp.RegisterFS(cafFS)
+}
+
+const (
+	formatIDLPCM = "lpcm"
+	formatIDAAC  = "aac "
+	formatIDALAC = "alac"
+)
+
+var formatIDDescriptions = scalar.StrToDescription{
+	formatIDLPCM: "Linear PCM",
+	"ima4":       "IMA 4:1 ADPCM",
+	formatIDAAC:  "MPEG-4 AAC",
+	"MAC3":       "MACE 3:1",
+	"MAC6":       "MACE 6:1",
+	"ulaw":       "uLaw 2:1",
+	"alaw":       "aLaw 2:1",
+	".mp1":       "MPEG-1 or 2, Layer 1",
+	".mp2":       "MPEG-1 or 2, Layer 2",
+	".mp3":       "MPEG-1 or 2, Layer 3",
+	formatIDALAC: "Apple Lossless",
+	"opus":       "Opus",
+	"flac":       "FLAC",
+	"ac-3":       "AC-3",
+	"ec-3":       "Enhanced AC-3",
+}
+
+var chunkTypeDescriptions = scalar.StrToDescription{
+	"desc": "Audio description",
+	"data": "Audio data",
+	"pakt": "Packet table",
+	"chan": "Channel layout",
+	"kuki": "Magic cookie",
+	"strg": "Strings",
+	"mark": "Marker",
+	"regn": "Region",
+	"inst": "Instrument",
+	"midi": "MIDI",
+	"ovvw": "Overview",
+	"peak": "Peak",
+	"edct": "Edit comments",
+	"info": "Information",
+	"umid": "Unique material identifier",
+	"uuid": "User defined",
+	"free": "Free",
+}
+
+const (
+	layoutTagUseChannelDescriptions = 0
+	layoutTagUseChannelBitmap       = 1 << 16
+)
+
+var channelLayoutTagNames = scalar.UToSymStr{
+	layoutTagUseChannelDescriptions: "use_channel_descriptions",
+	layoutTagUseChannelBitmap:       "use_channel_bitmap",
+	100<<16 | 1:                     "mono",
+	101<<16 | 2:                     "stereo",
+	102<<16 | 2:                     "stereo_headphones",
+	103<<16 | 2:                     "matrix_stereo",
+	104<<16 | 2:                     "mid_side",
+	105<<16 | 2:                     "xy",
+	106<<16 | 2:                     "binaural",
+	107<<16 | 4:                     "ambisonic_b_format",
+	108<<16 | 4:                     "quadraphonic",
+	109<<16 | 5:                     "pentagonal",
+	110<<16 | 6:                     "hexagonal",
+	111<<16 | 8:                     "octagonal",
+	112<<16 | 8:                     "cube",
+	113<<16 | 3:                     "mpeg_3_0_a",
+	114<<16 | 3:                     "mpeg_3_0_b",
+	115<<16 | 4:                     "mpeg_4_0_a",
+	116<<16 | 4:                     "mpeg_4_0_b",
+	117<<16 | 5:                     "mpeg_5_0_a",
+	118<<16 | 5:                     "mpeg_5_0_b",
+	119<<16 | 5:                     "mpeg_5_0_c",
+	120<<16 | 5:                     "mpeg_5_0_d",
+	121<<16 | 6:                     "mpeg_5_1_a",
+	122<<16 | 6:                     "mpeg_5_1_b",
+	123<<16 | 6:                     "mpeg_5_1_c",
+	124<<16 | 6:                     "mpeg_5_1_d",
+	125<<16 | 7:                     "mpeg_6_1_a",
+	126<<16 | 8:                     "mpeg_7_1_a",
+	127<<16 | 8:                     "mpeg_7_1_b",
+	128<<16 | 8:                     "mpeg_7_1_c",
+	129<<16 | 8:                     "emagic_default_7_1",
+	130<<16 | 8:                     "smpte_dtv",
+}
+
+var channelLabelNames = scalar.UToSymStr{
+	0:          "unused",
+	1:          "left",
+	2:          "right",
+	3:          "center",
+	4:          "lfe_screen",
+	5:          "left_surround",
+	6:          "right_surround",
+	7:          "left_center",
+	8:          "right_center",
+	9:          "center_surround",
+	10:         "left_surround_direct",
+	11:         "right_surround_direct",
+	12:         "top_center_surround",
+	13:         "vertical_height_left",
+	14:         "vertical_height_center",
+	15:         "vertical_height_right",
+	16:         "top_back_left",
+	17:         "top_back_center",
+	18:         "top_back_right",
+	33:         "rear_surround_left",
+	34:         "rear_surround_right",
+	35:         "left_wide",
+	36:         "right_wide",
+	37:         "lfe2",
+	38:         "left_total",
+	39:         "right_total",
+	40:         "hearing_impaired",
+	41:         "narration",
+	42:         "mono",
+	43:         "dialog_centric_mix",
+	44:         "center_surround_direct",
+	100:        "use_coordinates",
+	0xffffffff: "unknown",
+}
+
+type cafContext struct {
+	formatID        string
+	bytesPerPacket  uint64
+	framesPerPacket uint64
+	aacObjectType   int
+	packetSizes     []int64
+}
+
+// variable length integer, 7 bits per byte with high bit set if more bytes follow
+func readVarInt(d *decode.D) uint64 {
+	var n uint64
+	for i := 0; i < 10; i++ {
+		b := d.U8()
+		n = n<<7 | b&0x7f
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return n
+}
+
+var varIntFn = func(d *decode.D) scalar.S {
+	return scalar.S{Actual: readVarInt(d)}
+}
+
+// packet sizes from packet table chunk, can be after data chunk
+func scanPacketSizes(d *decode.D) []int64 {
+	var bytesPerPacket, framesPerPacket uint64
+	var sizes []int64
+	pos := d.Pos()
+	for pos+12*8 <= d.Len() {
+		var chunkType string
+		var size int64
+		d.SeekAbs(pos, func(d *decode.D) {
+			chunkType = d.UTF8(4)
+			size = d.S64()
+		})
+		if size < 0 || size > (d.Len()-pos)/8-12 {
+			break
+		}
+		switch {
+		case chunkType == "desc" && size >= 32:
+			d.SeekAbs(pos+(12+16)*8, func(d *decode.D) {
+				bytesPerPacket = d.U32()
+				framesPerPacket = d.U32()
+			})
+		case chunkType == "pakt" && size >= 24 && bytesPerPacket == 0:
+			d.RangeFn(pos+12*8, size*8, func(d *decode.D) {
+				numPackets := d.S64()
+				d.SeekRel(16 * 8)
+				for i := int64(0); i < numPackets && d.BitsLeft() >= 8; i++ {
+					sizes = append(sizes, int64(readVarInt(d)))
+					if framesPerPacket == 0 && d.BitsLeft() >= 8 {
+						readVarInt(d)
+					}
+				}
+			})
+		}
+		pos += (12 + size) * 8
+	}
+	return sizes
+}
+
+func decodeALACCookie(d *decode.D) {
+	// can be wrapped in frma and alac atoms
+	if d.BitsLeft() >= 12*8 && string(d.PeekBytes(8)[4:]) == "frma" {
+		d.FieldStruct("frma", func(d *decode.D) {
+			d.FieldU32("size")
+			d.FieldUTF8("type", 4)
+			d.FieldUTF8("format", 4)
+		})
+	}
+	hasAtom := d.BitsLeft() >= 12*8 && string(d.PeekBytes(8)[4:]) == "alac"
+	if hasAtom {
+		d.FieldU32("size")
+		d.FieldUTF8("type", 4)
+		d.FieldU32("version")
+	}
+	d.FieldStruct("config", func(d *decode.D) {
+		d.FieldU32("frame_length")
+		d.FieldU8("compatible_version")
+		d.FieldU8("bit_depth")
+		d.FieldU8("pb")
+		d.FieldU8("mb")
+		d.FieldU8("kb")
+		d.FieldU8("num_channels")
+		d.FieldU16("max_run")
+		d.FieldU32("max_frame_bytes")
+		d.FieldU32("avg_bit_rate")
+		d.FieldU32("sample_rate")
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+}
+
+var chunkFns = map[string]func(d *decode.D, ctx *cafContext){
+	"desc": func(d *decode.D, ctx *cafContext) {
+		d.FieldF64("sample_rate")
+		ctx.formatID = d.FieldUTF8("format_id", 4, formatIDDescriptions)
+		d.FieldU32("format_flags", scalar.ActualHex)
+		ctx.bytesPerPacket = d.FieldU32("bytes_per_packet")
+		ctx.framesPerPacket = d.FieldU32("frames_per_packet")
+		d.FieldU32("channels_per_frame")
+		d.FieldU32("bits_per_channel")
+	},
+	"data": func(d *decode.D, ctx *cafContext) {
+		d.FieldU32("edit_count")
+		if ctx.formatID != formatIDAAC || ctx.aacObjectType == 0 || len(ctx.packetSizes) == 0 {
+			d.FieldRawLen("data", d.BitsLeft())
+			return
+		}
+		d.FieldArray("packets", func(d *decode.D) {
+			for _, size := range ctx.packetSizes {
+				if size*8 > d.BitsLeft() {
+					break
+				}
+				d.FieldFormatOrRawLen("packet", size*8, aacFrameFormat, format.AACFrameIn{ObjectType: ctx.aacObjectType})
+			}
+		})
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("unknown", d.BitsLeft())
+		}
+	},
+	"pakt": func(d *decode.D, ctx *cafContext) {
+		numPackets := d.FieldS64("number_packets")
+		d.FieldS64("number_valid_frames")
+		d.FieldS32("priming_frames")
+		d.FieldS32("remainder_frames")
+		// packet sizes and frames are only stored if not constant
+		if ctx.bytesPerPacket == 0 || ctx.framesPerPacket == 0 {
+			d.FieldArray("packets", func(d *decode.D) {
+				for i := int64(0); i < numPackets && d.BitsLeft() >= 8; i++ {
+					d.FieldStruct("packet", func(d *decode.D) {
+						if ctx.bytesPerPacket == 0 {
+							d.FieldUScalarFn("size", varIntFn)
+						}
+						if ctx.framesPerPacket == 0 {
+							d.FieldUScalarFn("frames", varIntFn)
+						}
+					})
+				}
+			})
+		}
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("unknown", d.BitsLeft())
+		}
+	},
+	"chan": func(d *decode.D, _ *cafContext) {
+		d.FieldU32("channel_layout_tag", channelLayoutTagNames, scalar.ActualHex)
+		d.FieldU32("channel_bitmap", scalar.ActualHex)
+		numDescriptions := d.FieldU32("number_channel_descriptions")
+		d.FieldArray("channel_descriptions", func(d *decode.D) {
+			for i := uint64(0); i < numDescriptions; i++ {
+				d.FieldStruct("channel_description", func(d *decode.D) {
+					d.FieldU32("channel_label", channelLabelNames)
+					d.FieldU32("channel_flags", scalar.ActualHex)
+					d.FieldArray("coordinates", func(d *decode.D) {
+						for j := 0; j < 3; j++ {
+							d.FieldF32("coordinate")
+						}
+					})
+				})
+			}
+		})
+	},
+	"kuki": func(d *decode.D, ctx *cafContext) {
+		switch ctx.formatID {
+		case formatIDAAC:
+			_, v := d.FieldFormatOrRaw("magic_cookie", mpegESFormat, nil)
+			if mpegEsOut, ok := v.(format.MpegEsOut); ok && len(mpegEsOut.DecoderConfigs) > 0 {
+				dc := mpegEsOut.DecoderConfigs[0]
+				if dc.ObjectType == format.MPEGObjectTypeAAC {
+					ctx.aacObjectType = dc.ASCObjectType
+				}
+			}
+		case formatIDALAC:
+			d.FieldStruct("magic_cookie", decodeALACCookie)
+		default:
+			d.FieldRawLen("magic_cookie", d.BitsLeft())
+		}
+	},
+	"info": func(d *decode.D, _ *cafContext) {
+		numEntries := d.FieldU32("num_entries")
+		d.FieldArray("entries", func(d *decode.D) {
+			for i := uint64(0); i < numEntries; i++ {
+				d.FieldStruct("entry", func(d *decode.D) {
+					d.FieldUTF8Null("key")
+					d.FieldUTF8Null("value")
+				})
+			}
+		})
+	},
+	"uuid": func(d *decode.D, _ *cafContext) {
+		d.FieldRawLen("uuid", 16*8, scalar.RawUUID)
+		d.FieldRawLen("data", d.BitsLeft())
+	},
+	"free": func(d *decode.D, _ *cafContext) {
+		d.FieldRawLen("padding", d.BitsLeft())
+	},
+}
+
+func decodeChunk(d *decode.D, ctx *cafContext) {
+	chunkType := d.FieldUTF8("type", 4, chunkTypeDescriptions)
+	size := d.FieldS64("size", scalar.SToDescription{-1: "Rest of file"})
+	// only data chunk can have unknown size
+	if size == -1 && chunkType == "data" {
+		size = d.BitsLeft() / 8
+	}
+	if size < 0 || size > d.BitsLeft()/8 {
+		d.Fatalf("chunk %q size %d outside buffer", chunkType, size)
+	}
+
+	d.FramedFn(size*8, func(d *decode.D) {
+		if fn, ok := chunkFns[chunkType]; ok {
+			fn(d, ctx)
+			return
+		}
+		d.FieldRawLen("data", d.BitsLeft())
+	})
+}
+
+func cafDecode(d *decode.D, _ any) any {
+	d.FieldUTF8("file_type", 4, d.AssertStr("caff"))
+	d.FieldU16("file_version", d.AssertU(1))
+	d.FieldU16("file_flags")
+
+	ctx := &cafContext{packetSizes: scanPacketSizes(d)}
+	d.FieldStructArrayLoop("chunks", "chunk", func() bool { return d.BitsLeft() >= 12*8 }, func(d *decode.D) {
+		decodeChunk(d, ctx)
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+
+	return nil
+}
@@ -0,0 +1,360 @@
+package capnproto
+
+// https://capnproto.org/encoding.html
+// TODO: packed encoding
+// TODO: schema support
+
+import (
+	"embed"
+	"unicode/utf8"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/internal/mathex"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed capnproto.jq
+var capnprotoFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.CAPNPROTO,
+		Description: "Cap'n Proto message",
+		DecodeFn:    capnprotoDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(capnprotoFS)
+}
+
+const wordBits = 64
+
+// same defaults as the reference implementation
+const (
+	nestingLimit   = 64
+	traversalLimit = 8 * 1024 * 1024
+	// sanity limit on number of segments
+	maxSegments = 512
+)
+
+const (
+	pointerTypeStruct = 0
+	pointerTypeList   = 1
+	pointerTypeFar    = 2
+	pointerTypeOther  = 3
+)
+
+var pointerTypeNames = scalar.UToSymStr{
+	pointerTypeStruct: "struct",
+	pointerTypeList:   "list",
+	pointerTypeFar:    "far",
+	pointerTypeOther:  "other",
+}
+
+const (
+	elementSizeVoid      = 0
+	elementSizeByte      = 2
+	elementSizePointer   = 6
+	elementSizeComposite = 7
+)
+
+var elementSizeNames = scalar.UToSymStr{
+	0: "void",
+	1: "bit",
+	2: "byte",
+	3: "two_bytes",
+	4: "four_bytes",
+	5: "eight_bytes",
+	6: "pointer",
+	7: "composite",
+}
+
+var elementSizeBits = [...]int64{0, 1, 8, 16, 32, 64, 64}
+
+type segment struct {
+	start int64 // bit position of segment in buffer
+	words int64
+}
+
+type decoder struct {
+	segments      []segment
+	wordsTraveled int64
+}
+
+func (cd *decoder) wordPos(seg int, word int64) int64 {
+	return cd.segments[seg].start + word*wordBits
+}
+
+// checks that words are inside segment and counts them towards traversal limit
+func (cd *decoder) checkRange(d *decode.D, seg int, word int64, words int64) bool {
+	if word < 0 || words < 0 || word+words > cd.segments[seg].words {
+		d.Errorf("words %d-%d outside segment %d", word, word+words, seg)
+		return false
+	}
+	cd.wordsTraveled += words
+	if cd.wordsTraveled > traversalLimit {
+		d.Errorf("traversal limit %d words exceeded", traversalLimit)
+		return false
+	}
+	return true
+}
+
+// decode pointer at word in segment
+func (cd *decoder) fieldPointer(d *decode.D, name string, seg int, word int64, depth int) {
+	pos := cd.wordPos(seg, word)
+	d.RangeFn(pos, d.Len()-pos, func(d *decode.D) {
+		d.FieldStruct(name, func(d *decode.D) {
+			p := d.FieldU64("raw", scalar.ActualHex)
+			typ := p & 0x3
+			d.FieldValueU("type", typ, pointerTypeNames)
+			if p == 0 {
+				d.FieldValueBool("null", true)
+				return
+			}
+			if depth > nestingLimit {
+				d.Errorf("nesting limit %d exceeded", nestingLimit)
+				return
+			}
+
+			switch typ {
+			case pointerTypeStruct, pointerTypeList:
+				offset := mathex.TwosComplement(30, (p>>2)&0x3fff_ffff)
+				d.FieldValueS("offset", offset)
+				cd.decodeTarget(d, p, seg, word+1+offset, depth)
+			case pointerTypeFar:
+				doubleFar := (p>>2)&1 != 0
+				landingPad := int64((p >> 3) & 0x1fff_ffff)
+				segmentID := int(p >> 32)
+				d.FieldValueBool("double_far", doubleFar)
+				d.FieldValueU("landing_pad_offset", uint64(landingPad))
+				d.FieldValueU("segment_id", uint64(segmentID))
+				if segmentID >= len(cd.segments) {
+					d.Errorf("segment %d not found", segmentID)
+					return
+				}
+				if !doubleFar {
+					if !cd.checkRange(d, segmentID, landingPad, 1) {
+						return
+					}
+					cd.fieldPointer(d, "landing_pad", segmentID, landingPad, depth+1)
+					return
+				}
+				cd.decodeDoubleLandingPad(d, segmentID, landingPad, depth)
+			case pointerTypeOther:
+				if (p>>2)&0x3fff_ffff == 0 {
+					d.FieldValueU("capability_index", p>>32)
+				}
+			}
+		})
+	})
+}
+
+// double far landing pad is a far pointer to the content start followed by a
+// tag word that describes the content as a struct or list pointer with zero offset
+func (cd *decoder) decodeDoubleLandingPad(d *decode.D, seg int, word int64, depth int) {
+	if !cd.checkRange(d, seg, word, 2) {
+		return
+	}
+	pos := cd.wordPos(seg, word)
+	d.RangeFn(pos, d.Len()-pos, func(d *decode.D) {
+		d.FieldStruct("landing_pad", func(d *decode.D) {
+			var contentSegment int
+			var contentWord int64
+			d.FieldStruct("far", func(d *decode.D) {
+				p := d.FieldU64("raw", scalar.ActualHex)
+				d.FieldValueU("type", p&0x3, pointerTypeNames)
+				contentWord = int64((p >> 3) & 0x1fff_ffff)
+				contentSegment = int(p >> 32)
+				d.FieldValueU("offset", uint64(contentWord))
+				d.FieldValueU("segment_id", uint64(contentSegment))
+				if p&0x3 != pointerTypeFar || (p>>2)&1 != 0 {
+					d.Errorf("double far landing pad must start with a single far pointer")
+				}
+			})
+			if contentSegment >= len(cd.segments) {
+				d.Errorf("segment %d not found", contentSegment)
+				return
+			}
+			d.FieldStruct("tag", func(d *decode.D) {
+				p := d.FieldU64("raw", scalar.ActualHex)
+				typ := p & 0x3
+				d.FieldValueU("type", typ, pointerTypeNames)
+				if typ != pointerTypeStruct && typ != pointerTypeList {
+					d.Errorf("double far tag must be a struct or list pointer")
+					return
+				}
+				cd.decodeTarget(d, p, contentSegment, contentWord, depth)
+			})
+		})
+	})
+}
+
+// decode struct or list content described by pointer p located at target
+func (cd *decoder) decodeTarget(d *decode.D, p uint64, seg int, target int64, depth int) {
+	switch p & 0x3 {
+	case pointerTypeStruct:
+		dataWords := int64((p >> 32) & 0xffff)
+		pointerCount := int64(p >> 48)
+		d.FieldValueU("data_size", uint64(dataWords))
+		d.FieldValueU("pointer_count", uint64(pointerCount))
+		if !cd.checkRange(d, seg, target, dataWords+pointerCount) {
+			return
+		}
+		if dataWords+pointerCount == 0 {
+			// empty struct, usually points to itself
+			return
+		}
+		pos := cd.wordPos(seg, target)
+		d.RangeFn(pos, d.Len()-pos, func(d *decode.D) {
+			d.FieldStruct("struct", func(d *decode.D) {
+				cd.decodeStructContent(d, seg, target, dataWords, pointerCount, depth)
+			})
+		})
+	case pointerTypeList:
+		elementSize := (p >> 32) & 0x7
+		count := int64(p >> 35)
+		d.FieldValueU("element_size", elementSize, elementSizeNames)
+		if elementSize == elementSizeComposite {
+			d.FieldValueU("word_count", uint64(count))
+		} else {
+			d.FieldValueU("element_count", uint64(count))
+		}
+
+		if elementSize == elementSizeComposite {
+			cd.decodeCompositeList(d, seg, target, count, depth)
+			return
+		}
+
+		bits := count * elementSizeBits[elementSize]
+		words := (bits + wordBits - 1) / wordBits
+		if !cd.checkRange(d, seg, target, words) {
+			return
+		}
+		if elementSize == elementSizeVoid || count == 0 {
+			return
+		}
+		pos := cd.wordPos(seg, target)
+		d.RangeFn(pos, d.Len()-pos, func(d *decode.D) {
+			d.FieldStruct("list", func(d *decode.D) {
+				if elementSize == elementSizePointer {
+					d.FieldArray("pointers", func(d *decode.D) {
+						for i := int64(0); i < count; i++ {
+							cd.fieldPointer(d, "pointer", seg, target+i, depth+1)
+						}
+					})
+					return
+				}
+				if elementSize != elementSizeByte {
+					d.FieldRawLen("data", bits)
+					return
+				}
+				bs := d.PeekBytes(int(count))
+				d.FieldRawLen("data", bits)
+				// Text is a byte list with NUL terminator
+				if bs[len(bs)-1] == 0 && utf8.Valid(bs[:len(bs)-1]) {
+					d.FieldValueStr("text", string(bs[:len(bs)-1]))
+				}
+			})
+		})
+	}
+}
+
+func (cd *decoder) decodeStructContent(d *decode.D, seg int, word int64, dataWords int64, pointerCount int64, depth int) {
+	if dataWords > 0 {
+		d.FieldRawLen("data", dataWords*wordBits)
+	}
+	if pointerCount > 0 {
+		d.FieldArray("pointers", func(d *decode.D) {
+			for i := int64(0); i < pointerCount; i++ {
+				cd.fieldPointer(d, "pointer", seg, word+dataWords+i, depth+1)
+			}
+		})
+	}
+}
+
+func (cd *decoder) decodeCompositeList(d *decode.D, seg int, target int64, words int64, depth int) {
+	// tag word is not included in word count
+	if !cd.checkRange(d, seg, target, words+1) {
+		return
+	}
+	pos := cd.wordPos(seg, target)
+	d.RangeFn(pos, d.Len()-pos, func(d *decode.D) {
+		d.FieldStruct("list", func(d *decode.D) {
+			var count, dataWords, pointerCount int64
+			d.FieldStruct("tag", func(d *decode.D) {
+				p := d.FieldU64("raw", scalar.ActualHex)
+				d.FieldValueU("type", p&0x3, pointerTypeNames)
+				count = int64((p >> 2) & 0x3fff_ffff)
+				dataWords = int64((p >> 32) & 0xffff)
+				pointerCount = int64(p >> 48)
+				d.FieldValueU("element_count", uint64(count))
+				d.FieldValueU("data_size", uint64(dataWords))
+				d.FieldValueU("pointer_count", uint64(pointerCount))
+			})
+			if count*(dataWords+pointerCount) > words {
+				d.Errorf("composite list elements larger than word count %d", words)
+				return
+			}
+			d.FieldArray("elements", func(d *decode.D) {
+				for i := int64(0); i < count; i++ {
+					d.FieldStruct("element", func(d *decode.D) {
+						cd.decodeStructContent(d, seg, target+1+i*(dataWords+pointerCount), dataWords, pointerCount, depth)
+					})
+					d.SeekRel(pointerCount * wordBits)
+				}
+			})
+		})
+	})
+}
+
+func decodeMessage(d *decode.D) {
+	segmentCount := d.FieldU32("segment_count", scalar.ActualUAdd(1))
+	if segmentCount > maxSegments {
+		d.Fatalf("segment count %d larger than %d", segmentCount, maxSegments)
+	}
+	var sizes []int64
+	d.FieldArray("segment_sizes", func(d *decode.D) {
+		for i := uint64(0); i < segmentCount; i++ {
+			sizes = append(sizes, int64(d.FieldU32("size")))
+		}
+	})
+	// segment table is padded to a word boundary
+	if segmentCount%2 == 0 {
+		d.FieldU32("padding", d.ValidateU(0))
+	}
+
+	cd := &decoder{}
+	pos := d.Pos()
+	for _, s := range sizes {
+		cd.segments = append(cd.segments, segment{start: pos, words: s})
+		pos += s * wordBits
+	}
+	if pos > d.Len() {
+		d.Fatalf("segments larger than buffer")
+	}
+
+	// root pointer is first word of first segment
+	if cd.segments[0].words > 0 {
+		cd.fieldPointer(d, "root", 0, 0, 0)
+	}
+
+	d.FieldArray("segments", func(d *decode.D) {
+		for _, s := range cd.segments {
+			d.FieldRawLen("segment", s.words*wordBits)
+		}
+	})
+}
+
+func capnprotoDecode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	// a stream of messages
+	d.FieldArray("messages", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("message", decodeMessage)
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package crypto
+
+// FastCDC content-defined chunking
+// https://www.usenix.org/conference/atc16/technical-sessions/presentation/xia
+
+import (
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/bits"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/interp"
+)
+
+//go:embed chunk.jq
+var chunkFS embed.FS
+
+func init() {
+	interp.RegisterFunc1("_tochunks", toChunks)
+	interp.RegisterFS(chunkFS)
+}
+
+// gear table generated with splitmix64 to be stable between versions
+var gearTable = func() [256]uint64 {
+	var t [256]uint64
+	s := uint64(0x6671)
+	for i := range t {
+		s += 0x9e3779b97f4a7c15
+		z := s
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		t[i] = z ^ (z >> 31)
+	}
+	return t
+}()
+
+// mask with n high bits set. gear hash is shifted left so high bits depend on more bytes
+func gearMask(n int) uint64 {
+	if n <= 0 {
+		return 0
+	}
+	if n >= 64 {
+		return ^uint64(0)
+	}
+	return ^uint64(0) << (64 - n)
+}
+
+// fastCDCCut returns length of first chunk in b. Uses normalized chunking with a harder
+// mask before average size and an easier mask after to narrow the chunk size distribution.
+func fastCDCCut(b []byte, minSize int, avgSize int, maxSize int) int {
+	n := len(b)
+	if n <= minSize {
+		return n
+	}
+	if n > maxSize {
+		n = maxSize
+	}
+	normal := avgSize
+	if normal > n {
+		normal = n
+	}
+
+	avgBits := bits.Len(uint(avgSize)) - 1
+	maskS := gearMask(avgBits + 1)
+	maskL := gearMask(avgBits - 1)
+
+	var h uint64
+	i := minSize
+	for ; i < normal; i++ {
+		h = (h << 1) + gearTable[b[i]]
+		if h&maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = (h << 1) + gearTable[b[i]]
+		if h&maskL == 0 {
+			return i + 1
+		}
+	}
+
+	return n
+}
+
+type toChunksOpts struct {
+	Algorithm string
+	MinSize   int
+	AvgSize   int
+	MaxSize   int
+	Hash      string
+}
+
+func toChunks(_ *interp.Interp, c any, opts toChunksOpts) any {
+	inBR, err := interp.ToBitReader(c)
+	if err != nil {
+		return err
+	}
+
+	var cutFn func(b []byte) int
+	switch opts.Algorithm {
+	case "fastcdc":
+		if opts.MinSize < 1 || opts.MinSize > opts.AvgSize || opts.AvgSize > opts.MaxSize {
+			return fmt.Errorf("sizes must be 0 < min_size <= avg_size <= max_size")
+		}
+		cutFn = func(b []byte) int { return fastCDCCut(b, opts.MinSize, opts.AvgSize, opts.MaxSize) }
+	case "fixed":
+		if opts.AvgSize < 1 {
+			return fmt.Errorf("avg_size must be > 0")
+		}
+		cutFn = func(b []byte) int {
+			if len(b) < opts.AvgSize {
+				return len(b)
+			}
+			return opts.AvgSize
+		}
+	default:
+		return fmt.Errorf("unknown chunking algorithm %s", opts.Algorithm)
+	}
+	if hashFn(opts.Hash) == nil {
+		return fmt.Errorf("unknown hash function %s", opts.Hash)
+	}
+
+	buf, err := io.ReadAll(bitio.NewIOReader(inBR))
+	if err != nil {
+		return err
+	}
+
+	chunks := []any{}
+	for offset := 0; offset < len(buf); {
+		n := cutFn(buf[offset:])
+		h := hashFn(opts.Hash)
+		_, _ = h.Write(buf[offset : offset+n])
+		chunks = append(chunks, map[string]any{
+			"offset": offset,
+			"size":   n,
+			"hash":   hex.EncodeToString(h.Sum(nil)),
+		})
+		offset += n
+	}
+
+	return chunks
+}
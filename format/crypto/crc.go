@@ -0,0 +1,172 @@
+package crypto
+
+// CRC using Rocksoft parameter model
+// https://reveng.sourceforge.io/crc-catalogue/all.htm
+
+import (
+	"embed"
+	"fmt"
+	"hash/adler32"
+	"io"
+	"math"
+	"math/big"
+	"math/bits"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/interp"
+)
+
+//go:embed crc.jq
+var crcFS embed.FS
+
+func init() {
+	interp.RegisterFunc1("_crc", toCRC)
+	interp.RegisterFunc0("adler32", toAdler32)
+	interp.RegisterFS(crcFS)
+}
+
+type crcOpts struct {
+	width  int
+	poly   uint64
+	init   uint64
+	refin  bool
+	refout bool
+	xorout uint64
+}
+
+// register is kept left aligned in 64 bits so that any width can use same table
+type crc struct {
+	opts  crcOpts
+	table [256]uint64
+	reg   uint64
+}
+
+func newCRC(opts crcOpts) *crc {
+	c := &crc{opts: opts}
+	shift := 64 - opts.width
+	poly := opts.poly << shift
+	for i := range c.table {
+		r := uint64(i) << 56
+		for j := 0; j < 8; j++ {
+			if r&(1<<63) != 0 {
+				r = r<<1 ^ poly
+			} else {
+				r <<= 1
+			}
+		}
+		c.table[i] = r
+	}
+	c.reg = opts.init << shift
+	return c
+}
+
+func (c *crc) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if c.opts.refin {
+			b = bits.Reverse8(b)
+		}
+		c.reg = c.reg<<8 ^ c.table[byte(c.reg>>56)^b]
+	}
+	return len(p), nil
+}
+
+func (c *crc) sum() uint64 {
+	shift := 64 - c.opts.width
+	v := c.reg >> shift
+	if c.opts.refout {
+		v = bits.Reverse64(v) >> shift
+	}
+	return (v ^ c.opts.xorout) & (math.MaxUint64 >> shift)
+}
+
+// uint64 values that don't fit in int are returned as a big.Int
+func checksumValue(v uint64) any {
+	if v > math.MaxInt {
+		return new(big.Int).SetUint64(v)
+	}
+	return int(v)
+}
+
+// jq numbers can be int, float64 or big.Int, ex hex literals are big.Int
+func toUint64(v any) (uint64, bool) {
+	switch v := v.(type) {
+	case int:
+		return uint64(v), v >= 0
+	case float64:
+		return uint64(v), v >= 0 && v <= math.MaxUint64 && v == math.Trunc(v)
+	case *big.Int:
+		return v.Uint64(), v.IsUint64()
+	default:
+		return 0, false
+	}
+}
+
+func parseCRCOpts(m map[string]any) (crcOpts, error) {
+	var opts crcOpts
+	for k, v := range m {
+		switch k {
+		case "width", "poly", "init", "xorout":
+			n, ok := toUint64(v)
+			if !ok {
+				return opts, fmt.Errorf("%s must be an unsigned integer", k)
+			}
+			switch k {
+			case "width":
+				if n > 64 {
+					n = 0
+				}
+				opts.width = int(n)
+			case "poly":
+				opts.poly = n
+			case "init":
+				opts.init = n
+			case "xorout":
+				opts.xorout = n
+			}
+		case "refin", "refout":
+			b, ok := v.(bool)
+			if !ok {
+				return opts, fmt.Errorf("%s must be a boolean", k)
+			}
+			if k == "refin" {
+				opts.refin = b
+			} else {
+				opts.refout = b
+			}
+		default:
+			return opts, fmt.Errorf("unknown option %s", k)
+		}
+	}
+	if opts.width == 0 {
+		return opts, fmt.Errorf("width must be between 1 and 64")
+	}
+	return opts, nil
+}
+
+func toCRC(_ *interp.Interp, c any, m map[string]any) any {
+	opts, err := parseCRCOpts(m)
+	if err != nil {
+		return err
+	}
+	br, err := interp.ToBitReader(c)
+	if err != nil {
+		return err
+	}
+	h := newCRC(opts)
+	if _, err := io.Copy(h, bitio.NewIOReader(br)); err != nil {
+		return err
+	}
+	return checksumValue(h.sum())
+}
+
+func toAdler32(_ *interp.Interp, c any) any {
+	br, err := interp.ToBitReader(c)
+	if err != nil {
+		return err
+	}
+	h := adler32.New()
+	if _, err := io.Copy(h, bitio.NewIOReader(br)); err != nil {
+		return err
+	}
+	return checksumValue(uint64(h.Sum32()))
+}
@@ -0,0 +1,244 @@
+package crypto
+
+// ssdeep context triggered piecewise hashing (CTPH)
+// https://ssdeep-project.github.io/ssdeep/
+// https://dfrws.org/wp-content/uploads/2019/06/paper-identifying_almost_identical_files_using_context_triggered_piecewise_hashing.pdf
+// TODO: TLSH
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/interp"
+)
+
+func init() {
+	interp.RegisterFunc0("tossdeep", toSSDeep)
+	interp.RegisterFunc1("ssdeep_compare", ssdeepCompare)
+}
+
+const (
+	ssdeepRollingWindow = 7
+	ssdeepMinBlockSize  = 3
+	ssdeepHashInit      = 0x28021967
+	ssdeepHashPrime     = 0x01000193
+	ssdeepSpamSumLength = 64
+	ssdeepBase64        = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+type ssdeepRoll struct {
+	window [ssdeepRollingWindow]byte
+	h1     uint32
+	h2     uint32
+	h3     uint32
+	n      uint32
+}
+
+func (r *ssdeepRoll) hash(c byte) uint32 {
+	r.h2 -= r.h1
+	r.h2 += ssdeepRollingWindow * uint32(c)
+	r.h1 += uint32(c)
+	r.h1 -= uint32(r.window[r.n%ssdeepRollingWindow])
+	r.window[r.n%ssdeepRollingWindow] = c
+	r.n++
+	r.h3 <<= 5
+	r.h3 ^= uint32(c)
+	return r.sum()
+}
+
+func (r *ssdeepRoll) sum() uint32 {
+	return r.h1 + r.h2 + r.h3
+}
+
+func ssdeepSumHash(c byte, h uint32) uint32 {
+	return (h * ssdeepHashPrime) ^ uint32(c)
+}
+
+func ssdeepDigest(buf []byte, blockSize uint32) (string, string) {
+	var roll ssdeepRoll
+	var s1, s2 strings.Builder
+	h1 := uint32(ssdeepHashInit)
+	h2 := uint32(ssdeepHashInit)
+	for _, c := range buf {
+		h1 = ssdeepSumHash(c, h1)
+		h2 = ssdeepSumHash(c, h2)
+		r := roll.hash(c)
+		// last character is reserved for the remaining data
+		if r%blockSize == blockSize-1 && s1.Len() < ssdeepSpamSumLength-1 {
+			s1.WriteByte(ssdeepBase64[h1%64])
+			h1 = ssdeepHashInit
+		}
+		if r%(blockSize*2) == blockSize*2-1 && s2.Len() < ssdeepSpamSumLength/2-1 {
+			s2.WriteByte(ssdeepBase64[h2%64])
+			h2 = ssdeepHashInit
+		}
+	}
+	if roll.sum() != 0 {
+		s1.WriteByte(ssdeepBase64[h1%64])
+		s2.WriteByte(ssdeepBase64[h2%64])
+	}
+	return s1.String(), s2.String()
+}
+
+func ssdeepHash(buf []byte) string {
+	blockSize := uint32(ssdeepMinBlockSize)
+	for uint64(blockSize)*ssdeepSpamSumLength < uint64(len(buf)) {
+		blockSize *= 2
+	}
+	for {
+		s1, s2 := ssdeepDigest(buf, blockSize)
+		// too few pieces, try smaller block size
+		if blockSize > ssdeepMinBlockSize && len(s1) < ssdeepSpamSumLength/2 {
+			blockSize /= 2
+			continue
+		}
+		return fmt.Sprintf("%d:%s:%s", blockSize, s1, s2)
+	}
+}
+
+func toSSDeep(_ *interp.Interp, c any) any {
+	br, err := interp.ToBitReader(c)
+	if err != nil {
+		return err
+	}
+	buf, err := io.ReadAll(bitio.NewIOReader(br))
+	if err != nil {
+		return err
+	}
+	return ssdeepHash(buf)
+}
+
+type ssdeepParsed struct {
+	blockSize uint32
+	s1        string
+	s2        string
+}
+
+func ssdeepParse(s string) (ssdeepParsed, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 {
+		return ssdeepParsed{}, fmt.Errorf("%q: invalid ssdeep hash", s)
+	}
+	bs, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil || bs < ssdeepMinBlockSize {
+		return ssdeepParsed{}, fmt.Errorf("%q: invalid ssdeep block size", s)
+	}
+	// ignore optional ,"filename" suffix from ssdeep tool output
+	s2, _, _ := strings.Cut(parts[2], ",")
+	return ssdeepParsed{blockSize: uint32(bs), s1: ssdeepEliminateSequences(parts[1]), s2: ssdeepEliminateSequences(s2)}, nil
+}
+
+// runs of more than 3 same characters carry little information
+func ssdeepEliminateSequences(s string) string {
+	b := []byte(s)
+	out := b[:0]
+	for i, c := range b {
+		if i >= 3 && c == b[i-1] && c == b[i-2] && c == b[i-3] {
+			continue
+		}
+		out = append(out, c)
+	}
+	return string(out)
+}
+
+func ssdeepHasCommonSubstring(s1, s2 string) bool {
+	if len(s1) < ssdeepRollingWindow || len(s2) < ssdeepRollingWindow {
+		return false
+	}
+	for i := 0; i+ssdeepRollingWindow <= len(s1); i++ {
+		if strings.Contains(s2, s1[i:i+ssdeepRollingWindow]) {
+			return true
+		}
+	}
+	return false
+}
+
+// weighted levenshtein distance, insert and remove cost 1 and replace 2
+func ssdeepEditDistance(s1, s2 string) uint32 {
+	prev := make([]uint32, len(s2)+1)
+	cur := make([]uint32, len(s2)+1)
+	for j := range prev {
+		prev[j] = uint32(j)
+	}
+	for i := 1; i <= len(s1); i++ {
+		cur[0] = uint32(i)
+		for j := 1; j <= len(s2); j++ {
+			replace := prev[j-1]
+			if s1[i-1] != s2[j-1] {
+				replace += 2
+			}
+			cur[j] = min32(min32(prev[j]+1, cur[j-1]+1), replace)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(s2)]
+}
+
+func min32(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func ssdeepScoreStrings(s1, s2 string, blockSize uint32) uint32 {
+	if !ssdeepHasCommonSubstring(s1, s2) {
+		return 0
+	}
+	l1 := uint32(len(s1))
+	l2 := uint32(len(s2))
+	score := ssdeepEditDistance(s1, s2)
+	score = (score * ssdeepSpamSumLength) / (l1 + l2)
+	score = (100 * score) / ssdeepSpamSumLength
+	if score >= 100 {
+		return 0
+	}
+	score = 100 - score
+	// don't exaggerate the match size for small block sizes
+	if blockSize >= (99+ssdeepRollingWindow)/ssdeepRollingWindow*ssdeepMinBlockSize {
+		return score
+	}
+	if limit := blockSize / ssdeepMinBlockSize * min32(l1, l2); score > limit {
+		score = limit
+	}
+	return score
+}
+
+func ssdeepCompare(_ *interp.Interp, c any, other string) any {
+	s, ok := c.(string)
+	if !ok {
+		return fmt.Errorf("input is not a ssdeep hash string")
+	}
+	a, err := ssdeepParse(s)
+	if err != nil {
+		return err
+	}
+	b, err := ssdeepParse(other)
+	if err != nil {
+		return err
+	}
+
+	var score uint32
+	switch {
+	case a.blockSize == b.blockSize:
+		if a.s1 == b.s1 {
+			return 100
+		}
+		score = ssdeepScoreStrings(a.s1, b.s1, a.blockSize)
+		if s := ssdeepScoreStrings(a.s2, b.s2, a.blockSize*2); s > score {
+			score = s
+		}
+	case a.blockSize == b.blockSize*2:
+		score = ssdeepScoreStrings(a.s1, b.s2, a.blockSize)
+	case a.blockSize*2 == b.blockSize:
+		score = ssdeepScoreStrings(a.s2, b.s1, b.blockSize)
+	default:
+		// too different sizes to compare
+		return 0
+	}
+
+	return int(score)
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/internal/gojqex"
@@ -63,6 +64,19 @@ func decodeCSV(d *decode.D, in any) any {
 		rvs = append(rvs, vs)
 	}
 
+	if ci.Header && len(rvs) > 0 {
+		header := rvs[0].([]any)
+		ovs := []any{}
+		for _, rv := range rvs[1:] {
+			o := map[string]any{}
+			for i, v := range rv.([]any) {
+				o[header[i].(string)] = v
+			}
+			ovs = append(ovs, o)
+		}
+		rvs = ovs
+	}
+
 	d.Value.V = &scalar.S{Actual: rvs}
 	d.Value.Range.Len = d.Len()
 
@@ -70,7 +84,46 @@ func decodeCSV(d *decode.D, in any) any {
 }
 
 type ToCSVOpts struct {
-	Comma string
+	Comma  string
+	Header bool
+}
+
+// header row is sorted keys of first object, missing keys are empty
+func toCSVRowsFromObjects(c []any) ([]any, error) {
+	if len(c) == 0 {
+		return nil, nil
+	}
+	first, ok := gojqex.Cast[map[string]any](c[0])
+	if !ok {
+		return nil, fmt.Errorf("expected row to be an object, got %s", gojqex.TypeErrorPreview(c[0]))
+	}
+	var keys []string
+	for k := range first {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var header []any
+	for _, k := range keys {
+		header = append(header, k)
+	}
+	rows := []any{header}
+	for _, row := range c {
+		o, ok := gojqex.Cast[map[string]any](row)
+		if !ok {
+			return nil, fmt.Errorf("expected row to be an object, got %s", gojqex.TypeErrorPreview(row))
+		}
+		var vs []any
+		for _, k := range keys {
+			v, ok := o[k]
+			if !ok || v == nil {
+				v = ""
+			}
+			vs = append(vs, v)
+		}
+		rows = append(rows, vs)
+	}
+	return rows, nil
 }
 
 func toCSV(_ *interp.Interp, c []any, opts ToCSVOpts) any {
@@ -79,6 +132,12 @@ func toCSV(_ *interp.Interp, c []any, opts ToCSVOpts) any {
 	if opts.Comma != "" {
 		w.Comma = rune(opts.Comma[0])
 	}
+	if opts.Header {
+		var err error
+		if c, err = toCSVRowsFromObjects(c); err != nil {
+			return err
+		}
+	}
 	for _, row := range c {
 		rs, ok := gojqex.Cast[[]any](row)
 		if !ok {
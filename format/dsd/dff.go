@@ -0,0 +1,229 @@
+package dsd
+
+// https://dsd-guide.com/sites/default/files/white-papers/DSDIFF_1.5_Spec.pdf
+
+import (
+	"embed"
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed dff.jq
+var dffFS embed.FS
+
+var dffID3v2Format decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.DFF,
+		Description: "DSD Interchange File Format",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    dffDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.ID3V2}, Group: &dffID3v2Format},
+		},
+		Functions: []string{"_help"},
+	})
+	interp.RegisterFS(dffFS)
+}
+
+var dffChannelIDDescriptions = scalar.StrToDescription{
+	"SLFT": "Stereo left",
+	"SRGT": "Stereo right",
+	"MLFT": "Multi-channel left",
+	"MRGT": "Multi-channel right",
+	"LS":   "Multi-channel left surround",
+	"RS":   "Multi-channel right surround",
+	"C":    "Center",
+	"LFE":  "Low frequency enhancement",
+}
+
+var dffLoudspeakerConfigNames = scalar.UToSymStr{
+	0:     "2_channel_stereo",
+	1:     "5_channel_itu",
+	3:     "6_channel_5.1",
+	65535: "undefined",
+}
+
+var dffCommentTypeNames = scalar.UToSymStr{
+	0: "general",
+	1: "channel",
+	2: "sound_source",
+	3: "file_history",
+}
+
+var dffMarkTypeNames = scalar.UToSymStr{
+	0: "track_start",
+	1: "track_stop",
+	2: "program_start",
+	4: "index_entry",
+}
+
+// version as major.minor.revision.build
+var dffVersionMapper = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	v := s.ActualU()
+	s.Sym = fmt.Sprintf("%d.%d.%d.%d", v>>24, (v>>16)&0xff, (v>>8)&0xff, v&0xff)
+	return s, nil
+})
+
+func dffDecodeText(d *decode.D) {
+	count := d.FieldU32("count")
+	d.FieldUTF8("text", int(count))
+	if count%2 != 0 && d.BitsLeft() >= 8 {
+		d.FieldRawLen("padding", 8)
+	}
+}
+
+var dffChunkFns map[string]func(d *decode.D)
+
+// assigned in init as chunk functions can decode chunks
+func init() {
+	dffChunkFns = map[string]func(d *decode.D){
+		"FRM8": func(d *decode.D) {
+			d.FieldUTF8("form_type", 4, d.AssertStr("DSD "))
+			dffDecodeChunks(d)
+		},
+		"FVER": func(d *decode.D) {
+			d.FieldU32("version", dffVersionMapper, scalar.ActualHex)
+		},
+		"PROP": func(d *decode.D) {
+			d.FieldUTF8("property_type", 4, d.AssertStr("SND "))
+			dffDecodeChunks(d)
+		},
+		"FS": func(d *decode.D) {
+			d.FieldU32("sample_rate")
+		},
+		"CHNL": func(d *decode.D) {
+			numChannels := d.FieldU16("num_channels")
+			d.FieldArray("channel_ids", func(d *decode.D) {
+				for i := uint64(0); i < numChannels; i++ {
+					d.FieldUTF8("channel_id", 4, scalar.ActualTrimSpace, dffChannelIDDescriptions)
+				}
+			})
+		},
+		"CMPR": func(d *decode.D) {
+			d.FieldUTF8("compression_type", 4, scalar.StrToDescription{
+				"DSD ": "Not compressed",
+				"DST ": "DST encoded",
+			})
+			count := d.FieldU8("count")
+			d.FieldUTF8("compression_name", int(count))
+			if (count+1)%2 != 0 && d.BitsLeft() >= 8 {
+				d.FieldRawLen("padding", 8)
+			}
+		},
+		"ABSS": func(d *decode.D) {
+			d.FieldU16("hours")
+			d.FieldU8("minutes")
+			d.FieldU8("seconds")
+			d.FieldU32("samples")
+		},
+		"LSCO": func(d *decode.D) {
+			d.FieldU16("loudspeaker_config", dffLoudspeakerConfigNames)
+		},
+		"DSD": func(d *decode.D) {
+			d.FieldRawLen("samples", d.BitsLeft())
+		},
+		"DST": dffDecodeChunks,
+		"FRTE": func(d *decode.D) {
+			d.FieldU32("num_frames")
+			d.FieldU16("frame_rate")
+		},
+		"DSTF": func(d *decode.D) {
+			d.FieldRawLen("frame", d.BitsLeft())
+		},
+		"DSTC": func(d *decode.D) {
+			d.FieldRawLen("crc", d.BitsLeft())
+		},
+		"DSTI": func(d *decode.D) {
+			d.FieldStructArrayLoop("frames", "frame", func() bool { return d.BitsLeft() >= 12*8 }, func(d *decode.D) {
+				d.FieldU64("offset")
+				d.FieldU32("length")
+			})
+		},
+		"COMT": func(d *decode.D) {
+			numComments := d.FieldU16("num_comments")
+			d.FieldArray("comments", func(d *decode.D) {
+				for i := uint64(0); i < numComments; i++ {
+					d.FieldStruct("comment", func(d *decode.D) {
+						d.FieldU16("year")
+						d.FieldU8("month")
+						d.FieldU8("day")
+						d.FieldU8("hour")
+						d.FieldU8("minutes")
+						d.FieldU16("type", dffCommentTypeNames)
+						d.FieldU16("reference")
+						dffDecodeText(d)
+					})
+				}
+			})
+		},
+		"DIIN": dffDecodeChunks,
+		"EMID": func(d *decode.D) {
+			d.FieldUTF8("identifier", int(d.BitsLeft()/8))
+		},
+		"MARK": func(d *decode.D) {
+			d.FieldU16("hours")
+			d.FieldU8("minutes")
+			d.FieldU8("seconds")
+			d.FieldU32("samples")
+			d.FieldS32("offset")
+			d.FieldU16("mark_type", dffMarkTypeNames)
+			d.FieldU16("mark_channel")
+			d.FieldU16("track_flags", scalar.ActualHex)
+			dffDecodeText(d)
+		},
+		"DIAR": dffDecodeText,
+		"DITI": dffDecodeText,
+		"MANF": func(d *decode.D) {
+			d.FieldUTF8("manufacturer_id", 4)
+			d.FieldRawLen("data", d.BitsLeft())
+		},
+		"ID3": func(d *decode.D) {
+			d.FieldFormat("data", dffID3v2Format, nil)
+		},
+	}
+}
+
+func dffDecodeChunk(d *decode.D) {
+	id := d.FieldUTF8("id", 4, scalar.ActualTrimSpace)
+	size := int64(d.FieldU64("size"))
+	if size < 0 || size*8 > d.BitsLeft() {
+		d.Fatalf("chunk %q size %d outside buffer", id, size)
+	}
+
+	d.FramedFn(size*8, func(d *decode.D) {
+		if fn, ok := dffChunkFns[id]; ok {
+			fn(d)
+			return
+		}
+		d.FieldRawLen("data", d.BitsLeft())
+	})
+
+	// chunks are padded to even size
+	if size%2 != 0 && d.BitsLeft() >= 8 {
+		d.FieldRawLen("padding", 8)
+	}
+}
+
+func dffDecodeChunks(d *decode.D) {
+	d.FieldStructArrayLoop("chunks", "chunk", func() bool { return d.BitsLeft() >= 12*8 }, dffDecodeChunk)
+}
+
+func dffDecode(d *decode.D, _ any) any {
+	d.FieldUTF8("id", 4, d.AssertStr("FRM8"))
+	size := int64(d.FieldU64("size"))
+	if size < 0 || size*8 > d.BitsLeft() {
+		d.Fatalf("form size %d outside buffer", size)
+	}
+	d.FramedFn(size*8, dffChunkFns["FRM8"])
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package dsd
+
+// https://dsd-guide.com/sites/default/files/white-papers/DSFFileFormatSpec_E.pdf
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed dsf.jq
+var dsfFS embed.FS
+
+var dsfID3v2Format decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.DSF,
+		Description: "DSD Stream File",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    dsfDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.ID3V2}, Group: &dsfID3v2Format},
+		},
+		Functions: []string{"_help"},
+	})
+	interp.RegisterFS(dsfFS)
+}
+
+var dsfChannelTypeNames = scalar.UToSymStr{
+	1: "mono",
+	2: "stereo",
+	3: "3_channels",
+	4: "quad",
+	5: "4_channels",
+	6: "5_channels",
+	7: "5.1_channels",
+}
+
+var dsfFormatIDNames = scalar.UToSymStr{
+	0: "dsd_raw",
+}
+
+func dsfDecode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	var metadataPointer uint64
+	d.FieldStruct("dsd", func(d *decode.D) {
+		d.FieldUTF8("id", 4, d.AssertStr("DSD "))
+		d.FieldU64("size", d.AssertU(28))
+		d.FieldU64("total_file_size")
+		metadataPointer = d.FieldU64("metadata_pointer")
+	})
+
+	d.FieldStruct("fmt", func(d *decode.D) {
+		d.FieldUTF8("id", 4, d.AssertStr("fmt "))
+		size := d.FieldU64("size")
+		if size < 12 {
+			d.Fatalf("invalid fmt chunk size %d", size)
+		}
+		d.FramedFn(int64(size-12)*8, func(d *decode.D) {
+			d.FieldU32("format_version")
+			d.FieldU32("format_id", dsfFormatIDNames)
+			d.FieldU32("channel_type", dsfChannelTypeNames)
+			d.FieldU32("channel_num")
+			d.FieldU32("sampling_frequency")
+			d.FieldU32("bits_per_sample", d.AssertU(1, 8))
+			d.FieldU64("sample_count")
+			d.FieldU32("block_size_per_channel")
+			d.FieldU32("reserved")
+		})
+	})
+
+	d.FieldStruct("data", func(d *decode.D) {
+		d.FieldUTF8("id", 4, d.AssertStr("data"))
+		size := d.FieldU64("size")
+		if size < 12 {
+			d.Fatalf("invalid data chunk size %d", size)
+		}
+		// samples are interleaved in blocks of block_size_per_channel bytes per channel
+		d.FieldRawLen("samples", int64(size-12)*8)
+	})
+
+	if metadataPointer != 0 && int64(metadataPointer)*8 == d.Pos() {
+		d.FieldFormat("metadata", dsfID3v2Format, nil)
+	}
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+
+	return nil
+}
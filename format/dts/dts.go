@@ -0,0 +1,299 @@
+package dts
+
+// https://www.etsi.org/deliver/etsi_ts/102100_102199/102114/01.06.01_60/ts_102114v010601p.pdf
+// https://github.com/FFmpeg/FFmpeg/blob/master/libavcodec/dca_core.c
+// https://github.com/FFmpeg/FFmpeg/blob/master/libavcodec/dca_exss.c
+
+// TODO: 14 bit and little endian variants
+// TODO: asset descriptors
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed dts.jq
+var dtsFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.DTS,
+		ProbeOrder:  format.ProbeOrderBinFuzzy, // only sync word is fixed
+		Description: "DTS audio",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    dtsDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(dtsFS)
+}
+
+const (
+	syncCore      = 0x7ffe8001
+	syncSubstream = 0x64582025
+)
+
+var syncNames = scalar.UToSymStr{
+	syncCore:      "core",
+	syncSubstream: "substream",
+}
+
+var frameTypeNames = scalar.BoolToSymStr{
+	true:  "normal",
+	false: "termination",
+}
+
+var amodeNames = scalar.UToScalar{
+	0:  {Sym: "mono", Description: "A"},
+	1:  {Sym: "dual_mono", Description: "A + B"},
+	2:  {Sym: "stereo", Description: "L + R"},
+	3:  {Sym: "stereo_sum_difference", Description: "(L+R) + (L-R)"},
+	4:  {Sym: "stereo_total", Description: "LT + RT"},
+	5:  {Sym: "3", Description: "C + L + R"},
+	6:  {Sym: "2_1", Description: "L + R + S"},
+	7:  {Sym: "3_1", Description: "C + L + R + S"},
+	8:  {Sym: "2_2", Description: "L + R + SL + SR"},
+	9:  {Sym: "3_2", Description: "C + L + R + SL + SR"},
+	10: {Sym: "4_2", Description: "CL + CR + L + R + SL + SR"},
+	11: {Sym: "3_3_ov", Description: "C + L + R + LR + RR + OV"},
+	12: {Sym: "6_front_rear", Description: "CF + CR + LF + RF + LR + RR"},
+	13: {Sym: "5_2", Description: "CL + C + CR + L + R + SL + SR"},
+	14: {Sym: "4_4", Description: "CL + CR + L + R + SL1 + SL2 + SR1 + SR2"},
+	15: {Sym: "5_3", Description: "CL + C + CR + L + R + SL + S + SR"},
+}
+
+var sampleRateMap = scalar.UToSymU{
+	1:  8000,
+	2:  16000,
+	3:  32000,
+	6:  11025,
+	7:  22050,
+	8:  44100,
+	11: 12000,
+	12: 24000,
+	13: 48000,
+}
+
+var bitRateMap = scalar.UToScalar{
+	0:  {Sym: uint64(32000)},
+	1:  {Sym: uint64(56000)},
+	2:  {Sym: uint64(64000)},
+	3:  {Sym: uint64(96000)},
+	4:  {Sym: uint64(112000)},
+	5:  {Sym: uint64(128000)},
+	6:  {Sym: uint64(192000)},
+	7:  {Sym: uint64(224000)},
+	8:  {Sym: uint64(256000)},
+	9:  {Sym: uint64(320000)},
+	10: {Sym: uint64(384000)},
+	11: {Sym: uint64(448000)},
+	12: {Sym: uint64(512000)},
+	13: {Sym: uint64(576000)},
+	14: {Sym: uint64(640000)},
+	15: {Sym: uint64(768000)},
+	16: {Sym: uint64(960000)},
+	17: {Sym: uint64(1024000)},
+	18: {Sym: uint64(1152000)},
+	19: {Sym: uint64(1280000)},
+	20: {Sym: uint64(1344000)},
+	21: {Sym: uint64(1408000)},
+	22: {Sym: uint64(1411200)},
+	23: {Sym: uint64(1472000)},
+	24: {Sym: uint64(1536000)},
+	25: {Sym: uint64(1920000)},
+	26: {Sym: uint64(2048000)},
+	27: {Sym: uint64(3072000)},
+	28: {Sym: uint64(3840000)},
+	29: {Sym: "open"},
+	30: {Sym: "variable"},
+	31: {Sym: "lossless"},
+}
+
+var extAudioIDNames = scalar.UToScalar{
+	0: {Sym: "xch", Description: "Channel extension"},
+	2: {Sym: "x96", Description: "Frequency extension"},
+	6: {Sym: "xxch", Description: "Channel extension"},
+}
+
+var lffNames = scalar.UToSymStr{
+	0: "none",
+	1: "interpolation_128",
+	2: "interpolation_64",
+	3: "invalid",
+}
+
+var pcmrMap = scalar.UToScalar{
+	0: {Sym: uint64(16)},
+	1: {Sym: uint64(16), Description: "ES"},
+	2: {Sym: uint64(20)},
+	3: {Sym: uint64(20), Description: "ES"},
+	5: {Sym: uint64(24), Description: "ES"},
+	6: {Sym: uint64(24)},
+}
+
+var refClockMap = scalar.UToSymU{
+	0: 32000,
+	1: 44100,
+	2: 48000,
+}
+
+func decodeCore(d *decode.D, frameStart int64) {
+	var frameBits int64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldBool("ftype", frameTypeNames)
+		d.FieldU5("short", scalar.ActualUAdd(1))
+		cpf := d.FieldBool("cpf")
+		d.FieldU7("nblks", scalar.ActualUAdd(1))
+		frameBytes := int64(d.FieldU14("fsize", scalar.ActualUAdd(1)))
+		if frameBytes < 96 {
+			d.Fatalf("invalid frame size %d", frameBytes)
+		}
+		frameBits = frameBytes * 8
+		if frameStart+frameBits > d.Len() {
+			d.Fatalf("frame size %d outside buffer", frameBytes)
+		}
+		d.FieldU6("amode", amodeNames)
+		d.FieldU4("sfreq", sampleRateMap)
+		d.FieldU5("rate", bitRateMap)
+		d.FieldU1("fixed_bit")
+		d.FieldBool("dynf")
+		d.FieldBool("timef")
+		d.FieldBool("auxf")
+		d.FieldBool("hdcd")
+		d.FieldU3("ext_audio_id", extAudioIDNames)
+		d.FieldBool("ext_audio")
+		d.FieldBool("aspf")
+		d.FieldU2("lff", lffNames)
+		d.FieldBool("hflag")
+		if cpf {
+			d.FieldU16("hcrc", scalar.ActualHex)
+		}
+		d.FieldBool("filts")
+		d.FieldU4("vernum")
+		d.FieldU2("chist")
+		d.FieldU3("pcmr", pcmrMap)
+		d.FieldBool("sumf")
+		d.FieldBool("sums")
+		d.FieldU4("dialnorm")
+	})
+
+	// audio data has primary audio and optional core extensions
+	d.FieldRawLen("audio_data", frameStart+frameBits-d.Pos())
+}
+
+func decodeSubstream(d *decode.D, frameStart int64) {
+	var headerBits int64
+	var substreamBits int64
+	var assetSizes []int64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldU8("user_defined_bits")
+		ssIndex := d.FieldU2("extss_index")
+		wideHeader := d.FieldBool("header_size_type")
+		headerSizeBits, substreamSizeBits := 8, 16
+		if wideHeader {
+			headerSizeBits, substreamSizeBits = 12, 20
+		}
+		headerSize := d.FieldU("extss_header_size", headerSizeBits, scalar.ActualUAdd(1))
+		substreamSize := d.FieldU("extss_fsize", substreamSizeBits, scalar.ActualUAdd(1))
+		headerBits = int64(headerSize) * 8
+		substreamBits = int64(substreamSize) * 8
+		if headerBits > substreamBits || frameStart+substreamBits > d.Len() {
+			d.Fatalf("substream size %d outside buffer", substreamSize)
+		}
+
+		presentations := uint64(1)
+		assets := uint64(1)
+		if d.FieldBool("static_fields_present") {
+			d.FieldU2("ref_clock_code", refClockMap)
+			d.FieldU3("extss_frame_duration", scalar.ActualUFn(func(v uint64) uint64 { return (v + 1) * 512 }))
+			if d.FieldBool("timestamp_flag") {
+				d.FieldU32("timestamp")
+				d.FieldU4("lsb_timestamp")
+			}
+			presentations = d.FieldU3("num_presentations", scalar.ActualUAdd(1))
+			assets = d.FieldU3("num_assets", scalar.ActualUAdd(1))
+			activeExSSMasks := make([]uint64, presentations)
+			d.FieldArray("active_extss_masks", func(d *decode.D) {
+				for i := uint64(0); i < presentations; i++ {
+					activeExSSMasks[i] = d.FieldU("active_extss_mask", int(ssIndex)+1, scalar.ActualBin)
+				}
+			})
+			d.FieldArray("active_asset_masks", func(d *decode.D) {
+				for i := uint64(0); i < presentations; i++ {
+					for j := uint64(0); j <= ssIndex; j++ {
+						if activeExSSMasks[i]>>j&1 != 0 {
+							d.FieldU8("active_asset_mask", scalar.ActualBin)
+						}
+					}
+				}
+			})
+			if d.FieldBool("mix_metadata_enabled") {
+				d.FieldU2("mix_metadata_adj_level")
+				maskBits := d.FieldU2("bits4_mix_out_mask", scalar.ActualUFn(func(v uint64) uint64 { return (v + 1) << 2 }))
+				mixOutConfigs := d.FieldU2("num_mix_out_configs", scalar.ActualUAdd(1))
+				d.FieldArray("mix_out_channel_masks", func(d *decode.D) {
+					for i := uint64(0); i < mixOutConfigs; i++ {
+						d.FieldU("mix_out_channel_mask", int(maskBits), scalar.ActualBin)
+					}
+				})
+			}
+		}
+		d.FieldArray("asset_sizes", func(d *decode.D) {
+			for i := uint64(0); i < assets; i++ {
+				assetSizes = append(assetSizes, int64(d.FieldU("asset_size", substreamSizeBits, scalar.ActualUAdd(1))))
+			}
+		})
+
+		if left := frameStart + headerBits - d.Pos(); left > 0 {
+			d.FieldRawLen("asset_descriptors", left)
+		} else if left < 0 {
+			d.Fatalf("substream header outside header size")
+		}
+	})
+
+	d.FieldArray("assets", func(d *decode.D) {
+		for _, size := range assetSizes {
+			if size*8 > frameStart+substreamBits-d.Pos() {
+				break
+			}
+			d.FieldRawLen("asset", size*8)
+		}
+	})
+	if left := frameStart + substreamBits - d.Pos(); left > 0 {
+		d.FieldRawLen("unknown", left)
+	}
+}
+
+func dtsDecode(d *decode.D, _ any) any {
+	frameCount := 0
+	d.FieldArray("frames", func(d *decode.D) {
+		for d.BitsLeft() >= 32 {
+			sync := d.PeekBits(32)
+			if sync != syncCore && sync != syncSubstream {
+				break
+			}
+			d.FieldStruct("frame", func(d *decode.D) {
+				frameStart := d.Pos()
+				d.FieldU32("sync", syncNames, scalar.ActualHex)
+				switch sync {
+				case syncCore:
+					decodeCore(d, frameStart)
+				case syncSubstream:
+					decodeSubstream(d, frameStart)
+				}
+			})
+			frameCount++
+		}
+	})
+	if frameCount == 0 {
+		d.Fatalf("no frames found")
+	}
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("trailing", d.BitsLeft())
+	}
+
+	return nil
+}
@@ -74,6 +74,8 @@ var typeNames = scalar.URangeToScalar{
 }
 
 const (
+	EM_386    = 0x03
+	EM_ARM    = 0x28
 	EM_X86_64 = 0x3e
 	EM_ARM64  = 0xb7
 )
@@ -82,7 +84,7 @@ var machineNames = scalar.UToScalar{
 	0x00:      {Description: "No specific instruction set"},
 	0x01:      {Sym: "we_32100", Description: "AT&T WE 32100"},
 	0x02:      {Sym: "sparc", Description: "SPARC"},
-	0x03:      {Sym: "x86", Description: "x86"},
+	EM_386:    {Sym: "x86", Description: "x86"},
 	0x04:      {Sym: "m68k", Description: "Motorola 68000 (M68k)"},
 	0x05:      {Sym: "m88k", Description: "Motorola 88000 (M88k)"},
 	0x06:      {Sym: "intel_mcu", Description: "Intel MCU"},
@@ -101,7 +103,7 @@ var machineNames = scalar.UToScalar{
 	0x25:      {Sym: "fr20", Description: "Fujitsu FR20"},
 	0x26:      {Sym: "trw_rh_32", Description: "TRW RH-32"},
 	0x27:      {Sym: "motorola_rce", Description: "Motorola RCE"},
-	0x28:      {Sym: "arm", Description: "ARM (up to ARMv7/Aarch32)"},
+	EM_ARM:    {Sym: "arm", Description: "ARM (up to ARMv7/Aarch32)"},
 	0x29:      {Sym: "alpha", Description: "Digital Alpha"},
 	0x2a:      {Sym: "superh", Description: "SuperH"},
 	0x2b:      {Sym: "sparc_v9", Description: "SPARC Version 9"},
@@ -581,6 +583,10 @@ func elfReadSectionHeaders(d *decode.D, ec *elfContext) {
 	}
 
 	ec.strTabMap = map[string]string{}
+	// core files usually have no section headers
+	if ec.shNum == 0 {
+		return
+	}
 	var shStrTab string
 	if ec.shStrNdx >= len(ec.sections) {
 		d.Fatalf("can't find shStrNdx %d", ec.shStrNdx)
@@ -701,32 +707,39 @@ func elfDecodeProgramHeader(d *decode.D, ec elfContext) {
 		})
 	}
 
+	var typ uint64
 	var offset uint64
 	var size uint64
+	var align uint64
 
 	switch ec.archBits {
 	case 32:
-		d.FieldU32("type", phTypeNames)
+		typ = d.FieldU32("type", phTypeNames)
 		offset = d.FieldU("offset", ec.archBits, scalar.ActualHex)
 		d.FieldU("vaddr", ec.archBits, scalar.ActualHex)
 		d.FieldU("paddr", ec.archBits, scalar.ActualHex)
 		size = d.FieldU32("filesz")
 		d.FieldU32("memsz")
 		pFlags(d)
-		d.FieldU32("align")
+		align = d.FieldU32("align")
 	case 64:
-		d.FieldU32("type", phTypeNames)
+		typ = d.FieldU32("type", phTypeNames)
 		pFlags(d)
 		offset = d.FieldU("offset", ec.archBits, scalar.ActualHex)
 		d.FieldU("vaddr", ec.archBits, scalar.ActualHex)
 		d.FieldU("paddr", ec.archBits, scalar.ActualHex)
 		size = d.FieldU64("filesz")
 		d.FieldU64("memsz")
-		d.FieldU64("align")
+		align = d.FieldU64("align")
 	}
 
 	d.RangeFn(int64(offset*8), int64(size*8), func(d *decode.D) {
-		d.FieldRawLen("data", d.BitsLeft())
+		switch typ {
+		case PT_NOTE:
+			d.FieldArray("notes", func(d *decode.D) { elfDecodeNotes(d, ec, int64(align)) })
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
 	})
 }
 
@@ -836,6 +849,7 @@ func elfDecodeSectionHeader(d *decode.D, ec elfContext, sh sectionHeader) {
 	var size int64
 	var entSize int64
 	var typ uint64
+	var addrAlign uint64
 
 	switch ec.archBits {
 	case 32:
@@ -847,7 +861,7 @@ func elfDecodeSectionHeader(d *decode.D, ec elfContext, sh sectionHeader) {
 		size = int64(d.FieldU32("size", scalar.ActualHex) * 8)
 		d.FieldU32("link")
 		d.FieldU32("info")
-		d.FieldU32("addralign")
+		addrAlign = d.FieldU32("addralign")
 		entSize = int64(d.FieldU32("entsize") * 8)
 	case 64:
 		d.FieldU32("name", strTable(ec.strTabMap[STRTAB_SHSTRTAB]))
@@ -858,7 +872,7 @@ func elfDecodeSectionHeader(d *decode.D, ec elfContext, sh sectionHeader) {
 		size = int64(d.FieldU64("size") * 8)
 		d.FieldU32("link")
 		d.FieldU32("info")
-		d.FieldU64("addralign")
+		addrAlign = d.FieldU64("addralign")
 		entSize = int64(d.FieldU64("entsize") * 8)
 	}
 
@@ -893,6 +907,10 @@ func elfDecodeSectionHeader(d *decode.D, ec elfContext, sh sectionHeader) {
 		d.FieldStruct("gnu_hash", func(d *decode.D) {
 			elfDecodeGNUHash(d, ec, size, ec.strTabMap[STRTAB_DYNSTR])
 		})
+	case SHT_NOTE:
+		d.FramedFn(size, func(d *decode.D) {
+			d.FieldArray("notes", func(d *decode.D) { elfDecodeNotes(d, ec, int64(addrAlign)) })
+		})
 	default:
 		d.FieldRawLen("data", size)
 	}
@@ -0,0 +1,368 @@
+//nolint:revive
+package elf
+
+// https://man7.org/linux/man-pages/man5/elf.5.html
+// https://github.com/torvalds/linux/blob/master/include/uapi/linux/elfcore.h
+// https://github.com/torvalds/linux/blob/master/include/uapi/linux/auxvec.h
+// https://github.com/torvalds/linux/blob/master/fs/binfmt_elf.c
+
+import (
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const (
+	PT_NOTE = 4
+)
+
+const (
+	NOTE_NAME_CORE  = "CORE"
+	NOTE_NAME_LINUX = "LINUX"
+	NOTE_NAME_GNU   = "GNU"
+)
+
+const (
+	NT_PRSTATUS   = 1
+	NT_FPREGSET   = 2
+	NT_PRPSINFO   = 3
+	NT_TASKSTRUCT = 4
+	NT_AUXV       = 6
+	NT_SIGINFO    = 0x53494749
+	NT_FILE       = 0x46494c45
+)
+
+var coreNoteTypeNames = scalar.UToSymStr{
+	NT_PRSTATUS:   "prstatus",
+	NT_FPREGSET:   "fpregset",
+	NT_PRPSINFO:   "prpsinfo",
+	NT_TASKSTRUCT: "taskstruct",
+	NT_AUXV:       "auxv",
+	NT_SIGINFO:    "siginfo",
+	NT_FILE:       "file",
+}
+
+var linuxNoteTypeNames = scalar.UToSymStr{
+	0x46e62b7f: "prxfpreg",
+	0x200:      "386_tls",
+	0x201:      "386_ioperm",
+	0x202:      "x86_xstate",
+	0x204:      "x86_shstk",
+	0x205:      "x86_xsave_layout",
+	0x400:      "arm_vfp",
+	0x401:      "arm_tls",
+	0x402:      "arm_hw_break",
+	0x403:      "arm_hw_watch",
+	0x404:      "arm_system_call",
+	0x405:      "arm_sve",
+	0x406:      "arm_pac_mask",
+	0x409:      "arm_tagged_addr_ctrl",
+}
+
+const (
+	NT_GNU_ABI_TAG  = 1
+	NT_GNU_BUILD_ID = 3
+)
+
+var gnuNoteTypeNames = scalar.UToSymStr{
+	NT_GNU_ABI_TAG:  "abi_tag",
+	2:               "hwcap",
+	NT_GNU_BUILD_ID: "build_id",
+	4:               "gold_version",
+	5:               "property_type_0",
+}
+
+var gnuABITagOSNames = scalar.UToSymStr{
+	0: "linux",
+	1: "hurd",
+	2: "solaris",
+	3: "freebsd",
+}
+
+const AT_NULL = 0
+
+var auxvTypeNames = scalar.UToSymStr{
+	AT_NULL: "null",
+	1:       "ignore",
+	2:       "execfd",
+	3:       "phdr",
+	4:       "phent",
+	5:       "phnum",
+	6:       "pagesz",
+	7:       "base",
+	8:       "flags",
+	9:       "entry",
+	10:      "notelf",
+	11:      "uid",
+	12:      "euid",
+	13:      "gid",
+	14:      "egid",
+	15:      "platform",
+	16:      "hwcap",
+	17:      "clktck",
+	23:      "secure",
+	24:      "base_platform",
+	25:      "random",
+	26:      "hwcap2",
+	27:      "rseq_feature_size",
+	28:      "rseq_align",
+	29:      "hwcap3",
+	30:      "hwcap4",
+	31:      "execfn",
+	32:      "sysinfo",
+	33:      "sysinfo_ehdr",
+	51:      "minsigstksz",
+}
+
+var signalNames = scalar.UToSymStr{
+	1:  "sighup",
+	2:  "sigint",
+	3:  "sigquit",
+	4:  "sigill",
+	5:  "sigtrap",
+	6:  "sigabrt",
+	7:  "sigbus",
+	8:  "sigfpe",
+	9:  "sigkill",
+	10: "sigusr1",
+	11: "sigsegv",
+	12: "sigusr2",
+	13: "sigpipe",
+	14: "sigalrm",
+	15: "sigterm",
+	16: "sigstkflt",
+	17: "sigchld",
+	18: "sigcont",
+	19: "sigstop",
+	20: "sigtstp",
+	21: "sigttin",
+	22: "sigttou",
+	23: "sigurg",
+	24: "sigxcpu",
+	25: "sigxfsz",
+	26: "sigvtalrm",
+	27: "sigprof",
+	28: "sigwinch",
+	29: "sigio",
+	30: "sigpwr",
+	31: "sigsys",
+}
+
+// general purpose registers in prstatus pr_reg
+var prstatusRegNames = map[int][]string{
+	EM_386: {
+		"ebx", "ecx", "edx", "esi", "edi", "ebp", "eax", "ds", "es", "fs", "gs",
+		"orig_eax", "eip", "cs", "eflags", "esp", "ss",
+	},
+	EM_X86_64: {
+		"r15", "r14", "r13", "r12", "rbp", "rbx", "r11", "r10", "r9", "r8", "rax",
+		"rcx", "rdx", "rsi", "rdi", "orig_rax", "rip", "cs", "eflags", "rsp", "ss",
+		"fs_base", "gs_base", "ds", "es", "fs", "gs",
+	},
+	EM_ARM: {
+		"r0", "r1", "r2", "r3", "r4", "r5", "r6", "r7", "r8", "r9", "r10", "fp",
+		"ip", "sp", "lr", "pc", "cpsr", "orig_r0",
+	},
+	EM_ARM64: {
+		"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7", "x8", "x9", "x10", "x11",
+		"x12", "x13", "x14", "x15", "x16", "x17", "x18", "x19", "x20", "x21", "x22",
+		"x23", "x24", "x25", "x26", "x27", "x28", "x29", "x30", "sp", "pc", "pstate",
+	},
+}
+
+func elfDecodeTimeval(d *decode.D, ec elfContext) {
+	d.FieldS("sec", ec.archBits)
+	d.FieldS("usec", ec.archBits)
+}
+
+func elfDecodeNotePrstatus(d *decode.D, ec elfContext) {
+	d.FieldStruct("info", func(d *decode.D) {
+		d.FieldU32("signo", signalNames)
+		d.FieldS32("code")
+		d.FieldS32("errno")
+	})
+	d.FieldU16("cursig", signalNames)
+	d.FieldU16("pad0")
+	d.FieldU("sigpend", ec.archBits, scalar.ActualHex)
+	d.FieldU("sighold", ec.archBits, scalar.ActualHex)
+	d.FieldS32("pid")
+	d.FieldS32("ppid")
+	d.FieldS32("pgrp")
+	d.FieldS32("sid")
+	d.FieldStruct("utime", func(d *decode.D) { elfDecodeTimeval(d, ec) })
+	d.FieldStruct("stime", func(d *decode.D) { elfDecodeTimeval(d, ec) })
+	d.FieldStruct("cutime", func(d *decode.D) { elfDecodeTimeval(d, ec) })
+	d.FieldStruct("cstime", func(d *decode.D) { elfDecodeTimeval(d, ec) })
+
+	// pr_reg is followed by a 32 bit pr_fpvalid padded to word size
+	regsLen := d.BitsLeft() - int64(ec.archBits)
+	names := prstatusRegNames[ec.machine]
+	if int64(len(names)*ec.archBits) == regsLen {
+		d.FieldStruct("reg", func(d *decode.D) {
+			for _, n := range names {
+				d.FieldU(n, ec.archBits, scalar.ActualHex)
+			}
+		})
+	} else if regsLen >= 0 {
+		d.FieldArray("reg", func(d *decode.D) {
+			for i := int64(0); i < regsLen/int64(ec.archBits); i++ {
+				d.FieldU("reg", ec.archBits, scalar.ActualHex)
+			}
+		})
+	}
+	d.FieldS32("fpvalid")
+	if !d.End() {
+		d.FieldRawLen("pad1", d.BitsLeft())
+	}
+}
+
+func elfDecodeNotePrpsinfo(d *decode.D, ec elfContext) {
+	d.FieldS8("state")
+	d.FieldUTF8("sname", 1)
+	d.FieldU8("zomb")
+	d.FieldS8("nice")
+	if ec.archBits == 64 {
+		d.FieldU32("pad0")
+	}
+	d.FieldU("flag", ec.archBits, scalar.ActualHex)
+	// __kernel_uid_t is 16 bit on most 32 bit architectures
+	uidBits := 32
+	if ec.archBits == 32 {
+		uidBits = 16
+	}
+	d.FieldU("uid", uidBits)
+	d.FieldU("gid", uidBits)
+	d.FieldS32("pid")
+	d.FieldS32("ppid")
+	d.FieldS32("pgrp")
+	d.FieldS32("sid")
+	d.FieldUTF8NullFixedLen("fname", 16)
+	d.FieldUTF8NullFixedLen("psargs", 80)
+}
+
+func elfDecodeNoteSiginfo(d *decode.D) {
+	d.FieldU32("signo", signalNames)
+	d.FieldS32("errno")
+	d.FieldS32("code")
+	d.FieldRawLen("fields", d.BitsLeft())
+}
+
+func elfDecodeNoteAuxv(d *decode.D, ec elfContext) {
+	d.FieldArray("entries", func(d *decode.D) {
+		for !d.End() {
+			var typ uint64
+			d.FieldStruct("entry", func(d *decode.D) {
+				typ = d.FieldU("type", ec.archBits, auxvTypeNames)
+				d.FieldU("value", ec.archBits, scalar.ActualHex)
+			})
+			if typ == AT_NULL {
+				break
+			}
+		}
+	})
+}
+
+func elfDecodeNoteFile(d *decode.D, ec elfContext) {
+	count := d.FieldU("count", ec.archBits)
+	pageSize := d.FieldU("page_size", ec.archBits)
+	if count > uint64(d.BitsLeft()/int64(ec.archBits*3)) {
+		d.Fatalf("file count %d does not fit in note", count)
+	}
+
+	d.FieldArray("mappings", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("mapping", func(d *decode.D) {
+				start := d.FieldU("start", ec.archBits, scalar.ActualHex)
+				end := d.FieldU("end", ec.archBits, scalar.ActualHex)
+				ofs := d.FieldU("file_ofs", ec.archBits, scalar.Description("pages"))
+				d.FieldValueU("file_offset", ofs*pageSize, scalar.ActualHex)
+				d.FieldValueU("size", end-start)
+			})
+		}
+	})
+	d.FieldArray("filenames", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldUTF8Null("filename")
+		}
+	})
+}
+
+func elfDecodeNoteGNUABITag(d *decode.D) {
+	d.FieldU32("os", gnuABITagOSNames)
+	d.FieldU32("major")
+	d.FieldU32("minor")
+	d.FieldU32("subminor")
+}
+
+func elfDecodeNote(d *decode.D, ec elfContext, align int64) {
+	noteStart := d.Pos()
+	nameSz := d.FieldU32("namesz")
+	descSz := d.FieldU32("descsz")
+	var name string
+	typStart := d.Pos()
+	d.SeekRel(32)
+	if nameSz > 0 {
+		name = d.UTF8NullFixedLen(int(nameSz))
+	}
+	d.SeekAbs(typStart)
+
+	var typ uint64
+	switch name {
+	case NOTE_NAME_CORE:
+		typ = d.FieldU32("type", coreNoteTypeNames, scalar.ActualHex)
+	case NOTE_NAME_LINUX:
+		typ = d.FieldU32("type", linuxNoteTypeNames, scalar.ActualHex)
+	case NOTE_NAME_GNU:
+		typ = d.FieldU32("type", gnuNoteTypeNames, scalar.ActualHex)
+	default:
+		typ = d.FieldU32("type", scalar.ActualHex)
+	}
+
+	// name and desc are padded to alignment relative to start of note
+	alignPad := func() int64 {
+		n := (d.Pos() - noteStart) / 8
+		return ((align - n%align) % align) * 8
+	}
+	if nameSz > 0 {
+		d.FieldUTF8NullFixedLen("name", int(nameSz))
+		if pad := alignPad(); pad > 0 {
+			d.FieldRawLen("name_pad", pad)
+		}
+	}
+
+	if descSz == 0 {
+		return
+	}
+	d.FramedFn(int64(descSz)*8, func(d *decode.D) {
+		switch {
+		case name == NOTE_NAME_CORE && typ == NT_PRSTATUS:
+			d.FieldStruct("desc", func(d *decode.D) { elfDecodeNotePrstatus(d, ec) })
+		case name == NOTE_NAME_CORE && typ == NT_PRPSINFO:
+			d.FieldStruct("desc", func(d *decode.D) { elfDecodeNotePrpsinfo(d, ec) })
+		case name == NOTE_NAME_CORE && typ == NT_SIGINFO:
+			d.FieldStruct("desc", elfDecodeNoteSiginfo)
+		case name == NOTE_NAME_CORE && typ == NT_AUXV:
+			d.FieldStruct("desc", func(d *decode.D) { elfDecodeNoteAuxv(d, ec) })
+		case name == NOTE_NAME_CORE && typ == NT_FILE:
+			d.FieldStruct("desc", func(d *decode.D) { elfDecodeNoteFile(d, ec) })
+		case name == NOTE_NAME_GNU && typ == NT_GNU_ABI_TAG:
+			d.FieldStruct("desc", elfDecodeNoteGNUABITag)
+		case name == NOTE_NAME_GNU && typ == NT_GNU_BUILD_ID:
+			d.FieldRawLen("desc", d.BitsLeft(), scalar.RawHex)
+		default:
+			d.FieldRawLen("desc", d.BitsLeft())
+		}
+	})
+	if pad := alignPad(); pad > 0 && d.BitsLeft() >= pad {
+		d.FieldRawLen("desc_pad", pad)
+	}
+}
+
+func elfDecodeNotes(d *decode.D, ec elfContext, align int64) {
+	// notes are 4 byte aligned except for 8 byte aligned gnu property notes
+	if align != 8 {
+		align = 4
+	}
+	for !d.End() {
+		d.FieldStruct("note", func(d *decode.D) { elfDecodeNote(d, ec, align) })
+	}
+}
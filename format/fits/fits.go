@@ -0,0 +1,269 @@
+package fits
+
+// https://fits.gsfc.nasa.gov/fits_standard.html
+// https://fits.gsfc.nasa.gov/standard40/fits_standard40aa-le.pdf
+
+// TODO: decode ASCII and binary table rows using TFORMn
+// TODO: HIERARCH keywords
+
+import (
+	"embed"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed fits.jq
+var fitsFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.FITS,
+		Description: "Flexible Image Transport System",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    fitsDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(fitsFS)
+}
+
+const (
+	blockBytes   = 2880
+	cardBytes    = 80
+	keywordBytes = 8
+)
+
+var bitpixNames = scalar.SToSymStr{
+	8:   "uint8",
+	16:  "int16",
+	32:  "int32",
+	64:  "int64",
+	-32: "float32",
+	-64: "float64",
+}
+
+// length of value part of value/comment area, rest is "/ comment"
+func cardValueLen(s string) int {
+	i := 0
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	if i < len(s) && s[i] == '\'' {
+		// string, '' is an escaped quote
+		i++
+		for i < len(s) {
+			if s[i] == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					i += 2
+					continue
+				}
+				i++
+				break
+			}
+			i++
+		}
+	}
+	if j := strings.IndexByte(s[i:], '/'); j != -1 {
+		return i + j
+	}
+	return len(s)
+}
+
+// trimmed value as actual and string, logical, integer or float as sym
+var cardValueMapper = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	v := strings.TrimSpace(s.ActualStr())
+	s.Actual = v
+	switch {
+	case v == "":
+		// undefined value
+	case v[0] == '\'':
+		v = strings.TrimSuffix(v[1:], "'")
+		// trailing spaces are not significant
+		s.Sym = strings.TrimRight(strings.ReplaceAll(v, "''", "'"), " ")
+	case v == "T":
+		s.Sym = true
+	case v == "F":
+		s.Sym = false
+	default:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			s.Sym = n
+		} else if f, err := strconv.ParseFloat(strings.NewReplacer("D", "E", "d", "e").Replace(v), 64); err == nil {
+			s.Sym = f
+		}
+	}
+	return s, nil
+})
+
+var cardCommentMapper = scalar.ActualStrFn(func(s string) string {
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s), "/"))
+})
+
+func isValueCard(keyword string, indicator string) bool {
+	switch keyword {
+	case "CONTINUE":
+		return true
+	case "", "COMMENT", "HISTORY":
+		return false
+	default:
+		return indicator == "= "
+	}
+}
+
+type header struct {
+	values map[string]any
+}
+
+func (h header) int(keyword string, defaultV int64) int64 {
+	if v, ok := h.values[keyword].(int64); ok {
+		return v
+	}
+	return defaultV
+}
+
+func (h header) bool(keyword string) bool {
+	v, _ := h.values[keyword].(bool)
+	return v
+}
+
+func (h header) str(keyword string) string {
+	v, _ := h.values[keyword].(string)
+	return v
+}
+
+func decodeHeader(d *decode.D, firstKeyword string) header {
+	h := header{values: map[string]any{}}
+
+	seenEnd := false
+	cardI := 0
+	d.FieldStructArrayLoop("cards", "card", func() bool { return !seenEnd }, func(d *decode.D) {
+		keywordMappers := []scalar.Mapper{scalar.ActualTrimSpace}
+		if cardI == 0 {
+			keywordMappers = append(keywordMappers, d.AssertStr(firstKeyword))
+		}
+		cardI++
+		keyword := d.FieldUTF8("keyword", keywordBytes, keywordMappers...)
+		if keyword == "END" {
+			seenEnd = true
+		}
+		indicator := string(d.PeekBytes(2))
+		if !isValueCard(keyword, indicator) {
+			d.FieldUTF8("text", cardBytes-keywordBytes, scalar.ActualTrimSpace)
+			return
+		}
+
+		d.FieldUTF8("value_indicator", 2)
+		rest := string(d.PeekBytes(cardBytes - keywordBytes - 2))
+		valueLen := cardValueLen(rest)
+		v := d.FieldScalarUTF8("value", valueLen, cardValueMapper)
+		if commentLen := len(rest) - valueLen; commentLen > 0 {
+			d.FieldUTF8("comment", commentLen, cardCommentMapper)
+		}
+		if _, ok := h.values[keyword]; !ok && keyword != "CONTINUE" {
+			h.values[keyword] = v.Sym
+		}
+	})
+	if padBits := (blockBytes*8 - d.Pos()%(blockBytes*8)) % (blockBytes * 8); padBits > 0 {
+		d.FieldRawLen("padding", padBits)
+	}
+
+	return h
+}
+
+func decodeHDU(d *decode.D, primary bool) {
+	start := d.Pos()
+	firstKeyword := "XTENSION"
+	if primary {
+		firstKeyword = "SIMPLE"
+	}
+
+	var h header
+	d.FieldStruct("header", func(d *decode.D) {
+		h = decodeHeader(d, firstKeyword)
+	})
+
+	hduType := "primary"
+	if !primary {
+		hduType = h.str("XTENSION")
+	}
+	d.FieldValueStr("type", hduType)
+
+	bitpix := h.int("BITPIX", 8)
+	naxis := h.int("NAXIS", 0)
+	pcount := h.int("PCOUNT", 0)
+	gcount := h.int("GCOUNT", 1)
+	// random groups has NAXIS1 = 0
+	randomGroups := primary && h.bool("GROUPS") && h.int("NAXIS1", -1) == 0
+	if randomGroups {
+		d.FieldValueBool("random_groups", true)
+	}
+
+	var axes []int64
+	elements := int64(0)
+	if naxis > 0 {
+		elements = 1
+		for i := int64(1); i <= naxis; i++ {
+			n := h.int("NAXIS"+strconv.FormatInt(i, 10), 0)
+			axes = append(axes, n)
+			if i == 1 && randomGroups {
+				continue
+			}
+			elements *= n
+		}
+	}
+	bitpixAbs := bitpix
+	if bitpixAbs < 0 {
+		bitpixAbs = -bitpixAbs
+	}
+	dataBits := int64(0)
+	if naxis > 0 {
+		dataBits = bitpixAbs * gcount * (pcount + elements)
+	}
+	if dataBits < 0 || dataBits > d.BitsLeft() {
+		d.Fatalf("data size %d bits outside buffer", dataBits)
+	}
+
+	if dataBits == 0 {
+		return
+	}
+	d.FieldStruct("data", func(d *decode.D) {
+		d.FieldValueS("bitpix", bitpix, bitpixNames)
+		d.FieldArray("axes", func(d *decode.D) {
+			for _, n := range axes {
+				d.FieldValueS("axis", n)
+			}
+		})
+		d.FieldValueS("pcount", pcount)
+		d.FieldValueS("gcount", gcount)
+
+		// binary table main data is followed by heap
+		if hduType == "BINTABLE" && pcount > 0 {
+			d.FieldRawLen("array", dataBits-pcount*8)
+			d.FieldRawLen("heap", pcount*8)
+		} else {
+			d.FieldRawLen("array", dataBits)
+		}
+		// last block can be unpadded in broken files
+		padBits := (blockBytes*8 - (d.Pos()-start)%(blockBytes*8)) % (blockBytes * 8)
+		if padBits > d.BitsLeft() {
+			padBits = d.BitsLeft()
+		}
+		if padBits > 0 {
+			d.FieldRawLen("padding", padBits)
+		}
+	})
+}
+
+func fitsDecode(d *decode.D, _ any) any {
+	d.FieldArray("hdus", func(d *decode.D) {
+		d.FieldStruct("hdu", func(d *decode.D) { decodeHDU(d, true) })
+		for d.BitsLeft() >= blockBytes*8 && string(d.PeekBytes(keywordBytes)) == "XTENSION" {
+			d.FieldStruct("hdu", func(d *decode.D) { decodeHDU(d, false) })
+		}
+	})
+
+	return nil
+}
@@ -28,6 +28,11 @@ func init() {
 		Description: "Free Lossless Audio Codec file",
 		Groups:      []string{format.PROBE},
 		DecodeFn:    flacDecode,
+		EncodeFn:    flacEncode,
+		DecodeInArg: format.FlacIn{
+			DecodeResiduals: false,
+			Validate:        false,
+		},
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.FLAC_METADATABLOCKS}, Group: &flacMetadatablocksFormat},
 			{Names: []string{format.FLAC_FRAME}, Group: &flacFrameFormat},
@@ -35,14 +40,65 @@ func init() {
 	})
 }
 
-func flacDecode(d *decode.D, _ any) any {
+// smallest allowed block size except for last frame
+const minimumBlockSize = 16
+
+type flacWarning struct {
+	check      string
+	frameIndex int
+	message    string
+}
+
+// validates stream info and seektable constraints that don't need frames
+func validateMetadata(streamInfo format.FlacStreamInfo, seekpoints []format.FlacSeekpoint) []flacWarning {
+	var ws []flacWarning
+	warnf := func(check string, format string, a ...any) {
+		ws = append(ws, flacWarning{check: check, frameIndex: -1, message: fmt.Sprintf(format, a...)})
+	}
+
+	if streamInfo.MinimumBlockSize < minimumBlockSize {
+		warnf("streaminfo_block_size", "minimum block size %d < %d", streamInfo.MinimumBlockSize, minimumBlockSize)
+	}
+	if streamInfo.MinimumBlockSize > streamInfo.MaximumBlockSize {
+		warnf("streaminfo_block_size", "minimum block size %d > maximum block size %d", streamInfo.MinimumBlockSize, streamInfo.MaximumBlockSize)
+	}
+	// zero means unknown
+	if streamInfo.MinimumFrameSize != 0 && streamInfo.MaximumFrameSize != 0 &&
+		streamInfo.MinimumFrameSize > streamInfo.MaximumFrameSize {
+		warnf("streaminfo_frame_size", "minimum frame size %d > maximum frame size %d", streamInfo.MinimumFrameSize, streamInfo.MaximumFrameSize)
+	}
+	if streamInfo.SampleRate == 0 {
+		warnf("streaminfo_sample_rate", "sample rate is zero")
+	}
+
+	// placeholders are last and other points are in ascending sample number order
+	for i := 1; i < len(seekpoints); i++ {
+		prev, cur := seekpoints[i-1], seekpoints[i]
+		switch {
+		case cur.SampleNumber == SeekpointPlaceholder:
+		case prev.SampleNumber == SeekpointPlaceholder:
+			warnf("seektable_order", "seekpoint %d after placeholder", i)
+		case cur.SampleNumber <= prev.SampleNumber:
+			warnf("seektable_order", "seekpoint %d sample number %d <= %d", i, cur.SampleNumber, prev.SampleNumber)
+		case cur.Offset < prev.Offset:
+			warnf("seektable_order", "seekpoint %d offset %d < %d", i, cur.Offset, prev.Offset)
+		}
+	}
+
+	return ws
+}
+
+func flacDecode(d *decode.D, in any) any {
+	fi, _ := in.(format.FlacIn)
+
 	d.FieldUTF8("magic", 4, d.AssertStr("fLaC"))
 
 	var streamInfo format.FlacStreamInfo
-	var flacFrameIn format.FlacFrameIn
+	flacFrameIn := format.FlacFrameIn{DecodeResiduals: fi.DecodeResiduals}
 	var framesNDecodedSamples uint64
 	var streamTotalSamples uint64
 	var streamDecodedSamples uint64
+	var warnings []flacWarning
 
 	_, v := d.FieldFormat("metadatablocks", flacMetadatablocksFormat, nil)
 	flacMetadatablockOut, ok := v.(format.FlacMetadatablocksOut)
@@ -52,12 +108,16 @@ func flacDecode(d *decode.D, _ any) any {
 	if flacMetadatablockOut.HasStreamInfo {
 		streamInfo = flacMetadatablockOut.StreamInfo
 		streamTotalSamples = streamInfo.TotalSamplesInStream
-		flacFrameIn = format.FlacFrameIn{BitsPerSample: int(streamInfo.BitsPerSample)}
+		flacFrameIn.BitsPerSample = int(streamInfo.BitsPerSample)
+		if fi.Validate {
+			warnings = append(warnings, validateMetadata(streamInfo, flacMetadatablockOut.Seekpoints)...)
+		}
 	}
 
 	md5Samples := md5.New()
 	d.FieldArray("frames", func(d *decode.D) {
-		for d.NotEnd() {
+		for frameIndex := 0; d.NotEnd(); frameIndex++ {
+			frameStart := d.Pos()
 			// flac frame might need some fields from stream info to decode
 			_, v := d.FieldFormat("frame", flacFrameFormat, flacFrameIn)
 			ffo, ok := v.(format.FlacFrameOut)
@@ -65,6 +125,30 @@ func flacDecode(d *decode.D, _ any) any {
 				panic(fmt.Sprintf("expected FlacFrameOut got %#+v", v))
 			}
 
+			if fi.Validate {
+				warnf := func(check string, format string, a ...any) {
+					warnings = append(warnings, flacWarning{check: check, frameIndex: frameIndex, message: fmt.Sprintf(format, a...)})
+				}
+				if !ffo.HeaderCRCValid {
+					warnf("frame_header_crc", "header CRC-8 mismatch")
+				}
+				if !ffo.FooterCRCValid {
+					warnf("frame_footer_crc", "footer CRC-16 mismatch")
+				}
+				if flacMetadatablockOut.HasStreamInfo {
+					// last frame is allowed to be smaller than minimum block size
+					if ffo.Samples > streamInfo.MaximumBlockSize ||
+						(ffo.Samples < streamInfo.MinimumBlockSize && !d.End()) {
+						warnf("frame_block_size", "block size %d outside streaminfo range %d-%d", ffo.Samples, streamInfo.MinimumBlockSize, streamInfo.MaximumBlockSize)
+					}
+					frameSize := uint64((d.Pos() - frameStart) / 8)
+					if (streamInfo.MinimumFrameSize != 0 && frameSize < streamInfo.MinimumFrameSize) ||
+						(streamInfo.MaximumFrameSize != 0 && frameSize > streamInfo.MaximumFrameSize) {
+						warnf("frame_size", "frame size %d outside streaminfo range %d-%d", frameSize, streamInfo.MinimumFrameSize, streamInfo.MaximumFrameSize)
+					}
+				}
+			}
+
 			samplesInFrame := ffo.Samples
 			if streamTotalSamples > 0 {
 				samplesInFrame = mathex.Min(streamTotalSamples-streamDecodedSamples, ffo.Samples)
@@ -84,5 +168,32 @@ func flacDecode(d *decode.D, _ any) any {
 	_ = md5CalcValue.TryScalarFn(d.ValidateBitBuf(streamInfo.MD5), scalar.RawHex)
 	d.FieldValueU("decoded_samples", framesNDecodedSamples)
 
+	if fi.Validate {
+		// zero md5 and total samples means unknown
+		if flacMetadatablockOut.HasStreamInfo && !bytes.Equal(streamInfo.MD5, make([]byte, md5.Size)) &&
+			!bytes.Equal(streamInfo.MD5, md5Samples.Sum(nil)) {
+			warnings = append(warnings, flacWarning{check: "md5", frameIndex: -1, message: "md5 of decoded samples mismatch"})
+		}
+		if streamTotalSamples != 0 && streamTotalSamples != framesNDecodedSamples {
+			warnings = append(warnings, flacWarning{
+				check:      "total_samples",
+				frameIndex: -1,
+				message:    fmt.Sprintf("decoded samples %d != streaminfo total samples %d", framesNDecodedSamples, streamTotalSamples),
+			})
+		}
+
+		d.FieldArray("warnings", func(d *decode.D) {
+			for _, w := range warnings {
+				d.FieldStruct("warning", func(d *decode.D) {
+					d.FieldValueStr("check", w.check)
+					if w.frameIndex != -1 {
+						d.FieldValueU("frame_index", uint64(w.frameIndex))
+					}
+					d.FieldValueStr("message", w.message)
+				})
+			}
+		})
+	}
+
 	return nil
 }
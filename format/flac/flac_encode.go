@@ -0,0 +1,383 @@
+package flac
+
+// Unmodified values are copied as is, modified or new values are encoded from
+// their fields with recalculated lengths and last block flags. Audio frames
+// can only be copied.
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+)
+
+// field writer, errors are kept and reported in order
+type fieldEncoder struct {
+	e   *decode.E
+	obj map[string]any
+	err error
+}
+
+func newFieldEncoder(e *decode.E, v any) (*fieldEncoder, error) {
+	obj, err := interp.EncodeObject(v)
+	if err != nil {
+		return nil, err
+	}
+	return &fieldEncoder{e: e, obj: obj}, nil
+}
+
+func (fe *fieldEncoder) uint(name string) uint64 {
+	if fe.err != nil {
+		return 0
+	}
+	n, err := interp.EncodeUint(fe.obj[name])
+	if err != nil {
+		fe.err = fmt.Errorf("%s: %w", name, err)
+	}
+	return n
+}
+
+func (fe *fieldEncoder) u(name string, nBits int) {
+	n := fe.uint(name)
+	if fe.err != nil {
+		return
+	}
+	if nBits < 64 && n >= 1<<nBits {
+		fe.err = fmt.Errorf("%s: %d does not fit in %d bits", name, n, nBits)
+		return
+	}
+	fe.e.U(nBits, n)
+}
+
+func (fe *fieldEncoder) bool(name string) {
+	if fe.err != nil {
+		return
+	}
+	b, err := interp.EncodeBool(fe.obj[name])
+	if err != nil {
+		fe.err = fmt.Errorf("%s: %w", name, err)
+		return
+	}
+	fe.e.Bool(b)
+}
+
+func (fe *fieldEncoder) sym(name string, nBits int, syms map[uint64]string) {
+	if fe.err != nil {
+		return
+	}
+	n, err := interp.EncodeSym(fe.obj[name], syms)
+	if err != nil {
+		fe.err = fmt.Errorf("%s: %w", name, err)
+		return
+	}
+	fe.e.U(nBits, n)
+}
+
+func (fe *fieldEncoder) str(name string) string {
+	if fe.err != nil {
+		return ""
+	}
+	s, err := interp.EncodeString(fe.obj[name])
+	if err != nil {
+		fe.err = fmt.Errorf("%s: %w", name, err)
+	}
+	return s
+}
+
+// string zero padded to n bytes
+func (fe *fieldEncoder) fixedStr(name string, n int) {
+	s := fe.str(name)
+	if fe.err != nil {
+		return
+	}
+	if len(s) > n {
+		fe.err = fmt.Errorf("%s: %q is longer than %d bytes", name, s, n)
+		return
+	}
+	fe.e.WriteBytes([]byte(s))
+	fe.e.WriteBytes(make([]byte, n-len(s)))
+}
+
+// 32 bit length prefixed string
+func (fe *fieldEncoder) lenStr(name string) {
+	s := fe.str(name)
+	if fe.err != nil {
+		return
+	}
+	fe.e.U32(uint64(len(s)))
+	fe.e.WriteBytes([]byte(s))
+}
+
+func (fe *fieldEncoder) bytes(name string) []byte {
+	if fe.err != nil {
+		return nil
+	}
+	b, err := interp.EncodeBytes(fe.obj[name])
+	if err != nil {
+		fe.err = fmt.Errorf("%s: %w", name, err)
+	}
+	return b
+}
+
+func (fe *fieldEncoder) array(name string) []any {
+	if fe.err != nil {
+		return nil
+	}
+	vs, err := interp.EncodeArray(fe.obj[name])
+	if err != nil {
+		fe.err = fmt.Errorf("%s: %w", name, err)
+	}
+	return vs
+}
+
+// copy as is if v is unmodified otherwise encode using fn
+func (fe *fieldEncoder) rawOr(name string, fn func(e *decode.E, v any) error) {
+	if fe.err != nil {
+		return
+	}
+	v := fe.obj[name]
+	ok, err := interp.EncodeRaw(fe.e, v)
+	if err != nil {
+		fe.err = fmt.Errorf("%s: %w", name, err)
+		return
+	}
+	if ok {
+		return
+	}
+	if err := fn(fe.e, v); err != nil {
+		fe.err = fmt.Errorf("%s: %w", name, err)
+	}
+}
+
+func flacEncode(e *decode.E, v any) error {
+	fe, err := newFieldEncoder(e, v)
+	if err != nil {
+		return err
+	}
+	e.WriteBytes([]byte("fLaC"))
+	fe.rawOr("metadatablocks", metadatablocksEncode)
+	if _, ok := fe.obj["frames"]; ok {
+		fe.rawOr("frames", func(e *decode.E, v any) error {
+			return fmt.Errorf("modified frames can't be encoded")
+		})
+	}
+	return fe.err
+}
+
+// last_block is set for the last block
+func metadatablocksEncode(e *decode.E, v any) error {
+	blocks, err := interp.EncodeArray(v)
+	if err != nil {
+		return err
+	}
+	for i, bv := range blocks {
+		if err := encodeMetadatablock(e, bv, i == len(blocks)-1); err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func metadatablockEncode(e *decode.E, v any) error {
+	obj, err := interp.EncodeObject(v)
+	if err != nil {
+		return err
+	}
+	isLastBlock, err := interp.EncodeBool(obj["last_block"])
+	if err != nil {
+		return fmt.Errorf("last_block: %w", err)
+	}
+	return encodeMetadatablock(e, v, isLastBlock)
+}
+
+func encodeMetadatablock(e *decode.E, v any, isLastBlock bool) error {
+	re := &decode.E{}
+	ok, err := interp.EncodeRaw(re, v)
+	if err != nil {
+		return err
+	}
+	if ok {
+		b := re.Bytes()
+		if len(b) > 0 {
+			b[0] &= 0x7f
+			if isLastBlock {
+				b[0] |= 0x80
+			}
+		}
+		e.WriteBytes(b)
+		return nil
+	}
+
+	fe, err := newFieldEncoder(&decode.E{}, v)
+	if err != nil {
+		return err
+	}
+	typ, err := interp.EncodeSym(fe.obj["type"], metadataBlockNames)
+	if err != nil {
+		return fmt.Errorf("type: %w", err)
+	}
+
+	switch typ {
+	case MetadataBlockStreaminfo:
+		if fe.err == nil {
+			fe.err = fe.e.Format(flacStreaminfoFormat, fe.obj)
+		}
+	case MetadataBlockVorbisComment:
+		fe.rawOr("comment", func(e *decode.E, v any) error { return e.Format(vorbisCommentFormat, v) })
+	case MetadataBlockPicture:
+		fe.rawOr("picture", func(e *decode.E, v any) error { return e.Format(flacPicture, v) })
+	case MetadataBlockCuesheet:
+		encodeCuesheet(fe)
+	case MetadataBlockSeektable:
+		for i, sv := range fe.array("seekpoints") {
+			sfe, err := newFieldEncoder(fe.e, sv)
+			if err != nil {
+				return fmt.Errorf("seekpoints[%d]: %w", i, err)
+			}
+			sfe.u("sample_number", 64)
+			sfe.u("offset", 64)
+			sfe.u("number_of_samples", 16)
+			if sfe.err != nil {
+				return fmt.Errorf("seekpoints[%d]: %w", i, sfe.err)
+			}
+		}
+	case MetadataBlockApplication:
+		fe.fixedStr("id", 4)
+		fe.e.WriteBytes(fe.bytes("data"))
+	default:
+		fe.e.WriteBytes(fe.bytes("data"))
+	}
+	if fe.err != nil {
+		return fe.err
+	}
+
+	length := uint64(len(fe.e.Bytes()))
+	if length > 0xff_ffff {
+		return fmt.Errorf("length %d does not fit in 24 bits", length)
+	}
+	e.Bool(isLastBlock)
+	e.U(7, typ)
+	e.U24(length)
+	e.WriteBytes(fe.e.Bytes())
+
+	return nil
+}
+
+// reserved bits are zero, counts are recalculated
+func encodeCuesheet(fe *fieldEncoder) {
+	fe.fixedStr("media_catalog_number", 128)
+	fe.u("lead_in_samples", 64)
+	fe.bool("is_cd")
+	fe.e.U(7, 0)
+	fe.e.WriteBytes(make([]byte, 258))
+	tracks := fe.array("tracks")
+	if fe.err != nil {
+		return
+	}
+	fe.e.U8(uint64(len(tracks)))
+	for i, tv := range tracks {
+		tfe, err := newFieldEncoder(fe.e, tv)
+		if err != nil {
+			fe.err = fmt.Errorf("tracks[%d]: %w", i, err)
+			return
+		}
+		tfe.u("offset", 64)
+		tfe.u("number", 8)
+		tfe.fixedStr("isrc", 12)
+		tfe.sym("type", 1, cuesheetTrackTypeNames)
+		tfe.bool("pre_emphasis")
+		tfe.e.U(6, 0)
+		tfe.e.WriteBytes(make([]byte, 13))
+		indexPoints := tfe.array("index_points")
+		if tfe.err != nil {
+			fe.err = fmt.Errorf("tracks[%d]: %w", i, tfe.err)
+			return
+		}
+		tfe.e.U8(uint64(len(indexPoints)))
+		for j, iv := range indexPoints {
+			ife, err := newFieldEncoder(fe.e, iv)
+			if err != nil {
+				fe.err = fmt.Errorf("tracks[%d].index_points[%d]: %w", i, j, err)
+				return
+			}
+			ife.u("offset", 64)
+			ife.u("number", 8)
+			ife.e.U24(0)
+			if ife.err != nil {
+				fe.err = fmt.Errorf("tracks[%d].index_points[%d]: %w", i, j, ife.err)
+				return
+			}
+		}
+	}
+}
+
+// channels and bits_per_sample are actual values, md5 can be a hex string
+func streaminfoEncode(e *decode.E, v any) error {
+	fe, err := newFieldEncoder(e, v)
+	if err != nil {
+		return err
+	}
+	fe.u("minimum_block_size", 16)
+	fe.u("maximum_block_size", 16)
+	fe.u("minimum_frame_size", 24)
+	fe.u("maximum_frame_size", 24)
+	fe.u("sample_rate", 20)
+	for _, f := range []struct {
+		name  string
+		nBits int
+	}{
+		{"channels", 3},
+		{"bits_per_sample", 5},
+	} {
+		n := fe.uint(f.name)
+		if fe.err != nil {
+			return fe.err
+		}
+		if n < 1 || n > 1<<f.nBits {
+			return fmt.Errorf("%s: %d is out of range", f.name, n)
+		}
+		e.U(f.nBits, n-1)
+	}
+	fe.u("total_samples_in_stream", 36)
+	if fe.err != nil {
+		return fe.err
+	}
+
+	var md5 []byte
+	if s, ok := fe.obj["md5"].(string); ok {
+		if md5, err = hex.DecodeString(s); err != nil {
+			return fmt.Errorf("md5: %w", err)
+		}
+	} else {
+		md5 = fe.bytes("md5")
+	}
+	if fe.err == nil && len(md5) != 16 {
+		return fmt.Errorf("md5: should be 16 bytes but is %d", len(md5))
+	}
+	e.WriteBytes(md5)
+
+	return fe.err
+}
+
+func pictureEncode(e *decode.E, v any) error {
+	fe, err := newFieldEncoder(e, v)
+	if err != nil {
+		return err
+	}
+	fe.sym("picture_type", 32, pictureTypeNames)
+	fe.lenStr("mime")
+	fe.lenStr("description")
+	fe.u("width", 32)
+	fe.u("height", 32)
+	fe.u("color_depth", 32)
+	fe.u("number_of_index_colors", 32)
+	picture := fe.bytes("picture_data")
+	if fe.err != nil {
+		return fe.err
+	}
+	e.U32(uint64(len(picture)))
+	e.WriteBytes(picture)
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package flac
 
 import (
+	"bytes"
 	"encoding/binary"
 	"math/bits"
 
@@ -18,7 +19,8 @@ func init() {
 		Description: "FLAC frame",
 		DecodeFn:    frameDecode,
 		DecodeInArg: format.FlacFrameIn{
-			BitsPerSample: 16,
+			BitsPerSample:   16,
+			DecodeResiduals: false,
 		},
 	})
 }
@@ -107,6 +109,7 @@ func frameDecode(d *decode.D, in any) any {
 	channels := 0
 	sampleSize := 0
 	sideChannelIndex := -1
+	headerCRCValid := false
 
 	ffi, ok := in.(format.FlacFrameIn)
 	if ok {
@@ -320,7 +323,9 @@ func frameDecode(d *decode.D, in any) any {
 
 		headerCRC := &checksum.CRC{Bits: 8, Table: checksum.ATM8Table}
 		d.CopyBits(headerCRC, d.BitBufRange(frameStart, d.Pos()-frameStart))
-		d.FieldU8("crc", d.ValidateUBytes(headerCRC.Sum(nil)), scalar.ActualHex)
+		headerCRCSum := headerCRC.Sum(nil)
+		crc := d.FieldU8("crc", d.ValidateUBytes(headerCRCSum), scalar.ActualHex)
+		headerCRCValid = crc == uint64(headerCRCSum[0])
 	})
 
 	var channelSamples [][]int64
@@ -455,14 +460,54 @@ func frameDecode(d *decode.D, in any) any {
 
 								if riceParameter == riceEscape {
 									escapeSampleSize := int(d.FieldU5("escape_sample_size"))
-									d.FieldRawLen("samples", int64(count*escapeSampleSize))
+									if escapeSampleSize == 0 {
+										// all residuals are zero and no bits are used
+										if ffi.DecodeResiduals {
+											d.FieldArray("residuals", func(d *decode.D) {
+												for j := 0; j < count; j++ {
+													d.FieldValueS("residual", 0)
+												}
+											})
+										} else {
+											d.FieldRawLen("samples", 0)
+										}
+										for j := 0; j < count; j++ {
+											samples[n] = 0
+											n++
+										}
+									} else if ffi.DecodeResiduals {
+										d.FieldArray("residuals", func(d *decode.D) {
+											for j := 0; j < count; j++ {
+												samples[n] = d.FieldS("residual", escapeSampleSize)
+												n++
+											}
+										})
+									} else {
+										d.RangeFn(d.Pos(), int64(count*escapeSampleSize), func(d *decode.D) {
+											d.FieldRawLen("samples", d.BitsLeft())
+										})
+										for j := 0; j < count; j++ {
+											samples[n] = d.S(escapeSampleSize)
+											n++
+										}
+									}
+								} else if ffi.DecodeResiduals {
+									// one field per residual is expensive so only done if asked for
+									d.FieldArray("residuals", func(d *decode.D) {
+										for j := 0; j < count; j++ {
+											samples[n] = d.FieldSFn("residual", func(d *decode.D) int64 {
+												high := d.Unary(0)
+												low := d.U(riceParameter)
+												return mathex.ZigZag(high<<riceParameter | low)
+											})
+											n++
+										}
+									})
 								} else {
 									samplesStart := d.Pos()
 									for j := 0; j < count; j++ {
 										high := d.Unary(0)
-										_ = high
 										low := d.U(riceParameter)
-										_ = low
 										samples[n] = mathex.ZigZag(high<<riceParameter | low)
 										n++
 									}
@@ -566,7 +611,9 @@ func frameDecode(d *decode.D, in any) any {
 	// <16> CRC-16 (polynomial = x^16 + x^15 + x^2 + x^0, initialized with 0) of everything before the crc, back to and including the frame header sync code
 	footerCRC := &checksum.CRC{Bits: 16, Table: checksum.ANSI16Table}
 	d.CopyBits(footerCRC, d.BitBufRange(frameStart, d.Pos()-frameStart))
-	d.FieldRawLen("footer_crc", 16, d.ValidateBitBuf(footerCRC.Sum(nil)), scalar.RawHex)
+	footerCRCSum := footerCRC.Sum(nil)
+	footerCRCValid := bytes.Equal(d.BytesRange(d.Pos(), 2), footerCRCSum)
+	d.FieldRawLen("footer_crc", 16, d.ValidateBitBuf(footerCRCSum), scalar.RawHex)
 
 	streamSamples := len(channelSamples[0])
 	for j := 0; j < len(channelSamples); j++ {
@@ -634,9 +681,11 @@ func frameDecode(d *decode.D, in any) any {
 	}
 
 	return format.FlacFrameOut{
-		SamplesBuf:    interleavedSamplesBuf,
-		Samples:       uint64(streamSamples),
-		Channels:      channels,
-		BitsPerSample: outSampleSize,
+		SamplesBuf:     interleavedSamplesBuf,
+		Samples:        uint64(streamSamples),
+		Channels:       channels,
+		BitsPerSample:  outSampleSize,
+		HeaderCRCValid: headerCRCValid,
+		FooterCRCValid: footerCRCValid,
 	}
 }
@@ -1,8 +1,5 @@
 package flac
 
-// TODO: 24 bit picture length truncate warning
-// TODO: Cuesheet
-
 import (
 	"fmt"
 
@@ -21,6 +18,7 @@ func init() {
 		Name:        format.FLAC_METADATABLOCK,
 		Description: "FLAC metadatablock",
 		DecodeFn:    metadatablockDecode,
+		EncodeFn:    metadatablockEncode,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.FLAC_STREAMINFO}, Group: &flacStreaminfoFormat},
 			{Names: []string{format.FLAC_PICTURE}, Group: &flacPicture},
@@ -49,9 +47,52 @@ var metadataBlockNames = scalar.UToSymStr{
 	MetadataBlockPicture:       "picture",
 }
 
+const SeekpointPlaceholder = 0xffff_ffff_ffff_ffff
+
+// track number of CD-DA lead-out track
+const cuesheetLeadOutTrackCDDA = 170
+
+var cuesheetTrackTypeNames = scalar.UToSymStr{
+	0: "audio",
+	1: "non_audio",
+}
+
+func decodeCuesheet(d *decode.D) {
+	d.FieldUTF8("media_catalog_number", 128, scalar.ActualTrim("\x00"))
+	d.FieldU64("lead_in_samples")
+	d.FieldBool("is_cd")
+	d.FieldRawLen("reserved", 7+258*8)
+	numberOfTracks := d.FieldU8("number_of_tracks")
+	d.FieldArray("tracks", func(d *decode.D) {
+		for i := uint64(0); i < numberOfTracks; i++ {
+			d.FieldStruct("track", func(d *decode.D) {
+				d.FieldU64("offset")
+				d.FieldU8("number", scalar.UToScalar{
+					cuesheetLeadOutTrackCDDA: {Description: "Lead-out"},
+				})
+				d.FieldUTF8("isrc", 12, scalar.ActualTrim("\x00"))
+				d.FieldU1("type", cuesheetTrackTypeNames)
+				d.FieldBool("pre_emphasis")
+				d.FieldRawLen("reserved", 6+13*8)
+				numberOfIndexPoints := d.FieldU8("number_of_index_points")
+				d.FieldArray("index_points", func(d *decode.D) {
+					for j := uint64(0); j < numberOfIndexPoints; j++ {
+						d.FieldStruct("index_point", func(d *decode.D) {
+							d.FieldU64("offset")
+							d.FieldU8("number")
+							d.FieldU24("reserved")
+						})
+					}
+				})
+			})
+		}
+	})
+}
+
 func metadatablockDecode(d *decode.D, _ any) any {
 	var hasStreamInfo bool
 	var streamInfo format.FlacStreamInfo
+	var seekpoints []format.FlacSeekpoint
 
 	isLastBlock := d.FieldBool("last_block")
 	typ := d.FieldU7("type", metadataBlockNames)
@@ -69,16 +110,22 @@ func metadatablockDecode(d *decode.D, _ any) any {
 		d.FieldFormatLen("comment", int64(length*8), vorbisCommentFormat, nil)
 	case MetadataBlockPicture:
 		d.FieldFormatLen("picture", int64(length*8), flacPicture, nil)
+	case MetadataBlockCuesheet:
+		d.FramedFn(int64(length*8), decodeCuesheet)
 	case MetadataBlockSeektable:
 		seektableCount := length / 18
 		d.FieldArray("seekpoints", func(d *decode.D) {
 			for i := uint64(0); i < seektableCount; i++ {
 				d.FieldStruct("seekpoint", func(d *decode.D) {
-					d.FieldU64("sample_number", scalar.UToScalar{
-						0xffff_ffff_ffff_ffff: {Description: "Placeholder"},
+					sampleNumber := d.FieldU64("sample_number", scalar.UToScalar{
+						SeekpointPlaceholder: {Description: "Placeholder"},
 					})
-					d.FieldU64("offset")
+					offset := d.FieldU64("offset")
 					d.FieldU16("number_of_samples")
+					seekpoints = append(seekpoints, format.FlacSeekpoint{
+						SampleNumber: sampleNumber,
+						Offset:       offset,
+					})
 				})
 			}
 		})
@@ -93,5 +140,6 @@ func metadatablockDecode(d *decode.D, _ any) any {
 		IsLastBlock:   isLastBlock,
 		HasStreamInfo: hasStreamInfo,
 		StreamInfo:    streamInfo,
+		Seekpoints:    seekpoints,
 	}
 }
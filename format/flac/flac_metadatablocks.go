@@ -15,6 +15,7 @@ func init() {
 		Name:        format.FLAC_METADATABLOCKS,
 		Description: "FLAC metadatablocks",
 		DecodeFn:    metadatablocksDecode,
+		EncodeFn:    metadatablocksEncode,
 		RootArray:   true,
 		RootName:    "metadatablocks",
 		Dependencies: []decode.Dependency{
@@ -38,6 +39,7 @@ func metadatablocksDecode(d *decode.D, _ any) any {
 			flacMetadatablocksOut.HasStreamInfo = true
 			flacMetadatablocksOut.StreamInfo = flacMetadatablockOut.StreamInfo
 		}
+		flacMetadatablocksOut.Seekpoints = append(flacMetadatablocksOut.Seekpoints, flacMetadatablockOut.Seekpoints...)
 	}
 
 	return flacMetadatablocksOut
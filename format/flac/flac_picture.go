@@ -10,10 +10,10 @@ import (
 var images decode.Group
 
 var pictureTypeNames = scalar.UToSymStr{
-	0:  "Other",
+	0:  "other",
 	1:  "32x32_pixels",
 	2:  "other_file_icon",
-	3:  "cover_front)",
+	3:  "cover_front",
 	4:  "cover_back",
 	5:  "leaflet_page",
 	6:  "media",
@@ -38,6 +38,7 @@ func init() {
 		Name:        format.FLAC_PICTURE,
 		Description: "FLAC metadatablock picture",
 		DecodeFn:    pictureDecode,
+		EncodeFn:    pictureEncode,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.IMAGE}, Group: &images},
 		},
@@ -56,8 +57,13 @@ func pictureDecode(d *decode.D, _ any) any {
 	d.FieldU32("height")
 	d.FieldU32("color_depth")
 	d.FieldU32("number_of_index_colors")
-	pictureLen := d.FieldU32("picture_length")
-	d.FieldFormatOrRawLen("picture_data", int64(pictureLen)*8, images, nil)
+	pictureLen := int64(d.FieldU32("picture_length")) * 8
+	// metadatablock length is 24 bit so some encoders write pictures larger
+	// than 16MB with a truncated block, decode what is left
+	if pictureLen > d.BitsLeft() {
+		pictureLen = d.BitsLeft()
+	}
+	d.FieldFormatOrRawLen("picture_data", pictureLen, images, nil)
 
 	return nil
 }
@@ -12,14 +12,15 @@ func init() {
 		Name:        format.FLAC_STREAMINFO,
 		Description: "FLAC streaminfo",
 		DecodeFn:    streaminfoDecode,
+		EncodeFn:    streaminfoEncode,
 	})
 }
 
 func streaminfoDecode(d *decode.D, _ any) any {
-	d.FieldU16("minimum_block_size")
-	d.FieldU16("maximum_block_size")
-	d.FieldU24("minimum_frame_size")
-	d.FieldU24("maximum_frame_size")
+	minimumBlockSize := d.FieldU16("minimum_block_size")
+	maximumBlockSize := d.FieldU16("maximum_block_size")
+	minimumFrameSize := d.FieldU24("minimum_frame_size")
+	maximumFrameSize := d.FieldU24("maximum_frame_size")
 	sampleRate := d.FieldU("sample_rate", 20)
 	// <3> (number of channels)-1. FLAC supports from 1 to 8 channels
 	d.FieldU3("channels", scalar.ActualUAdd(1))
@@ -31,6 +32,10 @@ func streaminfoDecode(d *decode.D, _ any) any {
 
 	return format.FlacStreaminfoOut{
 		StreamInfo: format.FlacStreamInfo{
+			MinimumBlockSize:     minimumBlockSize,
+			MaximumBlockSize:     maximumBlockSize,
+			MinimumFrameSize:     minimumFrameSize,
+			MaximumFrameSize:     maximumFrameSize,
 			SampleRate:           sampleRate,
 			BitsPerSample:        bitsPerSample,
 			TotalSamplesInStream: totalSamplesInStream,
@@ -0,0 +1,331 @@
+package flatbuffers
+
+// https://flatbuffers.dev/flatbuffers_internals.html
+// https://github.com/google/flatbuffers/blob/master/reflection/reflection.fbs
+// TODO: size prefixed buffers
+// TODO: vector of unions and 64 bit offsets
+
+import (
+	"embed"
+	"fmt"
+	"sort"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed flatbuffers.jq
+var flatbuffersFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.FLATBUFFERS,
+		Description: "FlatBuffers",
+		DecodeFn:    flatbuffersDecode,
+		DecodeInArg: format.FlatBuffersIn{},
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(flatbuffersFS)
+}
+
+const (
+	uoffsetSize  = 4
+	fileIdentLen = 4
+)
+
+func isPrintable(bs []byte) bool {
+	for _, b := range bs {
+		if b < 0x20 || b > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+type decoder struct {
+	s *schema
+}
+
+// seek to uoffset target, offset is relative to its own position
+func (fd *decoder) fieldOffset(d *decode.D, fn func(d *decode.D)) {
+	offsetPos := d.Pos()
+	offset := d.FieldU32("offset")
+	target := offsetPos + int64(offset)*8
+	if target >= d.Len() {
+		d.Fatalf("offset %d outside buffer", offset)
+	}
+	d.RangeFn(target, d.Len()-target, fn)
+}
+
+func (fd *decoder) decodeVTable(d *decode.D, tablePos int64) ([]uint64, uint64) {
+	vtableOffset := d.FieldS32("vtable_offset")
+	vtablePos := tablePos - vtableOffset*8
+	if vtablePos < 0 || vtablePos >= d.Len() {
+		d.Fatalf("vtable offset %d outside buffer", vtableOffset)
+	}
+
+	var fieldOffsets []uint64
+	var tableSize uint64
+	d.RangeFn(vtablePos, d.Len()-vtablePos, func(d *decode.D) {
+		d.FieldStruct("vtable", func(d *decode.D) {
+			vtableSize := d.FieldU16("vtable_size")
+			tableSize = d.FieldU16("table_size")
+			if vtableSize < 4 {
+				d.Fatalf("vtable size %d too small", vtableSize)
+			}
+			d.FieldArray("field_offsets", func(d *decode.D) {
+				for i := uint64(0); i < (vtableSize-4)/2; i++ {
+					fieldOffsets = append(fieldOffsets, d.FieldU16("field_offset"))
+				}
+			})
+		})
+	})
+
+	return fieldOffsets, tableSize
+}
+
+// decodeTable decodes table at current position, o is nil if type is unknown
+func (fd *decoder) decodeTable(d *decode.D, o *schemaObject) {
+	tablePos := d.Pos()
+	fieldOffsets, tableSize := fd.decodeVTable(d, tablePos)
+
+	if o == nil {
+		// without schema size of a field is assumed to be up to next field or end of table
+		sortedOffsets := append([]uint64{}, fieldOffsets...)
+		sortedOffsets = append(sortedOffsets, tableSize)
+		sort.Slice(sortedOffsets, func(i, j int) bool { return sortedOffsets[i] < sortedOffsets[j] })
+
+		d.FieldArray("fields", func(d *decode.D) {
+			for id, off := range fieldOffsets {
+				if off == 0 {
+					continue
+				}
+				end := tableSize
+				for _, so := range sortedOffsets {
+					if so > off {
+						end = so
+						break
+					}
+				}
+				d.FieldStruct("field", func(d *decode.D) {
+					d.FieldValueU("id", uint64(id))
+					if end <= off {
+						return
+					}
+					d.RangeFn(tablePos+int64(off)*8, int64(end-off)*8, func(d *decode.D) {
+						d.FieldRawLen("data", d.BitsLeft())
+					})
+				})
+			}
+		})
+		return
+	}
+
+	fieldsByID := map[int]schemaField{}
+	for _, f := range o.fields {
+		fieldsByID[f.id] = f
+	}
+	// union type fields are always decoded before the union value field
+	unionTypes := map[int]uint64{}
+
+	d.FieldStruct("fields", func(d *decode.D) {
+		for id, off := range fieldOffsets {
+			if off == 0 {
+				continue
+			}
+			fieldPos := tablePos + int64(off)*8
+			f, ok := fieldsByID[id]
+			if !ok {
+				// field added in newer version of schema, size is unknown
+				d.FieldValueU(fmt.Sprintf("field%d_offset", id), off)
+				continue
+			}
+			d.RangeFn(fieldPos, d.Len()-fieldPos, func(d *decode.D) {
+				if f.typ.baseType == baseTypeUnion {
+					fd.decodeUnion(d, f, unionTypes[id-1])
+					return
+				}
+				v := fd.decodeValue(d, f.name, f.typ.baseType, f.typ)
+				if f.typ.baseType == baseTypeUType {
+					unionTypes[id] = v
+				}
+			})
+		}
+	})
+}
+
+func (fd *decoder) decodeUnion(d *decode.D, f schemaField, unionType uint64) {
+	var o *schemaObject
+	if e := fd.s.enum(f.typ.index); e != nil {
+		for _, v := range e.values {
+			if uint64(v.value) == unionType {
+				o = fd.s.object(v.unionType.index)
+				break
+			}
+		}
+	}
+	d.FieldStruct(f.name, func(d *decode.D) {
+		fd.fieldOffset(d, func(d *decode.D) {
+			fd.decodeTable(d, o)
+		})
+	})
+}
+
+func (fd *decoder) enumMapper(typ schemaType, signed bool) []scalar.Mapper {
+	e := fd.s.enum(typ.index)
+	if e == nil || e.isUnion && typ.baseType != baseTypeUType {
+		return nil
+	}
+	if signed {
+		m := scalar.SToSymStr{}
+		for _, v := range e.values {
+			m[v.value] = v.name
+		}
+		return []scalar.Mapper{m}
+	}
+	m := scalar.UToSymStr{}
+	for _, v := range e.values {
+		m[uint64(v.value)] = v.name
+	}
+	return []scalar.Mapper{m}
+}
+
+// decodeValue decodes value of baseType at current position, for scalars the
+// position is advanced by its size. Returns value for unsigned integer types
+func (fd *decoder) decodeValue(d *decode.D, name string, baseType int, typ schemaType) uint64 {
+	switch baseType {
+	case baseTypeBool:
+		d.FieldBoolFn(name, func(d *decode.D) bool { return d.U8() != 0 })
+	case baseTypeUType, baseTypeUByte:
+		return d.FieldU8(name, fd.enumMapper(typ, false)...)
+	case baseTypeByte:
+		d.FieldS8(name, fd.enumMapper(typ, true)...)
+	case baseTypeShort:
+		d.FieldS16(name, fd.enumMapper(typ, true)...)
+	case baseTypeUShort:
+		return d.FieldU16(name, fd.enumMapper(typ, false)...)
+	case baseTypeInt:
+		d.FieldS32(name, fd.enumMapper(typ, true)...)
+	case baseTypeUInt:
+		return d.FieldU32(name, fd.enumMapper(typ, false)...)
+	case baseTypeLong:
+		d.FieldS64(name, fd.enumMapper(typ, true)...)
+	case baseTypeULong:
+		return d.FieldU64(name, fd.enumMapper(typ, false)...)
+	case baseTypeFloat:
+		d.FieldF32(name)
+	case baseTypeDouble:
+		d.FieldF64(name)
+	case baseTypeString:
+		d.FieldStruct(name, func(d *decode.D) {
+			fd.fieldOffset(d, func(d *decode.D) {
+				length := d.FieldU32("length")
+				d.FieldUTF8("value", int(length))
+			})
+		})
+	case baseTypeVector:
+		d.FieldStruct(name, func(d *decode.D) {
+			fd.fieldOffset(d, func(d *decode.D) {
+				length := d.FieldU32("length")
+				fd.decodeElements(d, "value", int(length), typ)
+			})
+		})
+	case baseTypeArray:
+		fd.decodeElements(d, name, typ.fixedLength, typ)
+	case baseTypeObj:
+		o := fd.s.object(typ.index)
+		switch {
+		case o == nil:
+			d.Fatalf("field %s: unknown object index %d", name, typ.index)
+		case o.isStruct:
+			d.FieldStruct(name, func(d *decode.D) { fd.decodeStruct(d, o) })
+		default:
+			d.FieldStruct(name, func(d *decode.D) {
+				fd.fieldOffset(d, func(d *decode.D) {
+					fd.decodeTable(d, o)
+				})
+			})
+		}
+	default:
+		d.Fatalf("field %s: unsupported base type %d", name, baseType)
+	}
+	return 0
+}
+
+func (fd *decoder) decodeElements(d *decode.D, name string, length int, typ schemaType) {
+	switch typ.element {
+	case baseTypeByte, baseTypeUByte:
+		// usually binary data
+		if fd.enumMapper(typ, false) == nil {
+			d.FieldRawLen(name, int64(length)*8)
+			return
+		}
+	case baseTypeUnion:
+		d.FieldRawLen(name, int64(length)*uoffsetSize*8)
+		return
+	}
+	d.FieldArray(name, func(d *decode.D) {
+		for i := 0; i < length; i++ {
+			fd.decodeValue(d, "element", typ.element, typ)
+		}
+	})
+}
+
+func (fd *decoder) decodeStruct(d *decode.D, o *schemaObject) {
+	start := d.Pos()
+	fields := append([]schemaField{}, o.fields...)
+	sort.Slice(fields, func(i, j int) bool { return fields[i].offset < fields[j].offset })
+	for _, f := range fields {
+		fieldPos := start + int64(f.offset)*8
+		d.RangeFn(fieldPos, d.Len()-fieldPos, func(d *decode.D) {
+			fd.decodeValue(d, f.name, f.typ.baseType, f.typ)
+		})
+	}
+	d.SeekAbs(start + int64(o.byteSize)*8)
+}
+
+func flatbuffersDecode(d *decode.D, in any) any {
+	fbi, _ := in.(format.FlatBuffersIn)
+
+	d.Endian = decode.LittleEndian
+
+	fd := &decoder{}
+	var root *schemaObject
+	if fbi.Schema != "" {
+		s, err := parseSchema([]byte(fbi.Schema))
+		if err != nil {
+			d.Fatalf("schema: %s", err)
+		}
+		rootIndex := s.rootTable
+		if fbi.RootType != "" {
+			rootIndex = s.objectIndex(fbi.RootType)
+		}
+		root = s.object(rootIndex)
+		if root == nil || root.isStruct {
+			d.Fatalf("schema: root table type not found")
+		}
+		fd.s = s
+	}
+
+	rootOffset := d.FieldU32("root_offset")
+	if rootOffset < uoffsetSize || int64(rootOffset)*8 >= d.Len() {
+		d.Fatalf("root offset %d outside buffer", rootOffset)
+	}
+	switch {
+	case fd.s != nil && fd.s.fileIdent != "":
+		d.FieldUTF8("file_identifier", fileIdentLen, d.ValidateStr(fd.s.fileIdent))
+	case fd.s == nil && rootOffset >= uoffsetSize+fileIdentLen && isPrintable(d.PeekBytes(fileIdentLen)):
+		d.FieldUTF8("file_identifier", fileIdentLen)
+	}
+
+	rootPos := int64(rootOffset) * 8
+	d.RangeFn(rootPos, d.Len()-rootPos, func(d *decode.D) {
+		d.FieldStruct("root", func(d *decode.D) {
+			fd.decodeTable(d, root)
+		})
+	})
+
+	return nil
+}
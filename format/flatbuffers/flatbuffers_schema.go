@@ -0,0 +1,261 @@
+package flatbuffers
+
+// Binary schema (.bfbs) is a flatbuffer itself using reflection.fbs
+// https://github.com/google/flatbuffers/blob/master/reflection/reflection.fbs
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	baseTypeNone     = 0
+	baseTypeUType    = 1
+	baseTypeBool     = 2
+	baseTypeByte     = 3
+	baseTypeUByte    = 4
+	baseTypeShort    = 5
+	baseTypeUShort   = 6
+	baseTypeInt      = 7
+	baseTypeUInt     = 8
+	baseTypeLong     = 9
+	baseTypeULong    = 10
+	baseTypeFloat    = 11
+	baseTypeDouble   = 12
+	baseTypeString   = 13
+	baseTypeVector   = 14
+	baseTypeObj      = 15
+	baseTypeUnion    = 16
+	baseTypeArray    = 17
+	baseTypeVector64 = 18
+)
+
+var baseTypeSizes = map[int]int{
+	baseTypeUType:  1,
+	baseTypeBool:   1,
+	baseTypeByte:   1,
+	baseTypeUByte:  1,
+	baseTypeShort:  2,
+	baseTypeUShort: 2,
+	baseTypeInt:    4,
+	baseTypeUInt:   4,
+	baseTypeLong:   8,
+	baseTypeULong:  8,
+	baseTypeFloat:  4,
+	baseTypeDouble: 8,
+	baseTypeString: 4,
+	baseTypeVector: 4,
+	baseTypeObj:    4,
+	baseTypeUnion:  4,
+}
+
+type schemaType struct {
+	baseType    int
+	element     int
+	index       int
+	fixedLength int
+}
+
+type schemaField struct {
+	name   string
+	typ    schemaType
+	id     int
+	offset int
+}
+
+type schemaObject struct {
+	name     string
+	fields   []schemaField
+	isStruct bool
+	byteSize int
+}
+
+type schemaEnumVal struct {
+	name      string
+	value     int64
+	unionType schemaType
+}
+
+type schemaEnum struct {
+	name    string
+	values  []schemaEnumVal
+	isUnion bool
+}
+
+type schema struct {
+	objects   []schemaObject
+	enums     []schemaEnum
+	fileIdent string
+	rootTable int
+}
+
+// minimal flatbuffer reader, panics on out of bounds access
+type table struct {
+	b      []byte
+	pos    int
+	vt     int
+	vtSize int
+}
+
+func u16(b []byte, p int) int { return int(binary.LittleEndian.Uint16(b[p:])) }
+func u32(b []byte, p int) int { return int(binary.LittleEndian.Uint32(b[p:])) }
+
+func newTable(b []byte, pos int) table {
+	vt := pos - int(int32(binary.LittleEndian.Uint32(b[pos:])))
+	return table{b: b, pos: pos, vt: vt, vtSize: u16(b, vt)}
+}
+
+func (t table) field(id int) int {
+	o := 4 + 2*id
+	if o+2 > t.vtSize {
+		return 0
+	}
+	off := u16(t.b, t.vt+o)
+	if off == 0 {
+		return 0
+	}
+	return t.pos + off
+}
+
+func (t table) uint(id int, size int, def uint64) uint64 {
+	p := t.field(id)
+	if p == 0 {
+		return def
+	}
+	switch size {
+	case 1:
+		return uint64(t.b[p])
+	case 2:
+		return uint64(binary.LittleEndian.Uint16(t.b[p:]))
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(t.b[p:]))
+	default:
+		return binary.LittleEndian.Uint64(t.b[p:])
+	}
+}
+
+func (t table) str(id int) string {
+	p := t.field(id)
+	if p == 0 {
+		return ""
+	}
+	p += u32(t.b, p)
+	n := u32(t.b, p)
+	return string(t.b[p+4 : p+4+n])
+}
+
+func (t table) sub(id int) (table, bool) {
+	p := t.field(id)
+	if p == 0 {
+		return table{}, false
+	}
+	return newTable(t.b, p+u32(t.b, p)), true
+}
+
+func (t table) tables(id int) []table {
+	p := t.field(id)
+	if p == 0 {
+		return nil
+	}
+	p += u32(t.b, p)
+	n := u32(t.b, p)
+	var ts []table
+	for i := 0; i < n; i++ {
+		e := p + 4 + i*4
+		ts = append(ts, newTable(t.b, e+u32(t.b, e)))
+	}
+	return ts
+}
+
+func parseSchemaType(t table) schemaType {
+	return schemaType{
+		baseType:    int(t.uint(0, 1, 0)),
+		element:     int(t.uint(1, 1, 0)),
+		index:       int(int32(t.uint(2, 4, 0xffff_ffff))),
+		fixedLength: int(t.uint(3, 2, 0)),
+	}
+}
+
+func parseSchema(b []byte) (s *schema, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid schema: %v", r)
+		}
+	}()
+
+	root := newTable(b, u32(b, 0))
+	s = &schema{
+		fileIdent: root.str(2),
+		rootTable: -1,
+	}
+
+	for _, ot := range root.tables(0) {
+		o := schemaObject{
+			name:     ot.str(0),
+			isStruct: ot.uint(2, 1, 0) != 0,
+			byteSize: int(ot.uint(4, 4, 0)),
+		}
+		for _, ft := range ot.tables(1) {
+			f := schemaField{
+				name:   ft.str(0),
+				id:     int(ft.uint(2, 2, 0)),
+				offset: int(ft.uint(3, 2, 0)),
+			}
+			if tt, ok := ft.sub(1); ok {
+				f.typ = parseSchemaType(tt)
+			}
+			o.fields = append(o.fields, f)
+		}
+		s.objects = append(s.objects, o)
+	}
+
+	for _, et := range root.tables(1) {
+		e := schemaEnum{
+			name:    et.str(0),
+			isUnion: et.uint(2, 1, 0) != 0,
+		}
+		for _, vt := range et.tables(1) {
+			v := schemaEnumVal{
+				name:  vt.str(0),
+				value: int64(vt.uint(1, 8, 0)),
+				unionType: schemaType{
+					index: -1,
+				},
+			}
+			if tt, ok := vt.sub(3); ok {
+				v.unionType = parseSchemaType(tt)
+			}
+			e.values = append(e.values, v)
+		}
+		s.enums = append(s.enums, e)
+	}
+
+	if rt, ok := root.sub(4); ok {
+		s.rootTable = s.objectIndex(rt.str(0))
+	}
+
+	return s, nil
+}
+
+func (s *schema) objectIndex(name string) int {
+	for i, o := range s.objects {
+		if o.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *schema) object(index int) *schemaObject {
+	if index < 0 || index >= len(s.objects) {
+		return nil
+	}
+	return &s.objects[index]
+}
+
+func (s *schema) enum(index int) *schemaEnum {
+	if index < 0 || index >= len(s.enums) {
+		return nil
+	}
+	return &s.enums[index]
+}
@@ -1,186 +1,294 @@
-//go:build ignore
-
 package flv
 
-// TODO: make it useful
 // https://rtmp.veriskope.com/pdf/video_file_format_spec_v10.pdf
+// https://veovera.org/docs/enhanced/enhanced-rtmp-v1.pdf
+
+// TODO: enhanced FLV (fourcc codecs)
+// TODO: encrypted tags (filter bit)
 
 import (
+	"embed"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/pkg/decode"
-	"github.com/wader/fq/pkg/registry"
+	"github.com/wader/fq/pkg/interp"
 	"github.com/wader/fq/pkg/scalar"
 )
 
+//go:embed flv.jq
+var flvFS embed.FS
+
+var amf0Format decode.Group
+var mpegASCFormat decode.Group
+var aacFrameFormat decode.Group
+var mp3FrameFormat decode.Group
+var avcDCRFormat decode.Group
+var avcAUFormat decode.Group
+var hevcDCRFormat decode.Group
+var hevcAUFormat decode.Group
+
 func init() {
-	registry.MustRegister(decode.Format{
+	interp.RegisterFormat(decode.Format{
 		Name:        format.FLV,
 		Description: "Flash video",
 		Groups:      []string{format.PROBE},
 		DecodeFn:    flvDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.AMF0}, Group: &amf0Format},
+			{Names: []string{format.MPEG_ASC}, Group: &mpegASCFormat},
+			{Names: []string{format.AAC_FRAME}, Group: &aacFrameFormat},
+			{Names: []string{format.MP3_FRAME}, Group: &mp3FrameFormat},
+			{Names: []string{format.AVC_DCR}, Group: &avcDCRFormat},
+			{Names: []string{format.AVC_AU}, Group: &avcAUFormat},
+			{Names: []string{format.HEVC_DCR}, Group: &hevcDCRFormat},
+			{Names: []string{format.HEVC_AU}, Group: &hevcAUFormat},
+		},
+		Functions: []string{"_help"},
 	})
+	interp.RegisterFS(flvFS)
 }
 
+const headerSize = 9
+const tagHeaderSize = 11
+
 const (
-	audioData        = 8
-	videoData        = 9
-	scriptDataObject = 18
+	tagTypeAudio  = 8
+	tagTypeVideo  = 9
+	tagTypeScript = 18
 )
 
 var tagTypeNames = scalar.UToSymStr{
-	audioData:        "audioData",
-	videoData:        "videoData",
-	scriptDataObject: "scriptDataObject",
+	tagTypeAudio:  "audio",
+	tagTypeVideo:  "video",
+	tagTypeScript: "script",
 }
 
 const (
-	typeNumber      = 0
-	typeBoolean     = 1
-	typeString      = 2
-	typeObject      = 3
-	typeMovieClip   = 4
-	typeNull        = 5
-	typeUndefined   = 6
-	typeReference   = 7
-	typeECMAArray   = 8
-	typeObjectEnd   = 9
-	typeStrictArray = 10
-	typeDate        = 11
-	typeLongString  = 12
+	soundFormatMP3 = 2
+	soundFormatAAC = 10
 )
 
-var typeNames = scalar.UToSymStr{
-	typeNumber:      "Number",
-	typeBoolean:     "Boolean",
-	typeString:      "String",
-	typeObject:      "Object",
-	typeMovieClip:   "MovieClip",
-	typeNull:        "Null",
-	typeUndefined:   "Undefined",
-	typeReference:   "Reference",
-	typeECMAArray:   "ECMAArray",
-	typeObjectEnd:   "ObjectEnd",
-	typeStrictArray: "StrictArray",
-	typeDate:        "Date",
-	typeLongString:  "LongString",
+var soundFormatNames = scalar.UToSymStr{
+	0:              "pcm",
+	1:              "adpcm",
+	soundFormatMP3: "mp3",
+	3:              "pcm_le",
+	4:              "nellymoser_16khz",
+	5:              "nellymoser_8khz",
+	6:              "nellymoser",
+	7:              "g711a",
+	8:              "g711u",
+	9:              "reserved",
+	soundFormatAAC: "aac",
+	11:             "speex",
+	14:             "mp3_8khz",
+	15:             "device_specific",
 }
 
-func flvDecode(d *decode.D, _ any) any {
-	var fieldScriptDataObject func()
-	var fieldScriptDataVariable func(d *decode.D, name string)
-
-	fieldScriptDataString := func(d *decode.D, name string) {
-		d.FieldStrFn(name, func(d *decode.D) string {
-			l := d.U16()
-			return d.UTF8(int(l))
-		})
-	}
-	fieldScriptDataStringLong := func(d *decode.D, name string) {
-		d.FieldStrFn(name, func(d *decode.D) string {
-			l := d.U32()
-			return d.UTF8(int(l))
-		})
-	}
+var soundRateNames = scalar.UToSymU{
+	0: 5500,
+	1: 11025,
+	2: 22050,
+	3: 44100,
+}
 
-	fieldScriptDataVariable = func(d *decode.D, name string) {
-		d.FieldStruct(name, func(d *decode.D) {
-			fieldScriptDataString(d, "name")
-			fieldScriptDataString(d, "data")
-		})
-	}
+var soundSizeNames = scalar.UToSymU{
+	0: 8,
+	1: 16,
+}
 
-	fieldScriptDataValue := func(d *decode.D, _ string) uint64 {
-		typ := d.FieldU8("type", typeNames)
-		if typ == typeECMAArray {
-			d.FieldU32("ecma_array_length")
-		}
+var soundTypeNames = scalar.UToSymStr{
+	0: "mono",
+	1: "stereo",
+}
 
-		switch typ {
-		case typeNumber:
-			d.FieldF64("number")
-		case typeBoolean:
-			d.FieldU8("boolean")
-		case typeString:
-			fieldScriptDataString(d, "string")
-		case typeObject:
-			fieldScriptDataObject()
-		case typeMovieClip:
-			fieldScriptDataString(d, "path")
-		case typeNull:
-		case typeUndefined:
-		case typeReference:
-			d.FieldU16("reference")
-		case typeECMAArray:
-			d.FieldArray("array", func(d *decode.D) {
-				for {
-					if d.PeekBits(24) == typeObjectEnd { // variableEnd?
-						d.FieldU24("end")
-						break
-					}
-					fieldScriptDataVariable(d, "sasdadas")
-				}
-			})
-		case typeStrictArray:
-			length := d.FieldU32("length")
-			for i := uint64(0); i < length; i++ {
-				fieldScriptDataVariable(d, "sasdadas")
-			}
-		case typeDate:
-			d.FieldF64("date_time")
-			d.FieldS16("local_data_time_offset")
+const (
+	aacPacketTypeSequenceHeader = 0
+	aacPacketTypeRaw            = 1
+)
+
+var aacPacketTypeNames = scalar.UToSymStr{
+	aacPacketTypeSequenceHeader: "sequence_header",
+	aacPacketTypeRaw:            "raw",
+}
+
+var frameTypeNames = scalar.UToSymStr{
+	1: "keyframe",
+	2: "inter_frame",
+	3: "disposable_inter_frame",
+	4: "generated_keyframe",
+	5: "video_info_or_command_frame",
+}
+
+const (
+	codecIDAVC  = 7
+	codecIDHEVC = 12 // not in spec but used by many muxers
+)
+
+var codecIDNames = scalar.UToSymStr{
+	1:           "jpeg",
+	2:           "h263",
+	3:           "screen_video",
+	4:           "vp6",
+	5:           "vp6_alpha",
+	6:           "screen_video_v2",
+	codecIDAVC:  "avc",
+	codecIDHEVC: "hevc",
+}
+
+const (
+	avcPacketTypeSequenceHeader = 0
+	avcPacketTypeNALU           = 1
+	avcPacketTypeEndOfSequence  = 2
+)
 
-		case typeLongString:
-			fieldScriptDataStringLong(d, "asdsad")
+var avcPacketTypeNames = scalar.UToSymStr{
+	avcPacketTypeSequenceHeader: "sequence_header",
+	avcPacketTypeNALU:           "nalu",
+	avcPacketTypeEndOfSequence:  "end_of_sequence",
+}
+
+type flvState struct {
+	aacObjectType  int
+	avcLengthSize  uint64
+	hevcLengthSize uint64
+}
 
-		case typeObjectEnd: // variableEnd also?
+func decodeAudioData(d *decode.D, s *flvState) {
+	soundFormat := d.FieldU4("sound_format", soundFormatNames)
+	d.FieldU2("sound_rate", soundRateNames)
+	d.FieldU1("sound_size", soundSizeNames)
+	d.FieldU1("sound_type", soundTypeNames)
 
+	switch soundFormat {
+	case soundFormatAAC:
+		switch d.FieldU8("aac_packet_type", aacPacketTypeNames) {
+		case aacPacketTypeSequenceHeader:
+			_, v := d.FieldFormatOrRawLen("data", d.BitsLeft(), mpegASCFormat, nil)
+			if ascOut, ok := v.(format.MPEGASCOut); ok {
+				s.aacObjectType = ascOut.ObjectType
+			}
+		case aacPacketTypeRaw:
+			d.FieldFormatOrRawLen("data", d.BitsLeft(), aacFrameFormat, format.AACFrameIn{ObjectType: s.aacObjectType})
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
 		}
+	case soundFormatMP3:
+		d.FieldFormatOrRawLen("data", d.BitsLeft(), mp3FrameFormat, nil)
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func decodeVideoData(d *decode.D, s *flvState) {
+	d.FieldU4("frame_type", frameTypeNames)
+	codecID := d.FieldU4("codec_id", codecIDNames)
 
-		return typ
+	switch codecID {
+	case codecIDAVC, codecIDHEVC:
+		packetType := d.FieldU8("packet_type", avcPacketTypeNames)
+		d.FieldS24("composition_time")
+		if d.BitsLeft() == 0 {
+			return
+		}
+		switch {
+		case packetType == avcPacketTypeSequenceHeader && codecID == codecIDAVC:
+			_, v := d.FieldFormatOrRawLen("data", d.BitsLeft(), avcDCRFormat, nil)
+			if dcrOut, ok := v.(format.AvcDcrOut); ok {
+				s.avcLengthSize = dcrOut.LengthSize
+			}
+		case packetType == avcPacketTypeSequenceHeader && codecID == codecIDHEVC:
+			_, v := d.FieldFormatOrRawLen("data", d.BitsLeft(), hevcDCRFormat, nil)
+			if dcrOut, ok := v.(format.HevcDcrOut); ok {
+				s.hevcLengthSize = dcrOut.LengthSize
+			}
+		case packetType == avcPacketTypeNALU && codecID == codecIDAVC && s.avcLengthSize > 0:
+			d.FieldFormatOrRawLen("data", d.BitsLeft(), avcAUFormat, format.AvcAuIn{LengthSize: s.avcLengthSize})
+		case packetType == avcPacketTypeNALU && codecID == codecIDHEVC && s.hevcLengthSize > 0:
+			d.FieldFormatOrRawLen("data", d.BitsLeft(), hevcAUFormat, format.HevcAuIn{LengthSize: s.hevcLengthSize})
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
 	}
+}
 
-	fieldScriptDataObject = func() {
-		d.FieldStruct("object", func(d *decode.D) {
-			fieldScriptDataString(d, "name")
-			fieldScriptDataValue(d, "data")
-		})
+func decodeScriptData(d *decode.D) {
+	d.FieldFormat("name", amf0Format, nil)
+	d.FieldFormat("value", amf0Format, nil)
+	// some muxers end script data with an object end marker
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unknown", d.BitsLeft())
 	}
+}
 
-	d.FieldUTF8("signature", 3, d.AssertStr("FLV"))
-	d.FieldU8("version")
-	d.FieldU5("type_flags_reserved", d.AssertU(0))
-	d.FieldU1("type_flags_audio")
-	d.FieldU1("type_flags_reserved", d.AssertU(0))
-	d.FieldU1("type_flags_video")
-	dataOffset := d.FieldU32("data_offset")
+func flvDecode(d *decode.D, _ any) any {
+	var s flvState
 
-	d.SeekAbs(int64(dataOffset) * 8)
+	var dataOffset uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldUTF8("signature", 3, d.AssertStr("FLV"))
+		d.FieldU8("version")
+		d.FieldU5("type_flags_reserved0")
+		d.FieldBool("type_flags_audio")
+		d.FieldU1("type_flags_reserved1")
+		d.FieldBool("type_flags_video")
+		dataOffset = d.FieldU32("data_offset")
+		if dataOffset < headerSize {
+			d.Fatalf("invalid data offset %d", dataOffset)
+		}
+		if dataOffset > headerSize {
+			d.FieldRawLen("unknown", int64(dataOffset-headerSize)*8)
+		}
+	})
+	d.FieldU32("previous_tag_size0", d.ValidateU(0))
 
 	d.FieldArray("tags", func(d *decode.D) {
-		for !d.End() {
+		for d.BitsLeft() >= (tagHeaderSize+4)*8 {
+			dataSize := d.PeekBits(32) & 0xff_ff_ff
+			if int64(tagHeaderSize+dataSize+4)*8 > d.BitsLeft() {
+				break
+			}
+
 			d.FieldStruct("tag", func(d *decode.D) {
-				d.FieldU32("previous_tag_size")
-				tagType := d.FieldU8("tag_type", tagTypeNames)
-				dataSize := d.FieldU24("data_size")
-				d.FieldU24("timestamp")
-				d.FieldU8("timestamp_extended")
+				d.FieldU2("reserved")
+				filter := d.FieldBool("filter")
+				tagType := d.FieldU5("tag_type", tagTypeNames)
+				d.FieldU24("data_size")
+				timestampLow := d.FieldU24("timestamp")
+				timestampExtended := d.FieldU8("timestamp_extended")
+				d.FieldValueU("timestamp_ms", timestampExtended<<24|timestampLow)
 				d.FieldU24("stream_id")
 
-				switch tagType {
-				case audioData, videoData:
-					d.SeekRel(int64(dataSize) * 8)
-				case scriptDataObject:
-					for {
-						if d.PeekBits(24) == typeObjectEnd {
-							d.FieldU24("end")
-							break
+				d.FramedFn(int64(dataSize)*8, func(d *decode.D) {
+					if filter {
+						d.FieldRawLen("data", d.BitsLeft())
+						return
+					}
+					switch tagType {
+					case tagTypeAudio:
+						if d.BitsLeft() > 0 {
+							decodeAudioData(d, &s)
 						}
-						fieldScriptDataObject()
+					case tagTypeVideo:
+						if d.BitsLeft() > 0 {
+							decodeVideoData(d, &s)
+						}
+					case tagTypeScript:
+						decodeScriptData(d)
+					default:
+						d.FieldRawLen("data", d.BitsLeft())
 					}
-				}
+				})
+				d.FieldU32("previous_tag_size", d.ValidateU(tagHeaderSize+dataSize))
 			})
 		}
 	})
 
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("trailing", d.BitsLeft())
+	}
+
 	return nil
 }
@@ -23,12 +23,18 @@ const (
 	UDP_PAYLOAD = "udp_payload" // ex: dns
 
 	AAC_FRAME           = "aac_frame"
+	AC3                 = "ac3"
 	ADTS                = "adts"
 	ADTS_FRAME          = "adts_frame"
 	AMF0                = "amf0"
+	AMR                 = "amr"
+	APE                 = "ape"
 	APEV2               = "apev2"
 	AR                  = "ar"
+	ARROW_IPC           = "arrow_ipc"
+	ASF                 = "asf"
 	ASN1_BER            = "asn1_ber"
+	AVI                 = "avi"
 	AV1_CCR             = "av1_ccr"
 	AV1_FRAME           = "av1_frame"
 	AV1_OBU             = "av1_obu"
@@ -45,48 +51,81 @@ const (
 	BITCOIN_BLOCK       = "bitcoin_block"
 	BITCOIN_SCRIPT      = "bitcoin_script"
 	BITCOIN_TRANSACTION = "bitcoin_transaction"
+	BMP                 = "bmp"
+	BPLIST              = "bplist"
 	BSD_LOOPBACK_FRAME  = "bsd_loopback_frame"
 	BSON                = "bson"
+	BTRFS               = "btrfs"
 	BZIP2               = "bzip2"
+	CAF                 = "caf"
+	CAPNPROTO           = "capnproto"
 	CBOR                = "cbor"
+	CEA_708             = "cea_708"
 	CSV                 = "csv"
+	DEB                 = "deb"
+	DFF                 = "dff"
+	DM_VERITY           = "dm_verity"
 	DNS                 = "dns"
 	DNS_TCP             = "dns_tcp"
+	DSF                 = "dsf"
+	DTS                 = "dts"
+	EAC3                = "eac3"
+	EBML                = "ebml"
 	ELF                 = "elf"
 	ETHER8023_FRAME     = "ether8023_frame"
 	EXIF                = "exif"
 	FAIRPLAY_SPC        = "fairplay_spc"
+	FITS                = "fits"
 	FLAC                = "flac"
 	FLAC_FRAME          = "flac_frame"
 	FLAC_METADATABLOCK  = "flac_metadatablock"
 	FLAC_METADATABLOCKS = "flac_metadatablocks"
 	FLAC_PICTURE        = "flac_picture"
 	FLAC_STREAMINFO     = "flac_streaminfo"
-	FLV                 = "flv" // TODO:
+	FLATBUFFERS         = "flatbuffers"
+	FLV                 = "flv"
+	FSVERITY            = "fsverity"
+	GGUF                = "gguf"
 	GIF                 = "gif"
+	GIT_IDX             = "git_idx"
+	GIT_INDEX           = "git_index"
+	GIT_PACK            = "git_pack"
 	GZIP                = "gzip"
+	HDF5                = "hdf5"
+	HEIF                = "heif"
 	HEVC_ANNEXB         = "hevc_annexb"
 	HEVC_AU             = "hevc_au"
 	HEVC_DCR            = "hevc_dcr"
 	HEVC_NALU           = "hevc_nalu"
 	HEVC_PPS            = "hevc_pps"
+	HEVC_SEI            = "hevc_sei"
 	HEVC_SPS            = "hevc_sps"
 	HEVC_VPS            = "hevc_vps"
+	HIBERFIL            = "hiberfil"
 	HTML                = "html"
 	ICC_PROFILE         = "icc_profile"
 	ICMP                = "icmp"
 	ICMPV6              = "icmpv6"
+	ICO                 = "ico"
 	ID3V1               = "id3v1"
 	ID3V11              = "id3v11"
 	ID3V2               = "id3v2"
+	INNODB_PAGE         = "innodb_page"
 	IPV4_PACKET         = "ipv4_packet"
 	IPV6_PACKET         = "ipv6_packet"
 	JPEG                = "jpeg"
+	JPEG2000            = "jpeg2000"
 	JSON                = "json"
 	JSONL               = "jsonl"
+	KAFKA_LOG           = "kafka_log"
+	LATM_LOAS           = "latm_loas"
+	LINUX_SWAP          = "linux_swap"
+	LZ4                 = "lz4"
+	LZMA                = "lzma"
 	MACHO               = "macho"
 	MACHO_FAT           = "macho_fat"
 	MATROSKA            = "matroska"
+	MINIDUMP            = "minidump"
 	MP3                 = "mp3"
 	MP3_FRAME           = "mp3_frame"
 	MP4                 = "mp4"
@@ -94,26 +133,40 @@ const (
 	MPEG_ES             = "mpeg_es"
 	MPEG_PES            = "mpeg_pes"
 	MPEG_PES_PACKET     = "mpeg_pes_packet"
+	MPEG_PS             = "mpeg_ps"
 	MPEG_SPU            = "mpeg_spu"
 	MPEG_TS             = "mpeg_ts"
 	MSGPACK             = "msgpack"
+	MXF                 = "mxf"
 	OGG                 = "ogg"
 	OGG_PAGE            = "ogg_page"
+	OPENTYPE            = "opentype"
 	OPUS_PACKET         = "opus_packet"
 	PCAP                = "pcap"
 	PCAPNG              = "pcapng"
+	PG_HEAP             = "pg_heap"
+	PICKLE              = "pickle"
 	PNG                 = "png"
+	PREFETCH            = "prefetch"
 	PROTOBUF            = "protobuf"
 	PROTOBUF_WIDEVINE   = "protobuf_widevine"
 	PSSH_PLAYREADY      = "pssh_playready"
 	RAW                 = "raw"
 	RTMP                = "rtmp"
+	SCT_LIST            = "sct_list"
+	SF2                 = "sf2"
 	SLL_PACKET          = "sll_packet"
 	SLL2_PACKET         = "sll2_packet"
+	SQLITE3_JOURNAL     = "sqlite3_journal"
+	SQLITE3_WAL         = "sqlite3_wal"
+	SSTABLE             = "sstable"
 	TAR                 = "tar"
 	TCP_SEGMENT         = "tcp_segment"
 	TIFF                = "tiff"
+	TLS                 = "tls"
 	TOML                = "toml"
+	TORRENT             = "torrent"
+	TRUEHD              = "truehd"
 	UDP_DATAGRAM        = "udp_datagram"
 	VORBIS_COMMENT      = "vorbis_comment"
 	VORBIS_PACKET       = "vorbis_packet"
@@ -123,15 +176,22 @@ const (
 	VPX_CCR             = "vpx_ccr"
 	WAV                 = "wav"
 	WEBP                = "webp"
+	WOFF2               = "woff2"
 	XING                = "xing"
 	XML                 = "xml"
 	YAML                = "yaml"
+	ZFS                 = "zfs"
 	ZIP                 = "zip"
+	ZSTD                = "zstd"
 )
 
 // below are data types used to communicate between formats <FormatName>In/Out
 
 type FlacStreamInfo struct {
+	MinimumBlockSize     uint64
+	MaximumBlockSize     uint64
+	MinimumFrameSize     uint64
+	MaximumFrameSize     uint64
 	SampleRate           uint64
 	BitsPerSample        uint64
 	TotalSamplesInStream uint64
@@ -142,27 +202,42 @@ type FlacStreaminfoOut struct {
 	StreamInfo FlacStreamInfo
 }
 
+type FlacSeekpoint struct {
+	SampleNumber uint64
+	Offset       uint64
+}
+
 type FlacMetadatablockOut struct {
 	IsLastBlock   bool
 	HasStreamInfo bool
 	StreamInfo    FlacStreamInfo
+	Seekpoints    []FlacSeekpoint
 }
 
 type FlacMetadatablocksOut struct {
 	HasStreamInfo bool
 	StreamInfo    FlacStreamInfo
+	Seekpoints    []FlacSeekpoint
+}
+
+type FlacIn struct {
+	DecodeResiduals bool `doc:"Decode residual values in rice partitions"`
+	Validate        bool `doc:"Check spec constraints and add warnings"`
 }
 
 type FlacFrameIn struct {
-	SamplesBuf    []byte
-	BitsPerSample int `doc:"Bits per sample"`
+	SamplesBuf      []byte
+	BitsPerSample   int  `doc:"Bits per sample"`
+	DecodeResiduals bool `doc:"Decode residual values in rice partitions"`
 }
 
 type FlacFrameOut struct {
-	SamplesBuf    []byte
-	Samples       uint64
-	Channels      int
-	BitsPerSample int
+	SamplesBuf     []byte
+	Samples        uint64
+	Channels       int
+	BitsPerSample  int
+	HeaderCRCValid bool
+	FooterCRCValid bool
 }
 
 type OggPageOut struct {
@@ -191,7 +266,18 @@ type HevcDcrOut struct {
 }
 
 type ProtoBufIn struct {
-	Message ProtoBufMessage
+	Message     ProtoBufMessage
+	Descriptor  string `doc:"Serialized FileDescriptorSet, use @path to read from file"`
+	MessageType string `doc:"Full name of message type in descriptor, default first message in last file"`
+}
+
+type FlatBuffersIn struct {
+	Schema   string `doc:"Binary schema (.bfbs), use @path to read from file"`
+	RootType string `doc:"Root table type, default schema root_type"`
+}
+
+type EBMLIn struct {
+	Elements string `doc:"JSON object mapping element ID to name or {name, type, definition}, use @path to read from file"`
 }
 
 type MpegDecoderConfig struct {
@@ -216,6 +302,14 @@ type Mp3In struct {
 	MaxSyncSeek            int `doc:"Max byte distance to next sync"`
 }
 
+type AdtsIn struct {
+	MaxSyncSeek int `doc:"Max byte distance to first sync"`
+}
+
+type MpegTsIn struct {
+	MaxSyncSeek int `doc:"Max byte distance to first sync"`
+}
+
 type MP3FrameOut struct {
 	MPEGVersion      int
 	ProtectionAbsent bool
@@ -265,6 +359,8 @@ type TCPStreamIn struct {
 	SkippedBytes    uint64
 	SourcePort      int
 	DestinationPort int
+	PeerStream      []byte // other direction of the connection, ex: used by tls to find handshake parameters
+	Keylog          string // NSS key log content, ex: used by tls to decrypt records
 }
 
 func (t TCPStreamIn) IsPort(ports ...int) bool {
@@ -283,6 +379,14 @@ func (t TCPStreamIn) MustIsPort(fn func(format string, a ...any), ports ...int)
 	}
 }
 
+type PcapIn struct {
+	Keylog string `doc:"NSS key log (SSLKEYLOGFILE) content used to decrypt TLS"`
+}
+
+type BMPIn struct {
+	Icon bool `doc:"DIB without file header and with AND mask, as used in ICO and CUR"`
+}
+
 type Mp4In struct {
 	DecodeSamples  bool `doc:"Decode supported media samples"`
 	AllowTruncated bool `doc:"Allow box to be truncated"`
@@ -292,6 +396,18 @@ type ZipIn struct {
 	Uncompress bool `doc:"Uncompress and probe files"`
 }
 
+type Lz4In struct {
+	Uncompress bool `doc:"Uncompress blocks and probe content"`
+}
+
+type LzmaIn struct {
+	Uncompress bool `doc:"Uncompress and probe content"`
+}
+
+type ZstdIn struct {
+	Uncompress bool `doc:"Uncompress frames and probe content"`
+}
+
 type XMLIn struct {
 	Seq   bool `doc:"Use seq attribute to preserve element order"`
 	Array bool `doc:"Decode as nested arrays"`
@@ -305,4 +421,9 @@ type HTMLIn struct {
 type CSVLIn struct {
 	Comma   string `doc:"Separator character"`
 	Comment string `doc:"Comment line character"`
+	Header  bool   `doc:"Use first row as header and output objects"`
+}
+
+type InnoDBPageIn struct {
+	PageSize int `doc:"Page size in bytes"`
 }
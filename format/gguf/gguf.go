@@ -0,0 +1,297 @@
+package gguf
+
+// https://github.com/ggml-org/ggml/blob/master/docs/gguf.md
+// https://github.com/ggml-org/ggml/blob/master/include/ggml.h
+
+import (
+	"embed"
+	"math"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed gguf.jq
+var ggufFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.GGUF,
+		Description: "GGML universal file",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    ggufDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(ggufFS)
+}
+
+const (
+	defaultAlignment = 32
+	alignmentKey     = "general.alignment"
+	maxDimensions    = 4
+)
+
+const (
+	valueTypeUint8   = 0
+	valueTypeInt8    = 1
+	valueTypeUint16  = 2
+	valueTypeInt16   = 3
+	valueTypeUint32  = 4
+	valueTypeInt32   = 5
+	valueTypeFloat32 = 6
+	valueTypeBool    = 7
+	valueTypeString  = 8
+	valueTypeArray   = 9
+	valueTypeUint64  = 10
+	valueTypeInt64   = 11
+	valueTypeFloat64 = 12
+)
+
+var valueTypeNames = scalar.UToSymStr{
+	valueTypeUint8:   "uint8",
+	valueTypeInt8:    "int8",
+	valueTypeUint16:  "uint16",
+	valueTypeInt16:   "int16",
+	valueTypeUint32:  "uint32",
+	valueTypeInt32:   "int32",
+	valueTypeFloat32: "float32",
+	valueTypeBool:    "bool",
+	valueTypeString:  "string",
+	valueTypeArray:   "array",
+	valueTypeUint64:  "uint64",
+	valueTypeInt64:   "int64",
+	valueTypeFloat64: "float64",
+}
+
+type tensorType struct {
+	name string
+	// number of elements per block and bytes per block
+	blockSize int64
+	typeSize  int64
+}
+
+var tensorTypes = map[uint64]tensorType{
+	0:  {"f32", 1, 4},
+	1:  {"f16", 1, 2},
+	2:  {"q4_0", 32, 18},
+	3:  {"q4_1", 32, 20},
+	6:  {"q5_0", 32, 22},
+	7:  {"q5_1", 32, 24},
+	8:  {"q8_0", 32, 34},
+	9:  {"q8_1", 32, 36},
+	10: {"q2_k", 256, 84},
+	11: {"q3_k", 256, 110},
+	12: {"q4_k", 256, 144},
+	13: {"q5_k", 256, 176},
+	14: {"q6_k", 256, 210},
+	15: {"q8_k", 256, 292},
+	16: {"iq2_xxs", 256, 66},
+	17: {"iq2_xs", 256, 74},
+	18: {"iq3_xxs", 256, 98},
+	19: {"iq1_s", 256, 50},
+	20: {"iq4_nl", 32, 18},
+	21: {"iq3_s", 256, 110},
+	22: {"iq2_s", 256, 82},
+	23: {"iq4_xs", 256, 136},
+	24: {"i8", 1, 1},
+	25: {"i16", 1, 2},
+	26: {"i32", 1, 4},
+	27: {"i64", 1, 8},
+	28: {"f64", 1, 8},
+	29: {"iq1_m", 256, 56},
+	30: {"bf16", 1, 2},
+	34: {"tq1_0", 256, 54},
+	35: {"tq2_0", 256, 66},
+	39: {"mxfp4", 32, 17},
+}
+
+var tensorTypeNames = func() scalar.UToSymStr {
+	m := scalar.UToSymStr{}
+	for k, t := range tensorTypes {
+		m[k] = t.name
+	}
+	return m
+}()
+
+type decodeContext struct {
+	// version 1 use 32 bit lengths and counts
+	lenBits int
+}
+
+func (dc *decodeContext) fieldLen(d *decode.D, name string) uint64 {
+	return d.FieldU(name, dc.lenBits)
+}
+
+func (dc *decodeContext) fieldString(d *decode.D, name string, lengthName string) string {
+	n := dc.fieldLen(d, lengthName)
+	if n > math.MaxInt32 || int64(n)*8 > d.BitsLeft() {
+		d.Fatalf("string length %d outside input", n)
+	}
+	return d.FieldUTF8(name, int(n))
+}
+
+func (dc *decodeContext) fieldValue(d *decode.D, name string, typ uint64) any {
+	switch typ {
+	case valueTypeUint8:
+		return d.FieldU8(name)
+	case valueTypeInt8:
+		return d.FieldS8(name)
+	case valueTypeUint16:
+		return d.FieldU16(name)
+	case valueTypeInt16:
+		return d.FieldS16(name)
+	case valueTypeUint32:
+		return d.FieldU32(name)
+	case valueTypeInt32:
+		return d.FieldS32(name)
+	case valueTypeFloat32:
+		return d.FieldF32(name)
+	case valueTypeBool:
+		return d.FieldBoolFn(name, func(d *decode.D) bool { return d.U8() != 0 })
+	case valueTypeString:
+		return dc.fieldString(d, name, name+"_length")
+	case valueTypeArray:
+		d.FieldStruct(name, func(d *decode.D) {
+			elemType := d.FieldU32("type", valueTypeNames)
+			n := dc.fieldLen(d, "length")
+			// all values are at least one byte
+			if n > uint64(d.BitsLeft()/8) {
+				d.Fatalf("array length %d outside input", n)
+			}
+			d.FieldArray("values", func(d *decode.D) {
+				for i := uint64(0); i < n; i++ {
+					// string and array elements has more than one field
+					if elemType == valueTypeString || elemType == valueTypeArray {
+						d.FieldStruct("element", func(d *decode.D) {
+							dc.fieldValue(d, "value", elemType)
+						})
+					} else {
+						dc.fieldValue(d, "value", elemType)
+					}
+				}
+			})
+		})
+		return nil
+	case valueTypeUint64:
+		return d.FieldU64(name)
+	case valueTypeInt64:
+		return d.FieldS64(name)
+	case valueTypeFloat64:
+		return d.FieldF64(name)
+	default:
+		d.Fatalf("unknown value type %d", typ)
+		return nil
+	}
+}
+
+type tensorInfo struct {
+	name   string
+	typ    uint64
+	offset uint64
+	// -1 if unknown type
+	size int64
+}
+
+func ggufDecode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	dc := &decodeContext{lenBits: 64}
+	var tensorCount uint64
+	var kvCount uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldUTF8("magic", 4, d.AssertStr("GGUF"))
+		// big endian files have same magic but byte swapped version
+		if v := d.PeekBits(32); v != 0 && v < 0x1_0000 {
+			d.Endian = decode.BigEndian
+		}
+		version := d.FieldU32("version", d.AssertU(1, 2, 3))
+		if version == 1 {
+			dc.lenBits = 32
+		}
+		tensorCount = dc.fieldLen(d, "tensor_count")
+		kvCount = dc.fieldLen(d, "metadata_kv_count")
+	})
+
+	alignment := uint64(defaultAlignment)
+	d.FieldArray("metadata", func(d *decode.D) {
+		for i := uint64(0); i < kvCount; i++ {
+			d.FieldStruct("kv", func(d *decode.D) {
+				key := dc.fieldString(d, "key", "key_length")
+				typ := d.FieldU32("value_type", valueTypeNames)
+				v := dc.fieldValue(d, "value", typ)
+				if key == alignmentKey {
+					if a, ok := v.(uint64); ok && typ == valueTypeUint32 {
+						alignment = a
+					}
+				}
+			})
+		}
+	})
+	if alignment == 0 || alignment&(alignment-1) != 0 {
+		d.Fatalf("invalid alignment %d", alignment)
+	}
+
+	var tensors []tensorInfo
+	d.FieldArray("tensor_infos", func(d *decode.D) {
+		for i := uint64(0); i < tensorCount; i++ {
+			d.FieldStruct("tensor_info", func(d *decode.D) {
+				var t tensorInfo
+				t.name = dc.fieldString(d, "name", "name_length")
+				nDims := d.FieldU32("n_dimensions")
+				if nDims > maxDimensions {
+					d.Fatalf("too many dimensions %d", nDims)
+				}
+				elements := int64(1)
+				d.FieldArray("dimensions", func(d *decode.D) {
+					for j := uint64(0); j < nDims; j++ {
+						n := d.FieldU64("dimension")
+						if n > math.MaxInt32 {
+							d.Fatalf("dimension %d too large", n)
+						}
+						elements *= int64(n)
+					}
+				})
+				t.typ = d.FieldU32("type", tensorTypeNames)
+				t.offset = d.FieldU64("offset")
+				t.size = -1
+				if tt, ok := tensorTypes[t.typ]; ok && elements%tt.blockSize == 0 {
+					t.size = elements / tt.blockSize * tt.typeSize
+					d.FieldValueU("size", uint64(t.size))
+				}
+				tensors = append(tensors, t)
+			})
+		}
+	})
+
+	// tensor data starts at next alignment boundary
+	if rem := uint64(d.Pos()/8) % alignment; rem != 0 {
+		d.FieldRawLen("padding", int64(alignment-rem)*8)
+	}
+	dataStart := d.Pos()
+
+	d.FieldArray("tensors", func(d *decode.D) {
+		for i, t := range tensors {
+			start := dataStart + int64(t.offset)*8
+			size := t.size * 8
+			if t.size < 0 {
+				// unknown type, assume tensor ends at next tensor or end of file
+				size = d.Len() - start
+				if i+1 < len(tensors) {
+					size = dataStart + int64(tensors[i+1].offset)*8 - start
+				}
+			}
+			if start < dataStart || size < 0 || start+size > d.Len() {
+				d.Fatalf("tensor %q data outside file", t.name)
+			}
+			d.SeekAbs(start)
+			d.FieldStruct("tensor", func(d *decode.D) {
+				d.FieldValueStr("name", t.name)
+				d.FieldRawLen("data", size)
+			})
+		}
+	})
+
+	return nil
+}
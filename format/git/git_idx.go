@@ -0,0 +1,113 @@
+package git
+
+// https://git-scm.com/docs/pack-format#_original_version_1_pack_idx_files_have_the_following_format
+
+import (
+	"crypto/sha1"
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed git_idx.jq
+var gitIdxFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.GIT_IDX,
+		Description: "Git packfile index",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    gitIdxDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(gitIdxFS)
+}
+
+const idxV2Magic = 0xff_74_4f_63 // "\377tOc"
+
+const (
+	fanoutEntries = 256
+	// large offset index flag in 32 bit offset table
+	largeOffsetFlag = 0x80_00_00_00
+)
+
+func decodeFanout(d *decode.D) uint64 {
+	var objectCount uint64
+	d.FieldArray("fanout", func(d *decode.D) {
+		var prev uint64
+		for i := 0; i < fanoutEntries; i++ {
+			n := d.FieldU32("count")
+			if n < prev {
+				d.Fatalf("fanout count decreases")
+			}
+			prev = n
+		}
+		objectCount = prev
+	})
+	return objectCount
+}
+
+func gitIdxDecode(d *decode.D, _ any) any {
+	version := uint64(1)
+	if d.PeekBits(32) == idxV2Magic {
+		d.FieldU32("magic", scalar.ActualHex)
+		version = d.FieldU32("version", d.AssertU(2))
+	} else {
+		d.FieldValueU("version", version)
+	}
+
+	// version 1 has no magic, make sure size matches tables
+	objectCount := decodeFanout(d)
+
+	switch version {
+	case 1:
+		if d.BitsLeft() != int64(objectCount)*(32+objectIDLen)+2*objectIDLen {
+			d.Fatalf("size does not match object count")
+		}
+		d.FieldArray("entries", func(d *decode.D) {
+			for i := uint64(0); i < objectCount; i++ {
+				d.FieldStruct("entry", func(d *decode.D) {
+					d.FieldU32("offset")
+					d.FieldRawLen("object_id", objectIDLen, scalar.RawHex)
+				})
+			}
+		})
+	case 2:
+		d.FieldArray("object_ids", func(d *decode.D) {
+			for i := uint64(0); i < objectCount; i++ {
+				d.FieldRawLen("object_id", objectIDLen, scalar.RawHex)
+			}
+		})
+		d.FieldArray("crc32s", func(d *decode.D) {
+			for i := uint64(0); i < objectCount; i++ {
+				d.FieldU32("crc32", scalar.ActualHex)
+			}
+		})
+		largeOffsetCount := 0
+		d.FieldArray("offsets", func(d *decode.D) {
+			for i := uint64(0); i < objectCount; i++ {
+				if d.FieldU32("offset")&largeOffsetFlag != 0 {
+					largeOffsetCount++
+				}
+			}
+		})
+		if largeOffsetCount > 0 {
+			d.FieldArray("large_offsets", func(d *decode.D) {
+				for i := 0; i < largeOffsetCount; i++ {
+					d.FieldU64("offset")
+				}
+			})
+		}
+	}
+
+	d.FieldRawLen("pack_checksum", objectIDLen, scalar.RawHex)
+	checksumStart := d.Pos()
+	sha1Hash := sha1.New()
+	d.CopyBits(sha1Hash, d.BitBufRange(0, checksumStart))
+	d.FieldRawLen("checksum", objectIDLen, d.ValidateBitBuf(sha1Hash.Sum(nil)), scalar.RawHex)
+
+	return nil
+}
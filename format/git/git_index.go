@@ -0,0 +1,202 @@
+package git
+
+// https://git-scm.com/docs/index-format
+// TODO: decode more extensions (UNTR, FSMN, EOIE, IEOT, link, sdir)
+
+import (
+	"crypto/sha1"
+	"embed"
+	"strconv"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed git_index.jq
+var gitIndexFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.GIT_INDEX,
+		Description: "Git index (dircache)",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    gitIndexDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(gitIndexFS)
+}
+
+const (
+	objectTypeRegular = 0b1000
+	objectTypeSymlink = 0b1010
+	objectTypeGitlink = 0b1110
+)
+
+var indexObjectTypeNames = scalar.UToSymStr{
+	objectTypeRegular: "regular",
+	objectTypeSymlink: "symlink",
+	objectTypeGitlink: "gitlink",
+}
+
+func decodeEntryTime(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldU32("seconds", scalar.DescriptionActualUUnixTime)
+		d.FieldU32("nanoseconds")
+	})
+}
+
+func decodeIndexEntry(d *decode.D, version uint64, prevPath string) string {
+	entryStart := d.Pos()
+
+	decodeEntryTime(d, "ctime")
+	decodeEntryTime(d, "mtime")
+	d.FieldU32("dev")
+	d.FieldU32("ino")
+	d.FieldStruct("mode", func(d *decode.D) {
+		d.FieldU16("unused0")
+		d.FieldU4("object_type", indexObjectTypeNames)
+		d.FieldU3("unused1")
+		d.FieldU9("permissions", scalar.ActualOct)
+	})
+	d.FieldU32("uid")
+	d.FieldU32("gid")
+	d.FieldU32("size")
+	d.FieldRawLen("object_id", objectIDLen, scalar.RawHex)
+	var extended bool
+	d.FieldStruct("flags", func(d *decode.D) {
+		d.FieldBool("assume_valid")
+		extended = d.FieldBool("extended")
+		d.FieldU2("stage")
+		d.FieldU12("name_length")
+	})
+	if extended {
+		if version < 3 {
+			d.Fatalf("extended flags requires version 3 or later")
+		}
+		d.FieldStruct("extended_flags", func(d *decode.D) {
+			d.FieldBool("reserved")
+			d.FieldBool("skip_worktree")
+			d.FieldBool("intent_to_add")
+			d.FieldU13("unused")
+		})
+	}
+
+	if version < 4 {
+		path := d.FieldUTF8Null("path")
+		// entry is padded with 1-8 nul bytes to a multiple of 8 bytes, one is the path terminator
+		if padLen := (8 - ((d.Pos()-entryStart)/8)%8) % 8; padLen > 0 {
+			d.FieldRawLen("padding", padLen*8, d.BitBufIsZero())
+		}
+		return path
+	}
+
+	// version 4 path is prefix compressed using previous entry path and is not padded
+	stripLen := d.FieldUFn("path_strip_length", decodeOfsVarint)
+	if stripLen > uint64(len(prevPath)) {
+		d.Fatalf("path strip length %d larger than previous path", stripLen)
+	}
+	suffix := d.FieldUTF8Null("path_suffix")
+	path := prevPath[:len(prevPath)-int(stripLen)] + suffix
+	d.FieldValueStr("path", path)
+
+	return path
+}
+
+// entries are path, entry count and subtree count as ascii followed by object id if valid
+func decodeTreeExtension(d *decode.D) {
+	d.FieldArray("entries", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("entry", func(d *decode.D) {
+				d.FieldUTF8Null("path")
+				entryCountLen := d.PeekFindByte(' ', d.BitsLeft()/8)
+				if entryCountLen == -1 {
+					d.Fatalf("could not find entry count")
+				}
+				entryCountStr := d.FieldUTF8("entry_count", int(entryCountLen), scalar.SymSParseInt(10))
+				d.FieldUTF8("space", 1)
+				subtreeCountLen := d.PeekFindByte('\n', d.BitsLeft()/8)
+				if subtreeCountLen == -1 {
+					d.Fatalf("could not find subtree count")
+				}
+				d.FieldUTF8("subtree_count", int(subtreeCountLen), scalar.SymSParseInt(10))
+				d.FieldUTF8("newline", 1)
+				// negative entry count means invalidated and no object id
+				if n, err := strconv.ParseInt(entryCountStr, 10, 64); err == nil && n >= 0 {
+					d.FieldRawLen("object_id", objectIDLen, scalar.RawHex)
+				}
+			})
+		}
+	})
+}
+
+// entries are path and ascii octal mode for stage 1-3 followed by object ids for non-zero modes
+func decodeResolveUndoExtension(d *decode.D) {
+	d.FieldArray("entries", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("entry", func(d *decode.D) {
+				d.FieldUTF8Null("path")
+				var modes [3]uint64
+				d.FieldArray("modes", func(d *decode.D) {
+					for i := range modes {
+						modeStr := d.FieldUTF8Null("mode", scalar.SymUParseUint(8))
+						n, err := strconv.ParseUint(modeStr, 8, 32)
+						if err != nil {
+							d.Fatalf("invalid mode %q", modeStr)
+						}
+						modes[i] = n
+					}
+				})
+				d.FieldArray("object_ids", func(d *decode.D) {
+					for _, m := range modes {
+						if m != 0 {
+							d.FieldRawLen("object_id", objectIDLen, scalar.RawHex)
+						}
+					}
+				})
+			})
+		}
+	})
+}
+
+func gitIndexDecode(d *decode.D, _ any) any {
+	d.FieldUTF8("signature", 4, d.AssertStr("DIRC"))
+	version := d.FieldU32("version", d.AssertU(2, 3, 4))
+	entryCount := d.FieldU32("entry_count")
+
+	d.FieldArray("entries", func(d *decode.D) {
+		var prevPath string
+		for i := uint64(0); i < entryCount; i++ {
+			d.FieldStruct("entry", func(d *decode.D) {
+				prevPath = decodeIndexEntry(d, version, prevPath)
+			})
+		}
+	})
+
+	d.FieldArray("extensions", func(d *decode.D) {
+		for d.BitsLeft() > objectIDLen {
+			d.FieldStruct("extension", func(d *decode.D) {
+				signature := d.FieldUTF8("signature", 4)
+				size := d.FieldU32("size")
+				d.FramedFn(int64(size)*8, func(d *decode.D) {
+					switch signature {
+					case "TREE":
+						decodeTreeExtension(d)
+					case "REUC":
+						decodeResolveUndoExtension(d)
+					default:
+						d.FieldRawLen("data", d.BitsLeft())
+					}
+				})
+			})
+		}
+	})
+
+	checksumStart := d.Pos()
+	sha1Hash := sha1.New()
+	d.CopyBits(sha1Hash, d.BitBufRange(0, checksumStart))
+	d.FieldRawLen("checksum", objectIDLen, d.ValidateBitBuf(sha1Hash.Sum(nil)), scalar.RawHex)
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package git
+
+// https://git-scm.com/docs/pack-format
+// TODO: sha1 validation of objects would require resolving deltas
+
+import (
+	"compress/zlib"
+	"crypto/sha1"
+	"embed"
+	"io"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/internal/ioex"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed git_pack.jq
+var gitPackFS embed.FS
+
+var probeFormat decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.GIT_PACK,
+		Description: "Git packfile",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    gitPackDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.PROBE}, Group: &probeFormat},
+		},
+		Functions: []string{"_help"},
+	})
+	interp.RegisterFS(gitPackFS)
+}
+
+const (
+	objectCommit   = 1
+	objectTree     = 2
+	objectBlob     = 3
+	objectTag      = 4
+	objectOfsDelta = 6
+	objectRefDelta = 7
+)
+
+var objectTypeNames = scalar.UToSymStr{
+	objectCommit:   "commit",
+	objectTree:     "tree",
+	objectBlob:     "blob",
+	objectTag:      "tag",
+	objectOfsDelta: "ofs_delta",
+	objectRefDelta: "ref_delta",
+}
+
+const objectIDLen = 20 * 8
+
+// size is little endian 7 bit groups with msb as continuation bit
+func decodeSizeVarint(d *decode.D) uint64 {
+	var n uint64
+	for i := 0; ; i += 7 {
+		b := d.U8()
+		n |= (b & 0x7f) << i
+		if b&0x80 == 0 {
+			return n
+		}
+	}
+}
+
+// negative base offset as big endian 7 bit groups where each continuation adds one
+func decodeOfsVarint(d *decode.D) uint64 {
+	b := d.U8()
+	n := b & 0x7f
+	for b&0x80 != 0 {
+		b = d.U8()
+		n = ((n + 1) << 7) | (b & 0x7f)
+	}
+	return n
+}
+
+func decodeTree(d *decode.D, _ any) any {
+	d.FieldArray("entries", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("entry", func(d *decode.D) {
+				modeLen := d.PeekFindByte(' ', d.BitsLeft()/8)
+				if modeLen == -1 {
+					d.Fatalf("could not find mode")
+				}
+				d.FieldUTF8("mode", int(modeLen), scalar.SymUParseUint(8))
+				d.FieldUTF8("space", 1)
+				d.FieldUTF8Null("name")
+				d.FieldRawLen("object_id", objectIDLen, scalar.RawHex)
+			})
+		}
+	})
+	return nil
+}
+
+// commit and tag objects are header lines, an empty line and a message
+func decodeCommit(d *decode.D, _ any) any {
+	d.FieldArray("headers", func(d *decode.D) {
+		for !d.End() {
+			lineLen := d.PeekFindByte('\n', d.BitsLeft()/8)
+			if lineLen == -1 {
+				d.Fatalf("could not find header end")
+			}
+			if lineLen == 0 {
+				break
+			}
+			d.FieldUTF8("header", int(lineLen+1), scalar.ActualTrimSpace)
+		}
+	})
+	if !d.End() {
+		d.FieldUTF8("separator", 1)
+		d.FieldUTF8("message", int(d.BitsLeft()/8))
+	}
+	return nil
+}
+
+func decodeDelta(d *decode.D, _ any) any {
+	d.FieldUFn("base_size", decodeSizeVarint)
+	d.FieldUFn("result_size", decodeSizeVarint)
+	d.FieldArray("instructions", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("instruction", func(d *decode.D) {
+				if d.FieldBool("copy") {
+					sizePresent := d.FieldU3("size_present", scalar.ActualBin)
+					offsetPresent := d.FieldU4("offset_present", scalar.ActualBin)
+					// little endian bytes for each present bit
+					presentBytesFn := func(present uint64, n int) func(d *decode.D) uint64 {
+						return func(d *decode.D) uint64 {
+							var v uint64
+							for i := 0; i < n; i++ {
+								if present&(1<<i) != 0 {
+									v |= d.U8() << (i * 8)
+								}
+							}
+							return v
+						}
+					}
+					d.FieldUFn("offset", presentBytesFn(offsetPresent, 4))
+					d.FieldUFn("size", presentBytesFn(sizePresent, 3), copySizeMap)
+				} else {
+					size := d.FieldU7("size")
+					if size == 0 {
+						d.Fatalf("reserved insert size 0")
+					}
+					d.FieldRawLen("data", int64(size)*8)
+				}
+			})
+		}
+	})
+	return nil
+}
+
+// copy size 0 means 0x10000
+var copySizeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	if s.ActualU() == 0 {
+		s.Actual = uint64(0x10000)
+	}
+	return s, nil
+})
+
+var commitFormat = decode.FormatFn(decodeCommit)
+var treeFormat = decode.FormatFn(decodeTree)
+var deltaFormat = decode.FormatFn(decodeDelta)
+
+func gitPackDecode(d *decode.D, _ any) any {
+	d.FieldUTF8("signature", 4, d.AssertStr("PACK"))
+	d.FieldU32("version", d.AssertU(2, 3))
+	objectCount := d.FieldU32("object_count")
+
+	zlibRFn := func(r io.Reader) io.Reader {
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return ioex.ErrReader{Err: err}
+		}
+		return zr
+	}
+
+	d.FieldArray("objects", func(d *decode.D) {
+		for i := uint64(0); i < objectCount; i++ {
+			d.FieldStruct("object", func(d *decode.D) {
+				objectStart := d.Pos()
+				// first byte has continuation bit, 3 bit type and lowest 4 bits of size
+				b := d.U8()
+				d.SeekRel(-8)
+				objectType := (b >> 4) & 0x7
+				d.FieldValueU("type", objectType, objectTypeNames)
+				size := d.FieldUFn("size", func(d *decode.D) uint64 {
+					b := d.U8()
+					n := b & 0xf
+					if b&0x80 != 0 {
+						n |= decodeSizeVarint(d) << 4
+					}
+					return n
+				})
+
+				var group decode.Group
+				switch objectType {
+				case objectCommit, objectTag:
+					group = commitFormat
+				case objectTree:
+					group = treeFormat
+				case objectBlob:
+					group = probeFormat
+				case objectOfsDelta:
+					relOffset := d.FieldUFn("base_relative_offset", decodeOfsVarint)
+					d.FieldValueU("base_offset", uint64(objectStart/8)-relOffset)
+					group = deltaFormat
+				case objectRefDelta:
+					d.FieldRawLen("base_object_id", objectIDLen, scalar.RawHex)
+					group = deltaFormat
+				default:
+					d.Fatalf("unknown object type %d", objectType)
+				}
+
+				readCompressedSize, uncompressedBR, dv, _, err := d.TryFieldReaderRangeFormat("uncompressed", d.Pos(), d.BitsLeft(), zlibRFn, group, nil)
+				if uncompressedBR == nil {
+					d.Fatalf("failed to uncompress object: %s", err)
+				}
+				if dv == nil {
+					d.FieldRootBitBuf("uncompressed", uncompressedBR)
+				}
+				d.FieldRawLen("compressed", readCompressedSize)
+
+				if uncompressedLen, err := uncompressedBR.SeekBits(0, io.SeekEnd); err == nil && uint64(uncompressedLen/8) != size {
+					d.Errorf("uncompressed size %d does not match object size %d", uncompressedLen/8, size)
+				}
+			})
+		}
+	})
+
+	checksumStart := d.Pos()
+	sha1Hash := sha1.New()
+	d.CopyBits(sha1Hash, d.BitBufRange(0, checksumStart))
+	d.FieldRawLen("checksum", objectIDLen, d.ValidateBitBuf(sha1Hash.Sum(nil)), scalar.RawHex)
+
+	return nil
+}
@@ -0,0 +1,416 @@
+package hdf5
+
+// https://docs.hdfgroup.org/hdf5/develop/_f_m_t3.html
+
+// TODO: v2 B-trees, fractal heaps and dense link and attribute storage
+// TODO: layout message version 4 chunk indexes
+// TODO: global heap and variable length data
+// TODO: filtered (compressed) chunks
+
+import (
+	"bytes"
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/checksum"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed hdf5.jq
+var hdf5FS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.HDF5,
+		Description: "Hierarchical Data Format 5",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    hdf5Decode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(hdf5FS)
+}
+
+const signature = "\x89HDF\r\n\x1a\n"
+
+// superblock is at 0 or at a power of two after a user block
+var superblockOffsets = []int64{0, 512, 1024, 2048, 4096, 8192, 16384, 32768, 65536}
+
+type file struct {
+	offsetSize  int
+	lengthSize  int
+	baseAddress int64
+	undefined   uint64
+	addrMapper  scalar.Mapper
+	seen        map[uint64]bool
+}
+
+func (f *file) fieldAddress(d *decode.D, name string) uint64 {
+	return d.FieldU(name, f.offsetSize*8, f.addrMapper, scalar.ActualHex)
+}
+
+func (f *file) fieldLength(d *decode.D, name string) uint64 {
+	return d.FieldU(name, f.lengthSize*8)
+}
+
+// absolute bit position for address and if it and nBytes is inside buffer
+func (f *file) pos(d *decode.D, addr uint64, nBytes int64) (int64, bool) {
+	if addr == f.undefined {
+		return 0, false
+	}
+	p := (f.baseAddress + int64(addr)) * 8
+	if p < 0 || nBytes < 0 || p+nBytes*8 > d.Len() {
+		return 0, false
+	}
+	return p, true
+}
+
+// first visit of structure at address
+func (f *file) visit(addr uint64) bool {
+	if f.seen[addr] {
+		return false
+	}
+	f.seen[addr] = true
+	return true
+}
+
+// checksum of bytes between start and current position
+func fieldChecksum(d *decode.D, start int64) {
+	b := d.BytesRange(start, int((d.Pos()-start)/8))
+	d.FieldU32("checksum", d.ValidateU(uint64(checksum.Lookup3(b, 0))), scalar.ActualHex)
+}
+
+const (
+	cacheTypeNone        = 0
+	cacheTypeSymbolTable = 1
+	cacheTypeSymlink     = 2
+)
+
+var cacheTypeNames = scalar.UToSymStr{
+	cacheTypeNone:        "none",
+	cacheTypeSymbolTable: "symbol_table",
+	cacheTypeSymlink:     "symbolic_link",
+}
+
+type symbolTableEntry struct {
+	nameOffset          uint64
+	objectHeaderAddress uint64
+}
+
+func decodeSymbolTableEntry(d *decode.D, f *file, heap *localHeap) symbolTableEntry {
+	var e symbolTableEntry
+	if heap != nil {
+		e.nameOffset = d.FieldU("link_name_offset", f.offsetSize*8, heap.nameMapper(d))
+	} else {
+		e.nameOffset = f.fieldAddress(d, "link_name_offset")
+	}
+	e.objectHeaderAddress = f.fieldAddress(d, "object_header_address")
+	cacheType := d.FieldU32("cache_type", cacheTypeNames)
+	d.FieldU32("reserved")
+	d.FramedFn(16*8, func(d *decode.D) {
+		switch cacheType {
+		case cacheTypeSymbolTable:
+			f.fieldAddress(d, "btree_address")
+			f.fieldAddress(d, "heap_address")
+		case cacheTypeSymlink:
+			d.FieldU32("link_value_offset")
+		}
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("scratch_pad", d.BitsLeft())
+		}
+	})
+	return e
+}
+
+type localHeap struct {
+	dataSegment []byte
+}
+
+func (h *localHeap) name(offset uint64) (string, bool) {
+	if h == nil || offset >= uint64(len(h.dataSegment)) {
+		return "", false
+	}
+	b := h.dataSegment[offset:]
+	if i := bytes.IndexByte(b, 0); i != -1 {
+		b = b[:i]
+	}
+	return string(b), true
+}
+
+func (h *localHeap) nameMapper(d *decode.D) scalar.Mapper {
+	return scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		if n, ok := h.name(s.ActualU()); ok {
+			s.Sym = n
+		}
+		return s, nil
+	})
+}
+
+func decodeLocalHeap(d *decode.D, f *file) *localHeap {
+	h := &localHeap{}
+	d.FieldUTF8("signature", 4, d.AssertStr("HEAP"))
+	d.FieldU8("version")
+	d.FieldRawLen("reserved", 3*8)
+	segmentSize := f.fieldLength(d, "data_segment_size")
+	d.FieldU("free_list_head_offset", f.lengthSize*8, scalar.UToSymStr{f.undefined: "none"})
+	segmentAddr := f.fieldAddress(d, "data_segment_address")
+	if p, ok := f.pos(d, segmentAddr, int64(segmentSize)); ok {
+		h.dataSegment = d.BytesRange(p, int(segmentSize))
+		d.SeekAbs(p, func(d *decode.D) { d.FieldRawLen("data_segment", int64(segmentSize)*8) })
+	}
+	return h
+}
+
+const (
+	btreeNodeTypeGroup = 0
+	btreeNodeTypeChunk = 1
+)
+
+var btreeNodeTypeNames = scalar.UToSymStr{
+	btreeNodeTypeGroup: "group",
+	btreeNodeTypeChunk: "raw_data_chunk",
+}
+
+type link struct {
+	name    string
+	address uint64
+}
+
+// version 1 B-tree node, group nodes point to symbol table nodes and chunk nodes to raw chunk data
+func decodeBtreeNode(d *decode.D, f *file, heap *localHeap, dimensionality int, links *[]link) {
+	d.FieldUTF8("signature", 4, d.AssertStr("TREE"))
+	nodeType := d.FieldU8("node_type", btreeNodeTypeNames)
+	nodeLevel := d.FieldU8("node_level")
+	entriesUsed := d.FieldU16("entries_used")
+	f.fieldAddress(d, "left_sibling_address")
+	f.fieldAddress(d, "right_sibling_address")
+
+	decodeKey := func(d *decode.D) uint64 {
+		if nodeType == btreeNodeTypeGroup {
+			d.FieldU("key", f.lengthSize*8, heap.nameMapper(d))
+			return 0
+		}
+		var chunkSize uint64
+		d.FieldStruct("key", func(d *decode.D) {
+			chunkSize = d.FieldU32("chunk_size")
+			d.FieldU32("filter_mask", scalar.ActualHex)
+			d.FieldArray("offsets", func(d *decode.D) {
+				for i := 0; i < dimensionality; i++ {
+					d.FieldU64("offset")
+				}
+			})
+		})
+		return chunkSize
+	}
+
+	d.FieldArray("entries", func(d *decode.D) {
+		for i := uint64(0); i < entriesUsed; i++ {
+			d.FieldStruct("entry", func(d *decode.D) {
+				chunkSize := decodeKey(d)
+				childAddr := f.fieldAddress(d, "child_address")
+				switch {
+				case nodeLevel > 0:
+					if p, ok := f.pos(d, childAddr, 0); ok && f.visit(childAddr) {
+						d.SeekAbs(p, func(d *decode.D) {
+							d.FieldStruct("node", func(d *decode.D) {
+								decodeBtreeNode(d, f, heap, dimensionality, links)
+							})
+						})
+					}
+				case nodeType == btreeNodeTypeGroup:
+					if p, ok := f.pos(d, childAddr, 0); ok && f.visit(childAddr) {
+						d.SeekAbs(p, func(d *decode.D) {
+							d.FieldStruct("symbol_table_node", func(d *decode.D) {
+								decodeSymbolTableNode(d, f, heap, links)
+							})
+						})
+					}
+				case nodeType == btreeNodeTypeChunk:
+					if p, ok := f.pos(d, childAddr, int64(chunkSize)); ok {
+						d.RangeFn(p, int64(chunkSize)*8, func(d *decode.D) {
+							d.FieldRawLen("chunk", int64(chunkSize)*8)
+						})
+					}
+				}
+			})
+		}
+	})
+	decodeKey(d)
+}
+
+func decodeSymbolTableNode(d *decode.D, f *file, heap *localHeap, links *[]link) {
+	d.FieldUTF8("signature", 4, d.AssertStr("SNOD"))
+	d.FieldU8("version")
+	d.FieldU8("reserved")
+	numSymbols := d.FieldU16("number_of_symbols")
+	d.FieldArray("entries", func(d *decode.D) {
+		for i := uint64(0); i < numSymbols; i++ {
+			d.FieldStruct("entry", func(d *decode.D) {
+				e := decodeSymbolTableEntry(d, f, heap)
+				name, _ := heap.name(e.nameOffset)
+				*links = append(*links, link{name: name, address: e.objectHeaderAddress})
+			})
+		}
+	})
+}
+
+func decodeObject(d *decode.D, f *file, addr uint64) {
+	oi := decodeObjectHeader(d, f, addr)
+
+	var layout *dataLayout
+	var links []link
+	for _, m := range oi.messages {
+		switch m := m.(type) {
+		case *dataLayout:
+			layout = m
+		case link:
+			links = append(links, m)
+		}
+	}
+
+	switch {
+	case oi.symbolTable != nil:
+		d.FieldValueStr("type", "group")
+	case oi.isGroup:
+		d.FieldValueStr("type", "group")
+	case layout != nil:
+		d.FieldValueStr("type", "dataset")
+	case oi.hasDatatype:
+		d.FieldValueStr("type", "datatype")
+	}
+
+	if st := oi.symbolTable; st != nil {
+		var heap *localHeap
+		if p, ok := f.pos(d, st.heapAddress, 0); ok {
+			d.SeekAbs(p, func(d *decode.D) {
+				d.FieldStruct("local_heap", func(d *decode.D) { heap = decodeLocalHeap(d, f) })
+			})
+		}
+		if p, ok := f.pos(d, st.btreeAddress, 0); ok && f.visit(st.btreeAddress) {
+			d.SeekAbs(p, func(d *decode.D) {
+				d.FieldStruct("btree", func(d *decode.D) { decodeBtreeNode(d, f, heap, 0, &links) })
+			})
+		}
+	}
+
+	if layout != nil {
+		switch layout.class {
+		case layoutClassContiguous:
+			if p, ok := f.pos(d, layout.address, int64(layout.size)); ok && layout.size > 0 {
+				d.RangeFn(p, int64(layout.size)*8, func(d *decode.D) {
+					d.FieldRawLen("data", int64(layout.size)*8)
+				})
+			}
+		case layoutClassChunked:
+			if p, ok := f.pos(d, layout.address, 0); ok && f.visit(layout.address) {
+				d.SeekAbs(p, func(d *decode.D) {
+					d.FieldStruct("chunk_btree", func(d *decode.D) {
+						decodeBtreeNode(d, f, nil, layout.dimensionality, nil)
+					})
+				})
+			}
+		}
+	}
+
+	if len(links) > 0 {
+		d.FieldArray("links", func(d *decode.D) {
+			for _, l := range links {
+				d.FieldStruct("link", func(d *decode.D) {
+					d.FieldValueStr("name", l.name)
+					if l.address == f.undefined {
+						return
+					}
+					d.FieldValueU("object_header_address", l.address, scalar.ActualHex)
+					// hard links can make cycles, only decode first
+					if _, ok := f.pos(d, l.address, 0); ok && f.visit(l.address) {
+						d.FieldStruct("object", func(d *decode.D) { decodeObject(d, f, l.address) })
+					}
+				})
+			}
+		})
+	}
+}
+
+func decodeSuperblock(d *decode.D, f *file) (rootAddr uint64) {
+	start := d.Pos()
+	d.FieldRawLen("signature", 8*8, d.AssertBitBuf([]byte(signature)))
+	version := d.FieldU8("version", d.AssertU(0, 1, 2, 3))
+
+	setSizes := func(offsetSize, lengthSize uint64) {
+		f.offsetSize = int(offsetSize)
+		f.lengthSize = int(lengthSize)
+		f.undefined = uint64(1)<<(offsetSize*8) - 1
+		if offsetSize == 8 {
+			f.undefined = 0xffff_ffff_ffff_ffff
+		}
+		f.addrMapper = scalar.UToSymStr{f.undefined: "undefined"}
+	}
+
+	switch version {
+	case 0, 1:
+		d.FieldU8("free_space_version")
+		d.FieldU8("root_group_symbol_table_entry_version")
+		d.FieldU8("reserved0")
+		d.FieldU8("shared_header_message_format_version")
+		offsetSize := d.FieldU8("size_of_offsets", d.AssertU(2, 4, 8))
+		lengthSize := d.FieldU8("size_of_lengths", d.AssertU(2, 4, 8))
+		setSizes(offsetSize, lengthSize)
+		d.FieldU8("reserved1")
+		d.FieldU16("group_leaf_node_k")
+		d.FieldU16("group_internal_node_k")
+		d.FieldU32("file_consistency_flags", scalar.ActualHex)
+		if version == 1 {
+			d.FieldU16("indexed_storage_internal_node_k")
+			d.FieldU16("reserved2")
+		}
+		f.baseAddress = int64(f.fieldAddress(d, "base_address"))
+		f.fieldAddress(d, "free_space_info_address")
+		f.fieldAddress(d, "end_of_file_address")
+		f.fieldAddress(d, "driver_info_block_address")
+		d.FieldStruct("root_group_symbol_table_entry", func(d *decode.D) {
+			rootAddr = decodeSymbolTableEntry(d, f, nil).objectHeaderAddress
+		})
+	case 2, 3:
+		offsetSize := d.FieldU8("size_of_offsets", d.AssertU(2, 4, 8))
+		lengthSize := d.FieldU8("size_of_lengths", d.AssertU(2, 4, 8))
+		setSizes(offsetSize, lengthSize)
+		d.FieldU8("file_consistency_flags", scalar.ActualHex)
+		f.baseAddress = int64(f.fieldAddress(d, "base_address"))
+		f.fieldAddress(d, "superblock_extension_address")
+		f.fieldAddress(d, "end_of_file_address")
+		rootAddr = f.fieldAddress(d, "root_group_object_header_address")
+		fieldChecksum(d, start)
+	}
+
+	return rootAddr
+}
+
+func hdf5Decode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	superblockPos := int64(-1)
+	for _, offset := range superblockOffsets {
+		if d.Len() >= (offset+int64(len(signature)))*8 &&
+			string(d.BytesRange(offset*8, len(signature))) == signature {
+			superblockPos = offset * 8
+			break
+		}
+	}
+	if superblockPos == -1 {
+		d.Fatalf("no superblock signature found")
+	}
+
+	f := &file{seen: map[uint64]bool{}}
+	if superblockPos > 0 {
+		d.FieldRawLen("user_block", superblockPos)
+	}
+	var rootAddr uint64
+	d.FieldStruct("superblock", func(d *decode.D) { rootAddr = decodeSuperblock(d, f) })
+
+	if _, ok := f.pos(d, rootAddr, 0); ok && f.visit(rootAddr) {
+		d.FieldStruct("root_group", func(d *decode.D) { decodeObject(d, f, rootAddr) })
+	}
+
+	return nil
+}
@@ -0,0 +1,765 @@
+package hdf5
+
+import (
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const (
+	messageTypeNil                  = 0x00
+	messageTypeDataspace            = 0x01
+	messageTypeLinkInfo             = 0x02
+	messageTypeDatatype             = 0x03
+	messageTypeFillValueOld         = 0x04
+	messageTypeFillValue            = 0x05
+	messageTypeLink                 = 0x06
+	messageTypeExternalDataFiles    = 0x07
+	messageTypeDataLayout           = 0x08
+	messageTypeBogus                = 0x09
+	messageTypeGroupInfo            = 0x0a
+	messageTypeFilterPipeline       = 0x0b
+	messageTypeAttribute            = 0x0c
+	messageTypeObjectComment        = 0x0d
+	messageTypeModificationTimeOld  = 0x0e
+	messageTypeSharedMessageTable   = 0x0f
+	messageTypeContinuation         = 0x10
+	messageTypeSymbolTable          = 0x11
+	messageTypeModificationTime     = 0x12
+	messageTypeBtreeKValues         = 0x13
+	messageTypeDriverInfo           = 0x14
+	messageTypeAttributeInfo        = 0x15
+	messageTypeObjectReferenceCount = 0x16
+	messageTypeFileSpaceInfo        = 0x17
+)
+
+var messageTypeNames = scalar.UToSymStr{
+	messageTypeNil:                  "nil",
+	messageTypeDataspace:            "dataspace",
+	messageTypeLinkInfo:             "link_info",
+	messageTypeDatatype:             "datatype",
+	messageTypeFillValueOld:         "fill_value_old",
+	messageTypeFillValue:            "fill_value",
+	messageTypeLink:                 "link",
+	messageTypeExternalDataFiles:    "external_data_files",
+	messageTypeDataLayout:           "data_layout",
+	messageTypeBogus:                "bogus",
+	messageTypeGroupInfo:            "group_info",
+	messageTypeFilterPipeline:       "filter_pipeline",
+	messageTypeAttribute:            "attribute",
+	messageTypeObjectComment:        "object_comment",
+	messageTypeModificationTimeOld:  "modification_time_old",
+	messageTypeSharedMessageTable:   "shared_message_table",
+	messageTypeContinuation:         "continuation",
+	messageTypeSymbolTable:          "symbol_table",
+	messageTypeModificationTime:     "modification_time",
+	messageTypeBtreeKValues:         "btree_k_values",
+	messageTypeDriverInfo:           "driver_info",
+	messageTypeAttributeInfo:        "attribute_info",
+	messageTypeObjectReferenceCount: "object_reference_count",
+	messageTypeFileSpaceInfo:        "file_space_info",
+}
+
+type continuation struct {
+	address uint64
+	length  uint64
+}
+
+type symbolTable struct {
+	btreeAddress uint64
+	heapAddress  uint64
+}
+
+const (
+	layoutClassCompact    = 0
+	layoutClassContiguous = 1
+	layoutClassChunked    = 2
+	layoutClassVirtual    = 3
+)
+
+var layoutClassNames = scalar.UToSymStr{
+	layoutClassCompact:    "compact",
+	layoutClassContiguous: "contiguous",
+	layoutClassChunked:    "chunked",
+	layoutClassVirtual:    "virtual",
+}
+
+type dataLayout struct {
+	class          uint64
+	address        uint64
+	size           uint64
+	dimensionality int
+}
+
+type objectInfo struct {
+	messages    []any
+	symbolTable *symbolTable
+	isGroup     bool
+	hasDatatype bool
+}
+
+// message flags, bit 1 means data is a shared message reference
+func decodeMessageFlags(d *decode.D) (shared bool) {
+	d.FieldStruct("flags", func(d *decode.D) {
+		d.FieldBool("fail_if_unknown_always")
+		d.FieldBool("shareable")
+		d.FieldBool("modified_by_unknown")
+		d.FieldBool("mark_if_unknown")
+		d.FieldBool("fail_if_unknown_and_writable")
+		d.FieldBool("do_not_share")
+		shared = d.FieldBool("shared")
+		d.FieldBool("constant")
+	})
+	return shared
+}
+
+func decodeMessage(d *decode.D, f *file, oi *objectInfo, conts *[]continuation, version int, creationOrder bool) {
+	var messageType uint64
+	var size uint64
+	var shared bool
+	if version == 1 {
+		messageType = d.FieldU16("type", messageTypeNames)
+		size = d.FieldU16("size")
+		shared = decodeMessageFlags(d)
+		d.FieldRawLen("reserved", 3*8)
+	} else {
+		messageType = d.FieldU8("type", messageTypeNames)
+		size = d.FieldU16("size")
+		shared = decodeMessageFlags(d)
+		if creationOrder {
+			d.FieldU16("creation_order")
+		}
+	}
+	if size == 0 {
+		return
+	}
+
+	d.FramedFn(int64(size)*8, func(d *decode.D) {
+		fn, ok := messageFns[messageType]
+		if !ok || shared {
+			d.FieldRawLen("data", d.BitsLeft())
+			return
+		}
+		d.FieldStruct("data", func(d *decode.D) {
+			m := fn(d, f)
+			switch m := m.(type) {
+			case continuation:
+				*conts = append(*conts, m)
+			case *symbolTable:
+				oi.symbolTable = m
+			case nil:
+			default:
+				oi.messages = append(oi.messages, m)
+			}
+			switch messageType {
+			case messageTypeLinkInfo, messageTypeGroupInfo, messageTypeLink:
+				oi.isGroup = true
+			case messageTypeDatatype:
+				oi.hasDatatype = true
+			}
+			if d.BitsLeft() > 0 {
+				d.FieldRawLen("padding", d.BitsLeft())
+			}
+		})
+	})
+}
+
+func decodeObjectHeaderV1(d *decode.D, f *file, oi *objectInfo, conts *[]continuation, count *uint64) uint64 {
+	d.FieldU8("version", d.AssertU(1))
+	d.FieldU8("reserved0")
+	numMessages := d.FieldU16("number_of_messages")
+	d.FieldU32("object_reference_count")
+	headerSize := d.FieldU32("object_header_size")
+	// messages are 8 byte aligned
+	d.FieldU32("reserved1")
+	decodeMessagesV1(d, f, oi, conts, int64(headerSize), count, numMessages)
+	return numMessages
+}
+
+func decodeMessagesV1(d *decode.D, f *file, oi *objectInfo, conts *[]continuation, nBytes int64, count *uint64, numMessages uint64) {
+	d.FramedFn(nBytes*8, func(d *decode.D) {
+		d.FieldArray("messages", func(d *decode.D) {
+			for *count < numMessages && d.BitsLeft() >= 8*8 {
+				d.FieldStruct("message", func(d *decode.D) { decodeMessage(d, f, oi, conts, 1, false) })
+				*count++
+			}
+		})
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("gap", d.BitsLeft())
+		}
+	})
+}
+
+// messages in a version 2 chunk, checksum is after messages and gap
+func decodeMessagesV2(d *decode.D, f *file, oi *objectInfo, conts *[]continuation, start int64, nBytes int64, creationOrder bool) {
+	headerBits := int64(4 * 8)
+	if creationOrder {
+		headerBits += 2 * 8
+	}
+	d.FramedFn(nBytes*8, func(d *decode.D) {
+		d.FieldArray("messages", func(d *decode.D) {
+			for d.BitsLeft() >= headerBits {
+				d.FieldStruct("message", func(d *decode.D) { decodeMessage(d, f, oi, conts, 2, creationOrder) })
+			}
+		})
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("gap", d.BitsLeft())
+		}
+	})
+	fieldChecksum(d, start)
+}
+
+func decodeObjectHeaderV2(d *decode.D, f *file, oi *objectInfo, conts *[]continuation) bool {
+	start := d.Pos()
+	d.FieldUTF8("signature", 4, d.AssertStr("OHDR"))
+	d.FieldU8("version", d.AssertU(2))
+	var timesStored, phaseChangeStored, creationOrder bool
+	var chunk0SizeBits uint64
+	d.FieldStruct("flags", func(d *decode.D) {
+		d.FieldU2("reserved")
+		timesStored = d.FieldBool("times_stored")
+		phaseChangeStored = d.FieldBool("attribute_phase_change_stored")
+		d.FieldBool("attribute_creation_order_indexed")
+		creationOrder = d.FieldBool("attribute_creation_order_tracked")
+		chunk0SizeBits = d.FieldU2("chunk0_size_size", scalar.UToSymU{0: 1, 1: 2, 2: 4, 3: 8})
+	})
+	if timesStored {
+		d.FieldU32("access_time", scalar.DescriptionActualUUnixTime)
+		d.FieldU32("modification_time", scalar.DescriptionActualUUnixTime)
+		d.FieldU32("change_time", scalar.DescriptionActualUUnixTime)
+		d.FieldU32("birth_time", scalar.DescriptionActualUUnixTime)
+	}
+	if phaseChangeStored {
+		d.FieldU16("max_compact_attributes")
+		d.FieldU16("min_dense_attributes")
+	}
+	chunk0Size := d.FieldU("size_of_chunk0", (1<<chunk0SizeBits)*8)
+	decodeMessagesV2(d, f, oi, conts, start, int64(chunk0Size), creationOrder)
+	return creationOrder
+}
+
+func decodeObjectHeader(d *decode.D, f *file, addr uint64) objectInfo {
+	var oi objectInfo
+	var conts []continuation
+	p, _ := f.pos(d, addr, 0)
+
+	d.SeekAbs(p, func(d *decode.D) {
+		d.FieldStruct("object_header", func(d *decode.D) {
+			version := 1
+			creationOrder := false
+			numMessages := uint64(0)
+			count := uint64(0)
+			if string(d.PeekBytes(4)) == "OHDR" {
+				version = 2
+				creationOrder = decodeObjectHeaderV2(d, f, &oi, &conts)
+			} else {
+				numMessages = decodeObjectHeaderV1(d, f, &oi, &conts, &count)
+			}
+			if len(conts) == 0 {
+				return
+			}
+
+			// continuation messages can add more blocks
+			d.FieldArray("continuation_blocks", func(d *decode.D) {
+				for i := 0; i < len(conts); i++ {
+					c := conts[i]
+					cp, ok := f.pos(d, c.address, int64(c.length))
+					if !ok || !f.visit(c.address) {
+						continue
+					}
+					d.SeekAbs(cp, func(d *decode.D) {
+						d.FieldStruct("continuation_block", func(d *decode.D) {
+							if version == 1 {
+								// number of messages includes messages in continuation blocks
+								decodeMessagesV1(d, f, &oi, &conts, int64(c.length), &count, numMessages)
+								return
+							}
+							start := d.Pos()
+							d.FieldUTF8("signature", 4, d.AssertStr("OCHK"))
+							decodeMessagesV2(d, f, &oi, &conts, start, int64(c.length)-8, creationOrder)
+						})
+					})
+				}
+			})
+		})
+	})
+
+	return oi
+}
+
+var messageFns = map[uint64]func(d *decode.D, f *file) any{
+	messageTypeNil:                  func(d *decode.D, _ *file) any { return nil },
+	messageTypeDataspace:            decodeDataspace,
+	messageTypeLinkInfo:             decodeLinkInfo,
+	messageTypeDatatype:             func(d *decode.D, _ *file) any { decodeDatatype(d); return nil },
+	messageTypeFillValue:            decodeFillValue,
+	messageTypeLink:                 decodeLink,
+	messageTypeDataLayout:           decodeDataLayout,
+	messageTypeGroupInfo:            decodeGroupInfo,
+	messageTypeFilterPipeline:       decodeFilterPipeline,
+	messageTypeAttribute:            decodeAttribute,
+	messageTypeObjectComment:        decodeObjectComment,
+	messageTypeModificationTimeOld:  decodeModificationTimeOld,
+	messageTypeContinuation:         decodeContinuation,
+	messageTypeSymbolTable:          decodeSymbolTable,
+	messageTypeModificationTime:     decodeModificationTime,
+	messageTypeBtreeKValues:         decodeBtreeKValues,
+	messageTypeAttributeInfo:        decodeAttributeInfo,
+	messageTypeObjectReferenceCount: decodeObjectReferenceCount,
+}
+
+var dataspaceTypeNames = scalar.UToSymStr{
+	0: "scalar",
+	1: "simple",
+	2: "null",
+}
+
+func decodeDataspace(d *decode.D, f *file) any {
+	version := d.FieldU8("version", d.AssertU(1, 2))
+	dimensionality := d.FieldU8("dimensionality")
+	flags := d.FieldU8("flags", scalar.ActualHex)
+	if version == 1 {
+		d.FieldU8("reserved0")
+		d.FieldU32("reserved1")
+	} else {
+		d.FieldU8("type", dataspaceTypeNames)
+	}
+	d.FieldArray("dimensions", func(d *decode.D) {
+		for i := uint64(0); i < dimensionality; i++ {
+			d.FieldU("size", f.lengthSize*8)
+		}
+	})
+	if flags&0x1 != 0 {
+		d.FieldArray("max_dimensions", func(d *decode.D) {
+			for i := uint64(0); i < dimensionality; i++ {
+				d.FieldU("size", f.lengthSize*8, scalar.UToSymStr{f.undefined: "unlimited"})
+			}
+		})
+	}
+	if version == 1 && flags&0x2 != 0 {
+		d.FieldArray("permutation_indices", func(d *decode.D) {
+			for i := uint64(0); i < dimensionality; i++ {
+				d.FieldU("index", f.lengthSize*8)
+			}
+		})
+	}
+	return nil
+}
+
+func decodeLinkInfo(d *decode.D, f *file) any {
+	d.FieldU8("version", d.AssertU(0))
+	flags := d.FieldU8("flags", scalar.ActualHex)
+	if flags&0x1 != 0 {
+		d.FieldU64("max_creation_index")
+	}
+	f.fieldAddress(d, "fractal_heap_address")
+	f.fieldAddress(d, "name_index_btree_address")
+	if flags&0x2 != 0 {
+		f.fieldAddress(d, "creation_order_index_btree_address")
+	}
+	return nil
+}
+
+const (
+	datatypeClassFixedPoint    = 0
+	datatypeClassFloatingPoint = 1
+	datatypeClassTime          = 2
+	datatypeClassString        = 3
+	datatypeClassBitfield      = 4
+	datatypeClassOpaque        = 5
+	datatypeClassCompound      = 6
+	datatypeClassReference     = 7
+	datatypeClassEnumerated    = 8
+	datatypeClassVariableLen   = 9
+	datatypeClassArray         = 10
+)
+
+var datatypeClassNames = scalar.UToSymStr{
+	datatypeClassFixedPoint:    "fixed_point",
+	datatypeClassFloatingPoint: "floating_point",
+	datatypeClassTime:          "time",
+	datatypeClassString:        "string",
+	datatypeClassBitfield:      "bitfield",
+	datatypeClassOpaque:        "opaque",
+	datatypeClassCompound:      "compound",
+	datatypeClassReference:     "reference",
+	datatypeClassEnumerated:    "enumerated",
+	datatypeClassVariableLen:   "variable_length",
+	datatypeClassArray:         "array",
+}
+
+var byteOrderNames = scalar.UToSymStr{
+	0: "little_endian",
+	1: "big_endian",
+}
+
+var stringPaddingNames = scalar.UToSymStr{
+	0: "null_terminate",
+	1: "null_pad",
+	2: "space_pad",
+}
+
+var charsetNames = scalar.UToSymStr{
+	0: "ascii",
+	1: "utf8",
+}
+
+type datatype struct {
+	class     uint64
+	size      uint64
+	signed    bool
+	bigEndian bool
+}
+
+func decodeDatatype(d *decode.D) datatype {
+	var dt datatype
+	d.FieldU4("version")
+	dt.class = d.FieldU4("class", datatypeClassNames)
+	d.FieldStruct("class_bit_fields", func(d *decode.D) {
+		switch dt.class {
+		case datatypeClassFixedPoint, datatypeClassBitfield:
+			d.FieldU4("reserved0")
+			dt.signed = d.FieldBool("signed")
+			d.FieldU1("high_padding")
+			d.FieldU1("low_padding")
+			dt.bigEndian = d.FieldU1("byte_order", byteOrderNames) == 1
+			d.FieldU16("reserved1")
+		case datatypeClassFloatingPoint:
+			d.FieldU1("reserved0")
+			d.FieldU1("byte_order_high")
+			d.FieldU2("mantissa_normalization", scalar.UToSymStr{0: "none", 1: "msb_set", 2: "msb_implied"})
+			d.FieldU1("internal_padding")
+			d.FieldU1("high_padding")
+			d.FieldU1("low_padding")
+			dt.bigEndian = d.FieldU1("byte_order", byteOrderNames) == 1
+			d.FieldU8("sign_location")
+			d.FieldU8("reserved1")
+		case datatypeClassString:
+			d.FieldU4("charset", charsetNames)
+			d.FieldU4("padding", stringPaddingNames)
+			d.FieldU16("reserved")
+		default:
+			d.FieldRawLen("bits", 24)
+		}
+	})
+	dt.size = d.FieldU32("size")
+
+	switch dt.class {
+	case datatypeClassFixedPoint, datatypeClassBitfield:
+		d.FieldU16("bit_offset")
+		d.FieldU16("bit_precision")
+	case datatypeClassFloatingPoint:
+		d.FieldU16("bit_offset")
+		d.FieldU16("bit_precision")
+		d.FieldU8("exponent_location")
+		d.FieldU8("exponent_size")
+		d.FieldU8("mantissa_location")
+		d.FieldU8("mantissa_size")
+		d.FieldU32("exponent_bias")
+	case datatypeClassTime:
+		d.FieldU16("bit_precision")
+	case datatypeClassString:
+	default:
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("properties", d.BitsLeft())
+		}
+	}
+
+	return dt
+}
+
+var fillValueTimeNames = scalar.UToSymStr{
+	0: "early",
+	1: "late",
+	2: "incremental",
+}
+
+func decodeFillValue(d *decode.D, _ *file) any {
+	version := d.FieldU8("version", d.AssertU(1, 2, 3))
+	defined := false
+	if version < 3 {
+		d.FieldU8("space_allocation_time", fillValueTimeNames)
+		d.FieldU8("fill_value_write_time", scalar.UToSymStr{0: "on_allocation", 1: "never", 2: "if_set"})
+		defined = d.FieldU8("fill_value_defined") != 0
+		if version == 1 {
+			defined = true
+		}
+	} else {
+		d.FieldStruct("flags", func(d *decode.D) {
+			d.FieldU2("reserved")
+			defined = d.FieldBool("fill_value_defined")
+			d.FieldBool("undefined")
+			d.FieldU2("fill_value_write_time", scalar.UToSymStr{0: "on_allocation", 1: "never", 2: "if_set"})
+			d.FieldU2("space_allocation_time", fillValueTimeNames)
+		})
+	}
+	if defined && d.BitsLeft() >= 32 {
+		size := d.FieldU32("size")
+		d.FieldRawLen("fill_value", int64(size)*8)
+	}
+	return nil
+}
+
+var linkTypeNames = scalar.UToSymStr{
+	0:  "hard",
+	1:  "soft",
+	64: "external",
+}
+
+func decodeLink(d *decode.D, f *file) any {
+	d.FieldU8("version", d.AssertU(1))
+	var nameLenSize uint64
+	var hasType, hasCreationOrder, hasCharset bool
+	d.FieldStruct("flags", func(d *decode.D) {
+		d.FieldU3("reserved")
+		hasCharset = d.FieldBool("charset_present")
+		hasType = d.FieldBool("link_type_present")
+		hasCreationOrder = d.FieldBool("creation_order_present")
+		nameLenSize = d.FieldU2("name_length_size", scalar.UToSymU{0: 1, 1: 2, 2: 4, 3: 8})
+	})
+	linkType := uint64(0)
+	if hasType {
+		linkType = d.FieldU8("link_type", linkTypeNames)
+	}
+	if hasCreationOrder {
+		d.FieldU64("creation_order")
+	}
+	if hasCharset {
+		d.FieldU8("charset", charsetNames)
+	}
+	nameLen := d.FieldU("name_length", (1<<nameLenSize)*8)
+	l := link{address: f.undefined}
+	l.name = d.FieldUTF8("name", int(nameLen))
+	switch linkType {
+	case 0:
+		l.address = f.fieldAddress(d, "object_header_address")
+	case 1:
+		n := d.FieldU16("length")
+		d.FieldUTF8("target", int(n))
+	default:
+		n := d.FieldU16("length")
+		d.FieldRawLen("target", int64(n)*8)
+	}
+	return l
+}
+
+func decodeDataLayout(d *decode.D, f *file) any {
+	l := &dataLayout{address: f.undefined}
+	version := d.FieldU8("version")
+	switch version {
+	case 1, 2:
+		dimensionality := d.FieldU8("dimensionality")
+		l.class = d.FieldU8("layout_class", layoutClassNames)
+		d.FieldRawLen("reserved", 5*8)
+		if l.class != layoutClassCompact {
+			l.address = f.fieldAddress(d, "address")
+		}
+		d.FieldArray("dimension_sizes", func(d *decode.D) {
+			for i := uint64(0); i < dimensionality; i++ {
+				d.FieldU32("size")
+			}
+		})
+		l.dimensionality = int(dimensionality)
+		if l.class == layoutClassCompact {
+			size := d.FieldU32("compact_data_size")
+			d.FieldRawLen("compact_data", int64(size)*8)
+		}
+	case 3:
+		l.class = d.FieldU8("layout_class", layoutClassNames)
+		switch l.class {
+		case layoutClassCompact:
+			size := d.FieldU16("size")
+			d.FieldRawLen("raw_data", int64(size)*8)
+		case layoutClassContiguous:
+			l.address = f.fieldAddress(d, "address")
+			l.size = f.fieldLength(d, "size")
+		case layoutClassChunked:
+			dimensionality := d.FieldU8("dimensionality")
+			l.address = f.fieldAddress(d, "address")
+			d.FieldArray("dimension_sizes", func(d *decode.D) {
+				for i := uint64(0); i < dimensionality; i++ {
+					d.FieldU32("size")
+				}
+			})
+			l.dimensionality = int(dimensionality)
+		}
+	default:
+		d.FieldRawLen("properties", d.BitsLeft())
+	}
+	return l
+}
+
+func decodeGroupInfo(d *decode.D, _ *file) any {
+	d.FieldU8("version", d.AssertU(0))
+	flags := d.FieldU8("flags", scalar.ActualHex)
+	if flags&0x1 != 0 {
+		d.FieldU16("max_compact_links")
+		d.FieldU16("min_dense_links")
+	}
+	if flags&0x2 != 0 {
+		d.FieldU16("estimated_number_of_entries")
+		d.FieldU16("estimated_link_name_length")
+	}
+	return nil
+}
+
+var filterNames = scalar.UToSymStr{
+	1: "deflate",
+	2: "shuffle",
+	3: "fletcher32",
+	4: "szip",
+	5: "nbit",
+	6: "scaleoffset",
+}
+
+func align8(n uint64) uint64 { return (n + 7) &^ 7 }
+
+func decodeFilterPipeline(d *decode.D, _ *file) any {
+	version := d.FieldU8("version", d.AssertU(1, 2))
+	numFilters := d.FieldU8("number_of_filters")
+	if version == 1 {
+		d.FieldRawLen("reserved", 6*8)
+	}
+	d.FieldArray("filters", func(d *decode.D) {
+		for i := uint64(0); i < numFilters; i++ {
+			d.FieldStruct("filter", func(d *decode.D) {
+				id := d.FieldU16("id", filterNames)
+				nameLen := uint64(0)
+				if version == 1 || id >= 256 {
+					nameLen = d.FieldU16("name_length")
+				}
+				d.FieldU16("flags", scalar.ActualHex)
+				numValues := d.FieldU16("number_of_client_values")
+				if nameLen > 0 {
+					if version == 1 {
+						nameLen = align8(nameLen)
+					}
+					d.FieldUTF8NullFixedLen("name", int(nameLen))
+				}
+				d.FieldArray("client_data", func(d *decode.D) {
+					for j := uint64(0); j < numValues; j++ {
+						d.FieldU32("value")
+					}
+				})
+				if version == 1 && numValues%2 == 1 {
+					d.FieldU32("padding")
+				}
+			})
+		}
+	})
+	return nil
+}
+
+func decodeAttribute(d *decode.D, f *file) any {
+	version := d.FieldU8("version", d.AssertU(1, 2, 3))
+	if version == 1 {
+		d.FieldU8("reserved")
+	} else {
+		d.FieldU8("flags", scalar.ActualHex)
+	}
+	nameSize := d.FieldU16("name_size")
+	datatypeSize := d.FieldU16("datatype_size")
+	dataspaceSize := d.FieldU16("dataspace_size")
+	if version == 3 {
+		d.FieldU8("name_charset", charsetNames)
+	}
+	// version 1 pads name, datatype and dataspace to 8 bytes
+	pad := func(n uint64) uint64 {
+		if version == 1 {
+			return align8(n)
+		}
+		return n
+	}
+	d.FieldUTF8NullFixedLen("name", int(pad(nameSize)))
+	var dt datatype
+	d.FramedFn(int64(pad(datatypeSize))*8, func(d *decode.D) {
+		d.FieldStruct("datatype", func(d *decode.D) { dt = decodeDatatype(d) })
+	})
+	d.FramedFn(int64(pad(dataspaceSize))*8, func(d *decode.D) {
+		d.FieldStruct("dataspace", func(d *decode.D) { decodeDataspace(d, f) })
+	})
+
+	dataBits := d.BitsLeft()
+	if dataBits == 0 {
+		return nil
+	}
+	// scalar numbers and strings as values
+	var endian decode.Endian = decode.LittleEndian
+	if dt.bigEndian {
+		endian = decode.BigEndian
+	}
+	switch {
+	case dt.class == datatypeClassString:
+		d.FieldUTF8NullFixedLen("value", int(dataBits/8))
+	case dt.class == datatypeClassFixedPoint && dataBits == int64(dt.size)*8 && dataBits <= 64:
+		if dt.signed {
+			d.FieldSE("value", int(dataBits), endian)
+		} else {
+			d.FieldUE("value", int(dataBits), endian)
+		}
+	case dt.class == datatypeClassFloatingPoint && dataBits == int64(dt.size)*8 && (dataBits == 32 || dataBits == 64):
+		d.FieldFE("value", int(dataBits), endian)
+	default:
+		d.FieldRawLen("value", dataBits)
+	}
+	return nil
+}
+
+func decodeObjectComment(d *decode.D, _ *file) any {
+	d.FieldUTF8NullFixedLen("comment", int(d.BitsLeft()/8))
+	return nil
+}
+
+func decodeModificationTimeOld(d *decode.D, _ *file) any {
+	d.FieldUTF8("time", 14)
+	d.FieldU16("reserved")
+	return nil
+}
+
+func decodeContinuation(d *decode.D, f *file) any {
+	return continuation{
+		address: f.fieldAddress(d, "offset"),
+		length:  f.fieldLength(d, "length"),
+	}
+}
+
+func decodeSymbolTable(d *decode.D, f *file) any {
+	return &symbolTable{
+		btreeAddress: f.fieldAddress(d, "btree_address"),
+		heapAddress:  f.fieldAddress(d, "local_heap_address"),
+	}
+}
+
+func decodeModificationTime(d *decode.D, _ *file) any {
+	d.FieldU8("version", d.AssertU(1))
+	d.FieldRawLen("reserved", 3*8)
+	d.FieldU32("seconds", scalar.DescriptionActualUUnixTime)
+	return nil
+}
+
+func decodeBtreeKValues(d *decode.D, _ *file) any {
+	d.FieldU8("version", d.AssertU(0))
+	d.FieldU16("indexed_storage_internal_node_k")
+	d.FieldU16("group_internal_node_k")
+	d.FieldU16("group_leaf_node_k")
+	return nil
+}
+
+func decodeAttributeInfo(d *decode.D, f *file) any {
+	d.FieldU8("version", d.AssertU(0))
+	flags := d.FieldU8("flags", scalar.ActualHex)
+	if flags&0x1 != 0 {
+		d.FieldU16("max_creation_index")
+	}
+	f.fieldAddress(d, "fractal_heap_address")
+	f.fieldAddress(d, "name_index_btree_address")
+	if flags&0x2 != 0 {
+		f.fieldAddress(d, "creation_order_index_btree_address")
+	}
+	return nil
+}
+
+func decodeObjectReferenceCount(d *decode.D, _ *file) any {
+	d.FieldU8("version", d.AssertU(0))
+	d.FieldU32("reference_count")
+	return nil
+}
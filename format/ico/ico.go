@@ -0,0 +1,111 @@
+package ico
+
+// https://learn.microsoft.com/en-us/previous-versions/ms997538(v=msdn.10)
+// https://en.wikipedia.org/wiki/ICO_(file_format)
+
+import (
+	"bytes"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var bmpFormat decode.Group
+var pngFormat decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.ICO,
+		Description: "Windows icon and cursor",
+		Groups:      []string{format.PROBE, format.IMAGE},
+		DecodeFn:    icoDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.BMP}, Group: &bmpFormat},
+			{Names: []string{format.PNG}, Group: &pngFormat},
+		},
+	})
+}
+
+const (
+	typeIcon   = 1
+	typeCursor = 2
+)
+
+var typeNames = scalar.UToSymStr{
+	typeIcon:   "icon",
+	typeCursor: "cursor",
+}
+
+const (
+	headerSize = 6
+	entrySize  = 16
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// zero means 256
+var dimensionMapper = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	if s.ActualU() == 0 {
+		s.Sym = uint64(256)
+	}
+	return s, nil
+})
+
+type entry struct {
+	offset int64
+	size   int64
+}
+
+func icoDecode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	d.FieldU16("reserved", d.AssertU(0))
+	typ := d.FieldU16("type", typeNames, d.AssertU(typeIcon, typeCursor))
+	count := d.FieldU16("count")
+	if count == 0 {
+		d.Fatalf("no images")
+	}
+	dataStart := int64(headerSize + entrySize*count)
+
+	var entries []entry
+	d.FieldArray("entries", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("entry", func(d *decode.D) {
+				d.FieldU8("width", dimensionMapper)
+				d.FieldU8("height", dimensionMapper)
+				d.FieldU8("color_count")
+				d.FieldU8("reserved")
+				if typ == typeCursor {
+					d.FieldU16("hotspot_x")
+					d.FieldU16("hotspot_y")
+				} else {
+					d.FieldU16("planes")
+					d.FieldU16("bit_count")
+				}
+				size := int64(d.FieldU32("size"))
+				offset := int64(d.FieldU32("offset"))
+				if offset < dataStart || (offset+size)*8 > d.Len() {
+					d.Fatalf("entry %d image outside buffer", i)
+				}
+				entries = append(entries, entry{offset: offset, size: size})
+			})
+		}
+	})
+
+	d.FieldArray("images", func(d *decode.D) {
+		for _, e := range entries {
+			d.RangeFn(e.offset*8, e.size*8, func(d *decode.D) {
+				// vista and later allows png instead of dib
+				if e.size >= int64(len(pngSignature)) && bytes.Equal(d.PeekBytes(len(pngSignature)), pngSignature) {
+					d.FieldFormatOrRawLen("image", d.BitsLeft(), pngFormat, nil)
+				} else {
+					d.FieldFormatOrRawLen("image", d.BitsLeft(), bmpFormat, format.BMPIn{Icon: true})
+				}
+			})
+		}
+	})
+
+	return nil
+}
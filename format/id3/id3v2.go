@@ -26,6 +26,7 @@ func init() {
 		Name:        format.ID3V2,
 		Description: "ID3v2 metadata",
 		DecodeFn:    id3v2Decode,
+		EncodeFn:    id3v2Encode,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.IMAGE}, Group: &imageFormat},
 		},
@@ -313,6 +314,19 @@ func textNullFn(encoding int) func(d *decode.D) string {
 	}
 }
 
+// frame ids sharing the same layout
+func normalizeFrameID(id string) string {
+	switch {
+	case id == "COMM", id == "COM", id == "USLT", id == "ULT":
+		return "COMM"
+	case id == "TXX", id == "TXXX":
+		return "TXXX"
+	case len(id) > 0 && id[0] == 'T':
+		return "T000"
+	}
+	return id
+}
+
 func decodeFrame(d *decode.D, version int) uint64 {
 	var id string
 	var size uint64
@@ -535,15 +549,7 @@ func decodeFrame(d *decode.D, version int) uint64 {
 		},
 	}
 
-	idNormalized := id
-	switch {
-	case id == "COMM", id == "COM", id == "USLT", id == "ULT":
-		idNormalized = "COMM"
-	case id == "TXX", id == "TXXX":
-		idNormalized = "TXXX"
-	case len(id) > 0 && id[0] == 'T':
-		idNormalized = "T000"
-	}
+	idNormalized := normalizeFrameID(id)
 
 	if unsyncFlag {
 		// TODO: DecodeFn
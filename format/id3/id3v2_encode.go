@@ -0,0 +1,420 @@
+package id3
+
+// Unmodified frames are copied as is, modified or new frames are encoded from
+// their fields with recalculated sizes. Frames and tags using compression,
+// encryption or unsynchronisation can only be copied.
+
+import (
+	"fmt"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+type flagField struct {
+	name  string
+	nBits int
+}
+
+var id3v2HeaderFlags = []flagField{
+	{"unsynchronisation", 1},
+	{"extended_header", 1},
+	{"experimental_indicator", 1},
+	{"unused", 5},
+}
+
+var id3v23FrameFlags = []flagField{
+	{"tag_alter_preservation", 1},
+	{"file_alter_preservation", 1},
+	{"read_only", 1},
+	{"unused0", 5},
+	{"compression", 1},
+	{"encryption", 1},
+	{"grouping_identity", 1},
+	{"unused1", 5},
+}
+
+var id3v24FrameFlags = []flagField{
+	{"unused0", 1},
+	{"tag_alter_preservation", 1},
+	{"file_alter_preservation", 1},
+	{"read_only", 1},
+	{"unused1", 5},
+	{"grouping_identity", 1},
+	{"unused2", 2},
+	{"compression", 1},
+	{"encryption", 1},
+	{"unsync", 1},
+	{"data_length_indicator", 1},
+}
+
+var unsupportedFrameFlags = []string{
+	"compression",
+	"encryption",
+	"unsync",
+	"data_length_indicator",
+}
+
+func encodeSyncSafeU32(e *decode.E, v uint64) error {
+	if v > 0x0fff_ffff {
+		return fmt.Errorf("size %d does not fit in a syncsafe integer", v)
+	}
+	e.U32(((v & 0x0fe0_0000) << 3) |
+		((v & 0x001f_c000) << 2) |
+		((v & 0x0000_3f80) << 1) |
+		((v & 0x0000_007f) << 0))
+	return nil
+}
+
+// missing flags are zero, one bit flags can be booleans or numbers
+func encodeFlags(e *decode.E, v any, fields []flagField) error {
+	var obj map[string]any
+	if v != nil {
+		var err error
+		if obj, err = interp.EncodeObject(v); err != nil {
+			return fmt.Errorf("flags: %w", err)
+		}
+	}
+	for _, f := range fields {
+		fv, ok := obj[f.name]
+		if !ok || fv == nil {
+			e.U(f.nBits, 0)
+			continue
+		}
+		if b, err := interp.EncodeBool(fv); err == nil && f.nBits == 1 {
+			e.Bool(b)
+			continue
+		}
+		n, err := interp.EncodeUint(fv)
+		if err != nil {
+			return fmt.Errorf("flags.%s: %w", f.name, err)
+		}
+		e.U(f.nBits, n)
+	}
+	return nil
+}
+
+func encodeFromString(enc uint64, s string) ([]byte, error) {
+	var te encoding.Encoding
+	switch enc {
+	case encodingISO8859_1:
+		te = charmap.ISO8859_1
+	case encodingUTF16:
+		te = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	case encodingUTF16BE:
+		te = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	case encodingUTF8:
+		te = unicode.UTF8
+	default:
+		return nil, fmt.Errorf("unknown text encoding %d", enc)
+	}
+	b, err := te.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", s, err)
+	}
+	return b, nil
+}
+
+// frame body writer, errors are kept and reported in order
+type frameEncoder struct {
+	e   *decode.E
+	obj map[string]any
+	err error
+	// text_encoding is unmodified so unmodified strings can be copied as is
+	rawEncoding bool
+}
+
+func (fe *frameEncoder) u(name string, nBits int) {
+	if fe.err != nil {
+		return
+	}
+	n, err := interp.EncodeUint(fe.obj[name])
+	if err != nil {
+		fe.err = fmt.Errorf("%s: %w", name, err)
+		return
+	}
+	fe.e.U(nBits, n)
+}
+
+func (fe *frameEncoder) textEncoding() uint64 {
+	if fe.err != nil {
+		return 0
+	}
+	ev := fe.obj["text_encoding"]
+	n, err := interp.EncodeSym(ev, encodingNames)
+	if err != nil {
+		fe.err = fmt.Errorf("text_encoding: %w", err)
+		return 0
+	}
+	_, fe.rawEncoding = ev.(interp.DecodeValue)
+	fe.e.U8(n)
+	return n
+}
+
+// unmodified strings are copied as is to keep terminators and trailing nulls
+func (fe *frameEncoder) text(name string, enc uint64, null bool) {
+	if fe.err != nil {
+		return
+	}
+	if fe.rawEncoding {
+		ok, err := interp.EncodeRaw(fe.e, fe.obj[name])
+		if err != nil || ok {
+			fe.err = err
+			return
+		}
+	}
+	s, err := interp.EncodeString(fe.obj[name])
+	if err != nil {
+		fe.err = fmt.Errorf("%s: %w", name, err)
+		return
+	}
+	b, err := encodeFromString(enc, s)
+	if err != nil {
+		fe.err = fmt.Errorf("%s: %w", name, err)
+		return
+	}
+	fe.e.WriteBytes(b)
+	if null {
+		fe.e.WriteBytes(make([]byte, encodingLen[enc]))
+	}
+}
+
+func (fe *frameEncoder) fixedText(name string, n int) {
+	if fe.err != nil {
+		return
+	}
+	s, err := interp.EncodeString(fe.obj[name])
+	if err != nil {
+		fe.err = fmt.Errorf("%s: %w", name, err)
+		return
+	}
+	if len(s) != n {
+		fe.err = fmt.Errorf("%s: %q should be %d bytes", name, s, n)
+		return
+	}
+	fe.e.WriteBytes([]byte(s))
+}
+
+func (fe *frameEncoder) bytes(name string) {
+	if fe.err != nil {
+		return
+	}
+	b, err := interp.EncodeBytes(fe.obj[name])
+	if err != nil {
+		fe.err = fmt.Errorf("%s: %w", name, err)
+		return
+	}
+	fe.e.WriteBytes(b)
+}
+
+func encodeFrameBody(e *decode.E, version uint64, id string, obj map[string]any) error {
+	// strings without text_encoding are UTF-8 or ISO-8859-1
+	fe := &frameEncoder{e: e, obj: obj, rawEncoding: true}
+
+	switch normalizeFrameID(id) {
+	case "CHAP":
+		fe.text("element_id", encodingUTF8, true)
+		fe.u("start_time", 32)
+		fe.u("end_time", 32)
+		fe.u("start_offset", 32)
+		fe.u("end_offset", 32)
+		if fe.err == nil {
+			fe.err = encodeFrames(e, version, obj)
+		}
+	case "CTOC":
+		fe.text("element_id", encodingUTF8, true)
+		fe.u("ctoc_flags", 8)
+		if fe.err != nil {
+			break
+		}
+		entries, err := interp.EncodeArray(obj["entries"])
+		if err != nil {
+			return fmt.Errorf("entries: %w", err)
+		}
+		e.U8(uint64(len(entries)))
+		for _, ev := range entries {
+			fe.obj = map[string]any{"entry": ev}
+			fe.text("entry", encodingUTF8, true)
+		}
+	case "PIC":
+		enc := fe.textEncoding()
+		fe.fixedText("image_format", 3)
+		fe.u("picture_type", 8)
+		fe.text("description", enc, true)
+		fe.bytes("picture")
+	case "APIC":
+		enc := fe.textEncoding()
+		fe.text("mime_type", encodingUTF8, true)
+		fe.u("picture_type", 8)
+		fe.text("description", enc, true)
+		fe.bytes("picture")
+	case "GEOB":
+		enc := fe.textEncoding()
+		fe.text("mime_type", encodingUTF8, true)
+		fe.text("filename", enc, true)
+		fe.text("description", enc, true)
+		fe.bytes("data")
+	case "COMM":
+		enc := fe.textEncoding()
+		fe.fixedText("language", 3)
+		fe.text("description", enc, true)
+		fe.text("value", enc, false)
+	case "T000":
+		enc := fe.textEncoding()
+		fe.text("text", enc, false)
+	case "TXXX":
+		enc := fe.textEncoding()
+		fe.text("description", enc, true)
+		fe.text("value", enc, false)
+	case "PRIV":
+		fe.text("owner", encodingISO8859_1, true)
+		fe.bytes("data")
+	default:
+		if _, ok := obj["data"]; !ok {
+			return fmt.Errorf("no data field")
+		}
+		fe.bytes("data")
+	}
+
+	return fe.err
+}
+
+func encodeFrame(e *decode.E, version uint64, v any) error {
+	if ok, err := interp.EncodeRaw(e, v); err != nil || ok {
+		return err
+	}
+	obj, err := interp.EncodeObject(v)
+	if err != nil {
+		return err
+	}
+	id, err := interp.EncodeString(obj["id"])
+	if err != nil {
+		return fmt.Errorf("id: %w", err)
+	}
+	idLen := 4
+	if version == 2 {
+		idLen = 3
+	}
+	if len(id) != idLen {
+		return fmt.Errorf("id: %q should be %d bytes", id, idLen)
+	}
+	if _, ok := obj["unsync"]; ok {
+		return fmt.Errorf("%s: unsynchronised frame can't be encoded", id)
+	}
+
+	body := &decode.E{}
+	if err := encodeFrameBody(body, version, id, obj); err != nil {
+		return fmt.Errorf("%s: %w", id, err)
+	}
+	size := uint64(len(body.Bytes()))
+
+	e.WriteBytes([]byte(id))
+	switch version {
+	case 2:
+		if size > 0xff_ffff {
+			return fmt.Errorf("%s: size %d does not fit", id, size)
+		}
+		e.U24(size)
+	case 3, 4:
+		flagFields := id3v23FrameFlags
+		if version == 3 {
+			if size > 0xffff_ffff {
+				return fmt.Errorf("%s: size %d does not fit", id, size)
+			}
+			e.U32(size)
+		} else {
+			flagFields = id3v24FrameFlags
+			if err := encodeSyncSafeU32(e, size); err != nil {
+				return fmt.Errorf("%s: %w", id, err)
+			}
+		}
+		if fv, ok := obj["flags"]; ok && fv != nil {
+			flags, err := interp.EncodeObject(fv)
+			if err != nil {
+				return fmt.Errorf("%s: flags: %w", id, err)
+			}
+			for _, n := range unsupportedFrameFlags {
+				if b, _ := interp.EncodeBool(flags[n]); b {
+					return fmt.Errorf("%s: frame with %s flag can't be encoded", id, n)
+				}
+			}
+		}
+		if err := encodeFlags(e, obj["flags"], flagFields); err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+	}
+	e.WriteBytes(body.Bytes())
+
+	return nil
+}
+
+// frames and optional padding
+func encodeFrames(e *decode.E, version uint64, obj map[string]any) error {
+	if fv, ok := obj["frames"]; ok {
+		frames, err := interp.EncodeArray(fv)
+		if err != nil {
+			return fmt.Errorf("frames: %w", err)
+		}
+		for i, f := range frames {
+			if err := encodeFrame(e, version, f); err != nil {
+				return fmt.Errorf("frames[%d]: %w", i, err)
+			}
+		}
+	}
+	if pv, ok := obj["padding"]; ok {
+		b, err := interp.EncodeBytes(pv)
+		if err != nil {
+			return fmt.Errorf("padding: %w", err)
+		}
+		e.WriteBytes(b)
+	}
+	return nil
+}
+
+func id3v2Encode(e *decode.E, v any) error {
+	obj, err := interp.EncodeObject(v)
+	if err != nil {
+		return err
+	}
+	version, err := interp.EncodeUint(obj["version"])
+	if err != nil {
+		return fmt.Errorf("version: %w", err)
+	}
+	if version != 2 && version != 3 && version != 4 {
+		return fmt.Errorf("unsupported version %d", version)
+	}
+	revision, err := interp.EncodeUint(obj["revision"])
+	if err != nil {
+		return fmt.Errorf("revision: %w", err)
+	}
+
+	body := &decode.E{}
+	if ev, ok := obj["extended_header"]; ok {
+		ok, err := interp.EncodeRaw(body, ev)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("modified extended header can't be encoded")
+		}
+	}
+	if err := encodeFrames(body, version, obj); err != nil {
+		return err
+	}
+
+	e.WriteBytes([]byte("ID3"))
+	e.U8(version)
+	e.U8(revision)
+	if err := encodeFlags(e, obj["flags"], id3v2HeaderFlags); err != nil {
+		return err
+	}
+	if err := encodeSyncSafeU32(e, uint64(len(body.Bytes()))); err != nil {
+		return err
+	}
+	e.WriteBytes(body.Bytes())
+
+	return nil
+}
@@ -0,0 +1,386 @@
+package innodb
+
+// https://github.com/mysql/mysql-server/blob/trunk/storage/innobase/include/fil0types.h
+// https://github.com/mysql/mysql-server/blob/trunk/storage/innobase/include/page0types.h
+// https://github.com/mysql/mysql-server/blob/trunk/storage/innobase/include/rem0rec.h
+// https://github.com/mysql/mysql-server/blob/trunk/storage/innobase/buf/checksum.cc
+// https://blog.jcole.us/innodb/
+
+import (
+	"embed"
+	"hash/crc32"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed innodb_page.jq
+var innodbFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.INNODB_PAGE,
+		Description: "InnoDB tablespace page",
+		DecodeFn:    pageDecode,
+		DecodeInArg: format.InnoDBPageIn{
+			PageSize: 16384,
+		},
+		Functions: []string{"_help"},
+	})
+	interp.RegisterFS(innodbFS)
+}
+
+const (
+	filHeaderBytes  = 38
+	filTrailerBytes = 8
+	// checksum value written when innodb_checksum_algorithm is none
+	noChecksumMagic = 0xdeadbeef
+	filNull         = 0xffff_ffff
+)
+
+var filNullNames = scalar.UToSymStr{filNull: "none"}
+
+const (
+	pageTypeIndex = 0x45bf
+	pageTypeRTree = 0x45be
+	pageTypeSDI   = 0x45bd
+)
+
+var pageTypeNames = scalar.UToSymStr{
+	0:             "allocated",
+	2:             "undo_log",
+	3:             "inode",
+	4:             "ibuf_free_list",
+	5:             "ibuf_bitmap",
+	6:             "sys",
+	7:             "trx_sys",
+	8:             "fsp_hdr",
+	9:             "xdes",
+	10:            "blob",
+	11:            "zblob",
+	12:            "zblob2",
+	13:            "unknown",
+	14:            "compressed",
+	15:            "encrypted",
+	16:            "compressed_and_encrypted",
+	17:            "encrypted_rtree",
+	18:            "sdi_blob",
+	19:            "sdi_zblob",
+	20:            "legacy_dblwr",
+	21:            "rseg_array",
+	22:            "lob_index",
+	23:            "lob_data",
+	24:            "lob_first",
+	25:            "zlob_first",
+	26:            "zlob_data",
+	27:            "zlob_index",
+	28:            "zlob_frag",
+	29:            "zlob_frag_entry",
+	pageTypeSDI:   "sdi",
+	pageTypeRTree: "rtree",
+	pageTypeIndex: "index",
+}
+
+var directionNames = scalar.UToSymStr{
+	1: "left",
+	2: "right",
+	3: "same_rec",
+	4: "same_page",
+	5: "no_direction",
+}
+
+const (
+	pageDataOffset = filHeaderBytes + 36 + 20
+
+	compactExtraBytes   = 5
+	compactInfimum      = pageDataOffset + compactExtraBytes
+	compactInfimumLen   = 8
+	compactSupremumLen  = 8
+	redundantExtraBytes = 6
+	// after one byte field offset and header
+	redundantInfimum = pageDataOffset + 1 + redundantExtraBytes
+)
+
+const (
+	recordTypeConventional = 0
+	recordTypeNodePointer  = 1
+	recordTypeInfimum      = 2
+	recordTypeSupremum     = 3
+)
+
+var recordTypeNames = scalar.UToSymStr{
+	recordTypeConventional: "conventional",
+	recordTypeNodePointer:  "node_pointer",
+	recordTypeInfimum:      "infimum",
+	recordTypeSupremum:     "supremum",
+}
+
+const (
+	utHashRandomMask  = 1463735687
+	utHashRandomMask2 = 1653893711
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+func utFoldULintPair(n1 uint32, n2 uint32) uint32 {
+	return ((((n1 ^ n2 ^ utHashRandomMask2) << 8) + n1) ^ utHashRandomMask) + n2
+}
+
+func utFoldBinary(b []byte) uint32 {
+	var fold uint32
+	for _, c := range b {
+		fold = utFoldULintPair(fold, uint32(c))
+	}
+	return fold
+}
+
+func isZeroes(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func validPageSize(n int) bool {
+	return n >= 4096 && n <= 65536 && n&(n-1) == 0
+}
+
+func decodeFSEGHeader(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldU32("space_id")
+		d.FieldU32("page_number", filNullNames)
+		d.FieldU16("offset")
+	})
+}
+
+func decodeRecordInfoBits(d *decode.D) uint64 {
+	d.FieldU2("unused")
+	d.FieldBool("deleted")
+	d.FieldBool("min_rec")
+	d.FieldU4("n_owned")
+	return d.FieldU13("heap_no")
+}
+
+// compact record header is before the record origin and next is relative
+func decodeCompactRecord(d *decode.D, pageSize int64, origin int64) (int64, bool) {
+	var recordType uint64
+	var next uint64
+	d.SeekAbs((origin - compactExtraBytes) * 8)
+	d.FieldStruct("header", func(d *decode.D) {
+		decodeRecordInfoBits(d)
+		recordType = d.FieldU3("record_type", recordTypeNames)
+		next = uint64(uint16(d.FieldS16("next")))
+	})
+	d.FieldValueU("origin", uint64(origin))
+
+	switch recordType {
+	case recordTypeInfimum:
+		d.FieldUTF8NullFixedLen("data", compactInfimumLen)
+	case recordTypeSupremum:
+		d.FieldUTF8NullFixedLen("data", compactSupremumLen)
+		return 0, true
+	}
+	// field data can't be known without table definition
+	if next == 0 {
+		return 0, true
+	}
+	return int64((uint64(origin) + next) % uint64(pageSize)), false
+}
+
+// redundant record has field end offsets before the header and next is absolute
+func decodeRedundantRecord(d *decode.D, origin int64) (int64, bool) {
+	var heapNo uint64
+	var nFields uint64
+	var oneByteOffsets bool
+	var next uint64
+	headerStart := origin - redundantExtraBytes
+	d.SeekAbs(headerStart * 8)
+	d.FieldStruct("header", func(d *decode.D) {
+		heapNo = decodeRecordInfoBits(d)
+		nFields = d.FieldU10("n_fields")
+		oneByteOffsets = d.FieldBool("one_byte_offsets")
+		next = d.FieldU16("next")
+	})
+	d.FieldValueU("origin", uint64(origin))
+
+	offsetBytes := int64(2)
+	if oneByteOffsets {
+		offsetBytes = 1
+	}
+	if headerStart-int64(nFields)*offsetBytes < pageDataOffset {
+		d.Fatalf("field offsets outside page data")
+	}
+	var ends []int64
+	// stored in reverse order where first offset is closest to header
+	d.FieldArray("field_offsets", func(d *decode.D) {
+		for i := int64(0); i < int64(nFields); i++ {
+			d.SeekAbs((headerStart - (i+1)*offsetBytes) * 8)
+			d.FieldStruct("field_offset", func(d *decode.D) {
+				d.FieldBool("null")
+				if oneByteOffsets {
+					ends = append(ends, int64(d.FieldU7("end")))
+				} else {
+					d.FieldBool("external")
+					ends = append(ends, int64(d.FieldU14("end")))
+				}
+			})
+		}
+	})
+
+	d.SeekAbs(origin * 8)
+	d.FieldArray("fields", func(d *decode.D) {
+		start := int64(0)
+		for _, end := range ends {
+			if end < start {
+				d.Fatalf("field end offset %d before start %d", end, start)
+			}
+			d.FieldRawLen("field", (end-start)*8)
+			start = end
+		}
+	})
+
+	if heapNo == 1 || next == 0 {
+		return 0, true
+	}
+	return int64(next), false
+}
+
+func decodeIndexPage(d *decode.D, pageSize int64) {
+	var nDirSlots uint64
+	var nHeap uint64
+	var compact bool
+	d.FieldStruct("index_header", func(d *decode.D) {
+		nDirSlots = d.FieldU16("n_dir_slots")
+		d.FieldU16("heap_top")
+		compact = d.FieldBool("compact")
+		nHeap = d.FieldU15("n_heap")
+		d.FieldU16("free")
+		d.FieldU16("garbage")
+		d.FieldU16("last_insert")
+		d.FieldU16("direction", directionNames)
+		d.FieldU16("n_direction")
+		d.FieldU16("n_recs")
+		d.FieldU64("max_trx_id")
+		d.FieldU16("level")
+		d.FieldU64("index_id")
+	})
+	d.FieldStruct("fseg_header", func(d *decode.D) {
+		decodeFSEGHeader(d, "leaf")
+		decodeFSEGHeader(d, "non_leaf")
+	})
+
+	directoryStart := pageSize - filTrailerBytes - int64(nDirSlots)*2
+	if directoryStart < pageDataOffset {
+		d.Fatalf("%d directory slots outside page", nDirSlots)
+	}
+
+	origin := int64(redundantInfimum)
+	if compact {
+		origin = compactInfimum
+	}
+	seen := map[int64]bool{}
+	d.FieldArray("records", func(d *decode.D) {
+		for {
+			if origin < pageDataOffset || origin >= directoryStart {
+				d.Fatalf("record origin %d outside page data", origin)
+			}
+			if seen[origin] {
+				d.Fatalf("record loop at %d", origin)
+			}
+			// one more than heap size is a broken list
+			if uint64(len(seen)) > nHeap {
+				d.Fatalf("more records than heap size %d", nHeap)
+			}
+			seen[origin] = true
+
+			var last bool
+			d.FieldStruct("record", func(d *decode.D) {
+				if compact {
+					origin, last = decodeCompactRecord(d, pageSize, origin)
+				} else {
+					origin, last = decodeRedundantRecord(d, origin)
+				}
+			})
+			if last {
+				break
+			}
+		}
+	})
+
+	// slots grow downwards from page end
+	d.FieldArray("directory", func(d *decode.D) {
+		for i := int64(0); i < int64(nDirSlots); i++ {
+			d.SeekAbs((pageSize - filTrailerBytes - (i+1)*2) * 8)
+			d.FieldU16("slot")
+		}
+	})
+}
+
+func pageDecode(d *decode.D, in any) any {
+	pi, _ := in.(format.InnoDBPageIn)
+	if !validPageSize(pi.PageSize) {
+		d.Fatalf("invalid page size %d", pi.PageSize)
+	}
+	pageSize := int64(pi.PageSize)
+	if d.Len() < pageSize*8 {
+		d.Fatalf("shorter than page size %d", pageSize)
+	}
+
+	page := d.BytesRange(0, int(pageSize))
+	body := page[filHeaderBytes : pageSize-filTrailerBytes]
+	crc32Checksum := crc32.Checksum(page[4:26], crc32cTable) ^ crc32.Checksum(body, crc32cTable)
+	innodbChecksum := utFoldBinary(page[4:26]) + utFoldBinary(body)
+	innodbOldChecksum := utFoldBinary(page[0:26])
+
+	checksumNames := scalar.UToSymStr{
+		noChecksumMagic:        "none",
+		uint64(innodbChecksum): "innodb",
+		uint64(crc32Checksum):  "crc32",
+	}
+	checksums := []uint64{uint64(crc32Checksum), uint64(innodbChecksum), noChecksumMagic}
+	oldChecksumNames := scalar.UToSymStr{
+		noChecksumMagic:           "none",
+		uint64(innodbOldChecksum): "innodb",
+		uint64(crc32Checksum):     "crc32",
+	}
+	oldChecksums := []uint64{uint64(crc32Checksum), uint64(innodbOldChecksum), noChecksumMagic}
+	// never written page
+	if isZeroes(page) {
+		checksums = append(checksums, 0)
+		oldChecksums = append(oldChecksums, 0)
+	}
+
+	var pageType uint64
+	var lsn uint64
+	d.FieldStruct("fil_header", func(d *decode.D) {
+		d.FieldU32("checksum", d.ValidateU(checksums...), checksumNames, scalar.ActualHex)
+		d.FieldU32("page_number")
+		d.FieldU32("previous_page", filNullNames)
+		d.FieldU32("next_page", filNullNames)
+		lsn = d.FieldU64("lsn")
+		pageType = d.FieldU16("page_type", pageTypeNames)
+		d.FieldU64("flush_lsn")
+		d.FieldU32("space_id")
+	})
+
+	switch pageType {
+	case pageTypeIndex,
+		pageTypeRTree,
+		pageTypeSDI:
+		decodeIndexPage(d, pageSize)
+	default:
+		d.FieldRawLen("data", int64(len(body))*8)
+	}
+
+	d.SeekAbs((pageSize - filTrailerBytes) * 8)
+	d.FieldStruct("fil_trailer", func(d *decode.D) {
+		d.FieldU32("old_checksum", d.ValidateU(oldChecksums...), oldChecksumNames, scalar.ActualHex)
+		d.FieldU32("lsn_low", d.ValidateU(lsn&0xffff_ffff))
+	})
+
+	return nil
+}
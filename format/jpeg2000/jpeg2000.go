@@ -0,0 +1,563 @@
+package jpeg2000
+
+// https://www.itu.int/rec/T-REC-T.800
+// https://www.itu.int/rec/T-REC-T.801 (JPX extensions)
+// http://fileformats.archiveteam.org/wiki/JPEG_2000
+// TODO: JPX boxes and fragment tables
+// TODO: decode packets using SOP/EPH markers and PLT/PPT lengths
+
+import (
+	"bytes"
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed jpeg2000.jq
+var jpeg2000FS embed.FS
+
+var iccProfileFormat decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.JPEG2000,
+		Description: "JPEG 2000 image (JP2 file or codestream)",
+		Groups:      []string{format.PROBE, format.IMAGE},
+		DecodeFn:    jpeg2000Decode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.ICC_PROFILE}, Group: &iccProfileFormat},
+		},
+		Functions: []string{"_help"},
+	})
+	interp.RegisterFS(jpeg2000FS)
+}
+
+var jp2Signature = []byte{0x00, 0x00, 0x00, 0x0c, 'j', 'P', ' ', ' ', 0x0d, 0x0a, 0x87, 0x0a}
+var codestreamSignature = []byte{0xff, 0x4f, 0xff, 0x51}
+
+const (
+	markerSOC = 0xff4f
+	markerCAP = 0xff50
+	markerSIZ = 0xff51
+	markerCOD = 0xff52
+	markerCOC = 0xff53
+	markerTLM = 0xff55
+	markerPLM = 0xff57
+	markerPLT = 0xff58
+	markerCPF = 0xff59
+	markerQCD = 0xff5c
+	markerQCC = 0xff5d
+	markerRGN = 0xff5e
+	markerPOC = 0xff5f
+	markerPPM = 0xff60
+	markerPPT = 0xff61
+	markerCRG = 0xff63
+	markerCOM = 0xff64
+	markerSOT = 0xff90
+	markerSOP = 0xff91
+	markerEPH = 0xff92
+	markerSOD = 0xff93
+	markerEOC = 0xffd9
+)
+
+var markerNames = scalar.UToScalar{
+	markerSOC: {Sym: "soc", Description: "Start of codestream"},
+	markerCAP: {Sym: "cap", Description: "Extended capabilities"},
+	markerSIZ: {Sym: "siz", Description: "Image and tile size"},
+	markerCOD: {Sym: "cod", Description: "Coding style default"},
+	markerCOC: {Sym: "coc", Description: "Coding style component"},
+	markerTLM: {Sym: "tlm", Description: "Tile-part lengths"},
+	markerPLM: {Sym: "plm", Description: "Packet length, main header"},
+	markerPLT: {Sym: "plt", Description: "Packet length, tile-part header"},
+	markerCPF: {Sym: "cpf", Description: "Corresponding profile"},
+	markerQCD: {Sym: "qcd", Description: "Quantization default"},
+	markerQCC: {Sym: "qcc", Description: "Quantization component"},
+	markerRGN: {Sym: "rgn", Description: "Region-of-interest"},
+	markerPOC: {Sym: "poc", Description: "Progression order change"},
+	markerPPM: {Sym: "ppm", Description: "Packed packet headers, main header"},
+	markerPPT: {Sym: "ppt", Description: "Packed packet headers, tile-part header"},
+	markerCRG: {Sym: "crg", Description: "Component registration"},
+	markerCOM: {Sym: "com", Description: "Comment"},
+	markerSOT: {Sym: "sot", Description: "Start of tile-part"},
+	markerSOP: {Sym: "sop", Description: "Start of packet"},
+	markerEPH: {Sym: "eph", Description: "End of packet header"},
+	markerSOD: {Sym: "sod", Description: "Start of data"},
+	markerEOC: {Sym: "eoc", Description: "End of codestream"},
+}
+
+var rsizNames = scalar.UToDescription{
+	0: "No restrictions",
+	1: "Profile 0",
+	2: "Profile 1",
+	3: "2K digital cinema",
+	4: "4K digital cinema",
+	5: "Scalable 2K digital cinema",
+	6: "Scalable 4K digital cinema",
+	7: "Long-term storage",
+}
+
+var progressionOrderNames = scalar.UToSymStr{
+	0: "lrcp",
+	1: "rlcp",
+	2: "rpcl",
+	3: "pcrl",
+	4: "cprl",
+}
+
+var transformNames = scalar.UToSymStr{
+	0: "irreversible_9_7",
+	1: "reversible_5_3",
+}
+
+const (
+	quantizationNone            = 0
+	quantizationScalarDerived   = 1
+	quantizationScalarExpounded = 2
+)
+
+var quantizationStyleNames = scalar.UToSymStr{
+	quantizationNone:            "none",
+	quantizationScalarDerived:   "scalar_derived",
+	quantizationScalarExpounded: "scalar_expounded",
+}
+
+var commentRegistrationNames = scalar.UToSymStr{
+	0: "binary",
+	1: "latin1",
+}
+
+var colourMethodNames = scalar.UToSymStr{
+	1: "enumerated",
+	2: "restricted_icc",
+	3: "any_icc",
+	4: "vendor",
+}
+
+var enumeratedColourspaceNames = scalar.UToSymStr{
+	16: "srgb",
+	17: "greyscale",
+	18: "sycc",
+}
+
+var channelTypeNames = scalar.UToSymStr{
+	0:      "colour",
+	1:      "opacity",
+	2:      "premultiplied_opacity",
+	0xffff: "unspecified",
+}
+
+var boxDescriptions = scalar.StrToDescription{
+	"jP  ": "Signature",
+	"ftyp": "File type",
+	"jp2h": "JP2 header",
+	"ihdr": "Image header",
+	"bpcc": "Bits per component",
+	"colr": "Colour specification",
+	"pclr": "Palette",
+	"cmap": "Component mapping",
+	"cdef": "Channel definition",
+	"res ": "Resolution",
+	"resc": "Capture resolution",
+	"resd": "Default display resolution",
+	"jp2c": "Contiguous codestream",
+	"jp2i": "Intellectual property",
+	"xml ": "XML",
+	"uuid": "UUID",
+	"uinf": "UUID info",
+	"ulst": "UUID list",
+	"url ": "Data entry URL",
+}
+
+// "bits per component" byte, depth minus one and sign bit
+func fieldBitDepth(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldBool("signed")
+		d.FieldU7("depth", scalar.ActualUAdd(1))
+	})
+}
+
+// component index is 16 bit if more than 256 components
+func fieldComponent(d *decode.D, name string, csiz uint64) uint64 {
+	if csiz < 257 {
+		return d.FieldU8(name)
+	}
+	return d.FieldU16(name)
+}
+
+func decodeCodingStyleParameters(d *decode.D, precincts bool) {
+	levels := d.FieldU8("decomposition_levels")
+	d.FieldU8("code_block_width", scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		s.Sym = uint64(1) << (s.ActualU() + 2)
+		return s, nil
+	}))
+	d.FieldU8("code_block_height", scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		s.Sym = uint64(1) << (s.ActualU() + 2)
+		return s, nil
+	}))
+	d.FieldStruct("code_block_style", func(d *decode.D) {
+		d.FieldBool("reserved")
+		d.FieldBool("high_throughput")
+		d.FieldBool("segmentation_symbols")
+		d.FieldBool("predictable_termination")
+		d.FieldBool("vertically_causal_context")
+		d.FieldBool("termination_each_pass")
+		d.FieldBool("reset_context_probabilities")
+		d.FieldBool("selective_arithmetic_coding_bypass")
+	})
+	d.FieldU8("transform", transformNames)
+	if precincts {
+		d.FieldArray("precinct_sizes", func(d *decode.D) {
+			for i := uint64(0); i <= levels; i++ {
+				d.FieldStruct("precinct_size", func(d *decode.D) {
+					d.FieldU4("ppy")
+					d.FieldU4("ppx")
+				})
+			}
+		})
+	}
+}
+
+// coding style flags, only precincts is used for components
+func fieldCodingStyle(d *decode.D, name string) bool {
+	var precincts bool
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldU5("reserved")
+		d.FieldBool("eph")
+		d.FieldBool("sop")
+		precincts = d.FieldBool("precincts")
+	})
+	return precincts
+}
+
+func decodeQuantization(d *decode.D) {
+	var style uint64
+	d.FieldStruct("sqcd", func(d *decode.D) {
+		d.FieldU3("guard_bits")
+		style = d.FieldU5("style", quantizationStyleNames)
+	})
+	d.FieldArray("step_sizes", func(d *decode.D) {
+		for d.NotEnd() {
+			d.FieldStruct("step_size", func(d *decode.D) {
+				d.FieldU5("exponent")
+				if style == quantizationNone {
+					d.FieldU3("reserved")
+				} else {
+					d.FieldU11("mantissa")
+				}
+			})
+		}
+	})
+}
+
+func decodeTLM(d *decode.D) {
+	d.FieldU8("ztlm")
+	var st, sp uint64
+	d.FieldStruct("stlm", func(d *decode.D) {
+		d.FieldU1("reserved0")
+		sp = d.FieldU1("sp")
+		st = d.FieldU2("st")
+		d.FieldU4("reserved1")
+	})
+	d.FieldArray("tile_parts", func(d *decode.D) {
+		for d.NotEnd() {
+			d.FieldStruct("tile_part", func(d *decode.D) {
+				if st > 0 {
+					d.FieldU("ttlm", int(st)*8)
+				}
+				if sp == 0 {
+					d.FieldU16("ptlm")
+				} else {
+					d.FieldU32("ptlm")
+				}
+			})
+		}
+	})
+}
+
+func decodePOC(d *decode.D, csiz uint64) {
+	d.FieldArray("changes", func(d *decode.D) {
+		for d.NotEnd() {
+			d.FieldStruct("change", func(d *decode.D) {
+				d.FieldU8("rspoc")
+				fieldComponent(d, "cspoc", csiz)
+				d.FieldU16("lyepoc")
+				d.FieldU8("repoc")
+				fieldComponent(d, "cepoc", csiz)
+				d.FieldU8("ppoc", progressionOrderNames)
+			})
+		}
+	})
+}
+
+func decodeCodestream(d *decode.D) {
+	var csiz uint64
+	eocFound := false
+	// end of current tile-part, -1 until end of codestream
+	tilePartEnd := int64(-1)
+
+	d.FieldArray("segments", func(d *decode.D) {
+		for d.NotEnd() && !eocFound {
+			markerStart := d.Pos()
+			var code uint64
+			d.FieldStruct("marker", func(d *decode.D) {
+				code = d.FieldU16("code", markerNames, scalar.ActualHex)
+				if code < 0xff30 {
+					d.Fatalf("invalid marker %x", code)
+				}
+
+				switch code {
+				case markerSOC, markerSOD, markerEPH:
+					return
+				case markerEOC:
+					eocFound = true
+					return
+				}
+
+				length := d.FieldU16("length")
+				if length < 2 {
+					d.Fatalf("length %d too small", length)
+				}
+				d.FramedFn(int64(length-2)*8, func(d *decode.D) {
+					switch code {
+					case markerSIZ:
+						d.FieldU16("rsiz", rsizNames, scalar.ActualHex)
+						d.FieldU32("xsiz")
+						d.FieldU32("ysiz")
+						d.FieldU32("xosiz")
+						d.FieldU32("yosiz")
+						d.FieldU32("xtsiz")
+						d.FieldU32("ytsiz")
+						d.FieldU32("xtosiz")
+						d.FieldU32("ytosiz")
+						csiz = d.FieldU16("csiz")
+						d.FieldArray("components", func(d *decode.D) {
+							for i := uint64(0); i < csiz; i++ {
+								d.FieldStruct("component", func(d *decode.D) {
+									fieldBitDepth(d, "ssiz")
+									d.FieldU8("xrsiz")
+									d.FieldU8("yrsiz")
+								})
+							}
+						})
+					case markerCOD:
+						precincts := fieldCodingStyle(d, "scod")
+						d.FieldU8("progression_order", progressionOrderNames)
+						d.FieldU16("layers")
+						d.FieldU8("multiple_component_transform")
+						decodeCodingStyleParameters(d, precincts)
+					case markerCOC:
+						fieldComponent(d, "ccoc", csiz)
+						precincts := fieldCodingStyle(d, "scoc")
+						decodeCodingStyleParameters(d, precincts)
+					case markerQCD:
+						decodeQuantization(d)
+					case markerQCC:
+						fieldComponent(d, "cqcc", csiz)
+						decodeQuantization(d)
+					case markerRGN:
+						fieldComponent(d, "crgn", csiz)
+						d.FieldU8("srgn")
+						d.FieldU8("sprgn")
+					case markerPOC:
+						decodePOC(d, csiz)
+					case markerTLM:
+						decodeTLM(d)
+					case markerCOM:
+						registration := d.FieldU16("rcme", commentRegistrationNames)
+						if registration == 1 {
+							d.FieldUTF8("comment", int(d.BitsLeft()/8))
+						} else {
+							d.FieldRawLen("comment", d.BitsLeft())
+						}
+					case markerSOT:
+						d.FieldU16("isot")
+						psot := d.FieldU32("psot")
+						d.FieldU8("tpsot")
+						d.FieldU8("tnsot")
+						tilePartEnd = -1
+						if psot != 0 {
+							tilePartEnd = markerStart + int64(psot)*8
+						}
+					default:
+						d.FieldRawLen("data", d.BitsLeft())
+					}
+				})
+			})
+
+			if code == markerSOD {
+				end := tilePartEnd
+				if end == -1 {
+					end = d.Len()
+					if d.BitsLeft() >= 16 && bytes.Equal(d.BytesRange(d.Len()-16, 2), []byte{0xff, 0xd9}) {
+						end -= 16
+					}
+				}
+				if end < d.Pos() || end > d.Len() {
+					d.Fatalf("tile-part end %d outside codestream", end/8)
+				}
+				d.FieldRawLen("bitstream", end-d.Pos())
+			}
+		}
+	})
+}
+
+func decodeBoxes(d *decode.D) {
+	d.FieldArray("boxes", func(d *decode.D) {
+		for d.BitsLeft() >= 8*8 {
+			d.FieldStruct("box", decodeBox)
+		}
+	})
+}
+
+func decodeBox(d *decode.D) {
+	size := d.FieldU32("size", scalar.UToDescription{0: "Rest of file", 1: "Use 64 bit size"})
+	typ := d.FieldUTF8("type", 4, boxDescriptions)
+
+	var dataSize int64
+	switch size {
+	case 0:
+		dataSize = d.BitsLeft()
+	case 1:
+		size = d.FieldU64("size64")
+		dataSize = int64(size)*8 - 16*8
+	default:
+		dataSize = int64(size)*8 - 8*8
+	}
+	if dataSize < 0 {
+		d.Fatalf("box size %d too small", size)
+	}
+
+	d.FramedFn(dataSize, func(d *decode.D) {
+		switch typ {
+		case "jP  ":
+			d.FieldU32("signature", d.AssertU(0x0d0a870a), scalar.ActualHex)
+		case "ftyp":
+			d.FieldUTF8("brand", 4)
+			d.FieldU32("minor_version")
+			d.FieldArray("compatibility_list", func(d *decode.D) {
+				for d.BitsLeft() >= 32 {
+					d.FieldUTF8("brand", 4)
+				}
+			})
+		case "jp2h", "res ", "uinf":
+			decodeBoxes(d)
+		case "ihdr":
+			d.FieldU32("height")
+			d.FieldU32("width")
+			d.FieldU16("nc")
+			if d.PeekBits(8) == 0xff {
+				// bpcc box has per component depth
+				d.FieldU8("bpc", scalar.UToDescription{0xff: "Varies, see bpcc box"})
+			} else {
+				fieldBitDepth(d, "bpc")
+			}
+			d.FieldU8("c")
+			d.FieldU8("unk_c")
+			d.FieldU8("ipr")
+		case "bpcc":
+			d.FieldArray("components", func(d *decode.D) {
+				for d.NotEnd() {
+					fieldBitDepth(d, "bpc")
+				}
+			})
+		case "colr":
+			method := d.FieldU8("meth", colourMethodNames)
+			d.FieldS8("prec")
+			d.FieldU8("approx")
+			switch method {
+			case 1:
+				d.FieldU32("enumcs", enumeratedColourspaceNames)
+			case 2, 3:
+				d.FieldFormatOrRawLen("profile", d.BitsLeft(), iccProfileFormat, nil)
+			default:
+				d.FieldRawLen("data", d.BitsLeft())
+			}
+		case "pclr":
+			ne := d.FieldU16("ne")
+			npc := d.FieldU8("npc")
+			var depths []uint64
+			d.FieldArray("components", func(d *decode.D) {
+				for i := uint64(0); i < npc; i++ {
+					d.FieldStruct("bpc", func(d *decode.D) {
+						d.FieldBool("signed")
+						depths = append(depths, d.FieldU7("depth", scalar.ActualUAdd(1))+1)
+					})
+				}
+			})
+			d.FieldArray("entries", func(d *decode.D) {
+				for i := uint64(0); i < ne; i++ {
+					d.FieldArray("entry", func(d *decode.D) {
+						for _, depth := range depths {
+							// each value is stored in whole bytes
+							d.FieldU("value", int((depth+7)/8)*8)
+						}
+					})
+				}
+			})
+		case "cmap":
+			d.FieldArray("components", func(d *decode.D) {
+				for d.NotEnd() {
+					d.FieldStruct("component", func(d *decode.D) {
+						d.FieldU16("cmp")
+						d.FieldU8("mtyp", scalar.UToSymStr{0: "direct", 1: "palette"})
+						d.FieldU8("pcol")
+					})
+				}
+			})
+		case "cdef":
+			n := d.FieldU16("n")
+			d.FieldArray("channels", func(d *decode.D) {
+				for i := uint64(0); i < n; i++ {
+					d.FieldStruct("channel", func(d *decode.D) {
+						d.FieldU16("cn")
+						d.FieldU16("typ", channelTypeNames)
+						d.FieldU16("asoc", scalar.UToSymStr{0: "whole_image", 0xffff: "unassociated"})
+					})
+				}
+			})
+		case "resc", "resd":
+			d.FieldU16("vrn")
+			d.FieldU16("vrd")
+			d.FieldU16("hrn")
+			d.FieldU16("hrd")
+			d.FieldS8("vre")
+			d.FieldS8("hre")
+		case "jp2c":
+			d.FieldStruct("codestream", decodeCodestream)
+		case "xml ":
+			d.FieldUTF8("xml", int(d.BitsLeft()/8))
+		case "uuid":
+			d.FieldRawLen("uuid", 16*8, scalar.RawUUID)
+			d.FieldRawLen("data", d.BitsLeft())
+		case "ulst":
+			nu := d.FieldU16("nu")
+			d.FieldArray("ids", func(d *decode.D) {
+				for i := uint64(0); i < nu; i++ {
+					d.FieldRawLen("id", 16*8, scalar.RawUUID)
+				}
+			})
+		case "url ":
+			d.FieldU8("version")
+			d.FieldU24("flags")
+			d.FieldUTF8Null("location")
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+func jpeg2000Decode(d *decode.D, _ any) any {
+	switch {
+	case bytes.Equal(d.PeekBytes(len(jp2Signature)), jp2Signature):
+		decodeBoxes(d)
+	case bytes.Equal(d.PeekBytes(len(codestreamSignature)), codestreamSignature):
+		decodeCodestream(d)
+	default:
+		d.Fatalf("no JP2 signature box or codestream SOC marker found")
+	}
+
+	return nil
+}
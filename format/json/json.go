@@ -105,6 +105,7 @@ func makeEncoder(opts ToJSONOpts) *colorjson.Encoder {
 				panic(fmt.Sprintf("toValue not a JQValue value: %#v %T", v, v))
 			}
 		},
+		nil,
 		colorjson.Colors{},
 	)
 }
@@ -0,0 +1,276 @@
+package kafka
+
+// https://kafka.apache.org/documentation/#recordbatch
+// https://github.com/apache/kafka/blob/trunk/clients/src/main/java/org/apache/kafka/common/record/DefaultRecordBatch.java
+// https://github.com/apache/kafka/blob/trunk/clients/src/main/java/org/apache/kafka/common/record/DefaultRecord.java
+
+import (
+	"bytes"
+	"compress/gzip"
+	"embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed kafka_log.jq
+var kafkaFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.KAFKA_LOG,
+		Description: "Kafka log segment",
+		DecodeFn:    logDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(kafkaFS)
+}
+
+const (
+	// base offset and batch length
+	batchLogOverheadBytes = 12
+	// header up to and including records count
+	batchOverheadBytes = 61
+	// batch length is counted from partition leader epoch
+	batchCRCStartBytes = 21
+	maxVarintBytes     = 10
+)
+
+const (
+	compressionNone   = 0
+	compressionGzip   = 1
+	compressionSnappy = 2
+	compressionLZ4    = 3
+	compressionZstd   = 4
+)
+
+var compressionNames = scalar.UToSymStr{
+	compressionNone:   "none",
+	compressionGzip:   "gzip",
+	compressionSnappy: "snappy",
+	compressionLZ4:    "lz4",
+	compressionZstd:   "zstd",
+}
+
+var timestampTypeNames = scalar.UToSymStr{
+	0: "create_time",
+	1: "log_append_time",
+}
+
+var noValueNames = scalar.SToSymStr{-1: "none"}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// milliseconds since unix epoch, -1 means no timestamp
+var timestampDescription = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	v, ok := s.Actual.(int64)
+	if !ok {
+		return s, nil
+	}
+	if v >= 0 {
+		s.Description = time.UnixMilli(v).UTC().Format(time.RFC3339Nano)
+	}
+	return s, nil
+})
+
+// zigzag encoded little endian 7 bit groups, same as protobuf
+func decodeVarint(d *decode.D) int64 {
+	var n uint64
+	for i := 0; i < maxVarintBytes; i++ {
+		b := d.U8()
+		n |= (b & 0x7f) << (i * 7)
+		if b&0x80 == 0 {
+			return int64(n>>1) ^ -int64(n&1)
+		}
+	}
+	d.Fatalf("varint longer than %d bytes", maxVarintBytes)
+	return 0
+}
+
+var xerialSnappyMagic = []byte{0x82, 'S', 'N', 'A', 'P', 'P', 'Y', 0x00}
+
+// java clients use snappy-java stream framing with big endian length prefixed blocks
+func snappyDecode(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, xerialSnappyMagic) {
+		return snappy.Decode(nil, b)
+	}
+	// magic, version and compatible version
+	if len(b) < len(xerialSnappyMagic)+8 {
+		return nil, errors.New("truncated header")
+	}
+	b = b[len(xerialSnappyMagic)+8:]
+	var out []byte
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, errors.New("truncated block length")
+		}
+		n := binary.BigEndian.Uint32(b)
+		b = b[4:]
+		if uint64(n) > uint64(len(b)) {
+			return nil, errors.New("block outside input")
+		}
+		block, err := snappy.Decode(nil, b[0:n])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, block...)
+		b = b[n:]
+	}
+	return out, nil
+}
+
+func uncompress(compression uint64, b []byte) ([]byte, error) {
+	switch compression {
+	case compressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(zr)
+	case compressionSnappy:
+		return snappyDecode(b)
+	case compressionLZ4:
+		return io.ReadAll(lz4.NewReader(bytes.NewReader(b)))
+	case compressionZstd:
+		zd, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer zd.Close()
+		return zd.DecodeAll(b, nil)
+	default:
+		return nil, fmt.Errorf("unknown compression %d", compression)
+	}
+}
+
+func decodeLengthBytes(d *decode.D, name string, lengthName string, fn func(d *decode.D, n int64)) {
+	n := d.FieldSFn(lengthName, decodeVarint, noValueNames)
+	if n < -1 {
+		d.Fatalf("invalid %s %d", lengthName, n)
+	}
+	if n == -1 {
+		d.FieldValueNil(name)
+		return
+	}
+	fn(d, n)
+}
+
+func decodeRecords(d *decode.D, count int64, baseOffset int64, baseTimestamp int64) {
+	d.FieldArray("records", func(d *decode.D) {
+		for i := int64(0); i < count; i++ {
+			d.FieldStruct("record", func(d *decode.D) {
+				length := d.FieldSFn("length", decodeVarint)
+				if length < 0 || length*8 > d.BitsLeft() {
+					d.Fatalf("invalid record length %d", length)
+				}
+				d.FramedFn(length*8, func(d *decode.D) {
+					d.FieldU8("attributes")
+					timestampDelta := d.FieldSFn("timestamp_delta", decodeVarint)
+					d.FieldValueS("timestamp", baseTimestamp+timestampDelta, timestampDescription)
+					offsetDelta := d.FieldSFn("offset_delta", decodeVarint)
+					d.FieldValueS("offset", baseOffset+offsetDelta)
+					decodeLengthBytes(d, "key", "key_length", func(d *decode.D, n int64) {
+						d.FieldRawLen("key", n*8)
+					})
+					decodeLengthBytes(d, "value", "value_length", func(d *decode.D, n int64) {
+						d.FieldRawLen("value", n*8)
+					})
+					headersCount := d.FieldSFn("headers_count", decodeVarint)
+					d.FieldArray("headers", func(d *decode.D) {
+						for j := int64(0); j < headersCount; j++ {
+							d.FieldStruct("header", func(d *decode.D) {
+								keyLength := d.FieldSFn("key_length", decodeVarint)
+								if keyLength < 0 {
+									d.Fatalf("invalid header key length %d", keyLength)
+								}
+								d.FieldUTF8("key", int(keyLength))
+								decodeLengthBytes(d, "value", "value_length", func(d *decode.D, n int64) {
+									d.FieldRawLen("value", n*8)
+								})
+							})
+						}
+					})
+				})
+			})
+		}
+	})
+}
+
+func decodeBatch(d *decode.D) {
+	batchStart := d.Pos()
+	baseOffset := d.FieldS64("base_offset")
+	batchLength := d.FieldS32("batch_length")
+	batchEnd := batchStart + (batchLogOverheadBytes+batchLength)*8
+	d.FieldS32("partition_leader_epoch")
+	d.FieldU8("magic", d.AssertU(2))
+	crc := crc32.Checksum(d.BytesRange(batchStart+batchCRCStartBytes*8, int(batchEnd-batchStart)/8-batchCRCStartBytes), crc32cTable)
+	d.FieldU32("crc", d.ValidateU(uint64(crc)), scalar.ActualHex)
+	var compression uint64
+	d.FieldStruct("attributes", func(d *decode.D) {
+		d.FieldU9("unused")
+		d.FieldBool("has_delete_horizon_ms")
+		d.FieldBool("is_control_batch")
+		d.FieldBool("is_transactional")
+		d.FieldU1("timestamp_type", timestampTypeNames)
+		compression = d.FieldU3("compression", compressionNames)
+	})
+	lastOffsetDelta := d.FieldS32("last_offset_delta")
+	d.FieldValueS("last_offset", baseOffset+int64(lastOffsetDelta))
+	baseTimestamp := d.FieldS64("base_timestamp", timestampDescription)
+	d.FieldS64("max_timestamp", timestampDescription)
+	d.FieldS64("producer_id", noValueNames)
+	d.FieldS16("producer_epoch", noValueNames)
+	d.FieldS32("base_sequence", noValueNames)
+	recordsCount := d.FieldS32("records_count")
+	if recordsCount < 0 {
+		d.Fatalf("invalid records count %d", recordsCount)
+	}
+
+	recordsLen := batchEnd - d.Pos()
+	if compression == compressionNone {
+		d.FramedFn(recordsLen, func(d *decode.D) {
+			decodeRecords(d, recordsCount, baseOffset, baseTimestamp)
+		})
+		return
+	}
+
+	compressed := d.BytesRange(d.Pos(), int(recordsLen/8))
+	d.FieldRawLen("compressed", recordsLen)
+	if uncompressed, err := uncompress(compression, compressed); err == nil {
+		d.FieldStructRootBitBufFn("uncompressed", bitio.NewBitReader(uncompressed, -1), func(d *decode.D) {
+			decodeRecords(d, recordsCount, baseOffset, baseTimestamp)
+		})
+	}
+}
+
+func logDecode(d *decode.D, _ any) any {
+	d.FieldArray("batches", func(d *decode.D) {
+		for d.BitsLeft() >= batchOverheadBytes*8 {
+			var batchLength int64
+			d.RangeFn(d.Pos()+64, 32, func(d *decode.D) { batchLength = d.S32() })
+			// truncated segment, ex after crash
+			if batchLength < batchOverheadBytes-batchLogOverheadBytes ||
+				int64(batchLength+batchLogOverheadBytes)*8 > d.BitsLeft() {
+				break
+			}
+			d.FieldStruct("batch", decodeBatch)
+		}
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package lz4
+
+// https://github.com/lz4/lz4/blob/dev/doc/lz4_Frame_format.md
+// https://github.com/lz4/lz4/blob/dev/doc/lz4_Block_format.md
+// TODO: legacy frame format
+// TODO: dictionary support
+
+import (
+	"embed"
+
+	"github.com/pierrec/lz4/v4"
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/checksum"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed lz4.jq
+var lz4FS embed.FS
+
+var probeFormat decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.LZ4,
+		Description: "LZ4 frame compression",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    lz4Decode,
+		DecodeInArg: format.Lz4In{
+			Uncompress: true,
+		},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.PROBE}, Group: &probeFormat},
+		},
+		Functions: []string{"_help"},
+	})
+	interp.RegisterFS(lz4FS)
+}
+
+const (
+	frameMagic             = 0x18_4d_22_04
+	skippableFrameMagicMin = 0x18_4d_2a_50
+	skippableFrameMagicMax = 0x18_4d_2a_5f
+)
+
+// max uncompressed size of block is also max distance for dependent blocks
+const blockDictSize = 64 * 1024
+
+var blockMaxSizeNames = scalar.UToSymStr{
+	4: "64KB",
+	5: "256KB",
+	6: "1MB",
+	7: "4MB",
+}
+
+func decodeFrame(d *decode.D, li format.Lz4In) {
+	d.FieldU32("magic", d.AssertU(frameMagic), scalar.ActualHex)
+
+	var blockIndependence bool
+	var hasBlockChecksum bool
+	var hasContentSize bool
+	var hasContentChecksum bool
+	var hasDictID bool
+	var blockMaxSize uint64
+	var contentSize uint64
+
+	descriptorStart := d.Pos()
+	d.FieldStruct("descriptor", func(d *decode.D) {
+		d.FieldStruct("flags", func(d *decode.D) {
+			d.FieldU2("version", d.AssertU(1))
+			blockIndependence = d.FieldBool("block_independence")
+			hasBlockChecksum = d.FieldBool("block_checksum")
+			hasContentSize = d.FieldBool("content_size")
+			hasContentChecksum = d.FieldBool("content_checksum")
+			d.FieldU1("reserved0")
+			hasDictID = d.FieldBool("dict_id")
+		})
+		d.FieldStruct("block_descriptor", func(d *decode.D) {
+			d.FieldU1("reserved0")
+			blockMaxSize = d.FieldU3("block_max_size", blockMaxSizeNames)
+			d.FieldU4("reserved1")
+		})
+		if hasContentSize {
+			contentSize = d.FieldU64("content_size")
+		}
+		if hasDictID {
+			d.FieldU32("dict_id", scalar.ActualHex)
+		}
+		headerXXH32 := &checksum.XXH32{}
+		d.CopyBits(headerXXH32, d.BitBufRange(descriptorStart, d.Pos()-descriptorStart))
+		d.FieldU8("header_checksum", d.ValidateU(uint64(headerXXH32.Sum32()>>8)&0xff), scalar.ActualHex)
+	})
+
+	blockMaxBytes := 0
+	if blockMaxSize >= 4 {
+		blockMaxBytes = blockDictSize << (2 * (blockMaxSize - 4))
+	}
+
+	// dictionaries are not supported so can't uncompress if used
+	uncompress := li.Uncompress && !hasDictID && blockMaxBytes > 0
+	var uncompressed []byte
+
+	d.FieldArray("blocks", func(d *decode.D) {
+		for d.PeekBits(32) != 0 {
+			d.FieldStruct("block", func(d *decode.D) {
+				blockSize := d.FieldU32("size", scalar.ActualHex)
+				isCompressed := blockSize&0x80_00_00_00 == 0
+				dataSize := blockSize & 0x7f_ff_ff_ff
+				d.FieldValueBool("compressed", isCompressed)
+				d.FieldValueU("data_size", dataSize)
+				dataStart := d.Pos()
+				d.FieldRawLen("data", int64(dataSize)*8)
+				if hasBlockChecksum {
+					blockXXH32 := &checksum.XXH32{}
+					d.CopyBits(blockXXH32, d.BitBufRange(dataStart, int64(dataSize)*8))
+					d.FieldU32("checksum", d.ValidateU(uint64(blockXXH32.Sum32())), scalar.ActualHex)
+				}
+
+				if !uncompress {
+					return
+				}
+
+				data := d.BytesRange(dataStart, int(dataSize))
+				if !isCompressed {
+					uncompressed = append(uncompressed, data...)
+					return
+				}
+
+				var dict []byte
+				if !blockIndependence {
+					dict = uncompressed
+					if len(dict) > blockDictSize {
+						dict = dict[len(dict)-blockDictSize:]
+					}
+				}
+				block := make([]byte, blockMaxBytes)
+				n, err := lz4.UncompressBlockWithDict(data, block, dict)
+				if err != nil {
+					// keep decoding frame structure but skip uncompressed content
+					uncompress = false
+					uncompressed = nil
+					return
+				}
+				uncompressed = append(uncompressed, block[0:n]...)
+			})
+		}
+	})
+	d.FieldU32("end_mark", d.AssertU(0))
+
+	if hasContentChecksum {
+		if uncompress {
+			contentXXH32 := &checksum.XXH32{}
+			_, _ = contentXXH32.Write(uncompressed)
+			d.FieldU32("content_checksum", d.ValidateU(uint64(contentXXH32.Sum32())), scalar.ActualHex)
+		} else {
+			d.FieldU32("content_checksum", scalar.ActualHex)
+		}
+	}
+
+	if uncompress {
+		if hasContentSize && contentSize != uint64(len(uncompressed)) {
+			d.Errorf("content size %d does not match uncompressed size %d", contentSize, len(uncompressed))
+		}
+
+		uncompressedBR := bitio.NewBitReader(uncompressed, -1)
+		if dv, _, _ := d.TryFieldFormatBitBuf("uncompressed", uncompressedBR, probeFormat, nil); dv == nil {
+			d.FieldRootBitBuf("uncompressed", uncompressedBR)
+		}
+	}
+}
+
+func lz4Decode(d *decode.D, in any) any {
+	li, _ := in.(format.Lz4In)
+
+	d.Endian = decode.LittleEndian
+
+	frameCount := 0
+	d.FieldArray("frames", func(d *decode.D) {
+		for d.BitsLeft() >= 32 {
+			magic := d.U32()
+			d.SeekRel(-32)
+			switch {
+			case magic == frameMagic:
+				d.FieldStruct("frame", func(d *decode.D) { decodeFrame(d, li) })
+			case magic >= skippableFrameMagicMin && magic <= skippableFrameMagicMax:
+				d.FieldStruct("skippable_frame", func(d *decode.D) {
+					d.FieldU32("magic", scalar.ActualHex)
+					size := d.FieldU32("size")
+					d.FieldRawLen("data", int64(size)*8)
+				})
+			default:
+				// trailing data, let root decoder report it as unknown
+				return
+			}
+			frameCount++
+		}
+	})
+	if frameCount == 0 {
+		d.Fatalf("no lz4 frame found")
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package lzma
+
+// https://github.com/jljusten/LZMA-SDK/blob/master/DOC/lzma-specification.txt
+// TODO: probe? has no magic but properties and dictionary size are usually well known values
+
+import (
+	"embed"
+	"io"
+	"math"
+
+	"github.com/ulikunitz/xz/lzma"
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/internal/ioex"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed lzma.jq
+var lzmaFS embed.FS
+
+var probeFormat decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.LZMA,
+		Description: "LZMA alone compression",
+		DecodeFn:    lzmaDecode,
+		DecodeInArg: format.LzmaIn{
+			Uncompress: true,
+		},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.PROBE}, Group: &probeFormat},
+		},
+		Functions: []string{"_help"},
+	})
+	interp.RegisterFS(lzmaFS)
+}
+
+const headerLen = 13
+
+// max value for properties byte, (pb * 5 + lp) * 9 + lc
+const maxProperties = (4*5+4)*9 + 8
+
+var uncompressedSizeNames = scalar.UToSymStr{
+	math.MaxUint64: "unknown",
+}
+
+func lzmaDecode(d *decode.D, in any) any {
+	li, _ := in.(format.LzmaIn)
+
+	d.Endian = decode.LittleEndian
+
+	headerStart := d.Pos()
+	props := d.FieldU8("properties", d.AssertURange(0, maxProperties))
+	d.FieldValueU("lc", props%9)
+	d.FieldValueU("lp", (props/9)%5)
+	d.FieldValueU("pb", props/(9*5))
+	d.FieldU32("dictionary_size")
+	uncompressedSize := d.FieldU64("uncompressed_size", uncompressedSizeNames)
+
+	if !li.Uncompress {
+		d.FieldRawLen("compressed", d.BitsLeft())
+		return nil
+	}
+
+	// lzma reader wants to parse header itself so start from header start
+	rFn := func(r io.Reader) io.Reader {
+		lr, err := lzma.NewReader(r)
+		if err != nil {
+			return ioex.ErrReader{Err: err}
+		}
+		return lr
+	}
+	readCompressedSize, uncompressedBR, dv, _, _ := d.TryFieldReaderRangeFormat("uncompressed", headerStart, d.Len()-headerStart, rFn, probeFormat, nil)
+	if uncompressedBR == nil {
+		d.FieldRawLen("compressed", d.BitsLeft())
+		return nil
+	}
+	if dv == nil {
+		d.FieldRootBitBuf("uncompressed", uncompressedBR)
+	}
+	d.FieldRawLen("compressed", readCompressedSize-headerLen*8)
+
+	if uncompressedSize != math.MaxUint64 {
+		if uncompressedLen, err := uncompressedBR.SeekBits(0, io.SeekEnd); err == nil && uint64(uncompressedLen/8) != uncompressedSize {
+			d.Errorf("uncompressed size %d does not match header size %d", uncompressedLen/8, uncompressedSize)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package matroska
+
+// Generic EBML decoder, element names and types can be given using the elements option
+// https://www.rfc-editor.org/rfc/rfc8794
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/matroska/ebml"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed ebml.jq
+var ebmlFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.EBML,
+		Description: "Extensible Binary Meta Language",
+		DecodeFn:    ebmlDecode,
+		DecodeInArg: format.EBMLIn{},
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(ebmlFS)
+}
+
+type ebmlElementDef struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Definition string `json:"definition"`
+}
+
+func (e *ebmlElementDef) UnmarshalJSON(b []byte) error {
+	// "name" is short for {"name": "name"}
+	if err := json.Unmarshal(b, &e.Name); err == nil {
+		return nil
+	}
+	type def ebmlElementDef
+	return json.Unmarshal(b, (*def)(e))
+}
+
+// parseEBMLElements parses a JSON object with element IDs as keys, ex:
+// {"0x4286": "version", "0x18538067": {"name": "segment", "type": "master"}}
+// IDs are raw, including the vint width marker, and are looked up at any depth.
+func parseEBMLElements(s string) (ebml.Tag, error) {
+	var defs map[string]ebmlElementDef
+	if err := json.Unmarshal([]byte(s), &defs); err != nil {
+		return nil, err
+	}
+
+	typeNameToType := map[string]ebml.Type{}
+	for t, n := range ebml.TypeNames {
+		typeNameToType[n] = t
+	}
+
+	tag := ebml.Tag{
+		ebml.HeaderID: {Name: "ebml", Type: ebml.Master, Tag: ebml.Header},
+	}
+	for k, def := range defs {
+		id, err := strconv.ParseUint(k, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid element ID", k)
+		}
+		t := ebml.Unknown
+		if def.Type != "" {
+			var ok bool
+			t, ok = typeNameToType[def.Type]
+			if !ok {
+				return nil, fmt.Errorf("%s: unknown type %q", k, def.Type)
+			}
+		}
+		a := ebml.Attribute{Name: def.Name, Type: t, Definition: def.Definition}
+		if t == ebml.Master {
+			a.Tag = tag
+		}
+		tag[id] = a
+	}
+
+	return tag, nil
+}
+
+func decodeEBMLMaster(d *decode.D, bitsLimit int64, tag ebml.Tag) {
+	tagEndBit := d.Pos() + bitsLimit
+
+	d.FieldArray("elements", func(d *decode.D) {
+		for d.Pos() < tagEndBit && d.NotEnd() {
+			d.FieldStruct("element", func(d *decode.D) {
+				a := ebml.Attribute{
+					Type: ebml.Unknown,
+				}
+
+				d.FieldUFn("id", decodeRawVint, scalar.Fn(func(s scalar.S) (scalar.S, error) {
+					n := s.ActualU()
+					var ok bool
+					a, ok = tag[n]
+					if !ok {
+						a, ok = ebml.Global[n]
+						if !ok {
+							a = ebml.Attribute{
+								Type: ebml.Unknown,
+							}
+							return scalar.S{Actual: n, ActualDisplay: scalar.NumberHex, Description: "Unknown"}, nil
+						}
+					}
+					return scalar.S{Actual: n, ActualDisplay: scalar.NumberHex, Sym: a.Name, Description: a.Definition}, nil
+				}))
+				d.FieldValueStr("type", ebml.TypeNames[a.Type])
+
+				// all size bits set means unknown size, usually only used for master elements
+				// TODO: should end at first element that is not a valid child
+				unknownSize := false
+				tagSize := int64(d.FieldUFn("size", func(d *decode.D) uint64 {
+					n, w := decodeRawVintWidth(d)
+					m := uint64(1)<<(w*7) - 1
+					unknownSize = n&m == m
+					return n & m
+				}, scalar.Fn(func(s scalar.S) (scalar.S, error) {
+					if unknownSize {
+						s.Description = "Unknown"
+					}
+					return s, nil
+				})))
+				bitsLeft := tagEndBit - d.Pos()
+				if unknownSize {
+					tagSize = bitsLeft / 8
+				}
+				if tagSize*8 > bitsLeft {
+					d.Fatalf("tagSize %d outside parent", tagSize)
+				}
+
+				switch a.Type {
+				case ebml.Integer:
+					if tagSize > 8 {
+						d.Fatalf("invalid tagSize %d for number type", tagSize)
+					}
+					d.FieldS("value", int(tagSize)*8)
+				case ebml.Uinteger:
+					if tagSize > 8 {
+						d.Fatalf("invalid tagSize %d for number type", tagSize)
+					}
+					d.FieldU("value", int(tagSize)*8)
+				case ebml.Float:
+					if tagSize != 0 && tagSize != 4 && tagSize != 8 {
+						d.Fatalf("invalid tagSize %d for float type", tagSize)
+					}
+					d.FieldF("value", int(tagSize)*8)
+				case ebml.String,
+					ebml.UTF8:
+					d.FieldUTF8NullFixedLen("value", int(tagSize))
+				case ebml.Date:
+					if tagSize > 8 {
+						d.Fatalf("invalid tagSize %d for date type", tagSize)
+					}
+					// signed nanoseconds since 2001-01-01T00:00:00 UTC
+					d.FieldS("value", int(tagSize)*8)
+				case ebml.Binary:
+					d.FieldRawLen("value", tagSize*8)
+				case ebml.Master:
+					decodeEBMLMaster(d, tagSize*8, a.Tag)
+				default:
+					d.FieldRawLen("data", tagSize*8)
+				}
+			})
+		}
+	})
+}
+
+func ebmlDecode(d *decode.D, in any) any {
+	if d.PeekBits(32) != ebml.HeaderID {
+		d.Fatalf("no EBML header found")
+	}
+
+	tag := ebml.Tag{
+		ebml.HeaderID: {Name: "ebml", Type: ebml.Master, Tag: ebml.Header},
+	}
+	if ei, ok := in.(format.EBMLIn); ok && ei.Elements != "" {
+		var err error
+		tag, err = parseEBMLElements(ei.Elements)
+		if err != nil {
+			d.Fatalf("elements: %s", err)
+		}
+	}
+
+	decodeEBMLMaster(d, d.BitsLeft(), tag)
+
+	return nil
+}
@@ -23,7 +23,7 @@ var TypeNames = map[Type]string{
 	Float:    "float",
 	String:   "string",
 	UTF8:     "utf8",
-	Date:     "data",
+	Date:     "date",
 	Binary:   "binary",
 	Master:   "master",
 }
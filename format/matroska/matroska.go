@@ -78,7 +78,7 @@ func init() {
 			{Names: []string{format.VP9_CFM}, Group: &vp9CFMFormat},
 			{Names: []string{format.VP9_FRAME}, Group: &vp9FrameFormat},
 		},
-		Functions: []string{"_help"},
+		Functions: []string{"_at_time", "_help", "_timeline"},
 	})
 	interp.RegisterFS(matroskaFS)
 
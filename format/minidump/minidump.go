@@ -0,0 +1,515 @@
+package minidump
+
+// https://learn.microsoft.com/en-us/windows/win32/api/minidumpapiset/
+// https://github.com/llvm/llvm-project/blob/main/llvm/include/llvm/BinaryFormat/Minidump.h
+// https://chromium.googlesource.com/breakpad/breakpad/+/refs/heads/main/src/google_breakpad/common/minidump_format.h
+// TODO: decode more stream types (handle data, memory info, thread names)
+// TODO: decode context for other architectures than amd64
+
+import (
+	"embed"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed minidump.jq
+var minidumpFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.MINIDUMP,
+		Description: "Windows minidump crash dump",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    minidumpDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(minidumpFS)
+}
+
+const signature = "MDMP"
+
+const (
+	streamTypeThreadList         = 3
+	streamTypeModuleList         = 4
+	streamTypeMemoryList         = 5
+	streamTypeException          = 6
+	streamTypeSystemInfo         = 7
+	streamTypeMemory64List       = 9
+	streamTypeCommentA           = 10
+	streamTypeCommentW           = 11
+	streamTypeUnloadedModuleList = 14
+	streamTypeMiscInfo           = 15
+)
+
+var streamTypeNames = scalar.UToSymStr{
+	0:                            "unused",
+	1:                            "reserved0",
+	2:                            "reserved1",
+	streamTypeThreadList:         "thread_list",
+	streamTypeModuleList:         "module_list",
+	streamTypeMemoryList:         "memory_list",
+	streamTypeException:          "exception",
+	streamTypeSystemInfo:         "system_info",
+	8:                            "thread_ex_list",
+	streamTypeMemory64List:       "memory64_list",
+	streamTypeCommentA:           "comment_a",
+	streamTypeCommentW:           "comment_w",
+	12:                           "handle_data",
+	13:                           "function_table",
+	streamTypeUnloadedModuleList: "unloaded_module_list",
+	streamTypeMiscInfo:           "misc_info",
+	16:                           "memory_info_list",
+	17:                           "thread_info_list",
+	18:                           "handle_operation_list",
+	19:                           "token",
+	20:                           "java_script_data",
+	21:                           "system_memory_info",
+	22:                           "process_vm_counters",
+	23:                           "ipt_trace",
+	24:                           "thread_names",
+	0x43500001:                   "crashpad_info",
+	0x47670001:                   "breakpad_info",
+	0x47670002:                   "assertion_info",
+	0x47670003:                   "linux_cpu_info",
+	0x47670004:                   "linux_proc_status",
+	0x47670005:                   "linux_lsb_release",
+	0x47670006:                   "linux_cmd_line",
+	0x47670007:                   "linux_environ",
+	0x47670008:                   "linux_auxv",
+	0x47670009:                   "linux_maps",
+	0x4767000a:                   "linux_dso_debug",
+}
+
+const processorArchitectureAMD64 = 9
+
+var processorArchitectureNames = scalar.UToSymStr{
+	0:                          "x86",
+	1:                          "mips",
+	2:                          "alpha",
+	3:                          "ppc",
+	4:                          "shx",
+	5:                          "arm",
+	6:                          "ia64",
+	7:                          "alpha64",
+	8:                          "msil",
+	processorArchitectureAMD64: "amd64",
+	10:                         "ia32_on_win64",
+	12:                         "arm64",
+	0x8001:                     "sparc",
+	0x8002:                     "ppc64",
+	0x8003:                     "linux_x86_64",
+	0xffff:                     "unknown",
+}
+
+var productTypeNames = scalar.UToSymStr{
+	1: "workstation",
+	2: "domain_controller",
+	3: "server",
+}
+
+var platformIDNames = scalar.UToSymStr{
+	0:      "win32s",
+	1:      "win32_windows",
+	2:      "win32_nt",
+	3:      "win32_ce",
+	0x8000: "unix",
+	0x8101: "macos",
+	0x8102: "ios",
+	0x8201: "linux",
+	0x8202: "solaris",
+	0x8203: "android",
+	0x8204: "ps3",
+	0x8205: "nacl",
+	0x8206: "fuchsia",
+}
+
+var exceptionCodeNames = scalar.UToSymStr{
+	0x80000003: "breakpoint",
+	0x80000004: "single_step",
+	0xc0000005: "access_violation",
+	0xc0000006: "in_page_error",
+	0xc000001d: "illegal_instruction",
+	0xc0000025: "noncontinuable_exception",
+	0xc000008c: "array_bounds_exceeded",
+	0xc000008e: "float_divide_by_zero",
+	0xc0000094: "integer_divide_by_zero",
+	0xc0000096: "privileged_instruction",
+	0xc00000fd: "stack_overflow",
+	0xc0000374: "heap_corruption",
+	0xc0000409: "stack_buffer_overrun",
+	0xe06d7363: "cpp_exception",
+}
+
+const amd64ContextLen = 1232
+
+const cvSignatureRSDS = "RSDS"
+
+type dumpContext struct {
+	processorArchitecture uint64
+}
+
+func fieldLocation(d *decode.D) (uint64, uint64) {
+	dataSize := d.FieldU32("data_size")
+	rva := d.FieldU32("rva", scalar.ActualHex)
+	return dataSize, rva
+}
+
+func fieldMinidumpString(d *decode.D, name string, rva uint64) {
+	if rva == 0 {
+		return
+	}
+	d.RangeFn(int64(rva)*8, d.Len()-int64(rva)*8, func(d *decode.D) {
+		d.FieldStruct(name, func(d *decode.D) {
+			length := d.FieldU32("length")
+			d.FieldUTF16LE("value", int(length))
+		})
+	})
+}
+
+func fieldLocationRaw(d *decode.D, name string, dataSize uint64, rva uint64) {
+	if dataSize == 0 {
+		return
+	}
+	d.RangeFn(int64(rva)*8, int64(dataSize)*8, func(d *decode.D) {
+		d.FieldRawLen(name, d.BitsLeft())
+	})
+}
+
+func decodeAMD64Context(d *decode.D) {
+	d.FieldArray("p_home", func(d *decode.D) {
+		for i := 0; i < 6; i++ {
+			d.FieldU64("p_home", scalar.ActualHex)
+		}
+	})
+	d.FieldU32("context_flags", scalar.ActualHex)
+	d.FieldU32("mx_csr", scalar.ActualHex)
+	for _, n := range []string{"cs", "ds", "es", "fs", "gs", "ss"} {
+		d.FieldU16(n, scalar.ActualHex)
+	}
+	d.FieldU32("eflags", scalar.ActualHex)
+	for _, n := range []string{
+		"dr0", "dr1", "dr2", "dr3", "dr6", "dr7",
+		"rax", "rcx", "rdx", "rbx", "rsp", "rbp", "rsi", "rdi",
+		"r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15",
+		"rip",
+	} {
+		d.FieldU64(n, scalar.ActualHex)
+	}
+	d.FieldRawLen("flt_save", 512*8)
+	d.FieldRawLen("vector_register", 26*16*8)
+	d.FieldU64("vector_control", scalar.ActualHex)
+	d.FieldU64("debug_control", scalar.ActualHex)
+	d.FieldU64("last_branch_to_rip", scalar.ActualHex)
+	d.FieldU64("last_branch_from_rip", scalar.ActualHex)
+	d.FieldU64("last_exception_to_rip", scalar.ActualHex)
+	d.FieldU64("last_exception_from_rip", scalar.ActualHex)
+}
+
+func fieldContext(d *decode.D, dc *dumpContext) {
+	var dataSize, rva uint64
+	d.FieldStruct("thread_context", func(d *decode.D) {
+		dataSize, rva = fieldLocation(d)
+	})
+	if dataSize == 0 {
+		return
+	}
+	d.RangeFn(int64(rva)*8, int64(dataSize)*8, func(d *decode.D) {
+		if dc.processorArchitecture == processorArchitectureAMD64 && dataSize == amd64ContextLen {
+			d.FieldStruct("context", decodeAMD64Context)
+			return
+		}
+		d.FieldRawLen("context", d.BitsLeft())
+	})
+}
+
+func fieldMemoryDescriptor(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldU64("start_of_memory_range", scalar.ActualHex)
+		var dataSize, rva uint64
+		d.FieldStruct("memory", func(d *decode.D) {
+			dataSize, rva = fieldLocation(d)
+		})
+		fieldLocationRaw(d, "data", dataSize, rva)
+	})
+}
+
+func decodeThreadList(d *decode.D, dc *dumpContext) {
+	n := d.FieldU32("number_of_threads")
+	d.FieldArray("threads", func(d *decode.D) {
+		for i := uint64(0); i < n; i++ {
+			d.FieldStruct("thread", func(d *decode.D) {
+				d.FieldU32("thread_id")
+				d.FieldU32("suspend_count")
+				d.FieldU32("priority_class")
+				d.FieldU32("priority")
+				d.FieldU64("teb", scalar.ActualHex)
+				fieldMemoryDescriptor(d, "stack")
+				fieldContext(d, dc)
+			})
+		}
+	})
+}
+
+// guid with first three groups in little endian
+var rawGUID = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	return scalar.RawSym(s, 16, func(b []byte) string {
+		return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+			binary.LittleEndian.Uint32(b[0:4]), binary.LittleEndian.Uint16(b[4:6]), binary.LittleEndian.Uint16(b[6:8]),
+			b[8:10], b[10:16])
+	})
+})
+
+func decodeCVRecord(d *decode.D) {
+	if d.BitsLeft() < 4*8 || string(d.PeekBytes(4)) != cvSignatureRSDS {
+		d.FieldRawLen("data", d.BitsLeft())
+		return
+	}
+	d.FieldUTF8("signature", 4)
+	d.FieldRawLen("guid", 16*8, rawGUID)
+	d.FieldU32("age")
+	d.FieldUTF8NullFixedLen("pdb_file_name", int(d.BitsLeft()/8))
+}
+
+func decodeFixedFileInfo(d *decode.D) {
+	d.FieldU32("signature", scalar.ActualHex)
+	d.FieldU32("struct_version", scalar.ActualHex)
+	d.FieldU32("file_version_ms", scalar.ActualHex)
+	d.FieldU32("file_version_ls", scalar.ActualHex)
+	d.FieldU32("product_version_ms", scalar.ActualHex)
+	d.FieldU32("product_version_ls", scalar.ActualHex)
+	d.FieldU32("file_flags_mask", scalar.ActualHex)
+	d.FieldU32("file_flags", scalar.ActualHex)
+	d.FieldU32("file_os", scalar.ActualHex)
+	d.FieldU32("file_type")
+	d.FieldU32("file_subtype")
+	d.FieldU32("file_date_ms")
+	d.FieldU32("file_date_ls")
+}
+
+func decodeModuleList(d *decode.D) {
+	n := d.FieldU32("number_of_modules")
+	d.FieldArray("modules", func(d *decode.D) {
+		for i := uint64(0); i < n; i++ {
+			d.FieldStruct("module", func(d *decode.D) {
+				d.FieldU64("base_of_image", scalar.ActualHex)
+				d.FieldU32("size_of_image")
+				d.FieldU32("checksum", scalar.ActualHex)
+				d.FieldU32("time_date_stamp", scalar.DescriptionActualUUnixTime)
+				nameRVA := d.FieldU32("module_name_rva", scalar.ActualHex)
+				fieldMinidumpString(d, "module_name", nameRVA)
+				d.FieldStruct("version_info", decodeFixedFileInfo)
+				var cvSize, cvRVA uint64
+				d.FieldStruct("cv_record", func(d *decode.D) {
+					cvSize, cvRVA = fieldLocation(d)
+					if cvSize != 0 {
+						d.RangeFn(int64(cvRVA)*8, int64(cvSize)*8, func(d *decode.D) {
+							d.FieldStruct("data", decodeCVRecord)
+						})
+					}
+				})
+				d.FieldStruct("misc_record", func(d *decode.D) {
+					dataSize, rva := fieldLocation(d)
+					fieldLocationRaw(d, "data", dataSize, rva)
+				})
+				d.FieldU64("reserved0")
+				d.FieldU64("reserved1")
+			})
+		}
+	})
+}
+
+func decodeUnloadedModuleList(d *decode.D) {
+	d.FieldU32("size_of_header")
+	entrySize := d.FieldU32("size_of_entry")
+	n := d.FieldU32("number_of_entries")
+	d.FieldArray("modules", func(d *decode.D) {
+		for i := uint64(0); i < n; i++ {
+			d.FramedFn(int64(entrySize)*8, func(d *decode.D) {
+				d.FieldStruct("module", func(d *decode.D) {
+					d.FieldU64("base_of_image", scalar.ActualHex)
+					d.FieldU32("size_of_image")
+					d.FieldU32("checksum", scalar.ActualHex)
+					d.FieldU32("time_date_stamp", scalar.DescriptionActualUUnixTime)
+					nameRVA := d.FieldU32("module_name_rva", scalar.ActualHex)
+					fieldMinidumpString(d, "module_name", nameRVA)
+				})
+			})
+		}
+	})
+}
+
+func decodeMemoryList(d *decode.D) {
+	n := d.FieldU32("number_of_memory_ranges")
+	d.FieldArray("memory_ranges", func(d *decode.D) {
+		for i := uint64(0); i < n; i++ {
+			fieldMemoryDescriptor(d, "memory_range")
+		}
+	})
+}
+
+func decodeMemory64List(d *decode.D) {
+	n := d.FieldU64("number_of_memory_ranges")
+	rva := d.FieldU64("base_rva", scalar.ActualHex)
+	d.FieldArray("memory_ranges", func(d *decode.D) {
+		for i := uint64(0); i < n; i++ {
+			d.FieldStruct("memory_range", func(d *decode.D) {
+				d.FieldU64("start_of_memory_range", scalar.ActualHex)
+				dataSize := d.FieldU64("data_size")
+				// ranges are stored back to back starting at base rva
+				fieldLocationRaw(d, "data", dataSize, rva)
+				rva += dataSize
+			})
+		}
+	})
+}
+
+func decodeException(d *decode.D, dc *dumpContext) {
+	d.FieldU32("thread_id")
+	d.FieldU32("alignment")
+	d.FieldStruct("exception_record", func(d *decode.D) {
+		d.FieldU32("exception_code", exceptionCodeNames, scalar.ActualHex)
+		d.FieldU32("exception_flags", scalar.ActualHex)
+		d.FieldU64("exception_record", scalar.ActualHex)
+		d.FieldU64("exception_address", scalar.ActualHex)
+		n := d.FieldU32("number_parameters")
+		d.FieldU32("unused_alignment")
+		d.FieldArray("exception_information", func(d *decode.D) {
+			for i := 0; i < 15; i++ {
+				if uint64(i) < n {
+					d.FieldU64("parameter", scalar.ActualHex)
+				} else {
+					d.FieldU64("unused", scalar.ActualHex)
+				}
+			}
+		})
+	})
+	fieldContext(d, dc)
+}
+
+func decodeSystemInfo(d *decode.D) {
+	arch := d.FieldU16("processor_architecture", processorArchitectureNames)
+	d.FieldU16("processor_level")
+	d.FieldU16("processor_revision", scalar.ActualHex)
+	d.FieldU8("number_of_processors")
+	d.FieldU8("product_type", productTypeNames)
+	d.FieldU32("major_version")
+	d.FieldU32("minor_version")
+	d.FieldU32("build_number")
+	d.FieldU32("platform_id", platformIDNames)
+	csdVersionRVA := d.FieldU32("csd_version_rva", scalar.ActualHex)
+	fieldMinidumpString(d, "csd_version", csdVersionRVA)
+	d.FieldU16("suite_mask", scalar.ActualHex)
+	d.FieldU16("reserved2")
+	d.FieldStruct("cpu", func(d *decode.D) {
+		switch arch {
+		case 0, processorArchitectureAMD64:
+			d.FieldUTF8("vendor_id", 12)
+			d.FieldU32("version_information", scalar.ActualHex)
+			d.FieldU32("feature_information", scalar.ActualHex)
+			d.FieldU32("amd_extended_cpu_features", scalar.ActualHex)
+		default:
+			d.FieldArray("processor_features", func(d *decode.D) {
+				d.FieldU64("processor_feature", scalar.ActualHex)
+				d.FieldU64("processor_feature", scalar.ActualHex)
+			})
+			d.FieldRawLen("unused", 8*8)
+		}
+	})
+}
+
+func decodeMiscInfo(d *decode.D) {
+	d.FieldU32("size_of_info")
+	d.FieldU32("flags1", scalar.ActualHex)
+	d.FieldU32("process_id")
+	d.FieldU32("process_create_time", scalar.DescriptionActualUUnixTime)
+	d.FieldU32("process_user_time")
+	d.FieldU32("process_kernel_time")
+	if !d.End() {
+		d.FieldRawLen("extra", d.BitsLeft())
+	}
+}
+
+func decodeStream(d *decode.D, dc *dumpContext, typ uint64) {
+	switch typ {
+	case streamTypeThreadList:
+		decodeThreadList(d, dc)
+	case streamTypeModuleList:
+		decodeModuleList(d)
+	case streamTypeUnloadedModuleList:
+		decodeUnloadedModuleList(d)
+	case streamTypeMemoryList:
+		decodeMemoryList(d)
+	case streamTypeMemory64List:
+		decodeMemory64List(d)
+	case streamTypeException:
+		decodeException(d, dc)
+	case streamTypeSystemInfo:
+		decodeSystemInfo(d)
+	case streamTypeMiscInfo:
+		decodeMiscInfo(d)
+	case streamTypeCommentA:
+		d.FieldUTF8NullFixedLen("comment", int(d.BitsLeft()/8))
+	case streamTypeCommentW:
+		d.FieldUTF16LE("comment", int(d.BitsLeft()/8))
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+type directoryEntry struct {
+	typ      uint64
+	dataSize uint64
+	rva      uint64
+}
+
+func minidumpDecode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	var numberOfStreams uint64
+	var directoryRVA uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldUTF8("signature", 4, d.AssertStr(signature))
+		d.FieldU16("version", scalar.ActualHex)
+		d.FieldU16("implementation_version", scalar.ActualHex)
+		numberOfStreams = d.FieldU32("number_of_streams")
+		directoryRVA = d.FieldU32("stream_directory_rva", scalar.ActualHex)
+		d.FieldU32("checksum", scalar.ActualHex)
+		d.FieldU32("time_date_stamp", scalar.DescriptionActualUUnixTime)
+		d.FieldU64("flags", scalar.ActualHex)
+	})
+
+	// system info is needed to know how to decode thread contexts
+	var entries []directoryEntry
+	var dc dumpContext
+	d.SeekAbs(int64(directoryRVA) * 8)
+	for i := uint64(0); i < numberOfStreams; i++ {
+		e := directoryEntry{typ: d.U32(), dataSize: d.U32(), rva: d.U32()}
+		entries = append(entries, e)
+		if e.typ == streamTypeSystemInfo && e.dataSize >= 2 {
+			dc.processorArchitecture = uint64(binary.LittleEndian.Uint16(d.BytesRange(int64(e.rva)*8, 2)))
+		}
+	}
+
+	d.SeekAbs(int64(directoryRVA) * 8)
+	d.FieldArray("streams", func(d *decode.D) {
+		for _, e := range entries {
+			d.FieldStruct("stream", func(d *decode.D) {
+				d.FieldU32("stream_type", streamTypeNames, scalar.ActualHex)
+				fieldLocation(d)
+				if e.dataSize == 0 {
+					return
+				}
+				d.RangeFn(int64(e.rva)*8, int64(e.dataSize)*8, func(d *decode.D) {
+					d.FieldStruct("data", func(d *decode.D) { decodeStream(d, &dc, e.typ) })
+				})
+			})
+		}
+	})
+
+	return nil
+}
@@ -3,6 +3,7 @@ package mp3
 // TODO: vbri
 
 import (
+	"embed"
 	"fmt"
 
 	"github.com/wader/fq/format"
@@ -10,6 +11,9 @@ import (
 	"github.com/wader/fq/pkg/interp"
 )
 
+//go:embed mp3.jq
+var mp3FS embed.FS
+
 var headerFormat decode.Group
 var footerFormat decode.Group
 var mp3Frame decode.Group
@@ -23,10 +27,16 @@ func init() {
 		DecodeFn:    mp3Decode,
 		DecodeInArg: format.Mp3In{
 			MaxUniqueHeaderConfigs: 5,
-			MaxSyncSeek:            4 * 1024 * 8,
+			MaxSyncSeek:            4 * 1024,
 		},
 		Dependencies: []decode.Dependency{
-			{Names: []string{format.ID3V2}, Group: &headerFormat},
+			{
+				Names: []string{
+					format.ID3V2,
+					format.APEV2,
+				},
+				Group: &headerFormat,
+			},
 			{
 				Names: []string{
 					format.ID3V1,
@@ -37,7 +47,9 @@ func init() {
 			},
 			{Names: []string{format.MP3_FRAME}, Group: &mp3Frame},
 		},
+		Functions: []string{"_at_time", "_help"},
 	})
+	interp.RegisterFS(mp3FS)
 }
 
 func mp3Decode(d *decode.D, in any) any {
@@ -63,17 +75,30 @@ func mp3Decode(d *decode.D, in any) any {
 		}
 	})
 
+	findSync := func(d *decode.D) int64 {
+		syncLen, _, err := d.TryPeekFind(16, 8, int64(mi.MaxSyncSeek)*8, func(v uint64) bool {
+			return (v&0b1111_1111_1110_0000 == 0b1111_1111_1110_0000 && // sync header
+				v&0b0000_0000_0001_1000 != 0b0000_0000_0000_1000 && // not reserved mpeg version
+				v&0b0000_0000_0000_0110 == 0b0000_0000_0000_0010) // layer 3
+		})
+		if err != nil {
+			return -1
+		}
+		return syncLen
+	}
+
+	// report garbage before first sync, ex: a capture started mid-stream
+	if syncLen := findSync(d); syncLen > 0 {
+		d.FieldRawLen("leading_garbage", syncLen)
+	}
+
 	lastValidEnd := int64(0)
 	validFrames := 0
 	decodeFailures := 0
 	d.FieldArray("frames", func(d *decode.D) {
 		for d.NotEnd() {
-			syncLen, _, err := d.TryPeekFind(16, 8, int64(mi.MaxSyncSeek), func(v uint64) bool {
-				return (v&0b1111_1111_1110_0000 == 0b1111_1111_1110_0000 && // sync header
-					v&0b0000_0000_0001_1000 != 0b0000_0000_0000_1000 && // not reserved mpeg version
-					v&0b0000_0000_0000_0110 == 0b0000_0000_0000_0010) // layer 3
-			})
-			if err != nil || syncLen < 0 {
+			syncLen := findSync(d)
+			if syncLen < 0 {
 				break
 			}
 			if syncLen > 0 {
@@ -29,6 +29,30 @@ var boxSizeNames = scalar.UToDescription{
 	boxSizeUse64bitSize: "Use 64 bit size",
 }
 
+const (
+	constructionMethodFile = 0
+	constructionMethodIdat = 1
+	constructionMethodItem = 2
+)
+
+var constructionMethodNames = scalar.UToSymStr{
+	constructionMethodFile: "file",
+	constructionMethodIdat: "idat",
+	constructionMethodItem: "item",
+}
+
+var itemTypeNames = scalar.StrToDescription{
+	"av01": "AV1 image",
+	"hvc1": "HEVC image",
+	"jpeg": "JPEG image",
+	"grid": "Image grid",
+	"iden": "Identity transformation",
+	"iovl": "Image overlay",
+	"Exif": "Exif metadata",
+	"mime": "MIME content",
+	"uri ": "URI content",
+}
+
 var mediaTimeNames = scalar.SToDescription{
 	-1: "empty",
 }
@@ -81,6 +105,9 @@ var uuidNames = scalar.BytesToScalar{
 	{Bytes: uuidTfrfBytes[:], Scalar: scalar.S{Sym: "tfrf"}},
 	{Bytes: uuidProfBytes[:], Scalar: scalar.S{Sym: "prof"}},
 	{Bytes: uuidIpodBytes[:], Scalar: scalar.S{Sym: "ipod"}},
+	{Bytes: uuidPIFFProtectionSystemSpecificHeaderBytes[:], Scalar: scalar.S{Sym: "piff_pssh"}},
+	{Bytes: uuidPIFFTrackEncryptionBytes[:], Scalar: scalar.S{Sym: "piff_tenc"}},
+	{Bytes: uuidPIFFSampleEncryptionBytes[:], Scalar: scalar.S{Sym: "piff_senc"}},
 }
 
 // ISO 639-2/T language code 3 * 5bit packed uint + 1 zero bit
@@ -149,6 +176,10 @@ func decodeBoxWithParentData(ctx *decodeContext, d *decode.D, parentData any) {
 		ctx.path[len(ctx.path)-1].data = parentData
 	}
 	ctx.path = append(ctx.path, pathEntry{typ: typ, data: parentData})
+	// item properties are referenced by 1-based index in ipco
+	if ctx.isParent("ipco") {
+		ctx.properties = append(ctx.properties, itemProperty{typ: typ})
+	}
 
 	if decodeFn, ok := boxDecoders[typ]; ok {
 		d.FramedFn(int64(dataSize*8), func(d *decode.D) {
@@ -525,6 +556,9 @@ func init() {
 			if t := ctx.currentTrack(); t != nil {
 				t.formatInArg = format.HevcAuIn{LengthSize: hevcDcrOut.LengthSize} //nolint:gosimple
 			}
+			if ctx.isParent("ipco") {
+				ctx.properties[len(ctx.properties)-1].formatInArg = format.HevcAuIn{LengthSize: hevcDcrOut.LengthSize} //nolint:gosimple
+			}
 		},
 		"dfLa": func(ctx *decodeContext, d *decode.D) {
 			d.FieldU8("version")
@@ -966,9 +1000,8 @@ func init() {
 			d.FieldU24("flags")
 			d.FieldU32("mfra_size")
 		},
-		// TODO: item location
 		// HEIC image
-		"iloc": func(_ *decodeContext, d *decode.D) {
+		"iloc": func(ctx *decodeContext, d *decode.D) {
 			version := d.FieldU8("version")
 			d.FieldU24("flags")
 
@@ -991,28 +1024,32 @@ func init() {
 			d.FieldArray("items", func(d *decode.D) {
 				for i := uint64(0); i < itemCount; i++ {
 					d.FieldStruct("item", func(d *decode.D) {
+						var id uint64
 						switch version {
 						case 0, 1:
-							d.FieldU16("id")
+							id = d.FieldU16("id")
 						case 2:
-							d.FieldU32("id")
+							id = d.FieldU32("id")
 						}
+						it := ctx.lookupItem(int(id))
+						it.hasLocation = true
 						switch version {
 						case 1, 2:
 							d.FieldU12("reserved")
-							d.FieldU4("construction_method")
+							it.constructionMethod = int(d.FieldU4("construction_method", constructionMethodNames))
 						}
 						d.FieldU16("data_reference_index")
-						d.FieldU("base_offset", int(baseOffsetSize)*8)
+						it.baseOffset = int64(d.FieldU("base_offset", int(baseOffsetSize)*8))
 						extentCount := d.FieldU16("extent_count")
 						d.FieldArray("extends", func(d *decode.D) {
 							for i := uint64(0); i < extentCount; i++ {
 								d.FieldStruct("extent", func(d *decode.D) {
 									if (version == 1 || version == 2) && indexSize > 0 {
-										d.FieldU("index", int(offsetSize)*8)
+										d.FieldU("index", int(indexSize)*8)
 									}
-									d.FieldU("offset", int(offsetSize)*8)
-									d.FieldU("length", int(lengthSize)*8)
+									offset := d.FieldU("offset", int(offsetSize)*8)
+									length := d.FieldU("length", int(lengthSize)*8)
+									it.extents = append(it.extents, itemExtent{offset: int64(offset), length: int64(length)})
 								})
 							}
 						})
@@ -1020,29 +1057,55 @@ func init() {
 				}
 			})
 		},
-		"infe": func(_ *decodeContext, d *decode.D) {
-			d.FieldU8("version")
+		"infe": func(ctx *decodeContext, d *decode.D) {
+			version := d.FieldU8("version")
 			d.FieldU24("flags")
-			d.FieldU16("id")
+			var id uint64
+			if version < 3 {
+				id = d.FieldU16("id")
+			} else {
+				id = d.FieldU32("id")
+			}
+			it := ctx.lookupItem(int(id))
+			ctx.itemIDs = append(ctx.itemIDs, it.id)
 			d.FieldU16("protection_index")
-			d.FieldUTF8Null("item_name")
+			if version >= 2 {
+				it.typ = d.FieldUTF8("item_type", 4, itemTypeNames)
+			}
 			// TODO: really optional? seems so
 			if d.NotEnd() {
-				d.FieldUTF8Null("content_type")
+				it.name = d.FieldUTF8Null("item_name")
+			}
+			switch {
+			case version < 2, it.typ == "mime":
+				if d.NotEnd() {
+					it.contentType = d.FieldUTF8Null("content_type")
+				}
+				if d.NotEnd() {
+					d.FieldUTF8Null("content_encoding")
+				}
+			case it.typ == "uri ":
+				if d.NotEnd() {
+					d.FieldUTF8Null("item_uri_type")
+				}
 			}
 			if d.NotEnd() {
-				d.FieldUTF8Null("content_encoding")
+				d.FieldRawLen("extension", d.BitsLeft())
 			}
 		},
 		"iinf": func(ctx *decodeContext, d *decode.D) {
 			version := d.FieldU8("version")
 			d.FieldU24("flags")
 			if version == 0 {
-				_ = d.FieldU16("entry_count")
-				decodeBoxes(ctx, d)
+				d.FieldU16("entry_count")
 			} else {
-				d.FieldRawLen("data", d.BitsLeft())
+				d.FieldU32("entry_count")
 			}
+			decodeBoxes(ctx, d)
+		},
+		"idat": func(ctx *decodeContext, d *decode.D) {
+			ctx.idatPos = d.Pos()
+			d.FieldRawLen("data", d.BitsLeft())
 		},
 		"iprp": decodeBoxes,
 		"ipco": decodeBoxes,
@@ -1071,46 +1134,7 @@ func init() {
 			}
 		},
 		"pssh": func(_ *decodeContext, d *decode.D) {
-			var (
-				systemIDCommon    = [16]byte{0x10, 0x77, 0xef, 0xec, 0xc0, 0xb2, 0x4d, 0x02, 0xac, 0xe3, 0x3c, 0x1e, 0x52, 0xe2, 0xfb, 0x4b}
-				systemIDWidevine  = [16]byte{0xed, 0xef, 0x8b, 0xa9, 0x79, 0xd6, 0x4a, 0xce, 0xa3, 0xc8, 0x27, 0xdc, 0xd5, 0x1d, 0x21, 0xed}
-				systemIDPlayReady = [16]byte{0x9a, 0x04, 0xf0, 0x79, 0x98, 0x40, 0x42, 0x86, 0xab, 0x92, 0xe6, 0x5b, 0xe0, 0x88, 0x5f, 0x95}
-				systemIDFairPlay  = [16]byte{0x94, 0xce, 0x86, 0xfb, 0x07, 0xff, 0x4f, 0x43, 0xad, 0xb8, 0x93, 0xd2, 0xfa, 0x96, 0x8c, 0xa2}
-			)
-			systemIDNames := scalar.BytesToScalar{
-				{Bytes: systemIDCommon[:], Scalar: scalar.S{Sym: "common"}},
-				{Bytes: systemIDWidevine[:], Scalar: scalar.S{Sym: "widevine"}},
-				{Bytes: systemIDPlayReady[:], Scalar: scalar.S{Sym: "playready"}},
-				{Bytes: systemIDFairPlay[:], Scalar: scalar.S{Sym: "fairplay"}},
-			}
-
-			version := d.FieldU8("version")
-			d.FieldU24("flags")
-			systemIDBR := d.FieldRawLen("system_id", 16*8, systemIDNames)
-			// TODO: make nicer
-			systemID := d.ReadAllBits(systemIDBR)
-			switch version {
-			case 0:
-			case 1:
-				kidCount := d.FieldU32("kid_count")
-				d.FieldArray("kids", func(d *decode.D) {
-					for i := uint64(0); i < kidCount; i++ {
-						d.FieldRawLen("kid", 16*8)
-					}
-				})
-			}
-			dataLen := d.FieldU32("data_size")
-
-			switch {
-			case bytes.Equal(systemID, systemIDWidevine[:]):
-				d.FieldFormatLen("data", int64(dataLen)*8, protoBufWidevineFormat, nil)
-			case bytes.Equal(systemID, systemIDPlayReady[:]):
-				d.FieldFormatLen("data", int64(dataLen)*8, psshPlayreadyFormat, nil)
-			case systemID == nil:
-				fallthrough
-			default:
-				d.FieldRawLen("data", int64(dataLen)*8)
-			}
+			decodePSSH(d)
 		},
 		"sinf": decodeBoxes,
 		"frma": func(ctx *decodeContext, d *decode.D) {
@@ -1124,11 +1148,11 @@ func init() {
 		},
 		"schm": func(_ *decodeContext, d *decode.D) {
 			d.FieldU8("version")
-			d.FieldU24("flags")
-			d.FieldUTF8("encryption_type", 4)
-			d.FieldU16("encryption_version")
-			if d.BitsLeft() > 0 {
-				d.FieldUTF8("uri", int(d.BitsLeft())/8)
+			flags := d.FieldU24("flags")
+			d.FieldUTF8("encryption_type", 4, schemeTypeNames)
+			d.FieldU32("encryption_version", scalar.ActualHex)
+			if flags&0b1 != 0 {
+				d.FieldUTF8Null("uri")
 			}
 		},
 		"schi": decodeBoxes,
@@ -1141,9 +1165,23 @@ func init() {
 			d.FieldU32("h_spacing")
 			d.FieldU32("v_spacing")
 		},
-		"uuid": func(_ *decodeContext, d *decode.D) {
-			d.FieldRawLen("uuid", 16*8, scalar.RawUUID, uuidNames)
-			d.FieldRawLen("data", d.BitsLeft())
+		"uuid": func(ctx *decodeContext, d *decode.D) {
+			uuidBR := d.FieldRawLen("uuid", 16*8, scalar.RawUUID, uuidNames)
+			uuid := d.ReadAllBits(uuidBR)
+			switch {
+			case bytes.Equal(uuid, uuidPIFFProtectionSystemSpecificHeaderBytes[:]):
+				decodePSSH(d)
+			case bytes.Equal(uuid, uuidPIFFTrackEncryptionBytes[:]):
+				defaultIVSize := decodeTrackEncryption(d, true)
+				if t := ctx.currentTrack(); t != nil {
+					t.defaultIVSize = defaultIVSize
+					t.hasDefaultIVSize = true
+				}
+			case bytes.Equal(uuid, uuidPIFFSampleEncryptionBytes[:]):
+				decodeSampleEncryption(ctx, d, true)
+			default:
+				d.FieldRawLen("data", d.BitsLeft())
+			}
 		},
 		"keys": func(_ *decodeContext, d *decode.D) {
 			d.FieldU8("version")
@@ -1164,7 +1202,7 @@ func init() {
 			d.FieldU8("version")
 			flags := d.FieldU24("flags")
 			if flags&0b1 != 0 {
-				d.FieldU32("aux_info_type")
+				d.FieldUTF8("aux_info_type", 4)
 				d.FieldU32("aux_info_type_parameter")
 			}
 			defaultSampleInfoSize := d.FieldU8("default_sample_info_size")
@@ -1180,7 +1218,7 @@ func init() {
 		"sgpd": func(_ *decodeContext, d *decode.D) {
 			version := d.FieldU8("version")
 			d.FieldU24("flags")
-			d.FieldU32("grouping_type")
+			groupingType := d.FieldUTF8("grouping_type", 4)
 			var defaultLength uint64
 			if version == 1 {
 				defaultLength = d.FieldU32("default_length")
@@ -1201,7 +1239,14 @@ func init() {
 					} else if entryLen == 0 {
 						d.Fatalf("sgpd groups entry len <= 0")
 					}
-					d.FieldRawLen("data", int64(entryLen)*8)
+					switch groupingType {
+					case "seig":
+						d.FramedFn(int64(entryLen)*8, func(d *decode.D) {
+							d.FieldStruct("entry", decodeSampleGroupSeig)
+						})
+					default:
+						d.FieldRawLen("data", int64(entryLen)*8)
+					}
 				}
 			})
 		},
@@ -1209,7 +1254,7 @@ func init() {
 			version := d.FieldU8("version")
 			d.FieldU24("flags")
 
-			d.FieldU32("grouping_type")
+			d.FieldUTF8("grouping_type", 4)
 			if version == 1 {
 				d.FieldU32("grouping_type_parameter")
 			}
@@ -1228,7 +1273,7 @@ func init() {
 			flags := d.FieldU24("flags")
 
 			if flags&0b1 != 0 {
-				d.FieldU32("aux_info_type")
+				d.FieldUTF8("aux_info_type", 4)
 				d.FieldU32("aux_info_type_parameter")
 			}
 			entryCount := d.FieldU32("entry_count")
@@ -1243,72 +1288,25 @@ func init() {
 			})
 		},
 		"senc": func(ctx *decodeContext, d *decode.D) {
-			d.FieldU8("version")
-			flags := d.FieldU24("flags")
-
-			t := ctx.currentTrack()
-			if t == nil {
-				// need to know iv size
-				return
-			}
-			m := &moof{}
-			if t := ctx.currentTrafBox(); t != nil {
-				m = t.moof
-			}
-
-			s := senc{}
-			sampleCount := d.FieldU32("sample_count")
-			d.FieldArray("samples", func(d *decode.D) {
-				for i := uint64(0); i < sampleCount; i++ {
-					d.FieldStruct("entry", func(d *decode.D) {
-						if t.defaultIVSize != 0 {
-							d.FieldRawLen("iv", int64(t.defaultIVSize*8))
-						}
-						if flags&0b10 != 0 {
-							subSampleCount := d.FieldU16("subsample_count")
-							d.FieldArray("subsamples", func(d *decode.D) {
-								for i := uint64(0); i < subSampleCount; i++ {
-									d.FieldStruct("entry", func(d *decode.D) {
-										d.FieldU16("bytes_of_clean_data")
-										d.FieldU32("bytes_of_encrypted_data")
-									})
-								}
-							})
-						}
-					})
-
-					// TODO: add iv etc
-					s.entries = append(s.entries, struct{}{})
-				}
-			})
-			m.sencs = append(m.sencs, s)
+			decodeSampleEncryption(ctx, d, false)
 		},
 		"tenc": func(ctx *decodeContext, d *decode.D) {
-			version := d.FieldU8("version")
-			d.FieldU24("flags")
-
-			d.FieldU8("reserved0")
-			switch version {
-			case 0:
-				d.FieldU8("reserved1")
-			default:
-				d.FieldU4("default_crypto_bytes")
-				d.FieldU4("default_skip_bytes")
-			}
-
-			defaultIsEncrypted := d.FieldU8("default_is_encrypted")
-			defaultIVSize := d.FieldU8("default_iv_size")
-			d.FieldRawLen("default_kid", 8*16)
-
-			if defaultIsEncrypted != 0 && defaultIVSize == 0 {
-				defaultConstantIVSize := d.FieldU8("default_constant_iv_size")
-				d.FieldRawLen("default_constant_iv", int64(defaultConstantIVSize)*8)
-			}
+			defaultIVSize := decodeTrackEncryption(d, false)
 			if t := ctx.currentTrack(); t != nil {
-				t.defaultIVSize = int(defaultIVSize)
+				t.defaultIVSize = defaultIVSize
+				t.hasDefaultIVSize = true
 			}
 		},
 		"covr": decodeBoxes,
+		"dac3": func(_ *decodeContext, d *decode.D) {
+			d.FieldU2("fscod")
+			d.FieldU5("bsid")
+			d.FieldU3("bsmod")
+			d.FieldU3("acmod")
+			d.FieldU1("lfeon")
+			d.FieldU5("bit_rate_code")
+			d.FieldU5("reserved")
+		},
 		"dec3": func(_ *decodeContext, d *decode.D) {
 			d.FieldU13("data_rate")
 			d.FieldU3("num_ind_sub")
@@ -1439,28 +1437,32 @@ func init() {
 			d.FieldU32("image_width")
 			d.FieldU32("image_height")
 		},
-		"ipma": func(_ *decodeContext, d *decode.D) {
+		"ipma": func(ctx *decodeContext, d *decode.D) {
 			version := d.FieldU8("version")
 			flags := d.FieldU24("flags")
 			entryCount := d.FieldU32("entry_count")
 			d.FieldArray("entries", func(d *decode.D) {
 				for i := uint64(0); i < entryCount; i++ {
 					d.FieldStruct("entry", func(d *decode.D) {
+						var id uint64
 						if version < 1 {
-							d.FieldU16("item_id")
+							id = d.FieldU16("item_id")
 						} else {
-							d.FieldU32("item_id")
+							id = d.FieldU32("item_id")
 						}
+						it := ctx.lookupItem(int(id))
 						associationCount := d.FieldU8("association_count")
 						d.FieldArray("associations", func(d *decode.D) {
 							for j := uint64(0); j < associationCount; j++ {
 								d.FieldStruct("association", func(d *decode.D) {
 									d.FieldBool("essential")
+									var index uint64
 									if flags&0b1 != 0 {
-										d.FieldU15("property_index")
+										index = d.FieldU15("property_index")
 									} else {
-										d.FieldU7("item_id")
+										index = d.FieldU7("property_index")
 									}
+									it.properties = append(it.properties, int(index))
 								})
 							}
 						})
@@ -1468,13 +1470,13 @@ func init() {
 				}
 			})
 		},
-		"pitm": func(_ *decodeContext, d *decode.D) {
+		"pitm": func(ctx *decodeContext, d *decode.D) {
 			version := d.FieldU8("version")
 			d.FieldU24("flags")
 			if version < 1 {
-				d.FieldU16("item_id")
+				ctx.primaryItemID = int(d.FieldU16("item_id"))
 			} else {
-				d.FieldU32("item_id")
+				ctx.primaryItemID = int(d.FieldU32("item_id"))
 			}
 		},
 		"iref": func(ctx *decodeContext, d *decode.D) {
@@ -0,0 +1,213 @@
+package mp4
+
+// Common encryption and PIFF boxes
+// ISO/IEC 23001-7
+// https://learn.microsoft.com/en-us/playready/specifications/playready-header-specification
+// https://www.piff.org (Protected Interoperable File Format 1.1)
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var (
+	systemIDCommon    = [16]byte{0x10, 0x77, 0xef, 0xec, 0xc0, 0xb2, 0x4d, 0x02, 0xac, 0xe3, 0x3c, 0x1e, 0x52, 0xe2, 0xfb, 0x4b}
+	systemIDWidevine  = [16]byte{0xed, 0xef, 0x8b, 0xa9, 0x79, 0xd6, 0x4a, 0xce, 0xa3, 0xc8, 0x27, 0xdc, 0xd5, 0x1d, 0x21, 0xed}
+	systemIDPlayReady = [16]byte{0x9a, 0x04, 0xf0, 0x79, 0x98, 0x40, 0x42, 0x86, 0xab, 0x92, 0xe6, 0x5b, 0xe0, 0x88, 0x5f, 0x95}
+	systemIDFairPlay  = [16]byte{0x94, 0xce, 0x86, 0xfb, 0x07, 0xff, 0x4f, 0x43, 0xad, 0xb8, 0x93, 0xd2, 0xfa, 0x96, 0x8c, 0xa2}
+	systemIDMarlin    = [16]byte{0x5e, 0x62, 0x9a, 0xf5, 0x38, 0xda, 0x40, 0x63, 0x89, 0x77, 0x97, 0xff, 0xbd, 0x99, 0x02, 0xd4}
+	systemIDPrimetime = [16]byte{0xf2, 0x39, 0xe7, 0x69, 0xef, 0xa3, 0x48, 0x50, 0x9c, 0x16, 0xa9, 0x03, 0xc6, 0x93, 0x2e, 0xfb}
+)
+
+var systemIDNames = scalar.BytesToScalar{
+	{Bytes: systemIDCommon[:], Scalar: scalar.S{Sym: "common"}},
+	{Bytes: systemIDWidevine[:], Scalar: scalar.S{Sym: "widevine"}},
+	{Bytes: systemIDPlayReady[:], Scalar: scalar.S{Sym: "playready"}},
+	{Bytes: systemIDFairPlay[:], Scalar: scalar.S{Sym: "fairplay"}},
+	{Bytes: systemIDMarlin[:], Scalar: scalar.S{Sym: "marlin"}},
+	{Bytes: systemIDPrimetime[:], Scalar: scalar.S{Sym: "primetime"}},
+}
+
+var (
+	uuidPIFFProtectionSystemSpecificHeaderBytes = [16]byte{0xd0, 0x8a, 0x4f, 0x18, 0x10, 0xf3, 0x4a, 0x82, 0xb6, 0xc8, 0x32, 0xd8, 0xab, 0xa1, 0x83, 0xd3}
+	uuidPIFFTrackEncryptionBytes                = [16]byte{0x89, 0x74, 0xdb, 0xce, 0x7b, 0xe7, 0x4c, 0x51, 0x84, 0xf9, 0x71, 0x48, 0xf9, 0x88, 0x25, 0x54}
+	uuidPIFFSampleEncryptionBytes               = [16]byte{0xa2, 0x39, 0x4f, 0x52, 0x5a, 0x9b, 0x4f, 0x14, 0xa2, 0x44, 0x6c, 0x42, 0x7c, 0x64, 0x8d, 0xf4}
+)
+
+var schemeTypeNames = scalar.StrToDescription{
+	"cenc": "AES-CTR full sample encryption",
+	"cbc1": "AES-CBC full sample encryption",
+	"cens": "AES-CTR subsample pattern encryption",
+	"cbcs": "AES-CBC subsample pattern encryption",
+	"piff": "PIFF",
+}
+
+const (
+	sencFlagOverrideTrackEncryptionBoxParameters = 0b01
+	sencFlagUseSubSampleEncryption               = 0b10
+)
+
+func decodePSSH(d *decode.D) {
+	version := d.FieldU8("version")
+	d.FieldU24("flags")
+	systemIDBR := d.FieldRawLen("system_id", 16*8, scalar.RawUUID, systemIDNames)
+	// TODO: make nicer
+	systemID := d.ReadAllBits(systemIDBR)
+	switch version {
+	case 0:
+	case 1:
+		kidCount := d.FieldU32("kid_count")
+		d.FieldArray("kids", func(d *decode.D) {
+			for i := uint64(0); i < kidCount; i++ {
+				d.FieldRawLen("kid", 16*8, scalar.RawUUID)
+			}
+		})
+	}
+	dataLen := d.FieldU32("data_size")
+
+	switch {
+	case bytes.Equal(systemID, systemIDWidevine[:]):
+		d.FieldFormatLen("data", int64(dataLen)*8, protoBufWidevineFormat, nil)
+	case bytes.Equal(systemID, systemIDPlayReady[:]):
+		d.FieldFormatLen("data", int64(dataLen)*8, psshPlayreadyFormat, nil)
+	case systemID == nil:
+		fallthrough
+	default:
+		d.FieldRawLen("data", int64(dataLen)*8)
+	}
+}
+
+// tenc and PIFF track encryption box, returns default iv size
+func decodeTrackEncryption(d *decode.D, isPIFF bool) int {
+	version := d.FieldU8("version")
+	d.FieldU24("flags")
+
+	var defaultIsEncrypted uint64
+	if isPIFF {
+		defaultIsEncrypted = d.FieldU24("default_algorithm_id", scalar.UToDescription{
+			0: "Not encrypted",
+			1: "AES 128-bit CTR",
+			2: "AES 128-bit CBC",
+		})
+	} else {
+		d.FieldU8("reserved0")
+		switch version {
+		case 0:
+			d.FieldU8("reserved1")
+		default:
+			d.FieldU4("default_crypto_bytes")
+			d.FieldU4("default_skip_bytes")
+		}
+		defaultIsEncrypted = d.FieldU8("default_is_encrypted")
+	}
+	defaultIVSize := d.FieldU8("default_iv_size")
+	d.FieldRawLen("default_kid", 8*16, scalar.RawUUID)
+
+	if !isPIFF && defaultIsEncrypted != 0 && defaultIVSize == 0 {
+		defaultConstantIVSize := d.FieldU8("default_constant_iv_size")
+		d.FieldRawLen("default_constant_iv", int64(defaultConstantIVSize)*8)
+	}
+
+	return int(defaultIVSize)
+}
+
+// guess per sample iv size by finding one that makes the sample entries fill the box exactly
+func sencGuessIVSize(bs []byte, sampleCount uint64, hasSubSamples bool) (int, bool) {
+	for _, ivSize := range []int{8, 16, 0} {
+		p := 0
+		ok := true
+		for i := uint64(0); i < sampleCount; i++ {
+			p += ivSize
+			if !hasSubSamples {
+				continue
+			}
+			if p+2 > len(bs) {
+				ok = false
+				break
+			}
+			subSampleCount := int(binary.BigEndian.Uint16(bs[p:]))
+			p += 2 + subSampleCount*6
+		}
+		if ok && p == len(bs) {
+			return ivSize, true
+		}
+	}
+	return 0, false
+}
+
+// senc and PIFF sample encryption box
+func decodeSampleEncryption(ctx *decodeContext, d *decode.D, isPIFF bool) {
+	d.FieldU8("version")
+	flags := d.FieldU24("flags")
+
+	ivSize := -1
+	if t := ctx.currentTrack(); t != nil && t.hasDefaultIVSize {
+		ivSize = t.defaultIVSize
+	}
+	if isPIFF && flags&sencFlagOverrideTrackEncryptionBoxParameters != 0 {
+		d.FieldU24("algorithm_id")
+		ivSize = int(d.FieldU8("iv_size"))
+		d.FieldRawLen("kid", 16*8, scalar.RawUUID)
+	}
+
+	m := &moof{}
+	if t := ctx.currentTrafBox(); t != nil {
+		m = t.moof
+	}
+
+	s := senc{}
+	hasSubSamples := flags&sencFlagUseSubSampleEncryption != 0
+	sampleCount := d.FieldU32("sample_count")
+	if ivSize == -1 {
+		// no tenc seen, ex: media segment decoded without init segment
+		guessedIVSize, ok := sencGuessIVSize(d.BytesRange(d.Pos(), int(d.BitsLeft()/8)), sampleCount, hasSubSamples)
+		if !ok {
+			d.FieldRawLen("data", d.BitsLeft())
+			return
+		}
+		ivSize = guessedIVSize
+		d.FieldValueU("guessed_iv_size", uint64(ivSize))
+	}
+
+	d.FieldArray("samples", func(d *decode.D) {
+		for i := uint64(0); i < sampleCount; i++ {
+			d.FieldStruct("entry", func(d *decode.D) {
+				if ivSize != 0 {
+					d.FieldRawLen("iv", int64(ivSize*8), scalar.RawHex)
+				}
+				if hasSubSamples {
+					subSampleCount := d.FieldU16("subsample_count")
+					d.FieldArray("subsamples", func(d *decode.D) {
+						for i := uint64(0); i < subSampleCount; i++ {
+							d.FieldStruct("entry", func(d *decode.D) {
+								d.FieldU16("bytes_of_clean_data")
+								d.FieldU32("bytes_of_encrypted_data")
+							})
+						}
+					})
+				}
+			})
+
+			// TODO: add iv etc
+			s.entries = append(s.entries, struct{}{})
+		}
+	})
+	m.sencs = append(m.sencs, s)
+}
+
+// CencSampleEncryptionInformationGroupEntry
+func decodeSampleGroupSeig(d *decode.D) {
+	d.FieldU8("reserved")
+	d.FieldU4("crypt_byte_block")
+	d.FieldU4("skip_byte_block")
+	isProtected := d.FieldU8("is_protected")
+	perSampleIVSize := d.FieldU8("per_sample_iv_size")
+	d.FieldRawLen("kid", 16*8, scalar.RawUUID)
+	if isProtected == 1 && perSampleIVSize == 0 {
+		constantIVSize := d.FieldU8("constant_iv_size")
+		d.FieldRawLen("constant_iv", int64(constantIVSize)*8, scalar.RawHex)
+	}
+}
@@ -43,6 +43,7 @@ var boxDescriptions = scalar.StrToDescription{
 	"ctab": "Track color-table",
 	"ctts": "Composition time to sample",
 	"cvru": "OMA DRM Cover URI",
+	"dac3": "AC-3 (Dolby Digital) stream descriptor",
 	"dac4": "Dolby AC-4 stream descriptor",
 	"date": "Date and time, formatted according to ISO 8601, when the content was created. For clips captured by recording devices, this is typically the date and time when the clip’s recording started",
 	"dcfD": "Marlin DCF Duration, user-data atom type",
@@ -0,0 +1,207 @@
+package mp4
+
+// High Efficiency Image File Format, ISO/IEC 23008-12
+// AV1 Image File Format https://aomediacodec.github.io/av1-avif/
+// Same box structure as ISOBMFF but images are items in meta box instead of tracks
+// TODO: grid, iovl and iden derived images
+// TODO: item construction method 2 (item offset)
+// TODO: concatenate multiple extents before decoding
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+)
+
+//go:embed heif.jq
+var heifFS embed.FS
+
+var exifFormat decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.HEIF,
+		Description: "High Efficiency Image File Format (HEIF, HEIC and AVIF)",
+		Groups: []string{
+			format.PROBE,
+			format.IMAGE,
+		},
+		DecodeFn: heifDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.AV1_CCR}, Group: &av1CCRFormat},
+			{Names: []string{format.AV1_FRAME}, Group: &av1FrameFormat},
+			{Names: []string{format.EXIF}, Group: &exifFormat},
+			{Names: []string{format.HEVC_AU}, Group: &mpegHEVCSampleFormat},
+			{Names: []string{format.HEVC_DCR}, Group: &mpegHEVCDCRFrameFormat},
+			{Names: []string{format.ICC_PROFILE}, Group: &iccProfileFormat},
+			{Names: []string{format.JPEG}, Group: &jpegFormat},
+		},
+		Functions: []string{"_help"},
+	})
+	interp.RegisterFS(heifFS)
+}
+
+var heifBrands = map[string]struct{}{
+	"mif1": {},
+	"mif2": {},
+	"msf1": {},
+	"heic": {},
+	"heix": {},
+	"heim": {},
+	"heis": {},
+	"hevc": {},
+	"hevx": {},
+	"avif": {},
+	"avis": {},
+	"avio": {},
+}
+
+// major or one of the compatible brands in ftyp box
+func heifHasBrand(d *decode.D) bool {
+	if d.BitsLeft() < 16*8 {
+		return false
+	}
+	size := int64(d.U32())
+	if d.UTF8(4) != "ftyp" || size < 16 || size*8 > d.BitsLeft()+8*8 {
+		return false
+	}
+	for i := int64(8); i+4 <= size; i += 4 {
+		if i == 12 {
+			// minor version
+			continue
+		}
+		if _, ok := heifBrands[string(d.BytesRange(i*8, 4))]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func heifItemData(ctx *decodeContext, d *decode.D, it *item, nBits int64) {
+	switch it.typ {
+	case "hvc1":
+		var inArg any
+		for _, pi := range it.properties {
+			if pi > 0 && pi <= len(ctx.properties) && ctx.properties[pi-1].typ == "hvcC" {
+				inArg = ctx.properties[pi-1].formatInArg
+			}
+		}
+		d.FieldFormatOrRawLen("data", nBits, mpegHEVCSampleFormat, inArg)
+	case "av01":
+		d.FieldFormatOrRawLen("data", nBits, av1FrameFormat, nil)
+	case "jpeg":
+		d.FieldFormatOrRawLen("data", nBits, jpegFormat, nil)
+	case "Exif":
+		// offset to tiff header from after this field, usually zero
+		offset := d.FieldU32("exif_tiff_header_offset")
+		if int64(offset)*8 > d.BitsLeft() {
+			d.FieldRawLen("data", d.BitsLeft())
+			return
+		}
+		if offset > 0 {
+			d.FieldRawLen("prefix", int64(offset)*8)
+		}
+		d.FieldFormatOrRawLen("data", d.BitsLeft(), exifFormat, nil)
+	default:
+		d.FieldRawLen("data", nBits)
+	}
+}
+
+func heifItems(d *decode.D, ctx *decodeContext) {
+	d.FieldArray("items", func(d *decode.D) {
+		for _, id := range ctx.itemIDs {
+			it := ctx.items[id]
+			d.FieldStruct("item", func(d *decode.D) {
+				d.FieldValueU("id", uint64(it.id))
+				d.FieldValueStr("type", it.typ, itemTypeNames)
+				if it.name != "" {
+					d.FieldValueStr("name", it.name)
+				}
+				if it.contentType != "" {
+					d.FieldValueStr("content_type", it.contentType)
+				}
+				d.FieldValueBool("primary", it.id == ctx.primaryItemID)
+				d.FieldArray("properties", func(d *decode.D) {
+					for _, pi := range it.properties {
+						if pi > 0 && pi <= len(ctx.properties) {
+							d.FieldValueStr("property", ctx.properties[pi-1].typ, boxDescriptions)
+						}
+					}
+				})
+
+				if !it.hasLocation {
+					return
+				}
+				var base int64
+				switch it.constructionMethod {
+				case constructionMethodFile:
+					base = it.baseOffset * 8
+				case constructionMethodIdat:
+					if ctx.idatPos == -1 {
+						d.Errorf("item %d uses idat but no idat box found", it.id)
+						return
+					}
+					base = ctx.idatPos + it.baseOffset*8
+				default:
+					return
+				}
+
+				for _, e := range it.extents {
+					if base+e.offset*8+e.length*8 > d.Len() {
+						d.Errorf("item %d extent outside buffer", it.id)
+						return
+					}
+				}
+				switch len(it.extents) {
+				case 0:
+				case 1:
+					pos := base + it.extents[0].offset*8
+					length := it.extents[0].length * 8
+					if length == 0 {
+						// zero length means rest of file
+						length = d.Len() - pos
+					}
+					d.RangeFn(pos, length, func(d *decode.D) {
+						heifItemData(ctx, d, it, length)
+					})
+				default:
+					d.FieldArray("extents", func(d *decode.D) {
+						for _, e := range it.extents {
+							d.RangeFn(base+e.offset*8, e.length*8, func(d *decode.D) {
+								d.FieldRawLen("extent", d.BitsLeft())
+							})
+						}
+					})
+				}
+			})
+		}
+	})
+}
+
+func heifDecode(d *decode.D, _ any) any {
+	if !heifHasBrand(d) {
+		d.Fatalf("no heif brand found in ftyp box")
+	}
+	d.SeekAbs(0)
+
+	ctx := &decodeContext{
+		opts:    format.Mp4In{DecodeSamples: true},
+		path:    []pathEntry{{typ: "root"}},
+		tracks:  map[int]*track{},
+		items:   map[int]*item{},
+		idatPos: -1,
+	}
+
+	decodeBoxes(ctx, d)
+	if len(ctx.itemIDs) > 0 {
+		heifItems(d, ctx)
+	}
+	// image sequences (msf1, avis) also have tracks
+	if len(ctx.tracks) > 0 {
+		mp4Tracks(d, ctx)
+	}
+
+	return nil
+}
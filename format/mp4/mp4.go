@@ -29,8 +29,10 @@ import (
 var mp4FS embed.FS
 
 var aacFrameFormat decode.Group
+var ac3FrameFormat decode.Group
 var av1CCRFormat decode.Group
 var av1FrameFormat decode.Group
+var eac3FrameFormat decode.Group
 var flacFrameFormat decode.Group
 var flacMetadatablocksFormat decode.Group
 var id3v2Format decode.Group
@@ -60,14 +62,17 @@ func init() {
 			format.IMAGE, // avif
 		},
 		DecodeFn: mp4Decode,
+		EncodeFn: mp4Encode,
 		DecodeInArg: format.Mp4In{
 			DecodeSamples:  true,
 			AllowTruncated: false,
 		},
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.AAC_FRAME}, Group: &aacFrameFormat},
+			{Names: []string{format.AC3}, Group: &ac3FrameFormat},
 			{Names: []string{format.AV1_CCR}, Group: &av1CCRFormat},
 			{Names: []string{format.AV1_FRAME}, Group: &av1FrameFormat},
+			{Names: []string{format.EAC3}, Group: &eac3FrameFormat},
 			{Names: []string{format.FLAC_FRAME}, Group: &flacFrameFormat},
 			{Names: []string{format.FLAC_METADATABLOCKS}, Group: &flacMetadatablocksFormat},
 			{Names: []string{format.ID3V2}, Group: &id3v2Format},
@@ -88,7 +93,11 @@ func init() {
 			{Names: []string{format.VPX_CCR}, Group: &vpxCCRFormat},
 			{Names: []string{format.ICC_PROFILE}, Group: &iccProfileFormat},
 		},
-		Functions: []string{"_help"},
+		Functions: []string{"_at_time", "_help", "_timeline"},
+		ExtKeys: []decode.ExtKey{
+			{Name: "_pts", Fn: samplePTS},
+			{Name: "_duration", Fn: sampleDuration},
+		},
 	})
 	interp.RegisterFS(mp4FS)
 }
@@ -136,9 +145,33 @@ type track struct {
 	formatInArg        any
 	objectType         int // if data format is "mp4a"
 	defaultIVSize      int
+	hasDefaultIVSize   bool
 	moofs              []*moof // for fmp4
 }
 
+type itemExtent struct {
+	offset int64
+	length int64
+}
+
+// HEIF item, built from infe, iloc and ipma boxes
+type item struct {
+	id                 int
+	typ                string
+	name               string
+	contentType        string
+	constructionMethod int
+	baseOffset         int64
+	extents            []itemExtent
+	hasLocation        bool
+	properties         []int // 1-based index into ipco properties
+}
+
+type itemProperty struct {
+	typ         string
+	formatInArg any
+}
+
 type pathEntry struct {
 	typ  string
 	data any
@@ -148,6 +181,21 @@ type decodeContext struct {
 	opts   format.Mp4In
 	path   []pathEntry
 	tracks map[int]*track
+
+	items         map[int]*item
+	itemIDs       []int // in infe order
+	primaryItemID int
+	properties    []itemProperty
+	idatPos       int64 // bit position of idat data, -1 if none
+}
+
+func (ctx *decodeContext) lookupItem(id int) *item {
+	it, ok := ctx.items[id]
+	if !ok {
+		it = &item{id: id}
+		ctx.items[id] = it
+	}
+	return it
 }
 
 func (ctx *decodeContext) lookupTrack(id int) *track {
@@ -233,6 +281,10 @@ func mp4Tracks(d *decode.D, ctx *decodeContext) {
 						d.FieldFormatLen(name, nBits, mpegHEVCSampleFormat, inArg)
 					case dataFormat == "av01":
 						d.FieldFormatLen(name, nBits, av1FrameFormat, inArg)
+					case dataFormat == "ac-3":
+						d.FieldFormatLen(name, nBits, ac3FrameFormat, inArg)
+					case dataFormat == "ec-3":
+						d.FieldFormatLen(name, nBits, eac3FrameFormat, inArg)
 					case dataFormat == "mp4a" && t.objectType == format.MPEGObjectTypeMP3:
 						d.FieldFormatLen(name, nBits, mp3FrameFormat, inArg)
 					case dataFormat == "mp4a" && t.objectType == format.MPEGObjectTypeAAC:
@@ -403,9 +455,11 @@ func mp4Decode(d *decode.D, in any) any {
 	mi, _ := in.(format.Mp4In)
 
 	ctx := &decodeContext{
-		opts:   mi,
-		path:   []pathEntry{{typ: "root"}},
-		tracks: map[int]*track{},
+		opts:    mi,
+		path:    []pathEntry{{typ: "root"}},
+		tracks:  map[int]*track{},
+		items:   map[int]*item{},
+		idatPos: -1,
 	}
 
 	// TODO: nicer, validate functions without field?
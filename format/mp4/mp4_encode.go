@@ -0,0 +1,154 @@
+package mp4
+
+// Only box sizes are recalculated. Unmodified boxes are copied as is and for
+// modified boxes only boxes and data fields can be modified. Counts and
+// offsets, for example stco chunk offsets, are not updated so changing the
+// size of boxes before mdat will break sample references.
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+)
+
+// fields decoded by decodeBoxes after the boxes
+var boxesTrailingFields = map[string]bool{
+	"zero_terminator": true,
+	"padding":         true,
+}
+
+func encodeBoxes(e *decode.E, v any) error {
+	boxes, err := interp.EncodeArray(v)
+	if err != nil {
+		return err
+	}
+	for i, bv := range boxes {
+		if err := encodeBox(e, bv); err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// root fields not decoded from the box structure
+var rootDerivedFields = map[string]bool{
+	"tracks": true,
+	"items":  true,
+}
+
+// unmodified fields in decode order with boxes or data before trailing fields
+func encodeBoxFields(e *decode.E, obj map[string]any, skip map[string]bool) error {
+	type field struct {
+		name  string
+		start int64
+		raw   *decode.E
+	}
+	var fields []field
+	var trailing []field
+	for k, v := range obj {
+		switch k {
+		case "size", "size64", "type", "boxes", "data":
+			continue
+		}
+		if skip[k] {
+			continue
+		}
+		dv, ok := v.(interp.DecodeValue)
+		if !ok {
+			return fmt.Errorf("%s: modified field can't be encoded", k)
+		}
+		raw := &decode.E{}
+		if _, err := interp.EncodeRaw(raw, v); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		f := field{name: k, start: dv.DecodeValue().Range.Start, raw: raw}
+		if boxesTrailingFields[k] {
+			trailing = append(trailing, f)
+		} else {
+			fields = append(fields, f)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].start < fields[j].start })
+	sort.Slice(trailing, func(i, j int) bool { return trailing[i].start < trailing[j].start })
+
+	for _, f := range fields {
+		e.WriteBits(f.raw.Bytes(), f.raw.Len())
+	}
+	if bv, ok := obj["boxes"]; ok {
+		if err := encodeBoxes(e, bv); err != nil {
+			return fmt.Errorf("boxes%w", err)
+		}
+	}
+	if dv, ok := obj["data"]; ok {
+		b, err := interp.EncodeBytes(dv)
+		if err != nil {
+			return fmt.Errorf("data: %w", err)
+		}
+		e.WriteBytes(b)
+	}
+	for _, f := range trailing {
+		e.WriteBits(f.raw.Bytes(), f.raw.Len())
+	}
+
+	return nil
+}
+
+func encodeBox(e *decode.E, v any) error {
+	if ok, err := interp.EncodeRaw(e, v); err != nil || ok {
+		return err
+	}
+	obj, err := interp.EncodeObject(v)
+	if err != nil {
+		return err
+	}
+
+	// use raw type as it can be non-UTF-8, ex: "\xa9nam"
+	te := &decode.E{}
+	ok, err := interp.EncodeRaw(te, obj["type"])
+	if err != nil {
+		return err
+	}
+	typ := te.Bytes()
+	if !ok {
+		s, err := interp.EncodeString(obj["type"])
+		if err != nil {
+			return fmt.Errorf("type: %w", err)
+		}
+		typ = []byte(s)
+	}
+	if len(typ) != 4 {
+		return fmt.Errorf("type: %q should be 4 bytes", typ)
+	}
+
+	body := &decode.E{}
+	if err := encodeBoxFields(body, obj, nil); err != nil {
+		return fmt.Errorf("%s: %w", typ, err)
+	}
+
+	_, use64bitSize := obj["size64"]
+	size := uint64(len(body.Bytes())) + 8
+	if !use64bitSize && size > 0xffff_ffff {
+		use64bitSize = true
+	}
+	if use64bitSize {
+		e.U32(boxSizeUse64bitSize)
+		e.WriteBytes(typ)
+		e.U64(size + 8)
+	} else {
+		e.U32(size)
+		e.WriteBytes(typ)
+	}
+	e.WriteBytes(body.Bytes())
+
+	return nil
+}
+
+func mp4Encode(e *decode.E, v any) error {
+	obj, err := interp.EncodeObject(v)
+	if err != nil {
+		return err
+	}
+	return encodeBoxFields(e, obj, rootDerivedFields)
+}
@@ -0,0 +1,190 @@
+package mp4
+
+import (
+	"sort"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// resolve sample presentation time and duration in track time scale using
+// stts and ctts from the sample table, samples from fragments are not supported
+
+func ptsChild(v *decode.Value, name string) *decode.Value {
+	if v == nil {
+		return nil
+	}
+	c, ok := v.V.(*decode.Compound)
+	if !ok {
+		return nil
+	}
+	for _, cv := range c.Children {
+		if cv.Name == name {
+			return cv
+		}
+	}
+	return nil
+}
+
+func ptsScalar(v *decode.Value) (*scalar.S, bool) {
+	if v == nil {
+		return nil, false
+	}
+	s, ok := v.V.(*scalar.S)
+	return s, ok
+}
+
+func ptsChildren(v *decode.Value) []*decode.Value {
+	if v == nil {
+		return nil
+	}
+	c, ok := v.V.(*decode.Compound)
+	if !ok {
+		return nil
+	}
+	return c.Children
+}
+
+// first box of type in boxes tree
+func ptsFindBox(v *decode.Value, typ string) *decode.Value {
+	for _, b := range ptsChildren(ptsChild(v, "boxes")) {
+		if s, ok := ptsScalar(ptsChild(b, "type")); ok && s.ActualStr() == typ {
+			return b
+		}
+		if fb := ptsFindBox(b, typ); fb != nil {
+			return fb
+		}
+	}
+	return nil
+}
+
+func ptsTrak(root *decode.Value, trackID uint64) *decode.Value {
+	moov := ptsFindBox(root, "moov")
+	for _, b := range ptsChildren(ptsChild(moov, "boxes")) {
+		if s, ok := ptsScalar(ptsChild(b, "type")); !ok || s.ActualStr() != "trak" {
+			continue
+		}
+		if s, ok := ptsScalar(ptsChild(ptsFindBox(b, "tkhd"), "track_id")); ok && s.ActualU() == trackID {
+			return b
+		}
+	}
+	return nil
+}
+
+func ptsInt(s *scalar.S) int64 {
+	switch a := s.Actual.(type) {
+	case int64:
+		return a
+	case uint64:
+		return int64(a)
+	}
+	return 0
+}
+
+// run of count samples starting at sample index, acc is sum of values before the run
+type ptsRun struct {
+	index int64
+	count int64
+	value int64
+	acc   int64
+}
+
+type ptsTable struct {
+	stts []ptsRun
+	ctts []ptsRun
+}
+
+// cumulative runs from count/value run length entries
+func ptsRuns(entries []*decode.Value, countName string, valueName string) ([]ptsRun, bool) {
+	var runs []ptsRun
+	var index, acc int64
+	for _, e := range entries {
+		cs, cok := ptsScalar(ptsChild(e, countName))
+		vs, vok := ptsScalar(ptsChild(e, valueName))
+		if !cok || !vok {
+			return nil, false
+		}
+		r := ptsRun{index: index, count: ptsInt(cs), value: ptsInt(vs), acc: acc}
+		runs = append(runs, r)
+		index += r.count
+		acc += r.count * r.value
+	}
+	return runs, true
+}
+
+func ptsFindRun(runs []ptsRun, index int64) (ptsRun, bool) {
+	i := sort.Search(len(runs), func(i int) bool { return runs[i].index+runs[i].count > index })
+	if i == len(runs) || index < runs[i].index {
+		return ptsRun{}, false
+	}
+	return runs[i], true
+}
+
+func newPTSTable(trak *decode.Value) *ptsTable {
+	stts := ptsFindBox(trak, "stts")
+	if stts == nil {
+		return nil
+	}
+	t := &ptsTable{}
+	var ok bool
+	if t.stts, ok = ptsRuns(ptsChildren(ptsChild(stts, "entries")), "count", "delta"); !ok {
+		return nil
+	}
+	if ctts := ptsFindBox(trak, "ctts"); ctts != nil {
+		t.ctts, _ = ptsRuns(ptsChildren(ptsChild(ctts, "entries")), "sample_count", "sample_offset")
+	}
+	return t
+}
+
+// cache key for track tables, built on first use
+type ptsTableKey struct{ track *decode.Value }
+
+func samplePTSTable(v *decode.Value, cache decode.ExtKeyCache) (*ptsTable, int64, bool) {
+	if v.Name != "sample" || v.Parent == nil || v.Parent.Name != "samples" || v.Parent.Parent == nil {
+		return nil, 0, false
+	}
+	trackV := v.Parent.Parent
+
+	key := ptsTableKey{track: trackV}
+	t, ok := cache[key].(*ptsTable)
+	if !ok {
+		if idS, ok := ptsScalar(ptsChild(trackV, "id")); ok {
+			t = newPTSTable(ptsTrak(trackV.FormatRoot(), idS.ActualU()))
+		}
+		if cache != nil {
+			cache[key] = t
+		}
+	}
+
+	return t, int64(v.Index), t != nil
+}
+
+func samplePTS(v *decode.Value, cache decode.ExtKeyCache) (any, bool) {
+	t, index, ok := samplePTSTable(v, cache)
+	if !ok {
+		return nil, false
+	}
+	r, ok := ptsFindRun(t.stts, index)
+	if !ok {
+		return nil, false
+	}
+	pts := r.acc + (index-r.index)*r.value
+	if r, ok := ptsFindRun(t.ctts, index); ok {
+		pts += r.value
+	}
+
+	return pts, true
+}
+
+func sampleDuration(v *decode.Value, cache decode.ExtKeyCache) (any, bool) {
+	t, index, ok := samplePTSTable(v, cache)
+	if !ok {
+		return nil, false
+	}
+	r, ok := ptsFindRun(t.stts, index)
+	if !ok {
+		return nil, false
+	}
+
+	return r.value, true
+}
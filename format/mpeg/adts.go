@@ -13,16 +13,57 @@ func init() {
 		Name:        format.ADTS,
 		Description: "Audio Data Transport Stream",
 		Groups:      []string{format.PROBE},
+		ProbeOrder:  format.ProbeOrderBinFuzzy, // resync to 12 bit sync
 		DecodeFn:    adtsDecoder,
-		RootArray:   true,
-		RootName:    "frames",
+		DecodeInArg: format.AdtsIn{
+			MaxSyncSeek: 4 * 1024,
+		},
+		RootArray: true,
+		RootName:  "frames",
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.ADTS_FRAME}, Group: &adtsFrame},
 		},
 	})
 }
 
-func adtsDecoder(d *decode.D, _ any) any {
+func adtsDecoder(d *decode.D, in any) any {
+	ai, _ := in.(format.AdtsIn)
+
+	if ai.MaxSyncSeek > 0 {
+		start := d.Pos()
+		isSync := func(v uint64) bool { return v&0b1111_1111_1111_0110 == 0b1111_1111_1111_0000 } // sync and layer 0
+		syncLen, _, err := d.TryPeekFind(16, 8, int64(ai.MaxSyncSeek)*8, func(v uint64) bool {
+			if !isSync(v) {
+				return false
+			}
+			pos := d.Pos() - 16
+			if pos == start {
+				return true
+			}
+			// after skipping the frame should be followed by another frame or end of buffer
+			if d.BitsLeft() < 27 {
+				return false
+			}
+			frameLength := int64(d.PeekBits(27) & 0x1fff)
+			nextPos := pos + frameLength*8
+			if frameLength < 7 || nextPos > d.Len() {
+				return false
+			} else if nextPos == d.Len() {
+				return true
+			} else if nextPos+16 > d.Len() {
+				return false
+			}
+			b := d.BytesRange(nextPos, 2)
+			return isSync(uint64(b[0])<<8 | uint64(b[1]))
+		})
+		if err != nil || syncLen < 0 {
+			d.Fatalf("no sync found")
+		}
+		if syncLen > 0 {
+			d.FieldRawLen("leading_garbage", syncLen)
+		}
+	}
+
 	validFrames := 0
 	for !d.End() {
 		if dv, _, _ := d.TryFieldFormat("frame", adtsFrame, nil); dv == nil {
@@ -7,16 +7,23 @@ import (
 	"github.com/wader/fq/pkg/scalar"
 )
 
+var avcSEICEA708Format decode.Group
+
 func init() {
 	interp.RegisterFormat(decode.Format{
 		Name:        format.AVC_SEI,
 		Description: "H.264/AVC Supplemental Enhancement Information",
 		DecodeFn:    avcSEIDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.CEA_708}, Group: &avcSEICEA708Format},
+		},
 	})
 }
 
+// same payload types for AVC and HEVC
 const (
-	avcSEIUserDataUnregistered = 5
+	seiUserDataRegisteredITUTT35 = 4
+	avcSEIUserDataUnregistered   = 5
 )
 
 var seiNames = scalar.UToSymStr{
@@ -101,12 +108,65 @@ func ffSum(d *decode.D) uint64 {
 	return s
 }
 
-func avcSEIDecode(d *decode.D, _ any) any {
-	payloadType := d.FieldUFn("payload_type", func(d *decode.D) uint64 { return ffSum(d) }, seiNames)
+const (
+	t35CountryCodeUnitedStates = 0xb5
+	t35CountryCodeExtension    = 0xff
+	t35ProviderCodeATSC        = 0x0031
+	atscUserIdentifierGA94     = 0x47413934
+	atscUserDataTypeCCData     = 0x03
+)
+
+var t35CountryCodeNames = scalar.UToSymStr{
+	t35CountryCodeUnitedStates: "united_states",
+	t35CountryCodeExtension:    "extension",
+}
+
+var t35ProviderCodeNames = scalar.UToSymStr{
+	0x002f:              "directv",
+	t35ProviderCodeATSC: "atsc",
+	0x003b:              "dolby",
+	0x003c:              "samsung",
+}
+
+var atscUserIdentifierNames = scalar.UToSymStr{
+	atscUserIdentifierGA94: "GA94",
+	0x44544731:             "DTG1",
+}
+
+var atscUserDataTypeCodeNames = scalar.UToSymStr{
+	atscUserDataTypeCCData: "cc_data",
+	0x06:                   "bar_data",
+}
+
+// Rec. ITU-T T.35 registered user data, ATSC A/53 cc_data is decoded as CEA-608/708
+func decodeSEIUserDataRegistered(d *decode.D, cea708Format decode.Group) {
+	countryCode := d.FieldU8("itu_t_t35_country_code", t35CountryCodeNames, scalar.ActualHex)
+	if countryCode == t35CountryCodeExtension {
+		d.FieldU8("itu_t_t35_country_code_extension_byte", scalar.ActualHex)
+	}
+	if d.BitsLeft() < 16 {
+		return
+	}
+	providerCode := d.FieldU16("itu_t_t35_provider_code", t35ProviderCodeNames, scalar.ActualHex)
+	if countryCode != t35CountryCodeUnitedStates || providerCode != t35ProviderCodeATSC || d.BitsLeft() < 40 {
+		return
+	}
+	if d.FieldU32("user_identifier", atscUserIdentifierNames, scalar.ActualHex) != atscUserIdentifierGA94 {
+		return
+	}
+	if d.FieldU8("user_data_type_code", atscUserDataTypeCodeNames, scalar.ActualHex) == atscUserDataTypeCCData {
+		d.FieldFormatOrRawLen("cc_data", d.BitsLeft(), cea708Format, nil)
+	}
+}
+
+func decodeSEIMessage(d *decode.D, names scalar.UToSymStr, cea708Format decode.Group) {
+	payloadType := d.FieldUFn("payload_type", func(d *decode.D) uint64 { return ffSum(d) }, names)
 	payloadSize := d.FieldUFn("payload_size", func(d *decode.D) uint64 { return ffSum(d) })
 
 	d.FramedFn(int64(payloadSize)*8, func(d *decode.D) {
 		switch payloadType {
+		case seiUserDataRegisteredITUTT35:
+			decodeSEIUserDataRegistered(d, cea708Format)
 		case avcSEIUserDataUnregistered:
 			d.FieldRawLen("uuid", 16*8, userDataUnregisteredNames)
 		}
@@ -114,6 +174,10 @@ func avcSEIDecode(d *decode.D, _ any) any {
 	})
 
 	d.FieldRawLen("rbsp_trailing_bits", d.BitsLeft())
+}
+
+func avcSEIDecode(d *decode.D, _ any) any {
+	decodeSEIMessage(d, seiNames, avcSEICEA708Format)
 
 	return nil
 }
@@ -0,0 +1,349 @@
+package mpeg
+
+// ATSC A/53 Part 4 6.2.3.1 cc_data()
+// CTA-708-E Digital Television (DTV) Closed Captioning
+// CTA-608-E Line 21 Data Services
+// https://github.com/FFmpeg/FFmpeg/blob/master/libavcodec/ccaption_dec.c
+
+// TODO: reassemble DTVCC packets spanning multiple cc_data
+// TODO: G2/G3 character sets
+
+import (
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.CEA_708,
+		Description: "CEA-608/708 closed caption data",
+		DecodeFn:    cea708Decode,
+	})
+}
+
+const (
+	ccTypeNTSCField1       = 0
+	ccTypeNTSCField2       = 1
+	ccTypeDTVCCPacketData  = 2
+	ccTypeDTVCCPacketStart = 3
+)
+
+var ccTypeNames = scalar.UToSymStr{
+	ccTypeNTSCField1:       "ntsc_cc_field_1",
+	ccTypeNTSCField2:       "ntsc_cc_field_2",
+	ccTypeDTVCCPacketData:  "dtvcc_packet_data",
+	ccTypeDTVCCPacketStart: "dtvcc_packet_start",
+}
+
+// CEA-608 basic characters that differ from ASCII
+var cea608SpecialChars = map[uint64]string{
+	0x2a: "á",
+	0x5c: "é",
+	0x5e: "í",
+	0x5f: "ó",
+	0x60: "ú",
+	0x7b: "ç",
+	0x7c: "÷",
+	0x7d: "Ñ",
+	0x7e: "ñ",
+	0x7f: "█",
+}
+
+// CEA-608 bytes are 7 bit with odd parity
+var cea608CharMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	u := s.ActualU()
+	v := u & 0x7f
+	if c, ok := cea608SpecialChars[v]; ok {
+		s.Sym = c
+	} else if v >= 0x20 && v < 0x7f {
+		s.Sym = string(rune(v))
+	}
+	if parity(u) != 1 {
+		s.Description = "parity error"
+	}
+	return s, nil
+})
+
+func parity(v uint64) uint64 {
+	var p uint64
+	for ; v != 0; v >>= 1 {
+		p ^= v & 1
+	}
+	return p
+}
+
+// miscellaneous control codes, second byte with first byte 0x14/0x15 or 0x1c/0x1d
+var cea608MiscControlNames = map[uint64]string{
+	0x20: "resume_caption_loading",
+	0x21: "backspace",
+	0x22: "alarm_off",
+	0x23: "alarm_on",
+	0x24: "delete_to_end_of_row",
+	0x25: "roll_up_2_rows",
+	0x26: "roll_up_3_rows",
+	0x27: "roll_up_4_rows",
+	0x28: "flash_on",
+	0x29: "resume_direct_captioning",
+	0x2a: "text_restart",
+	0x2b: "resume_text_display",
+	0x2c: "erase_displayed_memory",
+	0x2d: "carriage_return",
+	0x2e: "erase_non_displayed_memory",
+	0x2f: "end_of_caption",
+}
+
+func cea608ControlCode(b1 uint64, b2 uint64) string {
+	// bit 3 of first byte is data channel
+	c1 := b1 &^ 0x08
+	switch {
+	case (c1 == 0x14 || c1 == 0x15) && b2 >= 0x20 && b2 <= 0x2f:
+		return cea608MiscControlNames[b2]
+	case c1 == 0x17 && b2 >= 0x21 && b2 <= 0x23:
+		return "tab_offset"
+	case c1 == 0x11 && b2 >= 0x20 && b2 <= 0x2f:
+		return "mid_row_code"
+	case c1 == 0x11 && b2 >= 0x30 && b2 <= 0x3f:
+		return "special_character"
+	case (c1 == 0x12 || c1 == 0x13) && b2 >= 0x20 && b2 <= 0x3f:
+		return "extended_character"
+	case c1 >= 0x10 && c1 <= 0x17 && b2 >= 0x40 && b2 <= 0x7f:
+		return "preamble_address_code"
+	}
+	return ""
+}
+
+var dtvccC0Names = scalar.UToScalar{
+	0x00: {Sym: "nul", Description: "Null"},
+	0x03: {Sym: "etx", Description: "End of text"},
+	0x08: {Sym: "bs", Description: "Backspace"},
+	0x0c: {Sym: "ff", Description: "Form feed"},
+	0x0d: {Sym: "cr", Description: "Carriage return"},
+	0x0e: {Sym: "hcr", Description: "Horizontal carriage return"},
+	0x10: {Sym: "ext1", Description: "Extended code set"},
+	0x18: {Sym: "p16", Description: "16 bit character"},
+}
+
+var dtvccC1Names = scalar.UToScalar{
+	0x80: {Sym: "cw0", Description: "Set current window 0"},
+	0x81: {Sym: "cw1", Description: "Set current window 1"},
+	0x82: {Sym: "cw2", Description: "Set current window 2"},
+	0x83: {Sym: "cw3", Description: "Set current window 3"},
+	0x84: {Sym: "cw4", Description: "Set current window 4"},
+	0x85: {Sym: "cw5", Description: "Set current window 5"},
+	0x86: {Sym: "cw6", Description: "Set current window 6"},
+	0x87: {Sym: "cw7", Description: "Set current window 7"},
+	0x88: {Sym: "clw", Description: "Clear windows"},
+	0x89: {Sym: "dsw", Description: "Display windows"},
+	0x8a: {Sym: "hdw", Description: "Hide windows"},
+	0x8b: {Sym: "tgw", Description: "Toggle windows"},
+	0x8c: {Sym: "dlw", Description: "Delete windows"},
+	0x8d: {Sym: "dly", Description: "Delay"},
+	0x8e: {Sym: "dlc", Description: "Delay cancel"},
+	0x8f: {Sym: "rst", Description: "Reset"},
+	0x90: {Sym: "spa", Description: "Set pen attributes"},
+	0x91: {Sym: "spc", Description: "Set pen color"},
+	0x92: {Sym: "spl", Description: "Set pen location"},
+	0x97: {Sym: "swa", Description: "Set window attributes"},
+	0x98: {Sym: "df0", Description: "Define window 0"},
+	0x99: {Sym: "df1", Description: "Define window 1"},
+	0x9a: {Sym: "df2", Description: "Define window 2"},
+	0x9b: {Sym: "df3", Description: "Define window 3"},
+	0x9c: {Sym: "df4", Description: "Define window 4"},
+	0x9d: {Sym: "df5", Description: "Define window 5"},
+	0x9e: {Sym: "df6", Description: "Define window 6"},
+	0x9f: {Sym: "df7", Description: "Define window 7"},
+}
+
+// number of parameter bytes for C0 and C1 codes
+func dtvccParamsLen(code uint64) int {
+	switch {
+	case code <= 0x0f:
+		return 0
+	case code <= 0x17:
+		return 1
+	case code <= 0x1f:
+		return 2
+	case code >= 0x88 && code <= 0x8d:
+		return 1
+	case code == 0x90, code == 0x92:
+		return 2
+	case code == 0x91:
+		return 3
+	case code == 0x97:
+		return 4
+	case code >= 0x98 && code <= 0x9f:
+		return 6
+	}
+	return 0
+}
+
+func isDTVCCText(b byte) bool {
+	return (b >= 0x20 && b <= 0x7f) || b >= 0xa0
+}
+
+// G0 is ASCII except music note, G1 is ISO 8859-1
+func dtvccText(bs []byte) string {
+	var sb strings.Builder
+	for _, b := range bs {
+		if b == 0x7f {
+			sb.WriteString("♪")
+		} else {
+			sb.WriteRune(rune(b))
+		}
+	}
+	return sb.String()
+}
+
+func decodeDTVCCServiceBlockData(d *decode.D) {
+	d.FieldArray("codes", func(d *decode.D) {
+		for d.BitsLeft() >= 8 {
+			bs := d.PeekBytes(int(d.BitsLeft() / 8))
+			n := 0
+			for n < len(bs) && isDTVCCText(bs[n]) {
+				n++
+			}
+			if n > 0 {
+				d.FieldStrFn("text", func(d *decode.D) string { return dtvccText(d.BytesLen(n)) })
+				continue
+			}
+
+			d.FieldStruct("command", func(d *decode.D) {
+				code := d.PeekBits(8)
+				var paramsLen int
+				switch {
+				case code == 0x10:
+					d.FieldU8("code", dtvccC0Names, scalar.ActualHex)
+					extCode := d.FieldU8("extended_code", scalar.ActualHex)
+					switch {
+					case extCode <= 0x1f:
+						paramsLen = int(extCode / 8)
+					case extCode >= 0x80 && extCode <= 0x87:
+						paramsLen = 4
+					case extCode >= 0x88 && extCode <= 0x8f:
+						paramsLen = 5
+					case extCode >= 0x90 && extCode <= 0x9f:
+						d.FieldU2("type")
+						paramsLen = int(d.FieldU6("length"))
+					}
+				case code <= 0x1f:
+					d.FieldU8("code", dtvccC0Names, scalar.ActualHex)
+					paramsLen = dtvccParamsLen(code)
+				default:
+					d.FieldU8("code", dtvccC1Names, scalar.ActualHex)
+					paramsLen = dtvccParamsLen(code)
+				}
+				if paramsLen > 0 {
+					if int64(paramsLen)*8 > d.BitsLeft() {
+						d.Fatalf("command parameters outside service block")
+					}
+					d.FieldRawLen("parameters", int64(paramsLen)*8)
+				}
+			})
+		}
+	})
+}
+
+func decodeDTVCCPacket(d *decode.D) {
+	d.FieldU2("sequence_number")
+	packetSizeCode := d.FieldU6("packet_size_code")
+	packetSize := int64(packetSizeCode) * 2
+	if packetSizeCode == 0 {
+		packetSize = 128
+	}
+	// packet size includes header byte
+	if (packetSize-1)*8 > d.BitsLeft() {
+		d.FieldValueBool("incomplete", true)
+		d.FieldRawLen("data", d.BitsLeft())
+		return
+	}
+
+	d.FramedFn((packetSize-1)*8, func(d *decode.D) {
+		d.FieldArray("service_blocks", func(d *decode.D) {
+			for d.BitsLeft() >= 8 {
+				// null service block header, rest is padding
+				if d.PeekBits(8) == 0 {
+					break
+				}
+				d.FieldStruct("service_block", func(d *decode.D) {
+					serviceNumber := d.FieldU3("service_number")
+					blockSize := d.FieldU5("block_size")
+					if serviceNumber == 7 && blockSize != 0 {
+						d.FieldU2("null_fill")
+						d.FieldU6("extended_service_number")
+					}
+					if int64(blockSize)*8 > d.BitsLeft() {
+						d.Fatalf("service block outside packet")
+					}
+					d.FramedFn(int64(blockSize)*8, decodeDTVCCServiceBlockData)
+				})
+			}
+		})
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("padding", d.BitsLeft())
+		}
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("padding", d.BitsLeft())
+	}
+}
+
+func cea708Decode(d *decode.D, _ any) any {
+	d.FieldU1("reserved")
+	d.FieldBool("process_cc_data_flag")
+	d.FieldBool("additional_data_flag")
+	ccCount := d.FieldU5("cc_count")
+	d.FieldU8("em_data")
+
+	var dtvccPackets [][]byte
+	d.FieldArray("cc_data_pkts", func(d *decode.D) {
+		for i := uint64(0); i < ccCount; i++ {
+			d.FieldStruct("cc_data_pkt", func(d *decode.D) {
+				d.FieldU5("marker_bits", d.ValidateU(0b1_1111), scalar.ActualBin)
+				ccValid := d.FieldBool("cc_valid")
+				ccType := d.FieldU2("cc_type", ccTypeNames)
+				switch ccType {
+				case ccTypeNTSCField1, ccTypeNTSCField2:
+					b1 := d.FieldU8("cc_data_1", cea608CharMap, scalar.ActualHex)
+					b2 := d.FieldU8("cc_data_2", cea608CharMap, scalar.ActualHex)
+					if ccValid {
+						if c := cea608ControlCode(b1&0x7f, b2&0x7f); c != "" {
+							d.FieldValueStr("control_code", c)
+						}
+					}
+				default:
+					b1 := d.FieldU8("cc_data_1", scalar.ActualHex)
+					b2 := d.FieldU8("cc_data_2", scalar.ActualHex)
+					if !ccValid {
+						return
+					}
+					if ccType == ccTypeDTVCCPacketStart {
+						dtvccPackets = append(dtvccPackets, nil)
+					} else if len(dtvccPackets) == 0 {
+						// continuation of packet started in previous cc_data
+						return
+					}
+					l := len(dtvccPackets) - 1
+					dtvccPackets[l] = append(dtvccPackets[l], byte(b1), byte(b2))
+				}
+			})
+		}
+	})
+	if d.BitsLeft() >= 8 {
+		d.FieldU8("marker_bits", scalar.ActualHex)
+	}
+
+	if len(dtvccPackets) > 0 {
+		d.FieldArray("dtvcc_packets", func(d *decode.D) {
+			for _, p := range dtvccPackets {
+				d.FieldStructRootBitBufFn("dtvcc_packet", bitio.NewBitReader(p, -1), decodeDTVCCPacket)
+			}
+		})
+	}
+
+	return nil
+}
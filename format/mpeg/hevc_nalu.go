@@ -11,6 +11,7 @@ import (
 var hevcVPSFormat decode.Group
 var hevcPPSFormat decode.Group
 var hevcSPSFormat decode.Group
+var hevcSEIFormat decode.Group
 
 func init() {
 	interp.RegisterFormat(decode.Format{
@@ -21,14 +22,17 @@ func init() {
 			{Names: []string{format.HEVC_VPS}, Group: &hevcVPSFormat},
 			{Names: []string{format.HEVC_PPS}, Group: &hevcPPSFormat},
 			{Names: []string{format.HEVC_SPS}, Group: &hevcSPSFormat},
+			{Names: []string{format.HEVC_SEI}, Group: &hevcSEIFormat},
 		},
 	})
 }
 
 const (
-	hevcNALNUTVPS = 32
-	hevcNALNUTSPS = 33
-	hevcNALNUTPPS = 34
+	hevcNALNUTVPS       = 32
+	hevcNALNUTSPS       = 33
+	hevcNALNUTPPS       = 34
+	hevcNALNUTPrefixSEI = 39
+	hevcNALNUTSuffixSEI = 40
 )
 
 var hevcNALNames = scalar.UToSymStr{
@@ -96,6 +100,8 @@ func hevcNALUDecode(d *decode.D, _ any) any {
 		d.FieldFormatBitBuf("pps", unescapedBR, hevcPPSFormat, nil)
 	case hevcNALNUTSPS:
 		d.FieldFormatBitBuf("sps", unescapedBR, hevcSPSFormat, nil)
+	case hevcNALNUTPrefixSEI, hevcNALNUTSuffixSEI:
+		d.FieldFormatBitBuf("sei", unescapedBR, hevcSEIFormat, nil)
 	}
 	d.FieldRawLen("data", d.BitsLeft())
 
@@ -0,0 +1,286 @@
+package mpeg
+
+// ISO/IEC 14496-3 1.7 LATM and LOAS
+// https://github.com/FFmpeg/FFmpeg/blob/master/libavcodec/aacdec_latm.h
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var latmAACFrameFormat decode.Group
+var latmMPEGASCFormat decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.LATM_LOAS,
+		ProbeOrder:  format.ProbeOrderBinFuzzy, // only 11 bit sync
+		Description: "MPEG-4 Audio LATM in LOAS AudioSyncStream",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    latmLOASDecoder,
+		RootArray:   true,
+		RootName:    "frames",
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.AAC_FRAME}, Group: &latmAACFrameFormat},
+			{Names: []string{format.MPEG_ASC}, Group: &latmMPEGASCFormat},
+		},
+	})
+}
+
+const loasSyncWord = 0x2b7
+
+var frameLengthTypeNames = scalar.UToDescription{
+	0: "Variable payload length",
+	1: "Fixed payload length",
+	3: "CELP 1 of 2 frame lengths",
+	4: "CELP fixed frame length",
+	5: "ER-CELP fixed frame length",
+	6: "HVXC fixed frame length",
+	7: "HVXC 1 of 4 frame lengths",
+}
+
+// stream layer in StreamMuxConfig
+type latmStream struct {
+	objectType      int
+	frameLengthType uint64
+	frameLength     uint64
+}
+
+type latmMuxConfig struct {
+	audioMuxVersionA          uint64
+	allStreamsSameTimeFraming bool
+	numSubFrames              uint64
+	streams                   []latmStream
+	otherDataLenBits          uint64
+	otherDataPresent          bool
+}
+
+func latmGetValue(d *decode.D) uint64 {
+	bytesForValue := d.U2()
+	var v uint64
+	for i := uint64(0); i <= bytesForValue; i++ {
+		v = v<<8 | d.U8()
+	}
+	return v
+}
+
+// AudioSpecificConfig without explicit length, GASpecificConfig is needed to know where it ends
+func decodeLATMASC(d *decode.D) int {
+	objectType, channelConfiguration := decodeASCHeader(d)
+	if objectType == format.MPEGAudioObjectTypeSBR || objectType == format.MPEGAudioObjectTypePS {
+		d.FieldUFn("extension_sampling_frequency", decodeEscapeValueAbsFn(4, 24, 0), frequencyIndexHzMap)
+		objectType = d.FieldUFn("extension_object_type", decodeEscapeValueCarryFn(5, 6, 0), format.MPEGAudioObjectTypeNames)
+	}
+
+	switch objectType {
+	case 1, 2, 3, 4, 6, 7, 17, 19, 20, 21, 22, 23:
+		d.FieldStruct("ga_specific_config", func(d *decode.D) {
+			d.FieldBool("frame_length_flag")
+			if d.FieldBool("depends_on_core_coder") {
+				d.FieldU14("core_coder_delay")
+			}
+			extensionFlag := d.FieldBool("extension_flag")
+			if channelConfiguration == 0 {
+				// TODO: program_config_element
+				d.Fatalf("program config element not supported")
+			}
+			if objectType == 6 || objectType == 20 {
+				d.FieldU3("layer_nr")
+			}
+			if extensionFlag {
+				if objectType == 22 {
+					d.FieldU5("num_of_sub_frame")
+					d.FieldU11("layer_length")
+				}
+				if objectType == 17 || objectType == 19 || objectType == 20 || objectType == 23 {
+					d.FieldBool("aac_section_data_resilience_flag")
+					d.FieldBool("aac_scalefactor_data_resilience_flag")
+					d.FieldBool("aac_spectral_data_resilience_flag")
+				}
+				d.FieldBool("extension_flag3")
+			}
+		})
+	default:
+		d.Fatalf("audio object type %d not supported", objectType)
+	}
+	if objectType >= 17 && objectType <= 27 {
+		epConfig := d.FieldU2("ep_config")
+		if epConfig == 2 || epConfig == 3 {
+			d.Fatalf("ep config %d not supported", epConfig)
+		}
+	}
+
+	return int(objectType)
+}
+
+func decodeStreamMuxConfig(d *decode.D) latmMuxConfig {
+	var c latmMuxConfig
+
+	audioMuxVersion := d.FieldU1("audio_mux_version")
+	if audioMuxVersion == 1 {
+		c.audioMuxVersionA = d.FieldU1("audio_mux_version_a")
+	}
+	if c.audioMuxVersionA != 0 {
+		d.Fatalf("audio mux version A %d not supported", c.audioMuxVersionA)
+	}
+	if audioMuxVersion == 1 {
+		d.FieldUFn("tara_buffer_fullness", latmGetValue)
+	}
+	c.allStreamsSameTimeFraming = d.FieldBool("all_streams_same_time_framing")
+	c.numSubFrames = d.FieldU6("num_sub_frames", scalar.ActualUAdd(1))
+	numPrograms := d.FieldU4("num_program", scalar.ActualUAdd(1))
+
+	d.FieldArray("programs", func(d *decode.D) {
+		for prog := uint64(0); prog < numPrograms; prog++ {
+			d.FieldStruct("program", func(d *decode.D) {
+				numLayers := d.FieldU3("num_layer", scalar.ActualUAdd(1))
+				d.FieldArray("layers", func(d *decode.D) {
+					for lay := uint64(0); lay < numLayers; lay++ {
+						d.FieldStruct("layer", func(d *decode.D) {
+							var s latmStream
+							useSameConfig := false
+							if prog != 0 || lay != 0 {
+								useSameConfig = d.FieldBool("use_same_config")
+							}
+							switch {
+							case useSameConfig && len(c.streams) > 0:
+								s.objectType = c.streams[len(c.streams)-1].objectType
+							case audioMuxVersion == 0:
+								d.FieldStruct("audio_specific_config", func(d *decode.D) {
+									s.objectType = decodeLATMASC(d)
+								})
+							default:
+								ascLen := d.FieldUFn("asc_len", latmGetValue)
+								_, v := d.FieldFormatLen("audio_specific_config", int64(ascLen), latmMPEGASCFormat, nil)
+								if ascOut, ok := v.(format.MPEGASCOut); ok {
+									s.objectType = ascOut.ObjectType
+								}
+							}
+
+							s.frameLengthType = d.FieldU3("frame_length_type", frameLengthTypeNames)
+							switch s.frameLengthType {
+							case 0:
+								d.FieldU8("latm_buffer_fullness")
+								// TODO: core_frame_offset for scalable layers when not all streams same time framing
+							case 1:
+								s.frameLength = d.FieldU9("frame_length")
+							case 3, 4, 5:
+								d.FieldU6("celp_frame_length_table_index")
+							case 6, 7:
+								d.FieldU1("hvxc_frame_length_table_index")
+							}
+							c.streams = append(c.streams, s)
+						})
+					}
+				})
+			})
+		}
+	})
+
+	c.otherDataPresent = d.FieldBool("other_data_present")
+	if c.otherDataPresent {
+		if audioMuxVersion == 1 {
+			c.otherDataLenBits = d.FieldUFn("other_data_len_bits", latmGetValue)
+		} else {
+			c.otherDataLenBits = d.FieldUFn("other_data_len_bits", func(d *decode.D) uint64 {
+				var n uint64
+				for {
+					esc := d.Bool()
+					n = n<<8 + d.U8()
+					if !esc {
+						return n
+					}
+				}
+			})
+		}
+	}
+	if d.FieldBool("crc_check_present") {
+		d.FieldU8("crc_check_sum", scalar.ActualHex)
+	}
+
+	return c
+}
+
+func decodeAudioMuxElement(d *decode.D, c *latmMuxConfig) {
+	if !d.FieldBool("use_same_stream_mux") {
+		d.FieldStruct("stream_mux_config", func(d *decode.D) {
+			*c = decodeStreamMuxConfig(d)
+		})
+	}
+	if c.streams == nil {
+		d.Fatalf("no stream mux config")
+	}
+	if !c.allStreamsSameTimeFraming {
+		// TODO: chunks
+		d.Fatalf("not all streams same time framing not supported")
+	}
+
+	d.FieldArray("sub_frames", func(d *decode.D) {
+		for i := uint64(0); i < c.numSubFrames; i++ {
+			d.FieldStruct("sub_frame", func(d *decode.D) {
+				payloadLengths := make([]int64, len(c.streams))
+				d.FieldArray("payload_length_info", func(d *decode.D) {
+					for si, s := range c.streams {
+						switch s.frameLengthType {
+						case 0:
+							payloadLengths[si] = int64(d.FieldUFn("mux_slot_length_bytes", func(d *decode.D) uint64 {
+								var n uint64
+								for {
+									v := d.U8()
+									n += v
+									if v != 255 {
+										return n
+									}
+								}
+							})) * 8
+						case 1:
+							payloadLengths[si] = int64(s.frameLength+20) * 8
+						default:
+							d.Fatalf("frame length type %d not supported", s.frameLengthType)
+						}
+					}
+				})
+				d.FieldArray("payloads", func(d *decode.D) {
+					for si, s := range c.streams {
+						d.FieldFormatOrRawLen("payload", payloadLengths[si], latmAACFrameFormat, format.AACFrameIn{ObjectType: s.objectType})
+					}
+				})
+			})
+		}
+	})
+	if c.otherDataPresent {
+		d.FieldRawLen("other_data", int64(c.otherDataLenBits))
+	}
+	if n := d.Pos() % 8; n != 0 {
+		d.FieldRawLen("byte_align", 8-n)
+	}
+}
+
+func latmLOASDecoder(d *decode.D, _ any) any {
+	var muxConfig latmMuxConfig
+
+	validFrames := 0
+	for d.BitsLeft() >= 24 && d.PeekBits(11) == loasSyncWord {
+		d.FieldStruct("frame", func(d *decode.D) {
+			d.FieldU11("syncword", d.AssertU(loasSyncWord), scalar.ActualHex)
+			length := d.FieldU13("audio_mux_length_bytes")
+			d.FramedFn(int64(length)*8, func(d *decode.D) {
+				d.FieldStruct("audio_mux_element", func(d *decode.D) {
+					decodeAudioMuxElement(d, &muxConfig)
+				})
+				if d.BitsLeft() > 0 {
+					d.FieldRawLen("unknown", d.BitsLeft())
+				}
+			})
+		})
+		validFrames++
+	}
+
+	if validFrames == 0 {
+		d.Fatalf("no valid frames")
+	}
+
+	return nil
+}
@@ -44,10 +44,16 @@ var channelConfigurationNames = scalar.UToDescription{
 	7: "front-center, front-left, front-right, side-left, side-right, back-left, back-right, LFE-channel",
 }
 
-func ascDecoder(d *decode.D, _ any) any {
-	objectType := d.FieldUFn("object_type", decodeEscapeValueCarryFn(5, 6, 0), format.MPEGAudioObjectTypeNames)
+// shared with latm StreamMuxConfig
+func decodeASCHeader(d *decode.D) (objectType uint64, channelConfiguration uint64) {
+	objectType = d.FieldUFn("object_type", decodeEscapeValueCarryFn(5, 6, 0), format.MPEGAudioObjectTypeNames)
 	d.FieldUFn("sampling_frequency", decodeEscapeValueAbsFn(4, 24, 0), frequencyIndexHzMap)
-	d.FieldU4("channel_configuration", channelConfigurationNames)
+	channelConfiguration = d.FieldU4("channel_configuration", channelConfigurationNames)
+	return objectType, channelConfiguration
+}
+
+func ascDecoder(d *decode.D, _ any) any {
+	objectType, _ := decodeASCHeader(d)
 	// TODO: GASpecificConfig etc
 	d.FieldRawLen("var_aot_or_byte_align", d.BitsLeft())
 
@@ -69,6 +69,63 @@ var mpegVersion = scalar.UToDescription{
 	0b10: "MPEG1",
 }
 
+func decodePackHeader(d *decode.D) {
+	isMPEG2 := d.PeekBits(2) == 0b01
+	if isMPEG2 {
+		d.FieldU2("marker_bits0", mpegVersion)
+	} else {
+		d.FieldU4("marker_bits0", mpegVersion)
+	}
+	scr0 := d.FieldU3("system_clock0")
+	d.FieldU1("marker_bits1")
+	scr1 := d.FieldU15("system_clock1")
+	d.FieldU1("marker_bits2")
+	scr2 := d.FieldU15("system_clock2")
+	d.FieldU1("marker_bits3")
+	if isMPEG2 {
+		d.FieldU9("scr_ext")
+	}
+	d.FieldU1("marker_bits4")
+	scr := scr0<<30 | scr1<<15 | scr2
+	d.FieldValueU("scr", scr)
+	d.FieldU22("mux_rate")
+	d.FieldU1("marker_bits5")
+	if isMPEG2 {
+		d.FieldU1("marker_bits6")
+		d.FieldU5("reserved")
+		packStuffingLength := d.FieldU3("pack_stuffing_length")
+		if packStuffingLength > 0 {
+			d.FieldRawLen("stuffing", int64(packStuffingLength*8))
+		}
+	}
+}
+
+func decodeSystemHeader(d *decode.D) {
+	d.FieldU16("length")
+	d.FieldU1("skip0")
+	d.FieldU22("rate_bound")
+	d.FieldU1("skip1")
+	d.FieldU6("audio_bound")
+	d.FieldU1("fixed_flag")
+	d.FieldU1("csps_flag")
+	d.FieldU1("system_audio_lock_flag")
+	d.FieldU1("system_video_lock_flag")
+	d.FieldU1("skip2")
+	d.FieldU5("video_bound")
+	d.FieldU1("packet_rate_restriction_flag")
+	d.FieldU7("reserved")
+	d.FieldArray("stream_bound_entries", func(d *decode.D) {
+		for d.PeekBits(1) == 1 {
+			d.FieldStruct("stream_bound_entry", func(d *decode.D) {
+				d.FieldU8("stream_id", startAndStreamNames, scalar.ActualHex)
+				d.FieldU2("skip0")
+				d.FieldU1("pstd_buffer_bound_scale")
+				d.FieldU13("pstd_buffer_size_bound")
+			})
+		}
+	})
+}
+
 func pesPacketDecode(d *decode.D, _ any) any {
 	var v any
 
@@ -97,58 +154,9 @@ func pesPacketDecode(d *decode.D, _ any) any {
 
 		}
 	case startCode == packHeader:
-		isMPEG2 := d.PeekBits(2) == 0b01
-		if isMPEG2 {
-			d.FieldU2("marker_bits0", mpegVersion)
-		} else {
-			d.FieldU4("marker_bits0", mpegVersion)
-		}
-		scr0 := d.FieldU3("system_clock0")
-		d.FieldU1("marker_bits1")
-		scr1 := d.FieldU15("system_clock1")
-		d.FieldU1("marker_bits2")
-		scr2 := d.FieldU15("system_clock2")
-		d.FieldU1("marker_bits3")
-		if isMPEG2 {
-			d.FieldU9("scr_ext")
-		}
-		d.FieldU1("marker_bits4")
-		scr := scr0<<30 | scr1<<15 | scr2
-		d.FieldValueU("scr", scr)
-		d.FieldU22("mux_rate")
-		d.FieldU1("marker_bits5")
-		if isMPEG2 {
-			d.FieldU1("marker_bits6")
-			d.FieldU5("reserved")
-			packStuffingLength := d.FieldU3("pack_stuffing_length")
-			if packStuffingLength > 0 {
-				d.FieldRawLen("stuffing", int64(packStuffingLength*8))
-			}
-		}
+		decodePackHeader(d)
 	case startCode == systemHeader:
-		d.FieldU16("length")
-		d.FieldU1("skip0")
-		d.FieldU22("rate_bound")
-		d.FieldU1("skip1")
-		d.FieldU6("audio_bound")
-		d.FieldU1("fixed_flag")
-		d.FieldU1("csps_flag")
-		d.FieldU1("system_audio_lock_flag")
-		d.FieldU1("system_video_lock_flag")
-		d.FieldU1("skip2")
-		d.FieldU5("video_bound")
-		d.FieldU1("packet_rate_restriction_flag")
-		d.FieldU7("reserved")
-		d.FieldArray("stream_bound_entries", func(d *decode.D) {
-			for d.PeekBits(1) == 1 {
-				d.FieldStruct("stream_bound_entry", func(d *decode.D) {
-					d.FieldU8("stream_id")
-					d.FieldU2("skip0")
-					d.FieldU1("pstd_buffer_bound_scale")
-					d.FieldU13("pstd_buffer_size_bound")
-				})
-			}
-		})
+		decodeSystemHeader(d)
 	case startCode >= 0xbd:
 		length := d.FieldU16("length")
 		// 0xbd-0xbd // Privatestream1
@@ -0,0 +1,163 @@
+package mpeg
+
+// ISO/IEC 13818-1 2.5 Program stream bitstream requirements
+// http://dvdnav.mplayerhq.hu/dvdinfo/mpeghdrs.html
+// http://dvdnav.mplayerhq.hu/dvdinfo/pes-hdr.html
+
+// TODO: program stream map
+// TODO: subpicture and lpcm substreams
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var psMP3Format decode.Group
+var psAC3Format decode.Group
+var psDTSFormat decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.MPEG_PS,
+		Description: "MPEG Program Stream",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    psDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.MP3}, Group: &psMP3Format},
+			{Names: []string{format.AC3}, Group: &psAC3Format},
+			{Names: []string{format.DTS}, Group: &psDTSFormat},
+		},
+	})
+}
+
+const (
+	programEnd    = 0xb9
+	paddingStream = 0xbe
+)
+
+// private stream 1 substreams as used by DVD-Video
+var substreamNames = scalar.URangeToScalar{
+	{Range: [2]uint64{0x20, 0x3f}, S: scalar.S{Sym: "subpicture"}},
+	{Range: [2]uint64{0x80, 0x87}, S: scalar.S{Sym: "ac3"}},
+	{Range: [2]uint64{0x88, 0x8f}, S: scalar.S{Sym: "dts"}},
+	{Range: [2]uint64{0xa0, 0xa7}, S: scalar.S{Sym: "lpcm"}},
+}
+
+type psStream struct {
+	streamID    uint64
+	substreamID uint64
+	buf         []byte
+}
+
+func psDecodeStream(d *decode.D, s *psStream) {
+	d.FieldValueU("stream_id", s.streamID, startAndStreamNames, scalar.ActualHex)
+	if s.streamID == privateStream1 {
+		d.FieldValueU("substream_id", s.substreamID, substreamNames, scalar.ActualHex)
+	}
+
+	br := bitio.NewBitReader(s.buf, -1)
+	var group *decode.Group
+	switch {
+	case s.streamID >= 0xc0 && s.streamID <= 0xdf:
+		group = &psMP3Format
+	case s.streamID == privateStream1 && s.substreamID >= 0x80 && s.substreamID <= 0x87:
+		group = &psAC3Format
+	case s.streamID == privateStream1 && s.substreamID >= 0x88 && s.substreamID <= 0x8f:
+		group = &psDTSFormat
+	}
+	if group != nil {
+		if dv, _, _ := d.TryFieldFormatBitBuf("data", br, *group, nil); dv != nil {
+			return
+		}
+	}
+	d.FieldRootBitBuf("data", br)
+}
+
+func psDecode(d *decode.D, _ any) any {
+	if d.PeekBits(32) != 0x0000_01ba {
+		d.Fatalf("no pack header found")
+	}
+
+	streams := map[uint64]*psStream{}
+	var streamKeys []uint64
+
+	d.FieldArray("packets", func(d *decode.D) {
+		for d.BitsLeft() >= 32 && d.PeekBits(24) == 0b0000_0000_0000_0000_0000_0001 {
+			startCode := d.PeekBits(32) & 0xff
+			if startCode < programEnd {
+				// video elementary stream start codes are not valid at pack level
+				break
+			}
+
+			d.FieldStruct("packet", func(d *decode.D) {
+				d.FieldU24("prefix", d.AssertU(0b0000_0000_0000_0000_0000_0001), scalar.ActualBin)
+				d.FieldU8("start_code", startAndStreamNames, scalar.ActualHex)
+
+				switch startCode {
+				case programEnd:
+				case packHeader:
+					decodePackHeader(d)
+				case systemHeader:
+					decodeSystemHeader(d)
+				default:
+					length := d.FieldU16("packet_length")
+					dataEnd := d.Pos() + int64(length)*8
+					if dataEnd > d.Len() {
+						d.Fatalf("packet length %d outside buffer", length)
+					}
+					if !pesNoHeaderStreamIDs[startCode] {
+						decodePESHeader(d, dataEnd)
+					}
+					var substreamID uint64
+					if startCode == privateStream1 && d.Pos() < dataEnd {
+						substreamID = d.FieldU8("substream_id", substreamNames, scalar.ActualHex)
+						switch {
+						case substreamID >= 0x80 && substreamID <= 0x8f:
+							d.FieldU8("frame_count")
+							d.FieldU16("first_access_unit_pointer")
+						case substreamID >= 0xa0 && substreamID <= 0xa7:
+							d.FieldU8("frame_count")
+							d.FieldU16("first_access_unit_pointer")
+							d.FieldRawLen("lpcm_header", 3*8)
+						}
+					}
+					if d.Pos() > dataEnd {
+						d.Fatalf("packet header outside packet")
+					}
+					data := d.FieldRawLen("data", dataEnd-d.Pos())
+
+					if startCode == paddingStream {
+						return
+					}
+					key := startCode<<8 | substreamID
+					s, ok := streams[key]
+					if !ok {
+						s = &psStream{streamID: startCode, substreamID: substreamID}
+						streams[key] = s
+						streamKeys = append(streamKeys, key)
+					}
+					s.buf = append(s.buf, d.ReadAllBits(data)...)
+				}
+			})
+
+			if startCode == programEnd {
+				break
+			}
+		}
+	})
+
+	d.FieldArray("streams", func(d *decode.D) {
+		for _, k := range streamKeys {
+			d.FieldStruct("stream", func(d *decode.D) { psDecodeStream(d, streams[k]) })
+		}
+	})
+
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("trailing", d.BitsLeft())
+	}
+
+	return nil
+}
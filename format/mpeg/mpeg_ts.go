@@ -1,12 +1,33 @@
 package mpeg
 
+// ISO/IEC 13818-1 2.4 Transport stream bitstream requirements
+// https://en.wikipedia.org/wiki/MPEG_transport_stream
+// https://en.wikipedia.org/wiki/Program-specific_information
+
+// TODO: sections spanning multiple packets
+// TODO: PES header ESCR, ES rate, trick mode and extension fields
+
 import (
+	"embed"
+
 	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/checksum"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
 	"github.com/wader/fq/pkg/scalar"
 )
 
+//go:embed mpeg_ts.jq
+var mpegTsFS embed.FS
+
+var tsAVCAnnexBFormat decode.Group
+var tsHEVCAnnexBFormat decode.Group
+var tsADTSFormat decode.Group
+var tsLATMLOASFormat decode.Group
+var tsAC3Format decode.Group
+var tsEAC3Format decode.Group
+
 func init() {
 	interp.RegisterFormat(decode.Format{
 		Name:        format.MPEG_TS,
@@ -14,20 +35,552 @@ func init() {
 		Description: "MPEG Transport Stream",
 		Groups:      []string{format.PROBE},
 		DecodeFn:    tsDecode,
+		DecodeInArg: format.MpegTsIn{
+			MaxSyncSeek: tsPacketSize, // capture started mid packet
+		},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.AVC_ANNEXB}, Group: &tsAVCAnnexBFormat},
+			{Names: []string{format.HEVC_ANNEXB}, Group: &tsHEVCAnnexBFormat},
+			{Names: []string{format.ADTS}, Group: &tsADTSFormat},
+			{Names: []string{format.LATM_LOAS}, Group: &tsLATMLOASFormat},
+			{Names: []string{format.AC3}, Group: &tsAC3Format},
+			{Names: []string{format.EAC3}, Group: &tsEAC3Format},
+		},
+		Functions: []string{"_at_time", "_help"},
 	})
+	interp.RegisterFS(mpegTsFS)
+}
+
+const tsPacketSize = 188
+const tsSyncByte = 0x47
+
+const (
+	pidPAT  = 0x0000
+	pidNull = 0x1fff
+)
+
+const (
+	tableIDPAT = 0x00
+	tableIDPMT = 0x02
+)
+
+const (
+	streamTypeADTS = 0x0f
+	streamTypeLATM = 0x11
+	streamTypeAVC  = 0x1b
+	streamTypeHEVC = 0x24
+	streamTypeAC3  = 0x81
+	streamTypeEAC3 = 0x87
+)
+
+var adaptationFieldControlNames = scalar.UToSymStr{
+	0b00: "reserved",
+	0b01: "payload_only",
+	0b10: "adaptation_field_only",
+	0b11: "adaptation_field_and_payload",
+}
+
+var tableIDNames = scalar.UToSymStr{
+	0x00: "program_association",
+	0x01: "conditional_access",
+	0x02: "program_map",
+	0x03: "description",
+	0xff: "forbidden",
 }
 
-// TODO: ts_packet
+var tsStreamTypeNames = scalar.UToScalar{
+	0x01: {Sym: "mpeg1_video", Description: "ISO/IEC 11172-2 video"},
+	0x02: {Sym: "mpeg2_video", Description: "ISO/IEC 13818-2 video"},
+	0x03: {Sym: "mpeg1_audio", Description: "ISO/IEC 11172-3 audio"},
+	0x04: {Sym: "mpeg2_audio", Description: "ISO/IEC 13818-3 audio"},
+	0x05: {Sym: "private_sections", Description: "ISO/IEC 13818-1 private sections"},
+	0x06: {Sym: "private_pes", Description: "ISO/IEC 13818-1 PES packets with private data"},
+	0x0f: {Sym: "adts", Description: "ISO/IEC 13818-7 audio with ADTS transport syntax"},
+	0x10: {Sym: "mpeg4_visual", Description: "ISO/IEC 14496-2 visual"},
+	0x11: {Sym: "latm", Description: "ISO/IEC 14496-3 audio with LATM transport syntax"},
+	0x15: {Sym: "metadata_pes", Description: "Metadata carried in PES packets"},
+	0x1b: {Sym: "avc", Description: "ITU-T H.264 video"},
+	0x24: {Sym: "hevc", Description: "ITU-T H.265 video"},
+	0x81: {Sym: "ac3", Description: "ATSC A/52 AC-3 audio"},
+	0x86: {Sym: "scte35", Description: "SCTE-35 splice information"},
+	0x87: {Sym: "eac3", Description: "ATSC A/52 E-AC-3 audio"},
+}
+
+var descriptorTagNames = scalar.UToSymStr{
+	0x02: "video_stream",
+	0x03: "audio_stream",
+	0x05: "registration",
+	0x09: "ca",
+	0x0a: "iso_639_language",
+	0x1c: "mpeg4_audio",
+	0x28: "avc_video",
+	0x38: "hevc_video",
+	0x52: "stream_identifier",
+	0x56: "teletext",
+	0x59: "subtitling",
+	0x6a: "ac3",
+	0x7a: "enhanced_ac3",
+	0x7c: "aac",
+}
+
+var ptsDTSFlagsNames = scalar.UToSymStr{
+	0b00: "none",
+	0b01: "forbidden",
+	0b10: "pts",
+	0b11: "pts_dts",
+}
+
+// stream ids without PES header extension
+var pesNoHeaderStreamIDs = map[uint64]bool{
+	0xbc: true, // program_stream_map
+	0xbe: true, // padding_stream
+	0xbf: true, // private_stream2
+	0xf0: true, // ecm_stream
+	0xf1: true, // emm_stream
+	0xf2: true, // itu_t_rec_h_222_0
+	0xf8: true, // itu_t_rec_h_222_1_type_e
+	0xff: true, // program_stream_directory
+}
+
+type tsStream struct {
+	streamType uint64
+	buf        []byte
+	started    bool
+	packetsD   *decode.D
+}
+
+type tsState struct {
+	pidNames  scalar.UToSymStr
+	pmtPIDs   map[uint64]bool
+	streams   map[uint64]*tsStream
+	streamPID []uint64
+	streamsD  *decode.D
+}
+
+func pesDecodeTimestamp(d *decode.D) uint64 {
+	d.U4()
+	v := d.U3()
+	d.U1()
+	v = v<<15 | d.U15()
+	d.U1()
+	v = v<<15 | d.U15()
+	d.U1()
+	return v
+}
+
+func tsDecodeDescriptors(d *decode.D, nBytes uint64) {
+	d.FramedFn(int64(nBytes)*8, func(d *decode.D) {
+		d.FieldArray("descriptors", func(d *decode.D) {
+			for d.BitsLeft() >= 16 {
+				d.FieldStruct("descriptor", func(d *decode.D) {
+					tag := d.FieldU8("tag", descriptorTagNames, scalar.ActualHex)
+					length := d.FieldU8("length")
+					if int64(length)*8 > d.BitsLeft() {
+						d.Fatalf("descriptor length %d outside descriptors", length)
+					}
+					d.FramedFn(int64(length)*8, func(d *decode.D) {
+						switch {
+						case tag == 0x05 && length >= 4:
+							d.FieldUTF8("format_identifier", 4)
+						case tag == 0x0a:
+							d.FieldArray("languages", func(d *decode.D) {
+								for d.BitsLeft() >= 32 {
+									d.FieldStruct("language", func(d *decode.D) {
+										d.FieldUTF8("iso_639_language_code", 3)
+										d.FieldU8("audio_type")
+									})
+								}
+							})
+						}
+						if d.BitsLeft() > 0 {
+							d.FieldRawLen("data", d.BitsLeft())
+						}
+					})
+				})
+			}
+		})
+	})
+}
 
-func tsDecode(d *decode.D, _ any) any {
-	d.FieldU8("sync", d.AssertU(0x47), scalar.ActualHex)
+func tsDecodeSection(d *decode.D, s *tsState) {
+	sectionStart := d.Pos()
+	tableID := d.FieldU8("table_id", tableIDNames, scalar.ActualHex)
+	if tableID == 0xff {
+		return
+	}
+	d.FieldBool("section_syntax_indicator")
+	d.FieldU1("private_indicator")
+	d.FieldU2("reserved0")
+	sectionLength := d.FieldU12("section_length")
+	if int64(sectionLength)*8 > d.BitsLeft() {
+		d.Fatalf("section length %d outside packet", sectionLength)
+	}
+	if sectionLength < 9 || (tableID != tableIDPAT && tableID != tableIDPMT) {
+		d.FieldRawLen("data", int64(sectionLength)*8)
+		return
+	}
+
+	d.FramedFn(int64(sectionLength-4)*8, func(d *decode.D) {
+		switch tableID {
+		case tableIDPAT:
+			d.FieldU16("transport_stream_id")
+		case tableIDPMT:
+			d.FieldU16("program_number")
+		}
+		d.FieldU2("reserved1")
+		d.FieldU5("version_number")
+		d.FieldBool("current_next_indicator")
+		d.FieldU8("section_number")
+		d.FieldU8("last_section_number")
+
+		switch tableID {
+		case tableIDPAT:
+			d.FieldArray("programs", func(d *decode.D) {
+				for d.BitsLeft() >= 32 {
+					d.FieldStruct("program", func(d *decode.D) {
+						programNumber := d.FieldU16("program_number")
+						d.FieldU3("reserved")
+						if programNumber == 0 {
+							d.FieldU13("network_pid", scalar.ActualHex)
+							return
+						}
+						pid := d.FieldU13("program_map_pid", scalar.ActualHex)
+						s.pmtPIDs[pid] = true
+						s.pidNames[pid] = "pmt"
+					})
+				}
+			})
+		case tableIDPMT:
+			d.FieldU3("reserved2")
+			d.FieldU13("pcr_pid", s.pidNames, scalar.ActualHex)
+			d.FieldU4("reserved3")
+			programInfoLength := d.FieldU12("program_info_length")
+			tsDecodeDescriptors(d, programInfoLength)
+			d.FieldArray("streams", func(d *decode.D) {
+				for d.BitsLeft() >= 40 {
+					d.FieldStruct("stream", func(d *decode.D) {
+						streamType := d.FieldU8("stream_type", tsStreamTypeNames, scalar.ActualHex)
+						d.FieldU3("reserved0")
+						pid := d.FieldU13("elementary_pid", scalar.ActualHex)
+						d.FieldU4("reserved1")
+						esInfoLength := d.FieldU12("es_info_length")
+						tsDecodeDescriptors(d, esInfoLength)
+
+						if _, ok := s.streams[pid]; ok {
+							return
+						}
+						sym := "pes"
+						if ss, ok := tsStreamTypeNames[streamType]; ok {
+							sym, _ = ss.Sym.(string)
+						}
+						s.pidNames[pid] = sym
+						var packetsD *decode.D
+						s.streamsD.FieldStruct("stream", func(d *decode.D) {
+							d.FieldValueU("pid", pid, scalar.ActualHex)
+							d.FieldValueU("stream_type", streamType, tsStreamTypeNames, scalar.ActualHex)
+							packetsD = d.FieldArrayValue("packets")
+						})
+						s.streams[pid] = &tsStream{
+							streamType: streamType,
+							packetsD:   packetsD,
+						}
+						s.streamPID = append(s.streamPID, pid)
+					})
+				}
+			})
+		}
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("unknown", d.BitsLeft())
+		}
+	})
+
+	crc := &checksum.CRC{Bits: 32, Current: 0xffff_ffff, Table: checksum.Poly04c11db7Table}
+	d.CopyBits(crc, d.BitBufRange(sectionStart, d.Pos()-sectionStart))
+	d.FieldU32("crc", d.ValidateUBEBytes(crc.Sum(nil)), scalar.ActualHex)
+}
+
+// MPEG-2 PES header, MPEG-1 packet header in program streams
+func decodePESHeader(d *decode.D, dataEnd int64) {
+	if d.PeekBits(2) != 0b10 {
+		d.FieldStruct("header", func(d *decode.D) {
+			// at most 16 stuffing bytes
+			stuffingBytes := int64(0)
+			for stuffingBytes < 16 && d.Pos()+(stuffingBytes+1)*8 <= dataEnd && d.BytesRange(d.Pos()+stuffingBytes*8, 1)[0] == 0xff {
+				stuffingBytes++
+			}
+			if stuffingBytes > 0 {
+				d.FieldRawLen("stuffing", stuffingBytes*8)
+			}
+			if d.PeekBits(2) == 0b01 {
+				d.FieldU2("std_marker_bits")
+				d.FieldBool("std_buffer_scale")
+				d.FieldU13("std_buffer_size")
+			}
+			switch d.PeekBits(4) {
+			case 0b0010:
+				d.FieldUFn("pts", pesDecodeTimestamp)
+			case 0b0011:
+				d.FieldUFn("pts", pesDecodeTimestamp)
+				d.FieldUFn("dts", pesDecodeTimestamp)
+			default:
+				d.FieldU8("no_timestamps", d.ValidateU(0x0f), scalar.ActualHex)
+			}
+		})
+		return
+	}
+
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldU2("marker_bits", d.ValidateU(0b10))
+		d.FieldU2("scrambling_control")
+		d.FieldBool("priority")
+		d.FieldBool("data_alignment_indicator")
+		d.FieldBool("copyright")
+		d.FieldBool("original")
+		ptsDTSFlags := d.FieldU2("pts_dts_flags", ptsDTSFlagsNames)
+		d.FieldBool("escr_flag")
+		d.FieldBool("es_rate_flag")
+		d.FieldBool("dsm_trick_mode_flag")
+		d.FieldBool("additional_copy_info_flag")
+		d.FieldBool("crc_flag")
+		d.FieldBool("extension_flag")
+		headerDataLength := d.FieldU8("header_data_length")
+		headerDataEnd := d.Pos() + int64(headerDataLength)*8
+		if headerDataEnd > dataEnd {
+			d.Fatalf("header data length %d outside packet", headerDataLength)
+		}
+		if ptsDTSFlags&0b10 != 0 {
+			d.FieldUFn("pts", pesDecodeTimestamp)
+		}
+		if ptsDTSFlags == 0b11 {
+			d.FieldUFn("dts", pesDecodeTimestamp)
+		}
+		if d.Pos() < headerDataEnd {
+			d.FieldRawLen("header_data", headerDataEnd-d.Pos())
+		}
+	})
+}
+
+func tsDecodePES(d *decode.D, streamType uint64) {
+	d.FieldU24("prefix", d.AssertU(0b0000_0000_0000_0000_0000_0001), scalar.ActualBin)
+	streamID := d.FieldU8("stream_id", startAndStreamNames, scalar.ActualHex)
+	packetLength := d.FieldU16("packet_length")
+	dataEnd := d.Len()
+	if packetLength != 0 && d.Pos()+int64(packetLength)*8 < dataEnd {
+		dataEnd = d.Pos() + int64(packetLength)*8
+	}
+
+	if !pesNoHeaderStreamIDs[streamID] {
+		decodePESHeader(d, dataEnd)
+	}
+
+	dataLen := dataEnd - d.Pos()
+	switch streamType {
+	case streamTypeAVC:
+		d.FieldFormatOrRawLen("data", dataLen, tsAVCAnnexBFormat, nil)
+	case streamTypeHEVC:
+		d.FieldFormatOrRawLen("data", dataLen, tsHEVCAnnexBFormat, nil)
+	case streamTypeADTS:
+		d.FieldFormatOrRawLen("data", dataLen, tsADTSFormat, nil)
+	case streamTypeLATM:
+		d.FieldFormatOrRawLen("data", dataLen, tsLATMLOASFormat, nil)
+	case streamTypeAC3:
+		d.FieldFormatOrRawLen("data", dataLen, tsAC3Format, nil)
+	case streamTypeEAC3:
+		d.FieldFormatOrRawLen("data", dataLen, tsEAC3Format, nil)
+	default:
+		d.FieldRawLen("data", dataLen)
+	}
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+}
+
+func (s *tsStream) flush() {
+	if len(s.buf) == 0 {
+		return
+	}
+	br := bitio.NewBitReader(s.buf, -1)
+	s.packetsD.FieldStructRootBitBufFn("packet", br, func(d *decode.D) {
+		tsDecodePES(d, s.streamType)
+	})
+	s.buf = nil
+}
+
+func tsDecodeAdaptationField(d *decode.D) {
+	length := d.FieldU8("length")
+	if int64(length)*8 > d.BitsLeft() {
+		d.Fatalf("adaptation field length %d outside packet", length)
+	}
+	if length == 0 {
+		return
+	}
+	d.FramedFn(int64(length)*8, func(d *decode.D) {
+		d.FieldBool("discontinuity_indicator")
+		d.FieldBool("random_access_indicator")
+		d.FieldBool("elementary_stream_priority_indicator")
+		pcrFlag := d.FieldBool("pcr_flag")
+		opcrFlag := d.FieldBool("opcr_flag")
+		splicingPointFlag := d.FieldBool("splicing_point_flag")
+		privateDataFlag := d.FieldBool("transport_private_data_flag")
+		extensionFlag := d.FieldBool("adaptation_field_extension_flag")
+		pcrFn := func(name string) {
+			d.FieldStruct(name, func(d *decode.D) {
+				base := d.FieldU33("base")
+				d.FieldU6("reserved")
+				ext := d.FieldU9("extension")
+				// 27 MHz clock
+				d.FieldValueU("value", base*300+ext)
+			})
+		}
+		if pcrFlag {
+			pcrFn("pcr")
+		}
+		if opcrFlag {
+			pcrFn("opcr")
+		}
+		if splicingPointFlag {
+			d.FieldS8("splice_countdown")
+		}
+		if privateDataFlag {
+			privateDataLength := d.FieldU8("transport_private_data_length")
+			d.FieldRawLen("transport_private_data", int64(privateDataLength)*8)
+		}
+		if extensionFlag {
+			extensionLength := d.FieldU8("extension_length")
+			d.FieldRawLen("extension", int64(extensionLength)*8)
+		}
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("stuffing", d.BitsLeft())
+		}
+	})
+}
+
+func tsDecodePacket(d *decode.D, s *tsState) {
+	d.FieldU8("sync", d.AssertU(tsSyncByte), scalar.ActualHex)
 	d.FieldBool("transport_error_indicator")
-	d.FieldBool("payload_unit_start")
+	payloadUnitStart := d.FieldBool("payload_unit_start")
 	d.FieldBool("transport_priority")
-	d.FieldU13("pid")
+	pid := d.FieldU13("pid", s.pidNames, scalar.ActualHex)
 	d.FieldU2("transport_scrambling_control")
-	d.FieldU2("adaptation_field_control")
+	adaptationFieldControl := d.FieldU2("adaptation_field_control", adaptationFieldControlNames)
 	d.FieldU4("continuity_counter")
 
+	if adaptationFieldControl&0b10 != 0 {
+		d.FieldStruct("adaptation_field", tsDecodeAdaptationField)
+	}
+	if adaptationFieldControl&0b01 == 0 || d.BitsLeft() == 0 {
+		return
+	}
+
+	switch {
+	case pid == pidNull:
+		d.FieldRawLen("stuffing", d.BitsLeft())
+	case pid == pidPAT || s.pmtPIDs[pid]:
+		if !payloadUnitStart {
+			d.FieldRawLen("payload", d.BitsLeft())
+			return
+		}
+		pointerField := d.FieldU8("pointer_field")
+		if int64(pointerField)*8 > d.BitsLeft() {
+			d.FieldRawLen("payload", d.BitsLeft())
+			return
+		}
+		if pointerField > 0 {
+			d.FieldRawLen("section_continuation", int64(pointerField)*8)
+		}
+		if d.BitsLeft() >= 8 && d.PeekBits(8) != 0xff {
+			d.FieldStruct("section", func(d *decode.D) { tsDecodeSection(d, s) })
+		}
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("stuffing", d.BitsLeft())
+		}
+	default:
+		payload := d.FieldRawLen("payload", d.BitsLeft())
+		ts, ok := s.streams[pid]
+		if !ok {
+			return
+		}
+		if payloadUnitStart {
+			ts.flush()
+			ts.started = true
+		}
+		if !ts.started {
+			return
+		}
+		ts.buf = append(ts.buf, d.ReadAllBits(payload)...)
+		// flush as soon as known length PES packet is complete
+		if len(ts.buf) >= 6 {
+			packetLength := int(ts.buf[4])<<8 | int(ts.buf[5])
+			if packetLength != 0 && len(ts.buf) >= 6+packetLength {
+				ts.flush()
+			}
+		}
+	}
+}
+
+func tsDecode(d *decode.D, in any) any {
+	ti, _ := in.(format.MpegTsIn)
+
+	if ti.MaxSyncSeek > 0 {
+		// a sync byte followed by another sync byte one packet later, or end of buffer
+		// if nothing was skipped
+		start := d.Pos()
+		syncLen, _, err := d.TryPeekFind(8, 8, int64(ti.MaxSyncSeek)*8, func(v uint64) bool {
+			if v != tsSyncByte {
+				return false
+			}
+			pos := d.Pos() - 8
+			nextPos := pos + tsPacketSize*8
+			if nextPos+8 > d.Len() {
+				return pos == start
+			}
+			return d.BytesRange(nextPos, 1)[0] == tsSyncByte
+		})
+		if err != nil || syncLen < 0 {
+			d.Fatalf("no sync found")
+		}
+		if syncLen > 0 {
+			d.FieldRawLen("leading_garbage", syncLen)
+		}
+	}
+
+	// first packet should be followed by another packet or end of buffer
+	nextPos := d.Pos() + tsPacketSize*8
+	if d.BitsLeft() >= 8 && d.PeekBits(8) == tsSyncByte && nextPos+8 <= d.Len() && d.BytesRange(nextPos, 1)[0] != tsSyncByte {
+		d.Fatalf("no sync found after first packet")
+	}
+
+	s := &tsState{
+		pidNames: scalar.UToSymStr{
+			0x0000:  "pat",
+			0x0001:  "cat",
+			0x0002:  "tsdt",
+			0x0003:  "ipmp",
+			pidNull: "null",
+		},
+		pmtPIDs: map[uint64]bool{},
+		streams: map[uint64]*tsStream{},
+	}
+	s.streamsD = d.FieldArrayValue("streams")
+
+	d.FieldArray("packets", func(d *decode.D) {
+		for first := true; first || (d.BitsLeft() >= 8 && d.PeekBits(8) == tsSyncByte); first = false {
+			packetBits := int64(tsPacketSize * 8)
+			if packetBits > d.BitsLeft() {
+				packetBits = d.BitsLeft()
+			}
+			d.FramedFn(packetBits, func(d *decode.D) {
+				d.FieldStruct("packet", func(d *decode.D) { tsDecodePacket(d, s) })
+			})
+		}
+	})
+	for _, pid := range s.streamPID {
+		s.streams[pid].flush()
+	}
+
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("trailing", d.BitsLeft())
+	}
+
 	return nil
 }
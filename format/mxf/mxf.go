@@ -0,0 +1,651 @@
+package mxf
+
+// SMPTE ST 377-1 Material Exchange Format (MXF) File Format Specification
+// SMPTE ST 336 Data Encoding Protocol Using Key-Length-Value
+// https://github.com/FFmpeg/FFmpeg/blob/master/libavformat/mxfdec.c
+// https://registry.smpte-ra.org
+
+// TODO: run-in before header partition
+// TODO: decode essence elements using codec decoders
+
+import (
+	"bytes"
+	"embed"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed mxf.jq
+var mxfFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.MXF,
+		Description: "Material Exchange Format",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    mxfDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(mxfFS)
+}
+
+// byte 7 is registry version and is ignored when matching
+var (
+	ulPartitionPack      = []byte{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x05, 0x01, 0x01, 0x0d, 0x01, 0x02, 0x01, 0x01}
+	ulPrimerPack         = []byte{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x05, 0x01, 0x01, 0x0d, 0x01, 0x02, 0x01, 0x01, 0x05, 0x01, 0x00}
+	ulRandomIndexPack    = []byte{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x05, 0x01, 0x01, 0x0d, 0x01, 0x02, 0x01, 0x01, 0x11, 0x01, 0x00}
+	ulIndexTableSegment  = []byte{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x53, 0x01, 0x01, 0x0d, 0x01, 0x02, 0x01, 0x01, 0x10, 0x01, 0x00}
+	ulFillItem           = []byte{0x06, 0x0e, 0x2b, 0x34, 0x01, 0x01, 0x01, 0x01, 0x03, 0x01, 0x02, 0x10, 0x01, 0x00, 0x00, 0x00}
+	ulMetadataSet        = []byte{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x53, 0x01, 0x01, 0x0d, 0x01, 0x01, 0x01, 0x01, 0x01}
+	ulEssenceElement     = []byte{0x06, 0x0e, 0x2b, 0x34, 0x01, 0x02, 0x01, 0x01, 0x0d, 0x01, 0x03, 0x01}
+	ulOperationalPattern = []byte{0x06, 0x0e, 0x2b, 0x34, 0x04, 0x01, 0x01, 0x01, 0x0d, 0x01, 0x02, 0x01}
+	ulEssenceContainer   = []byte{0x06, 0x0e, 0x2b, 0x34, 0x04, 0x01, 0x01, 0x01, 0x0d, 0x01, 0x03, 0x01, 0x02}
+	ulDataDefinition     = []byte{0x06, 0x0e, 0x2b, 0x34, 0x04, 0x01, 0x01, 0x01, 0x01, 0x03, 0x02}
+)
+
+func ulMatch(b []byte, prefix []byte) bool {
+	if len(b) < len(prefix) {
+		return false
+	}
+	for i, v := range prefix {
+		if i != 7 && b[i] != v {
+			return false
+		}
+	}
+	return true
+}
+
+var partitionKindNames = map[byte]string{
+	0x02: "header",
+	0x03: "body",
+	0x04: "footer",
+}
+
+var partitionStatusNames = map[byte]string{
+	0x01: "open_incomplete",
+	0x02: "closed_incomplete",
+	0x03: "open_complete",
+	0x04: "closed_complete",
+}
+
+const (
+	setPreface               = 0x2f
+	setIdentification        = 0x30
+	setContentStorage        = 0x18
+	setEssenceContainerData  = 0x23
+	setMaterialPackage       = 0x36
+	setSourcePackage         = 0x37
+	setTimelineTrack         = 0x3b
+	setEventTrack            = 0x39
+	setStaticTrack           = 0x3a
+	setSequence              = 0x0f
+	setSourceClip            = 0x11
+	setTimecodeComponent     = 0x14
+	setFiller                = 0x09
+	setMultipleDescriptor    = 0x44
+	setFileDescriptor        = 0x25
+	setPictureDescriptor     = 0x27
+	setCDCIDescriptor        = 0x28
+	setRGBADescriptor        = 0x29
+	setSoundDescriptor       = 0x42
+	setDataDescriptor        = 0x43
+	setMPEG2VideoDescriptor  = 0x51
+	setWaveAudioDescriptor   = 0x48
+	setAES3AudioDescriptor   = 0x47
+	setNetworkLocator        = 0x32
+	setTextLocator           = 0x33
+	setDMSegment             = 0x41
+	setAVCSubDescriptor      = 0x6e
+	setJPEG2000SubDescriptor = 0x5a
+)
+
+var setNames = map[byte]string{
+	setPreface:               "preface",
+	setIdentification:        "identification",
+	setContentStorage:        "content_storage",
+	setEssenceContainerData:  "essence_container_data",
+	setMaterialPackage:       "material_package",
+	setSourcePackage:         "source_package",
+	setTimelineTrack:         "timeline_track",
+	setEventTrack:            "event_track",
+	setStaticTrack:           "static_track",
+	setSequence:              "sequence",
+	setSourceClip:            "source_clip",
+	setTimecodeComponent:     "timecode_component",
+	setFiller:                "filler",
+	setMultipleDescriptor:    "multiple_descriptor",
+	setFileDescriptor:        "file_descriptor",
+	setPictureDescriptor:     "generic_picture_essence_descriptor",
+	setCDCIDescriptor:        "cdci_essence_descriptor",
+	setRGBADescriptor:        "rgba_essence_descriptor",
+	setSoundDescriptor:       "generic_sound_essence_descriptor",
+	setDataDescriptor:        "generic_data_essence_descriptor",
+	setMPEG2VideoDescriptor:  "mpeg2_video_descriptor",
+	setWaveAudioDescriptor:   "wave_audio_descriptor",
+	setAES3AudioDescriptor:   "aes3_audio_descriptor",
+	setNetworkLocator:        "network_locator",
+	setTextLocator:           "text_locator",
+	setDMSegment:             "dm_segment",
+	setAVCSubDescriptor:      "avc_sub_descriptor",
+	setJPEG2000SubDescriptor: "jpeg2000_sub_descriptor",
+}
+
+// generic container item types, byte 12 of essence element key
+var essenceItemTypeNames = map[byte]string{
+	0x04: "cp_system_item",
+	0x05: "cp_picture_item",
+	0x06: "cp_sound_item",
+	0x07: "cp_data_item",
+	0x14: "gc_system_item",
+	0x15: "gc_picture_item",
+	0x16: "gc_sound_item",
+	0x17: "gc_data_item",
+	0x18: "gc_compound_item",
+}
+
+var essenceContainerNames = map[byte]string{
+	0x01: "d10",
+	0x02: "dv",
+	0x04: "mpeg_es",
+	0x05: "uncompressed_picture",
+	0x06: "aes_bwf",
+	0x07: "mpeg_pes",
+	0x0a: "alaw",
+	0x0c: "jpeg2000",
+	0x10: "avc",
+	0x11: "vc3",
+	0x13: "timed_text",
+	0x1c: "prores",
+}
+
+var dataDefinitionNames = map[[2]byte]string{
+	{0x01, 0x01}: "timecode",
+	{0x02, 0x01}: "picture",
+	{0x02, 0x02}: "sound",
+	{0x02, 0x03}: "data",
+}
+
+func ulString(b []byte) string {
+	return fmt.Sprintf("%x.%x.%x.%x", b[0:4], b[4:8], b[8:12], b[12:16])
+}
+
+// symbol for keys and labels, falls back to hex UL
+func ulSym(b []byte) string {
+	switch {
+	case ulMatch(b, ulPrimerPack):
+		return "primer_pack"
+	case ulMatch(b, ulRandomIndexPack):
+		return "random_index_pack"
+	case ulMatch(b, ulIndexTableSegment):
+		return "index_table_segment"
+	case ulMatch(b, ulFillItem):
+		return "fill_item"
+	case ulMatch(b, ulPartitionPack):
+		kind, kindOk := partitionKindNames[b[13]]
+		status, statusOk := partitionStatusNames[b[14]]
+		if kindOk && statusOk {
+			return kind + "_partition_" + status
+		}
+	case ulMatch(b, ulMetadataSet) && b[15] == 0x00:
+		if n, ok := setNames[b[14]]; ok {
+			return n
+		}
+		return "metadata_set"
+	case ulMatch(b, ulEssenceElement):
+		if n, ok := essenceItemTypeNames[b[12]]; ok {
+			return n
+		}
+		return "essence_element"
+	case ulMatch(b, ulOperationalPattern):
+		switch {
+		case b[12] == 0x10:
+			return "op_atom"
+		case b[12] >= 0x01 && b[12] <= 0x03 && b[13] >= 0x01 && b[13] <= 0x03:
+			return fmt.Sprintf("op%d%c", b[12], 'a'+b[13]-1)
+		}
+	case ulMatch(b, ulEssenceContainer):
+		if n, ok := essenceContainerNames[b[13]]; ok {
+			return n
+		}
+		return "generic_container"
+	case ulMatch(b, ulDataDefinition):
+		if n, ok := dataDefinitionNames[[2]byte{b[11], b[12]}]; ok {
+			return n
+		}
+	}
+	return ulString(b)
+}
+
+var ulNames = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	return scalar.RawSym(s, 16, ulSym)
+})
+
+const (
+	tagTypeUUID = iota
+	tagTypeUL
+	tagTypeUMID
+	tagTypeU8
+	tagTypeU16
+	tagTypeU32
+	tagTypeU64
+	tagTypeS8
+	tagTypeS32
+	tagTypeS64
+	tagTypeBool
+	tagTypeRational
+	tagTypeTimestamp
+	tagTypeUTF16
+	tagTypeVersion
+	tagTypeUUIDBatch
+	tagTypeULBatch
+	tagTypeDeltaEntryArray
+	tagTypeIndexEntryArray
+)
+
+type localTag struct {
+	name string
+	typ  int
+}
+
+const (
+	tagInstanceUID     = 0x3c0a
+	tagSliceCount      = 0x3f08
+	tagPosTableCount   = 0x3f0e
+	tagDeltaEntryArray = 0x3f09
+	tagIndexEntryArray = 0x3f0a
+	dynamicTagFirst    = 0x8000
+)
+
+// statically assigned local tags, SMPTE ST 377-1 annex
+var localTags = map[uint64]localTag{
+	tagInstanceUID: {"instance_uid", tagTypeUUID},
+	0x0102:         {"generation_uid", tagTypeUUID},
+	0x3b02:         {"last_modified_date", tagTypeTimestamp},
+	0x3b05:         {"version", tagTypeU16},
+	0x3b07:         {"object_model_version", tagTypeU32},
+	0x3b03:         {"content_storage", tagTypeUUID},
+	0x3b06:         {"identifications", tagTypeUUIDBatch},
+	0x3b08:         {"primary_package", tagTypeUUID},
+	0x3b09:         {"operational_pattern", tagTypeUL},
+	0x3b0a:         {"essence_containers", tagTypeULBatch},
+	0x3b0b:         {"dm_schemes", tagTypeULBatch},
+
+	0x3c09: {"this_generation_uid", tagTypeUUID},
+	0x3c01: {"company_name", tagTypeUTF16},
+	0x3c02: {"product_name", tagTypeUTF16},
+	0x3c03: {"product_version", tagTypeVersion},
+	0x3c04: {"version_string", tagTypeUTF16},
+	0x3c05: {"product_uid", tagTypeUUID},
+	0x3c06: {"modification_date", tagTypeTimestamp},
+	0x3c07: {"toolkit_version", tagTypeVersion},
+	0x3c08: {"platform", tagTypeUTF16},
+
+	0x1901: {"packages", tagTypeUUIDBatch},
+	0x1902: {"essence_container_data", tagTypeUUIDBatch},
+	0x2701: {"linked_package_uid", tagTypeUMID},
+
+	0x4401: {"package_uid", tagTypeUMID},
+	0x4402: {"name", tagTypeUTF16},
+	0x4403: {"tracks", tagTypeUUIDBatch},
+	0x4404: {"package_modified_date", tagTypeTimestamp},
+	0x4405: {"package_creation_date", tagTypeTimestamp},
+	0x4701: {"descriptor", tagTypeUUID},
+
+	0x4801: {"track_id", tagTypeU32},
+	0x4802: {"track_name", tagTypeUTF16},
+	0x4803: {"sequence", tagTypeUUID},
+	0x4804: {"track_number", tagTypeU32},
+	0x4b01: {"edit_rate", tagTypeRational},
+	0x4b02: {"origin", tagTypeS64},
+
+	0x0201: {"data_definition", tagTypeUL},
+	0x0202: {"duration", tagTypeS64},
+	0x1001: {"structural_components", tagTypeUUIDBatch},
+	0x1101: {"source_package_id", tagTypeUMID},
+	0x1102: {"source_track_id", tagTypeU32},
+	0x1201: {"start_position", tagTypeS64},
+	0x1501: {"start_timecode", tagTypeS64},
+	0x1502: {"rounded_timecode_base", tagTypeU16},
+	0x1503: {"drop_frame", tagTypeBool},
+
+	0x2f01: {"locators", tagTypeUUIDBatch},
+	0x3001: {"sample_rate", tagTypeRational},
+	0x3002: {"container_duration", tagTypeS64},
+	0x3004: {"essence_container", tagTypeUL},
+	0x3005: {"codec", tagTypeUL},
+	0x3006: {"linked_track_id", tagTypeU32},
+	0x3f01: {"sub_descriptor_uids", tagTypeUUIDBatch},
+	0x4001: {"url_string", tagTypeUTF16},
+	0x4101: {"locator_name", tagTypeUTF16},
+
+	0x3201: {"picture_essence_coding", tagTypeUL},
+	0x3202: {"stored_height", tagTypeU32},
+	0x3203: {"stored_width", tagTypeU32},
+	0x3204: {"sampled_height", tagTypeU32},
+	0x3205: {"sampled_width", tagTypeU32},
+	0x3208: {"display_height", tagTypeU32},
+	0x3209: {"display_width", tagTypeU32},
+	0x320c: {"frame_layout", tagTypeU8},
+	0x320e: {"aspect_ratio", tagTypeRational},
+	0x3215: {"signal_standard", tagTypeU8},
+	0x3301: {"component_depth", tagTypeU32},
+	0x3302: {"horizontal_subsampling", tagTypeU32},
+	0x3303: {"color_siting", tagTypeU8},
+	0x3308: {"vertical_subsampling", tagTypeU32},
+
+	0x3d01: {"quantization_bits", tagTypeU32},
+	0x3d02: {"locked", tagTypeBool},
+	0x3d03: {"audio_sampling_rate", tagTypeRational},
+	0x3d04: {"audio_ref_level", tagTypeS8},
+	0x3d06: {"sound_essence_coding", tagTypeUL},
+	0x3d07: {"channel_count", tagTypeU32},
+	0x3d09: {"avg_bps", tagTypeU32},
+	0x3d0a: {"block_align", tagTypeU16},
+
+	0x3f05:             {"edit_unit_byte_count", tagTypeU32},
+	0x3f06:             {"index_sid", tagTypeU32},
+	0x3f07:             {"body_sid", tagTypeU32},
+	tagSliceCount:      {"slice_count", tagTypeU8},
+	tagDeltaEntryArray: {"delta_entry_array", tagTypeDeltaEntryArray},
+	tagIndexEntryArray: {"index_entry_array", tagTypeIndexEntryArray},
+	0x3f0b:             {"index_edit_rate", tagTypeRational},
+	0x3f0c:             {"index_start_position", tagTypeS64},
+	0x3f0d:             {"index_duration", tagTypeS64},
+	tagPosTableCount:   {"pos_table_count", tagTypeU8},
+}
+
+type mxfState struct {
+	primer map[uint64][]byte
+}
+
+// BER encoded length, short form or long form with number of bytes in first byte
+func berLength(d *decode.D) uint64 {
+	n := d.U8()
+	if n&0x80 == 0 {
+		return n
+	}
+	l := n & 0x7f
+	if l == 0 || l > 8 {
+		d.Fatalf("invalid BER length size %d", l)
+	}
+	return d.U(int(l) * 8)
+}
+
+func fieldBatch(d *decode.D, name string, fn func(d *decode.D)) {
+	d.FieldStruct(name, func(d *decode.D) {
+		count := d.FieldU32("count")
+		itemLength := d.FieldU32("item_length")
+		d.FieldArray("items", func(d *decode.D) {
+			for i := uint64(0); i < count; i++ {
+				d.FramedFn(int64(itemLength)*8, fn)
+			}
+		})
+	})
+}
+
+func decodeTimestamp(d *decode.D) {
+	year := d.FieldU16("year")
+	month := d.FieldU8("month")
+	day := d.FieldU8("day")
+	hour := d.FieldU8("hour")
+	minute := d.FieldU8("minute")
+	second := d.FieldU8("second")
+	quarterMsec := d.FieldU8("quarter_msec")
+	d.FieldValueStr("time", fmt.Sprintf("%04d-%02d-%02dT%02d:%02d:%02d.%03d",
+		year, month, day, hour, minute, second, quarterMsec*4))
+}
+
+func decodeRational(d *decode.D) {
+	d.FieldS32("numerator")
+	d.FieldS32("denominator")
+}
+
+func decodePartitionPack(d *decode.D) {
+	d.FieldU16("major_version")
+	d.FieldU16("minor_version")
+	d.FieldU32("kag_size")
+	d.FieldU64("this_partition")
+	d.FieldU64("previous_partition")
+	d.FieldU64("footer_partition")
+	d.FieldU64("header_byte_count")
+	d.FieldU64("index_byte_count")
+	d.FieldU32("index_sid")
+	d.FieldU64("body_offset")
+	d.FieldU32("body_sid")
+	d.FieldRawLen("operational_pattern", 16*8, ulNames)
+	fieldBatch(d, "essence_containers", func(d *decode.D) {
+		d.FieldRawLen("essence_container", 16*8, ulNames)
+	})
+}
+
+func decodePrimerPack(d *decode.D, s *mxfState) {
+	fieldBatch(d, "local_tags", func(d *decode.D) {
+		d.FieldStruct("local_tag", func(d *decode.D) {
+			tag := d.FieldU16("local_tag", scalar.ActualHex)
+			ul := d.PeekBytes(16)
+			d.FieldRawLen("ul", 16*8, ulNames)
+			s.primer[tag] = ul
+		})
+	})
+}
+
+func decodeRandomIndexPack(d *decode.D) {
+	d.FieldStructArrayLoop("partitions", "partition", func() bool { return d.BitsLeft() >= 12*8 }, func(d *decode.D) {
+		d.FieldU32("body_sid")
+		d.FieldU64("byte_offset")
+	})
+	d.FieldU32("overall_length")
+}
+
+func tagMapper(s *mxfState) scalar.Mapper {
+	return scalar.Fn(func(sc scalar.S) (scalar.S, error) {
+		t := sc.ActualU()
+		if lt, ok := localTags[t]; ok {
+			sc.Sym = lt.name
+		} else if ul, ok := s.primer[t]; ok {
+			sc.Description = ulSym(ul)
+		}
+		return sc, nil
+	})
+}
+
+type indexLayout struct {
+	sliceCount    uint64
+	posTableCount uint64
+}
+
+var tagTypeSizes = map[int]int64{
+	tagTypeUUID:      16,
+	tagTypeUL:        16,
+	tagTypeUMID:      32,
+	tagTypeU8:        1,
+	tagTypeU16:       2,
+	tagTypeU32:       4,
+	tagTypeU64:       8,
+	tagTypeS8:        1,
+	tagTypeS32:       4,
+	tagTypeS64:       8,
+	tagTypeBool:      1,
+	tagTypeRational:  8,
+	tagTypeTimestamp: 8,
+	tagTypeVersion:   10,
+}
+
+// returns value for unsigned integer types
+func decodeTagValue(d *decode.D, typ int, length int64, l *indexLayout) uint64 {
+	if n, ok := tagTypeSizes[typ]; ok && n != length {
+		d.FieldRawLen("value", length*8)
+		return 0
+	}
+
+	switch typ {
+	case tagTypeUUID:
+		d.FieldRawLen("value", 16*8, scalar.RawUUID)
+	case tagTypeUL:
+		d.FieldRawLen("value", 16*8, ulNames)
+	case tagTypeUMID:
+		d.FieldRawLen("value", 32*8, scalar.RawHex)
+	case tagTypeU8:
+		return d.FieldU8("value")
+	case tagTypeU16:
+		return d.FieldU16("value")
+	case tagTypeU32:
+		return d.FieldU32("value")
+	case tagTypeU64:
+		return d.FieldU64("value")
+	case tagTypeS8:
+		d.FieldS8("value")
+	case tagTypeS32:
+		d.FieldS32("value")
+	case tagTypeS64:
+		d.FieldS64("value")
+	case tagTypeBool:
+		d.FieldU8("value", scalar.UToSymBool{0: false, 1: true})
+	case tagTypeRational:
+		d.FieldStruct("value", decodeRational)
+	case tagTypeTimestamp:
+		d.FieldStruct("value", decodeTimestamp)
+	case tagTypeUTF16:
+		d.FieldUTF16BE("value", int(length), scalar.ActualTrim("\x00"))
+	case tagTypeVersion:
+		d.FieldStruct("value", func(d *decode.D) {
+			d.FieldU16("major")
+			d.FieldU16("minor")
+			d.FieldU16("patch")
+			d.FieldU16("build")
+			d.FieldU16("release")
+		})
+	case tagTypeUUIDBatch:
+		fieldBatch(d, "value", func(d *decode.D) {
+			d.FieldRawLen("uuid", 16*8, scalar.RawUUID)
+		})
+	case tagTypeULBatch:
+		fieldBatch(d, "value", func(d *decode.D) {
+			d.FieldRawLen("ul", 16*8, ulNames)
+		})
+	case tagTypeDeltaEntryArray:
+		fieldBatch(d, "value", func(d *decode.D) {
+			d.FieldStruct("delta_entry", func(d *decode.D) {
+				d.FieldS8("pos_table_index")
+				d.FieldU8("slice")
+				d.FieldU32("element_delta")
+			})
+		})
+	case tagTypeIndexEntryArray:
+		fieldBatch(d, "value", func(d *decode.D) {
+			d.FieldStruct("index_entry", func(d *decode.D) {
+				d.FieldS8("temporal_offset")
+				d.FieldS8("key_frame_offset")
+				flags := d.FieldU8("flags", scalar.ActualHex)
+				d.FieldValueBool("random_access", flags&0x80 != 0)
+				d.FieldValueBool("sequence_header", flags&0x40 != 0)
+				d.FieldU64("stream_offset")
+				if l.sliceCount > 0 {
+					d.FieldArray("slice_offsets", func(d *decode.D) {
+						for i := uint64(0); i < l.sliceCount; i++ {
+							d.FieldU32("slice_offset")
+						}
+					})
+				}
+				if l.posTableCount > 0 {
+					d.FieldArray("pos_table", func(d *decode.D) {
+						for i := uint64(0); i < l.posTableCount; i++ {
+							d.FieldStruct("pos_table_entry", decodeRational)
+						}
+					})
+				}
+				if d.BitsLeft() > 0 {
+					d.FieldRawLen("unknown", d.BitsLeft())
+				}
+			})
+		})
+	default:
+		d.FieldRawLen("value", length*8)
+	}
+	return 0
+}
+
+// local set with 2 byte tags and 2 byte lengths
+func decodeLocalSet(d *decode.D, s *mxfState) {
+	var l indexLayout
+	d.FieldStructArrayLoop("items", "item", func() bool { return d.BitsLeft() >= 4*8 }, func(d *decode.D) {
+		tag := d.FieldU16("tag", tagMapper(s), scalar.ActualHex)
+		length := int64(d.FieldU16("length"))
+		if length*8 > d.BitsLeft() {
+			d.Fatalf("item length %d outside set", length)
+		}
+		typ := -1
+		if lt, ok := localTags[tag]; ok && tag < dynamicTagFirst {
+			typ = lt.typ
+		}
+		d.FramedFn(length*8, func(d *decode.D) {
+			v := decodeTagValue(d, typ, length, &l)
+			switch tag {
+			case tagSliceCount:
+				l.sliceCount = v
+			case tagPosTableCount:
+				l.posTableCount = v
+			}
+			if d.BitsLeft() > 0 {
+				d.FieldRawLen("unknown", d.BitsLeft())
+			}
+		})
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+}
+
+func decodePacket(d *decode.D, s *mxfState) {
+	key := d.PeekBytes(16)
+	d.FieldRawLen("key", 16*8, ulNames)
+	if ulMatch(key, ulEssenceElement) {
+		d.FieldValueU("track_number", uint64(binary.BigEndian.Uint32(key[12:16])), scalar.ActualHex)
+	}
+	length := d.FieldUFn("length", berLength)
+	if length > uint64(d.BitsLeft()/8) {
+		d.Fatalf("length %d outside buffer", length)
+	}
+
+	d.FramedFn(int64(length)*8, func(d *decode.D) {
+		switch {
+		case ulMatch(key, ulPrimerPack):
+			d.FieldStruct("value", func(d *decode.D) { decodePrimerPack(d, s) })
+		case ulMatch(key, ulRandomIndexPack):
+			d.FieldStruct("value", decodeRandomIndexPack)
+		case ulMatch(key, ulPartitionPack):
+			d.FieldStruct("value", decodePartitionPack)
+		case ulMatch(key, ulIndexTableSegment),
+			ulMatch(key, ulMetadataSet):
+			d.FieldStruct("value", func(d *decode.D) { decodeLocalSet(d, s) })
+		default:
+			d.FieldRawLen("value", d.BitsLeft())
+		}
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("unknown", d.BitsLeft())
+		}
+	})
+}
+
+func mxfDecode(d *decode.D, _ any) any {
+	if d.BitsLeft() < 16*8 || !ulMatch(d.PeekBytes(16), ulPartitionPack) || d.PeekBytes(16)[13] != 0x02 {
+		d.Fatalf("no header partition pack found")
+	}
+
+	s := &mxfState{primer: map[uint64][]byte{}}
+	d.FieldStructArrayLoop("packets", "packet", func() bool {
+		return d.BitsLeft() >= 17*8 && bytes.Equal(d.PeekBytes(4), ulPartitionPack[0:4])
+	}, func(d *decode.D) {
+		decodePacket(d, s)
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("trailing", d.BitsLeft())
+	}
+
+	return nil
+}
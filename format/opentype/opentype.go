@@ -0,0 +1,243 @@
+package opentype
+
+// https://learn.microsoft.com/en-us/typography/opentype/spec/otff
+// https://developer.apple.com/fonts/TrueType-Reference-Manual/
+// https://adobe-type-tools.github.io/font-tech-notes/pdfs/5176.CFF.pdf
+
+// TODO: hdmx, kern, GSUB, GPOS etc
+// TODO: glyph outline flags and coordinates
+
+import (
+	"embed"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed opentype.jq
+var opentypeFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.OPENTYPE,
+		Description: "OpenType and TrueType font or font collection",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    opentypeDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(opentypeFS)
+}
+
+const (
+	sfntVersionTrueType      = 0x00010000
+	sfntVersionCFF           = 0x4f54544f // OTTO
+	sfntVersionAppleTrueType = 0x74727565 // true
+	sfntVersionType1         = 0x74797031 // typ1
+	collectionTag            = 0x74746366 // ttcf
+)
+
+var sfntVersionNames = scalar.UToSymStr{
+	sfntVersionTrueType:      "truetype",
+	sfntVersionCFF:           "cff",
+	sfntVersionAppleTrueType: "apple_truetype",
+	sfntVersionType1:         "type1",
+}
+
+const headMagic = 0x5f0f3cf5
+
+// state from other tables that is needed to decode a table
+type fontContext struct {
+	numGlyphs        int
+	numberOfHMetrics int
+	indexToLocFormat int64
+	locaOffsets      []int64
+}
+
+type tableRecord struct {
+	tag    string
+	offset int64
+	length int64
+}
+
+func opentypeDecode(d *decode.D, _ any) any {
+	if d.PeekBits(32) == collectionTag {
+		decodeCollection(d)
+	} else {
+		decodeFont(d, map[int64]bool{})
+	}
+
+	return nil
+}
+
+// TrueType collection, fonts can share tables
+func decodeCollection(d *decode.D) {
+	d.FieldUTF8("tag", 4, d.AssertStr("ttcf"))
+	majorVersion := d.FieldU16("major_version", d.AssertU(1, 2))
+	d.FieldU16("minor_version")
+	numFonts := d.FieldU32("num_fonts")
+	if numFonts == 0 {
+		d.Fatalf("no fonts")
+	}
+	var fontOffsets []int64
+	d.FieldArray("table_directory_offsets", func(d *decode.D) {
+		for i := uint64(0); i < numFonts; i++ {
+			offset := int64(d.FieldU32("offset"))
+			if offset*8 >= d.Len() {
+				d.Fatalf("font %d offset outside buffer", i)
+			}
+			fontOffsets = append(fontOffsets, offset)
+		}
+	})
+	if majorVersion == 2 {
+		d.FieldUTF8("dsig_tag", 4)
+		d.FieldU32("dsig_length")
+		d.FieldU32("dsig_offset")
+	}
+
+	// shared tables are only decoded for first font that use them
+	seenTables := map[int64]bool{}
+	d.FieldArray("fonts", func(d *decode.D) {
+		for _, offset := range fontOffsets {
+			d.RangeFn(offset*8, d.Len()-offset*8, func(d *decode.D) {
+				d.FieldStruct("font", func(d *decode.D) {
+					decodeFont(d, seenTables)
+				})
+			})
+		}
+	})
+}
+
+// checksum is sum of big endian uint32:s, zero padded to 4 bytes
+func tableChecksum(d *decode.D, r tableRecord) uint64 {
+	var b []byte
+	d.SeekAbs(r.offset*8, func(d *decode.D) { b = d.BytesLen(int(r.length)) })
+	if r.tag == "head" && len(b) >= 12 {
+		// checksum_adjustment is calculated with checksum_adjustment as zero
+		copy(b[8:12], []byte{0, 0, 0, 0})
+	}
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	var sum uint32
+	for i := 0; i < len(b); i += 4 {
+		sum += binary.BigEndian.Uint32(b[i:])
+	}
+	return uint64(sum)
+}
+
+func peekU(d *decode.D, pos int64, nBits int) uint64 {
+	var v uint64
+	d.SeekAbs(pos, func(d *decode.D) { v = d.U(nBits) })
+	return v
+}
+
+// tags are printable ASCII
+var tagMapper = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	for _, c := range s.ActualStr() {
+		if c < 0x20 || c > 0x7e {
+			return s, errors.New("invalid tag")
+		}
+	}
+	return s, nil
+})
+
+func decodeFont(d *decode.D, seenTables map[int64]bool) {
+	d.FieldU32("sfnt_version", sfntVersionNames, scalar.ActualHex, d.AssertU(
+		sfntVersionTrueType,
+		sfntVersionCFF,
+		sfntVersionAppleTrueType,
+		sfntVersionType1,
+	))
+	numTables := d.FieldU16("num_tables")
+	if numTables == 0 {
+		d.Fatalf("no tables")
+	}
+	d.FieldU16("search_range")
+	d.FieldU16("entry_selector")
+	d.FieldU16("range_shift")
+
+	var records []tableRecord
+	recordsByTag := map[string]tableRecord{}
+	var i uint64
+	d.FieldStructArrayLoop("table_records", "table_record", func() bool { return i < numTables }, func(d *decode.D) {
+		tag := d.FieldUTF8("tag", 4, tagMapper)
+		r := tableRecord{
+			tag:    tag,
+			offset: int64(peekU(d, d.Pos()+32, 32)),
+			length: int64(peekU(d, d.Pos()+64, 32)),
+		}
+		if (r.offset+r.length)*8 > d.Len() {
+			d.Fatalf("table %q outside buffer", tag)
+		}
+		d.FieldU32("checksum", d.ValidateU(tableChecksum(d, r)), scalar.ActualHex)
+		d.FieldU32("offset")
+		d.FieldU32("length")
+		records = append(records, r)
+		i++
+		if _, ok := recordsByTag[tag]; !ok {
+			recordsByTag[tag] = r
+		}
+	})
+
+	// tables are usually sorted by tag so read what is needed by other tables first
+	var ctx fontContext
+	if r, ok := recordsByTag["maxp"]; ok && r.length >= 6 {
+		ctx.numGlyphs = int(peekU(d, (r.offset+4)*8, 16))
+	}
+	if r, ok := recordsByTag["hhea"]; ok && r.length >= 36 {
+		ctx.numberOfHMetrics = int(peekU(d, (r.offset+34)*8, 16))
+	}
+	if r, ok := recordsByTag["head"]; ok && r.length >= 54 {
+		ctx.indexToLocFormat = int64(int16(peekU(d, (r.offset+50)*8, 16)))
+	}
+	if r, ok := recordsByTag["loca"]; ok && ctx.numGlyphs > 0 {
+		entrySize := int64(2)
+		if ctx.indexToLocFormat == 1 {
+			entrySize = 4
+		}
+		n := int64(ctx.numGlyphs + 1)
+		if n*entrySize <= r.length {
+			for i := int64(0); i < n; i++ {
+				v := int64(peekU(d, (r.offset+i*entrySize)*8, int(entrySize*8)))
+				if entrySize == 2 {
+					v *= 2
+				}
+				ctx.locaOffsets = append(ctx.locaOffsets, v)
+			}
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool { return records[i].offset < records[j].offset })
+
+	d.FieldStruct("tables", func(d *decode.D) {
+		seenTags := map[string]bool{}
+		for _, r := range records {
+			if seenTables[r.offset] || seenTags[r.tag] {
+				continue
+			}
+			seenTables[r.offset] = true
+			seenTags[r.tag] = true
+
+			name := strings.TrimRight(r.tag, " ")
+			if name == "" {
+				name = r.tag
+			}
+			d.RangeFn(r.offset*8, r.length*8, func(d *decode.D) {
+				d.FieldStruct(name, func(d *decode.D) {
+					fn, ok := tableFns[r.tag]
+					if !ok {
+						d.FieldRawLen("data", d.BitsLeft())
+						return
+					}
+					fn(d, &ctx)
+				})
+			})
+		}
+	})
+}
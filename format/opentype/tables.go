@@ -0,0 +1,701 @@
+package opentype
+
+import (
+	"time"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+	"golang.org/x/text/encoding/charmap"
+)
+
+var tableFns map[string]func(d *decode.D, ctx *fontContext)
+
+func init() {
+	tableFns = map[string]func(d *decode.D, ctx *fontContext){
+		"head": decodeHead,
+		"hhea": decodeHhea,
+		"maxp": decodeMaxp,
+		"hmtx": decodeHmtx,
+		"loca": decodeLoca,
+		"glyf": decodeGlyf,
+		"name": decodeName,
+		"cmap": decodeCmap,
+		"OS/2": decodeOS2,
+		"post": decodePost,
+		"CFF ": decodeCFF,
+		"CFF2": decodeCFF2,
+	}
+}
+
+// LONGDATETIME seconds since January 1, 1904 UTC
+var longDateTimeEpoch = scalar.DescriptionActualUTime(time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC), time.RFC3339)
+
+var indexToLocFormatNames = scalar.SToSymStr{
+	0: "short",
+	1: "long",
+}
+
+func decodeHead(d *decode.D, _ *fontContext) {
+	d.FieldU16("major_version")
+	d.FieldU16("minor_version")
+	d.FieldFP32("font_revision")
+	d.FieldU32("checksum_adjustment", scalar.ActualHex)
+	d.FieldU32("magic_number", d.AssertU(headMagic), scalar.ActualHex)
+	d.FieldU16("flags", scalar.ActualHex)
+	d.FieldU16("units_per_em")
+	d.FieldU64("created", longDateTimeEpoch)
+	d.FieldU64("modified", longDateTimeEpoch)
+	d.FieldS16("x_min")
+	d.FieldS16("y_min")
+	d.FieldS16("x_max")
+	d.FieldS16("y_max")
+	d.FieldStruct("mac_style", func(d *decode.D) {
+		d.FieldU9("reserved")
+		d.FieldBool("extended")
+		d.FieldBool("condensed")
+		d.FieldBool("shadow")
+		d.FieldBool("outline")
+		d.FieldBool("underline")
+		d.FieldBool("italic")
+		d.FieldBool("bold")
+	})
+	d.FieldU16("lowest_rec_ppem")
+	d.FieldS16("font_direction_hint")
+	d.FieldS16("index_to_loc_format", indexToLocFormatNames)
+	d.FieldS16("glyph_data_format")
+}
+
+func decodeHhea(d *decode.D, _ *fontContext) {
+	d.FieldU16("major_version")
+	d.FieldU16("minor_version")
+	d.FieldS16("ascender")
+	d.FieldS16("descender")
+	d.FieldS16("line_gap")
+	d.FieldU16("advance_width_max")
+	d.FieldS16("min_left_side_bearing")
+	d.FieldS16("min_right_side_bearing")
+	d.FieldS16("x_max_extent")
+	d.FieldS16("caret_slope_rise")
+	d.FieldS16("caret_slope_run")
+	d.FieldS16("caret_offset")
+	d.FieldRawLen("reserved", 4*16, d.BitBufIsZero())
+	d.FieldS16("metric_data_format")
+	d.FieldU16("number_of_hmetrics")
+}
+
+const (
+	maxpVersion05 = 0x00005000
+	maxpVersion10 = 0x00010000
+)
+
+var maxpVersionNames = scalar.UToSymStr{
+	maxpVersion05: "0.5",
+	maxpVersion10: "1.0",
+}
+
+func decodeMaxp(d *decode.D, _ *fontContext) {
+	version := d.FieldU32("version", maxpVersionNames, scalar.ActualHex)
+	d.FieldU16("num_glyphs")
+	if version != maxpVersion10 {
+		return
+	}
+	d.FieldU16("max_points")
+	d.FieldU16("max_contours")
+	d.FieldU16("max_composite_points")
+	d.FieldU16("max_composite_contours")
+	d.FieldU16("max_zones")
+	d.FieldU16("max_twilight_points")
+	d.FieldU16("max_storage")
+	d.FieldU16("max_function_defs")
+	d.FieldU16("max_instruction_defs")
+	d.FieldU16("max_stack_elements")
+	d.FieldU16("max_size_of_instructions")
+	d.FieldU16("max_component_elements")
+	d.FieldU16("max_component_depth")
+}
+
+func decodeHmtx(d *decode.D, ctx *fontContext) {
+	if ctx.numberOfHMetrics == 0 || int64(ctx.numberOfHMetrics)*32 > d.BitsLeft() {
+		d.FieldRawLen("data", d.BitsLeft())
+		return
+	}
+	d.FieldArray("h_metrics", func(d *decode.D) {
+		for i := 0; i < ctx.numberOfHMetrics; i++ {
+			d.FieldStruct("h_metric", func(d *decode.D) {
+				d.FieldU16("advance_width")
+				d.FieldS16("lsb")
+			})
+		}
+	})
+	if n := ctx.numGlyphs - ctx.numberOfHMetrics; n > 0 && int64(n)*16 <= d.BitsLeft() {
+		d.FieldArray("left_side_bearings", func(d *decode.D) {
+			for i := 0; i < n; i++ {
+				d.FieldS16("lsb")
+			}
+		})
+	}
+}
+
+func decodeLoca(d *decode.D, ctx *fontContext) {
+	if len(ctx.locaOffsets) == 0 {
+		d.FieldRawLen("data", d.BitsLeft())
+		return
+	}
+	d.FieldArray("offsets", func(d *decode.D) {
+		for range ctx.locaOffsets {
+			if ctx.indexToLocFormat == 1 {
+				d.FieldU32("offset")
+			} else {
+				// short offsets are stored divided by two
+				d.FieldUFn("offset", func(d *decode.D) uint64 { return d.U16() * 2 })
+			}
+		}
+	})
+}
+
+func decodeGlyf(d *decode.D, ctx *fontContext) {
+	if len(ctx.locaOffsets) == 0 {
+		d.FieldRawLen("data", d.BitsLeft())
+		return
+	}
+	tableStart := d.Pos()
+	tableLen := d.BitsLeft()
+	// empty glyphs has no data so glyph_id is glyph index
+	d.FieldArray("glyphs", func(d *decode.D) {
+		for i := 0; i < len(ctx.locaOffsets)-1; i++ {
+			start := ctx.locaOffsets[i] * 8
+			stop := ctx.locaOffsets[i+1] * 8
+			if stop <= start || stop > tableLen {
+				continue
+			}
+			d.RangeFn(tableStart+start, stop-start, func(d *decode.D) {
+				d.FieldStruct("glyph", func(d *decode.D) {
+					d.FieldValueU("glyph_id", uint64(i))
+					decodeGlyph(d)
+				})
+			})
+		}
+	})
+}
+
+const (
+	glyphArgsAreWords     = 0x0001
+	glyphArgsAreXYValues  = 0x0002
+	glyphHaveScale        = 0x0008
+	glyphMoreComponents   = 0x0020
+	glyphHaveXAndYScale   = 0x0040
+	glyphHaveTwoByTwo     = 0x0080
+	glyphHaveInstructions = 0x0100
+)
+
+// F2DOT14 signed 2.14 fixed point
+const f2Dot14FractionBits = 14
+
+func decodeGlyph(d *decode.D) {
+	numberOfContours := d.FieldS16("number_of_contours")
+	d.FieldS16("x_min")
+	d.FieldS16("y_min")
+	d.FieldS16("x_max")
+	d.FieldS16("y_max")
+
+	if numberOfContours >= 0 {
+		d.FieldArray("end_pts_of_contours", func(d *decode.D) {
+			for i := int64(0); i < numberOfContours; i++ {
+				d.FieldU16("end_pt")
+			}
+		})
+		instructionLength := d.FieldU16("instruction_length")
+		d.FieldRawLen("instructions", int64(instructionLength)*8)
+		d.FieldRawLen("data", d.BitsLeft())
+		return
+	}
+
+	haveInstructions := false
+	d.FieldArray("components", func(d *decode.D) {
+		for {
+			var flags uint64
+			d.FieldStruct("component", func(d *decode.D) {
+				flags = d.PeekBits(16)
+				d.FieldStruct("flags", func(d *decode.D) {
+					d.FieldU3("reserved0")
+					d.FieldBool("unscaled_component_offset")
+					d.FieldBool("scaled_component_offset")
+					d.FieldBool("overlap_compound")
+					d.FieldBool("use_my_metrics")
+					d.FieldBool("we_have_instructions")
+					d.FieldBool("we_have_a_two_by_two")
+					d.FieldBool("we_have_an_x_and_y_scale")
+					d.FieldBool("more_components")
+					d.FieldU1("reserved1")
+					d.FieldBool("we_have_a_scale")
+					d.FieldBool("round_xy_to_grid")
+					d.FieldBool("args_are_xy_values")
+					d.FieldBool("arg_1_and_2_are_words")
+				})
+				d.FieldU16("glyph_index")
+				switch {
+				case flags&glyphArgsAreWords != 0 && flags&glyphArgsAreXYValues != 0:
+					d.FieldS16("argument1")
+					d.FieldS16("argument2")
+				case flags&glyphArgsAreWords != 0:
+					d.FieldU16("argument1")
+					d.FieldU16("argument2")
+				case flags&glyphArgsAreXYValues != 0:
+					d.FieldS8("argument1")
+					d.FieldS8("argument2")
+				default:
+					d.FieldU8("argument1")
+					d.FieldU8("argument2")
+				}
+				switch {
+				case flags&glyphHaveScale != 0:
+					d.FieldFP("scale", 16, f2Dot14FractionBits)
+				case flags&glyphHaveXAndYScale != 0:
+					d.FieldFP("x_scale", 16, f2Dot14FractionBits)
+					d.FieldFP("y_scale", 16, f2Dot14FractionBits)
+				case flags&glyphHaveTwoByTwo != 0:
+					d.FieldFP("x_scale", 16, f2Dot14FractionBits)
+					d.FieldFP("scale01", 16, f2Dot14FractionBits)
+					d.FieldFP("scale10", 16, f2Dot14FractionBits)
+					d.FieldFP("y_scale", 16, f2Dot14FractionBits)
+				}
+			})
+			if flags&glyphHaveInstructions != 0 {
+				haveInstructions = true
+			}
+			if flags&glyphMoreComponents == 0 {
+				break
+			}
+		}
+	})
+	if haveInstructions {
+		instructionLength := d.FieldU16("instruction_length")
+		d.FieldRawLen("instructions", int64(instructionLength)*8)
+	}
+}
+
+const (
+	platformUnicode   = 0
+	platformMacintosh = 1
+	platformISO       = 2
+	platformWindows   = 3
+	platformCustom    = 4
+)
+
+var platformNames = scalar.UToSymStr{
+	platformUnicode:   "unicode",
+	platformMacintosh: "macintosh",
+	platformISO:       "iso",
+	platformWindows:   "windows",
+	platformCustom:    "custom",
+}
+
+var nameIDNames = scalar.UToSymStr{
+	0:  "copyright",
+	1:  "font_family",
+	2:  "font_subfamily",
+	3:  "unique_id",
+	4:  "full_name",
+	5:  "version",
+	6:  "postscript_name",
+	7:  "trademark",
+	8:  "manufacturer",
+	9:  "designer",
+	10: "description",
+	11: "vendor_url",
+	12: "designer_url",
+	13: "license",
+	14: "license_url",
+	16: "typographic_family",
+	17: "typographic_subfamily",
+	18: "compatible_full",
+	19: "sample_text",
+	20: "postscript_cid",
+	21: "wws_family",
+	22: "wws_subfamily",
+	23: "light_background_palette",
+	24: "dark_background_palette",
+	25: "variations_postscript_name_prefix",
+}
+
+func decodeName(d *decode.D, _ *fontContext) {
+	tableStart := d.Pos()
+	tableLen := d.BitsLeft()
+	version := d.FieldU16("version")
+	count := d.FieldU16("count")
+	storageOffset := int64(d.FieldU16("storage_offset"))
+
+	// string value is decoded as part of the record
+	stringFn := func(d *decode.D, offset int64, length int64, fn func(d *decode.D)) {
+		start := (storageOffset + offset) * 8
+		if start+length*8 > tableLen {
+			return
+		}
+		d.RangeFn(tableStart+start, length*8, fn)
+	}
+
+	d.FieldArray("name_records", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("name_record", func(d *decode.D) {
+				platformID := d.FieldU16("platform_id", platformNames)
+				encodingID := d.FieldU16("encoding_id")
+				d.FieldU16("language_id", scalar.ActualHex)
+				d.FieldU16("name_id", nameIDNames)
+				length := int64(d.FieldU16("length"))
+				offset := int64(d.FieldU16("offset"))
+				stringFn(d, offset, length, func(d *decode.D) {
+					switch {
+					case platformID == platformUnicode,
+						platformID == platformWindows:
+						d.FieldUTF16BE("value", int(length))
+					case platformID == platformMacintosh && encodingID == 0:
+						d.FieldStrFn("value", func(d *decode.D) string {
+							s, _ := charmap.Macintosh.NewDecoder().String(string(d.BytesLen(int(length))))
+							return s
+						})
+					default:
+						d.FieldRawLen("value", length*8)
+					}
+				})
+			})
+		}
+	})
+
+	if version < 1 {
+		return
+	}
+	langTagCount := d.FieldU16("lang_tag_count")
+	d.FieldArray("lang_tag_records", func(d *decode.D) {
+		for i := uint64(0); i < langTagCount; i++ {
+			d.FieldStruct("lang_tag_record", func(d *decode.D) {
+				length := int64(d.FieldU16("length"))
+				offset := int64(d.FieldU16("offset"))
+				stringFn(d, offset, length, func(d *decode.D) {
+					d.FieldUTF16BE("value", int(length))
+				})
+			})
+		}
+	})
+}
+
+// subtables can be shared by encoding records
+func decodeCmap(d *decode.D, _ *fontContext) {
+	tableStart := d.Pos()
+	tableLen := d.BitsLeft()
+	d.FieldU16("version")
+	numTables := d.FieldU16("num_tables")
+
+	subtableOffsets := map[int64]bool{}
+	var sortedOffsets []int64
+	d.FieldArray("encoding_records", func(d *decode.D) {
+		for i := uint64(0); i < numTables; i++ {
+			d.FieldStruct("encoding_record", func(d *decode.D) {
+				d.FieldU16("platform_id", platformNames)
+				d.FieldU16("encoding_id")
+				offset := int64(d.FieldU32("subtable_offset"))
+				if !subtableOffsets[offset] {
+					subtableOffsets[offset] = true
+					sortedOffsets = append(sortedOffsets, offset)
+				}
+			})
+		}
+	})
+
+	d.FieldArray("subtables", func(d *decode.D) {
+		for _, offset := range sortedOffsets {
+			start := offset * 8
+			if start+16 > tableLen {
+				continue
+			}
+			var length int64
+			switch peekU(d, tableStart+start, 16) {
+			case 8, 10, 12, 13:
+				if start+64 <= tableLen {
+					length = int64(peekU(d, tableStart+start+32, 32))
+				}
+			case 14:
+				if start+48 <= tableLen {
+					length = int64(peekU(d, tableStart+start+16, 32))
+				}
+			default:
+				if start+32 <= tableLen {
+					length = int64(peekU(d, tableStart+start+16, 16))
+				}
+			}
+			if length == 0 || start+length*8 > tableLen {
+				continue
+			}
+
+			d.RangeFn(tableStart+start, length*8, func(d *decode.D) {
+				d.FieldStruct("subtable", func(d *decode.D) {
+					d.FieldValueU("offset", uint64(offset))
+					decodeCmapSubtable(d)
+				})
+			})
+		}
+	})
+}
+
+func decodeCmapSubtable(d *decode.D) {
+	u16Array := func(name string, elmName string, n uint64) {
+		d.FieldArray(name, func(d *decode.D) {
+			for i := uint64(0); i < n; i++ {
+				d.FieldU16(elmName)
+			}
+		})
+	}
+	groups := func(glyphName string) {
+		numGroups := d.FieldU32("num_groups")
+		d.FieldArray("groups", func(d *decode.D) {
+			for i := uint64(0); i < numGroups; i++ {
+				d.FieldStruct("group", func(d *decode.D) {
+					d.FieldU32("start_char_code")
+					d.FieldU32("end_char_code")
+					d.FieldU32(glyphName)
+				})
+			}
+		})
+	}
+
+	switch d.FieldU16("format") {
+	case 0:
+		d.FieldU16("length")
+		d.FieldU16("language")
+		d.FieldArray("glyph_id_array", func(d *decode.D) {
+			for i := 0; i < 256; i++ {
+				d.FieldU8("glyph_id")
+			}
+		})
+	case 4:
+		d.FieldU16("length")
+		d.FieldU16("language")
+		segCount := d.FieldU16("seg_count_x2") / 2
+		d.FieldU16("search_range")
+		d.FieldU16("entry_selector")
+		d.FieldU16("range_shift")
+		u16Array("end_codes", "end_code", segCount)
+		d.FieldU16("reserved_pad")
+		u16Array("start_codes", "start_code", segCount)
+		d.FieldArray("id_deltas", func(d *decode.D) {
+			for i := uint64(0); i < segCount; i++ {
+				d.FieldS16("id_delta")
+			}
+		})
+		u16Array("id_range_offsets", "id_range_offset", segCount)
+		u16Array("glyph_id_array", "glyph_id", uint64(d.BitsLeft()/16))
+	case 6:
+		d.FieldU16("length")
+		d.FieldU16("language")
+		d.FieldU16("first_code")
+		entryCount := d.FieldU16("entry_count")
+		u16Array("glyph_id_array", "glyph_id", entryCount)
+	case 8:
+		d.FieldU16("reserved")
+		d.FieldU32("length")
+		d.FieldU32("language")
+		d.FieldRawLen("is32", 8192*8)
+		groups("start_glyph_id")
+	case 10:
+		d.FieldU16("reserved")
+		d.FieldU32("length")
+		d.FieldU32("language")
+		d.FieldU32("start_char_code")
+		numChars := d.FieldU32("num_chars")
+		u16Array("glyph_id_array", "glyph_id", numChars)
+	case 12:
+		d.FieldU16("reserved")
+		d.FieldU32("length")
+		d.FieldU32("language")
+		groups("start_glyph_id")
+	case 13:
+		d.FieldU16("reserved")
+		d.FieldU32("length")
+		d.FieldU32("language")
+		groups("glyph_id")
+	case 14:
+		d.FieldU32("length")
+		numRecords := d.FieldU32("num_var_selector_records")
+		d.FieldArray("var_selector_records", func(d *decode.D) {
+			for i := uint64(0); i < numRecords; i++ {
+				d.FieldStruct("var_selector_record", func(d *decode.D) {
+					d.FieldU24("var_selector", scalar.ActualHex)
+					d.FieldU32("default_uvs_offset")
+					d.FieldU32("non_default_uvs_offset")
+				})
+			}
+		})
+		d.FieldRawLen("data", d.BitsLeft())
+	default:
+		d.FieldU16("length")
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+var weightClassNames = scalar.UToSymStr{
+	100: "thin",
+	200: "extra_light",
+	300: "light",
+	400: "normal",
+	500: "medium",
+	600: "semi_bold",
+	700: "bold",
+	800: "extra_bold",
+	900: "black",
+}
+
+var widthClassNames = scalar.UToSymStr{
+	1: "ultra_condensed",
+	2: "extra_condensed",
+	3: "condensed",
+	4: "semi_condensed",
+	5: "medium",
+	6: "semi_expanded",
+	7: "expanded",
+	8: "extra_expanded",
+	9: "ultra_expanded",
+}
+
+func decodeOS2(d *decode.D, _ *fontContext) {
+	version := d.FieldU16("version")
+	d.FieldS16("x_avg_char_width")
+	d.FieldU16("us_weight_class", weightClassNames)
+	d.FieldU16("us_width_class", widthClassNames)
+	d.FieldU16("fs_type", scalar.ActualHex)
+	d.FieldS16("y_subscript_x_size")
+	d.FieldS16("y_subscript_y_size")
+	d.FieldS16("y_subscript_x_offset")
+	d.FieldS16("y_subscript_y_offset")
+	d.FieldS16("y_superscript_x_size")
+	d.FieldS16("y_superscript_y_size")
+	d.FieldS16("y_superscript_x_offset")
+	d.FieldS16("y_superscript_y_offset")
+	d.FieldS16("y_strikeout_size")
+	d.FieldS16("y_strikeout_position")
+	d.FieldS16("s_family_class")
+	d.FieldStruct("panose", func(d *decode.D) {
+		d.FieldU8("family_type")
+		d.FieldU8("serif_style")
+		d.FieldU8("weight")
+		d.FieldU8("proportion")
+		d.FieldU8("contrast")
+		d.FieldU8("stroke_variation")
+		d.FieldU8("arm_style")
+		d.FieldU8("letterform")
+		d.FieldU8("midline")
+		d.FieldU8("x_height")
+	})
+	d.FieldU32("ul_unicode_range1", scalar.ActualHex)
+	d.FieldU32("ul_unicode_range2", scalar.ActualHex)
+	d.FieldU32("ul_unicode_range3", scalar.ActualHex)
+	d.FieldU32("ul_unicode_range4", scalar.ActualHex)
+	d.FieldUTF8("ach_vend_id", 4)
+	d.FieldStruct("fs_selection", func(d *decode.D) {
+		d.FieldU6("reserved")
+		d.FieldBool("oblique")
+		d.FieldBool("wws")
+		d.FieldBool("use_typo_metrics")
+		d.FieldBool("regular")
+		d.FieldBool("bold")
+		d.FieldBool("strikeout")
+		d.FieldBool("outlined")
+		d.FieldBool("negative")
+		d.FieldBool("underscore")
+		d.FieldBool("italic")
+	})
+	d.FieldU16("us_first_char_index")
+	d.FieldU16("us_last_char_index")
+	// version 0 from apple can end here
+	if d.BitsLeft() == 0 {
+		return
+	}
+	d.FieldS16("s_typo_ascender")
+	d.FieldS16("s_typo_descender")
+	d.FieldS16("s_typo_line_gap")
+	d.FieldU16("us_win_ascent")
+	d.FieldU16("us_win_descent")
+	if version < 1 {
+		return
+	}
+	d.FieldU32("ul_code_page_range1", scalar.ActualHex)
+	d.FieldU32("ul_code_page_range2", scalar.ActualHex)
+	if version < 2 {
+		return
+	}
+	d.FieldS16("s_x_height")
+	d.FieldS16("s_cap_height")
+	d.FieldU16("us_default_char")
+	d.FieldU16("us_break_char")
+	d.FieldU16("us_max_context")
+	if version < 5 {
+		return
+	}
+	d.FieldU16("us_lower_optical_point_size")
+	d.FieldU16("us_upper_optical_point_size")
+}
+
+const (
+	postVersion10 = 0x00010000
+	postVersion20 = 0x00020000
+	postVersion25 = 0x00025000
+	postVersion30 = 0x00030000
+)
+
+var postVersionNames = scalar.UToSymStr{
+	postVersion10: "1.0",
+	postVersion20: "2.0",
+	postVersion25: "2.5",
+	postVersion30: "3.0",
+}
+
+func decodePost(d *decode.D, _ *fontContext) {
+	version := d.FieldU32("version", postVersionNames, scalar.ActualHex)
+	d.FieldFP32("italic_angle")
+	d.FieldS16("underline_position")
+	d.FieldS16("underline_thickness")
+	d.FieldU32("is_fixed_pitch")
+	d.FieldU32("min_mem_type42")
+	d.FieldU32("max_mem_type42")
+	d.FieldU32("min_mem_type1")
+	d.FieldU32("max_mem_type1")
+	if version != postVersion20 {
+		return
+	}
+	numGlyphs := d.FieldU16("num_glyphs")
+	d.FieldArray("glyph_name_index", func(d *decode.D) {
+		for i := uint64(0); i < numGlyphs; i++ {
+			d.FieldU16("index")
+		}
+	})
+	// indexes >= 258 are into this list, lower are standard macintosh glyph names
+	d.FieldArray("names", func(d *decode.D) {
+		for !d.End() {
+			d.FieldUTF8ShortString("name")
+		}
+	})
+}
+
+func decodeCFF(d *decode.D, _ *fontContext) {
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldU8("major")
+		d.FieldU8("minor")
+		hdrSize := d.FieldU8("hdr_size")
+		d.FieldU8("off_size")
+		if hdrSize > 4 {
+			d.FieldRawLen("extra", int64(hdrSize-4)*8)
+		}
+	})
+	d.FieldRawLen("data", d.BitsLeft())
+}
+
+func decodeCFF2(d *decode.D, _ *fontContext) {
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldU8("major_version")
+		d.FieldU8("minor_version")
+		headerSize := d.FieldU8("header_size")
+		d.FieldU16("top_dict_length")
+		if headerSize > 5 {
+			d.FieldRawLen("extra", int64(headerSize-5)*8)
+		}
+	})
+	d.FieldRawLen("data", d.BitsLeft())
+}
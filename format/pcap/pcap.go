@@ -35,11 +35,14 @@ func init() {
 			{Names: []string{format.TCP_STREAM}, Group: &pcapTCPStreamFormat},
 			{Names: []string{format.IPV4_PACKET}, Group: &pcapIPv4PacketFormat},
 		},
-		DecodeFn: decodePcap,
+		DecodeFn:    decodePcap,
+		DecodeInArg: format.PcapIn{},
 	})
 }
 
-func decodePcap(d *decode.D, _ any) any {
+func decodePcap(d *decode.D, in any) any {
+	pi, _ := in.(format.PcapIn)
+
 	endian := d.FieldU32("magic", d.AssertU(bigEndian, littleEndian), endianMap, scalar.ActualHex)
 	switch endian {
 	case bigEndian:
@@ -98,7 +101,7 @@ func decodePcap(d *decode.D, _ any) any {
 	})
 	fd.Flush()
 
-	fieldFlows(d, fd, pcapTCPStreamFormat, pcapIPv4PacketFormat)
+	fieldFlows(d, fd, pcapTCPStreamFormat, pcapIPv4PacketFormat, pi.Keylog)
 
 	return nil
 }
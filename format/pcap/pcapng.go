@@ -28,7 +28,8 @@ func init() {
 			{Names: []string{format.TCP_STREAM}, Group: &pcapngTCPStreamFormat},
 			{Names: []string{format.IPV4_PACKET}, Group: &pcapngIPvPacket4Format},
 		},
-		DecodeFn: decodePcapng,
+		DecodeFn:    decodePcapng,
+		DecodeInArg: format.PcapIn{},
 	})
 }
 
@@ -361,7 +362,9 @@ type decodeContext struct {
 	flowDecoder        *flowsdecoder.Decoder
 }
 
-func decodePcapng(d *decode.D, _ any) any {
+func decodePcapng(d *decode.D, in any) any {
+	pi, _ := in.(format.PcapIn)
+
 	sectionHeaders := 0
 	for !d.End() {
 		fd := flowsdecoder.New()
@@ -373,7 +376,7 @@ func decodePcapng(d *decode.D, _ any) any {
 		d.FieldStruct("section", func(d *decode.D) {
 			decodeSection(d, &dc)
 			fd.Flush()
-			fieldFlows(d, dc.flowDecoder, pcapngTCPStreamFormat, pcapngIPvPacket4Format)
+			fieldFlows(d, dc.flowDecoder, pcapngTCPStreamFormat, pcapngIPvPacket4Format, pi.Keylog)
 		})
 		if dc.sectionHeaderFound {
 			sectionHeaders++
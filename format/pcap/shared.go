@@ -34,7 +34,7 @@ var linkToDecodeFn = map[int]func(fd *flowsdecoder.Decoder, bs []byte) error{
 }
 
 // TODO: make some of this shared if more packet capture formats are added
-func fieldFlows(d *decode.D, fd *flowsdecoder.Decoder, tcpStreamFormat decode.Group, ipv4PacketFormat decode.Group) {
+func fieldFlows(d *decode.D, fd *flowsdecoder.Decoder, tcpStreamFormat decode.Group, ipv4PacketFormat decode.Group, keylog string) {
 	d.FieldArray("ipv4_reassembled", func(d *decode.D) {
 		for _, p := range fd.IPV4Reassembled {
 			br := bitio.NewBitReader(p.Datagram, -1)
@@ -78,6 +78,8 @@ func fieldFlows(d *decode.D, fd *flowsdecoder.Decoder, tcpStreamFormat decode.Gr
 						SkippedBytes:    s.Client.SkippedBytes,
 						SourcePort:      s.Client.Endpoint.Port,
 						DestinationPort: s.Server.Endpoint.Port,
+						PeerStream:      s.Server.Buffer.Bytes(),
+						Keylog:          keylog,
 					})
 				})
 				d.FieldStruct("server", func(d *decode.D) {
@@ -88,6 +90,8 @@ func fieldFlows(d *decode.D, fd *flowsdecoder.Decoder, tcpStreamFormat decode.Gr
 						SkippedBytes:    s.Server.SkippedBytes,
 						SourcePort:      s.Server.Endpoint.Port,
 						DestinationPort: s.Client.Endpoint.Port,
+						PeerStream:      s.Client.Buffer.Bytes(),
+						Keylog:          keylog,
 					})
 				})
 			})
@@ -0,0 +1,302 @@
+package pickle
+
+// https://github.com/python/cpython/blob/main/Lib/pickletools.py
+// https://github.com/python/cpython/blob/main/Lib/pickle.py
+// https://peps.python.org/pep-3154/
+// https://peps.python.org/pep-0574/
+
+import (
+	"embed"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed pickle.jq
+var pickleFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.PICKLE,
+		Description: "Python pickle",
+		DecodeFn:    pickleDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(pickleFS)
+}
+
+const maxProtocol = 5
+
+type argType int
+
+const (
+	argNone argType = iota
+	argUint1
+	argUint2
+	argUint4
+	argUint8
+	argInt4
+	argLong1
+	argLong4
+	argString1
+	argString4
+	argBytes1
+	argBytes4
+	argBytes8
+	argUnicodeString1
+	argUnicodeString4
+	argUnicodeString8
+	argBytearray8
+	argDecimalNLShort
+	argDecimalNLLong
+	argFloatNL
+	argFloat8
+	argStringNL
+	argStringNLNoEscape
+	argStringNLNoEscapePair
+	argUnicodeStringNL
+)
+
+const (
+	opStop    = '.'
+	opPut     = 'p'
+	opBinPut  = 'q'
+	opLongPut = 'r'
+	opProto   = 0x80
+	opMemoize = 0x94
+)
+
+type opcode struct {
+	name string
+	arg  argType
+}
+
+// names as in pickletools but lower case
+var opcodes = map[uint64]opcode{
+	'(':  {"mark", argNone},
+	'.':  {"stop", argNone},
+	'0':  {"pop", argNone},
+	'1':  {"pop_mark", argNone},
+	'2':  {"dup", argNone},
+	'F':  {"float", argFloatNL},
+	'I':  {"int", argDecimalNLShort},
+	'J':  {"binint", argInt4},
+	'K':  {"binint1", argUint1},
+	'L':  {"long", argDecimalNLLong},
+	'M':  {"binint2", argUint2},
+	'N':  {"none", argNone},
+	'P':  {"persid", argStringNLNoEscape},
+	'Q':  {"binpersid", argNone},
+	'R':  {"reduce", argNone},
+	'S':  {"string", argStringNL},
+	'T':  {"binstring", argString4},
+	'U':  {"short_binstring", argString1},
+	'V':  {"unicode", argUnicodeStringNL},
+	'X':  {"binunicode", argUnicodeString4},
+	'a':  {"append", argNone},
+	'b':  {"build", argNone},
+	'c':  {"global", argStringNLNoEscapePair},
+	'd':  {"dict", argNone},
+	'}':  {"empty_dict", argNone},
+	'e':  {"appends", argNone},
+	'g':  {"get", argDecimalNLShort},
+	'h':  {"binget", argUint1},
+	'i':  {"inst", argStringNLNoEscapePair},
+	'j':  {"long_binget", argUint4},
+	'l':  {"list", argNone},
+	']':  {"empty_list", argNone},
+	'o':  {"obj", argNone},
+	'p':  {"put", argDecimalNLShort},
+	'q':  {"binput", argUint1},
+	'r':  {"long_binput", argUint4},
+	's':  {"setitem", argNone},
+	't':  {"tuple", argNone},
+	')':  {"empty_tuple", argNone},
+	'u':  {"setitems", argNone},
+	'G':  {"binfloat", argFloat8},
+	0x80: {"proto", argUint1},
+	0x81: {"newobj", argNone},
+	0x82: {"ext1", argUint1},
+	0x83: {"ext2", argUint2},
+	0x84: {"ext4", argInt4},
+	0x85: {"tuple1", argNone},
+	0x86: {"tuple2", argNone},
+	0x87: {"tuple3", argNone},
+	0x88: {"newtrue", argNone},
+	0x89: {"newfalse", argNone},
+	0x8a: {"long1", argLong1},
+	0x8b: {"long4", argLong4},
+	'B':  {"binbytes", argBytes4},
+	'C':  {"short_binbytes", argBytes1},
+	0x8c: {"short_binunicode", argUnicodeString1},
+	0x8d: {"binunicode8", argUnicodeString8},
+	0x8e: {"binbytes8", argBytes8},
+	0x8f: {"empty_set", argNone},
+	0x90: {"additems", argNone},
+	0x91: {"frozenset", argNone},
+	0x92: {"newobj_ex", argNone},
+	0x93: {"stack_global", argNone},
+	0x94: {"memoize", argNone},
+	0x95: {"frame", argUint8},
+	0x96: {"bytearray8", argBytearray8},
+	0x97: {"next_buffer", argNone},
+	0x98: {"readonly_buffer", argNone},
+}
+
+var opcodeNames = func() scalar.UToSymStr {
+	m := scalar.UToSymStr{}
+	for k, o := range opcodes {
+		m[k] = o.name
+	}
+	return m
+}()
+
+var trimNewline = scalar.ActualStrFn(func(s string) string {
+	return strings.TrimSuffix(s, "\n")
+})
+
+// text line arguments used by protocol 0 and 1, newline is included in field
+func fieldLine(d *decode.D, name string, sms ...scalar.Mapper) string {
+	n := d.PeekFindByte('\n', d.BitsLeft()/8)
+	if n < 0 {
+		d.Fatalf("%s: newline not found", name)
+	}
+	return d.FieldUTF8(name, int(n)+1, append([]scalar.Mapper{trimNewline}, sms...)...)
+}
+
+func fieldLength(d *decode.D, nBits int) int64 {
+	n := d.FieldU("length", nBits)
+	if n > math.MaxInt64/8 || int64(n)*8 > d.BitsLeft() {
+		d.Fatalf("length %d outside input", n)
+	}
+	return int64(n)
+}
+
+func decodeArg(d *decode.D, arg argType) any {
+	switch arg {
+	case argNone:
+		return nil
+	case argUint1:
+		return d.FieldU8("value")
+	case argUint2:
+		return d.FieldU16("value")
+	case argUint4:
+		return d.FieldU32("value")
+	case argUint8:
+		return d.FieldU64("value")
+	case argInt4:
+		return d.FieldS32("value")
+	case argLong1, argLong4:
+		// little endian two's complement
+		nBits := 8
+		if arg == argLong4 {
+			nBits = 32
+		}
+		n := fieldLength(d, nBits)
+		if n == 0 {
+			d.FieldValueS("value", 0)
+			return nil
+		}
+		d.FieldSBigInt("value", int(n)*8)
+	case argString1, argString4:
+		// python 2 str, usually latin1 or ascii
+		nBits := 8
+		if arg == argString4 {
+			nBits = 32
+		}
+		n := fieldLength(d, nBits)
+		return d.FieldUTF8("value", int(n))
+	case argUnicodeString1, argUnicodeString4, argUnicodeString8:
+		nBits := 8
+		switch arg {
+		case argUnicodeString4:
+			nBits = 32
+		case argUnicodeString8:
+			nBits = 64
+		}
+		n := fieldLength(d, nBits)
+		return d.FieldUTF8("value", int(n))
+	case argBytes1, argBytes4, argBytes8, argBytearray8:
+		nBits := 64
+		switch arg {
+		case argBytes1:
+			nBits = 8
+		case argBytes4:
+			nBits = 32
+		}
+		n := fieldLength(d, nBits)
+		d.FieldRawLen("value", n*8)
+	case argDecimalNLShort:
+		// "00" and "01" are used by protocol 0 for False and True
+		return fieldLine(d, "value", scalar.TrySymSParseInt(10))
+	case argDecimalNLLong:
+		// python 2 repr has a "L" suffix
+		return fieldLine(d, "value")
+	case argFloatNL:
+		return fieldLine(d, "value", scalar.TrySymFParseFloat(64))
+	case argFloat8:
+		return d.FieldF64BE("value")
+	case argStringNL, argStringNLNoEscape, argUnicodeStringNL:
+		// repr quoted or raw-unicode-escape encoded string
+		return fieldLine(d, "value")
+	case argStringNLNoEscapePair:
+		fieldLine(d, "module")
+		fieldLine(d, "name")
+	default:
+		d.Fatalf("unknown argument type %d", arg)
+	}
+	return nil
+}
+
+func pickleDecode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	// memo keys seen so far, memoize uses number of keys as index
+	memo := map[uint64]struct{}{}
+	stopped := false
+	d.FieldArray("opcodes", func(d *decode.D) {
+		for !stopped && !d.End() {
+			d.FieldStruct("opcode", func(d *decode.D) {
+				op := d.FieldU8("opcode", opcodeNames)
+				o, ok := opcodes[op]
+				if !ok {
+					d.Fatalf("unknown opcode %d", op)
+				}
+				v := decodeArg(d, o.arg)
+
+				switch op {
+				case opStop:
+					stopped = true
+				case opProto:
+					if p, ok := v.(uint64); ok && p > maxProtocol {
+						d.Fatalf("unsupported protocol %d", p)
+					}
+				case opMemoize:
+					i := uint64(len(memo))
+					d.FieldValueU("memo_index", i)
+					memo[i] = struct{}{}
+				case opBinPut, opLongPut:
+					if i, ok := v.(uint64); ok {
+						memo[i] = struct{}{}
+					}
+				case opPut:
+					if s, ok := v.(string); ok {
+						if i, err := strconv.ParseUint(s, 10, 64); err == nil {
+							memo[i] = struct{}{}
+						}
+					}
+				}
+			})
+		}
+	})
+	if !stopped {
+		d.Fatalf("no stop opcode found")
+	}
+
+	return nil
+}
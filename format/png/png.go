@@ -119,21 +119,14 @@ func pngDecode(d *decode.D, _ any) any {
 			case "zTXt":
 				d.FieldUTF8Null("keyword")
 				compressionMethod := d.FieldU8("compression_method", compressionNames)
-				dataLen := d.BitsLeft()
-
-				// TODO: make nicer
-				d.FieldRawLen("compressed", dataLen)
-				d.SeekRel(-dataLen)
-
-				switch compressionMethod {
-				case compressionDeflate:
-					d.FieldFormatReaderLen("uncompressed", dataLen, zlib.NewReader, decode.FormatFn(func(d *decode.D, _ any) any {
-						d.FieldUTF8("text", int(d.BitsLeft()/8))
-						return nil
-					}))
-				default:
-					d.FieldRawLen("data", dataLen)
-				}
+				pngText(d, true, compressionMethod)
+			case "iTXt":
+				d.FieldUTF8Null("keyword")
+				compressed := d.FieldBoolFn("compression_flag", func(d *decode.D) bool { return d.U8() != 0 })
+				compressionMethod := d.FieldU8("compression_method", compressionNames)
+				d.FieldUTF8Null("language_tag")
+				d.FieldUTF8Null("translated_keyword")
+				pngText(d, compressed, compressionMethod)
 			case "iCCP":
 				d.FieldUTF8Null("profile_name")
 				compressionMethod := d.FieldU8("compression_method", compressionNames)
@@ -230,7 +223,31 @@ func pngDecode(d *decode.D, _ any) any {
 		chunkCRC := crc32.NewIEEE()
 		d.Copy(chunkCRC, bitio.NewIOReader(d.BitBufRange(crcStartPos, d.Pos()-crcStartPos)))
 		d.FieldU32("crc", d.ValidateUBytes(chunkCRC.Sum(nil)), scalar.ActualHex)
+		d.FieldValueRaw("crc_calculated", chunkCRC.Sum(nil), scalar.RawHex)
 	})
 
 	return nil
 }
+
+// rest of zTXt and iTXt chunk is text, zlib compressed or utf8
+func pngText(d *decode.D, compressed bool, compressionMethod uint64) {
+	dataLen := d.BitsLeft()
+	if !compressed {
+		d.FieldUTF8("text", int(dataLen/8))
+		return
+	}
+
+	// TODO: make nicer
+	d.FieldRawLen("compressed", dataLen)
+	d.SeekRel(-dataLen)
+
+	switch compressionMethod {
+	case compressionDeflate:
+		d.FieldFormatReaderLen("uncompressed", dataLen, zlib.NewReader, decode.FormatFn(func(d *decode.D, _ any) any {
+			d.FieldUTF8("text", int(d.BitsLeft()/8))
+			return nil
+		}))
+	default:
+		d.FieldRawLen("data", dataLen)
+	}
+}
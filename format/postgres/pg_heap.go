@@ -0,0 +1,246 @@
+package postgres
+
+// https://www.postgresql.org/docs/current/storage-page-layout.html
+// https://github.com/postgres/postgres/blob/master/src/include/storage/bufpage.h
+// https://github.com/postgres/postgres/blob/master/src/include/storage/itemid.h
+// https://github.com/postgres/postgres/blob/master/src/include/access/htup_details.h
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed pg_heap.jq
+var postgresFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.PG_HEAP,
+		Description: "PostgreSQL heap page",
+		DecodeFn:    heapDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(postgresFS)
+}
+
+const (
+	pageHeaderBytes  = 24
+	linePointerBytes = 4
+	// fixed part of tuple header, offsetof(HeapTupleHeaderData, t_bits)
+	tupleHeaderBytes = 23
+)
+
+const (
+	lpUnused   = 0
+	lpNormal   = 1
+	lpRedirect = 2
+	lpDead     = 3
+)
+
+var lpFlagsNames = scalar.UToSymStr{
+	lpUnused:   "unused",
+	lpNormal:   "normal",
+	lpRedirect: "redirect",
+	lpDead:     "dead",
+}
+
+var transactionIDNames = scalar.UToSymStr{
+	0: "invalid",
+	1: "bootstrap",
+	2: "frozen",
+}
+
+const (
+	heapNattsMask   = 0x07ff
+	heapKeysUpdated = 0x2000
+	heapHotUpdated  = 0x4000
+	heapOnlyTuple   = 0x8000
+)
+
+// page size is stored as upper byte of a 16 bit value
+var pageSizeSym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	s.Sym = s.ActualU() << 8
+	return s, nil
+})
+
+func validPageSize(n uint64) bool {
+	return n >= 1024 && n <= 32768 && n&(n-1) == 0
+}
+
+func decodeInfomask(d *decode.D) bool {
+	var hasNull bool
+	d.FieldStruct("infomask", func(d *decode.D) {
+		// 16 bit little endian flags in byte order
+		d.FieldBool("xmax_lock_only")
+		d.FieldBool("xmax_excl_lock")
+		d.FieldBool("combocid")
+		d.FieldBool("xmax_keyshr_lock")
+		d.FieldBool("hasoid_old")
+		d.FieldBool("hasexternal")
+		d.FieldBool("hasvarwidth")
+		hasNull = d.FieldBool("hasnull")
+
+		d.FieldBool("moved_in")
+		d.FieldBool("moved_off")
+		d.FieldBool("updated")
+		d.FieldBool("xmax_is_multi")
+		d.FieldBool("xmax_invalid")
+		d.FieldBool("xmax_committed")
+		d.FieldBool("xmin_invalid")
+		d.FieldBool("xmin_committed")
+	})
+	return hasNull
+}
+
+func decodeTuple(d *decode.D, lpOff int64, lpLen int64) {
+	if lpLen < tupleHeaderBytes {
+		d.Fatalf("tuple length %d shorter than header", lpLen)
+	}
+	tupleStart := lpOff * 8
+	d.SeekAbs(tupleStart)
+
+	var natts uint64
+	var hasNull bool
+	var hoff uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldU32("xmin", transactionIDNames)
+		d.FieldU32("xmax", transactionIDNames)
+		// cid or xvac for old style vacuum full
+		d.FieldU32("cid")
+		d.FieldStruct("ctid", func(d *decode.D) {
+			blockHi := d.FieldU16("block_hi")
+			blockLo := d.FieldU16("block_lo")
+			d.FieldValueU("block", blockHi<<16|blockLo)
+			d.FieldU16("offset")
+		})
+		// number of attributes and flags share bits so values are split out
+		infomask2 := d.FieldU16("infomask2", scalar.ActualHex)
+		natts = infomask2 & heapNattsMask
+		d.FieldValueU("natts", natts)
+		d.FieldValueBool("keys_updated", infomask2&heapKeysUpdated != 0)
+		d.FieldValueBool("hot_updated", infomask2&heapHotUpdated != 0)
+		d.FieldValueBool("heap_only_tuple", infomask2&heapOnlyTuple != 0)
+		hasNull = decodeInfomask(d)
+		hoff = d.FieldU8("hoff")
+		if int64(hoff) < tupleHeaderBytes || int64(hoff) > lpLen {
+			d.Fatalf("invalid header offset %d", hoff)
+		}
+		if hasNull {
+			bitmapBytes := int64(natts+7) / 8
+			if tupleHeaderBytes+bitmapBytes > int64(hoff) {
+				d.Fatalf("null bitmap outside header")
+			}
+			d.FieldRawLen("null_bitmap", bitmapBytes*8)
+		}
+		if paddingBits := tupleStart + int64(hoff)*8 - d.Pos(); paddingBits > 0 {
+			d.FieldRawLen("padding", paddingBits)
+		}
+	})
+	// attributes can't be decoded without table definition
+	d.FieldRawLen("data", (lpLen-int64(hoff))*8)
+}
+
+func heapDecode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	if d.Len() < pageHeaderBytes*8 {
+		d.Fatalf("too short")
+	}
+
+	var lower, upper, special uint64
+	var pageSize uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldStruct("lsn", func(d *decode.D) {
+			xlogID := d.FieldU32("xlogid")
+			xrecOff := d.FieldU32("xrecoff")
+			d.FieldValueU("lsn", xlogID<<32|xrecOff)
+		})
+		d.FieldU16("checksum", scalar.ActualHex)
+		d.FieldStruct("flags", func(d *decode.D) {
+			// 16 bit little endian flags in byte order
+			d.FieldU5("unused0")
+			d.FieldBool("all_visible")
+			d.FieldBool("page_full")
+			d.FieldBool("has_free_lines")
+			d.FieldU8("unused1")
+		})
+		lower = d.FieldU16("lower")
+		upper = d.FieldU16("upper")
+		special = d.FieldU16("special")
+		d.FieldStruct("pagesize_version", func(d *decode.D) {
+			// 16 bit little endian, version is low byte
+			d.FieldU8("version", d.AssertU(4))
+			pageSize = d.FieldU8("page_size", pageSizeSym) << 8
+		})
+		d.FieldU32("prune_xid", transactionIDNames)
+	})
+
+	switch {
+	case !validPageSize(pageSize):
+		d.Fatalf("invalid page size %d", pageSize)
+	case d.Len() < int64(pageSize)*8:
+		d.Fatalf("shorter than page size %d", pageSize)
+	case lower < pageHeaderBytes || lower > upper || upper > special || special > pageSize:
+		d.Fatalf("invalid lower %d, upper %d and special %d", lower, upper, special)
+	case (lower-pageHeaderBytes)%linePointerBytes != 0:
+		d.Fatalf("line pointer array end %d not aligned", lower)
+	}
+
+	type linePointer struct {
+		off   int64
+		flags uint64
+		len   int64
+	}
+	var lps []linePointer
+	d.FieldArray("line_pointers", func(d *decode.D) {
+		for d.Pos() < int64(lower)*8 {
+			d.FieldStruct("line_pointer", func(d *decode.D) {
+				// bit fields lp_off:15, lp_flags:2, lp_len:15
+				v := d.FieldU32("value", scalar.ActualHex)
+				lp := linePointer{
+					off:   int64(v & 0x7fff),
+					flags: (v >> 15) & 0x3,
+					len:   int64(v >> 17),
+				}
+				d.FieldValueU("item", uint64(len(lps)+1))
+				d.FieldValueU("flags", lp.flags, lpFlagsNames)
+				if lp.flags == lpRedirect {
+					d.FieldValueU("redirect", uint64(lp.off))
+				} else {
+					d.FieldValueU("offset", uint64(lp.off))
+				}
+				d.FieldValueU("length", uint64(lp.len))
+				lps = append(lps, lp)
+			})
+		}
+	})
+
+	d.FieldRawLen("free_space", int64(upper-lower)*8)
+
+	d.FieldArray("tuples", func(d *decode.D) {
+		for i, lp := range lps {
+			// dead line pointers can still have storage
+			if lp.flags == lpRedirect || lp.len == 0 {
+				continue
+			}
+			if lp.off < int64(upper) || lp.off+lp.len > int64(special) {
+				d.Fatalf("item %d at %d length %d outside tuple space", i+1, lp.off, lp.len)
+			}
+			d.FieldStruct("tuple", func(d *decode.D) {
+				d.FieldValueU("item", uint64(i+1))
+				decodeTuple(d, lp.off, lp.len)
+			})
+		}
+	})
+
+	if special < pageSize {
+		d.SeekAbs(int64(special) * 8)
+		d.FieldRawLen("special", int64(pageSize-special)*8)
+	}
+
+	return nil
+}
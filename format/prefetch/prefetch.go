@@ -0,0 +1,369 @@
+package prefetch
+
+// https://github.com/libyal/libscca/blob/main/documentation/Windows%20Prefetch%20File%20(PF)%20format.asciidoc
+
+// TODO: validate MAM checksum
+
+import (
+	"bytes"
+	"embed"
+	"encoding/binary"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed prefetch.jq
+var prefetchFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.PREFETCH,
+		Description: "Windows Prefetch file",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    prefetchDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(prefetchFS)
+}
+
+const (
+	headerBytes          = 84
+	maxUncompressedBytes = 64 * 1024 * 1024
+)
+
+const (
+	versionXP    = 17
+	versionVista = 23
+	version8     = 26
+	version10    = 30
+	version11    = 31
+)
+
+var versionNames = scalar.UToDescription{
+	versionXP:    "Windows XP and 2003",
+	versionVista: "Windows Vista and 7",
+	version8:     "Windows 8.1",
+	version10:    "Windows 10",
+	version11:    "Windows 11",
+}
+
+const compressionFormatXpressHuffman = 4
+
+var compressionFormatNames = scalar.UToSymStr{
+	2:                              "lznt1",
+	3:                              "xpress",
+	compressionFormatXpressHuffman: "xpress_huffman",
+}
+
+// FILETIME, 100ns intervals since 1601-01-01
+const filetimeUnixEpochDiff = 11644473600
+
+var descriptionFiletime = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	v := s.ActualU()
+	if v == 0 {
+		return s, nil
+	}
+	s.Description = time.Unix(int64(v/10_000_000)-filetimeUnixEpochDiff, int64(v%10_000_000)*100).UTC().Format(time.RFC3339)
+	return s, nil
+})
+
+type fileInformation struct {
+	metricsOffset         uint64
+	metricsCount          uint64
+	traceChainsOffset     uint64
+	traceChainsCount      uint64
+	filenameStringsOffset uint64
+	filenameStringsSize   uint64
+	volumesOffset         uint64
+	volumesCount          uint64
+	volumesSize           uint64
+}
+
+func fieldFileReference(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		ref := d.FieldU64("value", scalar.ActualHex)
+		d.FieldValueU("mft_entry", ref&0xffff_ffff_ffff)
+		d.FieldValueU("sequence_number", ref>>48)
+	})
+}
+
+// UTF-16 string at offset in characters
+func rangeUTF16(d *decode.D, pos int64, chars uint64) string {
+	var s string
+	d.RangeFn(pos, int64(chars)*16, func(d *decode.D) {
+		s = d.UTF16LE(int(chars) * 2)
+	})
+	return s
+}
+
+func decodeFileInformation(d *decode.D, version uint64, endPos int64) fileInformation {
+	var fi fileInformation
+	fi.metricsOffset = d.FieldU32("metrics_offset")
+	fi.metricsCount = d.FieldU32("metrics_count")
+	fi.traceChainsOffset = d.FieldU32("trace_chains_offset")
+	fi.traceChainsCount = d.FieldU32("trace_chains_count")
+	fi.filenameStringsOffset = d.FieldU32("filename_strings_offset")
+	fi.filenameStringsSize = d.FieldU32("filename_strings_size")
+	fi.volumesOffset = d.FieldU32("volumes_offset")
+	fi.volumesCount = d.FieldU32("volumes_count")
+	fi.volumesSize = d.FieldU32("volumes_size")
+
+	switch {
+	case version == versionXP:
+		d.FieldU64("last_run_time", descriptionFiletime)
+		d.FieldRawLen("unknown0", 16*8)
+		d.FieldU32("run_count")
+	case version == versionVista:
+		d.FieldRawLen("unknown0", 8*8)
+		d.FieldU64("last_run_time", descriptionFiletime)
+		d.FieldRawLen("unknown1", 16*8)
+		d.FieldU32("run_count")
+	default:
+		d.FieldRawLen("unknown0", 8*8)
+		d.FieldArray("last_run_times", func(d *decode.D) {
+			for i := 0; i < 8; i++ {
+				d.FieldU64("last_run_time", descriptionFiletime)
+			}
+		})
+		// some windows 10 versions have a shorter file information without 8 unknown bytes
+		if version >= version10 && fi.metricsOffset == 0x128 {
+			d.FieldRawLen("unknown1", 8*8)
+		} else {
+			d.FieldRawLen("unknown1", 16*8)
+		}
+		d.FieldU32("run_count")
+	}
+	if d.Pos() < endPos {
+		d.FieldRawLen("unknown", endPos-d.Pos())
+	}
+
+	return fi
+}
+
+// seeks to section and makes sure it is inside file
+func seekSection(d *decode.D, name string, offset uint64, size uint64) {
+	if offset < headerBytes || int64(offset+size)*8 > d.Len() {
+		d.Fatalf("%s offset %d size %d outside file", name, offset, size)
+	}
+	d.SeekAbs(int64(offset) * 8)
+}
+
+func decodeMetrics(d *decode.D, version uint64, fi fileInformation) {
+	entryBytes := uint64(20)
+	if version >= versionVista {
+		entryBytes = 32
+	}
+	seekSection(d, "metrics", fi.metricsOffset, fi.metricsCount*entryBytes)
+
+	d.FieldArray("metrics", func(d *decode.D) {
+		for i := uint64(0); i < fi.metricsCount; i++ {
+			d.FieldStruct("metric", func(d *decode.D) {
+				d.FieldU32("trace_chain_index")
+				d.FieldU32("trace_chains_count")
+				if version >= versionVista {
+					d.FieldU32("prefetched_blocks_count")
+				}
+				filenameOffset := d.FieldU32("filename_offset")
+				filenameChars := d.FieldU32("filename_chars")
+				d.FieldU32("flags", scalar.ActualHex)
+				if version >= versionVista {
+					fieldFileReference(d, "file_reference")
+				}
+				if filenameOffset+filenameChars*2 <= fi.filenameStringsSize {
+					d.FieldValueStr("filename", rangeUTF16(d, int64(fi.filenameStringsOffset+filenameOffset)*8, filenameChars))
+				}
+			})
+		}
+	})
+}
+
+func decodeTraceChains(d *decode.D, version uint64, fi fileInformation) {
+	entryBytes := uint64(12)
+	if version >= version10 {
+		entryBytes = 8
+	}
+	seekSection(d, "trace chains", fi.traceChainsOffset, fi.traceChainsCount*entryBytes)
+
+	d.FieldArray("trace_chains", func(d *decode.D) {
+		for i := uint64(0); i < fi.traceChainsCount; i++ {
+			d.FieldStruct("trace_chain", func(d *decode.D) {
+				if version < version10 {
+					d.FieldU32("next_index", scalar.UToSymStr{0xffff_ffff: "end"})
+				}
+				d.FieldU32("total_block_load_count")
+				d.FieldU8("unknown0")
+				d.FieldU8("sample_duration")
+				d.FieldU16("unknown1")
+			})
+		}
+	})
+}
+
+func decodeFilenameStrings(d *decode.D, fi fileInformation) {
+	seekSection(d, "filename strings", fi.filenameStringsOffset, fi.filenameStringsSize)
+
+	endPos := int64(fi.filenameStringsOffset+fi.filenameStringsSize) * 8
+	d.FieldArray("filename_strings", func(d *decode.D) {
+		for d.Pos() < endPos-16 {
+			d.FieldUTF16LENull("filename")
+		}
+	})
+	if d.Pos() < endPos {
+		d.FieldRawLen("filename_strings_padding", endPos-d.Pos())
+	}
+}
+
+func decodeVolume(d *decode.D, version uint64, volumesPos int64, endPos int64) {
+	devicePathOffset := d.FieldU32("device_path_offset")
+	devicePathChars := d.FieldU32("device_path_chars")
+	d.FieldU64("creation_time", descriptionFiletime)
+	d.FieldU32("serial_number", scalar.ActualHex)
+	fileReferencesOffset := d.FieldU32("file_references_offset")
+	fileReferencesSize := d.FieldU32("file_references_size")
+	directoryStringsOffset := d.FieldU32("directory_strings_offset")
+	directoryStringsCount := d.FieldU32("directory_strings_count")
+	d.FieldU32("unknown0")
+	if d.Pos() < endPos {
+		d.FieldRawLen("unknown1", endPos-d.Pos())
+	}
+
+	d.FieldValueStr("device_path", rangeUTF16(d, volumesPos+int64(devicePathOffset)*8, devicePathChars))
+
+	if fileReferencesOffset != 0 && fileReferencesSize >= 8 {
+		refsPos := volumesPos + int64(fileReferencesOffset)*8
+		refsEndPos := refsPos + int64(fileReferencesSize)*8
+		d.SeekAbs(refsPos)
+		d.FieldStruct("file_references", func(d *decode.D) {
+			d.FieldU32("version")
+			count := d.FieldU32("count")
+			// vista and later has 8 unknown bytes before entries
+			if version >= versionVista && refsEndPos-d.Pos() >= 8*8 {
+				d.FieldRawLen("unknown0", 8*8)
+			}
+			d.FieldArray("entries", func(d *decode.D) {
+				for i := uint64(0); i < count && refsEndPos-d.Pos() >= 64; i++ {
+					fieldFileReference(d, "entry")
+				}
+			})
+			if d.Pos() < refsEndPos {
+				d.FieldRawLen("unknown1", refsEndPos-d.Pos())
+			}
+		})
+	}
+
+	if directoryStringsOffset != 0 {
+		d.SeekAbs(volumesPos + int64(directoryStringsOffset)*8)
+		d.FieldArray("directory_strings", func(d *decode.D) {
+			for i := uint64(0); i < directoryStringsCount; i++ {
+				d.FieldStruct("directory_string", func(d *decode.D) {
+					chars := d.FieldU16("chars")
+					d.FieldUTF16LE("value", int(chars+1)*2, scalar.ActualTrim("\x00"))
+				})
+			}
+		})
+	}
+}
+
+func decodeVolumes(d *decode.D, version uint64, fi fileInformation) {
+	entryBytes := uint64(104)
+	switch {
+	case version == versionXP:
+		entryBytes = 40
+	case version >= version10:
+		entryBytes = 96
+	}
+	seekSection(d, "volumes", fi.volumesOffset, fi.volumesSize)
+	if fi.volumesCount*entryBytes > fi.volumesSize {
+		d.Fatalf("volumes count %d does not fit in volumes size %d", fi.volumesCount, fi.volumesSize)
+	}
+
+	volumesPos := int64(fi.volumesOffset) * 8
+	d.FieldArray("volumes", func(d *decode.D) {
+		for i := uint64(0); i < fi.volumesCount; i++ {
+			entryPos := volumesPos + int64(i*entryBytes)*8
+			d.SeekAbs(entryPos)
+			d.FieldStruct("volume", func(d *decode.D) {
+				decodeVolume(d, version, volumesPos, entryPos+int64(entryBytes)*8)
+			})
+		}
+	})
+}
+
+// uncompressed prefetch file starting with version and "SCCA" signature
+func decodeSCCA(d *decode.D) {
+	d.Endian = decode.LittleEndian
+
+	var version uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		version = d.FieldU32("version", versionNames)
+		d.FieldUTF8("signature", 4, d.AssertStr("SCCA"))
+		d.FieldU32("unknown0", scalar.ActualHex)
+		d.FieldU32("file_size")
+		d.FieldUTF16LE("executable_filename", 60, scalar.ActualTrim("\x00"))
+		d.FieldU32("prefetch_hash", scalar.ActualHex)
+		d.FieldU32("unknown1", scalar.ActualHex)
+	})
+	switch version {
+	case versionXP, versionVista, version8, version10, version11:
+	default:
+		d.Fatalf("unknown version %d", version)
+	}
+
+	// file information ends where metrics starts
+	metricsOffset := int64(binary.LittleEndian.Uint32(d.PeekBytes(4)))
+	if metricsOffset < headerBytes+36 || metricsOffset*8 > d.Len() {
+		d.Fatalf("invalid metrics offset %d", metricsOffset)
+	}
+	var fi fileInformation
+	d.FieldStruct("file_information", func(d *decode.D) {
+		fi = decodeFileInformation(d, version, metricsOffset*8)
+	})
+
+	decodeMetrics(d, version, fi)
+	decodeTraceChains(d, version, fi)
+	decodeFilenameStrings(d, fi)
+	decodeVolumes(d, version, fi)
+}
+
+func prefetchDecode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	if !bytes.Equal(d.PeekBytes(3), []byte("MAM")) {
+		decodeSCCA(d)
+		return nil
+	}
+
+	var compressionFormat uint64
+	var hasChecksum bool
+	d.FieldUTF8("signature", 3, d.AssertStr("MAM"))
+	d.FieldStruct("flags", func(d *decode.D) {
+		hasChecksum = d.FieldBool("has_checksum")
+		d.FieldU3("reserved")
+		compressionFormat = d.FieldU4("compression_format", compressionFormatNames)
+	})
+	uncompressedSize := d.FieldU32("uncompressed_size")
+	if hasChecksum {
+		d.FieldU32("checksum", scalar.ActualHex)
+	}
+	compressedPos := d.Pos()
+	d.FieldRawLen("compressed", d.BitsLeft())
+
+	if compressionFormat != compressionFormatXpressHuffman {
+		return nil
+	}
+	if uncompressedSize > maxUncompressedBytes {
+		d.Fatalf("uncompressed size %d too large", uncompressedSize)
+	}
+	uncompressed, err := xpressHuffmanDecompress(d.BytesRange(compressedPos, int(d.Len()-compressedPos)/8), int(uncompressedSize))
+	if err != nil {
+		d.Fatalf("xpress huffman: %s", err)
+	}
+	d.FieldStructRootBitBufFn("uncompressed", bitio.NewBitReader(uncompressed, -1), decodeSCCA)
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package prefetch
+
+// LZXPRESS Huffman decompression
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-xca/a8b7cb0a-92a6-4187-a23b-5e14273b96f8
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	xpressHuffmanSymbols   = 512
+	xpressHuffmanTableSize = xpressHuffmanSymbols / 2
+	xpressHuffmanMaxLen    = 15
+	xpressHuffmanBlockSize = 65536
+)
+
+type xpressHuffmanTable struct {
+	// indexed by next 15 bits, symbol<<4 | length
+	entries [1 << xpressHuffmanMaxLen]uint16
+}
+
+func newXpressHuffmanTable(b []byte) (*xpressHuffmanTable, error) {
+	var lengths [xpressHuffmanSymbols]uint8
+	for i, v := range b[0:xpressHuffmanTableSize] {
+		lengths[i*2] = v & 0xf
+		lengths[i*2+1] = v >> 4
+	}
+
+	t := &xpressHuffmanTable{}
+	// canonical codes, assigned by length then symbol
+	code := 0
+	for l := 1; l <= xpressHuffmanMaxLen; l++ {
+		for s, sl := range lengths {
+			if int(sl) != l {
+				continue
+			}
+			n := 1 << (xpressHuffmanMaxLen - l)
+			start := code << (xpressHuffmanMaxLen - l)
+			if start+n > len(t.entries) {
+				return nil, errors.New("oversubscribed huffman table")
+			}
+			for i := start; i < start+n; i++ {
+				t.entries[i] = uint16(s<<4 | l)
+			}
+			code++
+		}
+		code <<= 1
+	}
+
+	return t, nil
+}
+
+type xpressHuffmanReader struct {
+	buf       []byte
+	pos       int
+	nextBits  uint32
+	extraBits int
+}
+
+// reads past end of input are zero as encoders might not pad last bits
+func (r *xpressHuffmanReader) read16() uint32 {
+	if r.pos+2 > len(r.buf) {
+		r.pos += 2
+		return 0
+	}
+	v := binary.LittleEndian.Uint16(r.buf[r.pos:])
+	r.pos += 2
+	return uint32(v)
+}
+
+func (r *xpressHuffmanReader) init() {
+	r.nextBits = r.read16()<<16 | r.read16()
+	r.extraBits = 16
+}
+
+func (r *xpressHuffmanReader) consume(n int) {
+	r.nextBits <<= n
+	r.extraBits -= n
+	if r.extraBits < 0 {
+		r.nextBits |= r.read16() << -r.extraBits
+		r.extraBits += 16
+	}
+}
+
+func (r *xpressHuffmanReader) readByte() (int, error) {
+	if r.pos >= len(r.buf) {
+		return 0, errors.New("unexpected end of input")
+	}
+	v := r.buf[r.pos]
+	r.pos++
+	return int(v), nil
+}
+
+func xpressHuffmanDecompress(buf []byte, outSize int) ([]byte, error) {
+	out := make([]byte, 0, outSize)
+	r := &xpressHuffmanReader{buf: buf}
+
+	for len(out) < outSize {
+		if r.pos+xpressHuffmanTableSize > len(buf) {
+			return nil, errors.New("huffman table outside input")
+		}
+		t, err := newXpressHuffmanTable(buf[r.pos:])
+		if err != nil {
+			return nil, err
+		}
+		r.pos += xpressHuffmanTableSize
+		r.init()
+
+		blockEnd := len(out) + xpressHuffmanBlockSize
+		for len(out) < blockEnd && len(out) < outSize {
+			e := t.entries[r.nextBits>>(32-xpressHuffmanMaxLen)]
+			symbol := int(e >> 4)
+			symbolLen := int(e & 0xf)
+			if symbolLen == 0 {
+				return nil, errors.New("invalid huffman code")
+			}
+			r.consume(symbolLen)
+
+			if symbol < 256 {
+				out = append(out, byte(symbol))
+				continue
+			}
+
+			symbol -= 256
+			matchLen := symbol & 0xf
+			offsetBits := symbol >> 4
+			if matchLen == 15 {
+				if matchLen, err = r.readByte(); err != nil {
+					return nil, err
+				}
+				if matchLen == 255 {
+					if r.pos+2 > len(buf) {
+						return nil, errors.New("unexpected end of input")
+					}
+					matchLen = int(binary.LittleEndian.Uint16(buf[r.pos:]))
+					r.pos += 2
+					if matchLen == 0 {
+						if r.pos+4 > len(buf) {
+							return nil, errors.New("unexpected end of input")
+						}
+						matchLen = int(binary.LittleEndian.Uint32(buf[r.pos:]))
+						r.pos += 4
+					}
+					if matchLen < 15 {
+						return nil, fmt.Errorf("invalid match length %d", matchLen)
+					}
+					matchLen -= 15
+				}
+				matchLen += 15
+			}
+			matchLen += 3
+
+			// shift in two steps as offsetBits can be 0
+			matchOffset := int((r.nextBits>>1)>>(31-offsetBits)) | 1<<offsetBits
+			r.consume(offsetBits)
+
+			if matchOffset > len(out) {
+				return nil, fmt.Errorf("match offset %d outside output", matchOffset)
+			}
+			if len(out)+matchLen > outSize {
+				return nil, fmt.Errorf("match length %d outside output", matchLen)
+			}
+			// byte by byte as match can overlap
+			for i := 0; i < matchLen; i++ {
+				out = append(out, out[len(out)-matchOffset])
+			}
+		}
+	}
+
+	return out, nil
+}
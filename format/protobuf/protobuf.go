@@ -4,6 +4,7 @@ package protobuf
 
 import (
 	"embed"
+	"math"
 
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/internal/mathex"
@@ -20,6 +21,7 @@ func init() {
 		Name:        format.PROTOBUF,
 		Description: "Protobuf",
 		DecodeFn:    protobufDecode,
+		DecodeInArg: format.ProtoBufIn{},
 		Functions:   []string{"_help"},
 	})
 	interp.RegisterFS(protobufFS)
@@ -52,6 +54,48 @@ func varInt(d *decode.D) uint64 {
 	return n
 }
 
+func isPackable(typ int) bool {
+	switch typ {
+	case format.ProtoBufTypeString,
+		format.ProtoBufTypeBytes,
+		format.ProtoBufTypeMessage:
+		return false
+	}
+	return true
+}
+
+// decode one element of a packed repeated field
+func protobufDecodePackedValue(d *decode.D, pbf format.ProtoBufField) {
+	switch pbf.Type {
+	case format.ProtoBufTypeInt32:
+		d.FieldSFn("value", func(d *decode.D) int64 { return int64(int32(varInt(d))) })
+	case format.ProtoBufTypeInt64:
+		d.FieldSFn("value", func(d *decode.D) int64 { return int64(varInt(d)) })
+	case format.ProtoBufTypeUInt32, format.ProtoBufTypeUInt64:
+		d.FieldUFn("value", varInt)
+	case format.ProtoBufTypeSInt32, format.ProtoBufTypeSInt64:
+		d.FieldSFn("value", func(d *decode.D) int64 { return mathex.ZigZag(varInt(d)) })
+	case format.ProtoBufTypeBool:
+		d.FieldBoolFn("value", func(d *decode.D) bool { return varInt(d) != 0 })
+	case format.ProtoBufTypeEnum:
+		d.FieldUFn("value", varInt, scalar.UToSymStr(pbf.Enums))
+	case format.ProtoBufTypeFixed64:
+		d.FieldU64("value")
+	case format.ProtoBufTypeSFixed64:
+		d.FieldS64("value")
+	case format.ProtoBufTypeDouble:
+		d.FieldF64("value")
+	case format.ProtoBufTypeFixed32:
+		d.FieldU32("value")
+	case format.ProtoBufTypeSFixed32:
+		d.FieldS32("value")
+	case format.ProtoBufTypeFloat:
+		d.FieldF32("value")
+	default:
+		d.Fatalf("unknown packed type %d", pbf.Type)
+	}
+}
+
 func protobufDecodeField(d *decode.D, pbm *format.ProtoBufMessage) {
 	d.FieldStruct("field", func(d *decode.D) {
 		keyN := d.FieldUFn("key_n", varInt)
@@ -81,9 +125,27 @@ func protobufDecodeField(d *decode.D, pbm *format.ProtoBufMessage) {
 				d.FieldValueStr("name", pbf.Name)
 				d.FieldValueStr("type", format.ProtoBufTypeNames[uint64(pbf.Type)])
 
+				if wireType == wireTypeLengthDelimited && isPackable(pbf.Type) {
+					// repeated scalar values packed into one length delimited field
+					d.RangeFn(valueStart, int64(length)*8, func(d *decode.D) {
+						d.FieldArray("value", func(d *decode.D) {
+							for !d.End() {
+								protobufDecodePackedValue(d, pbf)
+							}
+						})
+					})
+					return
+				}
+
 				switch pbf.Type {
-				case format.ProtoBufTypeInt32, format.ProtoBufTypeInt64:
-					v := mathex.ZigZag(value)
+				case format.ProtoBufTypeInt32:
+					v := int64(int32(value))
+					d.FieldValueS("value", v)
+					if len(pbf.Enums) > 0 {
+						d.FieldValueStr("enum", pbf.Enums[uint64(v)])
+					}
+				case format.ProtoBufTypeInt64:
+					v := int64(value)
 					d.FieldValueS("value", v)
 					if len(pbf.Enums) > 0 {
 						d.FieldValueStr("enum", pbf.Enums[uint64(v)])
@@ -94,8 +156,7 @@ func protobufDecodeField(d *decode.D, pbm *format.ProtoBufMessage) {
 						d.FieldValueStr("enum", pbf.Enums[value])
 					}
 				case format.ProtoBufTypeSInt32, format.ProtoBufTypeSInt64:
-					// TODO: correct? 32 different?
-					v := mathex.TwosComplement(64, value)
+					v := mathex.ZigZag(value)
 					d.FieldValueS("value", v)
 					if len(pbf.Enums) > 0 {
 						d.FieldValueStr("enum", pbf.Enums[uint64(v)])
@@ -105,28 +166,27 @@ func protobufDecodeField(d *decode.D, pbm *format.ProtoBufMessage) {
 				case format.ProtoBufTypeEnum:
 					d.FieldValueStr("enum", pbf.Enums[value])
 				case format.ProtoBufTypeFixed64:
-					// TODO:
+					d.FieldValueU("value", value)
 				case format.ProtoBufTypeSFixed64:
-					// TODO:
+					d.FieldValueS("value", int64(value))
 				case format.ProtoBufTypeDouble:
-					// TODO:
+					d.FieldValueFloat("value", math.Float64frombits(value))
 				case format.ProtoBufTypeString:
 					d.FieldValueStr("value", string(d.BytesRange(valueStart, int(length))))
 				case format.ProtoBufTypeBytes:
 					d.FieldValueRaw("value", d.BytesRange(valueStart, int(length)))
 				case format.ProtoBufTypeMessage:
-					// TODO: test
-					d.FramedFn(int64(length)*8, func(d *decode.D) {
-						protobufDecodeFields(d, &pbf.Message)
+					d.RangeFn(valueStart, int64(length)*8, func(d *decode.D) {
+						d.FieldStruct("value", func(d *decode.D) {
+							protobufDecodeFields(d, &pbf.Message)
+						})
 					})
-				case format.ProtoBufTypePackedRepeated:
-					// TODO:
 				case format.ProtoBufTypeFixed32:
-					// TODO:
+					d.FieldValueU("value", value)
 				case format.ProtoBufTypeSFixed32:
-					// TODO:
+					d.FieldValueS("value", int64(int32(value)))
 				case format.ProtoBufTypeFloat:
-					// TODO:
+					d.FieldValueFloat("value", float64(math.Float32frombits(uint32(value))))
 				}
 			}
 		}
@@ -142,10 +202,22 @@ func protobufDecodeFields(d *decode.D, pbm *format.ProtoBufMessage) {
 }
 
 func protobufDecode(d *decode.D, in any) any {
+	// fixed size wire values are little endian
+	d.Endian = decode.LittleEndian
+
 	var pbm *format.ProtoBufMessage
 	pbi, ok := in.(format.ProtoBufIn)
 	if ok {
-		pbm = &pbi.Message
+		switch {
+		case pbi.Message != nil:
+			pbm = &pbi.Message
+		case pbi.Descriptor != "":
+			m, err := parseDescriptorSet([]byte(pbi.Descriptor), pbi.MessageType)
+			if err != nil {
+				d.Fatalf("descriptor: %s", err)
+			}
+			pbm = &m
+		}
 	}
 
 	protobufDecodeFields(d, pbm)
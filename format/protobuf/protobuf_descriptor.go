@@ -0,0 +1,318 @@
+package protobuf
+
+// https://github.com/protocolbuffers/protobuf/blob/main/src/google/protobuf/descriptor.proto
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/wader/fq/format"
+)
+
+// FieldDescriptorProto.Type to decoder type, TYPE_GROUP is not supported
+var descriptorTypes = map[uint64]int{
+	1:  format.ProtoBufTypeDouble,
+	2:  format.ProtoBufTypeFloat,
+	3:  format.ProtoBufTypeInt64,
+	4:  format.ProtoBufTypeUInt64,
+	5:  format.ProtoBufTypeInt32,
+	6:  format.ProtoBufTypeFixed64,
+	7:  format.ProtoBufTypeFixed32,
+	8:  format.ProtoBufTypeBool,
+	9:  format.ProtoBufTypeString,
+	11: format.ProtoBufTypeMessage,
+	12: format.ProtoBufTypeBytes,
+	13: format.ProtoBufTypeUInt32,
+	14: format.ProtoBufTypeEnum,
+	15: format.ProtoBufTypeSFixed32,
+	16: format.ProtoBufTypeSFixed64,
+	17: format.ProtoBufTypeSInt32,
+	18: format.ProtoBufTypeSInt64,
+}
+
+type wireField struct {
+	number   uint64
+	wireType uint64
+	value    uint64
+	bytes    []byte
+}
+
+func wireVarint(b []byte) (uint64, int, error) {
+	var n uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		n |= uint64(b[i]&0x7f) << (7 * i)
+		if b[i]&0x80 == 0 {
+			return n, i + 1, nil
+		}
+	}
+	return 0, 0, errors.New("invalid varint")
+}
+
+// wireFields splits a serialized message into its fields without a schema
+func wireFields(b []byte) ([]wireField, error) {
+	var fs []wireField
+	for len(b) > 0 {
+		keyN, n, err := wireVarint(b)
+		if err != nil {
+			return nil, err
+		}
+		b = b[n:]
+		f := wireField{number: keyN >> 3, wireType: keyN & 0x7}
+		switch f.wireType {
+		case wireTypeVarint:
+			if f.value, n, err = wireVarint(b); err != nil {
+				return nil, err
+			}
+		case wireType64Bit:
+			n = 8
+		case wireTypeLengthDelimited:
+			var l uint64
+			if l, n, err = wireVarint(b); err != nil {
+				return nil, err
+			}
+			if l > uint64(len(b)-n) {
+				return nil, fmt.Errorf("field %d length %d outside message", f.number, l)
+			}
+			b = b[n:]
+			n = int(l)
+			f.bytes = b[:n]
+		case wireType32Bit:
+			n = 4
+		default:
+			return nil, fmt.Errorf("field %d has unsupported wire type %d", f.number, f.wireType)
+		}
+		if n > len(b) {
+			return nil, fmt.Errorf("field %d outside message", f.number)
+		}
+		b = b[n:]
+		fs = append(fs, f)
+	}
+	return fs, nil
+}
+
+type descriptorField struct {
+	name     string
+	number   int
+	typ      uint64
+	typeName string
+}
+
+type descriptorMessage struct {
+	fields  []descriptorField
+	scope   string
+	message format.ProtoBufMessage
+}
+
+// descriptorSet is all messages and enums in a FileDescriptorSet by full name
+type descriptorSet struct {
+	messages map[string]*descriptorMessage
+	enums    map[string]map[uint64]string
+	// full name of first message in last file, protoc puts the input files last
+	defaultMessage string
+}
+
+func (ds *descriptorSet) parseEnum(b []byte, scope string) error {
+	fs, err := wireFields(b)
+	if err != nil {
+		return err
+	}
+	var name string
+	values := map[uint64]string{}
+	for _, f := range fs {
+		switch f.number {
+		case 1:
+			name = string(f.bytes)
+		case 2:
+			vfs, err := wireFields(f.bytes)
+			if err != nil {
+				return err
+			}
+			var vName string
+			var vNumber uint64
+			for _, vf := range vfs {
+				switch vf.number {
+				case 1:
+					vName = string(vf.bytes)
+				case 2:
+					// negative enum values are sign extended varints so matches wire value
+					vNumber = vf.value
+				}
+			}
+			values[vNumber] = vName
+		}
+	}
+	ds.enums[scope+"."+name] = values
+	return nil
+}
+
+func (ds *descriptorSet) parseMessage(b []byte, scope string) (string, error) {
+	fs, err := wireFields(b)
+	if err != nil {
+		return "", err
+	}
+	var name string
+	for _, f := range fs {
+		if f.number == 1 {
+			name = string(f.bytes)
+		}
+	}
+	fullName := scope + "." + name
+	dm := &descriptorMessage{scope: fullName, message: format.ProtoBufMessage{}}
+	ds.messages[fullName] = dm
+
+	for _, f := range fs {
+		switch f.number {
+		case 2:
+			ffs, err := wireFields(f.bytes)
+			if err != nil {
+				return "", err
+			}
+			var df descriptorField
+			for _, ff := range ffs {
+				switch ff.number {
+				case 1:
+					df.name = string(ff.bytes)
+				case 3:
+					df.number = int(ff.value)
+				case 5:
+					df.typ = ff.value
+				case 6:
+					df.typeName = string(ff.bytes)
+				}
+			}
+			dm.fields = append(dm.fields, df)
+		case 3:
+			if _, err := ds.parseMessage(f.bytes, fullName); err != nil {
+				return "", err
+			}
+		case 4:
+			if err := ds.parseEnum(f.bytes, fullName); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return fullName, nil
+}
+
+func (ds *descriptorSet) parseFile(b []byte) error {
+	fs, err := wireFields(b)
+	if err != nil {
+		return err
+	}
+	var scope string
+	for _, f := range fs {
+		if f.number == 2 {
+			scope = "." + string(f.bytes)
+		}
+	}
+	firstMessage := true
+	for _, f := range fs {
+		switch f.number {
+		case 4:
+			fullName, err := ds.parseMessage(f.bytes, scope)
+			if err != nil {
+				return err
+			}
+			if firstMessage {
+				ds.defaultMessage = fullName
+				firstMessage = false
+			}
+		case 5:
+			if err := ds.parseEnum(f.bytes, scope); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolve type name using protobuf scoping rules, protoc always
+// fully qualifies names but hand written descriptors might not
+func resolveName[T any](m map[string]T, name string, scope string) (T, bool) {
+	if strings.HasPrefix(name, ".") {
+		v, ok := m[name]
+		return v, ok
+	}
+	for {
+		if v, ok := m[scope+"."+name]; ok {
+			return v, true
+		}
+		if scope == "" {
+			var v T
+			return v, false
+		}
+		if i := strings.LastIndex(scope, "."); i >= 0 {
+			scope = scope[:i]
+		} else {
+			scope = ""
+		}
+	}
+}
+
+func (ds *descriptorSet) link() error {
+	for _, dm := range ds.messages {
+		for _, df := range dm.fields {
+			typ, ok := descriptorTypes[df.typ]
+			if !ok {
+				continue
+			}
+			pbf := format.ProtoBufField{Type: typ, Name: df.name}
+			switch typ {
+			case format.ProtoBufTypeMessage:
+				rm, ok := resolveName(ds.messages, df.typeName, dm.scope)
+				if !ok {
+					return fmt.Errorf("field %s: message type %s not found", df.name, df.typeName)
+				}
+				pbf.Message = rm.message
+			case format.ProtoBufTypeEnum:
+				re, ok := resolveName(ds.enums, df.typeName, dm.scope)
+				if !ok {
+					return fmt.Errorf("field %s: enum type %s not found", df.name, df.typeName)
+				}
+				pbf.Enums = re
+			}
+			dm.message[df.number] = pbf
+		}
+	}
+	return nil
+}
+
+// parseDescriptorSet parses a serialized FileDescriptorSet, as produced by
+// protoc --descriptor_set_out, into a message schema
+func parseDescriptorSet(b []byte, messageType string) (format.ProtoBufMessage, error) {
+	ds := &descriptorSet{
+		messages: map[string]*descriptorMessage{},
+		enums:    map[string]map[uint64]string{},
+	}
+
+	fs, err := wireFields(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fs {
+		if f.number != 1 || f.wireType != wireTypeLengthDelimited {
+			continue
+		}
+		if err := ds.parseFile(f.bytes); err != nil {
+			return nil, err
+		}
+	}
+	if err := ds.link(); err != nil {
+		return nil, err
+	}
+
+	if messageType == "" {
+		messageType = ds.defaultMessage
+	}
+	if !strings.HasPrefix(messageType, ".") {
+		messageType = "." + messageType
+	}
+	dm, ok := ds.messages[messageType]
+	if !ok {
+		return nil, fmt.Errorf("message type %s not found", strings.TrimPrefix(messageType, "."))
+	}
+
+	return dm.message, nil
+}
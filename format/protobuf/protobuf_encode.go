@@ -0,0 +1,288 @@
+package protobuf
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/internal/gojqex"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/gojq"
+)
+
+func init() {
+	interp.RegisterFunc2("_toprotobuf", toProtobuf)
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendU32LE(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendU64LE(b []byte, v uint64) []byte {
+	return appendU32LE(appendU32LE(b, uint32(v)), uint32(v>>32))
+}
+
+func appendKey(b []byte, number int, wireType uint64) []byte {
+	return appendVarint(b, uint64(number)<<3|wireType)
+}
+
+func appendLengthDelimited(b []byte, number int, v []byte) []byte {
+	b = appendKey(b, number, wireTypeLengthDelimited)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// decode values are converted to jq values except binaries
+func toJQValue(v any) any {
+	if _, ok := v.(interp.ToBinary); ok {
+		return v
+	}
+	if jv, ok := v.(gojq.JQValue); ok {
+		return jv.JQValueToGoJQ()
+	}
+	return v
+}
+
+// integer as two's complement 64 bit
+func toWireInt(v any) (uint64, error) {
+	switch v := toJQValue(v).(type) {
+	case int:
+		return uint64(int64(v)), nil
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxUint64 {
+			return 0, fmt.Errorf("%v is not a 64 bit integer", v)
+		}
+		if v < 0 {
+			return uint64(int64(v)), nil
+		}
+		return uint64(v), nil
+	case *big.Int:
+		switch {
+		case v.IsUint64():
+			return v.Uint64(), nil
+		case v.IsInt64():
+			return uint64(v.Int64()), nil
+		}
+		return 0, fmt.Errorf("%s is not a 64 bit integer", v)
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("expected a number, got %s", gojqex.TypeErrorPreview(v))
+	}
+}
+
+func toWireFloat(v any) (float64, error) {
+	switch v := toJQValue(v).(type) {
+	case int:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, nil
+	default:
+		return 0, fmt.Errorf("expected a number, got %s", gojqex.TypeErrorPreview(v))
+	}
+}
+
+// enum by name or number
+func toWireEnum(v any, enums map[uint64]string) (uint64, error) {
+	if s, ok := toJQValue(v).(string); ok {
+		for n, name := range enums {
+			if name == s {
+				return n, nil
+			}
+		}
+		return 0, fmt.Errorf("unknown enum value %q", s)
+	}
+	return toWireInt(v)
+}
+
+func toWireBytes(v any) ([]byte, error) {
+	br, err := interp.ToBitReader(v)
+	if err != nil {
+		return nil, fmt.Errorf("expected a string or binary, got %s", gojqex.TypeErrorPreview(v))
+	}
+	b, err := io.ReadAll(bitio.NewIOReader(br))
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// append scalar value without key, used for both single and packed values
+func appendScalar(b []byte, pbf format.ProtoBufField, v any) ([]byte, error) {
+	switch pbf.Type {
+	case format.ProtoBufTypeInt32,
+		format.ProtoBufTypeInt64,
+		format.ProtoBufTypeUInt32,
+		format.ProtoBufTypeUInt64,
+		format.ProtoBufTypeBool:
+		n, err := toWireInt(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendVarint(b, n), nil
+	case format.ProtoBufTypeEnum:
+		n, err := toWireEnum(v, pbf.Enums)
+		if err != nil {
+			return nil, err
+		}
+		return appendVarint(b, n), nil
+	case format.ProtoBufTypeSInt32, format.ProtoBufTypeSInt64:
+		n, err := toWireInt(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendVarint(b, n<<1^uint64(int64(n)>>63)), nil
+	case format.ProtoBufTypeFixed64, format.ProtoBufTypeSFixed64:
+		n, err := toWireInt(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendU64LE(b, n), nil
+	case format.ProtoBufTypeFixed32, format.ProtoBufTypeSFixed32:
+		n, err := toWireInt(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendU32LE(b, uint32(n)), nil
+	case format.ProtoBufTypeDouble:
+		f, err := toWireFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendU64LE(b, math.Float64bits(f)), nil
+	case format.ProtoBufTypeFloat:
+		f, err := toWireFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendU32LE(b, math.Float32bits(float32(f))), nil
+	default:
+		return nil, fmt.Errorf("unknown scalar type %d", pbf.Type)
+	}
+}
+
+func scalarWireType(typ int) uint64 {
+	switch typ {
+	case format.ProtoBufTypeFixed64,
+		format.ProtoBufTypeSFixed64,
+		format.ProtoBufTypeDouble:
+		return wireType64Bit
+	case format.ProtoBufTypeFixed32,
+		format.ProtoBufTypeSFixed32,
+		format.ProtoBufTypeFloat:
+		return wireType32Bit
+	default:
+		return wireTypeVarint
+	}
+}
+
+func appendField(b []byte, number int, pbf format.ProtoBufField, v any) ([]byte, error) {
+	switch pbf.Type {
+	case format.ProtoBufTypeString, format.ProtoBufTypeBytes:
+		vb, err := toWireBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendLengthDelimited(b, number, vb), nil
+	case format.ProtoBufTypeMessage:
+		vb, err := appendMessage(nil, pbf.Message, v)
+		if err != nil {
+			return nil, err
+		}
+		return appendLengthDelimited(b, number, vb), nil
+	default:
+		return appendScalar(appendKey(b, number, scalarWireType(pbf.Type)), pbf, v)
+	}
+}
+
+// fields are encoded in field number order, arrays are repeated fields and
+// packed if the type is packable
+func appendMessage(b []byte, pbm format.ProtoBufMessage, v any) ([]byte, error) {
+	obj, ok := toJQValue(v).(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected an object, got %s", gojqex.TypeErrorPreview(v))
+	}
+
+	byName := map[string]int{}
+	for n, pbf := range pbm {
+		byName[pbf.Name] = n
+	}
+	var numbers []int
+	for k, fv := range obj {
+		n, ok := byName[k]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q", k)
+		}
+		if fv != nil {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+
+	for _, n := range numbers {
+		pbf := pbm[n]
+		fv := toJQValue(obj[pbf.Name])
+		var err error
+		if vs, ok := fv.([]any); ok {
+			if isPackable(pbf.Type) {
+				var pb []byte
+				for _, e := range vs {
+					if pb, err = appendScalar(pb, pbf, e); err != nil {
+						return nil, fmt.Errorf("%s: %w", pbf.Name, err)
+					}
+				}
+				b = appendLengthDelimited(b, n, pb)
+				continue
+			}
+			for _, e := range vs {
+				if b, err = appendField(b, n, pbf, e); err != nil {
+					return nil, fmt.Errorf("%s: %w", pbf.Name, err)
+				}
+			}
+			continue
+		}
+		if b, err = appendField(b, n, pbf, fv); err != nil {
+			return nil, fmt.Errorf("%s: %w", pbf.Name, err)
+		}
+	}
+
+	return b, nil
+}
+
+func toProtobuf(_ *interp.Interp, c any, descriptor any, messageType string) any {
+	db, err := toWireBytes(descriptor)
+	if err != nil {
+		return fmt.Errorf("descriptor: %w", err)
+	}
+	pbm, err := parseDescriptorSet(db, messageType)
+	if err != nil {
+		return fmt.Errorf("descriptor: %w", err)
+	}
+	b, err := appendMessage(nil, pbm, c)
+	if err != nil {
+		return err
+	}
+	bb, err := interp.NewBinaryFromBitReader(bitio.NewBitReader(b, -1), 8, 0)
+	if err != nil {
+		return err
+	}
+	return bb
+}
@@ -3,18 +3,25 @@ package rtmp
 // https://rtmp.veriskope.com/pdf/amf0-file-format-specification.pdf
 
 import (
+	"embed"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
 	"github.com/wader/fq/pkg/scalar"
 )
 
+//go:embed amf0.jq
+var amf0FS embed.FS
+
 func init() {
 	interp.RegisterFormat(decode.Format{
 		Name:        format.AMF0,
 		Description: "Action Message Format 0",
 		DecodeFn:    amf0Decode,
+		Functions:   []string{"torepr", "_help"},
 	})
+	interp.RegisterFS(amf0FS)
 }
 
 const (
@@ -0,0 +1,283 @@
+package sf2
+
+// https://www.synthfont.com/sfspec24.pdf
+// http://www.synthfont.com/SFSPEC21.PDF
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed sf2.jq
+var sf2FS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.SF2,
+		Description: "SoundFont 2",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    sf2Decode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(sf2FS)
+}
+
+const (
+	generatorInstrument  = 41
+	generatorKeyRange    = 43
+	generatorVelRange    = 44
+	generatorSampleID    = 53
+	generatorSampleModes = 54
+)
+
+var generatorNames = scalar.UToSymStr{
+	0:                    "start_addrs_offset",
+	1:                    "end_addrs_offset",
+	2:                    "startloop_addrs_offset",
+	3:                    "endloop_addrs_offset",
+	4:                    "start_addrs_coarse_offset",
+	5:                    "mod_lfo_to_pitch",
+	6:                    "vib_lfo_to_pitch",
+	7:                    "mod_env_to_pitch",
+	8:                    "initial_filter_fc",
+	9:                    "initial_filter_q",
+	10:                   "mod_lfo_to_filter_fc",
+	11:                   "mod_env_to_filter_fc",
+	12:                   "end_addrs_coarse_offset",
+	13:                   "mod_lfo_to_volume",
+	14:                   "unused1",
+	15:                   "chorus_effects_send",
+	16:                   "reverb_effects_send",
+	17:                   "pan",
+	18:                   "unused2",
+	19:                   "unused3",
+	20:                   "unused4",
+	21:                   "delay_mod_lfo",
+	22:                   "freq_mod_lfo",
+	23:                   "delay_vib_lfo",
+	24:                   "freq_vib_lfo",
+	25:                   "delay_mod_env",
+	26:                   "attack_mod_env",
+	27:                   "hold_mod_env",
+	28:                   "decay_mod_env",
+	29:                   "sustain_mod_env",
+	30:                   "release_mod_env",
+	31:                   "keynum_to_mod_env_hold",
+	32:                   "keynum_to_mod_env_decay",
+	33:                   "delay_vol_env",
+	34:                   "attack_vol_env",
+	35:                   "hold_vol_env",
+	36:                   "decay_vol_env",
+	37:                   "sustain_vol_env",
+	38:                   "release_vol_env",
+	39:                   "keynum_to_vol_env_hold",
+	40:                   "keynum_to_vol_env_decay",
+	generatorInstrument:  "instrument",
+	42:                   "reserved1",
+	generatorKeyRange:    "key_range",
+	generatorVelRange:    "vel_range",
+	45:                   "startloop_addrs_coarse_offset",
+	46:                   "keynum",
+	47:                   "velocity",
+	48:                   "initial_attenuation",
+	49:                   "reserved2",
+	50:                   "endloop_addrs_coarse_offset",
+	51:                   "coarse_tune",
+	52:                   "fine_tune",
+	generatorSampleID:    "sample_id",
+	generatorSampleModes: "sample_modes",
+	55:                   "reserved3",
+	56:                   "scale_tuning",
+	57:                   "exclusive_class",
+	58:                   "overriding_root_key",
+	59:                   "unused5",
+	60:                   "end_oper",
+}
+
+var sampleModeNames = scalar.UToSymStr{
+	0: "no_loop",
+	1: "loop_continuous",
+	2: "unused_no_loop",
+	3: "loop_until_release",
+}
+
+var transformNames = scalar.UToSymStr{
+	0: "linear",
+	2: "absolute_value",
+}
+
+var sampleTypeNames = scalar.UToSymStr{
+	0x0001: "mono",
+	0x0002: "right",
+	0x0004: "left",
+	0x0008: "linked",
+	0x8001: "rom_mono",
+	0x8002: "rom_right",
+	0x8004: "rom_left",
+	0x8008: "rom_linked",
+}
+
+var chunkIDDescriptions = scalar.StrToDescription{
+	"ifil": "Version",
+	"isng": "Target sound engine",
+	"INAM": "Name",
+	"irom": "Sound ROM name",
+	"iver": "Sound ROM version",
+	"ICRD": "Creation date",
+	"IENG": "Engineers",
+	"IPRD": "Product",
+	"ICOP": "Copyright",
+	"ICMT": "Comments",
+	"ISFT": "Software",
+	"smpl": "Sample data",
+	"sm24": "Sample data low bytes",
+	"phdr": "Preset headers",
+	"pbag": "Preset zones",
+	"pmod": "Preset modulators",
+	"pgen": "Preset generators",
+	"inst": "Instruments",
+	"ibag": "Instrument zones",
+	"imod": "Instrument modulators",
+	"igen": "Instrument generators",
+	"shdr": "Sample headers",
+}
+
+func decodeVersion(d *decode.D) {
+	d.FieldU16("major")
+	d.FieldU16("minor")
+}
+
+func decodeString(d *decode.D) {
+	d.FieldUTF8NullFixedLen("value", int(d.BitsLeft()/8))
+}
+
+// records in a pdta sub chunk, last record is a terminal record
+func recordsFn(arrayName string, elementName string, recordBytes int64, fn func(d *decode.D)) func(d *decode.D) {
+	return func(d *decode.D) {
+		d.FieldStructArrayLoop(arrayName, elementName, func() bool { return d.BitsLeft() >= recordBytes*8 }, fn)
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("unknown", d.BitsLeft())
+		}
+	}
+}
+
+func decodeBag(d *decode.D) {
+	d.FieldU16("generator_index")
+	d.FieldU16("modulator_index")
+}
+
+func decodeModulator(d *decode.D) {
+	d.FieldU16("src_oper", scalar.ActualHex)
+	d.FieldU16("dest_oper", generatorNames)
+	d.FieldS16("amount")
+	d.FieldU16("amount_src_oper", scalar.ActualHex)
+	d.FieldU16("trans_oper", transformNames)
+}
+
+func decodeGenerator(d *decode.D) {
+	oper := d.FieldU16("oper", generatorNames)
+	switch oper {
+	case generatorKeyRange, generatorVelRange:
+		d.FieldU8("lo")
+		d.FieldU8("hi")
+	case generatorInstrument, generatorSampleID:
+		d.FieldU16("index")
+	case generatorSampleModes:
+		d.FieldU16("amount", sampleModeNames)
+	default:
+		d.FieldS16("amount")
+	}
+}
+
+var chunkFns = map[string]func(d *decode.D){
+	"ifil": decodeVersion,
+	"iver": decodeVersion,
+	"isng": decodeString,
+	"INAM": decodeString,
+	"irom": decodeString,
+	"ICRD": decodeString,
+	"IENG": decodeString,
+	"IPRD": decodeString,
+	"ICOP": decodeString,
+	"ICMT": decodeString,
+	"ISFT": decodeString,
+	"smpl": func(d *decode.D) { d.FieldRawLen("samples", d.BitsLeft()) },
+	"sm24": func(d *decode.D) { d.FieldRawLen("samples", d.BitsLeft()) },
+	"phdr": recordsFn("preset_headers", "preset_header", 38, func(d *decode.D) {
+		d.FieldUTF8NullFixedLen("name", 20)
+		d.FieldU16("preset")
+		d.FieldU16("bank")
+		d.FieldU16("bag_index")
+		d.FieldU32("library")
+		d.FieldU32("genre")
+		d.FieldU32("morphology")
+	}),
+	"pbag": recordsFn("zones", "zone", 4, decodeBag),
+	"pmod": recordsFn("modulators", "modulator", 10, decodeModulator),
+	"pgen": recordsFn("generators", "generator", 4, decodeGenerator),
+	"inst": recordsFn("instruments", "instrument", 22, func(d *decode.D) {
+		d.FieldUTF8NullFixedLen("name", 20)
+		d.FieldU16("bag_index")
+	}),
+	"ibag": recordsFn("zones", "zone", 4, decodeBag),
+	"imod": recordsFn("modulators", "modulator", 10, decodeModulator),
+	"igen": recordsFn("generators", "generator", 4, decodeGenerator),
+	"shdr": recordsFn("sample_headers", "sample_header", 46, func(d *decode.D) {
+		d.FieldUTF8NullFixedLen("name", 20)
+		d.FieldU32("start")
+		d.FieldU32("end")
+		d.FieldU32("start_loop")
+		d.FieldU32("end_loop")
+		d.FieldU32("sample_rate")
+		d.FieldU8("original_pitch")
+		d.FieldS8("pitch_correction")
+		d.FieldU16("sample_link")
+		d.FieldU16("sample_type", sampleTypeNames)
+	}),
+}
+
+func decodeChunk(d *decode.D) {
+	id := d.FieldUTF8("id", 4, chunkIDDescriptions)
+	size := int64(d.FieldU32("size"))
+
+	d.FramedFn(size*8, func(d *decode.D) {
+		if id == "LIST" {
+			d.FieldUTF8("list_type", 4)
+			decodeChunks(d)
+			return
+		}
+		if fn, ok := chunkFns[id]; ok {
+			fn(d)
+			return
+		}
+		d.FieldRawLen("data", d.BitsLeft())
+	})
+
+	if size%2 != 0 && d.BitsLeft() >= 8 {
+		d.FieldRawLen("align", 8)
+	}
+}
+
+func decodeChunks(d *decode.D) {
+	d.FieldStructArrayLoop("chunks", "chunk", func() bool { return d.BitsLeft() >= 8*8 }, decodeChunk)
+}
+
+func sf2Decode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	d.FieldUTF8("id", 4, d.AssertStr("RIFF"))
+	size := int64(d.FieldU32("size"))
+	d.FramedFn(size*8, func(d *decode.D) {
+		d.FieldUTF8("form_type", 4, d.AssertStr("sfbk"))
+		decodeChunks(d)
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("trailing", d.BitsLeft())
+	}
+
+	return nil
+}
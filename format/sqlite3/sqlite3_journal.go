@@ -0,0 +1,110 @@
+package sqlite3
+
+// https://www.sqlite.org/fileformat.html#the_rollback_journal
+// https://github.com/sqlite/sqlite/blob/master/src/pager.c
+
+import (
+	"bytes"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.SQLITE3_JOURNAL,
+		Description: "SQLite 3 rollback journal",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    journalDecode,
+		Functions:   []string{"_help"},
+	})
+}
+
+var journalMagic = []byte{0xd9, 0xd5, 0x05, 0xf9, 0x20, 0xa1, 0x63, 0xd7}
+
+const (
+	journalHeaderBytes = 28
+	// page count not synced yet, count is based on file size
+	journalPageCountUnknown = 0xffff_ffff
+)
+
+// sum of every 200th byte from end of page, first byte excluded
+func journalChecksum(nonce uint32, page []byte) uint32 {
+	c := nonce
+	for i := len(page) - 200; i > 0; i -= 200 {
+		c += uint32(page[i])
+	}
+	return c
+}
+
+func journalDecode(d *decode.D, _ any) any {
+	if !bytes.Equal(d.PeekBytes(len(journalMagic)), journalMagic) {
+		d.Fatalf("invalid magic")
+	}
+
+	// a journal can have multiple segments each starting with a header at a sector boundary
+	d.FieldArray("segments", func(d *decode.D) {
+		for d.BitsLeft() >= journalHeaderBytes*8 &&
+			bytes.Equal(d.PeekBytes(len(journalMagic)), journalMagic) {
+			d.FieldStruct("segment", func(d *decode.D) {
+				var pageCount uint64
+				var nonce uint64
+				var sectorSize uint64
+				var pageSize uint64
+				d.FieldStruct("header", func(d *decode.D) {
+					headerStart := d.Pos()
+					d.FieldRawLen("magic", int64(len(journalMagic))*8, d.AssertBitBuf(journalMagic))
+					pageCount = d.FieldU32("page_count", scalar.UToSymStr{journalPageCountUnknown: "unknown"})
+					nonce = d.FieldU32("nonce", scalar.ActualHex)
+					d.FieldU32("initial_database_size")
+					sectorSize = d.FieldU32("sector_size")
+					pageSize = d.FieldU32("page_size")
+					if !validPageSize(pageSize) {
+						d.Fatalf("invalid page size %d", pageSize)
+					}
+					if sectorSize < journalHeaderBytes || sectorSize > 65536 {
+						d.Fatalf("invalid sector size %d", sectorSize)
+					}
+					// header is padded to sector size
+					paddingBits := headerStart + int64(sectorSize)*8 - d.Pos()
+					if paddingBits > d.BitsLeft() {
+						paddingBits = d.BitsLeft()
+					}
+					d.FieldRawLen("padding", paddingBits)
+				})
+
+				recordBytes := int64(pageSize) + 8
+				if pageCount == journalPageCountUnknown || pageCount == 0 {
+					pageCount = uint64(d.BitsLeft() / 8 / recordBytes)
+				}
+
+				d.FieldArray("records", func(d *decode.D) {
+					for i := uint64(0); i < pageCount && d.BitsLeft() >= recordBytes*8; i++ {
+						d.FieldStruct("record", func(d *decode.D) {
+							d.FieldU32("page_number")
+							pagePos := d.Pos()
+							d.FieldRawLen("page", int64(pageSize)*8)
+							checksum := journalChecksum(uint32(nonce), d.BytesRange(pagePos, int(pageSize)))
+							d.FieldU32("checksum", d.ValidateU(uint64(checksum)), scalar.ActualHex)
+						})
+					}
+				})
+
+				// next segment header starts at next sector boundary
+				if rem := (d.Pos() / 8) % int64(sectorSize); rem != 0 {
+					paddingBits := (int64(sectorSize) - rem) * 8
+					if paddingBits <= d.BitsLeft() {
+						d.FieldRawLen("padding", paddingBits)
+					}
+				}
+			})
+		}
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+
+	return nil
+}
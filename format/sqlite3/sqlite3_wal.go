@@ -0,0 +1,117 @@
+package sqlite3
+
+// https://www.sqlite.org/fileformat.html#the_write_ahead_log
+
+import (
+	"embed"
+	"encoding/binary"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed sqlite3.jq
+var sqlite3FS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.SQLITE3_WAL,
+		Description: "SQLite 3 write-ahead log",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    walDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(sqlite3FS)
+}
+
+const (
+	walMagicLE       = 0x377f0682
+	walMagicBE       = 0x377f0683
+	walHeaderBytes   = 32
+	walFrameHdrBytes = 24
+)
+
+var walMagicNames = scalar.UToSymStr{
+	walMagicLE: "little_endian_checksum",
+	walMagicBE: "big_endian_checksum",
+}
+
+// checksum is over pairs of 32 bit words and continues from previous value
+type walChecksum struct {
+	order binary.ByteOrder
+	s0    uint32
+	s1    uint32
+}
+
+func (c *walChecksum) write(b []byte) {
+	for i := 0; i+8 <= len(b); i += 8 {
+		c.s0 += c.order.Uint32(b[i:]) + c.s1
+		c.s1 += c.order.Uint32(b[i+4:]) + c.s0
+	}
+}
+
+func validPageSize(n uint64) bool {
+	return n >= 512 && n <= 65536 && n&(n-1) == 0
+}
+
+func walDecode(d *decode.D, _ any) any {
+	var magic uint64
+	var pageSize uint64
+	var salt1, salt2 uint64
+	c := &walChecksum{}
+
+	d.FieldStruct("header", func(d *decode.D) {
+		magic = d.FieldU32("magic", walMagicNames, scalar.ActualHex)
+		switch magic {
+		case walMagicLE:
+			c.order = binary.LittleEndian
+		case walMagicBE:
+			c.order = binary.BigEndian
+		default:
+			d.Fatalf("invalid magic %x", magic)
+		}
+		d.FieldU32("file_format_version")
+		pageSize = d.FieldU32("page_size")
+		if !validPageSize(pageSize) {
+			d.Fatalf("invalid page size %d", pageSize)
+		}
+		d.FieldU32("checkpoint_sequence")
+		salt1 = d.FieldU32("salt1", scalar.ActualHex)
+		salt2 = d.FieldU32("salt2", scalar.ActualHex)
+		c.write(d.BytesRange(0, 24))
+		d.FieldU32("checksum1", d.ValidateU(uint64(c.s0)), scalar.ActualHex)
+		d.FieldU32("checksum2", d.ValidateU(uint64(c.s1)), scalar.ActualHex)
+	})
+
+	frameBytes := int64(walFrameHdrBytes + pageSize)
+	d.FieldArray("frames", func(d *decode.D) {
+		for d.BitsLeft() >= frameBytes*8 {
+			d.FieldStruct("frame", func(d *decode.D) {
+				frameStart := d.Pos()
+				d.FieldU32("page_number")
+				commitSize := d.FieldU32("commit_size")
+				d.FieldValueBool("is_commit", commitSize != 0)
+				// frames with other salts are left from a previous generation of the log
+				frameSalt1 := d.FieldU32("salt1", scalar.ActualHex)
+				frameSalt2 := d.FieldU32("salt2", scalar.ActualHex)
+				d.FieldValueBool("salt_valid", frameSalt1 == salt1 && frameSalt2 == salt2)
+
+				c.write(d.BytesRange(frameStart, 8))
+				c.write(d.BytesRange(frameStart+walFrameHdrBytes*8, int(pageSize)))
+				checksum1 := d.FieldU32("checksum1", d.ValidateU(uint64(c.s0)), scalar.ActualHex)
+				checksum2 := d.FieldU32("checksum2", d.ValidateU(uint64(c.s1)), scalar.ActualHex)
+				// continue with stored checksum so that valid frames after an invalid one still validate
+				c.s0, c.s1 = uint32(checksum1), uint32(checksum2)
+
+				d.FieldRawLen("page", int64(pageSize)*8)
+			})
+		}
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+
+	return nil
+}
@@ -0,0 +1,592 @@
+package sstable
+
+// https://github.com/google/leveldb/blob/main/doc/table_format.md
+// https://github.com/facebook/rocksdb/wiki/Rocksdb-BlockBasedTable-Format
+// https://github.com/facebook/rocksdb/blob/main/table/format.cc
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/checksum"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed sstable.jq
+var sstableFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.SSTABLE,
+		Description: "LevelDB/RocksDB sorted string table",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    sstableDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(sstableFS)
+}
+
+const (
+	legacyMagic  = 0xdb4775248b80fb57
+	rocksDBMagic = 0x88e241b785f4cff7
+)
+
+var magicNames = scalar.UToSymStr{
+	legacyMagic:  "legacy",
+	rocksDBMagic: "rocksdb",
+}
+
+const (
+	// two block handles of max 10 byte varints each
+	handlesBytes       = 40
+	legacyFooterBytes  = handlesBytes + 8
+	rocksDBFooterBytes = 1 + handlesBytes + 4 + 8
+	blockTrailerBytes  = 5
+	maxVarintBytes     = 10
+)
+
+const (
+	compressionNone   = 0x0
+	compressionSnappy = 0x1
+	compressionZlib   = 0x2
+	compressionBzip2  = 0x3
+	compressionLZ4    = 0x4
+	compressionLZ4HC  = 0x5
+	compressionXpress = 0x6
+	compressionZstd   = 0x7
+	// leveldb use 0x2 for zstd
+	compressionLevelDBZstd = 0x2
+)
+
+var levelDBCompressionNames = scalar.UToSymStr{
+	compressionNone:        "none",
+	compressionSnappy:      "snappy",
+	compressionLevelDBZstd: "zstd",
+}
+
+var rocksDBCompressionNames = scalar.UToSymStr{
+	compressionNone:   "none",
+	compressionSnappy: "snappy",
+	compressionZlib:   "zlib",
+	compressionBzip2:  "bzip2",
+	compressionLZ4:    "lz4",
+	compressionLZ4HC:  "lz4hc",
+	compressionXpress: "xpress",
+	compressionZstd:   "zstd",
+}
+
+const (
+	checksumNone     = 0x0
+	checksumCRC32C   = 0x1
+	checksumXXHash   = 0x2
+	checksumXXHash64 = 0x3
+	checksumXXH3     = 0x4
+)
+
+var checksumTypeNames = scalar.UToSymStr{
+	checksumNone:     "none",
+	checksumCRC32C:   "crc32c",
+	checksumXXHash:   "xxhash",
+	checksumXXHash64: "xxhash64",
+	checksumXXH3:     "xxh3",
+}
+
+var valueTypeNames = scalar.UToSymStr{
+	0x00: "deletion",
+	0x01: "value",
+	0x02: "merge",
+	0x07: "single_deletion",
+	0x0f: "range_deletion",
+	0x11: "blob_index",
+	0x13: "deletion_with_timestamp",
+	0x16: "wide_column_entity",
+}
+
+const (
+	indexTypeBinarySearch = 0
+	indexTypeHashSearch   = 1
+	indexTypeTwoLevel     = 2
+)
+
+const (
+	propertiesBlockName = "rocksdb.properties"
+	rangeDelBlockName   = "rocksdb.range_del"
+)
+
+const (
+	propertyIndexType             = "rocksdb.block.based.table.index.type"
+	propertyIndexKeyIsUserKey     = "rocksdb.index.key.is.user.key"
+	propertyIndexValueDeltaEncode = "rocksdb.index.value.is.delta.encoded"
+)
+
+// top bit is used as hash index flag
+var numRestartsPacked = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	s.Sym = s.ActualU() & 0x7fff_ffff
+	return s, nil
+})
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// stored crc is rotated and offset as crc of data with embedded crc is problematic
+func crc32cMask(crc uint32) uint32 {
+	return ((crc >> 15) | (crc << 17)) + 0xa282ead8
+}
+
+// little endian 7 bit groups, high bit means more bytes follows
+func decodeVarint(d *decode.D) uint64 {
+	var n uint64
+	for i := 0; i < maxVarintBytes; i++ {
+		b := d.U8()
+		n |= (b & 0x7f) << (i * 7)
+		if b&0x80 == 0 {
+			return n
+		}
+	}
+	d.Fatalf("varint longer than %d bytes", maxVarintBytes)
+	return 0
+}
+
+func decodeZigZagVarint(d *decode.D) int64 {
+	n := decodeVarint(d)
+	return int64(n>>1) ^ -int64(n&1)
+}
+
+func varintBytes(b []byte) (uint64, bool) {
+	n, l := binary.Uvarint(b)
+	return n, l > 0
+}
+
+type blockKind int
+
+const (
+	blockKindData blockKind = iota
+	blockKindIndex
+	blockKindMetaIndex
+	blockKindProperties
+	// not key/value block format, ex filter or compression dictionary
+	blockKindRaw
+)
+
+type blockHandle struct {
+	offset uint64
+	size   uint64
+}
+
+type blockEntry struct {
+	key    []byte
+	value  []byte
+	handle blockHandle
+}
+
+type decodeContext struct {
+	rocksDB          bool
+	formatVersion    uint64
+	checksumType     uint64
+	compressionNames scalar.UToSymStr
+	blocksEnd        int64
+	properties       map[string][]byte
+}
+
+func (dc *decodeContext) propertyU(name string, def uint64) uint64 {
+	if b, ok := dc.properties[name]; ok {
+		if n, ok := varintBytes(b); ok {
+			return n
+		}
+	}
+	return def
+}
+
+// leveldb index keys are always internal keys, rocksdb can write user keys since format version 3
+func (dc *decodeContext) indexKeyIsInternal() bool {
+	return dc.propertyU(propertyIndexKeyIsUserKey, 0) == 0
+}
+
+func (dc *decodeContext) indexValueIsDeltaEncoded() bool {
+	return dc.propertyU(propertyIndexValueDeltaEncode, 0) == 1
+}
+
+// rocksdb format version 2 and later prefix compressed contents with uncompressed size
+func (dc *decodeContext) hasUncompressedSize(compressionType uint64) bool {
+	if !dc.rocksDB || dc.formatVersion < 2 {
+		return false
+	}
+	switch compressionType {
+	case compressionZlib,
+		compressionBzip2,
+		compressionLZ4,
+		compressionLZ4HC,
+		compressionXpress,
+		compressionZstd:
+		return true
+	}
+	return false
+}
+
+func (dc *decodeContext) uncompress(compressionType uint64, uncompressedSize uint64, b []byte) ([]byte, error) {
+	if !dc.rocksDB && compressionType == compressionLevelDBZstd {
+		compressionType = compressionZstd
+	}
+
+	switch compressionType {
+	case compressionSnappy:
+		return snappy.Decode(nil, b)
+	case compressionZlib:
+		// raw deflate without zlib header
+		return io.ReadAll(flate.NewReader(bytes.NewReader(b)))
+	case compressionBzip2:
+		return io.ReadAll(bzip2.NewReader(bytes.NewReader(b)))
+	case compressionLZ4, compressionLZ4HC:
+		if uncompressedSize == 0 || uncompressedSize > math.MaxInt32 {
+			return nil, errors.New("unknown uncompressed size")
+		}
+		out := make([]byte, uncompressedSize)
+		n, err := lz4.UncompressBlock(b, out)
+		if err != nil {
+			return nil, err
+		}
+		return out[0:n], nil
+	case compressionZstd:
+		zd, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer zd.Close()
+		return zd.DecodeAll(b, nil)
+	default:
+		return nil, fmt.Errorf("unsupported compression type %d", compressionType)
+	}
+}
+
+func decodeBlockHandleFields(d *decode.D) blockHandle {
+	var h blockHandle
+	h.offset = d.FieldUFn("offset", decodeVarint)
+	h.size = d.FieldUFn("size", decodeVarint)
+	return h
+}
+
+func decodeFooterBlockHandle(d *decode.D, name string) blockHandle {
+	var h blockHandle
+	d.FieldStruct(name, func(d *decode.D) {
+		h = decodeBlockHandleFields(d)
+	})
+	return h
+}
+
+func decodeBlockContents(d *decode.D, dc *decodeContext, kind blockKind) []blockEntry {
+	d.Endian = decode.LittleEndian
+
+	if kind == blockKindRaw {
+		d.FieldRawLen("data", d.BitsLeft())
+		return nil
+	}
+
+	if d.BitsLeft() < 32 {
+		d.Fatalf("block too short")
+	}
+	var packed uint64
+	d.RangeFn(d.Len()-32, 32, func(d *decode.D) { packed = d.U32() })
+	// rocksdb use top bit to signal a data block hash index
+	hasHashIndex := dc.rocksDB && kind == blockKindData && packed&(1<<31) != 0
+	numRestarts := int64(packed & 0x7fff_ffff)
+
+	restartsEnd := d.Len() - 32
+	var numBuckets int64
+	if hasHashIndex {
+		if restartsEnd < 16 {
+			d.Fatalf("block too short for hash index")
+		}
+		d.RangeFn(restartsEnd-16, 16, func(d *decode.D) { numBuckets = int64(d.U16()) })
+		restartsEnd -= 16 + numBuckets*8
+	}
+	entriesEnd := restartsEnd - numRestarts*32
+	if entriesEnd < 0 {
+		d.Fatalf("%d restarts outside block", numRestarts)
+	}
+
+	internalKey := kind == blockKindData || (kind == blockKindIndex && dc.indexKeyIsInternal())
+	valueDeltaEncoded := kind == blockKindIndex && dc.indexValueIsDeltaEncoded()
+
+	var entries []blockEntry
+	d.FieldArray("entries", func(d *decode.D) {
+		var key []byte
+		var prevHandle blockHandle
+		for d.Pos() < entriesEnd {
+			d.FieldStruct("entry", func(d *decode.D) {
+				shared := d.FieldUFn("shared", decodeVarint)
+				nonShared := d.FieldUFn("non_shared", decodeVarint)
+				if shared > uint64(len(key)) {
+					d.Fatalf("shared %d longer than previous key", shared)
+				}
+				// delta encoded index values has no length, used for entries not at a restart point
+				valueLength := int64(-1)
+				if !valueDeltaEncoded {
+					valueLength = int64(d.FieldUFn("value_length", decodeVarint))
+				}
+				keyDeltaPos := d.Pos()
+				d.FieldRawLen("key_delta", int64(nonShared)*8)
+				key = append(key[0:shared:shared], d.BytesRange(keyDeltaPos, int(nonShared))...)
+
+				if internalKey {
+					if len(key) < 8 {
+						d.Fatalf("internal key shorter than 8 bytes")
+					}
+					userKey := key[0 : len(key)-8]
+					trailer := binary.LittleEndian.Uint64(key[len(key)-8:])
+					d.FieldValueStr("user_key", string(userKey))
+					d.FieldValueU("sequence", trailer>>8)
+					d.FieldValueU("value_type", trailer&0xff, valueTypeNames)
+				} else {
+					d.FieldValueStr("key", string(key))
+				}
+
+				e := blockEntry{key: append([]byte(nil), key...)}
+				if internalKey {
+					e.key = e.key[0 : len(e.key)-8]
+				}
+
+				switch kind {
+				case blockKindIndex, blockKindMetaIndex:
+					d.FieldStruct("value", func(d *decode.D) {
+						valueStart := d.Pos()
+						if valueDeltaEncoded && shared != 0 {
+							sizeDelta := d.FieldSFn("size_delta", decodeZigZagVarint)
+							e.handle.offset = prevHandle.offset + prevHandle.size + blockTrailerBytes
+							e.handle.size = uint64(int64(prevHandle.size) + sizeDelta)
+							d.FieldValueU("offset", e.handle.offset)
+							d.FieldValueU("size", e.handle.size)
+						} else {
+							e.handle = decodeBlockHandleFields(d)
+						}
+						if valueLength >= 0 {
+							// ex first key in index values
+							if unknownBits := valueStart + valueLength*8 - d.Pos(); unknownBits > 0 {
+								d.FieldRawLen("unknown", unknownBits)
+							} else if unknownBits < 0 {
+								d.Fatalf("block handle outside value")
+							}
+						}
+					})
+					prevHandle = e.handle
+				default:
+					valuePos := d.Pos()
+					d.FieldRawLen("value", valueLength*8)
+					e.value = d.BytesRange(valuePos, int(valueLength))
+				}
+				entries = append(entries, e)
+			})
+		}
+	})
+	if d.Pos() != entriesEnd {
+		d.Fatalf("entries outside restarts")
+	}
+
+	d.FieldArray("restarts", func(d *decode.D) {
+		for i := int64(0); i < numRestarts; i++ {
+			d.FieldU32("restart", d.ValidateURange(0, uint64(entriesEnd/8)))
+		}
+	})
+	if hasHashIndex {
+		d.FieldRawLen("hash_buckets", numBuckets*8)
+		d.FieldU16("num_buckets")
+	}
+	if dc.rocksDB && kind == blockKindData {
+		d.FieldU32("num_restarts", numRestartsPacked)
+		d.FieldValueBool("has_hash_index", hasHashIndex)
+	} else {
+		d.FieldU32("num_restarts")
+	}
+
+	return entries
+}
+
+func decodeBlock(d *decode.D, dc *decodeContext, h blockHandle, kind blockKind) []blockEntry {
+	if h.offset > uint64(dc.blocksEnd/8) || h.size+blockTrailerBytes > uint64(dc.blocksEnd/8)-h.offset {
+		d.Fatalf("block at %d size %d outside file", h.offset, h.size)
+	}
+	contentsPos := int64(h.offset) * 8
+	contentsEnd := contentsPos + int64(h.size)*8
+
+	var compressionType uint64
+	d.RangeFn(contentsEnd, 8, func(d *decode.D) { compressionType = d.U8() })
+
+	d.SeekAbs(contentsPos)
+	var entries []blockEntry
+	if compressionType == compressionNone {
+		d.FramedFn(int64(h.size)*8, func(d *decode.D) {
+			entries = decodeBlockContents(d, dc, kind)
+		})
+	} else {
+		var uncompressedSize uint64
+		if dc.hasUncompressedSize(compressionType) {
+			uncompressedSize = d.FieldUFn("uncompressed_size", decodeVarint)
+		}
+		if d.Pos() > contentsEnd {
+			d.Fatalf("uncompressed size outside block")
+		}
+		compressed := d.BytesRange(d.Pos(), int((contentsEnd-d.Pos())/8))
+		d.FieldRawLen("compressed", contentsEnd-d.Pos())
+		if uncompressed, err := dc.uncompress(compressionType, uncompressedSize, compressed); err == nil {
+			d.FieldStructRootBitBufFn("uncompressed", bitio.NewBitReader(uncompressed, -1), func(d *decode.D) {
+				entries = decodeBlockContents(d, dc, kind)
+			})
+		}
+	}
+
+	d.FieldU8("compression_type", dc.compressionNames)
+
+	// checksum is of contents and compression type
+	b := d.BytesRange(contentsPos, int(h.size)+1)
+	switch dc.checksumType {
+	case checksumCRC32C:
+		d.FieldU32("checksum", d.ValidateU(uint64(crc32cMask(crc32.Checksum(b, crc32cTable)))), scalar.ActualHex)
+	case checksumXXHash:
+		c := &checksum.XXH32{}
+		_, _ = c.Write(b)
+		d.FieldU32("checksum", d.ValidateU(uint64(c.Sum32())), scalar.ActualHex)
+	case checksumXXHash64:
+		c := &checksum.XXH64{}
+		_, _ = c.Write(b)
+		d.FieldU32("checksum", d.ValidateU(c.Sum64()&0xffff_ffff), scalar.ActualHex)
+	default:
+		d.FieldU32("checksum", scalar.ActualHex)
+	}
+
+	return entries
+}
+
+func metaBlockKind(name string) blockKind {
+	switch name {
+	case propertiesBlockName:
+		return blockKindProperties
+	case rangeDelBlockName:
+		return blockKindData
+	default:
+		return blockKindRaw
+	}
+}
+
+func sstableDecode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	if d.Len() < legacyFooterBytes*8 {
+		d.Fatalf("too short")
+	}
+	var magic uint64
+	d.RangeFn(d.Len()-64, 64, func(d *decode.D) { magic = d.U64() })
+
+	dc := &decodeContext{
+		checksumType:     checksumCRC32C,
+		compressionNames: levelDBCompressionNames,
+		properties:       map[string][]byte{},
+	}
+	var footerBytes int64
+	switch magic {
+	case legacyMagic:
+		footerBytes = legacyFooterBytes
+	case rocksDBMagic:
+		if d.Len() < rocksDBFooterBytes*8 {
+			d.Fatalf("too short")
+		}
+		dc.rocksDB = true
+		dc.compressionNames = rocksDBCompressionNames
+		footerBytes = rocksDBFooterBytes
+	default:
+		d.Fatalf("unknown magic %x", magic)
+	}
+	footerPos := d.Len() - footerBytes*8
+	dc.blocksEnd = footerPos
+
+	var metaIndexHandle blockHandle
+	var indexHandle blockHandle
+	d.SeekAbs(footerPos)
+	d.FieldStruct("footer", func(d *decode.D) {
+		handlesStart := d.Pos()
+		if dc.rocksDB {
+			dc.checksumType = d.FieldU8("checksum_type", checksumTypeNames)
+			handlesStart = d.Pos()
+			// format version is needed to know how to decode handles
+			d.RangeFn(d.Len()-12*8, 32, func(d *decode.D) { dc.formatVersion = d.U32() })
+		}
+		if dc.formatVersion >= 6 {
+			// metaindex is just before footer and index handle is in metaindex
+			d.FieldRawLen("extended_magic", 4*8, d.AssertBitBuf([]byte{0x3e, 0x00, 0x7a, 0x00}))
+			d.FieldU32("footer_checksum", scalar.ActualHex)
+			d.FieldU32("base_context_checksum", scalar.ActualHex)
+			d.FieldU32("metaindex_size")
+		} else {
+			metaIndexHandle = decodeFooterBlockHandle(d, "metaindex_handle")
+			indexHandle = decodeFooterBlockHandle(d, "index_handle")
+		}
+		d.FieldRawLen("padding", handlesStart+handlesBytes*8-d.Pos())
+		if dc.rocksDB {
+			d.FieldU32("format_version")
+		}
+		d.FieldU64("magic", magicNames, scalar.ActualHex)
+	})
+	if dc.formatVersion >= 6 {
+		// block checksums are also modified by offset so leave blocks undecoded
+		return nil
+	}
+
+	var metaEntries []blockEntry
+	d.FieldStruct("metaindex_block", func(d *decode.D) {
+		metaEntries = decodeBlock(d, dc, metaIndexHandle, blockKindMetaIndex)
+	})
+	d.FieldArray("meta_blocks", func(d *decode.D) {
+		for _, e := range metaEntries {
+			d.FieldStruct("meta_block", func(d *decode.D) {
+				name := string(e.key)
+				d.FieldValueStr("name", name)
+				kind := metaBlockKind(name)
+				entries := decodeBlock(d, dc, e.handle, kind)
+				if kind == blockKindProperties {
+					for _, pe := range entries {
+						dc.properties[string(pe.key)] = pe.value
+					}
+				}
+			})
+		}
+	})
+
+	var indexEntries []blockEntry
+	d.FieldStruct("index_block", func(d *decode.D) {
+		indexEntries = decodeBlock(d, dc, indexHandle, blockKindIndex)
+	})
+	// partitioned index where top level index points to index blocks
+	if dc.propertyU(propertyIndexType, indexTypeBinarySearch) == indexTypeTwoLevel {
+		var partitionEntries []blockEntry
+		d.FieldArray("index_partitions", func(d *decode.D) {
+			for _, e := range indexEntries {
+				d.FieldStruct("index_block", func(d *decode.D) {
+					partitionEntries = append(partitionEntries, decodeBlock(d, dc, e.handle, blockKindIndex)...)
+				})
+			}
+		})
+		indexEntries = partitionEntries
+	}
+
+	d.FieldArray("data_blocks", func(d *decode.D) {
+		for _, e := range indexEntries {
+			d.FieldStruct("data_block", func(d *decode.D) {
+				decodeBlock(d, dc, e.handle, blockKindData)
+			})
+		}
+	})
+
+	return nil
+}
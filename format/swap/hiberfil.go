@@ -0,0 +1,107 @@
+package swap
+
+// https://www.blackhat.com/presentations/bh-usa-08/Suiche/BH_US_08_Suiche_Windows_hibernation.pdf
+// https://github.com/volatilityfoundation/volatility/blob/master/volatility/plugins/overlays/windows/win7_sp01_x64_vtypes.py
+// Only the start of PO_MEMORY_IMAGE is stable between Windows versions, rest of header
+// is version specific. pagefile.sys and swapfile.sys has no header and are just pages.
+// TODO: decode memory range tables and xpress compressed page runs
+
+import (
+	"embed"
+	"encoding/binary"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed hiberfil.jq
+var hiberfilFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.HIBERFIL,
+		Description: "Windows hibernation file (hiberfil.sys) header",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    hiberfilDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(hiberfilFS)
+}
+
+const hiberfilPageSize = 4096
+
+var hiberfilSignatureNames = scalar.StrToDescription{
+	"hibr": "Hibernated",
+	"HIBR": "Hibernated",
+	"wake": "Resumed",
+	"WAKE": "Resumed",
+	"rstr": "Restoring",
+	"RSTR": "Restoring",
+	"link": "Linked",
+	"LINK": "Linked",
+}
+
+// FILETIME, 100ns intervals since 1601-01-01
+const filetimeUnixEpochDiff = 11644473600
+
+var descriptionFiletime = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	v := s.ActualU()
+	if v == 0 {
+		return s, nil
+	}
+	s.Description = time.Unix(int64(v/10_000_000)-filetimeUnixEpochDiff, int64(v%10_000_000)*100).UTC().Format(time.RFC3339)
+	return s, nil
+})
+
+func hiberfilDecode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	sig := string(d.PeekBytes(4))
+	if _, ok := hiberfilSignatureNames[sig]; !ok {
+		d.Fatalf("unknown signature %q", sig)
+	}
+
+	// PageSelf is 64 bit on 64 bit systems which moves PageSize 4 bytes
+	var is64 bool
+	switch {
+	case binary.LittleEndian.Uint32(d.BytesRange(0x18*8, 4)) == hiberfilPageSize:
+		is64 = true
+	case binary.LittleEndian.Uint32(d.BytesRange(0x14*8, 4)) == hiberfilPageSize:
+	default:
+		d.Fatalf("page size not found")
+	}
+
+	var lengthSelf uint64
+	d.FramedFn(hiberfilPageSize*8, func(d *decode.D) {
+		d.FieldStruct("header", func(d *decode.D) {
+			d.FieldUTF8("signature", 4, hiberfilSignatureNames)
+			d.FieldU32("image_type")
+			d.FieldU32("checksum", scalar.ActualHex)
+			lengthSelf = d.FieldU32("length_self")
+			if is64 {
+				d.FieldU64("page_self")
+				d.FieldU32("page_size")
+				d.FieldRawLen("reserved0", 4*8)
+			} else {
+				d.FieldU32("page_self")
+				d.FieldU32("page_size")
+				d.FieldRawLen("reserved0", 8*8)
+			}
+			d.FieldU64("system_time", descriptionFiletime)
+			d.FieldU64("interrupt_time")
+			if lengthSelf > uint64(d.Pos()/8) && lengthSelf <= hiberfilPageSize {
+				d.FieldRawLen("version_specific", int64(lengthSelf)*8-d.Pos())
+			}
+			d.FieldRawLen("reserved1", d.BitsLeft())
+		})
+	})
+
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("pages", d.BitsLeft())
+	}
+
+	return nil
+}
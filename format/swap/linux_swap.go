@@ -0,0 +1,229 @@
+package swap
+
+// https://github.com/torvalds/linux/blob/master/include/linux/swap.h
+// https://github.com/torvalds/linux/blob/master/kernel/power/swap.c
+// https://github.com/torvalds/linux/blob/master/kernel/power/power.h
+// TODO: uswsusp and tuxonice signatures
+// TODO: decompress lzo/lz4 compressed image data
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed linux_swap.jq
+var linuxSwapFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.LINUX_SWAP,
+		Description: "Linux swap area and hibernation image",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    linuxSwapDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(linuxSwapFS)
+}
+
+const (
+	swapMagicLen    = 10
+	bootBitsSize    = 1024
+	swapInfoPadding = 117
+	swsuspTailSize  = 40
+	// sanity limit when following map page chain
+	maxMapPages = 1 << 20
+)
+
+var pageSizes = []int64{4096, 8192, 16384, 65536}
+
+const (
+	magicSwapSpace2 = "SWAPSPACE2"
+	magicSwapSpace  = "SWAP-SPACE"
+	magicHibernate  = "S1SUSPEND\x00"
+)
+
+var magicNames = scalar.StrToDescription{
+	magicSwapSpace2: "Swap version 1",
+	magicSwapSpace:  "Swap version 0 (obsolete)",
+	magicHibernate:  "Hibernation image",
+}
+
+func findPageSize(d *decode.D) (int64, string) {
+	for _, ps := range pageSizes {
+		if d.Len() < ps*8 {
+			break
+		}
+		magic := string(d.BytesRange((ps-swapMagicLen)*8, swapMagicLen))
+		switch magic {
+		case magicSwapSpace2, magicSwapSpace, magicHibernate:
+			return ps, magic
+		}
+	}
+	return 0, ""
+}
+
+func versionCode(v uint64) string {
+	return fmt.Sprintf("%d.%d.%d", v>>16, (v>>8)&0xff, v&0xff)
+}
+
+// swsusp_info is the first page of the image and is stored uncompressed
+func decodeSwsuspInfo(d *decode.D) {
+	var machine string
+	d.FieldStruct("utsname", func(d *decode.D) {
+		d.FieldUTF8NullFixedLen("sysname", 65)
+		d.FieldUTF8NullFixedLen("nodename", 65)
+		d.FieldUTF8NullFixedLen("release", 65)
+		d.FieldUTF8NullFixedLen("version", 65)
+		machine = d.FieldUTF8NullFixedLen("machine", 65)
+		d.FieldUTF8NullFixedLen("domainname", 65)
+	})
+	// unsigned long is native word size
+	is64 := strings.Contains(machine, "64") || machine == "s390x"
+	d.FieldRawLen("padding0", 2*8)
+	d.FieldU32("version_code", scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		s.Description = versionCode(s.ActualU())
+		return s, nil
+	}))
+	if is64 {
+		d.FieldRawLen("padding1", 4*8)
+		d.FieldU64("num_physpages")
+		d.FieldS32("cpus")
+		d.FieldRawLen("padding2", 4*8)
+		d.FieldU64("image_pages")
+		d.FieldU64("pages")
+		d.FieldU64("size")
+	} else {
+		d.FieldU32("num_physpages")
+		d.FieldS32("cpus")
+		d.FieldU32("image_pages")
+		d.FieldU32("pages")
+		d.FieldU32("size")
+	}
+}
+
+func decodeHibernationImage(d *decode.D, pageSize int64, firstMapPage uint64) {
+	entriesPerPage := pageSize/8 - 1
+	var firstDataPage uint64
+
+	d.FieldArray("map_pages", func(d *decode.D) {
+		seen := map[uint64]bool{}
+		next := firstMapPage
+		for next != 0 && !seen[next] && len(seen) < maxMapPages {
+			seen[next] = true
+			pos := int64(next) * pageSize * 8
+			if pos+pageSize*8 > d.Len() {
+				d.Errorf("map page %d outside swap area", next)
+				break
+			}
+			d.RangeFn(pos, pageSize*8, func(d *decode.D) {
+				d.FieldStruct("map_page", func(d *decode.D) {
+					d.FieldValueU("page", next)
+					d.FieldArray("entries", func(d *decode.D) {
+						for i := int64(0); i < entriesPerPage; i++ {
+							if d.PeekBits(64) == 0 {
+								break
+							}
+							e := d.FieldU64("entry")
+							if firstDataPage == 0 {
+								firstDataPage = e
+							}
+						}
+					})
+					d.FieldRawLen("unused", d.Len()-d.Pos()-64)
+					next = d.FieldU64("next_swap")
+				})
+			})
+		}
+	})
+
+	if firstDataPage != 0 && int64(firstDataPage+1)*pageSize*8 <= d.Len() {
+		d.RangeFn(int64(firstDataPage)*pageSize*8, pageSize*8, func(d *decode.D) {
+			d.FieldStruct("info", decodeSwsuspInfo)
+		})
+	}
+}
+
+func linuxSwapDecode(d *decode.D, _ any) any {
+	pageSize, magic := findPageSize(d)
+	if pageSize == 0 {
+		d.Fatalf("no swap signature found")
+	}
+
+	// header is in native byte order, version is always 1
+	d.Endian = decode.LittleEndian
+	d.SeekAbs(bootBitsSize * 8)
+	if d.U32BE() == 1 {
+		d.Endian = decode.BigEndian
+	}
+	d.SeekAbs(0)
+
+	d.FieldValueU("page_size", uint64(pageSize))
+
+	var image uint64
+	d.FramedFn(pageSize*8, func(d *decode.D) {
+		d.FieldStruct("header", func(d *decode.D) {
+			d.FieldRawLen("boot_bits", bootBitsSize*8)
+			if magic == magicSwapSpace {
+				// version 0 has a bitmap of usable pages instead of info
+				d.FieldRawLen("page_bitmap", (pageSize-bootBitsSize-swapMagicLen)*8)
+				d.FieldUTF8("magic", swapMagicLen, magicNames)
+				return
+			}
+
+			d.FieldU32("version")
+			d.FieldU32("last_page")
+			nrBadPages := d.FieldU32("nr_badpages")
+			d.FieldRawLen("uuid", 16*8, scalar.RawUUID)
+			d.FieldUTF8NullFixedLen("volume_name", 16)
+			d.FieldRawLen("padding", swapInfoPadding*4*8)
+			maxBadPages := (pageSize*8 - d.Pos() - swsuspTailSize*8) / 32
+			if int64(nrBadPages) > maxBadPages {
+				d.Errorf("nr_badpages %d larger than max %d", nrBadPages, maxBadPages)
+				nrBadPages = uint64(maxBadPages)
+			}
+			d.FieldArray("bad_pages", func(d *decode.D) {
+				for i := uint64(0); i < nrBadPages; i++ {
+					d.FieldU32("bad_page")
+				}
+			})
+
+			if magic == magicHibernate {
+				d.FieldRawLen("reserved", (pageSize-swsuspTailSize)*8-d.Pos())
+				d.FieldU32("hw_sig", scalar.ActualHex)
+				d.FieldU32("crc32", scalar.ActualHex)
+				image = d.FieldU64("image")
+				d.FieldStruct("flags", func(d *decode.D) {
+					flags := d.FieldU32("raw", scalar.ActualHex)
+					d.FieldValueBool("platform_mode", flags&1 != 0)
+					d.FieldValueBool("nocompress_mode", flags&2 != 0)
+					d.FieldValueBool("crc32_mode", flags&4 != 0)
+					d.FieldValueBool("hw_sig", flags&8 != 0)
+					d.FieldValueBool("lz4_mode", flags&16 != 0)
+				})
+				d.FieldUTF8("orig_magic", swapMagicLen, magicNames)
+			} else {
+				d.FieldRawLen("reserved", (pageSize-swapMagicLen)*8-d.Pos())
+			}
+			d.FieldUTF8("magic", swapMagicLen, magicNames)
+		})
+	})
+
+	if image != 0 {
+		d.FieldStruct("hibernation_image", func(d *decode.D) {
+			decodeHibernationImage(d, pageSize, image)
+		})
+	}
+
+	// rest is swapped out pages
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("pages", d.BitsLeft())
+	}
+
+	return nil
+}
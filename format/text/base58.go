@@ -0,0 +1,132 @@
+package text
+
+// https://datatracker.ietf.org/doc/html/draft-msporny-base58
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/interp"
+)
+
+var base58Alphabets = map[string]string{
+	"bitcoin": "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz",
+	"flickr":  "123456789abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ",
+}
+
+// leading zero bytes are encoded as leading first alphabet characters
+func base58Encode(b []byte, alphabet string) string {
+	zeros := 0
+	for zeros < len(b) && b[zeros] == 0 {
+		zeros++
+	}
+
+	// little endian base 58 digits
+	var digits []byte
+	for _, c := range b[zeros:] {
+		carry := int(c)
+		for i := range digits {
+			carry += int(digits[i]) << 8
+			digits[i] = byte(carry % 58)
+			carry /= 58
+		}
+		for carry > 0 {
+			digits = append(digits, byte(carry%58))
+			carry /= 58
+		}
+	}
+
+	out := make([]byte, 0, zeros+len(digits))
+	for i := 0; i < zeros; i++ {
+		out = append(out, alphabet[0])
+	}
+	for i := len(digits) - 1; i >= 0; i-- {
+		out = append(out, alphabet[digits[i]])
+	}
+	return string(out)
+}
+
+func base58Decode(s string, alphabet string) ([]byte, error) {
+	var index [256]int
+	for i := range index {
+		index[i] = -1
+	}
+	for i := 0; i < len(alphabet); i++ {
+		index[alphabet[i]] = i
+	}
+
+	zeros := 0
+	for zeros < len(s) && s[zeros] == alphabet[0] {
+		zeros++
+	}
+
+	// little endian base 256 bytes
+	var bs []byte
+	for i := zeros; i < len(s); i++ {
+		carry := index[s[i]]
+		if carry < 0 {
+			return nil, fmt.Errorf("illegal base58 data at input byte %d", i)
+		}
+		for j := range bs {
+			carry += int(bs[j]) * 58
+			bs[j] = byte(carry)
+			carry >>= 8
+		}
+		for carry > 0 {
+			bs = append(bs, byte(carry))
+			carry >>= 8
+		}
+	}
+
+	out := make([]byte, zeros, zeros+len(bs))
+	for i := len(bs) - 1; i >= 0; i-- {
+		out = append(out, bs[i])
+	}
+	return out, nil
+}
+
+func init() {
+	type base58Opts struct {
+		Alphabet string
+	}
+	base58Alphabet := func(opts base58Opts) (string, error) {
+		a, ok := base58Alphabets[opts.Alphabet]
+		if !ok {
+			return "", fmt.Errorf("unknown base58 alphabet %s", opts.Alphabet)
+		}
+		return a, nil
+	}
+
+	interp.RegisterFunc1("_frombase58", func(_ *interp.Interp, c string, opts base58Opts) any {
+		alphabet, err := base58Alphabet(opts)
+		if err != nil {
+			return err
+		}
+		b, err := base58Decode(c, alphabet)
+		if err != nil {
+			return err
+		}
+		bin, err := interp.NewBinaryFromBitReader(bitio.NewBitReader(b, -1), 8, 0)
+		if err != nil {
+			return err
+		}
+		return bin
+	})
+	interp.RegisterFunc1("_tobase58", func(_ *interp.Interp, c string, opts base58Opts) any {
+		alphabet, err := base58Alphabet(opts)
+		if err != nil {
+			return err
+		}
+		br, err := interp.ToBitReader(c)
+		if err != nil {
+			return err
+		}
+		bb := &bytes.Buffer{}
+		if _, err := io.Copy(bb, bitio.NewIOReader(br)); err != nil {
+			return err
+		}
+		return base58Encode(bb.Bytes(), alphabet)
+	})
+}
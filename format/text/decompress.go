@@ -0,0 +1,69 @@
+package text
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/interp"
+)
+
+func init() {
+	interp.RegisterFunc0("inflate", makeDecompressFn(func(r io.Reader) (io.Reader, error) {
+		return flate.NewReader(r), nil
+	}))
+	interp.RegisterFunc0("gunzip", makeDecompressFn(func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	}))
+	interp.RegisterFunc0("unzstd", makeDecompressFn(func(r io.Reader) (io.Reader, error) {
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}))
+	interp.RegisterFunc0("unlz4", makeDecompressFn(func(r io.Reader) (io.Reader, error) {
+		return lz4.NewReader(r), nil
+	}))
+	interp.RegisterFunc0("unxz", makeDecompressFn(func(r io.Reader) (io.Reader, error) {
+		return xz.NewReader(r)
+	}))
+	interp.RegisterFunc0("unbrotli", makeDecompressFn(func(r io.Reader) (io.Reader, error) {
+		return brotli.NewReader(r), nil
+	}))
+}
+
+// decompress binary using fn into new binary
+func makeDecompressFn(fn func(r io.Reader) (io.Reader, error)) func(_ *interp.Interp, c any) any {
+	return func(_ *interp.Interp, c any) any {
+		inBR, err := interp.ToBitReader(c)
+		if err != nil {
+			return err
+		}
+
+		r, err := fn(bitio.NewIOReader(inBR))
+		if err != nil {
+			return err
+		}
+		if rc, ok := r.(io.Closer); ok {
+			defer rc.Close()
+		}
+
+		outBuf := &bytes.Buffer{}
+		if _, err := io.Copy(outBuf, r); err != nil {
+			return err
+		}
+
+		bb, err := interp.NewBinaryFromBitReader(bitio.NewBitReader(outBuf.Bytes(), -1), 8, 0)
+		if err != nil {
+			return err
+		}
+		return bb
+	}
+}
@@ -3,6 +3,8 @@ package text
 import (
 	"bytes"
 	"embed"
+	"encoding/ascii85"
+	"encoding/base32"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
@@ -87,6 +89,75 @@ func init() {
 		return bb.String()
 	})
 
+	base32Encoding := func(enc string) *base32.Encoding {
+		switch enc {
+		case "hex":
+			return base32.HexEncoding
+		case "rawstd":
+			return base32.StdEncoding.WithPadding(base32.NoPadding)
+		case "rawhex":
+			return base32.HexEncoding.WithPadding(base32.NoPadding)
+		default:
+			return base32.StdEncoding
+		}
+	}
+	type fromBase32Opts struct {
+		Encoding string
+	}
+	interp.RegisterFunc1("_frombase32", func(_ *interp.Interp, c string, opts fromBase32Opts) any {
+		b, err := base32Encoding(opts.Encoding).DecodeString(c)
+		if err != nil {
+			return err
+		}
+		bin, err := interp.NewBinaryFromBitReader(bitio.NewBitReader(b, -1), 8, 0)
+		if err != nil {
+			return err
+		}
+		return bin
+	})
+	type toBase32Opts struct {
+		Encoding string
+	}
+	interp.RegisterFunc1("_tobase32", func(_ *interp.Interp, c string, opts toBase32Opts) any {
+		br, err := interp.ToBitReader(c)
+		if err != nil {
+			return err
+		}
+		bb := &bytes.Buffer{}
+		wc := base32.NewEncoder(base32Encoding(opts.Encoding), bb)
+		if _, err := io.Copy(wc, bitio.NewIOReader(br)); err != nil {
+			return err
+		}
+		wc.Close()
+		return bb.String()
+	})
+
+	// ascii85 without <~ ~> delimiters, decode ignores whitespace
+	interp.RegisterFunc0("frombase85", func(_ *interp.Interp, c string) any {
+		bb := &bytes.Buffer{}
+		if _, err := io.Copy(bb, ascii85.NewDecoder(strings.NewReader(c))); err != nil {
+			return err
+		}
+		bin, err := interp.NewBinaryFromBitReader(bitio.NewBitReader(bb.Bytes(), -1), 8, 0)
+		if err != nil {
+			return err
+		}
+		return bin
+	})
+	interp.RegisterFunc0("tobase85", func(_ *interp.Interp, c string) any {
+		br, err := interp.ToBitReader(c)
+		if err != nil {
+			return err
+		}
+		bb := &bytes.Buffer{}
+		wc := ascii85.NewEncoder(bb)
+		if _, err := io.Copy(wc, bitio.NewIOReader(br)); err != nil {
+			return err
+		}
+		wc.Close()
+		return bb.String()
+	})
+
 	strEncoding := func(s string) encoding.Encoding {
 		switch s {
 		case "UTF8":
@@ -0,0 +1,146 @@
+package text
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/interp"
+)
+
+type stringsOpts struct {
+	MinLength int
+	Encoding  string
+}
+
+type stringsMatch struct {
+	offset   int
+	encoding string
+	s        string
+}
+
+func (m stringsMatch) toMap() map[string]any {
+	return map[string]any{
+		"offset":   m.offset,
+		"encoding": m.encoding,
+		"string":   m.s,
+	}
+}
+
+func isStringsRune(r rune) bool {
+	return r == '\t' || unicode.IsPrint(r)
+}
+
+func isStringsASCII(b byte) bool {
+	return b == '\t' || (b >= 0x20 && b <= 0x7e)
+}
+
+// runs of printable runes, pure ascii runs are reported as ascii
+func findStringsUTF8(b []byte, minLength int, asciiOnly bool) []stringsMatch {
+	var ms []stringsMatch
+	start := -1
+	n := 0
+	ascii := true
+	emit := func(end int) {
+		if start != -1 && n >= minLength {
+			enc := "utf8"
+			if ascii {
+				enc = "ascii"
+			}
+			ms = append(ms, stringsMatch{offset: start, encoding: enc, s: string(b[start:end])})
+		}
+		start = -1
+		n = 0
+		ascii = true
+	}
+
+	for i := 0; i < len(b); {
+		r, size := rune(b[i]), 1
+		ok := isStringsASCII(b[i])
+		if b[i] >= utf8.RuneSelf && !asciiOnly {
+			r, size = utf8.DecodeRune(b[i:])
+			ok = r != utf8.RuneError && isStringsRune(r)
+		}
+		if !ok {
+			emit(i)
+			i++
+			continue
+		}
+		if start == -1 {
+			start = i
+		}
+		if r >= utf8.RuneSelf {
+			ascii = false
+		}
+		n++
+		i += size
+	}
+	emit(len(b))
+
+	return ms
+}
+
+// runs of printable ascii code units at any alignment, same as strings -el
+func findStringsUTF16LE(b []byte, minLength int) []stringsMatch {
+	var ms []stringsMatch
+	for i := 0; i+1 < len(b); {
+		j := i
+		for j+1 < len(b) && isStringsASCII(b[j]) && b[j+1] == 0 {
+			j += 2
+		}
+		if (j-i)/2 >= minLength {
+			s := make([]byte, 0, (j-i)/2)
+			for k := i; k < j; k += 2 {
+				s = append(s, b[k])
+			}
+			ms = append(ms, stringsMatch{offset: i, encoding: "utf16le", s: string(s)})
+			i = j
+			continue
+		}
+		i++
+	}
+	return ms
+}
+
+func init() {
+	interp.RegisterFunc1("_strings", func(_ *interp.Interp, c any, opts stringsOpts) any {
+		if opts.MinLength < 1 {
+			return fmt.Errorf("min_length must be at least 1")
+		}
+
+		br, err := interp.ToBitReader(c)
+		if err != nil {
+			return err
+		}
+		buf := &bytes.Buffer{}
+		if _, err := io.Copy(buf, bitio.NewIOReader(br)); err != nil {
+			return err
+		}
+		b := buf.Bytes()
+
+		var ms []stringsMatch
+		switch opts.Encoding {
+		case "ascii":
+			ms = findStringsUTF8(b, opts.MinLength, true)
+		case "utf8":
+			ms = findStringsUTF8(b, opts.MinLength, false)
+		case "utf16le":
+			ms = findStringsUTF16LE(b, opts.MinLength)
+		case "all":
+			ms = append(findStringsUTF8(b, opts.MinLength, false), findStringsUTF16LE(b, opts.MinLength)...)
+			sort.SliceStable(ms, func(i, j int) bool { return ms[i].offset < ms[j].offset })
+		default:
+			return fmt.Errorf("unknown encoding %s", opts.Encoding)
+		}
+
+		vs := make([]any, len(ms))
+		for i, m := range ms {
+			vs[i] = m.toMap()
+		}
+		return vs
+	})
+}
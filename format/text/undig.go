@@ -0,0 +1,177 @@
+package text
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/interp"
+)
+
+// sanity limit on decompressed size per step
+const undigMaxSize = 64 * 1024 * 1024
+
+// shorter strings are too likely to be words that happen to be valid hex or base64
+const undigMinLen = 8
+
+var undigHexRe = regexp.MustCompile(`^([0-9a-fA-F]{2})+$`)
+var undigBase64Re = regexp.MustCompile(`^[A-Za-z0-9+/]+={0,2}$`)
+var undigBase64URLRe = regexp.MustCompile(`^[A-Za-z0-9\-_]+={0,2}$`)
+var undigPercentRe = regexp.MustCompile(`%[0-9a-fA-F]{2}`)
+
+func undigIsText(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && r != '\t' && r != '\n' && r != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+func undigIsGzip(b []byte) bool {
+	return len(b) >= 3 && b[0] == 0x1f && b[1] == 0x8b && b[2] == 0x08
+}
+
+func undigIsZlib(b []byte) bool {
+	// deflate with window size <= 32K and header checksum
+	return len(b) >= 2 && b[0]&0x0f == 8 && b[0]>>4 <= 7 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
+
+func undigDecompress(r io.Reader, err error) ([]byte, bool) {
+	if err != nil {
+		return nil, false
+	}
+	b, err := io.ReadAll(io.LimitReader(r, undigMaxSize))
+	if err != nil || len(b) == 0 {
+		return nil, false
+	}
+	return b, true
+}
+
+// base64 of binary data is accepted if padded or looks random enough, mixed case and digits
+func undigLooksRandom(s string) bool {
+	if strings.HasSuffix(s, "=") {
+		return true
+	}
+	var upper, lower, digit bool
+	for _, r := range s {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= '0' && r <= '9':
+			digit = true
+		}
+	}
+	return len(s) >= 16 && upper && lower && digit
+}
+
+func undigInteresting(b []byte) bool {
+	return undigIsText(b) || undigIsGzip(b) || undigIsZlib(b)
+}
+
+// undigStep tries to detect and decode one encoding layer
+func undigStep(b []byte) (string, []byte, bool) {
+	if undigIsGzip(b) {
+		if ub, ok := undigDecompress(gzip.NewReader(bytes.NewReader(b))); ok {
+			return "gzip", ub, true
+		}
+	}
+	if undigIsZlib(b) {
+		if ub, ok := undigDecompress(zlib.NewReader(bytes.NewReader(b))); ok {
+			return "zlib", ub, true
+		}
+	}
+
+	if !undigIsText(b) {
+		return "", nil, false
+	}
+	s := string(bytes.TrimSpace(b))
+	if len(s) < undigMinLen {
+		return "", nil, false
+	}
+
+	if undigPercentRe.MatchString(s) {
+		// path unescape to not turn "+" in base64 into space
+		if us, err := url.PathUnescape(s); err == nil && us != s {
+			return "url", []byte(us), true
+		}
+	}
+	if undigHexRe.MatchString(s) {
+		if hb, err := hex.DecodeString(s); err == nil {
+			return "hex", hb, true
+		}
+	}
+	var enc *base64.Encoding
+	switch {
+	case undigBase64Re.MatchString(s):
+		enc = base64.StdEncoding
+	case undigBase64URLRe.MatchString(s):
+		enc = base64.URLEncoding
+	}
+	if enc != nil {
+		if len(s)%4 != 0 {
+			enc = enc.WithPadding(base64.NoPadding)
+		}
+		if bb, err := enc.DecodeString(s); err == nil && len(bb) > 0 && (undigInteresting(bb) || undigLooksRandom(s)) {
+			return "base64", bb, true
+		}
+	}
+
+	return "", nil, false
+}
+
+func init() {
+	type undigOpts struct {
+		Depth int
+	}
+	interp.RegisterFunc1("_undig", func(_ *interp.Interp, c any, opts undigOpts) any {
+		br, err := interp.ToBitReader(c)
+		if err != nil {
+			return err
+		}
+		b, err := io.ReadAll(bitio.NewIOReader(br))
+		if err != nil {
+			return err
+		}
+
+		chain := []any{}
+		for len(chain) < opts.Depth {
+			name, nb, ok := undigStep(b)
+			if !ok {
+				break
+			}
+			chain = append(chain, name)
+			b = nb
+		}
+
+		var v any
+		if undigIsText(b) {
+			v = string(b)
+		} else {
+			bb, err := interp.NewBinaryFromBitReader(bitio.NewBitReader(b, -1), 8, 0)
+			if err != nil {
+				return err
+			}
+			v = bb
+		}
+
+		return map[string]any{
+			"value": v,
+			"chain": chain,
+		}
+	})
+}
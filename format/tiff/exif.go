@@ -1,7 +1,6 @@
 package tiff
 
 // https://exiftool.org/TagNames/EXIF.html
-// TODO: JPEGInterchangeFormat/JPEGInterchangeFormatLength, seem to just after the exif tag usually?
 
 import (
 	"github.com/wader/fq/format"
@@ -17,5 +16,9 @@ func init() {
 		Description: "Exchangeable Image File Format",
 		Groups:      []string{},
 		DecodeFn:    tiffDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.ICC_PROFILE}, Group: &tiffIccProfile},
+			{Names: []string{format.JPEG}, Group: &tiffJpeg},
+		},
 	})
 }
@@ -0,0 +1,251 @@
+package tiff
+
+// https://exiftool.org/makernote_types.html
+// https://exiftool.org/TagNames/Canon.html
+// https://exiftool.org/TagNames/Nikon.html
+// TODO: more makers, olympus, fujifilm, sony etc
+// TODO: decode canon and nikon binary data tags
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const (
+	makerNoteUnknown = iota
+	// IFD without header, offsets relative to tiff header
+	makerNoteCanon
+	// "Nikon\0" header followed by IFD, offsets relative to tiff header
+	makerNoteNikon2
+	// "Nikon\0" header followed by a embedded tiff header, offsets relative to it
+	makerNoteNikon3
+)
+
+const nikonSignature = "Nikon\x00"
+
+var canonTagNames = scalar.UToSymStr{
+	0x0001: "CanonCameraSettings",
+	0x0002: "CanonFocalLength",
+	0x0003: "CanonFlashInfo",
+	0x0004: "CanonShotInfo",
+	0x0005: "CanonPanorama",
+	0x0006: "CanonImageType",
+	0x0007: "CanonFirmwareVersion",
+	0x0008: "FileNumber",
+	0x0009: "OwnerName",
+	0x000c: "SerialNumber",
+	0x000d: "CanonCameraInfo",
+	0x000e: "CanonFileLength",
+	0x000f: "CustomFunctions",
+	0x0010: "CanonModelID",
+	0x0012: "CanonAFInfo",
+	0x0013: "ThumbnailImageValidArea",
+	0x0015: "SerialNumberFormat",
+	0x001a: "SuperMacro",
+	0x001c: "DateStampMode",
+	0x001d: "MyColors",
+	0x001e: "FirmwareRevision",
+	0x0023: "Categories",
+	0x0024: "FaceDetect1",
+	0x0025: "FaceDetect2",
+	0x0026: "CanonAFInfo2",
+	0x0027: "ContrastInfo",
+	0x0028: "ImageUniqueID",
+	0x0029: "WBInfo",
+	0x002f: "FaceDetect3",
+	0x0035: "TimeInfo",
+	0x0038: "BatteryType",
+	0x003c: "AFInfo3",
+	0x0081: "RawDataOffset",
+	0x0083: "OriginalDecisionDataOffset",
+	0x0090: "CustomFunctions1D",
+	0x0091: "PersonalFunctions",
+	0x0092: "PersonalFunctionValues",
+	0x0093: "CanonFileInfo",
+	0x0094: "AFPointsInFocus1D",
+	0x0095: "LensModel",
+	0x0096: "SerialInfo",
+	0x0097: "DustRemovalData",
+	0x0098: "CropInfo",
+	0x0099: "CustomFunctions2",
+	0x009a: "AspectInfo",
+	0x00a0: "ProcessingInfo",
+	0x00a1: "ToneCurveTable",
+	0x00a2: "SharpnessTable",
+	0x00a3: "SharpnessFreqTable",
+	0x00a4: "WhiteBalanceTable",
+	0x00a9: "ColorBalance",
+	0x00aa: "MeasuredColor",
+	0x00ae: "ColorTemperature",
+	0x00b0: "CanonFlags",
+	0x00b1: "ModifiedInfo",
+	0x00b2: "ToneCurveMatching",
+	0x00b3: "WhiteBalanceMatching",
+	0x00b4: "ColorSpace",
+	0x00b6: "PreviewImageInfo",
+	0x00d0: "VRDOffset",
+	0x00e0: "SensorInfo",
+	0x4001: "ColorData",
+	0x4002: "CRWParam",
+	0x4003: "ColorInfo",
+	0x4005: "Flavor",
+	0x4008: "PictureStyleUserDef",
+	0x4009: "PictureStylePC",
+	0x4010: "CustomPictureStyleFileName",
+	0x4013: "AFMicroAdj",
+	0x4015: "VignettingCorr",
+	0x4016: "VignettingCorr2",
+	0x4018: "LightingOpt",
+	0x4019: "LensInfo",
+	0x4020: "AmbienceInfo",
+	0x4021: "MultiExp",
+	0x4024: "FilterInfo",
+	0x4025: "HDRInfo",
+	0x4028: "AFConfig",
+}
+
+var nikonTagNames = scalar.UToSymStr{
+	0x0001: "MakerNoteVersion",
+	0x0002: "ISO",
+	0x0003: "ColorMode",
+	0x0004: "Quality",
+	0x0005: "WhiteBalance",
+	0x0006: "Sharpness",
+	0x0007: "FocusMode",
+	0x0008: "FlashSetting",
+	0x0009: "FlashType",
+	0x000b: "WhiteBalanceFineTune",
+	0x000c: "WB_RBLevels",
+	0x000d: "ProgramShift",
+	0x000e: "ExposureDifference",
+	0x000f: "ISOSelection",
+	0x0010: "DataDump",
+	0x0011: "PreviewIFD",
+	0x0012: "FlashExposureComp",
+	0x0013: "ISOSetting",
+	0x0014: "ColorBalanceA",
+	0x0016: "ImageBoundary",
+	0x0017: "ExternalFlashExposureComp",
+	0x0018: "FlashExposureBracketValue",
+	0x0019: "ExposureBracketValue",
+	0x001a: "ImageProcessing",
+	0x001b: "CropHiSpeed",
+	0x001c: "ExposureTuning",
+	0x001d: "SerialNumber",
+	0x001e: "ColorSpace",
+	0x001f: "VRInfo",
+	0x0020: "ImageAuthentication",
+	0x0021: "FaceDetect",
+	0x0022: "ActiveD-Lighting",
+	0x0023: "PictureControlData",
+	0x0024: "WorldTime",
+	0x0025: "ISOInfo",
+	0x002a: "VignetteControl",
+	0x002b: "DistortInfo",
+	0x002c: "UnknownInfo",
+	0x0032: "UnknownInfo2",
+	0x0035: "HDRInfo",
+	0x0039: "LocationInfo",
+	0x003d: "BlackLevel",
+	0x0080: "ImageAdjustment",
+	0x0081: "ToneComp",
+	0x0082: "AuxiliaryLens",
+	0x0083: "LensType",
+	0x0084: "Lens",
+	0x0085: "ManualFocusDistance",
+	0x0086: "DigitalZoom",
+	0x0087: "FlashMode",
+	0x0088: "AFInfo",
+	0x0089: "ShootingMode",
+	0x008b: "LensFStops",
+	0x008c: "ContrastCurve",
+	0x008d: "ColorHue",
+	0x008f: "SceneMode",
+	0x0090: "LightSource",
+	0x0091: "ShotInfo",
+	0x0092: "HueAdjustment",
+	0x0093: "NEFCompression",
+	0x0094: "SaturationAdj",
+	0x0095: "NoiseReduction",
+	0x0096: "NEFLinearizationTable",
+	0x0097: "ColorBalance",
+	0x0098: "LensData",
+	0x0099: "RawImageCenter",
+	0x009a: "SensorPixelSize",
+	0x009c: "SceneAssist",
+	0x009e: "RetouchHistory",
+	0x00a0: "SerialNumber",
+	0x00a2: "ImageDataSize",
+	0x00a5: "ImageCount",
+	0x00a6: "DeletedImageCount",
+	0x00a7: "ShutterCount",
+	0x00a8: "FlashInfo",
+	0x00a9: "ImageOptimization",
+	0x00aa: "Saturation",
+	0x00ab: "VariProgram",
+	0x00ac: "ImageStabilization",
+	0x00ad: "AFResponse",
+	0x00b0: "MultiExposure",
+	0x00b1: "HighISONoiseReduction",
+	0x00b3: "ToningEffect",
+	0x00b6: "PowerUpTime",
+	0x00b7: "AFInfo2",
+	0x00b8: "FileInfo",
+	0x00b9: "AFTune",
+	0x00bb: "RetouchInfo",
+	0x00bd: "PictureControlData",
+	0x00c3: "BarometerInfo",
+	0x0e00: "PrintIM",
+	0x0e01: "NikonCaptureData",
+	0x0e09: "NikonCaptureVersion",
+	0x0e0e: "NikonCaptureOffsets",
+	0x0e10: "NikonScanIFD",
+	0x0e13: "NikonCaptureEditVersions",
+	0x0e1d: "NikonICCProfile",
+	0x0e1e: "NikonCaptureOutput",
+	0x0e22: "NEFBitDepth",
+}
+
+func (td *decoder) makerNoteType(d *decode.D, offset int64, size int64) int {
+	if size < int64(len(nikonSignature))+2 || (offset+size)*8 > d.Len() {
+		return makerNoteUnknown
+	}
+	prefix := d.BytesRange(offset*8, len(nikonSignature)+1)
+	switch {
+	case bytes.Equal(prefix, []byte(nikonSignature+"\x01")):
+		return makerNoteNikon2
+	case bytes.Equal(prefix, []byte(nikonSignature+"\x02")):
+		return makerNoteNikon3
+	case strings.HasPrefix(td.make, "Canon"):
+		return makerNoteCanon
+	}
+	return makerNoteUnknown
+}
+
+func (td *decoder) decodeMakerNote(d *decode.D, mnt int, offset int64, size int64) {
+	switch mnt {
+	case makerNoteCanon:
+		td.decodeSubIfd(d, &strips{}, canonTagNames, offset)
+	case makerNoteNikon2:
+		d.SeekAbs(offset * 8)
+		d.FieldUTF8("signature", len(nikonSignature))
+		d.FieldU16BE("version", scalar.ActualHex)
+		td.decodeSubIfd(d, &strips{}, nikonTagNames, offset+8)
+	case makerNoteNikon3:
+		d.SeekAbs(offset * 8)
+		d.FieldUTF8("signature", len(nikonSignature))
+		d.FieldU16BE("version", scalar.ActualHex)
+		d.FieldU16("reserved")
+		// embedded tiff has its own endian and IFD offsets are relative to it
+		dataLen := (offset+size)*8 - d.Pos()
+		br := d.BitBufRange(d.Pos(), dataLen)
+		d.FieldRawLen("data", dataLen)
+		d.FieldStructRootBitBufFn("tiff", br, func(d *decode.D) {
+			mtd := &decoder{ifdSeen: map[int64]struct{}{}}
+			mtd.decodeTiff(d, nikonTagNames, false)
+		})
+	}
+}
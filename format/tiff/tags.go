@@ -298,6 +298,7 @@ const (
 	ShadowScale                  = 0xc633
 	DNGPrivateData               = 0xc634
 	MakerNoteSafety              = 0xc635
+	CR2Slice                     = 0xc640
 	CalibrationIlluminant1       = 0xc65a
 	CalibrationIlluminant2       = 0xc65b
 	BestQualityScale             = 0xc65c
@@ -312,6 +313,7 @@ const (
 	CurrentICCProfile            = 0xc691
 	CurrentPreProfileMatrix      = 0xc692
 	ColorimetricReference        = 0xc6bf
+	SRawType                     = 0xc6c5
 	CameraCalibrationSignature   = 0xc6f3
 	ProfileCalibrationSignature  = 0xc6f4
 	ExtraCameraProfiles          = 0xc6f5
@@ -660,6 +662,7 @@ var tiffTagNames = scalar.UToSymStr{
 	ShadowScale:                  "ShadowScale",
 	DNGPrivateData:               "DNGPrivateData",
 	MakerNoteSafety:              "MakerNoteSafety",
+	CR2Slice:                     "CR2Slice",
 	CalibrationIlluminant1:       "CalibrationIlluminant1",
 	CalibrationIlluminant2:       "CalibrationIlluminant2",
 	BestQualityScale:             "BestQualityScale",
@@ -674,6 +677,7 @@ var tiffTagNames = scalar.UToSymStr{
 	CurrentICCProfile:            "CurrentICCProfile",
 	CurrentPreProfileMatrix:      "CurrentPreProfileMatrix",
 	ColorimetricReference:        "ColorimetricReference",
+	SRawType:                     "SRawType",
 	CameraCalibrationSignature:   "CameraCalibrationSignature",
 	ProfileCalibrationSignature:  "ProfileCalibrationSignature",
 	ExtraCameraProfiles:          "ExtraCameraProfiles",
@@ -795,3 +799,19 @@ var gpsInfoTagNames = scalar.UToSymStr{
 	GPSDifferential:      "GPSDifferential",
 	GPSHPositioningError: "GPSHPositioningError",
 }
+
+const (
+	InteroperabilityIndex   = 0x0001
+	InteroperabilityVersion = 0x0002
+	RelatedImageFileFormat  = 0x1000
+	RelatedImageWidth       = 0x1001
+	RelatedImageHeight      = 0x1002
+)
+
+var interoperabilityTagNames = scalar.UToSymStr{
+	InteroperabilityIndex:   "InteroperabilityIndex",
+	InteroperabilityVersion: "InteroperabilityVersion",
+	RelatedImageFileFormat:  "RelatedImageFileFormat",
+	RelatedImageWidth:       "RelatedImageWidth",
+	RelatedImageHeight:      "RelatedImageHeight",
+}
@@ -3,13 +3,19 @@ package tiff
 // https://www.adobe.io/content/dam/udp/en/open/standards/tiff/TIFF6.pdf
 
 import (
+	"embed"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
 	"github.com/wader/fq/pkg/scalar"
 )
 
+//go:embed tiff.jq
+var tiffFS embed.FS
+
 var tiffIccProfile decode.Group
+var tiffJpeg decode.Group
 
 func init() {
 	interp.RegisterFormat(decode.Format{
@@ -19,10 +25,15 @@ func init() {
 		DecodeFn:    tiffDecode,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.ICC_PROFILE}, Group: &tiffIccProfile},
+			{Names: []string{format.JPEG}, Group: &tiffJpeg},
 		},
+		Functions: []string{"_help"},
 	})
+	interp.RegisterFS(tiffFS)
 }
 
+const cr2HeaderSize = 16
+
 const littleEndian = 0x49492a00 // "II*\0"
 const bigEndian = 0x4d4d002a    // "MM\0*"
 
@@ -37,9 +48,14 @@ const (
 	SHORT     = 3
 	LONG      = 4
 	RATIONAL  = 5
+	SBYTE     = 6
 	UNDEFINED = 7
+	SSHORT    = 8
 	SLONG     = 9
 	SRATIONAL = 10
+	FLOAT     = 11
+	DOUBLE    = 12
+	IFD       = 13
 )
 
 var typeNames = scalar.UToSymStr{
@@ -48,21 +64,38 @@ var typeNames = scalar.UToSymStr{
 	SHORT:     "SHORT",
 	LONG:      "LONG",
 	RATIONAL:  "RATIONAL",
+	SBYTE:     "SBYTE",
 	UNDEFINED: "UNDEFINED",
+	SSHORT:    "SSHORT",
 	SLONG:     "SLONG",
 	SRATIONAL: "SRATIONAL",
+	FLOAT:     "FLOAT",
+	DOUBLE:    "DOUBLE",
+	IFD:       "IFD",
 }
 
-// TODO: tiff 6.0 types
 var typeByteSize = map[uint64]uint64{
 	BYTE:      1,
 	ASCII:     1,
 	SHORT:     2,
 	LONG:      4,
 	RATIONAL:  4 + 4,
+	SBYTE:     1,
 	UNDEFINED: 1,
+	SSHORT:    2,
 	SLONG:     4,
 	SRATIONAL: 4 + 4,
+	FLOAT:     4,
+	DOUBLE:    8,
+	IFD:       4,
+}
+
+// tags with offsets to sub IFDs and tag names used for them
+var subIfdTagNames = map[uint64]scalar.UToSymStr{
+	ExifIFD:             tiffTagNames,
+	GPSInfo:             gpsInfoTagNames,
+	InteroperabilityIFD: interoperabilityTagNames,
+	SubIFDs:             tiffTagNames,
 }
 
 func fieldRational(d *decode.D, name string) float64 {
@@ -70,7 +103,7 @@ func fieldRational(d *decode.D, name string) float64 {
 	d.FieldStruct(name, func(d *decode.D) {
 		numerator := d.FieldU32("numerator")
 		denominator := d.FieldU32("denominator")
-		v := float64(numerator) / float64(denominator)
+		v = float64(numerator) / float64(denominator)
 		d.FieldValueFloat("float", v)
 	})
 	return v
@@ -81,19 +114,53 @@ func fieldSRational(d *decode.D, name string) float64 {
 	d.FieldStruct(name, func(d *decode.D) {
 		numerator := d.FieldS32("numerator")
 		denominator := d.FieldS32("denominator")
-		v := float64(numerator) / float64(denominator)
+		v = float64(numerator) / float64(denominator)
 		d.FieldValueFloat("float", v)
 	})
 	return v
 }
 
 type strips struct {
-	offsets    []int64
-	byteCounts []int64
+	offsets        []int64
+	byteCounts     []int64
+	tileOffsets    []int64
+	tileByteCounts []int64
+}
+
+func (s *strips) add(tag uint64, v uint64) {
+	switch tag {
+	case StripOffsets:
+		s.offsets = append(s.offsets, int64(v*8))
+	case StripByteCounts:
+		s.byteCounts = append(s.byteCounts, int64(v*8))
+	case TileOffsets:
+		s.tileOffsets = append(s.tileOffsets, int64(v*8))
+	case TileByteCounts:
+		s.tileByteCounts = append(s.tileByteCounts, int64(v*8))
+	}
+}
+
+type decoder struct {
+	// to catch infinite loops
+	ifdSeen map[int64]struct{}
+	// IFD0 Make, used to know maker note layout
+	make string
+}
+
+func (td *decoder) decodeSubIfd(d *decode.D, s *strips, tagNames scalar.UToSymStr, ifdOffset int64) {
+	if _, ok := td.ifdSeen[ifdOffset]; ok {
+		d.Errorf("ifd loop detected for %d", ifdOffset)
+		return
+	}
+	td.ifdSeen[ifdOffset] = struct{}{}
+	d.SeekAbs(ifdOffset * 8)
+	td.decodeIfd(d, s, tagNames)
 }
 
-func decodeIfd(d *decode.D, s *strips, tagNames scalar.UToSymStr) int64 {
+func (td *decoder) decodeIfd(d *decode.D, s *strips, tagNames scalar.UToSymStr) int64 {
 	var nextIfdOffset int64
+	var jpegOffset int64
+	var jpegLength int64
 
 	d.FieldStruct("ifd", func(d *decode.D) {
 		numberOfFields := d.FieldU16("number_of_field")
@@ -116,20 +183,38 @@ func decodeIfd(d *decode.D, s *strips, tagNames scalar.UToSymStr) int64 {
 						valueByteOffset = uint64(d.Pos()/8) - 4
 					}
 
+					subTagNames, isSubIfd := subIfdTagNames[tag]
+					mnt := makerNoteUnknown
+					if tag == MakerNote && typ == UNDEFINED {
+						mnt = td.makerNoteType(d, int64(valueByteOffset), int64(valueByteSize))
+					}
+
 					switch {
-					case typ == LONG && (tag == ExifIFD || tag == GPSInfo):
-						ifdPos := valueOrByteOffset
+					case (typ == LONG || typ == IFD) && isSubIfd:
 						pos := d.Pos()
-						d.SeekAbs(int64(ifdPos * 8))
-
-						switch tag {
-						case ExifIFD:
-							// TODO: exif tag names?
-							decodeIfd(d, &strips{}, tiffTagNames)
-						case GPSInfo:
-							decodeIfd(d, &strips{}, gpsInfoTagNames)
+						var ifdOffsets []int64
+						d.SeekAbs(int64(valueByteOffset * 8))
+						for i := uint64(0); i < count; i++ {
+							ifdOffsets = append(ifdOffsets, int64(d.U32()))
+						}
+
+						if tag == SubIFDs {
+							// usually reduced resolution or raw images that has their own strips
+							d.FieldArray("ifds", func(d *decode.D) {
+								for _, o := range ifdOffsets {
+									td.decodeSubIfd(d, s, subTagNames, o)
+								}
+							})
+						} else if len(ifdOffsets) > 0 {
+							td.decodeSubIfd(d, &strips{}, subTagNames, ifdOffsets[0])
 						}
 
+						d.SeekAbs(pos)
+					case mnt != makerNoteUnknown:
+						pos := d.Pos()
+						d.FieldStruct("maker_note", func(d *decode.D) {
+							td.decodeMakerNote(d, mnt, int64(valueByteOffset), int64(valueByteSize))
+						})
 						d.SeekAbs(pos)
 					default:
 
@@ -146,7 +231,10 @@ func decodeIfd(d *decode.D, s *strips, tagNames scalar.UToSymStr) int64 {
 								}
 							case typ == ASCII:
 								d.RangeFn(int64(valueByteOffset*8), int64(valueByteSize*8), func(d *decode.D) {
-									d.FieldUTF8NullFixedLen("value", int(valueByteSize))
+									v := d.FieldUTF8NullFixedLen("value", int(valueByteSize))
+									if tag == Make && td.make == "" {
+										td.make = v
+									}
 								})
 							case typ == BYTE:
 								d.RangeFn(int64(valueByteOffset*8), int64(valueByteSize*8), func(d *decode.D) {
@@ -159,23 +247,26 @@ func decodeIfd(d *decode.D, s *strips, tagNames scalar.UToSymStr) int64 {
 										// TODO: only some typ?
 										case BYTE:
 											d.FieldU8("value")
+										case SBYTE:
+											d.FieldS8("value")
+										case SSHORT:
+											d.FieldS16("value")
+										case FLOAT:
+											d.FieldF32("value")
+										case DOUBLE:
+											d.FieldF64("value")
+										case IFD:
+											d.FieldU32("value")
 										case SHORT:
-											v := d.FieldU16("value")
-											_ = v
-											switch tag {
-											case StripOffsets:
-												s.offsets = append(s.offsets, int64(v*8))
-											case StripByteCounts:
-												s.byteCounts = append(s.byteCounts, int64(v*8))
-											}
+											s.add(tag, d.FieldU16("value"))
 										case LONG:
 											v := d.FieldU32("value")
-											_ = v
+											s.add(tag, v)
 											switch tag {
-											case StripOffsets:
-												s.offsets = append(s.offsets, int64(v*8))
-											case StripByteCounts:
-												s.byteCounts = append(s.byteCounts, int64(v*8))
+											case JPEGInterchangeFormat:
+												jpegOffset = int64(v * 8)
+											case JPEGInterchangeFormatLength:
+												jpegLength = int64(v * 8)
 											}
 										case RATIONAL:
 											fieldRational(d, "value")
@@ -196,12 +287,34 @@ func decodeIfd(d *decode.D, s *strips, tagNames scalar.UToSymStr) int64 {
 		})
 
 		nextIfdOffset = int64(d.FieldU32("next_ifd"))
+
+		// usually a thumbnail in exif IFD1
+		if jpegOffset != 0 && jpegLength != 0 && jpegOffset+jpegLength <= d.Len() {
+			d.RangeFn(jpegOffset, jpegLength, func(d *decode.D) {
+				d.FieldFormatOrRawLen("jpeg", d.BitsLeft(), tiffJpeg, nil)
+			})
+		}
 	})
 
 	return nextIfdOffset
 }
 
-func tiffDecode(d *decode.D, _ any) any {
+func fieldSegments(d *decode.D, name string, elmName string, offsets []int64, byteCounts []int64) {
+	if len(offsets) != len(byteCounts) {
+		// TODO: warning
+		return
+	}
+	d.FieldArray(name, func(d *decode.D) {
+		for i := 0; i < len(offsets); i++ {
+			d.RangeFn(offsets[i], byteCounts[i], func(d *decode.D) {
+				d.FieldRawLen(elmName, d.BitsLeft())
+			})
+		}
+	})
+}
+
+// decodeTiff decodes header and IFD chain at start of buffer
+func (td *decoder) decodeTiff(d *decode.D, tagNames scalar.UToSymStr, isMain bool) {
 	endian := d.FieldU32("endian", endianNames, scalar.ActualHex)
 
 	switch endian {
@@ -219,33 +332,39 @@ func tiffDecode(d *decode.D, _ any) any {
 	d.FieldU16("integer_42", d.AssertU(42))
 
 	ifdOffset := int64(d.FieldU32("first_ifd"))
-	s := &strips{}
 
-	// to catch infinite loops
-	ifdSeen := map[int64]struct{}{}
+	// canon raw has a raw IFD offset after the header
+	if isMain && ifdOffset >= cr2HeaderSize && d.BitsLeft() >= 8*8 && string(d.PeekBytes(2)) == "CR" {
+		d.FieldStruct("cr2", func(d *decode.D) {
+			d.FieldUTF8("magic", 2)
+			d.FieldU8("major_version")
+			d.FieldU8("minor_version")
+			d.FieldU32("raw_ifd")
+		})
+	}
+
+	s := &strips{}
 
 	d.FieldArray("ifds", func(d *decode.D) {
 		for ifdOffset != 0 {
-			if _, ok := ifdSeen[ifdOffset]; ok {
+			if _, ok := td.ifdSeen[ifdOffset]; ok {
 				d.Fatalf("ifd loop detected for %d", ifdOffset)
 			}
-			ifdSeen[ifdOffset] = struct{}{}
+			td.ifdSeen[ifdOffset] = struct{}{}
 			d.SeekAbs(ifdOffset * 8)
-			ifdOffset = decodeIfd(d, s, tiffTagNames)
+			ifdOffset = td.decodeIfd(d, s, tagNames)
 		}
 	})
 
-	if len(s.offsets) != len(s.byteCounts) {
-		// TODO: warning
-	} else {
-		d.FieldArray("strips", func(d *decode.D) {
-			for i := 0; i < len(s.offsets); i++ {
-				d.RangeFn(s.offsets[i], s.byteCounts[i], func(d *decode.D) {
-					d.FieldRawLen("strip", d.BitsLeft())
-				})
-			}
-		})
+	fieldSegments(d, "strips", "strip", s.offsets, s.byteCounts)
+	if len(s.tileOffsets) > 0 {
+		fieldSegments(d, "tiles", "tile", s.tileOffsets, s.tileByteCounts)
 	}
+}
+
+func tiffDecode(d *decode.D, _ any) any {
+	td := &decoder{ifdSeen: map[int64]struct{}{}}
+	td.decodeTiff(d, tiffTagNames, true)
 
 	return nil
 }
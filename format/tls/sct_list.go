@@ -0,0 +1,82 @@
+package tls
+
+// https://datatracker.ietf.org/doc/html/rfc6962#section-3.3
+// TODO: decode extensions if any gets defined
+
+import (
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.SCT_LIST,
+		Description: "Certificate Transparency signed certificate timestamp list",
+		DecodeFn:    sctListDecode,
+	})
+}
+
+var sctVersionNames = scalar.UToSymStr{
+	0: "v1",
+}
+
+// TLS 1.2 HashAlgorithm and SignatureAlgorithm
+var hashAlgorithmNames = scalar.UToSymStr{
+	0: "none",
+	1: "md5",
+	2: "sha1",
+	3: "sha224",
+	4: "sha256",
+	5: "sha384",
+	6: "sha512",
+	8: "intrinsic",
+}
+
+var signatureAlgorithmNames = scalar.UToSymStr{
+	0: "anonymous",
+	1: "rsa",
+	2: "dsa",
+	3: "ecdsa",
+	7: "ed25519",
+	8: "ed448",
+}
+
+var descriptionUnixMilliTime = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	s.Description = time.UnixMilli(int64(s.ActualU())).UTC().Format(time.RFC3339Nano)
+	return s, nil
+})
+
+func decodeSCT(d *decode.D) {
+	d.FieldU8("version", sctVersionNames)
+	d.FieldRawLen("log_id", 32*8, scalar.RawHex)
+	d.FieldU64("timestamp", descriptionUnixMilliTime)
+	extensionsLen := d.FieldU16("extensions_length")
+	d.FieldRawLen("extensions", int64(extensionsLen)*8)
+	d.FieldU8("hash_algorithm", hashAlgorithmNames)
+	d.FieldU8("signature_algorithm", signatureAlgorithmNames)
+	signatureLen := d.FieldU16("signature_length")
+	d.FieldRawLen("signature", int64(signatureLen)*8)
+}
+
+func decodeSCTList(d *decode.D) {
+	listLen := d.FieldU16("length")
+	d.FramedFn(int64(listLen)*8, func(d *decode.D) {
+		d.FieldArray("scts", func(d *decode.D) {
+			for !d.End() {
+				d.FieldStruct("sct", func(d *decode.D) {
+					sctLen := d.FieldU16("length")
+					d.FramedFn(int64(sctLen)*8, decodeSCT)
+				})
+			}
+		})
+	})
+}
+
+func sctListDecode(d *decode.D, _ any) any {
+	decodeSCTList(d)
+	return nil
+}
@@ -0,0 +1,666 @@
+package tls
+
+// https://datatracker.ietf.org/doc/html/rfc5246
+// https://datatracker.ietf.org/doc/html/rfc8446
+// https://www.iana.org/assignments/tls-parameters/tls-parameters.xhtml
+// TODO: handshake messages split over multiple records
+// TODO: SSLv2 compatible client hello
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed tls.jq
+var tlsFS embed.FS
+
+var tlsAsn1BerFormat decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.TLS,
+		Description: "Transport layer security",
+		Groups:      []string{format.TCP_STREAM},
+		DecodeFn:    tlsDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.ASN1_BER}, Group: &tlsAsn1BerFormat},
+		},
+		Functions: []string{"_help"},
+	})
+	interp.RegisterFS(tlsFS)
+}
+
+const (
+	contentTypeChangeCipherSpec = 20
+	contentTypeAlert            = 21
+	contentTypeHandshake        = 22
+	contentTypeApplicationData  = 23
+	contentTypeHeartbeat        = 24
+)
+
+var contentTypeNames = scalar.UToSymStr{
+	contentTypeChangeCipherSpec: "change_cipher_spec",
+	contentTypeAlert:            "alert",
+	contentTypeHandshake:        "handshake",
+	contentTypeApplicationData:  "application_data",
+	contentTypeHeartbeat:        "heartbeat",
+}
+
+const (
+	versionTLS12 = 0x0303
+	versionTLS13 = 0x0304
+)
+
+var versionNames = scalar.UToSymStr{
+	0x0300:       "ssl3.0",
+	0x0301:       "tls1.0",
+	0x0302:       "tls1.1",
+	versionTLS12: "tls1.2",
+	versionTLS13: "tls1.3",
+}
+
+const (
+	handshakeTypeClientHello         = 1
+	handshakeTypeServerHello         = 2
+	handshakeTypeNewSessionTicket    = 4
+	handshakeTypeEncryptedExtensions = 8
+	handshakeTypeCertificate         = 11
+	handshakeTypeFinished            = 20
+	handshakeTypeKeyUpdate           = 24
+)
+
+var handshakeTypeNames = scalar.UToSymStr{
+	0:                                "hello_request",
+	handshakeTypeClientHello:         "client_hello",
+	handshakeTypeServerHello:         "server_hello",
+	3:                                "hello_verify_request",
+	handshakeTypeNewSessionTicket:    "new_session_ticket",
+	5:                                "end_of_early_data",
+	handshakeTypeEncryptedExtensions: "encrypted_extensions",
+	handshakeTypeCertificate:         "certificate",
+	12:                               "server_key_exchange",
+	13:                               "certificate_request",
+	14:                               "server_hello_done",
+	15:                               "certificate_verify",
+	16:                               "client_key_exchange",
+	handshakeTypeFinished:            "finished",
+	22:                               "certificate_status",
+	handshakeTypeKeyUpdate:           "key_update",
+	254:                              "message_hash",
+}
+
+var alertLevelNames = scalar.UToSymStr{
+	1: "warning",
+	2: "fatal",
+}
+
+var alertDescriptionNames = scalar.UToSymStr{
+	0:   "close_notify",
+	10:  "unexpected_message",
+	20:  "bad_record_mac",
+	21:  "decryption_failed",
+	22:  "record_overflow",
+	30:  "decompression_failure",
+	40:  "handshake_failure",
+	41:  "no_certificate",
+	42:  "bad_certificate",
+	43:  "unsupported_certificate",
+	44:  "certificate_revoked",
+	45:  "certificate_expired",
+	46:  "certificate_unknown",
+	47:  "illegal_parameter",
+	48:  "unknown_ca",
+	49:  "access_denied",
+	50:  "decode_error",
+	51:  "decrypt_error",
+	60:  "export_restriction",
+	70:  "protocol_version",
+	71:  "insufficient_security",
+	80:  "internal_error",
+	86:  "inappropriate_fallback",
+	90:  "user_canceled",
+	100: "no_renegotiation",
+	109: "missing_extension",
+	110: "unsupported_extension",
+	111: "certificate_unobtainable",
+	112: "unrecognized_name",
+	113: "bad_certificate_status_response",
+	114: "bad_certificate_hash_value",
+	115: "unknown_psk_identity",
+	116: "certificate_required",
+	120: "no_application_protocol",
+}
+
+var cipherSuiteNames = scalar.UToSymStr{
+	0x0000: "TLS_NULL_WITH_NULL_NULL",
+	0x0004: "TLS_RSA_WITH_RC4_128_MD5",
+	0x0005: "TLS_RSA_WITH_RC4_128_SHA",
+	0x000a: "TLS_RSA_WITH_3DES_EDE_CBC_SHA",
+	0x002f: "TLS_RSA_WITH_AES_128_CBC_SHA",
+	0x0033: "TLS_DHE_RSA_WITH_AES_128_CBC_SHA",
+	0x0035: "TLS_RSA_WITH_AES_256_CBC_SHA",
+	0x0039: "TLS_DHE_RSA_WITH_AES_256_CBC_SHA",
+	0x003c: "TLS_RSA_WITH_AES_128_CBC_SHA256",
+	0x003d: "TLS_RSA_WITH_AES_256_CBC_SHA256",
+	0x0067: "TLS_DHE_RSA_WITH_AES_128_CBC_SHA256",
+	0x006b: "TLS_DHE_RSA_WITH_AES_256_CBC_SHA256",
+	0x009c: "TLS_RSA_WITH_AES_128_GCM_SHA256",
+	0x009d: "TLS_RSA_WITH_AES_256_GCM_SHA384",
+	0x009e: "TLS_DHE_RSA_WITH_AES_128_GCM_SHA256",
+	0x009f: "TLS_DHE_RSA_WITH_AES_256_GCM_SHA384",
+	0x00ff: "TLS_EMPTY_RENEGOTIATION_INFO_SCSV",
+	0x1301: "TLS_AES_128_GCM_SHA256",
+	0x1302: "TLS_AES_256_GCM_SHA384",
+	0x1303: "TLS_CHACHA20_POLY1305_SHA256",
+	0x1304: "TLS_AES_128_CCM_SHA256",
+	0x1305: "TLS_AES_128_CCM_8_SHA256",
+	0x5600: "TLS_FALLBACK_SCSV",
+	0xc009: "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA",
+	0xc00a: "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA",
+	0xc013: "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+	0xc014: "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA",
+	0xc023: "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256",
+	0xc024: "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA384",
+	0xc027: "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256",
+	0xc028: "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA384",
+	0xc02b: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	0xc02c: "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	0xc02f: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	0xc030: "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	0xcca8: "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+	0xcca9: "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+	0xccaa: "TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+}
+
+const (
+	extensionServerName                          = 0
+	extensionSupportedGroups                     = 10
+	extensionECPointFormats                      = 11
+	extensionSignatureAlgorithms                 = 13
+	extensionApplicationLayerProtocolNegotiation = 16
+	extensionSignedCertificateTimestamp          = 18
+	extensionSupportedVersions                   = 43
+	extensionPSKKeyExchangeModes                 = 45
+	extensionSignatureAlgorithmsCert             = 50
+	extensionKeyShare                            = 51
+)
+
+var extensionTypeNames = scalar.UToSymStr{
+	extensionServerName:          "server_name",
+	1:                            "max_fragment_length",
+	5:                            "status_request",
+	extensionSupportedGroups:     "supported_groups",
+	extensionECPointFormats:      "ec_point_formats",
+	extensionSignatureAlgorithms: "signature_algorithms",
+	14:                           "use_srtp",
+	15:                           "heartbeat",
+	extensionApplicationLayerProtocolNegotiation: "application_layer_protocol_negotiation",
+	extensionSignedCertificateTimestamp:          "signed_certificate_timestamp",
+	21:                                           "padding",
+	22:                                           "encrypt_then_mac",
+	23:                                           "extended_master_secret",
+	27:                                           "compress_certificate",
+	28:                                           "record_size_limit",
+	35:                                           "session_ticket",
+	41:                                           "pre_shared_key",
+	42:                                           "early_data",
+	extensionSupportedVersions:                   "supported_versions",
+	44:                                           "cookie",
+	extensionPSKKeyExchangeModes:                 "psk_key_exchange_modes",
+	47:                                           "certificate_authorities",
+	49:                                           "post_handshake_auth",
+	extensionSignatureAlgorithmsCert:             "signature_algorithms_cert",
+	extensionKeyShare:                            "key_share",
+	0xff01:                                       "renegotiation_info",
+}
+
+var namedGroupNames = scalar.UToSymStr{
+	23:  "secp256r1",
+	24:  "secp384r1",
+	25:  "secp521r1",
+	29:  "x25519",
+	30:  "x448",
+	256: "ffdhe2048",
+	257: "ffdhe3072",
+	258: "ffdhe4096",
+	259: "ffdhe6144",
+	260: "ffdhe8192",
+}
+
+var signatureSchemeNames = scalar.UToSymStr{
+	0x0201: "rsa_pkcs1_sha1",
+	0x0203: "ecdsa_sha1",
+	0x0401: "rsa_pkcs1_sha256",
+	0x0403: "ecdsa_secp256r1_sha256",
+	0x0501: "rsa_pkcs1_sha384",
+	0x0503: "ecdsa_secp384r1_sha384",
+	0x0601: "rsa_pkcs1_sha512",
+	0x0603: "ecdsa_secp521r1_sha512",
+	0x0804: "rsa_pss_rsae_sha256",
+	0x0805: "rsa_pss_rsae_sha384",
+	0x0806: "rsa_pss_rsae_sha512",
+	0x0807: "ed25519",
+	0x0808: "ed448",
+	0x0809: "rsa_pss_pss_sha256",
+	0x080a: "rsa_pss_pss_sha384",
+	0x080b: "rsa_pss_pss_sha512",
+}
+
+var ecPointFormatNames = scalar.UToSymStr{
+	0: "uncompressed",
+	1: "ansiX962_compressed_prime",
+	2: "ansiX962_compressed_char2",
+}
+
+var pskKeyExchangeModeNames = scalar.UToSymStr{
+	0: "psk_ke",
+	1: "psk_dhe_ke",
+}
+
+var keyUpdateRequestNames = scalar.UToSymStr{
+	0: "update_not_requested",
+	1: "update_requested",
+}
+
+// state for one direction of a connection
+type tlsDirection struct {
+	isClient     bool
+	hello        helloParams
+	keylog       keylog
+	ccsSeen      bool
+	decrypter    *recordDecrypter
+	secret       []byte // current TLS 1.3 traffic secret
+	appData      []byte
+	isAppSecrets bool
+}
+
+func (t *tlsDirection) tls13() bool { return t.hello.version == versionTLS13 }
+
+func (t *tlsDirection) labelPrefix() string {
+	if t.isClient {
+		return "CLIENT_"
+	}
+	return "SERVER_"
+}
+
+func (t *tlsDirection) setTLS13Secret(secret []byte) {
+	t.decrypter = nil
+	t.secret = secret
+	cs, ok := decryptCipherSuites[t.hello.cipherSuite]
+	if !ok || secret == nil {
+		return
+	}
+	t.decrypter, _ = newTLS13RecordDecrypter(cs, secret)
+}
+
+// records after change cipher spec are encrypted, TLS 1.3 always use application data records
+// for encrypted records
+func (t *tlsDirection) isEncrypted(contentType uint64) bool {
+	return contentType == contentTypeApplicationData ||
+		(!t.tls13() && t.ccsSeen && contentType != contentTypeChangeCipherSpec)
+}
+
+func (t *tlsDirection) startDecrypt() {
+	if t.keylog == nil || !t.hello.hasServerHello {
+		return
+	}
+	if t.tls13() {
+		t.setTLS13Secret(t.keylog.secret(t.hello.clientRandom, t.labelPrefix()+"HANDSHAKE_TRAFFIC_SECRET"))
+		return
+	}
+	cs, ok := decryptCipherSuites[t.hello.cipherSuite]
+	masterSecret := t.keylog.secret(t.hello.clientRandom, "CLIENT_RANDOM")
+	if !ok || masterSecret == nil {
+		return
+	}
+	t.decrypter, _ = newTLS12RecordDecrypter(cs, masterSecret, t.hello.clientRandom, t.hello.serverRandom, t.isClient)
+}
+
+// TLS 1.3 switch to application traffic secret after finished and new secret on key update
+func (t *tlsDirection) handshakeDecrypted(bs []byte) {
+	if !t.tls13() {
+		return
+	}
+	cs, ok := decryptCipherSuites[t.hello.cipherSuite]
+	if !ok {
+		return
+	}
+	for _, typ := range handshakeMessageTypes(bs) {
+		switch {
+		case typ == handshakeTypeFinished && !t.isAppSecrets:
+			t.isAppSecrets = true
+			t.setTLS13Secret(t.keylog.secret(t.hello.clientRandom, t.labelPrefix()+"TRAFFIC_SECRET_0"))
+		case typ == handshakeTypeKeyUpdate && t.secret != nil:
+			h := cs.hash()
+			t.setTLS13Secret(hkdfExpandLabel(cs.hash, t.secret, "traffic upd", nil, h.Size()))
+		}
+	}
+}
+
+func decodeExtensions(d *decode.D, msgType uint64) {
+	d.FieldArray("extensions", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("extension", func(d *decode.D) {
+				typ := d.FieldU16("type", extensionTypeNames, scalar.ActualHex)
+				length := d.FieldU16("length")
+				d.FramedFn(int64(length)*8, func(d *decode.D) {
+					if length == 0 {
+						return
+					}
+					decodeExtension(d, typ, msgType)
+				})
+			})
+		}
+	})
+}
+
+func fieldU16List(d *decode.D, name string, elmName string, lenBits int, sms ...scalar.Mapper) {
+	length := d.FieldU(name+"_length", lenBits)
+	d.FramedFn(int64(length)*8, func(d *decode.D) {
+		d.FieldArray(name, func(d *decode.D) {
+			for !d.End() {
+				d.FieldU16(elmName, sms...)
+			}
+		})
+	})
+}
+
+func decodeExtension(d *decode.D, typ uint64, msgType uint64) {
+	switch typ {
+	case extensionServerName:
+		length := d.FieldU16("server_names_length")
+		d.FramedFn(int64(length)*8, func(d *decode.D) {
+			d.FieldArray("server_names", func(d *decode.D) {
+				for !d.End() {
+					d.FieldStruct("server_name", func(d *decode.D) {
+						d.FieldU8("name_type", scalar.UToSymStr{0: "host_name"})
+						nameLen := d.FieldU16("length")
+						d.FieldUTF8("name", int(nameLen))
+					})
+				}
+			})
+		})
+	case extensionSupportedGroups:
+		fieldU16List(d, "named_groups", "named_group", 16, namedGroupNames, scalar.ActualHex)
+	case extensionECPointFormats:
+		length := d.FieldU8("ec_point_formats_length")
+		d.FramedFn(int64(length)*8, func(d *decode.D) {
+			d.FieldArray("ec_point_formats", func(d *decode.D) {
+				for !d.End() {
+					d.FieldU8("ec_point_format", ecPointFormatNames)
+				}
+			})
+		})
+	case extensionSignatureAlgorithms,
+		extensionSignatureAlgorithmsCert:
+		fieldU16List(d, "signature_schemes", "signature_scheme", 16, signatureSchemeNames, scalar.ActualHex)
+	case extensionApplicationLayerProtocolNegotiation:
+		length := d.FieldU16("protocols_length")
+		d.FramedFn(int64(length)*8, func(d *decode.D) {
+			d.FieldArray("protocols", func(d *decode.D) {
+				for !d.End() {
+					d.FieldStruct("protocol", func(d *decode.D) {
+						nameLen := d.FieldU8("length")
+						d.FieldUTF8("name", int(nameLen))
+					})
+				}
+			})
+		})
+	case extensionSignedCertificateTimestamp:
+		d.FieldStruct("sct_list", decodeSCTList)
+	case extensionSupportedVersions:
+		if msgType == handshakeTypeClientHello {
+			fieldU16List(d, "versions", "version", 8, versionNames, scalar.ActualHex)
+		} else {
+			d.FieldU16("selected_version", versionNames, scalar.ActualHex)
+		}
+	case extensionPSKKeyExchangeModes:
+		length := d.FieldU8("modes_length")
+		d.FramedFn(int64(length)*8, func(d *decode.D) {
+			d.FieldArray("modes", func(d *decode.D) {
+				for !d.End() {
+					d.FieldU8("mode", pskKeyExchangeModeNames)
+				}
+			})
+		})
+	case extensionKeyShare:
+		decodeKeyShareEntry := func(d *decode.D) {
+			d.FieldU16("group", namedGroupNames, scalar.ActualHex)
+			keyExchangeLen := d.FieldU16("length")
+			d.FieldRawLen("key_exchange", int64(keyExchangeLen)*8)
+		}
+		switch {
+		case msgType == handshakeTypeClientHello:
+			length := d.FieldU16("entries_length")
+			d.FramedFn(int64(length)*8, func(d *decode.D) {
+				d.FieldArray("entries", func(d *decode.D) {
+					for !d.End() {
+						d.FieldStruct("entry", decodeKeyShareEntry)
+					}
+				})
+			})
+		case d.BitsLeft() == 16:
+			// hello retry request only has selected group
+			d.FieldU16("selected_group", namedGroupNames, scalar.ActualHex)
+		default:
+			d.FieldStruct("entry", decodeKeyShareEntry)
+		}
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func decodeHello(d *decode.D, msgType uint64) {
+	d.FieldU16("legacy_version", versionNames, scalar.ActualHex)
+	d.FieldRawLen("random", 32*8, scalar.RawHex)
+	sessionIDLen := d.FieldU8("session_id_length")
+	d.FieldRawLen("session_id", int64(sessionIDLen)*8)
+	if msgType == handshakeTypeClientHello {
+		fieldU16List(d, "cipher_suites", "cipher_suite", 16, cipherSuiteNames, scalar.ActualHex)
+		compressionMethodsLen := d.FieldU8("compression_methods_length")
+		d.FieldArray("compression_methods", func(d *decode.D) {
+			for i := uint64(0); i < compressionMethodsLen; i++ {
+				d.FieldU8("compression_method")
+			}
+		})
+	} else {
+		d.FieldU16("cipher_suite", cipherSuiteNames, scalar.ActualHex)
+		d.FieldU8("compression_method")
+	}
+	if d.End() {
+		return
+	}
+	extensionsLen := d.FieldU16("extensions_length")
+	d.FramedFn(int64(extensionsLen)*8, func(d *decode.D) {
+		decodeExtensions(d, msgType)
+	})
+}
+
+func decodeCertificate(d *decode.D, tls13 bool) {
+	if tls13 {
+		contextLen := d.FieldU8("certificate_request_context_length")
+		d.FieldRawLen("certificate_request_context", int64(contextLen)*8)
+	}
+	listLen := d.FieldU24("certificate_list_length")
+	d.FramedFn(int64(listLen)*8, func(d *decode.D) {
+		d.FieldArray("certificate_list", func(d *decode.D) {
+			for !d.End() {
+				d.FieldStruct("entry", func(d *decode.D) {
+					certLen := d.FieldU24("length")
+					d.FieldFormatOrRawLen("certificate", int64(certLen)*8, tlsAsn1BerFormat, nil)
+					if tls13 {
+						extensionsLen := d.FieldU16("extensions_length")
+						d.FramedFn(int64(extensionsLen)*8, func(d *decode.D) {
+							decodeExtensions(d, handshakeTypeCertificate)
+						})
+					}
+				})
+			}
+		})
+	})
+}
+
+func decodeHandshakeMessage(d *decode.D, tls13 bool) {
+	msgType := d.FieldU8("msg_type", handshakeTypeNames)
+	length := d.FieldU24("length")
+	d.FramedFn(int64(length)*8, func(d *decode.D) {
+		switch msgType {
+		case handshakeTypeClientHello,
+			handshakeTypeServerHello:
+			decodeHello(d, msgType)
+		case handshakeTypeEncryptedExtensions:
+			extensionsLen := d.FieldU16("extensions_length")
+			d.FramedFn(int64(extensionsLen)*8, func(d *decode.D) {
+				decodeExtensions(d, msgType)
+			})
+		case handshakeTypeCertificate:
+			decodeCertificate(d, tls13)
+		case handshakeTypeNewSessionTicket:
+			d.FieldU32("ticket_lifetime")
+			if tls13 {
+				d.FieldU32("ticket_age_add")
+				nonceLen := d.FieldU8("ticket_nonce_length")
+				d.FieldRawLen("ticket_nonce", int64(nonceLen)*8)
+			}
+			ticketLen := d.FieldU16("ticket_length")
+			d.FieldRawLen("ticket", int64(ticketLen)*8)
+			if tls13 {
+				extensionsLen := d.FieldU16("extensions_length")
+				d.FramedFn(int64(extensionsLen)*8, func(d *decode.D) {
+					decodeExtensions(d, msgType)
+				})
+			}
+		case handshakeTypeFinished:
+			d.FieldRawLen("verify_data", d.BitsLeft(), scalar.RawHex)
+		case handshakeTypeKeyUpdate:
+			d.FieldU8("request_update", keyUpdateRequestNames)
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+func decodeContent(d *decode.D, td *tlsDirection, contentType uint64) {
+	switch contentType {
+	case contentTypeChangeCipherSpec:
+		d.FieldU8("type")
+	case contentTypeAlert:
+		d.FieldU8("level", alertLevelNames)
+		d.FieldU8("description", alertDescriptionNames)
+	case contentTypeHandshake:
+		d.FieldArray("messages", func(d *decode.D) {
+			for !d.End() {
+				d.FieldStruct("message", func(d *decode.D) {
+					decodeHandshakeMessage(d, td.tls13())
+				})
+			}
+		})
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func decodeDecrypted(d *decode.D, td *tlsDirection, contentType uint64, plaintext []byte) {
+	innerType := contentType
+	contentLen := len(plaintext)
+	if td.tls13() {
+		// inner plaintext is content, content type and zero padding
+		contentLen = len(plaintext) - 1
+		for contentLen >= 0 && plaintext[contentLen] == 0 {
+			contentLen--
+		}
+		if contentLen < 0 {
+			d.Fatalf("no inner content type found")
+		}
+		innerType = uint64(plaintext[contentLen])
+	}
+	content := plaintext[0:contentLen]
+
+	d.FramedFn(int64(contentLen)*8, func(d *decode.D) {
+		decodeContent(d, td, innerType)
+	})
+	if td.tls13() {
+		d.FieldU8("content_type", contentTypeNames)
+		d.FieldRawLen("padding", d.BitsLeft(), d.BitBufIsZero())
+	}
+
+	switch innerType {
+	case contentTypeApplicationData:
+		td.appData = append(td.appData, content...)
+	case contentTypeHandshake:
+		td.handshakeDecrypted(content)
+	}
+}
+
+func decodeRecord(d *decode.D, td *tlsDirection) {
+	contentType := d.FieldU8("content_type", contentTypeNames)
+	version := d.FieldU16("version", versionNames, scalar.ActualHex)
+	length := d.FieldU16("length")
+
+	d.FramedFn(int64(length)*8, func(d *decode.D) {
+		if !td.isEncrypted(contentType) {
+			decodeContent(d, td, contentType)
+			return
+		}
+
+		if td.tls13() && td.decrypter == nil && td.secret == nil && !td.isAppSecrets {
+			td.startDecrypt()
+		}
+		fragment := d.BytesRange(d.Pos(), int(length))
+		d.FieldRawLen("encrypted_data", d.BitsLeft())
+		if td.decrypter == nil {
+			return
+		}
+		plaintext, err := td.decrypter.decrypt(contentType, version, fragment)
+		if err != nil {
+			return
+		}
+		d.FieldStructRootBitBufFn("decrypted", bitio.NewBitReader(plaintext, -1), func(d *decode.D) {
+			decodeDecrypted(d, td, contentType, plaintext)
+		})
+	})
+
+	if contentType == contentTypeChangeCipherSpec && !td.tls13() && !td.ccsSeen {
+		td.ccsSeen = true
+		td.startDecrypt()
+	}
+}
+
+func tlsDecode(d *decode.D, in any) any {
+	td := &tlsDirection{}
+
+	// most start with a handshake record, ex: client or server hello
+	contentType := d.PeekBits(8)
+	versionMajor := d.PeekBits(16) & 0xff
+	if contentType != contentTypeHandshake || versionMajor != 3 {
+		d.Fatalf("not a TLS handshake record")
+	}
+
+	scanHello(d.BytesRange(d.Pos(), int(d.BitsLeft()/8)), &td.hello)
+	if tsi, ok := in.(format.TCPStreamIn); ok {
+		td.isClient = tsi.IsClient
+		scanHello(tsi.PeerStream, &td.hello)
+		if tsi.Keylog != "" {
+			td.keylog = parseKeylog(tsi.Keylog)
+		}
+	}
+
+	d.FieldArray("records", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("record", func(d *decode.D) {
+				decodeRecord(d, td)
+			})
+		}
+	})
+
+	if len(td.appData) > 0 {
+		d.FieldRootBitBuf("application_data", bitio.NewBitReader(td.appData, -1))
+	}
+
+	return nil
+}
@@ -0,0 +1,301 @@
+package tls
+
+// https://developer.mozilla.org/en-US/docs/Mozilla/Projects/NSS/Key_Log_Format
+// https://datatracker.ietf.org/doc/html/rfc5246#section-6.3
+// https://datatracker.ietf.org/doc/html/rfc8446#section-7
+// TODO: CBC cipher suites
+// TODO: TLS 1.3 early data and hello retry request
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// client random hex -> label -> secret
+type keylog map[string]map[string][]byte
+
+func parseKeylog(s string) keylog {
+	kl := keylog{}
+	for _, l := range strings.Split(s, "\n") {
+		parts := strings.Fields(l)
+		if len(parts) != 3 || strings.HasPrefix(parts[0], "#") {
+			continue
+		}
+		clientRandom, err := hex.DecodeString(parts[1])
+		if err != nil {
+			continue
+		}
+		secret, err := hex.DecodeString(parts[2])
+		if err != nil {
+			continue
+		}
+		k := hex.EncodeToString(clientRandom)
+		if _, ok := kl[k]; !ok {
+			kl[k] = map[string][]byte{}
+		}
+		kl[k][parts[0]] = secret
+	}
+	return kl
+}
+
+func (kl keylog) secret(clientRandom []byte, label string) []byte {
+	return kl[hex.EncodeToString(clientRandom)][label]
+}
+
+type cipherSuite struct {
+	keyLen  int
+	ivLen   int // fixed iv length, for TLS 1.2 AES-GCM the rest of the nonce is explicit
+	hash    func() hash.Hash
+	newAEAD func(key []byte) (cipher.AEAD, error)
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(b)
+}
+
+var (
+	aes128GCMSHA256   = cipherSuite{keyLen: 16, ivLen: 4, hash: sha256.New, newAEAD: newAESGCM}
+	aes256GCMSHA384   = cipherSuite{keyLen: 32, ivLen: 4, hash: sha512.New384, newAEAD: newAESGCM}
+	chacha20Poly1305  = cipherSuite{keyLen: 32, ivLen: 12, hash: sha256.New, newAEAD: chacha20poly1305.New}
+	tls13AES128GCM    = cipherSuite{keyLen: 16, ivLen: 12, hash: sha256.New, newAEAD: newAESGCM}
+	tls13AES256GCM    = cipherSuite{keyLen: 32, ivLen: 12, hash: sha512.New384, newAEAD: newAESGCM}
+	tls13ChaCha20Poly = cipherSuite{keyLen: 32, ivLen: 12, hash: sha256.New, newAEAD: chacha20poly1305.New}
+)
+
+// cipher suites that can be decrypted
+var decryptCipherSuites = map[uint64]cipherSuite{
+	0x009c: aes128GCMSHA256,   // TLS_RSA_WITH_AES_128_GCM_SHA256
+	0x009d: aes256GCMSHA384,   // TLS_RSA_WITH_AES_256_GCM_SHA384
+	0x009e: aes128GCMSHA256,   // TLS_DHE_RSA_WITH_AES_128_GCM_SHA256
+	0x009f: aes256GCMSHA384,   // TLS_DHE_RSA_WITH_AES_256_GCM_SHA384
+	0xc02b: aes128GCMSHA256,   // TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256
+	0xc02c: aes256GCMSHA384,   // TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384
+	0xc02f: aes128GCMSHA256,   // TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	0xc030: aes256GCMSHA384,   // TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384
+	0xcca8: chacha20Poly1305,  // TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256
+	0xcca9: chacha20Poly1305,  // TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256
+	0xccaa: chacha20Poly1305,  // TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256
+	0x1301: tls13AES128GCM,    // TLS_AES_128_GCM_SHA256
+	0x1302: tls13AES256GCM,    // TLS_AES_256_GCM_SHA384
+	0x1303: tls13ChaCha20Poly, // TLS_CHACHA20_POLY1305_SHA256
+}
+
+// TLS 1.2 P_hash based PRF
+func prf12(h func() hash.Hash, secret []byte, label string, seed []byte, n int) []byte {
+	seed = append([]byte(label), seed...)
+	out := make([]byte, 0, n)
+	mac := hmac.New(h, secret)
+	mac.Write(seed)
+	a := mac.Sum(nil)
+	for len(out) < n {
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(seed)
+		out = append(out, mac.Sum(nil)...)
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+	}
+	return out[:n]
+}
+
+// TLS 1.3 HKDF-Expand-Label
+func hkdfExpandLabel(h func() hash.Hash, secret []byte, label string, context []byte, n int) []byte {
+	info := []byte{byte(n >> 8), byte(n)}
+	info = append(info, byte(len("tls13 "+label)))
+	info = append(info, "tls13 "+label...)
+	info = append(info, byte(len(context)))
+	info = append(info, context...)
+	out := make([]byte, n)
+	_, _ = hkdf.Expand(h, secret, info).Read(out)
+	return out
+}
+
+type recordDecrypter struct {
+	aead  cipher.AEAD
+	iv    []byte
+	tls13 bool
+	seq   uint64
+}
+
+func newRecordDecrypter(cs cipherSuite, key []byte, iv []byte, tls13 bool) (*recordDecrypter, error) {
+	aead, err := cs.newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &recordDecrypter{aead: aead, iv: iv, tls13: tls13}, nil
+}
+
+// TLS 1.2 key block is
+// client_write_MAC_key, server_write_MAC_key, client_write_key, server_write_key, client_write_IV, server_write_IV
+// MAC keys are empty for AEAD cipher suites
+func newTLS12RecordDecrypter(cs cipherSuite, masterSecret []byte, clientRandom []byte, serverRandom []byte, isClient bool) (*recordDecrypter, error) {
+	seed := append(append([]byte{}, serverRandom...), clientRandom...)
+	kb := prf12(cs.hash, masterSecret, "key expansion", seed, 2*cs.keyLen+2*cs.ivLen)
+	clientKey, kb := kb[0:cs.keyLen], kb[cs.keyLen:]
+	serverKey, kb := kb[0:cs.keyLen], kb[cs.keyLen:]
+	clientIV, kb := kb[0:cs.ivLen], kb[cs.ivLen:]
+	serverIV := kb[0:cs.ivLen]
+	if isClient {
+		return newRecordDecrypter(cs, clientKey, clientIV, false)
+	}
+	return newRecordDecrypter(cs, serverKey, serverIV, false)
+}
+
+func newTLS13RecordDecrypter(cs cipherSuite, trafficSecret []byte) (*recordDecrypter, error) {
+	key := hkdfExpandLabel(cs.hash, trafficSecret, "key", nil, cs.keyLen)
+	iv := hkdfExpandLabel(cs.hash, trafficSecret, "iv", nil, cs.ivLen)
+	return newRecordDecrypter(cs, key, iv, true)
+}
+
+// nonce is iv xor big endian sequence number padded to iv length
+func (r *recordDecrypter) seqNonce() []byte {
+	nonce := append([]byte{}, r.iv...)
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], r.seq)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-8+i] ^= seq[i]
+	}
+	return nonce
+}
+
+func (r *recordDecrypter) decrypt(contentType uint64, version uint64, fragment []byte) ([]byte, error) {
+	var nonce, ciphertext, additionalData []byte
+	switch {
+	case r.tls13:
+		nonce = r.seqNonce()
+		ciphertext = fragment
+		additionalData = []byte{byte(contentType), byte(version >> 8), byte(version), byte(len(fragment) >> 8), byte(len(fragment))}
+	default:
+		if len(r.iv) < r.aead.NonceSize() {
+			// explicit nonce, AES-GCM
+			explicitLen := r.aead.NonceSize() - len(r.iv)
+			if len(fragment) < explicitLen {
+				return nil, errors.New("fragment too short for explicit nonce")
+			}
+			nonce = append(append([]byte{}, r.iv...), fragment[0:explicitLen]...)
+			ciphertext = fragment[explicitLen:]
+		} else {
+			nonce = r.seqNonce()
+			ciphertext = fragment
+		}
+		plaintextLen := len(ciphertext) - r.aead.Overhead()
+		if plaintextLen < 0 {
+			return nil, errors.New("fragment too short")
+		}
+		additionalData = make([]byte, 8)
+		binary.BigEndian.PutUint64(additionalData, r.seq)
+		additionalData = append(additionalData, byte(contentType), byte(version>>8), byte(version), byte(plaintextLen>>8), byte(plaintextLen))
+	}
+
+	plaintext, err := r.aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, err
+	}
+	r.seq++
+
+	return plaintext, nil
+}
+
+// parameters from plaintext client and server hello needed to decrypt
+type helloParams struct {
+	clientRandom   []byte
+	serverRandom   []byte
+	cipherSuite    uint64
+	version        uint64
+	hasServerHello bool
+}
+
+// find hello messages in plaintext handshake records at start of a stream
+func scanHello(bs []byte, p *helloParams) {
+	for len(bs) >= 5 {
+		contentType := bs[0]
+		length := int(binary.BigEndian.Uint16(bs[3:5]))
+		if len(bs) < 5+length || contentType != contentTypeHandshake {
+			return
+		}
+		fragment := bs[5 : 5+length]
+		bs = bs[5+length:]
+
+		for len(fragment) >= 4 {
+			msgType := fragment[0]
+			msgLen := int(fragment[1])<<16 | int(fragment[2])<<8 | int(fragment[3])
+			if len(fragment) < 4+msgLen {
+				return
+			}
+			body := fragment[4 : 4+msgLen]
+			fragment = fragment[4+msgLen:]
+
+			if len(body) < 2+32+1 {
+				continue
+			}
+			switch msgType {
+			case handshakeTypeClientHello:
+				p.clientRandom = body[2:34]
+			case handshakeTypeServerHello:
+				p.hasServerHello = true
+				p.version = uint64(binary.BigEndian.Uint16(body[0:2]))
+				p.serverRandom = body[2:34]
+				// session id, cipher suite, compression method and extensions
+				sessionIDEnd := 35 + int(body[34])
+				if sessionIDEnd > len(body) {
+					continue
+				}
+				b := body[sessionIDEnd:]
+				if len(b) < 3 {
+					continue
+				}
+				p.cipherSuite = uint64(binary.BigEndian.Uint16(b[0:2]))
+				b = b[3:]
+				if len(b) < 2 {
+					continue
+				}
+				extensionsLen := int(binary.BigEndian.Uint16(b[0:2]))
+				b = b[2:]
+				if extensionsLen < len(b) {
+					b = b[:extensionsLen]
+				}
+				for len(b) >= 4 {
+					typ := binary.BigEndian.Uint16(b[0:2])
+					extLen := int(binary.BigEndian.Uint16(b[2:4]))
+					if len(b) < 4+extLen {
+						break
+					}
+					if typ == extensionSupportedVersions && extLen == 2 {
+						p.version = uint64(binary.BigEndian.Uint16(b[4:6]))
+					}
+					b = b[4+extLen:]
+				}
+			}
+		}
+	}
+}
+
+// types of handshake messages in a fragment
+func handshakeMessageTypes(bs []byte) []uint64 {
+	var types []uint64
+	for len(bs) >= 4 {
+		msgLen := int(bs[1])<<16 | int(bs[2])<<8 | int(bs[3])
+		types = append(types, uint64(bs[0]))
+		if len(bs) < 4+msgLen {
+			break
+		}
+		bs = bs[4+msgLen:]
+	}
+	return types
+}
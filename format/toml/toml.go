@@ -3,6 +3,7 @@ package toml
 import (
 	"bytes"
 	"embed"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/wader/fq/format"
@@ -37,7 +38,13 @@ func decodeTOML(d *decode.D, _ any) any {
 		d.Fatalf("%s", err)
 	}
 	var s scalar.S
-	s.Actual = gojqex.Normalize(r)
+	s.Actual = gojqex.NormalizeFn(r, func(v any) any {
+		if t, ok := v.(time.Time); ok {
+			return tomlTimeToString(t)
+		}
+		r, _ := gojqex.ToGoJQValue(v)
+		return r
+	})
 
 	// TODO: better way to handle that an empty file is valid toml and parsed as an object
 	switch v := s.Actual.(type) {
@@ -56,6 +63,20 @@ func decodeTOML(d *decode.D, _ any) any {
 	return nil
 }
 
+// local date and times are decoded with special zones, format them without offset
+func tomlTimeToString(t time.Time) string {
+	switch t.Location().String() {
+	case "datetime-local":
+		return t.Format("2006-01-02T15:04:05.999999999")
+	case "date-local":
+		return t.Format("2006-01-02")
+	case "time-local":
+		return t.Format("15:04:05.999999999")
+	default:
+		return t.Format(time.RFC3339Nano)
+	}
+}
+
 func toTOML(_ *interp.Interp, c any) any {
 	if c == nil {
 		return gojqex.FuncTypeError{Name: "totoml", V: c}
@@ -0,0 +1,283 @@
+package truehd
+
+// https://github.com/FFmpeg/FFmpeg/blob/master/libavcodec/mlp_parse.c
+// https://github.com/FFmpeg/FFmpeg/blob/master/libavcodec/mlpdec.c
+// https://gitlab.com/mbunkus/mkvtoolnix/-/blob/main/src/common/truehd.cpp
+
+// TODO: decode restart headers and blocks in substreams
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/checksum"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed truehd.jq
+var truehdFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.TRUEHD,
+		ProbeOrder:  format.ProbeOrderBinFuzzy, // major sync is not at start of file
+		Description: "Dolby TrueHD and Meridian Lossless Packing",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    truehdDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(truehdFS)
+}
+
+const (
+	majorSyncTrueHD = 0xf8726fba
+	majorSyncMLP    = 0xf8726fbb
+	majorSyncBytes  = 28
+	signature       = 0xb752
+)
+
+var majorSyncNames = scalar.UToSymStr{
+	majorSyncTrueHD: "truehd",
+	majorSyncMLP:    "mlp",
+}
+
+var majorSyncCRCTable = checksum.MakeTable(0x002d, 16)
+
+var quantWordSizeMap = scalar.UToSymU{
+	0: 16,
+	1: 20,
+	2: 24,
+}
+
+// 48000 or 44100 times a power of two
+var sampleRateMapper = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	v := s.ActualU()
+	if v == 0xf {
+		s.Description = "not present"
+		return s, nil
+	}
+	rate := uint64(48000)
+	if v&8 != 0 {
+		rate = 44100
+	}
+	s.Sym = rate << (v & 7)
+	return s, nil
+})
+
+// two channel presentation (stream 0) uses 2 bits, 6 channel (stream 1) 5 bits and 8 channel (stream 2) 13 bits
+var channelAssignmentNames = []string{
+	"lfe2",
+	"tfc",
+	"lw_rw",
+	"lsd_rsd",
+	"ts",
+	"cs",
+	"lrs_rrs",
+	"lc_rc",
+	"tfl_tfr",
+	"ls_rs",
+	"lfe",
+	"c",
+	"l_r",
+}
+
+var channelModifierNames = scalar.UToSymStr{
+	0: "stereo",
+	1: "lt_rt",
+	2: "lbin_rbin",
+	3: "mono",
+}
+
+func decodeChannelAssignment(d *decode.D, name string, nBits int) {
+	d.FieldStruct(name, func(d *decode.D) {
+		for _, n := range channelAssignmentNames[len(channelAssignmentNames)-nBits:] {
+			d.FieldBool(n)
+		}
+	})
+}
+
+// size of major sync including optional extra channel meaning
+func majorSyncSize(d *decode.D, pos int64) int64 {
+	if pos+majorSyncBytes*8 > d.Len() {
+		return 0
+	}
+	bs := d.BytesRange(pos, majorSyncBytes)
+	sync := uint64(bs[0])<<24 | uint64(bs[1])<<16 | uint64(bs[2])<<8 | uint64(bs[3])
+	switch sync {
+	case majorSyncTrueHD:
+		if bs[25]&1 != 0 {
+			return majorSyncBytes + 2 + int64(bs[26]>>4)*2
+		}
+		return majorSyncBytes
+	case majorSyncMLP:
+		return majorSyncBytes
+	default:
+		return 0
+	}
+}
+
+func decodeMajorSync(d *decode.D) {
+	start := d.Pos()
+	size := majorSyncSize(d, start)
+
+	sync := d.FieldU32("format_sync", majorSyncNames, scalar.ActualHex)
+	d.FieldStruct("format_info", func(d *decode.D) {
+		switch sync {
+		case majorSyncTrueHD:
+			d.FieldU4("audio_sampling_frequency", sampleRateMapper)
+			d.FieldU4("reserved")
+			d.FieldU2("2ch_presentation_channel_modifier", channelModifierNames)
+			d.FieldU2("6ch_presentation_channel_modifier", channelModifierNames)
+			decodeChannelAssignment(d, "6ch_presentation_channel_assignment", 5)
+			d.FieldU2("8ch_presentation_channel_modifier", channelModifierNames)
+			decodeChannelAssignment(d, "8ch_presentation_channel_assignment", 13)
+		case majorSyncMLP:
+			d.FieldU4("quantization_word_size_1", quantWordSizeMap)
+			d.FieldU4("quantization_word_size_2", quantWordSizeMap)
+			d.FieldU4("audio_sampling_frequency_1", sampleRateMapper)
+			d.FieldU4("audio_sampling_frequency_2", sampleRateMapper)
+			d.FieldU11("reserved")
+			d.FieldU5("channel_assignment")
+		}
+	})
+	d.FieldU16("signature", d.ValidateU(signature), scalar.ActualHex)
+	d.FieldU16("flags", scalar.ActualHex)
+	d.FieldU16("reserved")
+	d.FieldBool("variable_rate")
+	d.FieldU15("peak_data_rate")
+	d.FieldU4("substreams")
+	d.FieldU2("reserved2")
+	d.FieldU2("extended_substream_info")
+	d.FieldU8("substream_info", scalar.ActualHex)
+	if sync == majorSyncTrueHD {
+		d.FieldStruct("channel_meaning", func(d *decode.D) {
+			d.FieldU6("reserved")
+			d.FieldBool("2ch_control_enabled")
+			d.FieldBool("6ch_control_enabled")
+			d.FieldBool("8ch_control_enabled")
+			d.FieldU1("reserved2")
+			d.FieldS7("drc_start_up_gain")
+			d.FieldU6("2ch_dialogue_norm")
+			d.FieldU6("2ch_mix_level")
+			d.FieldU5("6ch_dialogue_norm")
+			d.FieldU6("6ch_mix_level")
+			d.FieldU5("6ch_source_format")
+			d.FieldU5("8ch_dialogue_norm")
+			d.FieldU6("8ch_mix_level")
+			d.FieldU6("8ch_source_format")
+			d.FieldU1("reserved3")
+			if d.FieldBool("extra_channel_meaning_present") {
+				d.FieldRawLen("extra_channel_meaning", start+(size-2)*8-d.Pos())
+			}
+		})
+	} else {
+		d.FieldRawLen("channel_meaning", 8*8)
+	}
+
+	crc := &checksum.CRC{Bits: 16, Table: majorSyncCRCTable}
+	d.CopyBits(crc, d.BitBufRange(start, d.Pos()-start))
+	// crc is stored little endian
+	d.FieldU16LE("major_sync_info_crc", d.ValidateUBEBytes(crc.Sum(nil)), scalar.ActualHex)
+}
+
+// check nibble makes xor of all nibbles in access unit header and substream directory 0xf
+func checkNibble(d *decode.D, start int64, majorSyncBytes int64, numSubstreams uint64) uint64 {
+	parity := d.BytesRange(start, 4)
+	v := parity[0]&0x0f ^ parity[1] ^ parity[2] ^ parity[3]
+	pos := start + (4+majorSyncBytes)*8
+	for i := uint64(0); i < numSubstreams && pos+16 <= d.Len(); i++ {
+		bs := d.BytesRange(pos, 2)
+		v ^= bs[0] ^ bs[1]
+		pos += 16
+		if bs[0]&0x80 != 0 && pos+16 <= d.Len() {
+			bs := d.BytesRange(pos, 2)
+			v ^= bs[0] ^ bs[1]
+			pos += 16
+		}
+	}
+	return uint64((v>>4^v)&0xf) ^ 0xf
+}
+
+func truehdDecode(d *decode.D, _ any) any {
+	if majorSyncSize(d, 4*8) == 0 {
+		d.Fatalf("first access unit has no major sync")
+	}
+
+	var numSubstreams uint64
+	d.FieldArray("access_units", func(d *decode.D) {
+		for d.BitsLeft() >= 4*8 {
+			start := d.Pos()
+			unitBytes := int64(d.PeekBits(16)&0xfff) * 2
+			if unitBytes < 4 || start+unitBytes*8 > d.Len() {
+				break
+			}
+			syncBytes := majorSyncSize(d, start+4*8)
+			if syncBytes > 0 {
+				// number of substreams is in the major sync at byte 16
+				d.SeekAbs(start+(4+16)*8, func(d *decode.D) { numSubstreams = d.U4() })
+			}
+			expectedNibble := checkNibble(d, start, syncBytes, numSubstreams)
+			d.SeekAbs(start)
+
+			d.FieldStruct("access_unit", func(d *decode.D) {
+				d.FieldU4("check_nibble", d.ValidateU(expectedNibble), scalar.ActualHex)
+				d.FieldU12("access_unit_length", scalar.ActualUFn(func(v uint64) uint64 { return v * 2 }))
+				d.FieldU16("input_timing")
+				if syncBytes > 0 {
+					d.FieldStruct("major_sync", decodeMajorSync)
+				}
+
+				var substreamEnds []int64
+				var substreamChecks []bool
+				d.FieldArray("substream_directory", func(d *decode.D) {
+					for i := uint64(0); i < numSubstreams; i++ {
+						d.FieldStruct("substream", func(d *decode.D) {
+							extraSubstreamWord := d.FieldBool("extra_substream_word")
+							d.FieldBool("restart_nonexistent")
+							substreamChecks = append(substreamChecks, d.FieldBool("crc_present"))
+							d.FieldU1("reserved")
+							substreamEnds = append(substreamEnds, int64(d.FieldU12("substream_end_ptr", scalar.ActualUFn(func(v uint64) uint64 { return v * 2 }))))
+							if extraSubstreamWord {
+								d.FieldS9("drc_gain_update")
+								d.FieldU3("drc_time_update")
+								d.FieldU4("reserved2")
+							}
+						})
+					}
+				})
+
+				dataStart := d.Pos()
+				unitEnd := start + unitBytes*8
+				d.FieldArray("substreams", func(d *decode.D) {
+					for i, end := range substreamEnds {
+						endPos := dataStart + end*8
+						if endPos < d.Pos() || endPos > unitEnd {
+							break
+						}
+						d.FramedFn(endPos-d.Pos(), func(d *decode.D) {
+							d.FieldStruct("substream", func(d *decode.D) {
+								if substreamChecks[i] && d.BitsLeft() >= 16 {
+									d.FieldRawLen("data", d.BitsLeft()-16)
+									d.FieldU8("parity", scalar.ActualHex)
+									d.FieldU8("crc", scalar.ActualHex)
+									return
+								}
+								d.FieldRawLen("data", d.BitsLeft())
+							})
+						})
+					}
+				})
+				if d.Pos() < unitEnd {
+					d.FieldRawLen("unknown", unitEnd-d.Pos())
+				}
+			})
+		}
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("trailing", d.BitsLeft())
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package verity
+
+// https://docs.kernel.org/admin-guide/device-mapper/verity.html
+// https://gitlab.com/cryptsetup/cryptsetup/-/wikis/DMVerity
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed dm_verity.jq
+var dmVerityFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.DM_VERITY,
+		Description: "dm-verity hash device",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    dmVerityDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(dmVerityFS)
+}
+
+const (
+	superblockLen = 512
+	maxSaltLen    = 256
+)
+
+var hashTypeNames = scalar.UToSymStr{
+	0: "chrome_os",
+	1: "normal",
+}
+
+var digestLens = map[string]int64{
+	"sha1":   20,
+	"sha256": 32,
+	"sha512": 64,
+}
+
+func isPowerOfTwo(n uint64) bool { return n != 0 && n&(n-1) == 0 }
+
+// number of hash blocks per level, index 0 is the level closest to the data blocks
+func levelSizes(dataBlocks uint64, hashesPerBlock uint64) []uint64 {
+	var sizes []uint64
+	for n := dataBlocks; n > 1; {
+		n = (n + hashesPerBlock - 1) / hashesPerBlock
+		sizes = append(sizes, n)
+	}
+	return sizes
+}
+
+// hashesPerBlock is rounded down to a power of two and each hash is stored in
+// a hashBlockSize/hashesPerBlock slot, for most digests slot and digest length are the same
+func hashesPerBlockPowerOfTwo(hashBlockSize uint64, digestLen int64) uint64 {
+	n := hashBlockSize / uint64(digestLen)
+	p := uint64(1)
+	for p*2 <= n {
+		p *= 2
+	}
+	return p
+}
+
+func decodeHashTree(d *decode.D, dataBlocks uint64, hashBlockSize uint64, hashesPerBlock uint64) {
+	slotLen := int64(hashBlockSize/hashesPerBlock) * 8
+	sizes := levelSizes(dataBlocks, hashesPerBlock)
+
+	var treeBlocks uint64
+	for _, n := range sizes {
+		treeBlocks += n
+	}
+	if uint64(d.BitsLeft()) < treeBlocks*hashBlockSize*8 {
+		d.Fatalf("hash tree needs %d blocks", treeBlocks)
+	}
+
+	// top level is stored first
+	d.FieldArray("levels", func(d *decode.D) {
+		for level := len(sizes) - 1; level >= 0; level-- {
+			entries := dataBlocks
+			if level > 0 {
+				entries = sizes[level-1]
+			}
+			d.FieldStruct("level", func(d *decode.D) {
+				d.FieldValueU("level", uint64(level))
+				d.FieldArray("blocks", func(d *decode.D) {
+					for i := uint64(0); i < sizes[level]; i++ {
+						d.FieldStruct("block", func(d *decode.D) {
+							blockStart := d.Pos()
+							n := entries - i*hashesPerBlock
+							if n > hashesPerBlock {
+								n = hashesPerBlock
+							}
+							d.FieldArray("hashes", func(d *decode.D) {
+								for j := uint64(0); j < n; j++ {
+									d.FieldRawLen("hash", slotLen, scalar.RawHex)
+								}
+							})
+							if padLen := int64(hashBlockSize)*8 - (d.Pos() - blockStart); padLen > 0 {
+								d.FieldRawLen("padding", padLen, d.BitBufIsZero())
+							}
+						})
+					}
+				})
+			})
+		}
+	})
+}
+
+func dmVerityDecode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	var algorithm string
+	var dataBlocks uint64
+	var hashBlockSize uint64
+
+	d.FieldStruct("superblock", func(d *decode.D) {
+		d.FieldUTF8NullFixedLen("signature", 8, d.AssertStr("verity"))
+		d.FieldU32("version", d.AssertU(1))
+		d.FieldU32("hash_type", hashTypeNames)
+		d.FieldRawLen("uuid", 16*8, scalar.RawUUID)
+		algorithm = d.FieldUTF8NullFixedLen("algorithm", 32)
+		dataBlockSize := d.FieldU32("data_block_size")
+		hashBlockSize = d.FieldU32("hash_block_size")
+		if !isPowerOfTwo(dataBlockSize) || !isPowerOfTwo(hashBlockSize) || hashBlockSize < superblockLen {
+			d.Fatalf("invalid block sizes %d %d", dataBlockSize, hashBlockSize)
+		}
+		dataBlocks = d.FieldU64("data_blocks")
+		saltSize := d.FieldU16("salt_size", d.AssertURange(0, maxSaltLen))
+		d.FieldRawLen("padding0", 6*8, d.BitBufIsZero())
+		d.FieldRawLen("salt", int64(saltSize)*8, scalar.RawHex)
+		d.FieldRawLen("salt_padding", int64(maxSaltLen-saltSize)*8, d.BitBufIsZero())
+		d.FieldRawLen("padding1", 168*8, d.BitBufIsZero())
+	})
+	// hash tree starts at next hash block
+	if padLen := int64(hashBlockSize-superblockLen) * 8; padLen > 0 {
+		d.FieldRawLen("padding", padLen)
+	}
+
+	digestLen, ok := digestLens[algorithm]
+	if !ok {
+		d.FieldRawLen("hash_tree", d.BitsLeft())
+		return nil
+	}
+	d.FieldStruct("hash_tree", func(d *decode.D) {
+		decodeHashTree(d, dataBlocks, hashBlockSize, hashesPerBlockPowerOfTwo(hashBlockSize, digestLen))
+	})
+
+	return nil
+}
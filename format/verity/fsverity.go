@@ -0,0 +1,71 @@
+package verity
+
+// https://docs.kernel.org/filesystems/fsverity.html
+// descriptor as stored on disk or from "fsverity dump_metadata descriptor"
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed fsverity.jq
+var fsverityFS embed.FS
+
+var asn1BerFormat decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.FSVERITY,
+		Description: "fs-verity descriptor",
+		DecodeFn:    fsverityDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.ASN1_BER}, Group: &asn1BerFormat},
+		},
+		Functions: []string{"_help"},
+	})
+	interp.RegisterFS(fsverityFS)
+}
+
+const (
+	fsverityHashSHA256 = 1
+	fsverityHashSHA512 = 2
+)
+
+var fsverityHashNames = scalar.UToSymStr{
+	fsverityHashSHA256: "sha256",
+	fsverityHashSHA512: "sha512",
+}
+
+const (
+	maxRootHashLen     = 64
+	maxFsveritySaltLen = 32
+)
+
+func fsverityDecode(d *decode.D, _ any) any {
+	d.Endian = decode.LittleEndian
+
+	d.FieldU8("version", d.AssertU(1))
+	hashAlgorithm := d.FieldU8("hash_algorithm", fsverityHashNames, d.AssertU(fsverityHashSHA256, fsverityHashSHA512))
+	logBlockSize := d.FieldU8("log_blocksize", d.AssertURange(10, 16))
+	d.FieldValueU("block_size", 1<<logBlockSize)
+	saltSize := d.FieldU8("salt_size", d.AssertURange(0, maxFsveritySaltLen))
+	sigSize := d.FieldU32("sig_size")
+	d.FieldU64("data_size")
+	digestLen := digestLens[fsverityHashNames[hashAlgorithm]]
+	d.FieldRawLen("root_hash", digestLen*8, scalar.RawHex)
+	d.FieldRawLen("root_hash_padding", (maxRootHashLen-digestLen)*8, d.BitBufIsZero())
+	d.FieldRawLen("salt", int64(saltSize)*8, scalar.RawHex)
+	d.FieldRawLen("salt_padding", int64(maxFsveritySaltLen-saltSize)*8, d.BitBufIsZero())
+	d.FieldRawLen("reserved", 144*8, d.BitBufIsZero())
+
+	// builtin signature is a DER encoded PKCS#7 message
+	if sigSize > 0 {
+		d.FieldFormatOrRawLen("signature", int64(sigSize)*8, asn1BerFormat, nil)
+	}
+
+	return nil
+}
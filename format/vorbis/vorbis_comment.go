@@ -2,6 +2,7 @@ package vorbis
 
 import (
 	"encoding/base64"
+	"fmt"
 	"io"
 	"strings"
 
@@ -17,6 +18,7 @@ func init() {
 		Name:        format.VORBIS_COMMENT,
 		Description: "Vorbis comment",
 		DecodeFn:    commentDecode,
+		EncodeFn:    commentEncode,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.FLAC_PICTURE}, Group: &flacPicture},
 		},
@@ -57,3 +59,53 @@ func commentDecode(d *decode.D, _ any) any {
 
 	return nil
 }
+
+// lengths are recalculated, user comments can be objects with a comment
+// field or strings, picture is ignored as it's decoded from the comment
+func commentEncode(e *decode.E, v any) error {
+	e.Endian = decode.LittleEndian
+
+	obj, err := interp.EncodeObject(v)
+	if err != nil {
+		return err
+	}
+	vendor, err := interp.EncodeString(obj["vendor"])
+	if err != nil {
+		return fmt.Errorf("vendor: %w", err)
+	}
+	e.U32(uint64(len(vendor)))
+	e.WriteBytes([]byte(vendor))
+
+	var userComments []any
+	if cv, ok := obj["user_comments"]; ok {
+		if userComments, err = interp.EncodeArray(cv); err != nil {
+			return fmt.Errorf("user_comments: %w", err)
+		}
+	}
+	e.U32(uint64(len(userComments)))
+	for i, uv := range userComments {
+		ok, err := interp.EncodeRaw(e, uv)
+		if err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
+		cv := uv
+		if _, isStr := uv.(string); !isStr {
+			uobj, err := interp.EncodeObject(uv)
+			if err != nil {
+				return fmt.Errorf("user_comments[%d]: %w", i, err)
+			}
+			cv = uobj["comment"]
+		}
+		comment, err := interp.EncodeString(cv)
+		if err != nil {
+			return fmt.Errorf("user_comments[%d]: %w", i, err)
+		}
+		e.U32(uint64(len(comment)))
+		e.WriteBytes([]byte(comment))
+	}
+
+	return nil
+}
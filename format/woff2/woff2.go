@@ -0,0 +1,218 @@
+package woff2
+
+// https://www.w3.org/TR/WOFF2/
+
+// TODO: brotli decompress font data and decode using opentype
+// TODO: transformed glyf, loca and hmtx tables
+
+import (
+	"bytes"
+	"compress/zlib"
+	"embed"
+	"io"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed woff2.jq
+var woff2FS embed.FS
+
+var xmlFormat decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.WOFF2,
+		Description: "Web Open Font Format 2",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    woff2Decode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.XML}, Group: &xmlFormat},
+		},
+		Functions: []string{"_help"},
+	})
+	interp.RegisterFS(woff2FS)
+}
+
+const (
+	flavorTrueType   = 0x00010000
+	flavorCFF        = 0x4f54544f // OTTO
+	flavorTrueApple  = 0x74727565 // true
+	flavorCollection = 0x74746366 // ttcf
+)
+
+var flavorNames = scalar.UToSymStr{
+	flavorTrueType:   "truetype",
+	flavorCFF:        "cff",
+	flavorTrueApple:  "apple_truetype",
+	flavorCollection: "collection",
+}
+
+const arbitraryTagIndex = 63
+
+// index in table directory flags to tag
+var knownTags = []string{
+	"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post",
+	"cvt ", "fpgm", "glyf", "loca", "prep", "CFF ", "VORG", "EBDT",
+	"EBLC", "gasp", "hdmx", "kern", "LTSH", "PCLT", "VDMX", "vhea",
+	"vmtx", "BASE", "GDEF", "GPOS", "GSUB", "EBSC", "JSTF", "MATH",
+	"CBDT", "CBLC", "COLR", "CPAL", "SVG ", "sbix", "acnt", "avar",
+	"bdat", "bloc", "bsln", "cvar", "fdsc", "feat", "fmtx", "fvar",
+	"gvar", "hsty", "just", "lcar", "mort", "morx", "opbd", "prop",
+	"trak", "Zapf", "Silf", "Glat", "Gloc", "Feat", "Sill",
+}
+
+var knownTagMapper = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	if i := int(s.ActualU()); i < len(knownTags) {
+		s.Sym = knownTags[i]
+	} else if i == arbitraryTagIndex {
+		s.Sym = "arbitrary"
+	}
+	return s, nil
+})
+
+// UIntBase128, big endian 7 bits per byte with high bit as continuation, at most 5 bytes
+func uintBase128(d *decode.D) uint64 {
+	var v uint64
+	for i := 0; i < 5; i++ {
+		b := d.U8()
+		if i == 0 && b == 0x80 {
+			d.Fatalf("UIntBase128 with leading zeros")
+		}
+		if v&0xfe00_0000 != 0 {
+			d.Fatalf("UIntBase128 overflow")
+		}
+		v = v<<7 | b&0x7f
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+	d.Fatalf("UIntBase128 longer than 5 bytes")
+	return 0
+}
+
+const (
+	oneMoreByteCode1 = 255
+	oneMoreByteCode2 = 254
+	wordCode         = 253
+	lowestUCode      = 253
+)
+
+// 255UInt16, variable length encoding of small numbers
+func uint255(d *decode.D) uint64 {
+	switch code := d.U8(); code {
+	case wordCode:
+		return d.U16()
+	case oneMoreByteCode1:
+		return d.U8() + lowestUCode
+	case oneMoreByteCode2:
+		return d.U8() + lowestUCode*2
+	default:
+		return code
+	}
+}
+
+func woff2Decode(d *decode.D, _ any) any {
+	d.FieldUTF8("signature", 4, d.AssertStr("wOF2"))
+	flavor := d.FieldU32("flavor", flavorNames, scalar.ActualHex)
+	d.FieldU32("length", d.ValidateU(uint64(d.Len()/8)))
+	numTables := d.FieldU16("num_tables")
+	d.FieldU16("reserved")
+	d.FieldU32("total_sfnt_size")
+	totalCompressedSize := d.FieldU32("total_compressed_size")
+	d.FieldU16("major_version")
+	d.FieldU16("minor_version")
+	metaOffset := d.FieldU32("meta_offset")
+	metaLength := d.FieldU32("meta_length")
+	metaOrigLength := d.FieldU32("meta_orig_length")
+	privOffset := d.FieldU32("priv_offset")
+	privLength := d.FieldU32("priv_length")
+
+	var i uint64
+	d.FieldStructArrayLoop("table_directory", "table", func() bool { return i < numTables }, func(d *decode.D) {
+		var transformVersion uint64
+		var tagIndex uint64
+		d.FieldStruct("flags", func(d *decode.D) {
+			transformVersion = d.FieldU2("transform_version")
+			tagIndex = d.FieldU6("tag_index", knownTagMapper)
+		})
+		var tag string
+		if tagIndex == arbitraryTagIndex {
+			tag = d.FieldUTF8("tag", 4)
+		} else if tagIndex < uint64(len(knownTags)) {
+			tag = knownTags[tagIndex]
+			d.FieldValueStr("tag", tag)
+		}
+		d.FieldUFn("orig_length", uintBase128)
+		// for glyf and loca version 0 is transformed and 3 is null transform,
+		// for other tables version 0 is null transform
+		transformed := transformVersion != 0
+		if tag == "glyf" || tag == "loca" {
+			transformed = transformVersion != 3
+		}
+		d.FieldValueBool("transformed", transformed)
+		if transformed {
+			d.FieldUFn("transform_length", uintBase128)
+		}
+		i++
+	})
+
+	if flavor == flavorCollection {
+		d.FieldStruct("collection_header", func(d *decode.D) {
+			d.FieldU32("version", scalar.ActualHex)
+			numFonts := d.FieldUFn("num_fonts", uint255)
+			d.FieldArray("fonts", func(d *decode.D) {
+				for i := uint64(0); i < numFonts; i++ {
+					d.FieldStruct("font", func(d *decode.D) {
+						numTables := d.FieldUFn("num_tables", uint255)
+						d.FieldU32("flavor", flavorNames, scalar.ActualHex)
+						d.FieldArray("table_indices", func(d *decode.D) {
+							for i := uint64(0); i < numTables; i++ {
+								d.FieldUFn("index", uint255)
+							}
+						})
+					})
+				}
+			})
+		})
+	}
+
+	// single brotli stream with all tables
+	d.FieldRawLen("compressed_data", int64(totalCompressedSize)*8)
+
+	if metaLength > 0 {
+		if padBits := int64(metaOffset)*8 - d.Pos(); padBits > 0 {
+			d.FieldRawLen("metadata_padding", padBits)
+		}
+		d.FieldStruct("metadata", func(d *decode.D) {
+			d.FieldRawLen("compressed", int64(metaLength)*8)
+			zr, err := zlib.NewReader(bytes.NewReader(d.BytesRange(int64(metaOffset)*8, int(metaLength))))
+			if err != nil {
+				return
+			}
+			uncompressed, err := io.ReadAll(zr)
+			if err != nil {
+				return
+			}
+			if uint64(len(uncompressed)) != metaOrigLength {
+				d.Errorf("metadata uncompressed length %d does not match %d", len(uncompressed), metaOrigLength)
+			}
+			uncompressedBR := bitio.NewBitReader(uncompressed, -1)
+			if dv, _, _ := d.TryFieldFormatBitBuf("uncompressed", uncompressedBR, xmlFormat, nil); dv == nil {
+				d.FieldRootBitBuf("uncompressed", uncompressedBR)
+			}
+		})
+	}
+
+	if privLength > 0 {
+		if padBits := int64(privOffset)*8 - d.Pos(); padBits > 0 {
+			d.FieldRawLen("private_data_padding", padBits)
+		}
+		d.FieldRawLen("private_data", int64(privLength)*8)
+	}
+
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"embed"
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"html"
 	"io"
 	"regexp"
@@ -25,6 +26,8 @@ import (
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
 	"github.com/wader/fq/pkg/scalar"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
 )
 
 //go:embed xml.jq
@@ -218,12 +221,31 @@ func fromXMLToObject(n xmlNode, xi format.XMLIn) any {
 func decodeXML(d *decode.D, in any) any {
 	xi, _ := in.(format.XMLIn)
 
+	// UTF-16 is transcoded to UTF-8 so decoder offsets are not input offsets
+	isUTF16 := false
+	if bom, err := d.TryPeekBytes(2); err == nil {
+		isUTF16 = bytes.Equal(bom, []byte{0xff, 0xfe}) || bytes.Equal(bom, []byte{0xfe, 0xff})
+	}
+
 	br := d.RawLen(d.Len())
 	var r any
 	var err error
 
-	xd := xml.NewDecoder(bitio.NewIOReader(br))
+	var xr io.Reader = bitio.NewIOReader(br)
+	if isUTF16 {
+		xr = transform.NewReader(xr, unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder())
+	}
+	xd := xml.NewDecoder(xr)
 	xd.Strict = false
+	if isUTF16 {
+		xd.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+			// already transcoded
+			if strings.HasPrefix(strings.ToLower(charset), "utf-16") {
+				return input, nil
+			}
+			return nil, fmt.Errorf("UTF-16 BOM but %q declared", charset)
+		}
+	}
 	var n xmlNode
 	if err := xd.Decode(&n); err != nil {
 		d.Fatalf("%s", err)
@@ -249,7 +271,9 @@ func decodeXML(d *decode.D, in any) any {
 
 	// continue decode to end and make sure there is only things we want to ignore
 	for {
-		d.SeekAbs(xd.InputOffset() * 8)
+		if !isUTF16 {
+			d.SeekAbs(xd.InputOffset() * 8)
+		}
 		t, err := xd.Token()
 		if errors.Is(err, io.EOF) {
 			break
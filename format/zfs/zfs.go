@@ -0,0 +1,519 @@
+package zfs
+
+// https://github.com/openzfs/zfs/blob/master/include/sys/vdev_impl.h
+// https://github.com/openzfs/zfs/blob/master/include/sys/uberblock_impl.h
+// https://github.com/openzfs/zfs/blob/master/include/sys/spa.h
+// https://github.com/openzfs/zfs/blob/master/module/nvpair/nvpair.c
+// TODO: decode boot envelope
+// TODO: decode MOS and object sets referenced by root block pointer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/binary"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed zfs.jq
+var zfsFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.ZFS,
+		Description: "ZFS vdev labels and uberblocks",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    zfsDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(zfsFS)
+}
+
+const (
+	labelLen         = 256 * 1024
+	labelPadLen      = 8 * 1024
+	bootEnvelopeLen  = 8 * 1024
+	vdevPhysLen      = 112 * 1024
+	uberblockRingLen = 128 * 1024
+	eckLen           = 40
+
+	uberblockShift    = 10
+	maxUberblockShift = 13
+)
+
+const (
+	eckMagic       = 0x0210da7ab10c7a11
+	uberblockMagic = 0x00bab10c
+)
+
+var nvEncodingNames = scalar.UToSymStr{
+	0: "native",
+	1: "xdr",
+}
+
+var nvEndianNames = scalar.UToSymStr{
+	0: "big_endian",
+	1: "little_endian",
+}
+
+const (
+	dataTypeBoolean      = 1
+	dataTypeByte         = 2
+	dataTypeInt16        = 3
+	dataTypeUint16       = 4
+	dataTypeInt32        = 5
+	dataTypeUint32       = 6
+	dataTypeInt64        = 7
+	dataTypeUint64       = 8
+	dataTypeString       = 9
+	dataTypeByteArray    = 10
+	dataTypeInt16Array   = 11
+	dataTypeUint16Array  = 12
+	dataTypeInt32Array   = 13
+	dataTypeUint32Array  = 14
+	dataTypeInt64Array   = 15
+	dataTypeUint64Array  = 16
+	dataTypeStringArray  = 17
+	dataTypeHrtime       = 18
+	dataTypeNVList       = 19
+	dataTypeNVListArray  = 20
+	dataTypeBooleanValue = 21
+	dataTypeInt8         = 22
+	dataTypeUint8        = 23
+	dataTypeBooleanArray = 24
+	dataTypeInt8Array    = 25
+	dataTypeUint8Array   = 26
+	dataTypeDouble       = 27
+)
+
+var dataTypeNames = scalar.UToSymStr{
+	0:                    "unknown",
+	dataTypeBoolean:      "boolean",
+	dataTypeByte:         "byte",
+	dataTypeInt16:        "int16",
+	dataTypeUint16:       "uint16",
+	dataTypeInt32:        "int32",
+	dataTypeUint32:       "uint32",
+	dataTypeInt64:        "int64",
+	dataTypeUint64:       "uint64",
+	dataTypeString:       "string",
+	dataTypeByteArray:    "byte_array",
+	dataTypeInt16Array:   "int16_array",
+	dataTypeUint16Array:  "uint16_array",
+	dataTypeInt32Array:   "int32_array",
+	dataTypeUint32Array:  "uint32_array",
+	dataTypeInt64Array:   "int64_array",
+	dataTypeUint64Array:  "uint64_array",
+	dataTypeStringArray:  "string_array",
+	dataTypeHrtime:       "hrtime",
+	dataTypeNVList:       "nvlist",
+	dataTypeNVListArray:  "nvlist_array",
+	dataTypeBooleanValue: "boolean_value",
+	dataTypeInt8:         "int8",
+	dataTypeUint8:        "uint8",
+	dataTypeBooleanArray: "boolean_array",
+	dataTypeInt8Array:    "int8_array",
+	dataTypeUint8Array:   "uint8_array",
+	dataTypeDouble:       "double",
+}
+
+var compressNames = scalar.UToSymStr{
+	0:  "inherit",
+	1:  "on",
+	2:  "off",
+	3:  "lzjb",
+	4:  "empty",
+	5:  "gzip_1",
+	6:  "gzip_2",
+	7:  "gzip_3",
+	8:  "gzip_4",
+	9:  "gzip_5",
+	10: "gzip_6",
+	11: "gzip_7",
+	12: "gzip_8",
+	13: "gzip_9",
+	14: "zle",
+	15: "lz4",
+	16: "zstd",
+}
+
+var checksumNames = scalar.UToSymStr{
+	0:  "inherit",
+	1:  "on",
+	2:  "off",
+	3:  "label",
+	4:  "gang_header",
+	5:  "zilog",
+	6:  "fletcher_2",
+	7:  "fletcher_4",
+	8:  "sha256",
+	9:  "zilog2",
+	10: "noparity",
+	11: "sha512",
+	12: "skein",
+	13: "edonr",
+	14: "blake3",
+}
+
+var objectTypeNames = scalar.UToSymStr{
+	0:  "none",
+	1:  "object_directory",
+	2:  "object_array",
+	3:  "packed_nvlist",
+	4:  "packed_nvlist_size",
+	5:  "bpobj",
+	6:  "bpobj_hdr",
+	7:  "space_map_header",
+	8:  "space_map",
+	9:  "intent_log",
+	10: "dnode",
+	11: "objset",
+	12: "dsl_dir",
+	13: "dsl_dir_child_map",
+	14: "dsl_ds_snap_map",
+	15: "dsl_props",
+	16: "dsl_dataset",
+	17: "znode",
+	18: "oldacl",
+	19: "plain_file_contents",
+	20: "directory_contents",
+	21: "master_node",
+	22: "unlinked_set",
+	23: "zvol",
+	24: "zvol_prop",
+}
+
+// nvlist values collected while decoding, uint64 for integers, string or nvlistValues
+type nvlistValues map[string]any
+
+func fieldXDRString(d *decode.D, name string) string {
+	length := d.FieldU32(name + "_length")
+	s := d.FieldUTF8(name, int(length))
+	if pad := (4 - length%4) % 4; pad != 0 {
+		d.FieldRawLen(name+"_padding", int64(pad)*8)
+	}
+	return s
+}
+
+func decodeNVPairValue(d *decode.D, typ uint64, nelem uint64) any {
+	switch typ {
+	case dataTypeBoolean:
+		return nil
+	// types smaller than 64 bit are encoded as 32 bit
+	case dataTypeByte, dataTypeUint8, dataTypeUint16, dataTypeUint32, dataTypeBooleanValue:
+		return d.FieldU32("value")
+	case dataTypeInt8, dataTypeInt16, dataTypeInt32:
+		return uint64(d.FieldS32("value"))
+	case dataTypeUint64, dataTypeHrtime:
+		return d.FieldU64("value")
+	case dataTypeInt64:
+		return uint64(d.FieldS64("value"))
+	case dataTypeDouble:
+		d.FieldF64("value")
+	case dataTypeString:
+		return fieldXDRString(d, "value")
+	case dataTypeByteArray:
+		d.FieldRawLen("value", int64(nelem)*8)
+		if pad := (4 - nelem%4) % 4; pad != 0 {
+			d.FieldRawLen("value_padding", int64(pad)*8)
+		}
+	case dataTypeInt8Array, dataTypeUint8Array,
+		dataTypeInt16Array, dataTypeUint16Array,
+		dataTypeInt32Array, dataTypeUint32Array, dataTypeBooleanArray:
+		count := d.FieldU32("count")
+		d.FieldArray("values", func(d *decode.D) {
+			for i := uint64(0); i < count; i++ {
+				d.FieldU32("value")
+			}
+		})
+	case dataTypeInt64Array, dataTypeUint64Array:
+		count := d.FieldU32("count")
+		d.FieldArray("values", func(d *decode.D) {
+			for i := uint64(0); i < count; i++ {
+				d.FieldU64("value")
+			}
+		})
+	case dataTypeStringArray:
+		d.FieldArray("values", func(d *decode.D) {
+			for i := uint64(0); i < nelem; i++ {
+				d.FieldStruct("value", func(d *decode.D) { fieldXDRString(d, "value") })
+			}
+		})
+	case dataTypeNVList:
+		var nv nvlistValues
+		d.FieldStruct("value", func(d *decode.D) { nv = decodeNVList(d) })
+		return nv
+	case dataTypeNVListArray:
+		d.FieldArray("values", func(d *decode.D) {
+			for i := uint64(0); i < nelem; i++ {
+				d.FieldStruct("value", func(d *decode.D) { decodeNVList(d) })
+			}
+		})
+	default:
+		d.FieldRawLen("value", d.BitsLeft())
+	}
+	return nil
+}
+
+// embedded XDR nvlist without encoding header
+func decodeNVList(d *decode.D) nvlistValues {
+	nv := nvlistValues{}
+
+	d.FieldS32("version")
+	d.FieldU32("nvflag", scalar.ActualHex)
+	d.FieldArray("pairs", func(d *decode.D) {
+		for {
+			// pair list ends with zero encode and decode size
+			if d.PeekBits(64) == 0 {
+				break
+			}
+			d.FieldStruct("pair", func(d *decode.D) {
+				encodeSize := d.FieldU32("encode_size")
+				d.FieldU32("decode_size")
+				if encodeSize < 8 {
+					d.Fatalf("invalid encode_size %d", encodeSize)
+				}
+				d.FramedFn(int64(encodeSize-8)*8, func(d *decode.D) {
+					name := fieldXDRString(d, "name")
+					typ := d.FieldU32("type", dataTypeNames)
+					nelem := d.FieldU32("nelem")
+					nv[name] = decodeNVPairValue(d, typ, nelem)
+				})
+			})
+		}
+	})
+	d.FieldU64("end")
+
+	return nv
+}
+
+// label checksum is a sha256 of the block with the checksum replaced by a verifier
+// with the physical offset of the block, digest words are stored in block byte order
+func labelChecksum(block []byte, offset uint64, bo binary.ByteOrder) []byte {
+	b := append([]byte{}, block...)
+	cksum := b[len(b)-eckLen+8:]
+	for i := range cksum {
+		cksum[i] = 0
+	}
+	bo.PutUint64(cksum, offset)
+
+	digest := sha256.Sum256(b)
+	expected := make([]byte, 32)
+	for i := 0; i < 4; i++ {
+		bo.PutUint64(expected[i*8:], binary.BigEndian.Uint64(digest[i*8:]))
+	}
+	return expected
+}
+
+func eckByteOrder(b []byte) (binary.ByteOrder, bool) {
+	switch {
+	case binary.LittleEndian.Uint64(b) == eckMagic:
+		return binary.LittleEndian, true
+	case binary.BigEndian.Uint64(b) == eckMagic:
+		return binary.BigEndian, true
+	}
+	return nil, false
+}
+
+// embedded checksum at end of block, blockStart in bits and blockLen in bytes
+// returns true if checksum is valid
+func fieldEck(d *decode.D, blockStart int64, blockLen int64) bool {
+	block := d.BytesRange(blockStart, int(blockLen))
+	bo, ok := eckByteOrder(block[len(block)-eckLen:])
+	var valid bool
+
+	d.FieldStruct("eck", func(d *decode.D) {
+		if !ok {
+			d.FieldU64("magic", scalar.ActualHex)
+			d.FieldRawLen("checksum", 32*8, scalar.RawHex)
+			return
+		}
+		if bo == binary.LittleEndian {
+			d.Endian = decode.LittleEndian
+		}
+		d.FieldU64("magic", scalar.ActualHex)
+		expected := labelChecksum(block, uint64(blockStart/8), bo)
+		valid = bytes.Equal(d.PeekBytes(32), expected)
+		d.FieldRawLen("checksum", 32*8, d.ValidateBitBuf(expected), scalar.RawHex)
+	})
+
+	return valid
+}
+
+func decodeDVA(d *decode.D) {
+	w0 := d.FieldU64("word0", scalar.ActualHex)
+	d.FieldValueU("vdev", w0>>32)
+	d.FieldValueU("grid", (w0>>24)&0xff)
+	d.FieldValueU("asize", ((w0&0xff_ffff)+1)<<9)
+	w1 := d.FieldU64("word1", scalar.ActualHex)
+	d.FieldValueU("offset", (w1&0x7fff_ffff_ffff_ffff)<<9, scalar.ActualHex)
+	d.FieldValueBool("gang", w1>>63 == 1)
+}
+
+func decodeBlkptr(d *decode.D) {
+	d.FieldArray("dvas", func(d *decode.D) {
+		for i := 0; i < 3; i++ {
+			d.FieldStruct("dva", decodeDVA)
+		}
+	})
+	d.FieldStruct("prop", func(d *decode.D) {
+		prop := d.FieldU64("word", scalar.ActualHex)
+		d.FieldValueU("lsize", ((prop&0xffff)+1)<<9)
+		d.FieldValueU("psize", (((prop>>16)&0xffff)+1)<<9)
+		d.FieldValueU("compress", (prop>>32)&0x7f, compressNames)
+		d.FieldValueBool("embedded", (prop>>39)&1 == 1)
+		d.FieldValueU("checksum", (prop>>40)&0xff, checksumNames)
+		d.FieldValueU("type", (prop>>48)&0xff, objectTypeNames)
+		d.FieldValueU("level", (prop>>56)&0x1f)
+		d.FieldValueBool("encrypted", (prop>>61)&1 == 1)
+		d.FieldValueBool("dedup", (prop>>62)&1 == 1)
+		d.FieldValueU("byteorder", prop>>63, scalar.UToSymStr{0: "big_endian", 1: "little_endian"})
+	})
+	d.FieldRawLen("pad", 2*64)
+	d.FieldU64("phys_birth")
+	d.FieldU64("birth")
+	d.FieldU64("fill")
+	d.FieldArray("checksum", func(d *decode.D) {
+		for i := 0; i < 4; i++ {
+			d.FieldU64("word", scalar.ActualHex)
+		}
+	})
+}
+
+type uberblock struct {
+	txg       uint64
+	timestamp uint64
+}
+
+func decodeUberblock(d *decode.D, slotLen int64) (uberblock, bool) {
+	var ub uberblock
+	start := d.Pos()
+
+	switch {
+	case d.PeekBits(64) == uberblockMagic:
+	case binary.LittleEndian.Uint64(d.PeekBytes(8)) == uberblockMagic:
+		d.Endian = decode.LittleEndian
+	default:
+		d.FieldU64("magic", scalar.ActualHex)
+		d.FieldRawLen("unused", slotLen*8-64)
+		return ub, false
+	}
+
+	d.FieldU64("magic", scalar.ActualHex)
+	d.FieldU64("version")
+	ub.txg = d.FieldU64("txg")
+	d.FieldU64("guid_sum", scalar.ActualHex)
+	ub.timestamp = d.FieldU64("timestamp", scalar.DescriptionActualUUnixTime)
+	d.FieldStruct("rootbp", decodeBlkptr)
+	d.FieldU64("software_version")
+	d.FieldU64("mmp_magic", scalar.ActualHex)
+	d.FieldU64("mmp_delay")
+	d.FieldU64("mmp_config", scalar.ActualHex)
+	d.FieldU64("checkpoint_txg")
+	d.FieldU64("raidz_reflow_info", scalar.ActualHex)
+	d.FieldRawLen("padding", slotLen*8-eckLen*8-(d.Pos()-start))
+	valid := fieldEck(d, start, slotLen)
+
+	return ub, valid
+}
+
+func uberblockSlotLen(nv nvlistValues) int64 {
+	shift := uint64(uberblockShift)
+	if vdevTree, ok := nv["vdev_tree"].(nvlistValues); ok {
+		if ashift, ok := vdevTree["ashift"].(uint64); ok && ashift > shift {
+			shift = ashift
+		}
+	}
+	if shift > maxUberblockShift {
+		shift = maxUberblockShift
+	}
+	return 1 << shift
+}
+
+func decodeLabel(d *decode.D) {
+	labelStart := d.Pos()
+
+	d.FieldRawLen("pad", labelPadLen*8)
+	d.FieldRawLen("boot_envelope", bootEnvelopeLen*8)
+
+	var nv nvlistValues
+	d.FieldStruct("vdev_phys", func(d *decode.D) {
+		start := d.Pos()
+		d.FieldStruct("nvlist", func(d *decode.D) {
+			d.FieldU8("encoding", nvEncodingNames)
+			d.FieldU8("endian", nvEndianNames)
+			d.FieldU16("reserved")
+			nv = decodeNVList(d)
+		})
+		d.FieldRawLen("unused", vdevPhysLen*8-eckLen*8-(d.Pos()-start))
+		fieldEck(d, start, vdevPhysLen)
+	})
+
+	slotLen := uberblockSlotLen(nv)
+	activeIndex := -1
+	var active uberblock
+	d.FieldArray("uberblocks", func(d *decode.D) {
+		for i := 0; i < uberblockRingLen/int(slotLen); i++ {
+			d.FieldStruct("uberblock", func(d *decode.D) {
+				ub, ok := decodeUberblock(d, slotLen)
+				if !ok {
+					return
+				}
+				// active uberblock is the valid one with highest txg, timestamp breaks ties
+				if activeIndex == -1 || ub.txg > active.txg || (ub.txg == active.txg && ub.timestamp > active.timestamp) {
+					activeIndex = i
+					active = ub
+				}
+			})
+		}
+	})
+	if activeIndex != -1 {
+		d.FieldValueU("active_uberblock", uint64(activeIndex))
+	}
+
+	if d.Pos() != labelStart+labelLen*8 {
+		d.Fatalf("label length mismatch")
+	}
+}
+
+func hasLabel(d *decode.D, offset int64) bool {
+	if offset < 0 || d.Len() < (offset+labelLen)*8 {
+		return false
+	}
+	_, ok := eckByteOrder(d.BytesRange((offset+labelPadLen+bootEnvelopeLen+vdevPhysLen-eckLen)*8, 8))
+	return ok
+}
+
+func zfsDecode(d *decode.D, _ any) any {
+	// last two labels are at end of device aligned to label size
+	size := (d.Len() / 8) &^ (labelLen - 1)
+	labelOffsets := []int64{
+		0,
+		labelLen,
+		size - 2*labelLen,
+		size - labelLen,
+	}
+	if !hasLabel(d, labelOffsets[0]) && !hasLabel(d, labelOffsets[1]) {
+		d.Fatalf("no vdev label found")
+	}
+
+	d.FieldArray("labels", func(d *decode.D) {
+		for i, offset := range labelOffsets {
+			// skip missing or damaged labels and overlapping labels on small devices
+			if !hasLabel(d, offset) || (i >= 2 && offset < 2*labelLen) {
+				continue
+			}
+			d.SeekAbs(offset * 8)
+			d.FieldStruct("label", func(d *decode.D) {
+				d.FieldValueU("number", uint64(i))
+				decodeLabel(d)
+			})
+		}
+	})
+
+	return nil
+}
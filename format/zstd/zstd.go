@@ -0,0 +1,211 @@
+package zstd
+
+// https://www.rfc-editor.org/rfc/rfc8878.html
+// https://github.com/facebook/zstd/blob/dev/doc/zstd_compression_format.md
+// TODO: decode literals and sequences sections of compressed blocks
+// TODO: dictionary frames
+
+import (
+	"embed"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/checksum"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed zstd.jq
+var zstdFS embed.FS
+
+var probeFormat decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.ZSTD,
+		Description: "Zstandard compression",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    zstdDecode,
+		DecodeInArg: format.ZstdIn{
+			Uncompress: true,
+		},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.PROBE}, Group: &probeFormat},
+		},
+		Functions: []string{"_help"},
+	})
+	interp.RegisterFS(zstdFS)
+}
+
+const (
+	frameMagic             = 0xfd_2f_b5_28
+	skippableFrameMagicMin = 0x18_4d_2a_50
+	skippableFrameMagicMax = 0x18_4d_2a_5f
+)
+
+const (
+	blockTypeRaw        = 0
+	blockTypeRLE        = 1
+	blockTypeCompressed = 2
+	blockTypeReserved   = 3
+)
+
+var blockTypeNames = scalar.UToSymStr{
+	blockTypeRaw:        "raw",
+	blockTypeRLE:        "rle",
+	blockTypeCompressed: "compressed",
+	blockTypeReserved:   "reserved",
+}
+
+var dictIDFlagSizes = [4]int{0, 1, 2, 4}
+
+func decodeFrame(d *decode.D, zi format.ZstdIn) {
+	frameStart := d.Pos()
+
+	d.FieldU32("magic", d.AssertU(frameMagic), scalar.ActualHex)
+
+	var fcsFlag uint64
+	var singleSegment bool
+	var hasContentChecksum bool
+	var dictIDFlag uint64
+	var hasContentSize bool
+	var contentSize uint64
+	var dictID uint64
+
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldStruct("descriptor", func(d *decode.D) {
+			fcsFlag = d.FieldU2("frame_content_size_flag")
+			singleSegment = d.FieldBool("single_segment")
+			d.FieldU1("unused")
+			d.FieldU1("reserved")
+			hasContentChecksum = d.FieldBool("content_checksum")
+			dictIDFlag = d.FieldU2("dictionary_id_flag")
+		})
+		if !singleSegment {
+			d.FieldStruct("window_descriptor", func(d *decode.D) {
+				exponent := d.FieldU5("exponent")
+				mantissa := d.FieldU3("mantissa")
+				windowBase := uint64(1) << (10 + exponent)
+				windowAdd := (windowBase / 8) * mantissa
+				d.FieldValueU("window_size", windowBase+windowAdd)
+			})
+		}
+		if n := dictIDFlagSizes[dictIDFlag]; n > 0 {
+			dictID = d.FieldU("dictionary_id", n*8)
+		}
+		hasContentSize = true
+		switch fcsFlag {
+		case 0:
+			if singleSegment {
+				contentSize = d.FieldU8("frame_content_size")
+			} else {
+				hasContentSize = false
+			}
+		case 1:
+			contentSize = d.FieldU16("frame_content_size", scalar.ActualUAdd(256))
+		case 2:
+			contentSize = d.FieldU32("frame_content_size")
+		case 3:
+			contentSize = d.FieldU64("frame_content_size")
+		}
+	})
+
+	d.FieldArray("blocks", func(d *decode.D) {
+		lastBlock := false
+		for !lastBlock {
+			d.FieldStruct("block", func(d *decode.D) {
+				header := d.FieldU24("header", scalar.ActualHex)
+				lastBlock = header&0b1 == 1
+				blockType := (header >> 1) & 0b11
+				blockSize := header >> 3
+				d.FieldValueBool("last_block", lastBlock)
+				d.FieldValueU("type", blockType, blockTypeNames)
+				d.FieldValueU("size", blockSize)
+
+				switch blockType {
+				case blockTypeRaw, blockTypeCompressed:
+					d.FieldRawLen("data", int64(blockSize)*8)
+				case blockTypeRLE:
+					d.FieldU8("byte", scalar.ActualHex)
+				default:
+					d.Fatalf("reserved block type")
+				}
+			})
+		}
+	})
+
+	var uncompressed []byte
+	// dictionaries are not supported so can't uncompress if used
+	if zi.Uncompress && dictID == 0 {
+		// checksum is validated below so don't fail on mismatch
+		zd, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.IgnoreChecksum(true))
+		if err != nil {
+			d.Fatalf("failed to create decoder: %s", err)
+		}
+		frameEnd := d.Pos()
+		if hasContentChecksum {
+			frameEnd += 32
+		}
+		uncompressed, err = zd.DecodeAll(d.BytesRange(frameStart, int((frameEnd-frameStart)/8)), nil)
+		zd.Close()
+		if err != nil {
+			uncompressed = nil
+		}
+	}
+
+	if hasContentChecksum {
+		if uncompressed != nil {
+			contentXXH64 := &checksum.XXH64{}
+			_, _ = contentXXH64.Write(uncompressed)
+			d.FieldU32("content_checksum", d.ValidateU(contentXXH64.Sum64()&0xff_ff_ff_ff), scalar.ActualHex)
+		} else {
+			d.FieldU32("content_checksum", scalar.ActualHex)
+		}
+	}
+
+	if uncompressed != nil {
+		if hasContentSize && contentSize != uint64(len(uncompressed)) {
+			d.Errorf("frame content size %d does not match uncompressed size %d", contentSize, len(uncompressed))
+		}
+
+		uncompressedBR := bitio.NewBitReader(uncompressed, -1)
+		if dv, _, _ := d.TryFieldFormatBitBuf("uncompressed", uncompressedBR, probeFormat, nil); dv == nil {
+			d.FieldRootBitBuf("uncompressed", uncompressedBR)
+		}
+	}
+}
+
+func zstdDecode(d *decode.D, in any) any {
+	zi, _ := in.(format.ZstdIn)
+
+	d.Endian = decode.LittleEndian
+
+	frameCount := 0
+	d.FieldArray("frames", func(d *decode.D) {
+		for d.BitsLeft() >= 32 {
+			magic := d.U32()
+			d.SeekRel(-32)
+			switch {
+			case magic == frameMagic:
+				d.FieldStruct("frame", func(d *decode.D) { decodeFrame(d, zi) })
+			case magic >= skippableFrameMagicMin && magic <= skippableFrameMagicMax:
+				d.FieldStruct("skippable_frame", func(d *decode.D) {
+					d.FieldU32("magic", scalar.ActualHex)
+					size := d.FieldU32("size")
+					d.FieldRawLen("data", int64(size)*8)
+				})
+			default:
+				// trailing data, let root decoder report it as unknown
+				return
+			}
+			frameCount++
+		}
+	})
+	if frameCount == 0 {
+		d.Fatalf("no zstd frame found")
+	}
+
+	return nil
+}
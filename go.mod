@@ -14,6 +14,10 @@ require (
 	// bump: gomod-BurntSushi/toml command go get -d github.com/BurntSushi/toml@v$LATEST && go mod tidy
 	// bump: gomod-BurntSushi/toml link "Source diff $CURRENT..$LATEST" https://github.com/BurntSushi/toml/compare/v$CURRENT..v$LATEST
 	github.com/BurntSushi/toml v1.2.0
+	// bump: gomod-andybalholm/brotli /github\.com\/andybalholm\/brotli v(.*)/ https://github.com/andybalholm/brotli.git|^1
+	// bump: gomod-andybalholm/brotli command go get -d github.com/andybalholm/brotli@v$LATEST && go mod tidy
+	// bump: gomod-andybalholm/brotli link "Source diff $CURRENT..$LATEST" https://github.com/andybalholm/brotli/compare/v$CURRENT..v$LATEST
+	github.com/andybalholm/brotli v1.0.5
 	// bump: gomod-creasty-defaults /github\.com\/creasty\/defaults v(.*)/ https://github.com/creasty/defaults.git|^1
 	// bump: gomod-creasty-defaults command go get -d github.com/creasty/defaults@v$LATEST && go mod tidy
 	// bump: gomod-creasty-defaults link "Source diff $CURRENT..$LATEST" https://github.com/creasty/defaults/compare/v$CURRENT..v$LATEST
@@ -26,6 +30,10 @@ require (
 	// bump: gomod-gopacket command go get -d github.com/google/gopacket@v$LATEST && go mod tidy
 	// bump: gomod-gopacket link "Release notes" https://github.com/google/gopacket/releases/tag/v$LATEST
 	github.com/google/gopacket v1.1.19
+	// bump: gomod-klauspost/compress /github\.com\/klauspost\/compress v(.*)/ https://github.com/klauspost/compress.git|^1
+	// bump: gomod-klauspost/compress command go get -d github.com/klauspost/compress@v$LATEST && go mod tidy
+	// bump: gomod-klauspost/compress link "Release notes" https://github.com/klauspost/compress/releases/tag/v$LATEST
+	github.com/klauspost/compress v1.15.9
 	// bump: gomod-copystructure /github\.com\/mitchellh\/copystructure v(.*)/ https://github.com/mitchellh/copystructure.git|^1
 	// bump: gomod-copystructure command go get -d github.com/mitchellh/copystructure@v$LATEST && go mod tidy
 	// bump: gomod-copystructure link "CHANGELOG" https://github.com/mitchellh/copystructure/blob/master/CHANGELOG.md
@@ -34,10 +42,18 @@ require (
 	// bump: gomod-mapstructure command go get -d github.com/mitchellh/mapstructure@v$LATEST && go mod tidy
 	// bump: gomod-mapstructure link "CHANGELOG" https://github.com/mitchellh/mapstructure/blob/master/CHANGELOG.md
 	github.com/mitchellh/mapstructure v1.5.0
+	// bump: gomod-pierrec/lz4 /github\.com\/pierrec\/lz4\/v4 v(.*)/ https://github.com/pierrec/lz4.git|^4
+	// bump: gomod-pierrec/lz4 command go get -d github.com/pierrec/lz4/v4@v$LATEST && go mod tidy
+	// bump: gomod-pierrec/lz4 link "Release notes" https://github.com/pierrec/lz4/releases/tag/v$LATEST
+	github.com/pierrec/lz4/v4 v4.1.15
 	// bump: gomod-go-difflib /github\.com\/pmezard\/go-difflib v(.*)/ https://github.com/pmezard/go-difflib.git|^1
 	// bump: gomod-go-difflib command go get -d github.com/pmezard/go-difflib@v$LATEST && go mod tidy
 	// bump: gomod-go-difflib link "Source diff $CURRENT..$LATEST" https://github.com/pmezard/go-difflib/compare/v$CURRENT..v$LATEST
 	github.com/pmezard/go-difflib v1.0.0
+	// bump: gomod-ulikunitz/xz /github\.com\/ulikunitz\/xz v(.*)/ https://github.com/ulikunitz/xz.git|^0
+	// bump: gomod-ulikunitz/xz command go get -d github.com/ulikunitz/xz@v$LATEST && go mod tidy
+	// bump: gomod-ulikunitz/xz link "Source diff $CURRENT..$LATEST" https://github.com/ulikunitz/xz/compare/v$CURRENT..v$LATEST
+	github.com/ulikunitz/xz v0.5.10
 	// has no tags
 	// go get -d golang.org/x/crypto@master && go mod tidy
 	golang.org/x/crypto v0.0.0-20220622213112-05595931fe9d
@@ -60,16 +60,24 @@ type Encoder struct {
 	depth   int
 	buf     [64]byte
 	valueFn func(v any) any
+	floatFn FloatFn
 	colors  Colors
 }
 
-func NewEncoder(color bool, tab bool, indent int, valueFn func(v any) any, colors Colors) *Encoder {
+// FloatFn formats a float, if isNumber is false it's not a valid JSON number and
+// will be encoded as a string
+type FloatFn func(f float64) (s string, isNumber bool)
+
+// NewEncoder creates a new encoder, floatFn is optional and defaults to shortest
+// representation that round trips
+func NewEncoder(color bool, tab bool, indent int, valueFn func(v any) any, floatFn FloatFn, colors Colors) *Encoder {
 	// reuse the buffer in multiple calls of marshal
 	return &Encoder{
 		color:   color,
 		tab:     tab,
 		indent:  indent,
 		valueFn: valueFn,
+		floatFn: floatFn,
 		colors:  colors,
 	}
 }
@@ -126,6 +134,14 @@ func (e *Encoder) encodeFloat64(f float64) {
 	} else if f <= -math.MaxFloat64 {
 		f = -math.MaxFloat64
 	}
+	if e.floatFn != nil {
+		if fs, isNumber := e.floatFn(f); isNumber {
+			e.write([]byte(fs), e.colors.Number)
+		} else {
+			e.encodeString(fs, e.colors.Number)
+		}
+		return
+	}
 	fmt := byte('f')
 	if x := math.Abs(f); x != 0 && x < 1e-6 || x >= 1e21 {
 		fmt = 'e'
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"sync/atomic"
 )
 
 func SeekerEnd(s io.Seeker) (int64, error) {
@@ -28,6 +29,18 @@ func (r *ReadErrSeeker) Seek(offset int64, whence int) (int64, error) {
 	return 0, errors.New("seek")
 }
 
+// CountReadSeeker atomically adds number of bytes read to N
+type CountReadSeeker struct {
+	io.ReadSeeker
+	N *int64
+}
+
+func (r CountReadSeeker) Read(p []byte) (n int, err error) {
+	n, err = r.ReadSeeker.Read(p)
+	atomic.AddInt64(r.N, int64(n))
+	return n, err
+}
+
 type CtxWriter struct {
 	io.Writer
 	Ctx context.Context
@@ -54,3 +67,8 @@ func (o DiscardCtxWriter) Write(p []byte) (n int, err error) {
 	}
 	return n, nil
 }
+
+// ErrReader is a reader that always fails with Err
+type ErrReader struct{ Err error }
+
+func (r ErrReader) Read(p []byte) (n int, err error) { return 0, r.Err }
@@ -0,0 +1,86 @@
+package ioex
+
+import (
+	"io"
+	"unicode/utf8"
+)
+
+const (
+	escNone = iota
+	escStart
+	escCSI
+)
+
+// LineWriter prefixes each line with Prefix and if Width is not zero hard wraps
+// lines so that they including prefix are at most Width columns.
+// ANSI CSI escape sequences and UTF-8 continuation bytes are not counted as columns.
+type LineWriter struct {
+	W      io.Writer
+	Prefix string
+	Width  int
+
+	started bool
+	col     int
+	esc     int
+	buf     []byte
+}
+
+func (lw *LineWriter) startLine() {
+	lw.buf = append(lw.buf, lw.Prefix...)
+	lw.col = utf8.RuneCountInString(lw.Prefix)
+	lw.started = true
+}
+
+func (lw *LineWriter) Write(p []byte) (int, error) {
+	lw.buf = lw.buf[:0]
+	for _, b := range p {
+		switch {
+		case lw.esc == escCSI:
+			// final byte ends sequence
+			if b >= 0x40 && b <= 0x7e {
+				lw.esc = escNone
+			}
+			lw.buf = append(lw.buf, b)
+			continue
+		case lw.esc == escStart:
+			lw.esc = escNone
+			if b == '[' {
+				lw.esc = escCSI
+			}
+			lw.buf = append(lw.buf, b)
+			continue
+		case b == '\n':
+			if !lw.started {
+				lw.buf = append(lw.buf, lw.Prefix...)
+			}
+			lw.buf = append(lw.buf, b)
+			lw.started = false
+			continue
+		}
+
+		if !lw.started {
+			lw.startLine()
+		}
+		if b == 0x1b {
+			lw.esc = escStart
+			lw.buf = append(lw.buf, b)
+			continue
+		}
+		if !utf8.RuneStart(b) {
+			lw.buf = append(lw.buf, b)
+			continue
+		}
+		if lw.Width > 0 && lw.col >= lw.Width && lw.col > utf8.RuneCountInString(lw.Prefix) {
+			lw.buf = append(lw.buf, '\n')
+			lw.startLine()
+		}
+		lw.col++
+		lw.buf = append(lw.buf, b)
+	}
+
+	if _, err := lw.W.Write(lw.buf); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
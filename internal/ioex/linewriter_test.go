@@ -0,0 +1,45 @@
+package ioex_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/wader/fq/internal/ioex"
+)
+
+func TestLineWriter(t *testing.T) {
+	testCases := []struct {
+		prefix   string
+		width    int
+		writes   []string
+		expected string
+	}{
+		{"", 0, []string{"abc\ndef\n"}, "abc\ndef\n"},
+		{"> ", 0, []string{"abc\n\ndef"}, "> abc\n> \n> def"},
+		{"> ", 5, []string{"abcdefg\n"}, "> abc\n> def\n> g\n"},
+		{"> ", 5, []string{"ab", "cd", "efg\n"}, "> abc\n> def\n> g\n"},
+		{"", 3, []string{"åäöåä\n"}, "åäö\nåä\n"},
+		{"", 3, []string{"\xc3", "\xa5bcd\n"}, "åbc\nd\n"},
+		{"", 2, []string{"\x1b[31mabc\x1b[0m\n"}, "\x1b[31mab\nc\x1b[0m\n"},
+	}
+	for _, tC := range testCases {
+		t.Run(fmt.Sprintf("%q_%d_%q", tC.prefix, tC.width, tC.writes), func(t *testing.T) {
+			b := &bytes.Buffer{}
+			lw := &ioex.LineWriter{W: b, Prefix: tC.prefix, Width: tC.width}
+			for _, s := range tC.writes {
+				n, err := lw.Write([]byte(s))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n != len(s) {
+					t.Errorf("expected n %d got %d", len(s), n)
+				}
+			}
+			actual := b.String()
+			if tC.expected != actual {
+				t.Errorf("expected %q got %q", tC.expected, actual)
+			}
+		})
+	}
+}
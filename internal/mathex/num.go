@@ -59,6 +59,57 @@ func PadFormatBigInt(i *big.Int, base int, basePrefix bool, width int) string {
 	return padFormatNumber(i.Text(base), base, basePrefix, width)
 }
 
+// GroupDigits groups digits of a formatted integer, "," every 3 digits for decimal
+// and "_" every 4 digits if it has a base prefix. Fractional part after "." is kept as is.
+func GroupDigits(s string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	prefix := ""
+	groupSize, sep := 3, ","
+	for _, p := range BasePrefixMap {
+		if strings.HasPrefix(s, p) {
+			prefix, s = p, s[len(p):]
+			groupSize, sep = 4, "_"
+			break
+		}
+	}
+	digits, frac, hasFrac := strings.Cut(s, ".")
+
+	var sb strings.Builder
+	for i, c := range digits {
+		if i > 0 && (len(digits)-i)%groupSize == 0 {
+			sb.WriteString(sep)
+		}
+		sb.WriteRune(c)
+	}
+	if hasFrac {
+		sb.WriteString(".")
+		sb.WriteString(frac)
+	}
+
+	return sign + prefix + sb.String()
+}
+
+var humanSizeUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// HumanSize formats n bytes using binary units with one decimal, ex: 1536 -> "1.5 KiB"
+func HumanSize[T constraints.Integer](n T) string {
+	f := float64(n)
+	u := 0
+	for math.Abs(f) >= 1024 && u < len(humanSizeUnits)-1 {
+		f /= 1024
+		u++
+	}
+	if u == 0 {
+		return strconv.FormatInt(int64(n), 10) + " " + humanSizeUnits[u]
+	}
+	s := strconv.FormatFloat(f, 'f', 1, 64)
+	s = strings.TrimSuffix(s, ".0")
+	return s + " " + humanSizeUnits[u]
+}
+
 func Max[T Number](v T, vs ...T) T {
 	m := v
 	for _, v := range vs {
@@ -0,0 +1,53 @@
+package mathex_test
+
+import (
+	"testing"
+
+	"github.com/wader/fq/internal/mathex"
+)
+
+func TestGroupDigits(t *testing.T) {
+	testCases := []struct {
+		s        string
+		expected string
+	}{
+		{"0", "0"},
+		{"123", "123"},
+		{"1234", "1,234"},
+		{"-1234567", "-1,234,567"},
+		{"123456.7", "123,456.7"},
+		{"0x1234", "0x1234"},
+		{"0xdeadbeef", "0xdead_beef"},
+		{"0b110101010", "0b1_1010_1010"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.s, func(t *testing.T) {
+			actual := mathex.GroupDigits(tC.s)
+			if tC.expected != actual {
+				t.Errorf("expected %s, got %s", tC.expected, actual)
+			}
+		})
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	testCases := []struct {
+		n        int64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1 KiB"},
+		{1536, "1.5 KiB"},
+		{10 * 1024 * 1024, "10 MiB"},
+		{5 * 1024 * 1024 * 1024 * 1024, "5 TiB"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.expected, func(t *testing.T) {
+			actual := mathex.HumanSize(tC.n)
+			if tC.expected != actual {
+				t.Errorf("expected %s, got %s", tC.expected, actual)
+			}
+		})
+	}
+}
@@ -268,6 +268,8 @@ type Case struct {
 	Path   string
 	Parts  []part
 	WasRun bool
+	// files written by tofile, kept in memory so tests don't touch testdata
+	written map[string][]byte
 }
 
 func (c *Case) ToActual() string {
@@ -340,28 +342,39 @@ func normalizeOSError(err error) error {
 	return err
 }
 
-func (c *Case) Open(name string) (fs.File, error) {
+func (c *Case) paths(name string) (testAbsPath string, fsPath string) {
 	const testData = "testdata"
 	testDataIndex := strings.Index(c.Path, testData)
 	// cwd is directory where current script file is
 	testRoot := c.Path[0 : testDataIndex+len(testData)]
 	testCwd := filepath.Dir(c.Path[testDataIndex+len(testData):])
-	testAbsPath := filepath.Join(testCwd, name)
-	fsPath := filepath.Join(testRoot, testAbsPath)
+	testAbsPath = filepath.Join(testCwd, name)
+	return testAbsPath, filepath.Join(testRoot, testAbsPath)
+}
+
+func fileReader(name string, data []byte) interp.FileReader {
+	return interp.FileReader{
+		R: io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))),
+		FileInfo: interp.FixedFileInfo{
+			FName: filepath.Base(name),
+			FSize: int64(len(data)),
+		},
+	}
+}
+
+func (c *Case) Open(name string) (fs.File, error) {
+	testAbsPath, fsPath := c.paths(name)
 
+	if data, ok := c.written[filepath.ToSlash(testAbsPath)]; ok {
+		return fileReader(name, data), nil
+	}
 	for _, p := range c.Parts {
 		f, ok := p.(*caseFile)
 		if !ok {
 			continue
 		}
 		if f.name == filepath.ToSlash(testAbsPath) {
-			return interp.FileReader{
-				R: io.NewSectionReader(bytes.NewReader(f.data), 0, int64(len(f.data))),
-				FileInfo: interp.FixedFileInfo{
-					FName: filepath.Base(name),
-					FSize: int64(len(f.data)),
-				},
-			}, nil
+			return fileReader(name, f.data), nil
 		}
 	}
 	f, err := os.Open(fsPath)
@@ -370,6 +383,26 @@ func (c *Case) Open(name string) (fs.File, error) {
 	return f, normalizeOSError(err)
 }
 
+type caseWriter struct {
+	bytes.Buffer
+	close func(b []byte)
+}
+
+func (cw *caseWriter) Close() error {
+	cw.close(cw.Bytes())
+	return nil
+}
+
+func (c *Case) Create(name string) (io.WriteCloser, error) {
+	testAbsPath, _ := c.paths(name)
+	return &caseWriter{close: func(b []byte) {
+		if c.written == nil {
+			c.written = map[string][]byte{}
+		}
+		c.written[filepath.ToSlash(testAbsPath)] = b
+	}}, nil
+}
+
 type Section struct {
 	LineNr int
 	Name   string
@@ -8,10 +8,14 @@
 //
 // - bitio.IOReader is a io.Reader that reads bytes from a bitio.Reader, will zero pad unaligned byte at EOF
 //
+// - bitio.IOReaderAt is a io.ReaderAt that reads bytes from a bitio.ReaderAt, will zero pad unaligned byte at EOF
+//
 // - bitio.IOReadSeeker is a io.ReadSeeker that reads from a bitio.ReadSeeker, will zero pad unaligned byte at EOF
 //
 // - bitio.NewBitReader same as bytes.NewReader
 //
+// - bitio.ReadAheadReader is a io.ReadSeeker that reads windows from a io.ReadSeeker and prefetches the next in background
+//
 // - bitio.LimitReader same as io.LimitReader
 //
 // - bitio.MultiReader same as io.MultiReader
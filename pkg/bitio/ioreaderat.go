@@ -0,0 +1,39 @@
+package bitio
+
+import (
+	"errors"
+	"io"
+)
+
+// IOReaderAt is a io.ReaderAt that reads bytes from a bitio.ReaderAt.
+// Unaligned byte at EOF will be zero bit padded.
+// Is only safe for concurrent use if the underlaying reader is, file backed
+// readers are usually not.
+type IOReaderAt struct {
+	r ReaderAt
+}
+
+// NewIOReaderAt returns a new bitio.IOReaderAt.
+func NewIOReaderAt(r ReaderAt) *IOReaderAt {
+	return &IOReaderAt{r: r}
+}
+
+func (r *IOReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	rBits, err := r.r.ReadBitsAt(p, int64(len(p))*8, off*8)
+	n = int(BitsByteCount(rBits))
+	if restBits := rBits % 8; restBits != 0 {
+		p[n-1] &= 0xff << (8 - restBits)
+	}
+	if n < len(p) && err == nil {
+		err = io.EOF
+	}
+
+	return n, err
+}
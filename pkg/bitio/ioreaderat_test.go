@@ -0,0 +1,45 @@
+package bitio_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/wader/fq/pkg/bitio"
+)
+
+func TestIOReaderAt(t *testing.T) {
+	testCases := []struct {
+		bs          string
+		off         int64
+		n           int
+		expected    []byte
+		expectedErr error
+	}{
+		{"", 0, 1, []byte{}, io.EOF},
+		{"11111111", 0, 1, []byte{0xff}, nil},
+		{"11111111", 0, 2, []byte{0xff}, io.EOF},
+		{"11111111", 1, 1, []byte{}, io.EOF},
+		{"1111111100000001", 1, 1, []byte{0x01}, nil},
+		{"1111111100000001", 0, 2, []byte{0xff, 0x01}, nil},
+		// unaligned end padded
+		{"11111111101", 1, 1, []byte{0xa0}, nil},
+		{"11111111101", 0, 3, []byte{0xff, 0xa0}, io.EOF},
+	}
+	for _, tC := range testCases {
+		r := bitio.NewIOReaderAt(sb(tC.bs))
+		p := make([]byte, tC.n)
+		n, err := r.ReadAt(p, tC.off)
+		if !bytes.Equal(p[0:n], tC.expected) || err != tC.expectedErr {
+			t.Errorf("%q at %d: expected %v %v got %v %v", tC.bs, tC.off, tC.expected, tC.expectedErr, p[0:n], err)
+		}
+	}
+
+	// unaligned section as io.SectionReader
+	br := bitio.NewSectionReader(sb("1111000011110000111100001111"), 4, 24)
+	sr := io.NewSectionReader(bitio.NewIOReaderAt(br), 0, 3)
+	b, err := io.ReadAll(sr)
+	if err != nil || !bytes.Equal(b, []byte{0x0f, 0x0f, 0x0f}) {
+		t.Errorf("section: got %v %v", b, err)
+	}
+}
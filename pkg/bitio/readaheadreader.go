@@ -0,0 +1,157 @@
+package bitio
+
+import (
+	"errors"
+	"io"
+)
+
+// ReadAheadReader is a io.ReadSeeker that reads from a io.ReadSeeker in windows and
+// for sequential reads prefetches the next window in the background. This overlaps
+// IO with decoding and is useful for slow storage like network filesystems.
+//
+// The underlaying reader is only used by one go routine at a time but it might not be
+// the callers go routine.
+type ReadAheadReader struct {
+	rs       io.ReadSeeker
+	window   int
+	windowFn func()
+
+	offset int64
+	cur    readAheadWindow
+	spare  []byte
+
+	pending   bool
+	pendingCh chan readAheadWindow
+}
+
+type readAheadWindow struct {
+	offset int64
+	buf    []byte
+	n      int
+	err    error
+}
+
+func (w readAheadWindow) contains(offset int64) bool {
+	return offset >= w.offset && offset < w.offset+int64(w.n)
+}
+
+func (w readAheadWindow) end() int64 {
+	return w.offset + int64(w.n)
+}
+
+// NewReadAheadReader returns a new bitio.ReadAheadReader reading window bytes at a time.
+// If windowFn is not nil it's called from the callers go routine when reading moves to
+// another window, ex: to report progress tracked by the underlaying reader.
+func NewReadAheadReader(rs io.ReadSeeker, window int, windowFn func()) *ReadAheadReader {
+	if window < 1 {
+		window = 1
+	}
+	return &ReadAheadReader{
+		rs:        rs,
+		window:    window,
+		windowFn:  windowFn,
+		pendingCh: make(chan readAheadWindow, 1),
+	}
+}
+
+func (r *ReadAheadReader) fill(offset int64, buf []byte) readAheadWindow {
+	if buf == nil {
+		buf = make([]byte, r.window)
+	}
+	w := readAheadWindow{offset: offset, buf: buf}
+	if _, err := r.rs.Seek(offset, io.SeekStart); err != nil {
+		w.err = err
+		return w
+	}
+	w.n, w.err = io.ReadFull(r.rs, buf)
+	if errors.Is(w.err, io.ErrUnexpectedEOF) {
+		w.err = io.EOF
+	}
+	return w
+}
+
+// wait for pending prefetch and use it if it starts at offset
+func (r *ReadAheadReader) wait(offset int64) {
+	if !r.pending {
+		return
+	}
+	w := <-r.pendingCh
+	r.pending = false
+	if w.offset == offset && w.n > 0 {
+		r.spare, r.cur = r.cur.buf, w
+		return
+	}
+	r.spare = w.buf
+}
+
+func (r *ReadAheadReader) prefetch() {
+	if r.pending || r.cur.err != nil {
+		return
+	}
+	buf := r.spare
+	r.spare = nil
+	offset := r.cur.end()
+	r.pending = true
+	go func() {
+		r.pendingCh <- r.fill(offset, buf)
+	}()
+}
+
+func (r *ReadAheadReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if !r.cur.contains(r.offset) {
+		sequential := r.offset == r.cur.end()
+		r.wait(r.offset)
+		if r.cur.err != nil && r.offset == r.cur.end() {
+			// already read to end or error
+			return 0, r.cur.err
+		}
+		if !r.cur.contains(r.offset) {
+			r.cur = r.fill(r.offset, r.cur.buf)
+		}
+		if r.windowFn != nil {
+			r.windowFn()
+		}
+		if r.cur.n == 0 {
+			return 0, r.cur.err
+		}
+		if sequential {
+			r.prefetch()
+		}
+	}
+
+	d := r.offset - r.cur.offset
+	n := copy(p, r.cur.buf[d:r.cur.n])
+	r.offset += int64(n)
+
+	return n, nil
+}
+
+func (r *ReadAheadReader) Seek(offset int64, whence int) (int64, error) {
+	var absOffset int64
+	switch whence {
+	case io.SeekStart:
+		absOffset = offset
+	case io.SeekCurrent:
+		absOffset = r.offset + offset
+	case io.SeekEnd:
+		// underlaying reader might be in use by prefetch
+		r.wait(-1)
+		end, err := r.rs.Seek(offset, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		absOffset = end
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if absOffset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = absOffset
+
+	return absOffset, nil
+}
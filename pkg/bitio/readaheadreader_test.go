@@ -0,0 +1,140 @@
+package bitio_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/wader/fq/pkg/bitio"
+)
+
+func TestReadAheadReader(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	for _, window := range []int{1, 3, 7, 64, 1000, 2000} {
+		r := bitio.NewReadAheadReader(bytes.NewReader(data), window, nil)
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("window %d: ReadAll: %s", window, err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Fatalf("window %d: ReadAll: got other data", window)
+		}
+
+		end, err := r.Seek(-10, io.SeekEnd)
+		if err != nil || end != 990 {
+			t.Fatalf("window %d: SeekEnd: got %d %v", window, end, err)
+		}
+		b, err = io.ReadAll(r)
+		if err != nil || !bytes.Equal(b, data[990:]) {
+			t.Fatalf("window %d: read after SeekEnd: got %v %v", window, b, err)
+		}
+
+		rnd := rand.New(rand.NewSource(int64(window)))
+		for i := 0; i < 200; i++ {
+			offset := rnd.Intn(len(data) + 10)
+			size := rnd.Intn(100) + 1
+			if _, err := r.Seek(int64(offset), io.SeekStart); err != nil {
+				t.Fatalf("window %d: Seek %d: %s", window, offset, err)
+			}
+			p := make([]byte, size)
+			n, err := io.ReadFull(r, p)
+			expected := []byte{}
+			if offset < len(data) {
+				expected = data[offset:]
+			}
+			if len(expected) > size {
+				expected = expected[0:size]
+			}
+			if !bytes.Equal(p[0:n], expected) {
+				t.Fatalf("window %d: read %d at %d: got %v expected %v", window, size, offset, p[0:n], expected)
+			}
+			if n < size && err == nil {
+				t.Fatalf("window %d: read %d at %d: expected error for short read", window, size, offset)
+			}
+		}
+	}
+}
+
+type readRecord struct {
+	pLen int
+	off  int64
+	retP string
+	err  error
+}
+
+// records reads, might be read from read ahead go routine
+type recordingReadSeeker struct {
+	rs      io.ReadSeeker
+	mu      sync.Mutex
+	off     int64
+	records []readRecord
+}
+
+func (r *recordingReadSeeker) Read(p []byte) (n int, err error) {
+	n, err = r.rs.Read(p)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, readRecord{
+		pLen: len(p),
+		off:  r.off,
+		retP: string(p[0:n]),
+		err:  err,
+	})
+	r.off += int64(n)
+	return n, err
+}
+
+func (r *recordingReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	off, err := r.rs.Seek(offset, whence)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.off = off
+	return off, err
+}
+
+func TestReadAheadReaderWindowReads(t *testing.T) {
+	rrs := &recordingReadSeeker{rs: bytes.NewReader([]byte("abc"))}
+	windowFnCalls := 0
+	r := bitio.NewReadAheadReader(rrs, 2, func() { windowFnCalls++ })
+
+	var got []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		got = append(got, b[0:n]...)
+		if err != nil {
+			if err != io.EOF {
+				t.Fatalf("Read: %s", err)
+			}
+			break
+		}
+	}
+	if string(got) != "abc" {
+		t.Fatalf("got %q expected %q", got, "abc")
+	}
+
+	// one byte reads are done as window size reads, second window is prefetched
+	expectedRecords := []readRecord{
+		{pLen: 2, off: 0, retP: "ab"},
+		{pLen: 2, off: 2, retP: "c"},
+		{pLen: 1, off: 3, retP: "", err: io.EOF},
+	}
+	rrs.mu.Lock()
+	records := rrs.records
+	rrs.mu.Unlock()
+	if !reflect.DeepEqual(records, expectedRecords) {
+		t.Fatalf("got records %#+v expected %#+v", records, expectedRecords)
+	}
+
+	// first and second window, end is known from second window
+	if windowFnCalls != 2 {
+		t.Fatalf("got %d window fn calls expected 2", windowFnCalls)
+	}
+}
@@ -0,0 +1,75 @@
+package checksum
+
+// Bob Jenkins lookup3 hashlittle
+// http://burtleburtle.net/bob/c/lookup3.c
+
+import "math/bits"
+
+func lookup3Mix(a, b, c uint32) (uint32, uint32, uint32) {
+	a -= c
+	a ^= bits.RotateLeft32(c, 4)
+	c += b
+	b -= a
+	b ^= bits.RotateLeft32(a, 6)
+	a += c
+	c -= b
+	c ^= bits.RotateLeft32(b, 8)
+	b += a
+	a -= c
+	a ^= bits.RotateLeft32(c, 16)
+	c += b
+	b -= a
+	b ^= bits.RotateLeft32(a, 19)
+	a += c
+	c -= b
+	c ^= bits.RotateLeft32(b, 4)
+	b += a
+	return a, b, c
+}
+
+func lookup3Final(a, b, c uint32) uint32 {
+	c ^= b
+	c -= bits.RotateLeft32(b, 14)
+	a ^= c
+	a -= bits.RotateLeft32(c, 11)
+	b ^= a
+	b -= bits.RotateLeft32(a, 25)
+	c ^= b
+	c -= bits.RotateLeft32(b, 16)
+	a ^= c
+	a -= bits.RotateLeft32(c, 4)
+	b ^= a
+	b -= bits.RotateLeft32(a, 14)
+	c ^= b
+	c -= bits.RotateLeft32(b, 24)
+	return c
+}
+
+// Lookup3 returns hashlittle of b with initial value
+func Lookup3(b []byte, initval uint32) uint32 {
+	a := 0xdeadbeef + uint32(len(b)) + initval
+	bv, c := a, a
+
+	for len(b) > 12 {
+		a += uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+		bv += uint32(b[4]) | uint32(b[5])<<8 | uint32(b[6])<<16 | uint32(b[7])<<24
+		c += uint32(b[8]) | uint32(b[9])<<8 | uint32(b[10])<<16 | uint32(b[11])<<24
+		a, bv, c = lookup3Mix(a, bv, c)
+		b = b[12:]
+	}
+	if len(b) == 0 {
+		return c
+	}
+	for i, v := range b {
+		switch {
+		case i < 4:
+			a += uint32(v) << (8 * i)
+		case i < 8:
+			bv += uint32(v) << (8 * (i - 4))
+		default:
+			c += uint32(v) << (8 * (i - 8))
+		}
+	}
+
+	return lookup3Final(a, bv, c)
+}
@@ -0,0 +1,118 @@
+package checksum
+
+// https://github.com/Cyan4973/xxHash/blob/dev/doc/xxhash_spec.md
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	xxh32Prime1 uint32 = 2654435761
+	xxh32Prime2 uint32 = 2246822519
+	xxh32Prime3 uint32 = 3266489917
+	xxh32Prime4 uint32 = 668265263
+	xxh32Prime5 uint32 = 374761393
+)
+
+// XXH32 implements hash.Hash32
+type XXH32 struct {
+	Seed uint32
+
+	v     [4]uint32
+	buf   [16]byte
+	nBuf  int
+	total uint64
+	init  bool
+}
+
+func xxh32Round(acc uint32, input uint32) uint32 {
+	acc += input * xxh32Prime2
+	acc = bits.RotateLeft32(acc, 13)
+	return acc * xxh32Prime1
+}
+
+func (c *XXH32) reset() {
+	c.v[0] = c.Seed + xxh32Prime1 + xxh32Prime2
+	c.v[1] = c.Seed + xxh32Prime2
+	c.v[2] = c.Seed
+	c.v[3] = c.Seed - xxh32Prime1
+	c.nBuf = 0
+	c.total = 0
+	c.init = true
+}
+
+func (c *XXH32) stripe(p []byte) {
+	c.v[0] = xxh32Round(c.v[0], binary.LittleEndian.Uint32(p[0:]))
+	c.v[1] = xxh32Round(c.v[1], binary.LittleEndian.Uint32(p[4:]))
+	c.v[2] = xxh32Round(c.v[2], binary.LittleEndian.Uint32(p[8:]))
+	c.v[3] = xxh32Round(c.v[3], binary.LittleEndian.Uint32(p[12:]))
+}
+
+func (c *XXH32) Write(p []byte) (n int, err error) {
+	if !c.init {
+		c.reset()
+	}
+	n = len(p)
+	c.total += uint64(n)
+
+	if c.nBuf > 0 {
+		l := copy(c.buf[c.nBuf:], p)
+		c.nBuf += l
+		p = p[l:]
+		if c.nBuf < len(c.buf) {
+			return n, nil
+		}
+		c.stripe(c.buf[:])
+		c.nBuf = 0
+	}
+	for ; len(p) >= 16; p = p[16:] {
+		c.stripe(p)
+	}
+	c.nBuf = copy(c.buf[:], p)
+
+	return n, nil
+}
+
+func (c *XXH32) Sum32() uint32 {
+	if !c.init {
+		c.reset()
+	}
+
+	var acc uint32
+	if c.total >= 16 {
+		acc = bits.RotateLeft32(c.v[0], 1) +
+			bits.RotateLeft32(c.v[1], 7) +
+			bits.RotateLeft32(c.v[2], 12) +
+			bits.RotateLeft32(c.v[3], 18)
+	} else {
+		acc = c.Seed + xxh32Prime5
+	}
+	acc += uint32(c.total)
+
+	p := c.buf[:c.nBuf]
+	for ; len(p) >= 4; p = p[4:] {
+		acc += binary.LittleEndian.Uint32(p) * xxh32Prime3
+		acc = bits.RotateLeft32(acc, 17) * xxh32Prime4
+	}
+	for _, b := range p {
+		acc += uint32(b) * xxh32Prime5
+		acc = bits.RotateLeft32(acc, 11) * xxh32Prime1
+	}
+
+	acc ^= acc >> 15
+	acc *= xxh32Prime2
+	acc ^= acc >> 13
+	acc *= xxh32Prime3
+	acc ^= acc >> 16
+
+	return acc
+}
+
+func (c *XXH32) Sum(b []byte) []byte {
+	s := c.Sum32()
+	return append(b, byte(s>>24), byte(s>>16), byte(s>>8), byte(s))
+}
+func (c *XXH32) Reset()         { c.reset() }
+func (c *XXH32) Size() int      { return 4 }
+func (c *XXH32) BlockSize() int { return 16 }
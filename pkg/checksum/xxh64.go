@@ -0,0 +1,132 @@
+package checksum
+
+// https://github.com/Cyan4973/xxHash/blob/dev/doc/xxhash_spec.md
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	xxh64Prime1 uint64 = 11400714785074694791
+	xxh64Prime2 uint64 = 14029467366897019727
+	xxh64Prime3 uint64 = 1609587929392839161
+	xxh64Prime4 uint64 = 9650029242287828579
+	xxh64Prime5 uint64 = 2870177450012600261
+)
+
+// XXH64 implements hash.Hash64
+type XXH64 struct {
+	Seed uint64
+
+	v     [4]uint64
+	buf   [32]byte
+	nBuf  int
+	total uint64
+	init  bool
+}
+
+func xxh64Round(acc uint64, input uint64) uint64 {
+	acc += input * xxh64Prime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxh64Prime1
+}
+
+func xxh64MergeRound(acc uint64, v uint64) uint64 {
+	acc ^= xxh64Round(0, v)
+	return acc*xxh64Prime1 + xxh64Prime4
+}
+
+func (c *XXH64) reset() {
+	c.v[0] = c.Seed + xxh64Prime1 + xxh64Prime2
+	c.v[1] = c.Seed + xxh64Prime2
+	c.v[2] = c.Seed
+	c.v[3] = c.Seed - xxh64Prime1
+	c.nBuf = 0
+	c.total = 0
+	c.init = true
+}
+
+func (c *XXH64) stripe(p []byte) {
+	c.v[0] = xxh64Round(c.v[0], binary.LittleEndian.Uint64(p[0:]))
+	c.v[1] = xxh64Round(c.v[1], binary.LittleEndian.Uint64(p[8:]))
+	c.v[2] = xxh64Round(c.v[2], binary.LittleEndian.Uint64(p[16:]))
+	c.v[3] = xxh64Round(c.v[3], binary.LittleEndian.Uint64(p[24:]))
+}
+
+func (c *XXH64) Write(p []byte) (n int, err error) {
+	if !c.init {
+		c.reset()
+	}
+	n = len(p)
+	c.total += uint64(n)
+
+	if c.nBuf > 0 {
+		l := copy(c.buf[c.nBuf:], p)
+		c.nBuf += l
+		p = p[l:]
+		if c.nBuf < len(c.buf) {
+			return n, nil
+		}
+		c.stripe(c.buf[:])
+		c.nBuf = 0
+	}
+	for ; len(p) >= 32; p = p[32:] {
+		c.stripe(p)
+	}
+	c.nBuf = copy(c.buf[:], p)
+
+	return n, nil
+}
+
+func (c *XXH64) Sum64() uint64 {
+	if !c.init {
+		c.reset()
+	}
+
+	var acc uint64
+	if c.total >= 32 {
+		acc = bits.RotateLeft64(c.v[0], 1) +
+			bits.RotateLeft64(c.v[1], 7) +
+			bits.RotateLeft64(c.v[2], 12) +
+			bits.RotateLeft64(c.v[3], 18)
+		acc = xxh64MergeRound(acc, c.v[0])
+		acc = xxh64MergeRound(acc, c.v[1])
+		acc = xxh64MergeRound(acc, c.v[2])
+		acc = xxh64MergeRound(acc, c.v[3])
+	} else {
+		acc = c.Seed + xxh64Prime5
+	}
+	acc += c.total
+
+	p := c.buf[:c.nBuf]
+	for ; len(p) >= 8; p = p[8:] {
+		acc ^= xxh64Round(0, binary.LittleEndian.Uint64(p))
+		acc = bits.RotateLeft64(acc, 27)*xxh64Prime1 + xxh64Prime4
+	}
+	if len(p) >= 4 {
+		acc ^= uint64(binary.LittleEndian.Uint32(p)) * xxh64Prime1
+		acc = bits.RotateLeft64(acc, 23)*xxh64Prime2 + xxh64Prime3
+		p = p[4:]
+	}
+	for _, b := range p {
+		acc ^= uint64(b) * xxh64Prime5
+		acc = bits.RotateLeft64(acc, 11) * xxh64Prime1
+	}
+
+	acc ^= acc >> 33
+	acc *= xxh64Prime2
+	acc ^= acc >> 29
+	acc *= xxh64Prime3
+	acc ^= acc >> 32
+
+	return acc
+}
+
+func (c *XXH64) Sum(b []byte) []byte {
+	s := c.Sum64()
+	return append(b, byte(s>>56), byte(s>>48), byte(s>>40), byte(s>>32), byte(s>>24), byte(s>>16), byte(s>>8), byte(s))
+}
+func (c *XXH64) Reset()         { c.reset() }
+func (c *XXH64) Size() int      { return 8 }
+func (c *XXH64) BlockSize() int { return 32 }
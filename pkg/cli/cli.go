@@ -155,6 +155,11 @@ type stdOSFS struct{}
 
 func (stdOSFS) Open(name string) (fs.File, error) { return os.Open(name) }
 
+// Stat makes fs.Stat not have to open named pipes etc
+func (stdOSFS) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+
+func (stdOSFS) Create(name string) (io.WriteCloser, error) { return os.Create(name) }
+
 func (*stdOS) FS() fs.FS { return stdOSFS{} }
 
 func (o *stdOS) Readline(opts interp.ReadlineOpts) (string, error) {
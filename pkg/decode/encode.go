@@ -0,0 +1,95 @@
+package decode
+
+import (
+	"fmt"
+
+	"github.com/wader/fq/pkg/bitio"
+)
+
+// E is passed to Format.EncodeFn and is the write counterpart of D
+type E struct {
+	Endian Endian
+
+	buf   []byte
+	nBits int64
+}
+
+// Len is number of bits written
+func (e *E) Len() int64 { return e.nBits }
+
+// Bytes returns written bytes, last byte is zero padded if not byte aligned
+func (e *E) Bytes() []byte { return e.buf }
+
+// U writes nBits unsigned integer using current endian
+func (e *E) U(nBits int, v uint64) {
+	if e.Endian == LittleEndian {
+		v = bitio.ReverseBytes64(nBits, v)
+	}
+	e.write64(v, int64(nBits))
+}
+
+func (e *E) write64(v uint64, nBits int64) {
+	if need := bitio.BitsByteCount(e.nBits + nBits); need > int64(len(e.buf)) {
+		e.buf = append(e.buf, make([]byte, need-int64(len(e.buf)))...)
+	}
+	bitio.Write64(v, nBits, e.buf, e.nBits)
+	e.nBits += nBits
+}
+
+func (e *E) U1(v uint64)  { e.U(1, v) }
+func (e *E) U8(v uint64)  { e.U(8, v) }
+func (e *E) U16(v uint64) { e.U(16, v) }
+func (e *E) U24(v uint64) { e.U(24, v) }
+func (e *E) U32(v uint64) { e.U(32, v) }
+func (e *E) U64(v uint64) { e.U(64, v) }
+
+func (e *E) Bool(v bool) {
+	if v {
+		e.U1(1)
+	} else {
+		e.U1(0)
+	}
+}
+
+// WriteBytes writes bytes, can be unaligned
+func (e *E) WriteBytes(b []byte) {
+	if e.nBits%8 == 0 {
+		e.buf = append(e.buf, b...)
+		e.nBits += int64(len(b)) * 8
+		return
+	}
+	for _, c := range b {
+		e.write64(uint64(c), 8)
+	}
+}
+
+// WriteBits writes the first nBits bits of b, can be unaligned
+func (e *E) WriteBits(b []byte, nBits int64) {
+	if e.nBits%8 == 0 && nBits%8 == 0 {
+		e.WriteBytes(b[0 : nBits/8])
+		return
+	}
+	for i := int64(0); i < nBits; i += 64 {
+		n := nBits - i
+		if n > 64 {
+			n = 64
+		}
+		e.write64(bitio.Read64(b, i, n), n)
+	}
+}
+
+// Format encodes v using the first format in group that has an encoder
+func (e *E) Format(group Group, v any) error {
+	for _, f := range group {
+		if f.EncodeFn == nil {
+			continue
+		}
+		// formats have their own endian
+		endian := e.Endian
+		e.Endian = BigEndian
+		err := f.EncodeFn(e, v)
+		e.Endian = endian
+		return err
+	}
+	return fmt.Errorf("no encoder found")
+}
@@ -13,6 +13,7 @@ type Format struct {
 	Description   string
 	Groups        []string
 	DecodeFn      func(d *D, _ any) any
+	EncodeFn      func(e *E, v any) error // optional, v is a jq value or decode value possibly modified
 	DecodeInArg   any
 	DecodeOutType any
 	RootArray     bool
@@ -20,8 +21,21 @@ type Format struct {
 	Dependencies  []Dependency
 	Help          FormatHelp
 	Functions     []string
+	ExtKeys       []ExtKey // additional "_" prefixed keys for values decoded by the format
 }
 
+// ExtKey is a "_" prefixed key available on values decoded by a format or a format nested inside it.
+type ExtKey struct {
+	Name string
+	// Fn returns key value for v and false if the key does not apply to v, the key is then null.
+	// The value can be a *Value or a JSON compatible go value.
+	Fn func(v *Value, cache ExtKeyCache) (any, bool)
+}
+
+// ExtKeyCache is shared by ext key lookups on values from the same decode and can be used to
+// keep state built from other values, ex: lookup tables. Use a key type private to the format.
+type ExtKeyCache map[any]any
+
 type HelpExample struct {
 	Comment string
 	Code    string
@@ -151,8 +151,8 @@ func (d *D) tryTextLenPrefixed(lenBits int, fixedBytes int, e encoding.Encoding)
 	if lenBits < 0 {
 		return "", fmt.Errorf("tryTextLenPrefixed lenBits must be >= 0 (%d)", lenBits)
 	}
-	if fixedBytes < 0 {
-		return "", fmt.Errorf("tryTextLenPrefixed fixedBytes must be >= 0 (%d)", fixedBytes)
+	if fixedBytes < -1 {
+		return "", fmt.Errorf("tryTextLenPrefixed fixedBytes must be >= -1 (%d)", fixedBytes)
 	}
 	bytesLeft := d.BitsLeft() / 8
 	if int64(fixedBytes) > bytesLeft {
@@ -2,8 +2,10 @@ package decode
 
 import (
 	"errors"
+	"io"
 	"sort"
 
+	"github.com/wader/fq/internal/bitioex"
 	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/ranges"
 	"github.com/wader/fq/pkg/scalar"
@@ -179,6 +181,24 @@ func (v *Value) InnerRange() ranges.Range {
 	return v.Range
 }
 
+// BitReader returns a bit reader for the bits of the value without copying.
+// Bit offset zero is the first bit of the value.
+func (v *Value) BitReader() (bitio.ReaderAtSeeker, error) {
+	r := v.InnerRange()
+	return bitioex.Range(v.RootReader, r.Start, r.Len)
+}
+
+// SectionReader returns a io.SectionReader for the bytes of the value without copying.
+// Value does not need to be byte aligned, an unaligned last byte is zero bit padded.
+// Is only safe for concurrent use if the underlaying reader is.
+func (v *Value) SectionReader() (*io.SectionReader, error) {
+	br, err := v.BitReader()
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(bitio.NewIOReaderAt(br), 0, bitio.BitsByteCount(v.InnerRange().Len)), nil
+}
+
 func (v *Value) postProcess() {
 	if err := v.WalkRootPostOrder(func(v *Value, _ *Value, _ int, _ int) error {
 		switch vv := v.V.(type) {
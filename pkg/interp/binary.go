@@ -7,8 +7,8 @@ import (
 	"io"
 	"io/fs"
 	"math/big"
+	"sync/atomic"
 
-	"github.com/wader/fq/internal/aheadreadseeker"
 	"github.com/wader/fq/internal/bitioex"
 	"github.com/wader/fq/internal/ctxreadseeker"
 	"github.com/wader/fq/internal/gojqex"
@@ -229,22 +229,41 @@ func (i *Interp) _open(c any) any {
 		filename: path,
 	}
 
-	const progressPrecision = 1024
-	fRS = progressreadseeker.New(fRS, progressPrecision, bEnd,
-		func(approxReadBytes int64, totalSize int64) {
-			// progressFn is assign by decode etc
-			if bbf.progressFn != nil {
-				bbf.progressFn(approxReadBytes, totalSize)
+	progressFn := func(approxReadBytes int64, totalSize int64) {
+		// progressFn is assign by decode etc
+		if bbf.progressFn != nil {
+			bbf.progressFn(approxReadBytes, totalSize)
+		}
+	}
+	var windowFn func()
+	readAheadSize := i.readAheadSize()
+	if readAheadSize > 0 {
+		// progress might be updated from the read ahead go routine so report it
+		// from the callers go routine when reading moves to another window
+		var approxReadBytes, reportedReadBytes int64
+		reportFn := progressFn
+		progressFn = func(n int64, _ int64) { atomic.StoreInt64(&approxReadBytes, n) }
+		windowFn = func() {
+			if n := atomic.LoadInt64(&approxReadBytes); n != reportedReadBytes {
+				reportedReadBytes = n
+				reportFn(n, bEnd)
 			}
-		},
-	)
+		}
+	}
 
-	const cacheReadAheadSize = 512 * 1024
-	aheadRs := aheadreadseeker.New(fRS, cacheReadAheadSize)
+	fRS = ioex.CountReadSeeker{ReadSeeker: fRS, N: &i.stats.readBytes}
+
+	const progressPrecision = 1024
+	fRS = progressreadseeker.New(fRS, progressPrecision, bEnd, progressFn)
+
+	// read ahead in background while decoding, most decoders read sequentially
+	if readAheadSize > 0 {
+		fRS = bitio.NewReadAheadReader(fRS, readAheadSize, windowFn)
+	}
 
-	// bitio.Buffer -> (bitio.Reader) -> aheadreadseeker -> progressreadseeker -> ctxreadseeker -> readseeker
+	// bitio.Buffer -> (bitio.Reader) -> bitio.ReadAheadReader -> progressreadseeker -> countreadseeker -> ctxreadseeker -> readseeker
 
-	bbf.br = bitio.NewIOBitReadSeeker(aheadRs)
+	bbf.br = bitio.NewIOBitReadSeeker(fRS)
 	if err != nil {
 		return err
 	}
@@ -255,6 +274,9 @@ func (i *Interp) _open(c any) any {
 var _ Value = Binary{}
 var _ ToBinary = Binary{}
 
+// Binary is a bit range of a reader with a unit size in bits used when indexing and
+// slicing, 8 for bytes and 1 for bits. Binaries share the underlaying reader so slicing
+// and reading does not copy.
 type Binary struct {
 	br   bitio.ReaderAtSeeker
 	r    ranges.Range
@@ -410,6 +432,27 @@ func (b Binary) Display(w io.Writer, opts Options) error {
 	return hexdump(w, b, opts)
 }
 
+// Range returns the bit range of the binary in the underlaying reader.
+func (b Binary) Range() ranges.Range { return b.r }
+
+// Unit returns size in bits of a unit when indexing and slicing.
+func (b Binary) Unit() int { return b.unit }
+
+// BitReader returns a bit reader for the bits of the binary without copying.
+// Bit offset zero is the first bit of the binary.
+func (b Binary) BitReader() (bitio.ReaderAtSeeker, error) { return b.toReader() }
+
+// SectionReader returns a io.SectionReader for the bytes of the binary without copying.
+// Binary does not need to be byte aligned, an unaligned last byte is zero bit padded.
+// Is only safe for concurrent use if the underlaying reader is, binaries from files are not.
+func (b Binary) SectionReader() (*io.SectionReader, error) {
+	br, err := b.toReader()
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(bitio.NewIOReaderAt(br), 0, bitio.BitsByteCount(b.pad+b.r.Len)), nil
+}
+
 func (b Binary) toReader() (bitio.ReaderAtSeeker, error) {
 	br, err := bitioex.Range(b.br, b.r.Start, b.r.Len)
 	if err != nil {
@@ -1,9 +1,11 @@
 package interp
 
 import (
+	"fmt"
 	"math/big"
 
 	"github.com/wader/fq/internal/gojqex"
+	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/gojq"
 )
 
@@ -14,6 +16,10 @@ func init() {
 	RegisterFunc2("band", (*Interp).band)
 	RegisterFunc2("bor", (*Interp).bor)
 	RegisterFunc2("bxor", (*Interp).bxor)
+	RegisterFunc1("band", (*Interp).bandBinary)
+	RegisterFunc1("bor", (*Interp).borBinary)
+	RegisterFunc1("bxor", (*Interp).bxorBinary)
+	RegisterFunc1("bshift", (*Interp).bshift)
 }
 
 func (i *Interp) bnot(c any) any {
@@ -22,6 +28,8 @@ func (i *Interp) bnot(c any) any {
 		return ^c
 	case *big.Int:
 		return new(big.Int).Not(c)
+	case Binary:
+		return binaryBitop(c, []byte{0xff}, func(a, b byte) byte { return ^a })
 	case gojq.JQValue:
 		return i.bnot(c.JQValueToGoJQ())
 	default:
@@ -103,3 +111,111 @@ func (i *Interp) bxor(c any, a any, b any) any {
 		func(l, r any) any { return &gojqex.BinopTypeError{Name: "bxor", L: l, R: r} },
 	)
 }
+
+// binary input with a repeating key for bitwise operations on bytes, ex xor deobfuscation
+func toBitopBinary(name string, c any, key any) (Binary, []byte, error) {
+	var bv Binary
+	switch c.(type) {
+	case ToBinary, string:
+		var err error
+		bv, err = toBinary(c)
+		if err != nil {
+			return Binary{}, nil, err
+		}
+	default:
+		return Binary{}, nil, &gojqex.BinopTypeError{Name: name, L: c, R: key}
+	}
+
+	var kb []byte
+	switch key.(type) {
+	case int, float64, *big.Int:
+		// single number is a one byte key
+		n, err := toBigInt(key)
+		if err != nil || n.Sign() < 0 || n.Cmp(big.NewInt(0xff)) > 0 {
+			return Binary{}, nil, fmt.Errorf("%s: number key must be a byte 0-255", name)
+		}
+		kb = []byte{byte(n.Int64())}
+	default:
+		var err error
+		kb, err = toBytes(key)
+		if err != nil {
+			return Binary{}, nil, &gojqex.BinopTypeError{Name: name, L: c, R: key}
+		}
+	}
+	if len(kb) == 0 {
+		return Binary{}, nil, fmt.Errorf("%s: key is empty", name)
+	}
+
+	return bv, kb, nil
+}
+
+func binaryBitop(bv Binary, key []byte, fn func(a, b byte) byte) any {
+	buf, err := bv.toBytesBuffer(bv.r)
+	if err != nil {
+		return err
+	}
+	b := buf.Bytes()
+	for i := range b {
+		b[i] = fn(b[i], key[i%len(key)])
+	}
+	outBv, err := NewBinaryFromBitReader(bitio.NewBitReader(b, bv.r.Len), 8, 0)
+	if err != nil {
+		return err
+	}
+	return outBv
+}
+
+func (i *Interp) bandBinary(c any, key any) any {
+	bv, kb, err := toBitopBinary("band", c, key)
+	if err != nil {
+		return err
+	}
+	return binaryBitop(bv, kb, func(a, b byte) byte { return a & b })
+}
+
+func (i *Interp) borBinary(c any, key any) any {
+	bv, kb, err := toBitopBinary("bor", c, key)
+	if err != nil {
+		return err
+	}
+	return binaryBitop(bv, kb, func(a, b byte) byte { return a | b })
+}
+
+func (i *Interp) bxorBinary(c any, key any) any {
+	bv, kb, err := toBitopBinary("bxor", c, key)
+	if err != nil {
+		return err
+	}
+	return binaryBitop(bv, kb, func(a, b byte) byte { return a ^ b })
+}
+
+// shift whole binary n bits left or right if negative, length is kept and zeros shifted in
+func (i *Interp) bshift(c any, n int) any {
+	bv, _, err := toBitopBinary("bshift", c, 0)
+	if err != nil {
+		return err
+	}
+	buf, err := bv.toBytesBuffer(bv.r)
+	if err != nil {
+		return err
+	}
+	b := buf.Bytes()
+	nBits := bv.r.Len
+
+	out := make([]byte, len(b))
+	for j := int64(0); j < nBits; j++ {
+		src := j + int64(n)
+		if src < 0 || src >= nBits {
+			continue
+		}
+		if b[src/8]&(0x80>>(src%8)) != 0 {
+			out[j/8] |= 0x80 >> (j % 8)
+		}
+	}
+
+	outBv, err := NewBinaryFromBitReader(bitio.NewBitReader(out, nBits), 8, 0)
+	if err != nil {
+		return err
+	}
+	return outBv
+}
@@ -7,7 +7,9 @@ import (
 	"io"
 	"math/big"
 	"reflect"
+	"runtime"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/mitchellh/copystructure"
@@ -26,6 +28,32 @@ func init() {
 	RegisterFunc0("_registry", (*Interp)._registry)
 	RegisterFunc1("_tovalue", (*Interp)._toValue)
 	RegisterFunc2("_decode", (*Interp)._decode)
+	RegisterFunc0("_stats", (*Interp)._stats)
+}
+
+type stats struct {
+	decodes      int
+	decodeTime   time.Duration
+	decodeValues int
+	readBytes    int64 // atomic, might be updated from read ahead go routine
+}
+
+func (i *Interp) _stats(c any) any {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	return map[string]any{
+		"decodes":       i.stats.decodes,
+		"decode_time":   i.stats.decodeTime.Seconds(),
+		"decode_values": i.stats.decodeValues,
+		"read_bytes":    int(atomic.LoadInt64(&i.stats.readBytes)),
+		// total memory obtained from the OS, go runtime does not keep track of
+		// peak heap size
+		"sys_memory":  int(ms.Sys),
+		"total_alloc": int(ms.TotalAlloc),
+		"mallocs":     int(ms.Mallocs),
+		"gc_count":    int(ms.NumGC),
+	}
 }
 
 type expectedExtkeyError struct {
@@ -124,6 +152,9 @@ func (i *Interp) _registry(c any) any {
 			}
 			vf["functions"] = ss
 		}
+		if f.EncodeFn != nil {
+			vf["encode"] = true
+		}
 
 		formats[f.Name] = vf
 	}
@@ -164,16 +195,92 @@ func (i *Interp) _registry(c any) any {
 }
 
 func (i *Interp) _toValue(c any, opts map[string]any) any {
-	v, _ := toValue(
-		func() Options { return OptionsFromValue(opts) },
-		c,
-	)
+	o := OptionsFromValue(opts)
+	optsFn := func() Options { return o }
+	if o.Depth != 0 || o.ArrayLimit != 0 {
+		return toValueLimited(optsFn, o, c, 0)
+	}
+	v, _ := toValue(optsFn, c)
 	return v
 }
 
+// toValueLimited converts tree so that options apply to all values. Compound
+// values deeper than depth are replaced and arrays longer than array limit are
+// truncated with a {"_truncated": <number of elided values>} marker. Decode
+// value children past the limits are not converted.
+func toValueLimited(optsFn func() Options, opts Options, c any, depth int) any {
+	truncated := func(n int) any { return map[string]any{"_truncated": n} }
+	arrayLen := func(n int) int {
+		if opts.ArrayLimit != 0 && n > opts.ArrayLimit {
+			return opts.ArrayLimit
+		}
+		return n
+	}
+
+	switch v := c.(type) {
+	case ArrayDecodeValue:
+		children := v.Compound.Children
+		if opts.Depth != 0 && depth >= opts.Depth {
+			return truncated(len(children))
+		}
+		n := arrayLen(len(children))
+		vs := make([]any, 0, n+1)
+		for _, f := range children[0:n] {
+			vs = append(vs, toValueLimited(optsFn, opts, makeDecodeValue(f, v.extKeyCache), depth+1))
+		}
+		if n < len(children) {
+			vs = append(vs, truncated(len(children)-n))
+		}
+		return vs
+	case StructDecodeValue:
+		children := v.Compound.Children
+		if opts.Depth != 0 && depth >= opts.Depth {
+			return truncated(len(children))
+		}
+		vm := make(map[string]any, len(children))
+		for _, f := range children {
+			vm[f.Name] = toValueLimited(optsFn, opts, makeDecodeValue(f, v.extKeyCache), depth+1)
+		}
+		return vm
+	}
+
+	v, ok := toValue(optsFn, c)
+	if !ok {
+		return v
+	}
+
+	switch v := v.(type) {
+	case []any:
+		if opts.Depth != 0 && depth >= opts.Depth {
+			return truncated(len(v))
+		}
+		n := arrayLen(len(v))
+		vs := make([]any, 0, n+1)
+		for _, e := range v[0:n] {
+			vs = append(vs, toValueLimited(optsFn, opts, e, depth+1))
+		}
+		if n < len(v) {
+			vs = append(vs, truncated(len(v)-n))
+		}
+		return vs
+	case map[string]any:
+		if opts.Depth != 0 && depth >= opts.Depth {
+			return truncated(len(v))
+		}
+		vm := make(map[string]any, len(v))
+		for k, e := range v {
+			vm[k] = toValueLimited(optsFn, opts, e, depth+1)
+		}
+		return vm
+	default:
+		return v
+	}
+}
+
 type decodeOpts struct {
 	Force    bool
 	Progress string
+	Stats    bool
 	Remain   map[string]any `mapstruct:",remain"`
 }
 
@@ -235,6 +342,7 @@ func (i *Interp) _decode(c any, format string, opts decodeOpts) any {
 		return err
 	}
 
+	decodeStart := time.Now()
 	dv, formatOut, err := decode.Decode(i.EvalInstance.Ctx, bv.br, decodeFormat,
 		decode.Options{
 			IsRoot:      true,
@@ -266,6 +374,15 @@ func (i *Interp) _decode(c any, format string, opts decodeOpts) any {
 			},
 		},
 	)
+	i.stats.decodes++
+	i.stats.decodeTime += time.Since(decodeStart)
+	if dv != nil && opts.Stats {
+		// counting is not free so only do it if asked for
+		_ = dv.WalkPreOrder(func(v *decode.Value, rootV *decode.Value, depth int, rootDepth int) error {
+			i.stats.decodeValues++
+			return nil
+		})
+	}
 	if dv == nil {
 		var decodeFormatsErr decode.FormatsError
 		if errors.As(err, &decodeFormatsErr) {
@@ -289,7 +406,7 @@ func (i *Interp) _decode(c any, format string, opts decodeOpts) any {
 		}
 	}
 
-	return makeDecodeValueOut(dv, formatOutMap)
+	return makeDecodeValueOut(dv, formatOutMap, decode.ExtKeyCache{})
 }
 
 func valueKey(name string, a, b func(name string) any) any {
@@ -326,18 +443,24 @@ func toValue(optsFn func() Options, v any) (any, bool) {
 	}
 }
 
-func makeDecodeValue(dv *decode.Value) any {
-	return makeDecodeValueOut(dv, nil)
+// cache is shared by values from the same decode, see decode.ExtKeyCache
+func makeDecodeValue(dv *decode.Value, cache decode.ExtKeyCache) any {
+	return makeDecodeValueOut(dv, nil, cache)
 }
 
-func makeDecodeValueOut(dv *decode.Value, out any) any {
+func makeDecodeValueOut(dv *decode.Value, out any, cache decode.ExtKeyCache) any {
 	switch vv := dv.V.(type) {
 	case *decode.Compound:
 		if vv.IsArray {
-			return NewArrayDecodeValue(dv, out, vv)
+			v := NewArrayDecodeValue(dv, out, vv)
+			v.extKeyCache = cache
+			return v
 		}
-		return NewStructDecodeValue(dv, out, vv)
+		v := NewStructDecodeValue(dv, out, vv)
+		v.extKeyCache = cache
+		return v
 	case *scalar.S:
+		dvb := decodeValueBase{dv: dv, extKeyCache: cache}
 		switch vv := vv.Value().(type) {
 		case bitio.ReaderAtSeeker:
 			// is lazy so that in situations where the decode value is only used to
@@ -359,58 +482,58 @@ func makeDecodeValueOut(dv *decode.Value, out any) any {
 						return gojqex.String([]rune(buf.String())), nil
 					},
 				},
-				decodeValueBase: decodeValueBase{dv: dv},
+				decodeValueBase: dvb,
 				bitsFormat:      true,
 			}
 		case bool:
 			return decodeValue{
 				JQValue:         gojqex.Boolean(vv),
-				decodeValueBase: decodeValueBase{dv: dv},
+				decodeValueBase: dvb,
 			}
 		case int:
 			return decodeValue{
 				JQValue:         gojqex.Number{V: vv},
-				decodeValueBase: decodeValueBase{dv: dv},
+				decodeValueBase: dvb,
 			}
 		case int64:
 			return decodeValue{
 				JQValue:         gojqex.Number{V: big.NewInt(vv)},
-				decodeValueBase: decodeValueBase{dv: dv},
+				decodeValueBase: dvb,
 			}
 		case uint64:
 			return decodeValue{
 				JQValue:         gojqex.Number{V: new(big.Int).SetUint64(vv)},
-				decodeValueBase: decodeValueBase{dv: dv},
+				decodeValueBase: dvb,
 			}
 		case float64:
 			return decodeValue{
 				JQValue:         gojqex.Number{V: vv},
-				decodeValueBase: decodeValueBase{dv: dv},
+				decodeValueBase: dvb,
 			}
 		case string:
 			return decodeValue{
 				JQValue:         gojqex.String(vv),
-				decodeValueBase: decodeValueBase{dv: dv},
+				decodeValueBase: dvb,
 			}
 		case []any:
 			return decodeValue{
 				JQValue:         gojqex.Array(vv),
-				decodeValueBase: decodeValueBase{dv: dv},
+				decodeValueBase: dvb,
 			}
 		case map[string]any:
 			return decodeValue{
 				JQValue:         gojqex.Object(vv),
-				decodeValueBase: decodeValueBase{dv: dv},
+				decodeValueBase: dvb,
 			}
 		case nil:
 			return decodeValue{
 				JQValue:         gojqex.Null{},
-				decodeValueBase: decodeValueBase{dv: dv},
+				decodeValueBase: dvb,
 			}
 		case *big.Int:
 			return decodeValue{
 				JQValue:         gojqex.Number{V: vv},
-				decodeValueBase: decodeValueBase{dv: dv},
+				decodeValueBase: dvb,
 			}
 		default:
 			panic(fmt.Sprintf("unreachable vv %#+v", vv))
@@ -420,9 +543,39 @@ func makeDecodeValueOut(dv *decode.Value, out any) any {
 	}
 }
 
+// bufferPath returns the chain of buffers from the root file to the buffer dv is in.
+// Each hop has the path and bit length of the value rooting the buffer and, except
+// for the root file, the path and bit range of the parent value it was derived from.
+func bufferPath(dv *decode.Value) any {
+	var hops []any
+	for v := dv.BufferRoot(); ; v = v.Parent.BufferRoot() {
+		hop := map[string]any{
+			"path": valuePath(v),
+		}
+		if brLen, err := bitioex.Len(v.RootReader); err == nil {
+			hop["len"] = big.NewInt(brLen)
+		}
+		if v.Parent != nil {
+			// range of parent in the previous hop buffer
+			sr := v.Parent.InnerRange()
+			hop["source_path"] = valuePath(v.Parent)
+			hop["source_start"] = big.NewInt(sr.Start)
+			hop["source_stop"] = big.NewInt(sr.Stop())
+			hop["source_len"] = big.NewInt(sr.Len)
+		}
+		hops = append([]any{hop}, hops...)
+
+		if v.Parent == nil {
+			break
+		}
+	}
+	return hops
+}
+
 type decodeValueBase struct {
-	dv  *decode.Value
-	out any
+	dv          *decode.Value
+	out         any
+	extKeyCache decode.ExtKeyCache
 }
 
 func (dvb decodeValueBase) DecodeValue() *decode.Value {
@@ -443,6 +596,7 @@ func (dvb decodeValueBase) ExtKeys() []string {
 		"_root",
 		"_buffer_root",
 		"_format_root",
+		"_buffer_path",
 		"_parent",
 		"_actual",
 		"_sym",
@@ -466,9 +620,57 @@ func (dvb decodeValueBase) ExtKeys() []string {
 		}
 	}
 
+	// values are only evaluated on lookup
+	seen := map[string]bool{}
+	for _, k := range formatExtKeys(dvb.dv) {
+		if !seen[k.Name] {
+			kv = append(kv, k.Name)
+			seen[k.Name] = true
+		}
+	}
+
 	return kv
 }
 
+// ext keys from format of value and formats it's nested inside, closest first
+func formatExtKeys(dv *decode.Value) []decode.ExtKey {
+	var ks []decode.ExtKey
+	for fv := dv.FormatRoot(); fv != nil; {
+		if fv.Format != nil {
+			ks = append(ks, fv.Format.ExtKeys...)
+		}
+		if fv.Parent == nil {
+			break
+		}
+		fv = fv.Parent.FormatRoot()
+	}
+	return ks
+}
+
+// null if no format key with name applies to value
+func formatExtKey(dv *decode.Value, cache decode.ExtKeyCache, name string) (any, bool) {
+	found := false
+	for _, k := range formatExtKeys(dv) {
+		if k.Name != name {
+			continue
+		}
+		found = true
+		v, ok := k.Fn(dv, cache)
+		if !ok {
+			continue
+		}
+		if kv, ok := v.(*decode.Value); ok {
+			return makeDecodeValue(kv, cache), true
+		}
+		jv, ok := gojqex.ToGoJQValue(v)
+		if !ok {
+			return fmt.Errorf("%s: can't convert ext key value to jq value %#+v", name, v), true
+		}
+		return jv, true
+	}
+	return nil, found
+}
+
 func (dvb decodeValueBase) JQValueKey(name string) any {
 	dv := dvb.dv
 
@@ -482,18 +684,20 @@ func (dvb decodeValueBase) JQValueKey(name string) any {
 	case "_name":
 		return dv.Name
 	case "_root":
-		return makeDecodeValue(dv.Root())
+		return makeDecodeValue(dv.Root(), dvb.extKeyCache)
 	case "_buffer_root":
 		// TODO: rename?
-		return makeDecodeValue(dv.BufferRoot())
+		return makeDecodeValue(dv.BufferRoot(), dvb.extKeyCache)
 	case "_format_root":
 		// TODO: rename?
-		return makeDecodeValue(dv.FormatRoot())
+		return makeDecodeValue(dv.FormatRoot(), dvb.extKeyCache)
+	case "_buffer_path":
+		return bufferPath(dv)
 	case "_parent":
 		if dv.Parent == nil {
 			return nil
 		}
-		return makeDecodeValue(dv.Parent)
+		return makeDecodeValue(dv.Parent, dvb.extKeyCache)
 	case "_actual":
 		switch vv := dv.V.(type) {
 		case *scalar.S:
@@ -571,6 +775,10 @@ func (dvb decodeValueBase) JQValueKey(name string) any {
 		}
 	}
 
+	if v, ok := formatExtKey(dv, dvb.extKeyCache, name); ok {
+		return v
+	}
+
 	return expectedExtkeyError{Key: name}
 }
 
@@ -642,19 +850,19 @@ func (v ArrayDecodeValue) JQValueIndex(index int) any {
 	if index < 0 {
 		return nil
 	}
-	return makeDecodeValue((v.Compound.Children)[index])
+	return makeDecodeValue((v.Compound.Children)[index], v.extKeyCache)
 }
 func (v ArrayDecodeValue) JQValueSlice(start int, end int) any {
 	vs := make([]any, end-start)
 	for i, e := range (v.Compound.Children)[start:end] {
-		vs[i] = makeDecodeValue(e)
+		vs[i] = makeDecodeValue(e, v.extKeyCache)
 	}
 	return vs
 }
 func (v ArrayDecodeValue) JQValueEach() any {
 	props := make([]gojq.PathValue, len(v.Compound.Children))
 	for i, f := range v.Compound.Children {
-		props[i] = gojq.PathValue{Path: i, Value: makeDecodeValue(f)}
+		props[i] = gojq.PathValue{Path: i, Value: makeDecodeValue(f, v.extKeyCache)}
 	}
 	return props
 }
@@ -680,7 +888,7 @@ func (v ArrayDecodeValue) JQValueHas(key any) any {
 func (v ArrayDecodeValue) JQValueToGoJQ() any {
 	vs := make([]any, len(v.Compound.Children))
 	for i, f := range v.Compound.Children {
-		vs[i] = makeDecodeValue(f)
+		vs[i] = makeDecodeValue(f, v.extKeyCache)
 	}
 	return vs
 }
@@ -712,7 +920,7 @@ func (v StructDecodeValue) JQValueKey(name string) any {
 
 	for _, f := range v.Compound.Children {
 		if f.Name == name {
-			return makeDecodeValue(f)
+			return makeDecodeValue(f, v.extKeyCache)
 		}
 	}
 	return nil
@@ -720,7 +928,7 @@ func (v StructDecodeValue) JQValueKey(name string) any {
 func (v StructDecodeValue) JQValueEach() any {
 	props := make([]gojq.PathValue, len(v.Compound.Children))
 	for i, f := range v.Compound.Children {
-		props[i] = gojq.PathValue{Path: f.Name, Value: makeDecodeValue(f)}
+		props[i] = gojq.PathValue{Path: f.Name, Value: makeDecodeValue(f, v.extKeyCache)}
 	}
 	return props
 }
@@ -752,7 +960,7 @@ func (v StructDecodeValue) JQValueHas(key any) any {
 func (v StructDecodeValue) JQValueToGoJQ() any {
 	vm := make(map[string]any, len(v.Compound.Children))
 	for _, f := range v.Compound.Children {
-		vm[f.Name] = makeDecodeValue(f)
+		vm[f.Name] = makeDecodeValue(f, v.extKeyCache)
 	}
 	return vm
 }
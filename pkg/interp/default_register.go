@@ -15,6 +15,10 @@ func RegisterFormat(format decode.Format) {
 	DefaultRegistry.Format(format)
 }
 
+func RegisterExtKey(formatName string, key decode.ExtKey) {
+	DefaultRegistry.ExtKey(formatName, key)
+}
+
 func RegisterFS(fs fs.ReadDirFS) {
 	DefaultRegistry.FS(fs)
 }
@@ -1,9 +1,11 @@
 package interp
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"strconv"
 	"strings"
 
@@ -12,6 +14,7 @@ import (
 	"github.com/wader/fq/internal/bitioex"
 	"github.com/wader/fq/internal/columnwriter"
 	"github.com/wader/fq/internal/hexpairwriter"
+	"github.com/wader/fq/internal/ioex"
 	"github.com/wader/fq/internal/mathex"
 	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/decode"
@@ -36,6 +39,20 @@ const (
 const rootIndentWidth = 2
 const treeIndentWidth = 2
 
+// dump layout versions, 0 is the interactive layout that might change between
+// fq versions and depends on terminal width, color etc. Stable versions will
+// not change layout once released so that dumps can be stored and diffed.
+const (
+	DumpVersionInteractive = 0
+	DumpVersionStable      = 1
+	DumpVersionLatest      = DumpVersionStable
+)
+
+const stableLineBytes = 16
+
+// fits addresses for buffers up to 4GB
+const stableAddrWidth = 8
+
 func isCompound(v *decode.Value) bool {
 	switch v.V.(type) {
 	case *decode.Compound:
@@ -61,6 +78,33 @@ func indentStr(n int) string {
 	return spaces[0:n]
 }
 
+// number shown in field column, raw value is not affected
+func dumpPreviewValue(v any, df scalar.DisplayFormat, opts Options) string {
+	s := previewValue(v, df, opts.FloatFormatFn)
+	if opts.DigitGrouping {
+		switch v.(type) {
+		case int, int64, uint64, *big.Int:
+			s = mathex.GroupDigits(s)
+		}
+	}
+	return s
+}
+
+func dumpBits(bits int64, base int, opts Options) string {
+	s := mathex.Bits(bits).StringByteBits(base)
+	if opts.DigitGrouping {
+		s = mathex.GroupDigits(s)
+	}
+	return s
+}
+
+func dumpSize(bits int64, opts Options) string {
+	if opts.HumanSize && bits%8 == 0 {
+		return mathex.HumanSize(bits / 8)
+	}
+	return dumpBits(bits, opts.Sizebase, opts)
+}
+
 func dumpEx(v *decode.Value, ctx *dumpCtx, depth int, rootV *decode.Value, rootDepth int, addrWidth int) error {
 	opts := ctx.opts
 	cw := ctx.cw
@@ -164,10 +208,10 @@ func dumpEx(v *decode.Value, ctx *dumpCtx, depth int, rootV *decode.Value, rootD
 		default:
 			cprint(colField, ":")
 			if vv.Sym == nil {
-				cfmt(colField, " %s", deco.ValueColor(vv.Actual).F(previewValue(vv.Actual, vv.ActualDisplay)))
+				cfmt(colField, " %s", deco.ValueColor(vv.Actual).F(dumpPreviewValue(vv.Actual, vv.ActualDisplay, opts)))
 			} else {
-				cfmt(colField, " %s", deco.ValueColor(vv.Sym).F(previewValue(vv.Sym, vv.SymDisplay)))
-				cfmt(colField, " (%s)", deco.ValueColor(vv.Actual).F(previewValue(vv.Actual, vv.ActualDisplay)))
+				cfmt(colField, " %s", deco.ValueColor(vv.Sym).F(dumpPreviewValue(vv.Sym, vv.SymDisplay, opts)))
+				cfmt(colField, " (%s)", deco.ValueColor(vv.Actual).F(dumpPreviewValue(vv.Actual, vv.ActualDisplay, opts)))
 			}
 		}
 
@@ -189,8 +233,12 @@ func dumpEx(v *decode.Value, ctx *dumpCtx, depth int, rootV *decode.Value, rootD
 	innerRange := v.InnerRange()
 
 	if opts.Verbose {
-		cfmt(colField, " %s (%s)",
-			mathex.BitRange(innerRange).StringByteBits(opts.Addrbase), mathex.Bits(innerRange.Len).StringByteBits(opts.Sizebase))
+		stopStr := "NA"
+		if innerRange.Len != 0 {
+			stopStr = dumpBits(innerRange.Stop()-1, opts.Addrbase, opts)
+		}
+		cfmt(colField, " %s-%s (%s)",
+			dumpBits(innerRange.Start, opts.Addrbase, opts), stopStr, dumpSize(innerRange.Len, opts))
 	}
 
 	cprint(colField, "\n")
@@ -208,7 +256,8 @@ func dumpEx(v *decode.Value, ctx *dumpCtx, depth int, rootV *decode.Value, rootD
 				columns()
 				cfmt(colField, "%s  %s: %s: %s\n", indent, deco.Error.F("error"), formatErr.Format.Name, formatErr.Err.Error())
 
-				if opts.Verbose {
+				// stacktrace depend on fq source so not part of stable layout
+				if opts.Verbose && opts.DumpVersion == DumpVersionInteractive {
 					for _, f := range formatErr.Stacktrace.Frames() {
 						columns()
 						cfmt(colField, "%s    %s\n", indent, f.Function)
@@ -337,9 +386,9 @@ func dumpEx(v *decode.Value, ctx *dumpCtx, depth int, rootV *decode.Value, rootD
 			cprint(colHex, "\n")
 			// TODO: truncate if display_bytes is small?
 			cfmt(colHex, "until %s%s (%s)",
-				mathex.Bits(stopBit).StringByteBits(opts.Addrbase),
+				dumpBits(stopBit, opts.Addrbase, opts),
 				isEnd,
-				mathex.PadFormatInt(bitio.BitsByteCount(sizeBits), opts.Sizebase, true, 0))
+				dumpSize(bitio.BitsByteCount(sizeBits)*8, opts))
 			// TODO: dump last line?
 		}
 	}
@@ -352,6 +401,17 @@ func dumpEx(v *decode.Value, ctx *dumpCtx, depth int, rootV *decode.Value, rootD
 }
 
 func dump(v *decode.Value, w io.Writer, opts Options) error {
+	if opts.DumpVersion < 0 || opts.DumpVersion > DumpVersionLatest {
+		return fmt.Errorf("unsupported dump version %d", opts.DumpVersion)
+	}
+
+	// walking a huge tree might not write anything for a long time so check
+	// if output has been canceled, ex: ctrl-c
+	ctxErr := func() error { return nil }
+	if cw, ok := w.(ioex.CtxWriter); ok && cw.Ctx != nil {
+		ctxErr = cw.Ctx.Err
+	}
+
 	maxAddrIndentWidth := 0
 	makeWalkFn := func(fn decode.WalkFn) decode.WalkFn {
 		return func(v *decode.Value, rootV *decode.Value, depth int, rootDepth int) error {
@@ -363,16 +423,46 @@ func dump(v *decode.Value, w io.Writer, opts Options) error {
 		}
 	}
 
-	_ = v.WalkPreOrder(makeWalkFn(func(v *decode.Value, _ *decode.Value, _ int, rootDepth int) error {
+	// only look at values that will be displayed so that output can start without
+	// walking the whole tree, ex: huge truncated arrays
+	walkCount := 0
+	if err := v.WalkPreOrder(makeWalkFn(func(v *decode.Value, _ *decode.Value, depth int, rootDepth int) error {
+		walkCount++
+		if walkCount%1024 == 0 {
+			if err := ctxErr(); err != nil {
+				return err
+			}
+		}
+		if opts.ArrayTruncate != 0 && depth != 0 && v.Index >= opts.ArrayTruncate {
+			if dc, ok := v.Parent.V.(*decode.Compound); ok && dc.IsArray {
+				return decode.ErrWalkBreak
+			}
+		}
+
 		maxAddrIndentWidth = mathex.Max(
 			maxAddrIndentWidth,
 			rootIndentWidth*rootDepth+mathex.DigitsInBase(bitio.BitsByteCount(v.InnerRange().Stop()), true, opts.Addrbase),
 		)
 		return nil
-	}))
+	})); err != nil && !errors.Is(err, decode.ErrWalkBreak) {
+		return err
+	}
+	if opts.DumpVersion == DumpVersionStable {
+		maxAddrIndentWidth = mathex.Max(maxAddrIndentWidth, stableAddrWidth)
+	}
 
+	if opts.LinePrefix != "" || (opts.LineWrap && opts.Width > 0) {
+		lw := &ioex.LineWriter{W: w, Prefix: opts.LinePrefix}
+		if opts.LineWrap {
+			lw.Width = opts.Width
+		}
+		w = lw
+	}
+
+	// buffer lines and write once per value instead of per column
+	bw := bufio.NewWriter(w)
 	cw := columnwriter.New(
-		w,
+		bw,
 		[]int{
 			maxAddrIndentWidth,
 			1,
@@ -408,9 +498,21 @@ func dump(v *decode.Value, w io.Writer, opts Options) error {
 		asciiHeader: asciiHeader,
 	}
 
-	return v.WalkPreOrder(makeWalkFn(func(v *decode.Value, rootV *decode.Value, depth int, rootDepth int) error {
-		return dumpEx(v, ctx, depth, rootV, rootDepth, maxAddrIndentWidth-rootDepth)
+	err := v.WalkPreOrder(makeWalkFn(func(v *decode.Value, rootV *decode.Value, depth int, rootDepth int) error {
+		err := dumpEx(v, ctx, depth, rootV, rootDepth, maxAddrIndentWidth-rootDepth)
+		if flushErr := bw.Flush(); flushErr != nil {
+			return flushErr
+		}
+		if err == nil {
+			err = ctxErr()
+		}
+		return err
 	}))
+	if flushErr := bw.Flush(); err == nil {
+		err = flushErr
+	}
+
+	return err
 }
 
 func hexdump(w io.Writer, bv Binary, opts Options) error {
@@ -0,0 +1,175 @@
+package interp
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/wader/fq/internal/bitioex"
+	"github.com/wader/fq/internal/gojqex"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+	"github.com/wader/gojq"
+)
+
+// Helpers for format EncodeFn implementations. Values to encode are jq values
+// where unmodified parts are still decode values, jq only converts the values
+// along a modified path. This makes it possible for encoders to copy the
+// original bytes of unmodified parts.
+
+func init() {
+	RegisterFunc1("_encode", (*Interp)._encode)
+}
+
+func (i *Interp) _encode(c any, formatName string) any {
+	g, err := i.Registry.FormatGroup(formatName)
+	if err != nil {
+		return err
+	}
+	var encodeFn func(e *decode.E, v any) error
+	for _, f := range g {
+		if f.Name == formatName {
+			encodeFn = f.EncodeFn
+		}
+	}
+	if encodeFn == nil {
+		return fmt.Errorf("%s has no encoder", formatName)
+	}
+
+	e := &decode.E{}
+	if err := encodeFn(e, c); err != nil {
+		return fmt.Errorf("%s: %w", formatName, err)
+	}
+	bb, err := NewBinaryFromBitReader(bitio.NewBitReader(e.Bytes(), e.Len()), 8, 0)
+	if err != nil {
+		return err
+	}
+	return bb
+}
+
+// EncodeRaw writes the original bits of v if it's an unmodified decode value
+func EncodeRaw(e *decode.E, v any) (bool, error) {
+	dv, ok := v.(DecodeValue)
+	if !ok {
+		return false, nil
+	}
+	bv, err := dv.ToBinary()
+	if err != nil {
+		return false, err
+	}
+	br, err := bv.toReader()
+	if err != nil {
+		return false, err
+	}
+	buf := &bytes.Buffer{}
+	if _, err := bitioex.CopyBits(buf, br); err != nil {
+		return false, err
+	}
+	e.WriteBits(buf.Bytes(), bv.pad+bv.r.Len)
+	return true, nil
+}
+
+// actual go value for decode value scalars without symbolic mapping
+func encodeActual(v any) any {
+	if dv, ok := v.(DecodeValue); ok {
+		if s, ok := dv.DecodeValue().V.(*scalar.S); ok {
+			switch a := s.Actual.(type) {
+			case uint64, int64, bool, string, float64:
+				return a
+			}
+		}
+	}
+	if jv, ok := v.(gojq.JQValue); ok {
+		return jv.JQValueToGoJQ()
+	}
+	return v
+}
+
+// EncodeObject returns object where values can still be decode values
+func EncodeObject(v any) (map[string]any, error) {
+	m, ok := gojqex.Cast[map[string]any](v)
+	if !ok || v == nil {
+		return nil, fmt.Errorf("expected an object, got %s", gojqex.TypeErrorPreview(v))
+	}
+	return m, nil
+}
+
+// EncodeArray returns array where values can still be decode values
+func EncodeArray(v any) ([]any, error) {
+	vs, ok := gojqex.Cast[[]any](v)
+	if !ok || v == nil {
+		return nil, fmt.Errorf("expected an array, got %s", gojqex.TypeErrorPreview(v))
+	}
+	return vs, nil
+}
+
+// EncodeUint returns unsigned integer for a number, decode values use actual value
+func EncodeUint(v any) (uint64, error) {
+	switch a := encodeActual(v).(type) {
+	case uint64:
+		return a, nil
+	case int64:
+		if a >= 0 {
+			return uint64(a), nil
+		}
+	case int:
+		if a >= 0 {
+			return uint64(a), nil
+		}
+	case float64:
+		if a >= 0 && a == float64(uint64(a)) {
+			return uint64(a), nil
+		}
+	case *big.Int:
+		if a.IsUint64() {
+			return a.Uint64(), nil
+		}
+	}
+	return 0, fmt.Errorf("expected an unsigned integer, got %s", gojqex.TypeErrorPreview(v))
+}
+
+// EncodeBool returns boolean for a boolean
+func EncodeBool(v any) (bool, error) {
+	b, ok := encodeActual(v).(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a boolean, got %s", gojqex.TypeErrorPreview(v))
+	}
+	return b, nil
+}
+
+// EncodeString returns string for a string, decode values use actual value
+func EncodeString(v any) (string, error) {
+	s, ok := encodeActual(v).(string)
+	if !ok {
+		return "", fmt.Errorf("expected a string, got %s", gojqex.TypeErrorPreview(v))
+	}
+	return s, nil
+}
+
+// EncodeBytes returns bytes for a binary, string or decode value
+func EncodeBytes(v any) ([]byte, error) {
+	re := &decode.E{}
+	if ok, err := EncodeRaw(re, v); err != nil || ok {
+		return re.Bytes(), err
+	}
+	b, err := toBytes(v)
+	if err != nil {
+		return nil, fmt.Errorf("expected a binary or string, got %s", gojqex.TypeErrorPreview(v))
+	}
+	return b, nil
+}
+
+// EncodeSym returns number for v if it's a number or a symbolic name in syms
+func EncodeSym(v any, syms scalar.UToSymStr) (uint64, error) {
+	s, ok := encodeActual(v).(string)
+	if !ok {
+		return EncodeUint(v)
+	}
+	for n, name := range syms {
+		if name == s {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown value %q", s)
+}
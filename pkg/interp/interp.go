@@ -74,6 +74,7 @@ func init() {
 	RegisterIter1("_print_color_json", (*Interp)._printColorJSON)
 
 	RegisterFunc0("_is_completing", (*Interp)._isCompleting)
+	RegisterFunc0("_is_file", (*Interp)._isFile)
 }
 
 type valueError struct {
@@ -160,6 +161,12 @@ type OS interface {
 	History() ([]string, error)
 }
 
+// CreateFS can optionally be implemented by the FS returned by OS.FS() to support writing files
+type CreateFS interface {
+	fs.FS
+	Create(name string) (io.WriteCloser, error)
+}
+
 type FixedFileInfo struct {
 	FName    string
 	FSize    int64
@@ -337,6 +344,10 @@ type Interp struct {
 	interruptStack *ctxstack.Stack
 	// global state, is ref as Interp is cloned per eval
 	state *any
+	// decode and read statistics, is ref as Interp is cloned per eval
+	stats *stats
+	// tofile permission, is ref as Interp is cloned per eval
+	write *writePermission
 
 	// new for each eval, other values are copied by value
 	EvalInstance EvalInstance
@@ -365,6 +376,8 @@ func New(os OS, registry *Registry) (*Interp, error) {
 		}
 	})
 	i.state = new(any)
+	i.stats = &stats{}
+	i.write = &writePermission{}
 
 	return i, nil
 }
@@ -646,6 +659,19 @@ func (i *Interp) _canDisplay(c any) any {
 	return ok
 }
 
+// used by argument parsing to tell files and query apart
+func (i *Interp) _isFile(c any) any {
+	path, ok := c.(string)
+	if !ok {
+		return false
+	}
+	fi, err := fs.Stat(i.OS.FS(), path)
+	if err != nil {
+		return false
+	}
+	return !fi.IsDir()
+}
+
 func (i *Interp) _hexdump(c any, v any) gojq.Iter {
 	opts := OptionsFromValue(v)
 	bv, err := toBinary(c)
@@ -984,6 +1010,7 @@ func (i *Interp) EvalFuncValues(ctx context.Context, c any, name string, args []
 
 type Options struct {
 	Depth          int
+	ArrayLimit     int
 	ArrayTruncate  int
 	Verbose        bool
 	Width          int
@@ -994,37 +1021,79 @@ type Options struct {
 		Ranges [][2]int
 		Value  string
 	}
-	Unicode      bool
-	RawOutput    bool
-	REPL         bool
-	RawString    bool
-	JoinString   string
-	Compact      bool
-	BitsFormat   string
-	LineBytes    int
-	DisplayBytes int
-	Addrbase     int
-	Sizebase     int
-
-	Decorator    Decorator
-	BitsFormatFn func(br bitio.ReaderAtSeeker) (any, error)
+	Unicode        bool
+	RawOutput      bool
+	REPL           bool
+	RawString      bool
+	JoinString     string
+	Compact        bool
+	BitsFormat     string
+	FloatFormat    string
+	FloatPrecision int
+	LineBytes      int
+	LinePrefix     string
+	LineWrap       bool
+	DisplayBytes   int
+	Addrbase       int
+	Sizebase       int
+	DigitGrouping  bool
+	HumanSize      bool
+	DumpVersion    int
+
+	Decorator     Decorator
+	BitsFormatFn  func(br bitio.ReaderAtSeeker) (any, error)
+	FloatFormatFn colorjson.FloatFn
 }
 
 func OptionsFromValue(v any) Options {
 	var opts Options
 	_ = mapstruct.ToStruct(v, &opts)
+	opts.ArrayLimit = mathex.Max(0, opts.ArrayLimit)
 	opts.ArrayTruncate = mathex.Max(0, opts.ArrayTruncate)
 	opts.Depth = mathex.Max(0, opts.Depth)
 	opts.Addrbase = mathex.Clamp(2, 36, opts.Addrbase)
 	opts.Sizebase = mathex.Clamp(2, 36, opts.Sizebase)
 	opts.LineBytes = mathex.Max(0, opts.LineBytes)
 	opts.DisplayBytes = mathex.Max(0, opts.DisplayBytes)
+	if opts.DumpVersion == DumpVersionStable {
+		// stable layout should not depend on terminal or environment
+		opts.Color = false
+		opts.Unicode = false
+		opts.LineBytes = stableLineBytes
+		opts.Addrbase = 16
+		opts.Sizebase = 10
+		opts.DigitGrouping = false
+		opts.HumanSize = false
+		opts.LinePrefix = ""
+		opts.LineWrap = false
+	}
 	opts.Decorator = decoratorFromOptions(opts)
 	opts.BitsFormatFn = bitsFormatFnFromOptions(opts)
+	opts.FloatFormatFn = floatFormatFnFromOptions(opts)
 
 	return opts
 }
 
+// nil means default shortest representation that round trips
+func floatFormatFnFromOptions(opts Options) colorjson.FloatFn {
+	switch opts.FloatFormat {
+	case "fixed":
+		precision := mathex.Max(0, opts.FloatPrecision)
+		return func(f float64) (string, bool) {
+			return strconv.FormatFloat(f, 'f', precision, 64), true
+		}
+	case "hex":
+		// exact but not valid JSON number
+		return func(f float64) (string, bool) {
+			return strconv.FormatFloat(f, 'x', -1, 64), false
+		}
+	case "shortest":
+		fallthrough
+	default:
+		return nil
+	}
+}
+
 func bitsFormatFnFromOptions(opts Options) func(br bitio.ReaderAtSeeker) (any, error) {
 	switch opts.BitsFormat {
 	case "md5":
@@ -1107,6 +1176,20 @@ func (i *Interp) includePaths() []string {
 	return paths
 }
 
+// default if not set from options, ex: when not using the cli
+const defaultReadAheadSize = 512 * 1024
+
+func (i *Interp) readAheadSize() int {
+	switch v := i.lookupState("read_ahead_size").(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	default:
+		return defaultReadAheadSize
+	}
+}
+
 func (i *Interp) slurps() map[string]any {
 	slurpsAny, _ := i.lookupState("slurps").(map[string]any)
 	return slurpsAny
@@ -1128,6 +1211,7 @@ func (i *Interp) NewColorJSON(opts Options) (*colorjson.Encoder, error) {
 			}
 			panic(fmt.Sprintf("toValue not a JQValue value: %#v", v))
 		},
+		opts.FloatFormatFn,
 		colorjson.Colors{
 			Reset:     []byte(ansi.Reset.SetString),
 			Null:      []byte(opts.Decorator.Null.SetString),
@@ -0,0 +1,283 @@
+package interp
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/internal/mathex"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/ranges"
+)
+
+func init() {
+	RegisterFunc1("frombits", (*Interp).fromBits)
+	RegisterFunc2("pack", (*Interp).pack)
+	RegisterFunc2("unpack", (*Interp).unpack)
+}
+
+// pack format is space separated fields with optional name: prefix:
+// u<bits>[le|be]  unsigned integer
+// s<bits>[le|be]  signed integer
+// f<bits>[le|be]  float, 16, 32 or 64 bits
+// <n>s            n bytes string or binary, zero padded or truncated
+// <n>x            n zero bytes, consumes no value
+// default is big endian and little endian requires whole bytes.
+// names are used by unpack to produce an object instead of an array.
+type packField struct {
+	name string
+	kind byte
+	bits int
+	le   bool
+}
+
+var packNumberRe = regexp.MustCompile(`^([usf])(\d+)(le|be)?$`)
+var packBytesRe = regexp.MustCompile(`^(\d+)([sx])$`)
+
+func parsePackFormat(format string) ([]packField, error) {
+	var fields []packField
+	named := 0
+	for _, t := range strings.Fields(format) {
+		var name string
+		if i := strings.Index(t, ":"); i != -1 {
+			if i == 0 {
+				return nil, fmt.Errorf("%s: empty name", t)
+			}
+			name, t = t[0:i], t[i+1:]
+			named++
+		}
+		if sm := packNumberRe.FindStringSubmatch(t); sm != nil {
+			bits, err := strconv.Atoi(sm[2])
+			if err != nil || bits < 1 {
+				return nil, fmt.Errorf("%s: invalid number of bits", t)
+			}
+			f := packField{kind: sm[1][0], bits: bits, le: sm[3] == "le"}
+			if f.kind == 'f' && bits != 16 && bits != 32 && bits != 64 {
+				return nil, fmt.Errorf("%s: float must be 16, 32 or 64 bits", t)
+			}
+			if f.le && bits%8 != 0 {
+				return nil, fmt.Errorf("%s: little endian must be whole bytes", t)
+			}
+			f.name = name
+			fields = append(fields, f)
+		} else if sm := packBytesRe.FindStringSubmatch(t); sm != nil {
+			n, err := strconv.Atoi(sm[1])
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid number of bytes", t)
+			}
+			kind := byte('b')
+			if sm[2] == "x" {
+				kind = 'x'
+			}
+			fields = append(fields, packField{name: name, kind: kind, bits: n * 8})
+		} else {
+			return nil, fmt.Errorf("%s: invalid field", t)
+		}
+	}
+	if named > 0 {
+		for _, f := range fields {
+			if f.name == "" && f.kind != 'x' {
+				return nil, fmt.Errorf("all or no fields must have names")
+			}
+		}
+	}
+	return fields, nil
+}
+
+// unsigned big-endian bytes of v that is assumed to fit in bits, left aligned if not whole bytes
+func packBigInt(v *big.Int, bits int) []byte {
+	buf := make([]byte, (bits+7)/8)
+	new(big.Int).Lsh(v, uint((8-bits%8)%8)).FillBytes(buf)
+	return buf
+}
+
+func packValue(f packField, v any) ([]byte, error) {
+	var buf []byte
+	switch f.kind {
+	case 'b':
+		bs, err := toBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		buf = make([]byte, f.bits/8)
+		copy(buf, bs)
+	case 'f':
+		var fv float64
+		switch v := v.(type) {
+		case int:
+			fv = float64(v)
+		case float64:
+			fv = v
+		case *big.Int:
+			fv, _ = new(big.Float).SetInt(v).Float64()
+		default:
+			return nil, fmt.Errorf("value is not a number")
+		}
+		var n uint64
+		switch f.bits {
+		case 16:
+			n = uint64(mathex.NewFloat16(float32(fv)))
+		case 32:
+			n = uint64(math.Float32bits(float32(fv)))
+		case 64:
+			n = math.Float64bits(fv)
+		}
+		buf = packBigInt(new(big.Int).SetUint64(n), f.bits)
+	default:
+		bi, err := toBigInt(v)
+		if err != nil {
+			return nil, err
+		}
+		limit := new(big.Int).Lsh(big.NewInt(1), uint(f.bits))
+		lo := big.NewInt(0)
+		hi := limit
+		if f.kind == 's' {
+			hi = new(big.Int).Rsh(limit, 1)
+			lo = new(big.Int).Neg(hi)
+		}
+		if bi.Cmp(lo) < 0 || bi.Cmp(hi) >= 0 {
+			return nil, fmt.Errorf("%s does not fit in %d bits", bi, f.bits)
+		}
+		if bi.Sign() < 0 {
+			// two's complement
+			bi = new(big.Int).Add(bi, limit)
+		}
+		buf = packBigInt(bi, f.bits)
+	}
+	if f.le {
+		for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+			buf[i], buf[j] = buf[j], buf[i]
+		}
+	}
+	return buf, nil
+}
+
+func (i *Interp) pack(c any, format string, values []any) any {
+	fields, err := parsePackFormat(format)
+	if err != nil {
+		return err
+	}
+
+	b := &bitio.Buffer{}
+	vi := 0
+	for _, f := range fields {
+		var buf []byte
+		if f.kind == 'x' {
+			buf = make([]byte, f.bits/8)
+		} else {
+			if vi >= len(values) {
+				return fmt.Errorf("got %d values but format has more fields", len(values))
+			}
+			buf, err = packValue(f, values[vi])
+			vi++
+			if err != nil {
+				return fmt.Errorf("value %d: %w", vi-1, err)
+			}
+		}
+		if _, err := b.WriteBits(buf, int64(f.bits)); err != nil {
+			return err
+		}
+	}
+	if vi != len(values) {
+		return fmt.Errorf("format has %d fields but got %d values", vi, len(values))
+	}
+
+	buf, nBits := b.Bits()
+	bb, err := NewBinaryFromBitReader(bitio.NewBitReader(buf, nBits), 8, 0)
+	if err != nil {
+		return err
+	}
+	return bb
+}
+
+func unpackField(d *decode.D, name string, f packField) {
+	var endian decode.Endian = decode.BigEndian
+	if f.le {
+		endian = decode.LittleEndian
+	}
+	switch f.kind {
+	case 'u':
+		if f.bits > 64 {
+			d.FieldUBigIntE(name, f.bits, endian)
+		} else {
+			d.FieldUE(name, f.bits, endian)
+		}
+	case 's':
+		if f.bits > 64 {
+			d.FieldSBigIntE(name, f.bits, endian)
+		} else {
+			d.FieldSE(name, f.bits, endian)
+		}
+	case 'f':
+		d.FieldFE(name, f.bits, endian)
+	case 'b':
+		d.FieldRawLen(name, int64(f.bits))
+	case 'x':
+		d.SeekRel(int64(f.bits))
+	}
+}
+
+func (i *Interp) unpack(c any, format string, v any) any {
+	fields, err := parsePackFormat(format)
+	if err != nil {
+		return err
+	}
+	bv, err := toBinary(v)
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	for _, f := range fields {
+		size += int64(f.bits)
+	}
+	if size > bv.r.Len {
+		return fmt.Errorf("format needs %d bits but got %d", size, bv.r.Len)
+	}
+
+	named := false
+	for _, f := range fields {
+		named = named || f.name != ""
+	}
+	dv, _, err := decode.Decode(i.EvalInstance.Ctx, bv.br, decode.Group{{
+		Name:      "unpack",
+		RootArray: !named,
+		DecodeFn: func(d *decode.D, _ any) any {
+			for _, f := range fields {
+				name := f.name
+				if !named {
+					name = "value"
+				}
+				unpackField(d, name, f)
+			}
+			return nil
+		},
+	}}, decode.Options{
+		IsRoot: true,
+		Range:  ranges.Range{Start: bv.r.Start, Len: size},
+	})
+	if dv == nil {
+		return err
+	}
+
+	return makeDecodeValue(dv, decode.ExtKeyCache{})
+}
+
+func (i *Interp) fromBits(c any, s string) any {
+	s = strings.NewReplacer(" ", "", "_", "").Replace(strings.TrimPrefix(s, "0b"))
+	for j := 0; j < len(s); j++ {
+		if s[j] != '0' && s[j] != '1' {
+			return fmt.Errorf("invalid bit string %q at index %d", s, j)
+		}
+	}
+	buf, nBits := bitio.BytesFromBitString(s)
+	bb, err := NewBinaryFromBitReader(bitio.NewBitReader(buf, nBits), 1, 0)
+	if err != nil {
+		return err
+	}
+	return bb
+}
@@ -5,13 +5,14 @@ import (
 	"math/big"
 	"strconv"
 
+	"github.com/wader/fq/internal/colorjson"
 	"github.com/wader/fq/internal/mathex"
 	"github.com/wader/fq/internal/stringsex"
 	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/scalar"
 )
 
-func previewValue(v any, df scalar.DisplayFormat) string {
+func previewValue(v any, df scalar.DisplayFormat, floatFn colorjson.FloatFn) string {
 	switch vv := v.(type) {
 	case bool:
 		if vv {
@@ -27,6 +28,10 @@ func previewValue(v any, df scalar.DisplayFormat) string {
 	case uint64:
 		return mathex.PadFormatUint(vv, df.FormatBase(), true, 0)
 	case float64:
+		if floatFn != nil {
+			s, _ := floatFn(vv)
+			return s
+		}
 		// TODO: float32? better truncated to significant digits?
 		return strconv.FormatFloat(vv, 'g', -1, 64)
 	case string:
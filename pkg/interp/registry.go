@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/fs"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/wader/fq/internal/gojqex"
@@ -49,6 +50,12 @@ func (r *Registry) format(groupName string, format decode.Format, single bool) {
 }
 
 func (r *Registry) Format(format decode.Format) decode.Format {
+	for _, k := range format.ExtKeys {
+		if !strings.HasPrefix(k.Name, "_") {
+			panic(fmt.Sprintf("%s: ext key %s must start with _", format.Name, k.Name))
+		}
+	}
+
 	r.format(format.Name, format, false)
 	for _, g := range format.Groups {
 		r.format(g, format, true)
@@ -58,6 +65,30 @@ func (r *Registry) Format(format decode.Format) decode.Format {
 	return format
 }
 
+// ExtKey adds an ext key to an already registered format. Ex: an embedder that want to add
+// an application specific key to some format values.
+func (r *Registry) ExtKey(formatName string, key decode.ExtKey) {
+	if r.formatResolved {
+		panic("registry already resolved")
+	}
+	if !strings.HasPrefix(key.Name, "_") {
+		panic(fmt.Sprintf("%s: ext key %s must start with _", formatName, key.Name))
+	}
+
+	found := false
+	for _, g := range r.FormatGroups {
+		for i := range g {
+			if g[i].Name == formatName {
+				g[i].ExtKeys = append(g[i].ExtKeys, key)
+				found = true
+			}
+		}
+	}
+	if !found {
+		panic(fmt.Sprintf("%s: format not registered", formatName))
+	}
+}
+
 func (r *Registry) FS(fs fs.ReadDirFS) {
 	r.FSs = append(r.FSs, fs)
 }
@@ -0,0 +1,170 @@
+package interp
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/wader/fq/internal/mathex"
+	"github.com/wader/gojq"
+)
+
+func init() {
+	RegisterFunc0("fromfloat16", (*Interp).fromFloat16)
+	RegisterFunc0("tofloat16", (*Interp).toFloat16)
+	RegisterFunc0("frombfloat16", (*Interp).fromBFloat16)
+	RegisterFunc0("tobfloat16", (*Interp).toBFloat16)
+	RegisterFunc2("fromfixed", (*Interp).fromFixed)
+	RegisterFunc2("tofixed", (*Interp).toFixed)
+}
+
+// raw unsigned bits from a number or big endian from a binary of exactly nBits,
+// decode values with a number value use the number
+func toRawBits(c any, nBits int) (*big.Int, error) {
+	if jv, ok := c.(gojq.JQValue); ok {
+		if _, isBinary := c.(Binary); !isBinary {
+			switch v := jv.JQValueToGoJQ().(type) {
+			case int, float64, *big.Int:
+				c = v
+			}
+		}
+	}
+
+	switch c.(type) {
+	case int, float64, *big.Int:
+		bi, err := toBigInt(c)
+		if err != nil {
+			return nil, err
+		}
+		if bi.Sign() < 0 || bi.BitLen() > nBits {
+			return nil, fmt.Errorf("%s does not fit in %d bits", bi, nBits)
+		}
+		return bi, nil
+	case ToBinary:
+		bv, err := toBinary(c)
+		if err != nil {
+			return nil, err
+		}
+		if bv.r.Len != int64(nBits) {
+			return nil, fmt.Errorf("binary must be %d bits but is %d", nBits, bv.r.Len)
+		}
+		buf, err := bv.toBytesBuffer(bv.r)
+		if err != nil {
+			return nil, err
+		}
+		// toBytesBuffer left aligns last partial byte
+		bi := new(big.Int).SetBytes(buf.Bytes())
+		return bi.Rsh(bi, uint((8-nBits%8)%8)), nil
+	default:
+		return nil, fmt.Errorf("value is not a number or binary")
+	}
+}
+
+func toFloat(c any) (float64, error) {
+	switch c := c.(type) {
+	case int:
+		return float64(c), nil
+	case float64:
+		return c, nil
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(c).Float64()
+		return f, nil
+	default:
+		return 0, fmt.Errorf("value is not a number")
+	}
+}
+
+func (i *Interp) fromFloat16(c any) any {
+	bi, err := toRawBits(c, 16)
+	if err != nil {
+		return err
+	}
+	return float64(mathex.Float16(bi.Uint64()).Float32())
+}
+
+func (i *Interp) toFloat16(c any) any {
+	f, err := toFloat(c)
+	if err != nil {
+		return err
+	}
+	return int(mathex.NewFloat16(float32(f)))
+}
+
+// bfloat16 is the upper 16 bits of a float32
+func (i *Interp) fromBFloat16(c any) any {
+	bi, err := toRawBits(c, 16)
+	if err != nil {
+		return err
+	}
+	return float64(math.Float32frombits(uint32(bi.Uint64()) << 16))
+}
+
+func (i *Interp) toBFloat16(c any) any {
+	f, err := toFloat(c)
+	if err != nil {
+		return err
+	}
+	u := math.Float32bits(float32(f))
+	if math.IsNaN(f) {
+		// keep it a quiet NaN after truncation
+		return int(u>>16 | 0x40)
+	}
+	// round to nearest even
+	u += 0x7fff + (u>>16)&1
+	return int(u >> 16)
+}
+
+// Qm.n signed fixed point is m+n bits two's complement where m includes the sign bit
+func fixedBits(m int, n int) (int, error) {
+	if m < 1 || n < 0 {
+		return 0, fmt.Errorf("fixed point m must be at least 1 and n not negative")
+	}
+	return m + n, nil
+}
+
+func (i *Interp) fromFixed(c any, m int, n int) any {
+	nBits, err := fixedBits(m, n)
+	if err != nil {
+		return err
+	}
+	bi, err := toRawBits(c, nBits)
+	if err != nil {
+		return err
+	}
+	if bi.Bit(nBits-1) == 1 {
+		bi = new(big.Int).Sub(bi, new(big.Int).Lsh(big.NewInt(1), uint(nBits)))
+	}
+	f, _ := new(big.Float).SetMantExp(new(big.Float).SetInt(bi), -n).Float64()
+	return f
+}
+
+// rounds to nearest and outputs raw unsigned bits
+func (i *Interp) toFixed(c any, m int, n int) any {
+	nBits, err := fixedBits(m, n)
+	if err != nil {
+		return err
+	}
+	f, err := toFloat(c)
+	if err != nil {
+		return err
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("%v can't be represented as fixed point", f)
+	}
+	bf := new(big.Float).SetMantExp(big.NewFloat(f), n)
+	if bf.Sign() >= 0 {
+		bf.Add(bf, big.NewFloat(0.5))
+	} else {
+		bf.Sub(bf, big.NewFloat(0.5))
+	}
+	bi, _ := bf.Int(nil)
+
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(nBits-1))
+	if bi.Cmp(limit) >= 0 || bi.Cmp(new(big.Int).Neg(limit)) < 0 {
+		return fmt.Errorf("%v does not fit in Q%d.%d", f, m, n)
+	}
+	if bi.Sign() < 0 {
+		bi.Add(bi, new(big.Int).Lsh(limit, 1))
+	}
+	return bigIntToValue(bi)
+}
@@ -0,0 +1,119 @@
+package interp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wader/gojq"
+)
+
+func init() {
+	RegisterIter1("scan_bytes", (*Interp)._scanBytes)
+}
+
+// bytePattern matches when input byte & mask == value
+type bytePattern struct {
+	value byte
+	mask  byte
+}
+
+func hexNibble(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	default:
+		return 0, false
+	}
+}
+
+// parse two hex digits where ? is a wildcard nibble, ex "4?" or "??"
+func parseHexByte(s string) (value byte, mask byte, ok bool) {
+	if len(s) != 2 {
+		return 0, 0, false
+	}
+	for _, c := range []byte(s) {
+		value <<= 4
+		mask <<= 4
+		if c == '?' {
+			continue
+		}
+		n, ok := hexNibble(c)
+		if !ok {
+			return 0, 0, false
+		}
+		value |= n
+		mask |= 0xf
+	}
+	return value, mask, true
+}
+
+// parseBytePattern parses space separated or continuous hex bytes where each
+// byte can have wildcard nibbles or an explicit bit mask, ex "ff ?? 4? 80&f0"
+func parseBytePattern(s string) ([]bytePattern, error) {
+	var ps []bytePattern
+	for _, f := range strings.Fields(s) {
+		for len(f) > 0 {
+			if len(f) < 2 {
+				return nil, fmt.Errorf("invalid byte pattern %q", f)
+			}
+			value, mask, ok := parseHexByte(f[0:2])
+			if !ok {
+				return nil, fmt.Errorf("invalid byte pattern %q", f[0:2])
+			}
+			f = f[2:]
+			if len(f) > 0 && f[0] == '&' {
+				if len(f) < 3 {
+					return nil, fmt.Errorf("invalid byte pattern mask %q", f)
+				}
+				m, _, ok := parseHexByte(f[1:3])
+				if !ok || strings.Contains(f[1:3], "?") {
+					return nil, fmt.Errorf("invalid byte pattern mask %q", f[1:3])
+				}
+				mask &= m
+				f = f[3:]
+			}
+			ps = append(ps, bytePattern{value: value & mask, mask: mask})
+		}
+	}
+	if len(ps) == 0 {
+		return nil, fmt.Errorf("empty byte pattern")
+	}
+	return ps, nil
+}
+
+func bytePatternMatch(b []byte, ps []bytePattern) bool {
+	for i, p := range ps {
+		if b[i]&p.mask != p.value {
+			return false
+		}
+	}
+	return true
+}
+
+// outputs byte offset of each non-overlapping match
+func (i *Interp) _scanBytes(c any, pattern string) gojq.Iter {
+	ps, err := parseBytePattern(pattern)
+	if err != nil {
+		return gojq.NewIter(err)
+	}
+	b, err := toBytes(c)
+	if err != nil {
+		return gojq.NewIter(err)
+	}
+
+	off := 0
+	return iterFn(func() (any, bool) {
+		for ; off+len(ps) <= len(b); off++ {
+			if bytePatternMatch(b[off:], ps) {
+				matchOff := off
+				off += len(ps)
+				return matchOff, true
+			}
+		}
+		return nil, false
+	})
+}
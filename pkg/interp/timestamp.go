@@ -0,0 +1,149 @@
+package interp
+
+import (
+	"fmt"
+	"time"
+)
+
+func init() {
+	RegisterFunc0("fromntptime", (*Interp).fromNTPTime)
+	RegisterFunc0("fromfiletime", (*Interp).fromFILETIME)
+	RegisterFunc0("fromhfstime", (*Interp).fromHFSTime)
+	RegisterFunc0("fromdostime", (*Interp).fromDOSTime)
+	RegisterFunc0("fromgpstime", (*Interp).fromGPSTime)
+}
+
+var (
+	ntpEpoch      = time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC)
+	filetimeEpoch = time.Date(1601, time.January, 1, 0, 0, 0, 0, time.UTC)
+	hfsEpoch      = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+	gpsEpoch      = time.Date(1980, time.January, 6, 0, 0, 0, 0, time.UTC)
+)
+
+// UTC times when GPS-UTC offset was incremented
+// https://www.ietf.org/timezones/data/leap-seconds.list
+var gpsLeapSeconds = []time.Time{
+	time.Date(1981, time.July, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(1982, time.July, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(1983, time.July, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(1985, time.July, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(1988, time.January, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(1990, time.January, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(1991, time.January, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(1992, time.July, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(1993, time.July, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(1994, time.July, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(1996, time.January, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(1997, time.July, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(1999, time.January, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(2006, time.January, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(2009, time.January, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(2012, time.July, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(2015, time.July, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC),
+}
+
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// epoch plus seconds and nanoseconds, split to not overflow time.Duration
+func epochAdd(epoch time.Time, sec int64, nsec int64) time.Time {
+	return time.Unix(epoch.Unix()+sec, nsec)
+}
+
+// 32 bit seconds since 1900 and 32 bit fraction
+func (i *Interp) fromNTPTime(c any) any {
+	bi, err := toRawBits(c, 64)
+	if err != nil {
+		return err
+	}
+	v := bi.Uint64()
+	sec := int64(v >> 32)
+	nsec := int64((v & 0xffff_ffff) * 1_000_000_000 >> 32)
+	return formatTimestamp(epochAdd(ntpEpoch, sec, nsec))
+}
+
+// 100ns intervals since 1601
+func (i *Interp) fromFILETIME(c any) any {
+	bi, err := toRawBits(c, 64)
+	if err != nil {
+		return err
+	}
+	v := bi.Uint64()
+	return formatTimestamp(epochAdd(filetimeEpoch, int64(v/10_000_000), int64(v%10_000_000)*100))
+}
+
+// seconds since 1904
+func (i *Interp) fromHFSTime(c any) any {
+	bi, err := toRawBits(c, 32)
+	if err != nil {
+		return err
+	}
+	return formatTimestamp(epochAdd(hfsEpoch, bi.Int64(), 0))
+}
+
+// date in high 16 bits and time in low 16 bits or [date, time] array, local time without zone
+func (i *Interp) fromDOSTime(c any) any {
+	var date, tim uint64
+	if vs, ok := c.([]any); ok {
+		if len(vs) != 2 {
+			return fmt.Errorf("expected [date, time] array")
+		}
+		d, err := toRawBits(vs[0], 16)
+		if err != nil {
+			return fmt.Errorf("date: %w", err)
+		}
+		t, err := toRawBits(vs[1], 16)
+		if err != nil {
+			return fmt.Errorf("time: %w", err)
+		}
+		date, tim = d.Uint64(), t.Uint64()
+	} else {
+		bi, err := toRawBits(c, 32)
+		if err != nil {
+			return err
+		}
+		date, tim = bi.Uint64()>>16, bi.Uint64()&0xffff
+	}
+
+	t := time.Date(
+		1980+int(date>>9),
+		time.Month(date>>5&0xf),
+		int(date&0x1f),
+		int(tim>>11),
+		int(tim>>5&0x3f),
+		int(tim&0x1f)*2,
+		0,
+		time.UTC,
+	)
+	return t.Format("2006-01-02T15:04:05")
+}
+
+// seconds since 1980-01-06 without leap seconds
+func (i *Interp) fromGPSTime(c any) any {
+	var sec int64
+	var nsec int64
+	switch c := c.(type) {
+	case float64:
+		sec = int64(c)
+		nsec = int64((c - float64(sec)) * 1e9)
+	default:
+		bi, err := toRawBits(c, 64)
+		if err != nil {
+			return err
+		}
+		if !bi.IsInt64() {
+			return fmt.Errorf("%s is too large", bi)
+		}
+		sec = bi.Int64()
+	}
+
+	t := epochAdd(gpsEpoch, sec, nsec)
+	for _, l := range gpsLeapSeconds {
+		if !t.Add(-time.Second).Before(l) {
+			t = t.Add(-time.Second)
+		}
+	}
+	return formatTimestamp(t)
+}
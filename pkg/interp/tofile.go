@@ -0,0 +1,61 @@
+package interp
+
+import (
+	"fmt"
+
+	"github.com/wader/fq/internal/bitioex"
+	"github.com/wader/gojq"
+)
+
+func init() {
+	RegisterIter1("_tofile", (*Interp)._toFile)
+	RegisterFunc1("_set_allow_write", (*Interp)._setAllowWrite)
+}
+
+// set once from parsed options before any query is evaluated so that queries
+// can't change it
+type writePermission struct {
+	set   bool
+	allow bool
+}
+
+func (i *Interp) _setAllowWrite(c any, allow bool) any {
+	if i.write.set {
+		return fmt.Errorf("allow write can only be set once")
+	}
+	i.write.set = true
+	i.write.allow = allow
+	return nil
+}
+
+// writes input binary or string to path and outputs empty
+func (i *Interp) _toFile(c any, path string) gojq.Iter {
+	if !i.write.allow {
+		return gojq.NewIter(fmt.Errorf("%s: writing files is not allowed, use --allow-write", path))
+	}
+	cfs, ok := i.OS.FS().(CreateFS)
+	if !ok {
+		return gojq.NewIter(fmt.Errorf("%s: file system does not support writing", path))
+	}
+	br, err := ToBitReader(c)
+	if err != nil {
+		return gojq.NewIter(err)
+	}
+	if i.EvalInstance.IsCompleting {
+		return gojq.NewIter()
+	}
+
+	w, err := cfs.Create(path)
+	if err != nil {
+		return gojq.NewIter(err)
+	}
+	if _, err := bitioex.CopyBits(w, br); err != nil {
+		w.Close()
+		return gojq.NewIter(err)
+	}
+	if err := w.Close(); err != nil {
+		return gojq.NewIter(err)
+	}
+
+	return gojq.NewIter()
+}
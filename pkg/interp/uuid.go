@@ -0,0 +1,73 @@
+package interp
+
+import (
+	"fmt"
+)
+
+// https://datatracker.ietf.org/doc/html/rfc4122
+
+func init() {
+	RegisterFunc1("_touuid", (*Interp)._toUUID)
+	RegisterFunc1("_uuid_fields", (*Interp)._uuidFields)
+}
+
+type uuidOpts struct {
+	GUID bool
+}
+
+// microsoft GUID layout has the first three groups little endian
+func toUUIDBytes(c any, opts uuidOpts) ([]byte, error) {
+	b, err := toBytes(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 16 {
+		return nil, fmt.Errorf("uuid must be 16 bytes but is %d", len(b))
+	}
+	if opts.GUID {
+		b = []byte{
+			b[3], b[2], b[1], b[0],
+			b[5], b[4],
+			b[7], b[6],
+			b[8], b[9], b[10], b[11], b[12], b[13], b[14], b[15],
+		}
+	}
+	return b, nil
+}
+
+func formatUUID(b []byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func uuidVariant(b []byte) string {
+	switch {
+	case b[8]&0x80 == 0:
+		return "ncs"
+	case b[8]&0xc0 == 0x80:
+		return "rfc4122"
+	case b[8]&0xe0 == 0xc0:
+		return "microsoft"
+	default:
+		return "future"
+	}
+}
+
+func (i *Interp) _toUUID(c any, opts uuidOpts) any {
+	b, err := toUUIDBytes(c, opts)
+	if err != nil {
+		return err
+	}
+	return formatUUID(b)
+}
+
+func (i *Interp) _uuidFields(c any, opts uuidOpts) any {
+	b, err := toUUIDBytes(c, opts)
+	if err != nil {
+		return err
+	}
+	return map[string]any{
+		"uuid":    formatUUID(b),
+		"version": int(b[6] >> 4),
+		"variant": uuidVariant(b),
+	}
+}
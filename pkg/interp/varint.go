@@ -0,0 +1,135 @@
+package interp
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/wader/fq/pkg/bitio"
+)
+
+func init() {
+	RegisterFunc0("toleb128", (*Interp).toLEB128)
+	RegisterFunc0("fromleb128", (*Interp).fromLEB128)
+	RegisterFunc0("tosleb128", (*Interp).toSLEB128)
+	RegisterFunc0("fromsleb128", (*Interp).fromSLEB128)
+	RegisterFunc0("tozigzag", (*Interp).toZigZag)
+	RegisterFunc0("fromzigzag", (*Interp).fromZigZag)
+}
+
+var bigInt7Mask = big.NewInt(0x7f)
+
+func bigIntToValue(bi *big.Int) any {
+	if bi.IsInt64() {
+		if v := bi.Int64(); v >= math.MinInt && v <= math.MaxInt {
+			return int(v)
+		}
+	}
+	return bi
+}
+
+func toVarintBigInt(c any) (*big.Int, error) {
+	switch c.(type) {
+	case int, float64, *big.Int:
+		return toBigInt(c)
+	default:
+		return nil, fmt.Errorf("value is not a number")
+	}
+}
+
+// 7 bits per byte least significant group first, high bit set if more bytes follow
+func appendLEB128(buf []byte, bi *big.Int, signed bool) []byte {
+	v := new(big.Int).Set(bi)
+	g := new(big.Int)
+	for {
+		b := byte(g.And(v, bigInt7Mask).Uint64())
+		// arithmetic shift for negative numbers
+		v.Rsh(v, 7)
+		var done bool
+		if signed {
+			done = (v.Sign() == 0 && b&0x40 == 0) || (v.Cmp(big.NewInt(-1)) == 0 && b&0x40 != 0)
+		} else {
+			done = v.Sign() == 0
+		}
+		if done {
+			return append(buf, b)
+		}
+		buf = append(buf, b|0x80)
+	}
+}
+
+// reads leading LEB128 from b and ignores trailing bytes
+func readLEB128(b []byte, signed bool) (*big.Int, error) {
+	v := new(big.Int)
+	for i, c := range b {
+		v.Or(v, new(big.Int).Lsh(big.NewInt(int64(c&0x7f)), uint(i*7)))
+		if c&0x80 != 0 {
+			continue
+		}
+		if signed && c&0x40 != 0 {
+			v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint((i+1)*7)))
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("unterminated LEB128")
+}
+
+func (i *Interp) toLEB128Ex(c any, signed bool) any {
+	bi, err := toVarintBigInt(c)
+	if err != nil {
+		return err
+	}
+	if !signed && bi.Sign() < 0 {
+		return fmt.Errorf("unsigned LEB128 can't be negative")
+	}
+	bb, err := NewBinaryFromBitReader(bitio.NewBitReader(appendLEB128(nil, bi, signed), -1), 8, 0)
+	if err != nil {
+		return err
+	}
+	return bb
+}
+
+func (i *Interp) fromLEB128Ex(c any, signed bool) any {
+	b, err := toBytes(c)
+	if err != nil {
+		return err
+	}
+	bi, err := readLEB128(b, signed)
+	if err != nil {
+		return err
+	}
+	return bigIntToValue(bi)
+}
+
+func (i *Interp) toLEB128(c any) any    { return i.toLEB128Ex(c, false) }
+func (i *Interp) fromLEB128(c any) any  { return i.fromLEB128Ex(c, false) }
+func (i *Interp) toSLEB128(c any) any   { return i.toLEB128Ex(c, true) }
+func (i *Interp) fromSLEB128(c any) any { return i.fromLEB128Ex(c, true) }
+
+// zigzag maps signed to unsigned as 0, -1, 1, -2, 2... => 0, 1, 2, 3, 4...
+func (i *Interp) toZigZag(c any) any {
+	bi, err := toVarintBigInt(c)
+	if err != nil {
+		return err
+	}
+	z := new(big.Int).Lsh(bi, 1)
+	if bi.Sign() < 0 {
+		z.Neg(z).Sub(z, big.NewInt(1))
+	}
+	return bigIntToValue(z)
+}
+
+func (i *Interp) fromZigZag(c any) any {
+	bi, err := toVarintBigInt(c)
+	if err != nil {
+		return err
+	}
+	if bi.Sign() < 0 {
+		return fmt.Errorf("zigzag value can't be negative")
+	}
+	v := new(big.Int).Rsh(bi, 1)
+	if bi.Bit(0) == 1 {
+		v.Neg(v).Sub(v, big.NewInt(1))
+	}
+	return bigIntToValue(v)
+}